@@ -189,7 +189,7 @@ func (b *bwRate) toByte() (bits uint8) {
 	return bits
 }
 
-// readInt converts two bytes to int16
-func readIntLE(msb byte, lsb byte) int32 {
-	return int32(uint16(msb) | uint16(lsb)<<8)
+// readIntLE converts two bytes, low byte first, to a signed value
+func readIntLE(lsb byte, msb byte) int32 {
+	return int32(int16(uint16(lsb) | uint16(msb)<<8))
 }
@@ -0,0 +1,178 @@
+package adxl345_test
+
+import (
+	"machine"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/adxl345"
+)
+
+// chip simulates the registers of an ADXL345 through the I2C hooks of the
+// machine package. While fifo is not empty, a read of the data registers
+// pops its oldest sample.
+type chip struct {
+	regs      [64]byte
+	fifo      [][6]byte
+	writes    []uint8 // registers in the order written
+	dataReads int
+}
+
+func newChip(t *testing.T) (*chip, adxl345.Device) {
+	c := &chip{}
+	machine.ReadHook = func(addr, reg uint8, buf []byte) error {
+		if addr != adxl345.AddressLow {
+			t.Errorf("read from address %#x", addr)
+		}
+		if reg == adxl345.REG_DATAX0 && len(c.fifo) > 0 {
+			c.dataReads++
+			copy(buf, c.fifo[0][:])
+			c.fifo = c.fifo[1:]
+			c.regs[adxl345.REG_FIFO_STATUS] = c.regs[adxl345.REG_FIFO_STATUS]&0xC0 | uint8(len(c.fifo))
+			return nil
+		}
+		copy(buf, c.regs[reg:])
+		return nil
+	}
+	machine.WriteHook = func(addr, reg uint8, buf []byte) error {
+		copy(c.regs[reg:], buf)
+		c.writes = append(c.writes, reg)
+		return nil
+	}
+	t.Cleanup(func() { machine.ReadHook, machine.WriteHook = nil, nil })
+	d := adxl345.New(machine.I2C0)
+	d.Configure()
+	c.writes = nil
+	return c, d
+}
+
+// sample returns the data registers of a raw sample.
+func sample(x, y, z int16) [6]byte {
+	return [6]byte{byte(x), byte(x >> 8), byte(y), byte(y >> 8), byte(z), byte(z >> 8)}
+}
+
+// TestReadAcceleration checks that negative raw values keep their sign.
+func TestReadAcceleration(t *testing.T) {
+	c, d := newChip(t)
+	s := sample(-256, 1, -32768)
+	copy(c.regs[adxl345.REG_DATAX0:], s[:])
+	x, y, z, err := d.ReadAcceleration()
+	// 4 mg per unit at ±2 g
+	if x != -1024 || y != 4 || z != -131072 || err != nil {
+		t.Errorf("got %d, %d, %d, %v, want -1024, 4, -131072", x, y, z, err)
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(adxl345.FIFO_STREAM, 20, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.regs[adxl345.REG_FIFO_CTL]; got != 0xB4 {
+		t.Errorf("FIFO_CTL: got %#02x, want 0xb4", got)
+	}
+
+	for i := int16(0); i < 5; i++ {
+		c.fifo = append(c.fifo, sample(i, -i, 256))
+	}
+	// FIFO_TRIG is not part of the count
+	c.regs[adxl345.REG_FIFO_STATUS] = 0x80 | 5
+	if n, err := d.FIFOCount(); n != 5 || err != nil {
+		t.Errorf("FIFOCount: got %d, %v, want 5", n, err)
+	}
+
+	samples := make([][3]int32, 8)
+	n, err := d.ReadFIFO(samples[:3])
+	if n != 3 || err != nil || c.dataReads != 3 {
+		t.Fatalf("got %d samples in %d reads, %v, want 3", n, c.dataReads, err)
+	}
+	n, err = d.ReadFIFO(samples[3:])
+	if n != 2 || err != nil || c.dataReads != 5 {
+		t.Fatalf("got %d samples in %d reads, %v, want 2", n, c.dataReads-3, err)
+	}
+	for i, s := range samples[:5] {
+		if want := [3]int32{int32(i) * 4, -int32(i) * 4, 1024}; s != want {
+			t.Errorf("sample %d: got %v, want %v", i, s, want)
+		}
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureInterrupts(adxl345.INT_SINGLE_TAP|adxl345.INT_WATERMARK, adxl345.INT_WATERMARK); err != nil {
+		t.Fatal(err)
+	}
+	// mapped before they are enabled
+	if len(c.writes) != 2 || c.writes[0] != adxl345.REG_INT_MAP || c.writes[1] != adxl345.REG_INT_ENABLE {
+		t.Errorf("wrote registers %#02x", c.writes)
+	}
+	if c.regs[adxl345.REG_INT_MAP] != 0x02 || c.regs[adxl345.REG_INT_ENABLE] != 0x42 {
+		t.Errorf("INT_MAP %#02x, INT_ENABLE %#02x", c.regs[adxl345.REG_INT_MAP], c.regs[adxl345.REG_INT_ENABLE])
+	}
+	c.regs[adxl345.REG_INT_SOUCE] = 0x83
+	if ints, err := d.ReadInterrupts(); ints != adxl345.INT_DATA_READY|adxl345.INT_WATERMARK|adxl345.INT_OVERRUN || err != nil {
+		t.Errorf("got %#02x, %v", ints, err)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(d *adxl345.Device) error
+		regs      map[uint8]uint8
+	}{
+		{"tap", func(d *adxl345.Device) error {
+			return d.ConfigureTap(adxl345.TapConfig{
+				Threshold: 3040000,
+				Duration:  10 * time.Millisecond,
+				Latency:   20 * time.Millisecond,
+				Window:    300 * time.Millisecond,
+				Axes:      adxl345.AXIS_ALL | 0x08,
+			})
+		}, map[uint8]uint8{
+			// 62.5 mg, 625 µs and 1.25 ms per unit
+			adxl345.REG_THRESH_TAP: 49,
+			adxl345.REG_DUR:        16,
+			adxl345.REG_LATENT:     16,
+			adxl345.REG_WINDOW:     240,
+			adxl345.REG_TAP_AXES:   0x07,
+		}},
+		{"tap limits", func(d *adxl345.Device) error {
+			return d.ConfigureTap(adxl345.TapConfig{Threshold: 20000000, Duration: time.Second, Latency: -time.Millisecond})
+		}, map[uint8]uint8{
+			adxl345.REG_THRESH_TAP: 255,
+			adxl345.REG_DUR:        255,
+			adxl345.REG_LATENT:     0,
+			adxl345.REG_WINDOW:     0,
+		}},
+		{"free fall", func(d *adxl345.Device) error {
+			return d.ConfigureFreeFall(400000, 100*time.Millisecond)
+		}, map[uint8]uint8{
+			adxl345.REG_THRESH_FF: 6,
+			adxl345.REG_TIME_FF:   20,
+		}},
+		{"activity", func(d *adxl345.Device) error {
+			return d.ConfigureActivity(250000, 190000, 5*time.Second, adxl345.AXIS_X|adxl345.AXIS_Z)
+		}, map[uint8]uint8{
+			adxl345.REG_THRESH_ACT:    4,
+			adxl345.REG_THRESH_INACT:  3,
+			adxl345.REG_TIME_INACT:    5,
+			adxl345.REG_ACT_INACT_CTL: 0xDD,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, d := newChip(t)
+			for reg := range tc.regs {
+				c.regs[reg] = 0xA8
+			}
+			if err := tc.configure(&d); err != nil {
+				t.Fatal(err)
+			}
+			for reg, want := range tc.regs {
+				if got := c.regs[reg]; got != want {
+					t.Errorf("register %#02x: got %d, want %d", reg, got, want)
+				}
+			}
+		})
+	}
+}
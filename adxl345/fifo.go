@@ -0,0 +1,52 @@
+package adxl345
+
+// FIFOMode is the mode of the FIFO of 32 samples.
+type FIFOMode uint8
+
+// ConfigureFIFO sets the mode of the FIFO and its watermark, the number of
+// samples from 1 to 31 at which INT_WATERMARK is raised. In
+// FIFO_TRIGGER mode, the watermark is instead the number of samples kept
+// from before the trigger, which is an INT_ACTIVITY, INT_SINGLE_TAP or other
+// interrupt mapped to INT1, or to INT2 if trigger2 is true.
+func (d *Device) ConfigureFIFO(mode FIFOMode, watermark uint8, trigger2 bool) error {
+	ctl := uint8(mode)<<6 | watermark&0x1F
+	if trigger2 {
+		ctl |= 0x20
+	}
+	return d.bus.WriteRegister(uint8(d.Address), REG_FIFO_CTL, []byte{ctl})
+}
+
+// FIFOCount returns the number of samples in the FIFO.
+func (d *Device) FIFOCount() (int, error) {
+	data := []byte{0}
+	err := d.bus.ReadRegister(uint8(d.Address), REG_FIFO_STATUS, data)
+	return int(data[0] & 0x3F), err
+}
+
+// ReadFIFO reads the oldest samples of the FIFO into samples, as x, y and z
+// in the units of ReadAcceleration, and returns how many it read: at most
+// len(samples), and at most the number in the FIFO.
+func (d *Device) ReadFIFO(samples [][3]int32) (int, error) {
+	count, err := d.FIFOCount()
+	if err != nil {
+		return 0, err
+	}
+	if count > len(samples) {
+		count = len(samples)
+	}
+	// Each read of the data registers pops one sample, so they are read one
+	// by one; the time the bus takes is more than the 5 µs the FIFO needs
+	// between them.
+	data := []byte{0, 0, 0, 0, 0, 0}
+	for i := 0; i < count; i++ {
+		if err := d.bus.ReadRegister(uint8(d.Address), REG_DATAX0, data); err != nil {
+			return i, err
+		}
+		samples[i] = [3]int32{
+			d.dataFormat.convertToIS(readIntLE(data[0], data[1])),
+			d.dataFormat.convertToIS(readIntLE(data[2], data[3])),
+			d.dataFormat.convertToIS(readIntLE(data[4], data[5])),
+		}
+	}
+	return count, nil
+}
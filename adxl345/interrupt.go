@@ -0,0 +1,110 @@
+package adxl345
+
+import "time"
+
+// Interrupt is a set of interrupts, with the bits of REG_INT_ENABLE.
+type Interrupt uint8
+
+// Axes is a set of axes, for the detection of taps and activity.
+type Axes uint8
+
+// ConfigureInterrupts enables the interrupts in enabled. Those also in int2
+// are signaled on the INT2 pin, the others on INT1. The pins are active high.
+func (d *Device) ConfigureInterrupts(enabled, int2 Interrupt) error {
+	// map before enabling, so that no interrupt goes to the wrong pin
+	err := d.bus.WriteRegister(uint8(d.Address), REG_INT_MAP, []byte{uint8(int2)})
+	if err != nil {
+		return err
+	}
+	return d.bus.WriteRegister(uint8(d.Address), REG_INT_ENABLE, []byte{uint8(enabled)})
+}
+
+// ReadInterrupts returns the interrupts raised, and clears those of taps,
+// activity, inactivity and free fall. The others are cleared by reading the
+// data: ReadAcceleration for INT_DATA_READY and ReadFIFO for INT_WATERMARK
+// and INT_OVERRUN.
+func (d *Device) ReadInterrupts() (Interrupt, error) {
+	data := []byte{0}
+	err := d.bus.ReadRegister(uint8(d.Address), REG_INT_SOUCE, data)
+	return Interrupt(data[0]), err
+}
+
+// TapConfig configures the detection of taps.
+type TapConfig struct {
+	// Threshold is the acceleration of a tap, in µg, up to 16 g.
+	Threshold int32
+
+	// Duration is the longest time the acceleration of a tap stays above
+	// the threshold, up to 159 ms.
+	Duration time.Duration
+
+	// Latency is the time after a tap before the window for a second tap,
+	// and Window the length of that window, both up to 318 ms. Double taps
+	// are only detected if both are set.
+	Latency time.Duration
+	Window  time.Duration
+
+	// Axes are the axes on which taps are detected.
+	Axes Axes
+}
+
+// ConfigureTap configures the detection of single and double taps, which
+// raise INT_SINGLE_TAP and INT_DOUBLE_TAP.
+func (d *Device) ConfigureTap(cfg TapConfig) error {
+	return d.writeRegisters(
+		REG_THRESH_TAP, scale(int64(cfg.Threshold), 62500),
+		REG_DUR, scale(int64(cfg.Duration), int64(625*time.Microsecond)),
+		REG_LATENT, scale(int64(cfg.Latency), int64(1250*time.Microsecond)),
+		REG_WINDOW, scale(int64(cfg.Window), int64(1250*time.Microsecond)),
+		REG_TAP_AXES, uint8(cfg.Axes&AXIS_ALL),
+	)
+}
+
+// ConfigureFreeFall configures the detection of free fall, which raises
+// INT_FREE_FALL when the acceleration on all axes stays below threshold, in
+// µg, for duration, up to 1.275 s. Typical values are 300 mg to 600 mg and
+// 100 ms to 350 ms.
+func (d *Device) ConfigureFreeFall(threshold int32, duration time.Duration) error {
+	return d.writeRegisters(
+		REG_THRESH_FF, scale(int64(threshold), 62500),
+		REG_TIME_FF, scale(int64(duration), int64(5*time.Millisecond)),
+	)
+}
+
+// ConfigureActivity configures the detection of activity and inactivity on
+// axes. INT_ACTIVITY is raised when the change of acceleration on any of the
+// axes exceeds activity, in µg, and INT_INACTIVITY when it stays below
+// inactivity for duration, up to 255 s. Changes are measured from the
+// acceleration at the start of the detection, so that gravity is ignored.
+func (d *Device) ConfigureActivity(activity, inactivity int32, duration time.Duration, axes Axes) error {
+	axes &= AXIS_ALL
+	return d.writeRegisters(
+		REG_THRESH_ACT, scale(int64(activity), 62500),
+		REG_THRESH_INACT, scale(int64(inactivity), 62500),
+		REG_TIME_INACT, scale(int64(duration), int64(time.Second)),
+		// ac-coupled activity and inactivity
+		REG_ACT_INACT_CTL, 0x88|uint8(axes)<<4|uint8(axes),
+	)
+}
+
+// writeRegisters writes pairs of register and value.
+func (d *Device) writeRegisters(pairs ...uint8) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := d.bus.WriteRegister(uint8(d.Address), pairs[i], pairs[i+1:i+2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scale returns v in units of lsb, rounded and limited to a register.
+func scale(v, lsb int64) uint8 {
+	v = (v + lsb/2) / lsb
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
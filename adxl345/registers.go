@@ -59,3 +59,31 @@ const (
 	REG_FIFO_CTL       = 0x38 // R/W,   00000000,   FIFO control
 	REG_FIFO_STATUS    = 0x39 // R,     00000000,   FIFO status
 )
+
+// FIFO modes.
+const (
+	FIFO_BYPASS  FIFOMode = 0 // no FIFO
+	FIFO_FIFO    FIFOMode = 1 // collect samples until full, then stop
+	FIFO_STREAM  FIFOMode = 2 // keep the latest samples, dropping the oldest
+	FIFO_TRIGGER FIFOMode = 3 // keep the latest samples until a trigger, then collect until full
+)
+
+// Interrupts.
+const (
+	INT_DATA_READY Interrupt = 0x80
+	INT_SINGLE_TAP Interrupt = 0x40
+	INT_DOUBLE_TAP Interrupt = 0x20
+	INT_ACTIVITY   Interrupt = 0x10
+	INT_INACTIVITY Interrupt = 0x08
+	INT_FREE_FALL  Interrupt = 0x04
+	INT_WATERMARK  Interrupt = 0x02
+	INT_OVERRUN    Interrupt = 0x01
+)
+
+// Axes for taps and activity.
+const (
+	AXIS_X   Axes = 0x04
+	AXIS_Y   Axes = 0x02
+	AXIS_Z   Axes = 0x01
+	AXIS_ALL Axes = AXIS_X | AXIS_Y | AXIS_Z
+)
@@ -0,0 +1,111 @@
+// Package ahrs estimates the orientation of a device, as a quaternion or as
+// roll, pitch and heading, from the readings of an accelerometer, a
+// gyroscope and optionally a magnetometer, with the filters of Madgwick or
+// Mahony.
+//
+// Readings are in the units of the drivers: µg for accelerometers such as
+// the lsm6ds3 and mpu6050, µ°/s for gyroscopes, and any unit for
+// magnetometers such as the mag3110. The axes of the sensors must agree, and
+// the device is taken to have x forward, y to the left and z up. A sensor
+// mounted otherwise can be turned with the Matrix of a
+// calibration.Correction, which also corrects its bias:
+//
+//	imu := lsm6ds3.New(machine.I2C0)
+//	imu.Configure(lsm6ds3.Configuration{})
+//	mag := mag3110.New(machine.I2C0)
+//	mag.Configure()
+//	a := ahrs.New(ahrs.NewMadgwick(0.1),
+//		calibration.NoError(imu.ReadAcceleration),
+//		calibration.NoError(imu.ReadRotation),
+//		calibration.Int16(mag.ReadMagnetic))
+//	for {
+//		a.Update()
+//		roll, pitch, heading := a.Quaternion().Euler()
+//		time.Sleep(10 * time.Millisecond)
+//	}
+package ahrs // import "tinygo.org/x/drivers/ahrs"
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers/calibration"
+)
+
+// Reading is a reading of the sensors.
+type Reading struct {
+	Accel [3]int32 // in µg
+	Gyro  [3]int32 // in µ°/s
+
+	// Mag is the magnetic field, in any unit, or zero without a
+	// magnetometer, in which case the heading is only kept by the
+	// gyroscope and drifts.
+	Mag [3]int32
+}
+
+// Filter estimates the orientation of a device from readings.
+type Filter interface {
+	// Update updates the orientation with a reading taken dt after the
+	// previous one.
+	Update(r Reading, dt time.Duration)
+
+	Quaternion() Quaternion
+	SetQuaternion(q Quaternion)
+}
+
+// AHRS reads the sensors of a device and estimates its orientation.
+type AHRS struct {
+	Filter Filter
+
+	accel, gyro, mag calibration.ReadFunc
+	reading          Reading
+	last             time.Time
+}
+
+// New returns an AHRS reading the accelerometer, gyroscope and, if not nil,
+// magnetometer of a device.
+func New(filter Filter, accel, gyro, mag calibration.ReadFunc) *AHRS {
+	return &AHRS{Filter: filter, accel: accel, gyro: gyro, mag: mag}
+}
+
+// Update reads the sensors and updates the orientation. It should be called
+// at a steady rate, typically 100 times a second. The first call sets the
+// orientation from the acceleration and the magnetic field.
+func (a *AHRS) Update() error {
+	r := &a.reading
+	var err error
+	if r.Accel[0], r.Accel[1], r.Accel[2], err = a.accel(); err != nil {
+		return err
+	}
+	if r.Gyro[0], r.Gyro[1], r.Gyro[2], err = a.gyro(); err != nil {
+		return err
+	}
+	if a.mag != nil {
+		if r.Mag[0], r.Mag[1], r.Mag[2], err = a.mag(); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if a.last.IsZero() {
+		a.Filter.SetQuaternion(FromReading(r.Accel, r.Mag))
+	} else {
+		a.Filter.Update(*r, now.Sub(a.last))
+	}
+	a.last = now
+	return nil
+}
+
+// Reading returns the last reading of the sensors.
+func (a *AHRS) Reading() Reading {
+	return a.reading
+}
+
+// Quaternion returns the orientation.
+func (a *AHRS) Quaternion() Quaternion {
+	return a.Filter.Quaternion()
+}
+
+// Reset makes the next Update set the orientation again from the
+// acceleration and the magnetic field.
+func (a *AHRS) Reset() {
+	a.last = time.Time{}
+}
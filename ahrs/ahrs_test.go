@@ -0,0 +1,277 @@
+package ahrs_test
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/ahrs"
+	"tinygo.org/x/drivers/sensorlog"
+)
+
+const motionLog = "testdata/motion.bin"
+
+var update = flag.Bool("update", false, "regenerate "+motionLog)
+
+// TestFilters replays the motion log through both filters, with and without
+// the magnetometer, and checks the error of the angles against the
+// reference angles of the log once the filters have settled.
+//
+// The log is synthetic, not recorded: no IMU with a reference was available.
+// So this test does not meet the validation against recorded motion that the
+// package was asked for. It shows that the filters converge on readings with
+// noise, bias and shaking, and a recorded log should replace it.
+func TestFilters(t *testing.T) {
+	if *update {
+		if err := writeMotionLog(motionLog); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		filter func() ahrs.Filter
+		mag    bool
+		rms    [3]float64 // roll, pitch and heading, in degrees
+		max    [3]float64
+	}{
+		{"Madgwick", func() ahrs.Filter { return ahrs.NewMadgwick(0.1) }, true, [3]float64{2.5, 2.5, 3.5}, [3]float64{5, 5, 7.5}},
+		{"Mahony", func() ahrs.Filter { return ahrs.NewMahony(1, 0.02) }, true, [3]float64{1.2, 1.2, 1.5}, [3]float64{2.5, 2.5, 3.5}},
+		{"MadgwickNoMag", func() ahrs.Filter { return ahrs.NewMadgwick(0.1) }, false, [3]float64{3, 3}, [3]float64{6, 6}},
+		{"MahonyNoMag", func() ahrs.Filter { return ahrs.NewMahony(1, 0.02) }, false, [3]float64{1.2, 1.2}, [3]float64{2.5, 2.5}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rms, max, err := replay(motionLog, tc.filter(), tc.mag, 10*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, name := range [3]string{"roll", "pitch", "heading"} {
+				if i == 2 && !tc.mag {
+					// the heading starts at 0 without a magnetometer, and
+					// drifts with the bias of the gyroscope
+					break
+				}
+				t.Logf("%s error: rms %.2f°, max %.2f°", name, rms[i], max[i])
+				if rms[i] > tc.rms[i] || max[i] > tc.max[i] {
+					t.Errorf("%s error: rms %.2f°, max %.2f°, want at most %.2f° and %.2f°", name, rms[i], max[i], tc.rms[i], tc.max[i])
+				}
+			}
+		})
+	}
+}
+
+// replay runs filter on the readings of a log, and returns the RMS and
+// maximum errors of roll, pitch and heading after settle.
+func replay(name string, filter ahrs.Filter, mag bool, settle time.Duration) (rms, max [3]float64, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return rms, max, err
+	}
+	defer f.Close()
+	dec := sensorlog.NewDecoder(bufio.NewReader(f))
+	var start, last time.Time
+	var sum2 [3]float64
+	count := 0
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rms, max, err
+		}
+		v := rec.Values
+		r := ahrs.Reading{
+			Accel: [3]int32{v[0], v[1], v[2]},
+			Gyro:  [3]int32{v[3], v[4], v[5]},
+		}
+		if mag {
+			r.Mag = [3]int32{v[6], v[7], v[8]}
+		}
+		if last.IsZero() {
+			filter.SetQuaternion(ahrs.FromReading(r.Accel, r.Mag))
+			start = rec.Time
+		} else {
+			filter.Update(r, rec.Time.Sub(last))
+		}
+		last = rec.Time
+		if rec.Time.Sub(start) < settle {
+			continue
+		}
+		roll, pitch, heading := filter.Quaternion().Euler()
+		for i, estimate := range [3]float32{roll, pitch, heading} {
+			ref := float64(v[9+i]) / 100
+			d := math.Abs(math.Mod(float64(estimate)-ref+540, 360) - 180)
+			sum2[i] += d * d
+			max[i] = math.Max(max[i], d)
+		}
+		count++
+	}
+	if dec.Skipped != 0 || count == 0 {
+		return rms, max, io.ErrUnexpectedEOF
+	}
+	for i := range rms {
+		rms[i] = math.Sqrt(sum2[i] / float64(count))
+	}
+	return rms, max, nil
+}
+
+// The motion log is generated from a model of a handheld device: it rests
+// for two seconds, then rolls, pitches and turns around by several
+// overlapping oscillations while it is shaken. The readings are those of a
+// 100 Hz IMU with white noise, a constant gyroscope bias and a magnetometer
+// in a field of 48 µT with an inclination of 64°. The log also holds the
+// true angles. It is not a recording of real motion.
+const (
+	motionRate     = 100 // Hz
+	motionDuration = 40 * time.Second
+	inclination    = 64 * math.Pi / 180
+	fieldStrength  = 4800 // in the unit of mx, my and mz, 10 nT
+)
+
+var gyroBias = [3]float64{0.2, -0.15, 0.1} // in °/s
+
+// motion returns roll, pitch and heading in degrees at t seconds.
+func motion(t float64) (roll, pitch, heading float64) {
+	if t < 2 {
+		return 0, 0, 30
+	}
+	t -= 2
+	// fade the oscillations in from rest
+	ramp := math.Min(t/3, 1)
+	sin := func(period float64) float64 { return math.Sin(2 * math.Pi * t / period) }
+	roll = ramp * (30*sin(7) + 10*sin(2.3))
+	pitch = ramp * (20*sin(11) + 5*sin(3.1))
+	heading = 30 + ramp*(170*sin(23)+15*sin(4.7))
+	return roll, pitch, heading
+}
+
+// linearAcceleration returns the acceleration of the device in the Earth
+// frame in g, besides gravity.
+func linearAcceleration(t float64) [3]float64 {
+	if t < 2 {
+		return [3]float64{}
+	}
+	return [3]float64{
+		0.05 * math.Sin(2*math.Pi*t/1.7),
+		0.05 * math.Cos(2*math.Pi*t/2.9),
+		0.03 * math.Sin(2*math.Pi*t/1.3),
+	}
+}
+
+// quat is a float64 quaternion, for the model.
+type quat struct{ w, x, y, z float64 }
+
+func (q quat) mul(r quat) quat {
+	return quat{
+		q.w*r.w - q.x*r.x - q.y*r.y - q.z*r.z,
+		q.w*r.x + q.x*r.w + q.y*r.z - q.z*r.y,
+		q.w*r.y - q.x*r.z + q.y*r.w + q.z*r.x,
+		q.w*r.z + q.x*r.y - q.y*r.x + q.z*r.w,
+	}
+}
+
+func (q quat) conj() quat { return quat{q.w, -q.x, -q.y, -q.z} }
+
+// toSensor rotates v from the Earth frame to the frame of the sensor.
+func (q quat) toSensor(v [3]float64) [3]float64 {
+	p := q.conj().mul(quat{0, v[0], v[1], v[2]}).mul(q)
+	return [3]float64{p.x, p.y, p.z}
+}
+
+// orientation returns the quaternion of the angles of motion at t: the
+// heading and pitch turn about -z and -y of the north-west-up frame.
+func orientation(t float64) quat {
+	roll, pitch, heading := motion(t)
+	axis := func(angle float64, x, y, z float64) quat {
+		s, c := math.Sincos(angle * math.Pi / 360)
+		return quat{c, x * s, y * s, z * s}
+	}
+	return axis(-heading, 0, 0, 1).mul(axis(-pitch, 0, 1, 0)).mul(axis(roll, 1, 0, 0))
+}
+
+// rotationRate returns the rotation rate of the sensor in its own frame at
+// t, in rad/s.
+func rotationRate(t float64) [3]float64 {
+	const h = 1e-5
+	d := orientation(t - h/2).conj().mul(orientation(t + h/2))
+	if d.w < 0 {
+		d = quat{-d.w, -d.x, -d.y, -d.z}
+	}
+	return [3]float64{2 * d.x / h, 2 * d.y / h, 2 * d.z / h}
+}
+
+func writeMotionLog(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	l := sensorlog.New(w, sensorlog.Binary,
+		sensorlog.Field{Name: "ax", Unit: "g", Decimals: 6},
+		sensorlog.Field{Name: "ay", Unit: "g", Decimals: 6},
+		sensorlog.Field{Name: "az", Unit: "g", Decimals: 6},
+		sensorlog.Field{Name: "gx", Unit: "°/s", Decimals: 6},
+		sensorlog.Field{Name: "gy", Unit: "°/s", Decimals: 6},
+		sensorlog.Field{Name: "gz", Unit: "°/s", Decimals: 6},
+		sensorlog.Field{Name: "mx", Unit: "µT", Decimals: 2},
+		sensorlog.Field{Name: "my", Unit: "µT", Decimals: 2},
+		sensorlog.Field{Name: "mz", Unit: "µT", Decimals: 2},
+		sensorlog.Field{Name: "roll", Unit: "°", Decimals: 2},
+		sensorlog.Field{Name: "pitch", Unit: "°", Decimals: 2},
+		sensorlog.Field{Name: "heading", Unit: "°", Decimals: 2},
+	)
+	rnd := rand.New(rand.NewSource(1))
+	noise := func(sigma float64) float64 { return sigma * rnd.NormFloat64() }
+	field := [3]float64{fieldStrength * math.Cos(inclination), 0, -fieldStrength * math.Sin(inclination)}
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	values := make([]int32, 12)
+	for i := 0; i < int(motionDuration.Seconds())*motionRate; i++ {
+		t := float64(i) / motionRate
+		q := orientation(t)
+		lin := linearAcceleration(t)
+		accel := q.toSensor([3]float64{lin[0], lin[1], lin[2] + 1})
+		gyro := rotationRate(t)
+		mag := q.toSensor(field)
+		for j := 0; j < 3; j++ {
+			values[j] = int32(math.Round(1e6 * (accel[j] + noise(0.003))))
+			values[3+j] = int32(math.Round(1e6 * (gyro[j]*180/math.Pi + gyroBias[j] + noise(0.1))))
+			values[6+j] = int32(math.Round(mag[j] + noise(20)))
+		}
+		roll, pitch, heading := motion(t)
+		heading = math.Mod(heading+360, 360)
+		for j, angle := range [3]float64{roll, pitch, heading} {
+			values[9+j] = int32(math.Round(angle * 100))
+		}
+		if err := l.Log(start.Add(time.Duration(i)*time.Second/motionRate), values); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// TestMotionModel checks that the reference angles of the model agree with
+// Euler, so that the log tests the filters and not the conventions.
+func TestMotionModel(t *testing.T) {
+	for _, ts := range []float64{0, 3.3, 12.7, 25, 41.9} {
+		q := orientation(ts)
+		roll, pitch, heading := ahrs.Quaternion{W: float32(q.w), X: float32(q.x), Y: float32(q.y), Z: float32(q.z)}.Euler()
+		r, p, h := motion(ts)
+		h = math.Mod(h+360, 360)
+		for i, d := range [3]float64{float64(roll) - r, float64(pitch) - p, float64(heading) - h} {
+			if math.Abs(math.Mod(d+540, 360)-180) > 0.01 {
+				t.Errorf("t=%v: angle %d: got %v %v %v, want %v %v %v", ts, i, roll, pitch, heading, r, p, h)
+				break
+			}
+		}
+	}
+}
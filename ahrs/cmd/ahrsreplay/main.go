@@ -0,0 +1,185 @@
+// Command ahrsreplay runs the filters of package ahrs on recorded motion, to
+// tune and check them on the host.
+//
+// Usage:
+//
+//	ahrsreplay [-filter madgwick|mahony] [-beta 0.1] [-kp 1] [-ki 0] log.bin
+//
+// The log is a binary log of package sensorlog with the fields ax, ay and az
+// in µg, gx, gy and gz in µ°/s, and optionally mx, my and mz. The roll, pitch
+// and heading estimated at every record are written as CSV to the standard
+// output. If the log also has reference angles in fields roll, pitch and
+// heading, from a motion capture system or a better IMU, the error of the
+// estimates is reported on the standard error.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"tinygo.org/x/drivers/ahrs"
+	"tinygo.org/x/drivers/sensorlog"
+)
+
+var (
+	filterName = flag.String("filter", "madgwick", "filter: madgwick or mahony")
+	beta       = flag.Float64("beta", 0.1, "gain of the Madgwick filter")
+	kp         = flag.Float64("kp", 1, "proportional gain of the Mahony filter")
+	ki         = flag.Float64("ki", 0, "integral gain of the Mahony filter")
+	settle     = flag.Duration("settle", 10*time.Second, "time to converge before errors are measured")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: ahrsreplay [flags] log.bin")
+		os.Exit(2)
+	}
+	var filter ahrs.Filter
+	switch *filterName {
+	case "madgwick":
+		filter = ahrs.NewMadgwick(float32(*beta))
+	case "mahony":
+		filter = ahrs.NewMahony(float32(*kp), float32(*ki))
+	default:
+		fail(errors.New("unknown filter " + *filterName))
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if err := replay(sensorlog.NewDecoder(bufio.NewReader(f)), filter, out); err != nil {
+		out.Flush()
+		fail(err)
+	}
+}
+
+// columns are the indices of the fields in the records, -1 if absent.
+type columns struct {
+	accel, gyro, mag, ref [3]int
+	decimals              [3]uint8 // of the reference angles
+}
+
+func findColumns(fields []sensorlog.Field) (columns, error) {
+	var c columns
+	find := func(dst *[3]int, names ...string) bool {
+		found := true
+		for i, name := range names {
+			dst[i] = -1
+			for j, f := range fields {
+				if f.Name == name {
+					dst[i] = j
+				}
+			}
+			found = found && dst[i] >= 0
+		}
+		return found
+	}
+	if !find(&c.accel, "ax", "ay", "az") || !find(&c.gyro, "gx", "gy", "gz") {
+		return c, errors.New("log without fields ax, ay, az, gx, gy and gz")
+	}
+	if !find(&c.mag, "mx", "my", "mz") {
+		c.mag = [3]int{-1, -1, -1}
+	}
+	if find(&c.ref, "roll", "pitch", "heading") {
+		for i, j := range c.ref {
+			c.decimals[i] = fields[j].Decimals
+		}
+	} else {
+		c.ref = [3]int{-1, -1, -1}
+	}
+	return c, nil
+}
+
+func replay(dec *sensorlog.Decoder, filter ahrs.Filter, w io.Writer) error {
+	var (
+		c       columns
+		fields  []sensorlog.Field
+		last    time.Time
+		start   time.Time
+		sum2    [3]float64
+		worst   [3]float64
+		count   int
+		records int
+	)
+	fmt.Fprintln(w, "time,roll,pitch,heading")
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if fields == nil || !sameFields(fields, rec.Fields) {
+			if c, err = findColumns(rec.Fields); err != nil {
+				return err
+			}
+			fields = rec.Fields
+		}
+		var r ahrs.Reading
+		for i := 0; i < 3; i++ {
+			r.Accel[i] = rec.Values[c.accel[i]]
+			r.Gyro[i] = rec.Values[c.gyro[i]]
+			if c.mag[i] >= 0 {
+				r.Mag[i] = rec.Values[c.mag[i]]
+			}
+		}
+		if last.IsZero() {
+			filter.SetQuaternion(ahrs.FromReading(r.Accel, r.Mag))
+			start = rec.Time
+		} else {
+			filter.Update(r, rec.Time.Sub(last))
+		}
+		last = rec.Time
+		records++
+
+		roll, pitch, heading := filter.Quaternion().Euler()
+		fmt.Fprintf(w, "%s,%.2f,%.2f,%.2f\n", rec.Time.Format(time.RFC3339Nano), roll, pitch, heading)
+
+		if c.ref[0] < 0 || rec.Time.Sub(start) < *settle {
+			continue
+		}
+		for i, estimate := range [3]float32{roll, pitch, heading} {
+			ref := float64(rec.Values[c.ref[i]]) / math.Pow10(int(c.decimals[i]))
+			d := math.Abs(math.Mod(float64(estimate)-ref+540, 360) - 180)
+			sum2[i] += d * d
+			worst[i] = math.Max(worst[i], d)
+		}
+		count++
+	}
+	fmt.Fprintln(os.Stderr, records, "records")
+	if count > 0 {
+		for i, name := range [3]string{"roll", "pitch", "heading"} {
+			fmt.Fprintf(os.Stderr, "%s error: rms %.2f°, max %.2f°\n", name, math.Sqrt(sum2[i]/float64(count)), worst[i])
+		}
+	}
+	return nil
+}
+
+func sameFields(a, b []sensorlog.Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "ahrsreplay:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,184 @@
+package ahrs
+
+import "time"
+
+// Madgwick is the filter of Sebastian Madgwick, which corrects the
+// orientation integrated from the gyroscope by a step of gradient descent
+// towards the orientation given by gravity and the magnetic field.
+type Madgwick struct {
+	// Beta is the gain of the correction, in rad/s: higher values follow
+	// the accelerometer and magnetometer faster, but let more of their
+	// noise and of accelerations through. Madgwick suggests about 0.04 to
+	// 0.1.
+	Beta float32
+
+	q Quaternion
+}
+
+// NewMadgwick returns a Madgwick filter with gain beta.
+func NewMadgwick(beta float32) *Madgwick {
+	return &Madgwick{Beta: beta, q: Identity}
+}
+
+// Quaternion returns the orientation.
+func (f *Madgwick) Quaternion() Quaternion {
+	return f.q
+}
+
+// SetQuaternion sets the orientation.
+func (f *Madgwick) SetQuaternion(q Quaternion) {
+	f.q = q.Normalize()
+}
+
+// Update updates the orientation with a reading taken dt after the previous
+// one.
+func (f *Madgwick) Update(r Reading, dt time.Duration) {
+	q := f.q
+	// rate of change of the orientation from the gyroscope: q × ω / 2
+	qDot := q.Mul(Quaternion{
+		X: float32(r.Gyro[0]) * radiansPerMicrodegree / 2,
+		Y: float32(r.Gyro[1]) * radiansPerMicrodegree / 2,
+		Z: float32(r.Gyro[2]) * radiansPerMicrodegree / 2,
+	})
+
+	a := normalize(toFloat(r.Accel))
+	if a != ([3]float32{}) {
+		// Gradient of the error between the directions of gravity and of
+		// the magnetic field measured and those the orientation predicts,
+		// as in the paper of Madgwick: the error f times the Jacobian J.
+		w, x, y, z := q.W, q.X, q.Y, q.Z
+		fg := [3]float32{
+			2*(x*z-w*y) - a[0],
+			2*(w*x+y*z) - a[1],
+			2*(0.5-x*x-y*y) - a[2],
+		}
+		jg := [3][4]float32{
+			{-2 * y, 2 * z, -2 * w, 2 * x},
+			{2 * x, 2 * w, 2 * z, 2 * y},
+			{0, -4 * x, -4 * y, 0},
+		}
+		var s [4]float32
+		addGradient(&s, &jg, fg)
+
+		if m := normalize(toFloat(r.Mag)); m != ([3]float32{}) {
+			// the magnetic field in the Earth frame, turned to the north
+			h := q.Rotate(m)
+			bx := 1 / invSqrt(h[0]*h[0]+h[1]*h[1])
+			bz := h[2]
+			fb := [3]float32{
+				2*bx*(0.5-y*y-z*z) + 2*bz*(x*z-w*y) - m[0],
+				2*bx*(x*y-w*z) + 2*bz*(w*x+y*z) - m[1],
+				2*bx*(w*y+x*z) + 2*bz*(0.5-x*x-y*y) - m[2],
+			}
+			jb := [3][4]float32{
+				{-2 * bz * y, 2 * bz * z, -4*bx*y - 2*bz*w, -4*bx*z + 2*bz*x},
+				{-2*bx*z + 2*bz*x, 2*bx*y + 2*bz*w, 2*bx*x + 2*bz*z, -2*bx*w + 2*bz*y},
+				{2 * bx * y, 2*bx*z - 4*bz*x, 2*bx*w - 4*bz*y, 2 * bx * x},
+			}
+			addGradient(&s, &jb, fb)
+		}
+
+		if n := s[0]*s[0] + s[1]*s[1] + s[2]*s[2] + s[3]*s[3]; n > 0 {
+			k := f.Beta * invSqrt(n)
+			qDot.W -= k * s[0]
+			qDot.X -= k * s[1]
+			qDot.Y -= k * s[2]
+			qDot.Z -= k * s[3]
+		}
+	}
+
+	t := float32(dt.Seconds())
+	f.q = Quaternion{
+		W: q.W + qDot.W*t,
+		X: q.X + qDot.X*t,
+		Y: q.Y + qDot.Y*t,
+		Z: q.Z + qDot.Z*t,
+	}.Normalize()
+}
+
+// addGradient adds Jᵀ f to s.
+func addGradient(s *[4]float32, j *[3][4]float32, f [3]float32) {
+	for i := range s {
+		s[i] += j[0][i]*f[0] + j[1][i]*f[1] + j[2][i]*f[2]
+	}
+}
+
+// Mahony is the complementary filter of Robert Mahony, which corrects the
+// rotation rate of the gyroscope by the error between the directions of
+// gravity and of the magnetic field measured and those the orientation
+// predicts, with a proportional and an integral gain.
+type Mahony struct {
+	// Kp is the proportional gain, in rad/s: higher values follow the
+	// accelerometer and magnetometer faster, but let more of their noise and
+	// of accelerations through.
+	Kp float32
+
+	// Ki is the integral gain, in rad/s², which corrects the bias of the
+	// gyroscope if not zero.
+	Ki float32
+
+	q        Quaternion
+	integral [3]float32
+}
+
+// NewMahony returns a Mahony filter with gains kp and ki, for example 1 and
+// 0, or 1 and 0.01 to correct the bias of an uncalibrated gyroscope.
+func NewMahony(kp, ki float32) *Mahony {
+	return &Mahony{Kp: kp, Ki: ki, q: Identity}
+}
+
+// Quaternion returns the orientation.
+func (f *Mahony) Quaternion() Quaternion {
+	return f.q
+}
+
+// SetQuaternion sets the orientation and clears the integral of the error.
+func (f *Mahony) SetQuaternion(q Quaternion) {
+	f.q = q.Normalize()
+	f.integral = [3]float32{}
+}
+
+// Update updates the orientation with a reading taken dt after the previous
+// one.
+func (f *Mahony) Update(r Reading, dt time.Duration) {
+	q := f.q
+	t := float32(dt.Seconds())
+	g := [3]float32{
+		float32(r.Gyro[0]) * radiansPerMicrodegree,
+		float32(r.Gyro[1]) * radiansPerMicrodegree,
+		float32(r.Gyro[2]) * radiansPerMicrodegree,
+	}
+
+	a := normalize(toFloat(r.Accel))
+	if a != ([3]float32{}) {
+		// up and north as the orientation predicts them in the frame of
+		// the sensor
+		inv := q.Conjugate()
+		up := inv.Rotate([3]float32{0, 0, 1})
+		e := cross(a, up)
+		if m := toFloat(r.Mag); m != ([3]float32{}) {
+			// The magnetic field only corrects the heading: its error is
+			// the angle about up between the field and north, both
+			// projected on the horizontal plane, so that the inclination of
+			// the field does not weaken or tilt the correction.
+			north := inv.Rotate([3]float32{1, 0, 0})
+			em := cross(normalize(cross(up, m)), normalize(cross(up, north)))
+			e = [3]float32{e[0] + em[0], e[1] + em[1], e[2] + em[2]}
+		}
+		for i := range g {
+			if f.Ki > 0 {
+				f.integral[i] += f.Ki * e[i] * t
+				g[i] += f.integral[i]
+			}
+			g[i] += f.Kp * e[i]
+		}
+	}
+
+	qDot := q.Mul(Quaternion{X: g[0] / 2, Y: g[1] / 2, Z: g[2] / 2})
+	f.q = Quaternion{
+		W: q.W + qDot.W*t,
+		X: q.X + qDot.X*t,
+		Y: q.Y + qDot.Y*t,
+		Z: q.Z + qDot.Z*t,
+	}.Normalize()
+}
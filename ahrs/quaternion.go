@@ -0,0 +1,161 @@
+package ahrs
+
+import "math"
+
+// Quaternion is a rotation. As the orientation of a sensor, it rotates
+// vectors from the frame of the sensor to the frame of the Earth.
+type Quaternion struct {
+	W, X, Y, Z float32
+}
+
+// Identity is the quaternion of no rotation: the sensor lies flat, its x axis
+// pointing north.
+var Identity = Quaternion{W: 1}
+
+// Mul returns the product q × r, the rotation r followed by q.
+func (q Quaternion) Mul(r Quaternion) Quaternion {
+	return Quaternion{
+		W: q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+		X: q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		Y: q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		Z: q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+	}
+}
+
+// Conjugate returns the inverse rotation of q.
+func (q Quaternion) Conjugate() Quaternion {
+	return Quaternion{W: q.W, X: -q.X, Y: -q.Y, Z: -q.Z}
+}
+
+// Normalize returns q scaled to unit length.
+func (q Quaternion) Normalize() Quaternion {
+	n := q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z
+	if n == 0 {
+		return Identity
+	}
+	r := invSqrt(n)
+	return Quaternion{W: q.W * r, X: q.X * r, Y: q.Y * r, Z: q.Z * r}
+}
+
+// Rotate returns the vector v rotated by q.
+func (q Quaternion) Rotate(v [3]float32) [3]float32 {
+	p := q.Mul(Quaternion{X: v[0], Y: v[1], Z: v[2]}).Mul(q.Conjugate())
+	return [3]float32{p.X, p.Y, p.Z}
+}
+
+// Euler returns the orientation as angles in degrees: roll, positive with
+// the right side down, and pitch, positive with the nose up, both from -180
+// to 180, and heading, clockwise from north, from 0 to 360.
+func (q Quaternion) Euler() (roll, pitch, heading float32) {
+	w, x, y, z := float64(q.W), float64(q.X), float64(q.Y), float64(q.Z)
+	roll = float32(math.Atan2(2*(w*x+y*z), 1-2*(x*x+y*y)) * degrees)
+	sinPitch := 2 * (w*y - z*x)
+	if sinPitch > 1 {
+		sinPitch = 1
+	} else if sinPitch < -1 {
+		sinPitch = -1
+	}
+	// the Earth frame has y to the west, so the angles about y and z are
+	// the opposite of pitch and heading
+	pitch = float32(-math.Asin(sinPitch) * degrees)
+	heading = float32(-math.Atan2(2*(w*z+x*y), 1-2*(y*y+z*z)) * degrees)
+	if heading < 0 {
+		heading += 360
+	}
+	return roll, pitch, heading
+}
+
+// FromReading returns the orientation given by the acceleration of a sensor
+// at rest and, if not zero, its magnetic field. Without a magnetic field the
+// heading is 0.
+func FromReading(accel, mag [3]int32) Quaternion {
+	up := normalize(toFloat(accel))
+	if up == ([3]float32{}) {
+		return Identity
+	}
+	// north and west in the frame of the sensor
+	west := normalize(cross(up, toFloat(mag)))
+	if west == ([3]float32{}) {
+		// no magnetic field, or parallel to gravity: take the x axis of the
+		// sensor as north
+		west = normalize(cross(up, [3]float32{1, 0, 0}))
+		if west == ([3]float32{}) {
+			west = normalize(cross(up, [3]float32{0, 1, 0}))
+		}
+	}
+	north := cross(west, up)
+
+	// The rows of the rotation matrix from the sensor to the Earth are
+	// north, west and up.
+	m := [3][3]float32{north, west, up}
+	var q Quaternion
+	switch trace := m[0][0] + m[1][1] + m[2][2]; {
+	case trace > 0:
+		s := 0.5 * invSqrt(trace+1)
+		q = Quaternion{W: 0.25 / s, X: (m[2][1] - m[1][2]) * s, Y: (m[0][2] - m[2][0]) * s, Z: (m[1][0] - m[0][1]) * s}
+	case m[0][0] > m[1][1] && m[0][0] > m[2][2]:
+		s := 0.5 * invSqrt(1+m[0][0]-m[1][1]-m[2][2])
+		q = Quaternion{W: (m[2][1] - m[1][2]) * s, X: 0.25 / s, Y: (m[0][1] + m[1][0]) * s, Z: (m[0][2] + m[2][0]) * s}
+	case m[1][1] > m[2][2]:
+		s := 0.5 * invSqrt(1+m[1][1]-m[0][0]-m[2][2])
+		q = Quaternion{W: (m[0][2] - m[2][0]) * s, X: (m[0][1] + m[1][0]) * s, Y: 0.25 / s, Z: (m[1][2] + m[2][1]) * s}
+	default:
+		s := 0.5 * invSqrt(1+m[2][2]-m[0][0]-m[1][1])
+		q = Quaternion{W: (m[1][0] - m[0][1]) * s, X: (m[0][2] + m[2][0]) * s, Y: (m[1][2] + m[2][1]) * s, Z: 0.25 / s}
+	}
+	return q.Normalize()
+}
+
+// Heading returns the tilt-compensated compass heading in degrees, clockwise
+// from magnetic north from 0 to 360, of the x axis of a sensor at rest.
+func Heading(accel, mag [3]int32) float32 {
+	up := normalize(toFloat(accel))
+	west := normalize(cross(up, toFloat(mag)))
+	north := cross(west, up)
+	h := float32(math.Atan2(-float64(west[0]), float64(north[0])) * degrees)
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+const (
+	degrees = 180 / math.Pi
+
+	// radiansPerMicrodegree converts µ°/s, the unit of the gyroscope
+	// drivers, to rad/s.
+	radiansPerMicrodegree = math.Pi / 180 / 1e6
+)
+
+func toFloat(v [3]int32) [3]float32 {
+	return [3]float32{float32(v[0]), float32(v[1]), float32(v[2])}
+}
+
+func cross(a, b [3]float32) [3]float32 {
+	return [3]float32{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+// normalize returns v scaled to unit length, or zero.
+func normalize(v [3]float32) [3]float32 {
+	n := v[0]*v[0] + v[1]*v[1] + v[2]*v[2]
+	if n == 0 {
+		return v
+	}
+	r := invSqrt(n)
+	return [3]float32{v[0] * r, v[1] * r, v[2] * r}
+}
+
+// invSqrt returns 1/√x without float64 arithmetic, which most
+// microcontrollers lack: an estimate from the bits of x refined by Newton's
+// method.
+func invSqrt(x float32) float32 {
+	y := math.Float32frombits(0x5f375a86 - math.Float32bits(x)>>1)
+	for i := 0; i < 3; i++ {
+		y *= 1.5 - 0.5*x*y*y
+	}
+	return y
+}
@@ -1,5 +1,7 @@
 // Package at24cx provides a driver for the AT24C32/64/128/256/512 2-wire serial EEPROM
 //
+// Package eeprom supports the whole 24C01 to 24C1024 family.
+//
 // Datasheet:
 // https://www.openimpulse.com/blog/wp-content/uploads/wpsc/downloadables/24C32-Datasheet.pdf
 package at24cx // import "tinygo.org/x/drivers/at24cx"
@@ -0,0 +1,30 @@
+package drivers
+
+// BlockDevice is the raw storage interface shared by flash memories and
+// similar devices, such as flash.Device. Filesystems and logs are written
+// against it so they can run on any chip, or on an in-memory emulator in
+// tests.
+type BlockDevice interface {
+	// ReadAt reads len(p) bytes starting at byte offset off.
+	ReadAt(p []byte, off int64) (n int, err error)
+
+	// WriteAt writes p starting at byte offset off. The destination must
+	// have been erased before; on NOR flash, writing can only change bits
+	// from 1 to 0.
+	WriteAt(p []byte, off int64) (n int, err error)
+
+	// Size returns the total size of the device in bytes.
+	Size() int64
+
+	// WriteBlockSize returns the size in bytes of the unit in which data is
+	// programmed, such as a flash page. Unaligned writes must still work.
+	WriteBlockSize() int64
+
+	// EraseBlockSize returns the size in bytes of the smallest erasable
+	// area, which is the unit used by EraseBlocks.
+	EraseBlockSize() int64
+
+	// EraseBlocks erases len blocks starting at block start, setting all
+	// bytes to 0xFF.
+	EraseBlocks(start, len int64) error
+}
@@ -0,0 +1,246 @@
+// Package calibration corrects the readings of accelerometers, gyroscopes
+// and magnetometers such as the mpu6050, lsm6ds3, adxl345, lis3dh, mma8653
+// and mag3110.
+//
+// Calibrators compute corrections from samples recorded on the device:
+//
+//   - AccelCalibrator the bias, scale and cross-axis sensitivity of an
+//     accelerometer, from the six positions with an axis pointing up or down;
+//   - GyroCalibrator the zero-rate bias of a gyroscope at rest;
+//   - MagCalibrator the hard-iron offset and soft-iron distortion of a
+//     magnetometer, by fitting an ellipsoid to samples taken while rotating
+//     it in all directions.
+//
+// The corrections are kept in a Calibration, which can be stored in flash or
+// EEPROM with MarshalBinary, and applied by wrapping the drivers:
+//
+//	accel := calibration.NewAccelerometer(calibration.NoError(imu.ReadAcceleration), cal.Accel)
+//	x, y, z, err := accel.ReadAcceleration()
+package calibration // import "tinygo.org/x/drivers/calibration"
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"time"
+)
+
+var (
+	ErrNoSamples = errors.New("calibration: no samples")
+	ErrPositions = errors.New("calibration: not all six positions recorded")
+	ErrFit       = errors.New("calibration: samples do not fit an ellipsoid")
+	ErrBadData   = errors.New("calibration: bad data")
+)
+
+// Correction corrects readings of three axes v as Matrix × (v - Offset).
+type Correction struct {
+	// Offset is the bias, in the units of the readings.
+	Offset [3]int32
+
+	// Matrix corrects the scale and the cross-axis sensitivity. The zero
+	// matrix stands for the identity, so that the zero Correction changes
+	// nothing.
+	Matrix [3][3]float32
+}
+
+// Apply returns the corrected reading of x, y and z.
+func (c *Correction) Apply(x, y, z int32) (int32, int32, int32) {
+	v := [3]float32{
+		float32(int64(x) - int64(c.Offset[0])),
+		float32(int64(y) - int64(c.Offset[1])),
+		float32(int64(z) - int64(c.Offset[2])),
+	}
+	if c.Matrix == ([3][3]float32{}) {
+		return round(v[0]), round(v[1]), round(v[2])
+	}
+	m := &c.Matrix
+	return round(m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2]),
+		round(m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2]),
+		round(m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2])
+}
+
+func round(f float32) int32 {
+	switch {
+	case f >= math.MaxInt32:
+		return math.MaxInt32
+	case f <= math.MinInt32:
+		return math.MinInt32
+	case f < 0:
+		return int32(f - 0.5)
+	}
+	return int32(f + 0.5)
+}
+
+// Calibration holds the corrections of an IMU.
+type Calibration struct {
+	Accel Correction
+	Gyro  Correction
+	Mag   Correction
+}
+
+const (
+	dataMagic      = 'C'
+	dataVersion    = 1
+	correctionSize = 3*4 + 9*4
+
+	// DataSize is the size of a marshaled Calibration.
+	DataSize = 2 + 3*correctionSize + 4
+)
+
+// MarshalBinary returns the calibration as DataSize bytes, with a CRC so
+// that UnmarshalBinary rejects erased or corrupted storage.
+func (c *Calibration) MarshalBinary() ([]byte, error) {
+	b := make([]byte, DataSize)
+	b[0], b[1] = dataMagic, dataVersion
+	p := b[2:]
+	for _, corr := range [...]*Correction{&c.Accel, &c.Gyro, &c.Mag} {
+		for _, v := range corr.Offset {
+			binary.LittleEndian.PutUint32(p, uint32(v))
+			p = p[4:]
+		}
+		for _, row := range corr.Matrix {
+			for _, v := range row {
+				binary.LittleEndian.PutUint32(p, math.Float32bits(v))
+				p = p[4:]
+			}
+		}
+	}
+	binary.LittleEndian.PutUint32(p, crc32.ChecksumIEEE(b[:DataSize-4]))
+	return b, nil
+}
+
+// UnmarshalBinary sets the calibration from data written by MarshalBinary.
+func (c *Calibration) UnmarshalBinary(data []byte) error {
+	if len(data) < DataSize || data[0] != dataMagic || data[1] != dataVersion {
+		return ErrBadData
+	}
+	data = data[:DataSize]
+	if crc32.ChecksumIEEE(data[:DataSize-4]) != binary.LittleEndian.Uint32(data[DataSize-4:]) {
+		return ErrBadData
+	}
+	p := data[2:]
+	for _, corr := range [...]*Correction{&c.Accel, &c.Gyro, &c.Mag} {
+		for i := range corr.Offset {
+			corr.Offset[i] = int32(binary.LittleEndian.Uint32(p))
+			p = p[4:]
+		}
+		for i := range corr.Matrix {
+			for j := range corr.Matrix[i] {
+				corr.Matrix[i][j] = math.Float32frombits(binary.LittleEndian.Uint32(p))
+				p = p[4:]
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFunc reads the three axes of a sensor, like the ReadAcceleration
+// method of the adxl345, lis3dh and mma8653 drivers.
+type ReadFunc func() (x, y, z int32, err error)
+
+// NoError adapts a driver method that returns no error, such as
+// mpu6050.Device.ReadRotation, to a ReadFunc.
+func NoError(read func() (x, y, z int32)) ReadFunc {
+	return func() (x, y, z int32, err error) {
+		x, y, z = read()
+		return x, y, z, nil
+	}
+}
+
+// Int16 adapts a driver method that returns int16 values and no error, such
+// as mag3110.Device.ReadMagnetic, to a ReadFunc.
+func Int16(read func() (x, y, z int16)) ReadFunc {
+	return func() (x, y, z int32, err error) {
+		x16, y16, z16 := read()
+		return int32(x16), int32(y16), int32(z16), nil
+	}
+}
+
+// Calibrator is implemented by the calibrators.
+type Calibrator interface {
+	Add(x, y, z int32)
+}
+
+// Record adds n samples read every interval to c.
+func Record(c Calibrator, read ReadFunc, n int, interval time.Duration) error {
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		x, y, z, err := read()
+		if err != nil {
+			return err
+		}
+		c.Add(x, y, z)
+	}
+	return nil
+}
+
+// Accelerometer corrects the readings of an accelerometer.
+type Accelerometer struct {
+	read       ReadFunc
+	Correction Correction
+}
+
+// NewAccelerometer returns an accelerometer that corrects the readings of
+// read with c.
+func NewAccelerometer(read ReadFunc, c Correction) *Accelerometer {
+	return &Accelerometer{read: read, Correction: c}
+}
+
+// ReadAcceleration returns the corrected acceleration, in the units of the
+// driver, usually µg.
+func (a *Accelerometer) ReadAcceleration() (x, y, z int32, err error) {
+	x, y, z, err = a.read()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	x, y, z = a.Correction.Apply(x, y, z)
+	return x, y, z, nil
+}
+
+// Gyroscope corrects the readings of a gyroscope.
+type Gyroscope struct {
+	read       ReadFunc
+	Correction Correction
+}
+
+// NewGyroscope returns a gyroscope that corrects the readings of read with c.
+func NewGyroscope(read ReadFunc, c Correction) *Gyroscope {
+	return &Gyroscope{read: read, Correction: c}
+}
+
+// ReadRotation returns the corrected rotation rate, in the units of the
+// driver, usually µ°/s.
+func (g *Gyroscope) ReadRotation() (x, y, z int32, err error) {
+	x, y, z, err = g.read()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	x, y, z = g.Correction.Apply(x, y, z)
+	return x, y, z, nil
+}
+
+// Magnetometer corrects the readings of a magnetometer.
+type Magnetometer struct {
+	read       ReadFunc
+	Correction Correction
+}
+
+// NewMagnetometer returns a magnetometer that corrects the readings of read
+// with c.
+func NewMagnetometer(read ReadFunc, c Correction) *Magnetometer {
+	return &Magnetometer{read: read, Correction: c}
+}
+
+// ReadMagnetic returns the corrected magnetic field, in the units of the
+// driver.
+func (m *Magnetometer) ReadMagnetic() (x, y, z int32, err error) {
+	x, y, z, err = m.read()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	x, y, z = m.Correction.Apply(x, y, z)
+	return x, y, z, nil
+}
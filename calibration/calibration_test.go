@@ -0,0 +1,304 @@
+package calibration_test
+
+import (
+	"math"
+	"testing"
+
+	"tinygo.org/x/drivers/calibration"
+)
+
+// noise returns a deterministic pseudo-random value in [-1, 1).
+func noise(i, axis int) float64 {
+	x := uint32(i*3+axis)*2654435761 + 12345
+	x ^= x >> 15
+	x *= 2246822519
+	x ^= x >> 13
+	return float64(x)/(1<<31) - 1
+}
+
+// accelModel is an accelerometer with a bias, and scale and cross-axis
+// errors: it reads offset + k g.
+var accelModel = struct {
+	offset [3]float64
+	k      [3][3]float64
+}{
+	offset: [3]float64{20000, -15000, 30000},
+	k: [3][3]float64{
+		{1.02, 0.01, -0.005},
+		{0.008, 0.97, 0.012},
+		{-0.01, 0.004, 1.05},
+	},
+}
+
+func accelReading(g [3]float64, i int) (x, y, z int32) {
+	var r [3]int32
+	for j := range r {
+		v := accelModel.offset[j]
+		for l := range g {
+			v += accelModel.k[j][l] * g[l]
+		}
+		r[j] = int32(math.Round(v + 500*noise(i, j)))
+	}
+	return r[0], r[1], r[2]
+}
+
+func TestAccelCalibrator(t *testing.T) {
+	var c calibration.AccelCalibrator
+	positions := [6][3]float64{
+		{calibration.OneG, 0, 0}, {-calibration.OneG, 0, 0},
+		{0, calibration.OneG, 0}, {0, -calibration.OneG, 0},
+		{0, 0, calibration.OneG}, {0, 0, -calibration.OneG},
+	}
+	for p, g := range positions[:5] {
+		for i := 0; i < 50; i++ {
+			c.Add(accelReading(g, p*100+i))
+		}
+	}
+	if _, err := c.Result(); err != calibration.ErrPositions {
+		t.Errorf("five positions: got %v, want %v", err, calibration.ErrPositions)
+	}
+	for i := 0; i < 50; i++ {
+		c.Add(accelReading(positions[5], 500+i))
+	}
+	// tilted by 45° while turning between positions: ignored
+	s := calibration.OneG / math.Sqrt2
+	for i := 0; i < 20; i++ {
+		c.Add(accelReading([3]float64{s, 0, s}, 600+i))
+	}
+	for p := calibration.XUp; p <= calibration.ZDown; p++ {
+		if c.Count(p) != 50 {
+			t.Errorf("position %d: %d samples, want 50", p, c.Count(p))
+		}
+	}
+
+	corr, err := c.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range corr.Offset {
+		if d := math.Abs(float64(corr.Offset[i]) - accelModel.offset[i]); d > 200 {
+			t.Errorf("offset %d: got %d, want %.0f", i, corr.Offset[i], accelModel.offset[i])
+		}
+	}
+	// the corrected readings are within 0.1% of gravity, in any direction
+	for i, g := range append(positions[:], [3]float64{s, -s / 2, s / 2}, [3]float64{-s / 2, s, -s}) {
+		x, y, z := accelReading(g, 1000+i)
+		x, y, z = corr.Apply(x, y, z)
+		for j, v := range [3]int32{x, y, z} {
+			if d := math.Abs(float64(v) - g[j]); d > 1000 {
+				t.Errorf("%v: axis %d reads %d", g, j, v)
+			}
+		}
+	}
+}
+
+// magModel is a magnetometer with a hard-iron offset and a soft-iron
+// distortion, in a field of the given strength. The offset is set by the
+// tests.
+var magModel = struct {
+	offset   [3]float64
+	matrix   [3][3]float64
+	strength float64
+}{
+	matrix: [3][3]float64{
+		{1.15, 0.06, -0.03},
+		{0.06, 0.9, 0.04},
+		{-0.03, 0.04, 1.02},
+	},
+	strength: 500,
+}
+
+// magReading returns the reading of the field in direction u.
+func magReading(u [3]float64, i int) (x, y, z int32) {
+	var r [3]int32
+	for j := range r {
+		v := magModel.offset[j]
+		for l := range u {
+			v += magModel.matrix[j][l] * u[l] * magModel.strength
+		}
+		r[j] = int32(math.Round(v + 2*noise(i, j)))
+	}
+	return r[0], r[1], r[2]
+}
+
+// sphere returns n directions spread evenly on the unit sphere.
+func sphere(n int) [][3]float64 {
+	u := make([][3]float64, n)
+	golden := math.Pi * (3 - math.Sqrt(5))
+	for i := range u {
+		z := 1 - (float64(i)+0.5)*2/float64(n)
+		r := math.Sqrt(1 - z*z)
+		a := golden * float64(i)
+		u[i] = [3]float64{r * math.Cos(a), r * math.Sin(a), z}
+	}
+	return u
+}
+
+func TestMagCalibrator(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		offset [3]float64
+	}{
+		// the field is the larger, and the ellipsoid encloses zero
+		{"small offset", [3]float64{40, -25, 60}},
+		{"large offset", [3]float64{-320, 145, 780}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			magModel.offset = tc.offset
+			testMagCalibrator(t)
+		})
+	}
+}
+
+func testMagCalibrator(t *testing.T) {
+	var c calibration.MagCalibrator
+	if _, err := c.Result(); err != calibration.ErrNoSamples {
+		t.Errorf("no samples: got %v, want %v", err, calibration.ErrNoSamples)
+	}
+	dirs := sphere(400)
+	for i, u := range dirs[:8] {
+		c.Add(magReading(u, i))
+	}
+	if _, err := c.Result(); err != calibration.ErrFit {
+		t.Errorf("8 samples: got %v, want %v", err, calibration.ErrFit)
+	}
+	for i, u := range dirs[8:] {
+		c.Add(magReading(u, 8+i))
+	}
+	if c.Count() != len(dirs) {
+		t.Errorf("%d samples, want %d", c.Count(), len(dirs))
+	}
+
+	corr, err := c.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range corr.Offset {
+		if d := math.Abs(float64(corr.Offset[i]) - magModel.offset[i]); d > 2 {
+			t.Errorf("offset %d: got %d, want %.0f", i, corr.Offset[i], magModel.offset[i])
+		}
+	}
+	// the corrected field has the same strength in all directions, about
+	// that of the readings
+	min, max := math.Inf(1), 0.0
+	for i, u := range sphere(97) {
+		x, y, z := corr.Apply(magReading(u, 1000+i))
+		n := math.Sqrt(float64(x)*float64(x) + float64(y)*float64(y) + float64(z)*float64(z))
+		min, max = math.Min(min, n), math.Max(max, n)
+	}
+	if max-min > 0.02*magModel.strength || min < 0.9*magModel.strength || max > 1.1*magModel.strength {
+		t.Errorf("corrected strength from %.1f to %.1f", min, max)
+	}
+
+	// the extremes give the offset, but not the cross-axis distortion
+	hard, err := c.HardIron()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range hard.Offset {
+		if d := math.Abs(float64(hard.Offset[i]) - magModel.offset[i]); d > 25 {
+			t.Errorf("hard iron offset %d: got %d, want %.0f", i, hard.Offset[i], magModel.offset[i])
+		}
+	}
+}
+
+func TestMagCalibratorFlat(t *testing.T) {
+	// turned in a single plane: no ellipsoid fits
+	var c calibration.MagCalibrator
+	magModel.offset = [3]float64{40, -25, 60}
+	for i := 0; i < 100; i++ {
+		a := 2 * math.Pi * float64(i) / 100
+		c.Add(magReading([3]float64{math.Cos(a), math.Sin(a), 0}, i))
+	}
+	if _, err := c.Result(); err != calibration.ErrFit {
+		t.Errorf("got %v, want %v", err, calibration.ErrFit)
+	}
+}
+
+func TestGyroCalibrator(t *testing.T) {
+	var c calibration.GyroCalibrator
+	if _, err := c.Result(); err != calibration.ErrNoSamples {
+		t.Errorf("got %v, want %v", err, calibration.ErrNoSamples)
+	}
+	for i := 0; i < 100; i++ {
+		c.Add(int32(1500+10*noise(i, 0)), int32(-700+10*noise(i, 1)), int32(250+10*noise(i, 2)))
+	}
+	corr, err := c.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, z := corr.Apply(1500, -700, 250); abs(x) > 3 || abs(y) > 3 || abs(z) > 3 {
+		t.Errorf("offset %v leaves %d, %d, %d", corr.Offset, x, y, z)
+	}
+}
+
+func TestApply(t *testing.T) {
+	var c calibration.Correction
+	if x, y, z := c.Apply(1, -2, math.MaxInt32); x != 1 || y != -2 || z != math.MaxInt32 {
+		t.Errorf("zero correction: got %d, %d, %d", x, y, z)
+	}
+	c = calibration.Correction{
+		Offset: [3]int32{10, -10, 0},
+		Matrix: [3][3]float32{{0.5, 0, 0}, {0, 0.5, 0}, {0, 0, -2}},
+	}
+	// rounded half away from zero
+	if x, y, z := c.Apply(15, -15, 3); x != 3 || y != -3 || z != -6 {
+		t.Errorf("got %d, %d, %d, want 3, -3, -6", x, y, z)
+	}
+	if _, _, z := c.Apply(0, 0, math.MinInt32); z != math.MaxInt32 {
+		t.Errorf("got %d, want it clamped to %d", z, math.MaxInt32)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	cal := calibration.Calibration{
+		Accel: calibration.Correction{
+			Offset: [3]int32{20000, -15000, 30000},
+			Matrix: [3][3]float32{{0.98, -0.01, 0.005}, {-0.008, 1.03, -0.012}, {0.01, -0.004, 0.95}},
+		},
+		Gyro: calibration.Correction{Offset: [3]int32{1500, -700, math.MinInt32}},
+		Mag: calibration.Correction{
+			Offset: [3]int32{-320, 145, 780},
+			Matrix: [3][3]float32{{0.87, -0.05, 0.03}, {-0.05, 1.11, -0.04}, {0.03, -0.04, float32(math.Inf(1))}},
+		},
+	}
+	b, err := cal.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != calibration.DataSize {
+		t.Fatalf("%d bytes, want %d", len(b), calibration.DataSize)
+	}
+	var got calibration.Calibration
+	// trailing bytes, such as the rest of a flash page, are ignored
+	if err := got.UnmarshalBinary(append(b, 0xFF, 0xFF)); err != nil {
+		t.Fatal(err)
+	}
+	if got != cal {
+		t.Errorf("got %+v\nwant %+v", got, cal)
+	}
+
+	for i := range b {
+		c := append([]byte(nil), b...)
+		c[i] ^= 0x10
+		if err := got.UnmarshalBinary(c); err != calibration.ErrBadData {
+			t.Errorf("byte %d changed: got %v, want %v", i, err, calibration.ErrBadData)
+		}
+	}
+	erased := make([]byte, calibration.DataSize)
+	for i := range erased {
+		erased[i] = 0xFF
+	}
+	for name, data := range map[string][]byte{"short": b[:len(b)-1], "erased": erased, "zero": make([]byte, calibration.DataSize)} {
+		if err := got.UnmarshalBinary(data); err != calibration.ErrBadData {
+			t.Errorf("%s: got %v, want %v", name, err, calibration.ErrBadData)
+		}
+	}
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
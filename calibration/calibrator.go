@@ -0,0 +1,407 @@
+package calibration
+
+import "math"
+
+// OneG is 1 g in µg, the unit of the accelerometer drivers.
+const OneG = 1000000
+
+// GyroCalibrator computes the zero-rate bias of a gyroscope from samples
+// taken while it is at rest.
+type GyroCalibrator struct {
+	sum   [3]int64
+	count int
+}
+
+// Add adds a sample.
+func (c *GyroCalibrator) Add(x, y, z int32) {
+	c.sum[0] += int64(x)
+	c.sum[1] += int64(y)
+	c.sum[2] += int64(z)
+	c.count++
+}
+
+// Result returns the correction of the bias.
+func (c *GyroCalibrator) Result() (Correction, error) {
+	if c.count == 0 {
+		return Correction{}, ErrNoSamples
+	}
+	var corr Correction
+	for i, s := range c.sum {
+		corr.Offset[i] = int32(s / int64(c.count))
+	}
+	return corr, nil
+}
+
+// Position is a position of an accelerometer at rest, with an axis pointing
+// up or down.
+type Position uint8
+
+const (
+	XUp Position = iota
+	XDown
+	YUp
+	YDown
+	ZUp
+	ZDown
+)
+
+// AccelCalibrator computes the bias, scale and cross-axis sensitivity of an
+// accelerometer from samples taken at rest in six positions, with each axis
+// in turn pointing up and down. The position of a sample is found from the
+// axis that reads the most, so samples can be added while the device is
+// turned from one position to the next; samples more than about 35° off an
+// axis are ignored.
+type AccelCalibrator struct {
+	// Gravity is the reading of 1 g, OneG if zero.
+	Gravity int32
+
+	sum   [6][3]int64
+	count [6]int
+}
+
+// Add adds a sample.
+func (c *AccelCalibrator) Add(x, y, z int32) {
+	v := [3]int64{int64(x), int64(y), int64(z)}
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if abs64(v[i]) > abs64(v[axis]) {
+			axis = i
+		}
+	}
+	norm2 := v[0]*v[0] + v[1]*v[1] + v[2]*v[2]
+	if norm2 == 0 || v[axis]*v[axis]*3 < norm2*2 {
+		return
+	}
+	p := Position(axis * 2)
+	if v[axis] < 0 {
+		p++
+	}
+	for i := range v {
+		c.sum[p][i] += v[i]
+	}
+	c.count[p]++
+}
+
+// Count returns the number of samples added in position p.
+func (c *AccelCalibrator) Count(p Position) int {
+	return c.count[p]
+}
+
+// Result returns the correction, once samples have been added in all six
+// positions.
+func (c *AccelCalibrator) Result() (Correction, error) {
+	var mean [6][3]float64
+	for p := range mean {
+		if c.count[p] == 0 {
+			return Correction{}, ErrPositions
+		}
+		for i := range mean[p] {
+			mean[p][i] = float64(c.sum[p][i]) / float64(c.count[p])
+		}
+	}
+	gravity := float64(c.Gravity)
+	if gravity == 0 {
+		gravity = OneG
+	}
+
+	// A reading is r = o + K g: the offset o is halfway between the
+	// readings up and down, and column i of K half their difference.
+	var corr Correction
+	var k [3][3]float64
+	for i := 0; i < 3; i++ {
+		up, down := mean[2*i], mean[2*i+1]
+		for j := 0; j < 3; j++ {
+			k[j][i] = (up[j] - down[j]) / 2 / gravity
+		}
+	}
+	for j := 0; j < 3; j++ {
+		var o float64
+		for i := 0; i < 3; i++ {
+			o += (mean[2*i][j] + mean[2*i+1][j]) / 2
+		}
+		corr.Offset[j] = int32(math.Round(o / 3))
+	}
+	inv, ok := inverse3(k)
+	if !ok {
+		return Correction{}, ErrPositions
+	}
+	corr.Matrix = toFloat32(inv)
+	return corr, nil
+}
+
+// MagCalibrator computes the hard-iron offset and soft-iron distortion of a
+// magnetometer from samples taken while rotating it in all directions. The
+// samples lie on an ellipsoid, which the correction turns into a sphere
+// centered on zero, of about the same radius.
+//
+// It keeps sums rather than samples, so any number of samples can be added.
+type MagCalibrator struct {
+	scale float64 // of the samples, for the conditioning of the fit
+	ata   [9][9]float64
+	atb   [9]float64
+	min   [3]int32
+	max   [3]int32
+	count int
+}
+
+// Add adds a sample.
+func (c *MagCalibrator) Add(x, y, z int32) {
+	v := [3]int32{x, y, z}
+	if c.count == 0 {
+		c.min, c.max = v, v
+	}
+	for i := range v {
+		if v[i] < c.min[i] {
+			c.min[i] = v[i]
+		}
+		if v[i] > c.max[i] {
+			c.max[i] = v[i]
+		}
+	}
+	if c.scale == 0 {
+		c.scale = math.Max(math.Abs(float64(x)), math.Max(math.Abs(float64(y)), math.Abs(float64(z))))
+		if c.scale == 0 {
+			return
+		}
+	}
+	c.count++
+
+	// Fit a x² + b y² + c z² + 2d xy + 2e xz + 2f yz + 2g x + 2h y + 2i z = 1
+	// by least squares, accumulating the normal equations.
+	fx, fy, fz := float64(x)/c.scale, float64(y)/c.scale, float64(z)/c.scale
+	row := [9]float64{fx * fx, fy * fy, fz * fz, 2 * fx * fy, 2 * fx * fz, 2 * fy * fz, 2 * fx, 2 * fy, 2 * fz}
+	for i := range row {
+		for j := i; j < 9; j++ {
+			c.ata[i][j] += row[i] * row[j]
+		}
+		c.atb[i] += row[i]
+	}
+}
+
+// Count returns the number of samples added.
+func (c *MagCalibrator) Count() int {
+	return c.count
+}
+
+// HardIron returns a correction of the offset and of the scale of each axis
+// from the extremes of the samples. It is less accurate than Result, but
+// needs fewer samples: one turn in each of two perpendicular planes.
+func (c *MagCalibrator) HardIron() (Correction, error) {
+	if c.count == 0 {
+		return Correction{}, ErrNoSamples
+	}
+	var corr Correction
+	var radius [3]float64
+	var mean float64
+	for i := range radius {
+		corr.Offset[i] = int32((int64(c.min[i]) + int64(c.max[i])) / 2)
+		radius[i] = float64(int64(c.max[i])-int64(c.min[i])) / 2
+		if radius[i] == 0 {
+			return Correction{}, ErrFit
+		}
+		mean += radius[i] / 3
+	}
+	for i := range radius {
+		corr.Matrix[i][i] = float32(mean / radius[i])
+	}
+	return corr, nil
+}
+
+// Result returns the correction fitted to the samples.
+func (c *MagCalibrator) Result() (Correction, error) {
+	if c.count == 0 {
+		return Correction{}, ErrNoSamples
+	}
+	if c.count < 9 {
+		return Correction{}, ErrFit
+	}
+	var a [9][9]float64
+	for i := range a {
+		for j := i; j < 9; j++ {
+			a[i][j], a[j][i] = c.ata[i][j], c.ata[i][j]
+		}
+	}
+	p, ok := solve9(a, c.atb)
+	if !ok {
+		return Correction{}, ErrFit
+	}
+
+	// v·M·v + 2 g·v = 1 is (v - o)·M·(v - o) = 1 + o·M·o with o = -M⁻¹ g.
+	m := [3][3]float64{
+		{p[0], p[3], p[4]},
+		{p[3], p[1], p[5]},
+		{p[4], p[5], p[2]},
+	}
+	inv, ok := inverse3(m)
+	if !ok {
+		return Correction{}, ErrFit
+	}
+	var o [3]float64
+	for i := range o {
+		o[i] = -(inv[i][0]*p[6] + inv[i][1]*p[7] + inv[i][2]*p[8])
+	}
+	k := 1.0
+	for i := range o {
+		for j := range o {
+			k += o[i] * m[i][j] * o[j]
+		}
+	}
+	if k == 0 {
+		return Correction{}, ErrFit
+	}
+
+	// The correction is the square root of M/k, which maps the ellipsoid on
+	// the unit sphere, times the geometric mean of the radii of the
+	// ellipsoid. When the offset is larger than the field, the ellipsoid
+	// doesn't enclose zero, and M and k are both negative.
+	values, vectors := eigen3(m)
+	radius := 1.0
+	for i := range values {
+		values[i] /= k
+		if values[i] <= 0 {
+			return Correction{}, ErrFit
+		}
+		radius /= math.Sqrt(values[i])
+	}
+	radius = math.Cbrt(radius)
+	var w [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for l := 0; l < 3; l++ {
+				w[i][j] += vectors[i][l] * math.Sqrt(values[l]) * vectors[j][l]
+			}
+			w[i][j] *= radius
+		}
+	}
+
+	var corr Correction
+	for i := range o {
+		corr.Offset[i] = int32(math.Round(o[i] * c.scale))
+	}
+	corr.Matrix = toFloat32(w)
+	return corr, nil
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func toFloat32(m [3][3]float64) (f [3][3]float32) {
+	for i := range m {
+		for j := range m[i] {
+			f[i][j] = float32(m[i][j])
+		}
+	}
+	return f
+}
+
+// inverse3 returns the inverse of m, and false if it is singular.
+func inverse3(m [3][3]float64) ([3][3]float64, bool) {
+	var inv [3][3]float64
+	inv[0][0] = m[1][1]*m[2][2] - m[1][2]*m[2][1]
+	inv[0][1] = m[0][2]*m[2][1] - m[0][1]*m[2][2]
+	inv[0][2] = m[0][1]*m[1][2] - m[0][2]*m[1][1]
+	inv[1][0] = m[1][2]*m[2][0] - m[1][0]*m[2][2]
+	inv[1][1] = m[0][0]*m[2][2] - m[0][2]*m[2][0]
+	inv[1][2] = m[0][2]*m[1][0] - m[0][0]*m[1][2]
+	inv[2][0] = m[1][0]*m[2][1] - m[1][1]*m[2][0]
+	inv[2][1] = m[0][1]*m[2][0] - m[0][0]*m[2][1]
+	inv[2][2] = m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	det := m[0][0]*inv[0][0] + m[0][1]*inv[1][0] + m[0][2]*inv[2][0]
+	if det == 0 || math.IsNaN(det) {
+		return inv, false
+	}
+	for i := range inv {
+		for j := range inv[i] {
+			inv[i][j] /= det
+		}
+	}
+	return inv, true
+}
+
+// solve9 solves a x = b by Gaussian elimination with partial pivoting, and
+// returns false if a is singular.
+func solve9(a [9][9]float64, b [9]float64) ([9]float64, bool) {
+	const n = 9
+	var largest float64
+	for i := range a {
+		for j := range a[i] {
+			largest = math.Max(largest, math.Abs(a[i][j]))
+		}
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) <= largest*1e-12 {
+			return b, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < n; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c < n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	var x [9]float64
+	for r := n - 1; r >= 0; r-- {
+		s := b[r]
+		for c := r + 1; c < n; c++ {
+			s -= a[r][c] * x[c]
+		}
+		x[r] = s / a[r][r]
+	}
+	return x, true
+}
+
+// eigen3 returns the eigenvalues of the symmetric matrix m and the
+// eigenvectors as the columns of a matrix, by Jacobi rotations.
+func eigen3(m [3][3]float64) ([3]float64, [3][3]float64) {
+	v := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := m[0][1]*m[0][1] + m[0][2]*m[0][2] + m[1][2]*m[1][2]
+		if off == 0 {
+			break
+		}
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if m[p][q] == 0 {
+					continue
+				}
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				// m = Jᵀ m J with the rotation J in the plane p, q
+				for k := 0; k < 3; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p] = c*mkp - s*mkq
+					m[k][q] = s*mkp + c*mkq
+				}
+				for k := 0; k < 3; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k] = c*mpk - s*mqk
+					m[q][k] = s*mpk + c*mqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = c*vkp - s*vkq
+					v[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+	return [3]float64{m[0][0], m[1][1], m[2][2]}, v
+}
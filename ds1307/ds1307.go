@@ -12,6 +12,8 @@ import (
 	"machine"
 )
 
+var errSRAMRange = errors.New("ds1307: access outside of SRAM")
+
 // Device wraps an I2C connection to a DS1307 device.
 type Device struct {
 	bus         machine.I2C
@@ -66,21 +68,53 @@ func (d *Device) Time() (time.Time, error) {
 // relative to the current offset, and 2 means relative to the end.
 // returns new offset and error, if any
 func (d *Device) Seek(offset int64, whence int) (int64, error) {
+	var base int64
 	switch whence {
 	case 0:
-		whence = SRAMBeginAddres
+		base = SRAMBeginAddres
 	case 1:
-		whence = int(d.AddressSRAM)
+		base = int64(d.AddressSRAM)
 	case 2:
-		whence = SRAMEndAddress
+		base = SRAMEndAddress
 	default:
 		return 0, errors.New("invalid starting point")
 	}
-	d.AddressSRAM = uint8(whence) + uint8(offset)
-	if d.AddressSRAM > SRAMEndAddress {
+	// the position after the last byte is valid, like the end of a file
+	addr := base + offset
+	if addr < SRAMBeginAddres || addr > SRAMEndAddress+1 {
 		return 0, errors.New("EOF")
 	}
-	return int64(d.AddressSRAM), nil
+	d.AddressSRAM = uint8(addr)
+	return addr, nil
+}
+
+// ReadAt reads len(data) bytes of SRAM starting at offset, which is relative
+// to the origin of the SRAM. It satisfies the io.ReaderAt interface.
+func (d *Device) ReadAt(data []byte, offset int64) (n int, err error) {
+	if offset < 0 || offset+int64(len(data)) > SRAMSize {
+		return 0, errSRAMRange
+	}
+	err = d.bus.ReadRegister(d.Address, uint8(SRAMBeginAddres+offset), data)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteAt writes len(data) bytes to SRAM starting at offset, which is
+// relative to the origin of the SRAM. It satisfies the io.WriterAt interface.
+func (d *Device) WriteAt(data []byte, offset int64) (n int, err error) {
+	if offset < 0 || offset+int64(len(data)) > SRAMSize {
+		return 0, errSRAMRange
+	}
+	buffer := make([]byte, len(data)+1)
+	buffer[0] = uint8(SRAMBeginAddres + offset)
+	copy(buffer[1:], data)
+	err = d.bus.Tx(uint16(d.Address), buffer, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
 }
 
 // Write writes len(data) bytes to SRAM
@@ -0,0 +1,126 @@
+package ds1307_test
+
+import (
+	"bytes"
+	"machine"
+	"testing"
+
+	"tinygo.org/x/drivers/ds1307"
+)
+
+// rtc simulates the registers of a DS1307 through the I2C hooks of the
+// machine package.
+type rtc struct {
+	t    *testing.T
+	regs [64]byte
+	txs  int
+}
+
+func newRTC(t *testing.T) (*rtc, *ds1307.Device) {
+	r := &rtc{t: t}
+	machine.TxHook = func(addr uint16, w, _ []byte) error {
+		r.check(addr, w[0], len(w)-1)
+		copy(r.regs[w[0]:], w[1:])
+		return nil
+	}
+	machine.ReadHook = func(addr, reg uint8, buf []byte) error {
+		r.check(uint16(addr), reg, len(buf))
+		copy(buf, r.regs[reg:])
+		return nil
+	}
+	t.Cleanup(func() { machine.TxHook, machine.ReadHook = nil, nil })
+	d := ds1307.New(machine.I2C0)
+	return r, &d
+}
+
+func (r *rtc) check(addr uint16, reg uint8, n int) {
+	r.txs++
+	if addr != ds1307.I2CAddress {
+		r.t.Errorf("transaction with address %#x", addr)
+	}
+	if int(reg)+n > len(r.regs) {
+		r.t.Fatalf("access of %d bytes at register %#x", n, reg)
+	}
+}
+
+func TestReadWriteAt(t *testing.T) {
+	r, d := newRTC(t)
+	if n, err := d.WriteAt([]byte{1, 2, 3}, 10); n != 3 || err != nil {
+		t.Fatalf("WriteAt: got %d, %v", n, err)
+	}
+	// the offset is relative to the SRAM at 0x08
+	if !bytes.Equal(r.regs[0x12:0x15], []byte{1, 2, 3}) {
+		t.Errorf("registers % x", r.regs)
+	}
+
+	copy(r.regs[0x3C:], []byte{4, 5, 6, 7})
+	buf := make([]byte, 4)
+	if n, err := d.ReadAt(buf, 52); n != 4 || err != nil || !bytes.Equal(buf, []byte{4, 5, 6, 7}) {
+		t.Errorf("ReadAt: got %d, %v, % x", n, err, buf)
+	}
+
+	// no access outside of the SRAM reaches the bus
+	r.txs = 0
+	for _, offset := range []int64{-1, 53, 56} {
+		if _, err := d.ReadAt(buf, offset); err == nil {
+			t.Errorf("ReadAt %d: no error", offset)
+		}
+		if _, err := d.WriteAt(buf, offset); err == nil {
+			t.Errorf("WriteAt %d: no error", offset)
+		}
+	}
+	if r.txs != 0 {
+		t.Errorf("%d transactions", r.txs)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	_, d := newRTC(t)
+	for _, tc := range []struct {
+		offset int64
+		whence int
+		want   int64
+		ok     bool
+	}{
+		{0, 0, 0x08, true},
+		{10, 1, 0x12, true},
+		{-11, 1, 0, false},
+		{1, 2, 0x40, true},
+		{2, 2, 0, false},
+		{0, 3, 0, false},
+		// beyond the range of the register address
+		{250, 0, 0, false},
+		{-3, 2, 0x3C, true},
+	} {
+		got, err := d.Seek(tc.offset, tc.whence)
+		if (err == nil) != tc.ok || tc.ok && got != tc.want {
+			t.Errorf("Seek(%d, %d): got %#x, %v", tc.offset, tc.whence, got, err)
+		}
+	}
+	if d.AddressSRAM != 0x3C {
+		t.Errorf("at %#x, want 0x3c", d.AddressSRAM)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	r, d := newRTC(t)
+	d.Seek(-3, 2)
+	if n, err := d.Write([]byte{7, 8, 9, 10}); n != 4 || err != nil {
+		t.Fatalf("Write: got %d, %v", n, err)
+	}
+	if !bytes.Equal(r.regs[0x3C:], []byte{7, 8, 9, 10}) || d.AddressSRAM != 0x40 {
+		t.Errorf("registers % x, at %#x", r.regs[0x3C:], d.AddressSRAM)
+	}
+	if _, err := d.Write([]byte{1}); err == nil {
+		t.Error("Write at the end: no error")
+	}
+
+	d.Seek(-2, 1)
+	buf := make([]byte, 2)
+	if n, err := d.Read(buf); n != 2 || err != nil || !bytes.Equal(buf, []byte{9, 10}) {
+		t.Errorf("Read: got %d, %v, % x", n, err, buf)
+	}
+	if _, err := d.Read(buf); err == nil {
+		t.Error("Read at the end: no error")
+	}
+}
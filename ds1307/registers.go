@@ -8,6 +8,7 @@ const (
 	CH              = 0x7
 	SRAMBeginAddres = 0x8
 	SRAMEndAddress  = 0x3F
+	SRAMSize        = SRAMEndAddress - SRAMBeginAddres + 1
 )
 
 const (
@@ -3,6 +3,10 @@ package ds3231
 // The I2C address which this device listens to.
 const Address = 0x68
 
+// The I2C address of the AT24C32 EEPROM found on many DS3231 boards, which
+// can be used with package eeprom.
+const EEPROMAddress = 0x57
+
 // Registers
 const (
 	REG_TIMEDATE = 0x00
@@ -0,0 +1,243 @@
+// Package eeprom provides a driver for the 24C01 to 24C1024 family of I2C
+// serial EEPROMs, such as the Atmel/Microchip AT24C and 24LC series.
+//
+// Chips up to 16kbit (24C16) take a one byte word address, chips from 32kbit
+// on two bytes. The address bits that don't fit into the word address select
+// a block and are sent in the low bits of the I2C address, so for example a
+// 24C16 occupies the I2C addresses 0x50 to 0x57.
+//
+// The EEPROM on many DS3231 RTC boards is an AT24C32 at address 0x57:
+//
+//	rom := eeprom.New(machine.I2C0)
+//	rom.Address = 0x57
+//	rom.Configure(eeprom.AT24C32)
+//
+// Datasheet:
+// https://ww1.microchip.com/downloads/en/DeviceDoc/AT24C01A-02-04-08-16-Data-Sheet-DS20006175B.pdf
+package eeprom // import "tinygo.org/x/drivers/eeprom"
+
+import (
+	"errors"
+	"io"
+	"machine"
+	"time"
+)
+
+// Address is the I2C address of a chip with all address pins low.
+const Address = 0x50
+
+// Configurations of the chips of the family.
+var (
+	AT24C01   = Config{Size: 128, PageSize: 8}
+	AT24C02   = Config{Size: 256, PageSize: 8}
+	AT24C04   = Config{Size: 512, PageSize: 16}
+	AT24C08   = Config{Size: 1024, PageSize: 16}
+	AT24C16   = Config{Size: 2048, PageSize: 16}
+	AT24C32   = Config{Size: 4096, PageSize: 32}
+	AT24C64   = Config{Size: 8192, PageSize: 32}
+	AT24C128  = Config{Size: 16384, PageSize: 64}
+	AT24C256  = Config{Size: 32768, PageSize: 64}
+	AT24C512  = Config{Size: 65536, PageSize: 128}
+	AT24C1024 = Config{Size: 131072, PageSize: 256}
+)
+
+var (
+	ErrInvalidConfig = errors.New("eeprom: invalid configuration")
+	ErrOutOfRange    = errors.New("eeprom: address out of range")
+	ErrWriteTimeout  = errors.New("eeprom: write cycle timeout")
+	errInvalidWhence = errors.New("eeprom: invalid whence")
+)
+
+// writeTimeout is the longest a write cycle may take; datasheets specify
+// 5ms to 10ms.
+const writeTimeout = 20 * time.Millisecond
+
+// Config describes the memory of a chip.
+type Config struct {
+	// Size is the size of the memory in bytes.
+	Size int64
+
+	// PageSize is the number of bytes that can be written at once, 8 to 256.
+	PageSize int
+
+	// AddressBytes is the number of bytes of the word address, 1 or 2. If
+	// zero, it is 1 for chips up to 2kB and 2 for larger chips.
+	AddressBytes int
+}
+
+// Device wraps an I2C connection to an EEPROM.
+type Device struct {
+	bus     machine.I2C
+	Address uint16
+
+	size      int64
+	pageSize  int64
+	addrBytes int
+	pos       int64 // offset of Read, Write and Seek
+	buf       []byte
+	word      [2]byte // word address of wordAddress
+}
+
+// New creates a new EEPROM connection. The I2C bus must already be
+// configured.
+//
+// This function only creates the Device object, it does not touch the device.
+func New(bus machine.I2C) Device {
+	return Device{
+		bus:     bus,
+		Address: Address,
+	}
+}
+
+// Configure sets the size and organization of the memory, such as
+// AT24C256.
+func (d *Device) Configure(cfg Config) error {
+	addrBytes := cfg.AddressBytes
+	if addrBytes == 0 {
+		addrBytes = 1
+		if cfg.Size > 2048 {
+			addrBytes = 2
+		}
+	}
+	if cfg.Size <= 0 || cfg.PageSize < 1 || cfg.PageSize > 256 || addrBytes > 2 ||
+		cfg.Size > int64(8)<<(8*addrBytes) {
+		return ErrInvalidConfig
+	}
+	d.size = cfg.Size
+	d.pageSize = int64(cfg.PageSize)
+	d.addrBytes = addrBytes
+	d.buf = make([]byte, addrBytes+cfg.PageSize)
+	d.pos = 0
+	return nil
+}
+
+// Size returns the size of the memory in bytes.
+func (d *Device) Size() int64 {
+	return d.size
+}
+
+// ReadAt satisfies the io.ReaderAt interface.
+func (d *Device) ReadAt(data []byte, offset int64) (n int, err error) {
+	if offset < 0 || offset+int64(len(data)) > d.size {
+		return 0, ErrOutOfRange
+	}
+	// sequential reads may not cross into the next block
+	block := int64(1) << (8 * d.addrBytes)
+	for n < len(data) {
+		addr := offset + int64(n)
+		chunk := data[n:]
+		if rest := block - addr%block; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		if err = d.bus.Tx(d.i2cAddress(addr), d.wordAddress(addr), chunk); err != nil {
+			return
+		}
+		n += len(chunk)
+	}
+	return
+}
+
+// WriteAt satisfies the io.WriterAt interface. Data is written one page at a
+// time, waiting for each write cycle to complete. Pages whose content is
+// already equal to data are not written, to save time and wear.
+func (d *Device) WriteAt(data []byte, offset int64) (n int, err error) {
+	if offset < 0 || offset+int64(len(data)) > d.size {
+		return 0, ErrOutOfRange
+	}
+	for n < len(data) {
+		addr := offset + int64(n)
+		chunk := data[n:]
+		if rest := d.pageSize - addr%d.pageSize; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		cur := d.buf[d.addrBytes : d.addrBytes+len(chunk)]
+		if _, err = d.ReadAt(cur, addr); err != nil {
+			return
+		}
+		if string(cur) != string(chunk) {
+			copy(d.buf, d.wordAddress(addr))
+			copy(cur, chunk)
+			if err = d.bus.Tx(d.i2cAddress(addr), d.buf[:d.addrBytes+len(chunk)], nil); err != nil {
+				return
+			}
+			if err = d.waitWrite(addr); err != nil {
+				return
+			}
+		}
+		n += len(chunk)
+	}
+	return
+}
+
+// waitWrite waits for the write cycle to complete: the chip doesn't
+// acknowledge its address until then. It is polled every millisecond, so as
+// not to keep the bus busy.
+func (d *Device) waitWrite(addr int64) error {
+	start := time.Now()
+	for {
+		if d.bus.Tx(d.i2cAddress(addr), d.wordAddress(addr), nil) == nil {
+			return nil
+		}
+		if time.Since(start) > writeTimeout {
+			return ErrWriteTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Seek sets the offset for the next Read or Write to offset, interpreted
+// according to whence: io.SeekStart, io.SeekCurrent or io.SeekEnd.
+func (d *Device) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errInvalidWhence
+	}
+	if offset < 0 || offset > d.size {
+		return 0, ErrOutOfRange
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// Read satisfies the io.Reader interface, reading from the offset set by
+// Seek.
+func (d *Device) Read(data []byte) (n int, err error) {
+	if d.pos >= d.size {
+		return 0, io.EOF
+	}
+	if rest := d.size - d.pos; int64(len(data)) > rest {
+		data = data[:rest]
+	}
+	n, err = d.ReadAt(data, d.pos)
+	d.pos += int64(n)
+	return
+}
+
+// Write satisfies the io.Writer interface, writing at the offset set by
+// Seek.
+func (d *Device) Write(data []byte) (n int, err error) {
+	n, err = d.WriteAt(data, d.pos)
+	d.pos += int64(n)
+	return
+}
+
+// i2cAddress returns the I2C address of the block holding addr.
+func (d *Device) i2cAddress(addr int64) uint16 {
+	return d.Address | uint16(addr>>(8*d.addrBytes))
+}
+
+// wordAddress returns the word address of addr within its block. It is
+// valid until the next call.
+func (d *Device) wordAddress(addr int64) []byte {
+	if d.addrBytes == 1 {
+		d.word[0] = byte(addr)
+	} else {
+		d.word[0], d.word[1] = byte(addr>>8), byte(addr)
+	}
+	return d.word[:d.addrBytes]
+}
@@ -0,0 +1,294 @@
+package eeprom_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"machine"
+	"testing"
+
+	"tinygo.org/x/drivers/eeprom"
+)
+
+var errNak = errors.New("no acknowledgement")
+
+// tx is an I2C transaction with the chip.
+type tx struct {
+	addr  uint16
+	ptr   int // address in the memory
+	write int // bytes written
+	read  int // bytes read
+}
+
+// chip simulates an EEPROM through the I2C hooks of the machine package. It
+// doesn't acknowledge its address for busy transactions after each write.
+type chip struct {
+	t         *testing.T
+	mem       []byte
+	pageSize  int
+	addrBytes int
+	busy      int
+
+	cycle int // transactions left in the write cycle
+	txs   []tx
+	polls int
+}
+
+func newChip(t *testing.T, cfg eeprom.Config, addrBytes int) (*chip, *eeprom.Device) {
+	c := &chip{t: t, mem: make([]byte, cfg.Size), pageSize: cfg.PageSize, addrBytes: addrBytes}
+	machine.TxHook = c.tx
+	t.Cleanup(func() { machine.TxHook = nil })
+	d := eeprom.New(machine.I2C0)
+	if err := d.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return c, &d
+}
+
+func (c *chip) tx(addr uint16, w, r []byte) error {
+	if addr&^0x07 != eeprom.Address {
+		c.t.Fatalf("transaction with address %#x", addr)
+	}
+	if c.cycle > 0 {
+		c.cycle--
+		c.polls++
+		return errNak
+	}
+	if len(w) < c.addrBytes {
+		c.t.Fatalf("word address of %d bytes", len(w))
+	}
+	// the block in the I2C address, and the word address within it
+	block := 1 << (8 * c.addrBytes)
+	ptr := int(addr-eeprom.Address) * block
+	word := 0
+	for _, b := range w[:c.addrBytes] {
+		word = word<<8 | int(b)
+	}
+	ptr |= word
+	data := w[c.addrBytes:]
+	c.txs = append(c.txs, tx{addr, ptr, len(data), len(r)})
+	if len(data) > 0 {
+		// a chip wraps around within the page
+		if ptr/c.pageSize != (ptr+len(data)-1)/c.pageSize {
+			c.t.Errorf("write of %d bytes at %#x crosses a page", len(data), ptr)
+		}
+		copy(c.mem[ptr:], data)
+		c.cycle = c.busy
+	}
+	if len(r) > 0 {
+		// and a read within the block of its address
+		if ptr/block != (ptr+len(r)-1)/block {
+			c.t.Errorf("read of %d bytes at %#x crosses a block", len(r), ptr)
+		}
+		copy(r, c.mem[ptr:])
+	}
+	return nil
+}
+
+// writes returns the page writes.
+func (c *chip) writes() []tx {
+	var writes []tx
+	for _, t := range c.txs {
+		if t.write > 0 {
+			writes = append(writes, t)
+		}
+	}
+	return writes
+}
+
+func pattern(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i)
+	}
+	return b
+}
+
+func TestWriteAtPages(t *testing.T) {
+	c, d := newChip(t, eeprom.AT24C02, 1)
+	c.busy = 3
+	data := pattern(20, 1)
+	if n, err := d.WriteAt(data, 5); n != 20 || err != nil {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if !bytes.Equal(c.mem[5:25], data) {
+		t.Errorf("memory % x", c.mem[:32])
+	}
+	// split at the pages of 8 bytes, waiting for each write cycle
+	want := []tx{{0x50, 5, 3, 0}, {0x50, 8, 8, 0}, {0x50, 16, 8, 0}, {0x50, 24, 1, 0}}
+	if got := c.writes(); len(got) != len(want) {
+		t.Fatalf("got writes %v, want %v", got, want)
+	} else {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("write %d: got %v, want %v", i, got[i], want[i])
+			}
+		}
+	}
+	if c.polls != 4*3 {
+		t.Errorf("%d polls were not acknowledged, want 12", c.polls)
+	}
+
+	// pages that hold the data already are not written again
+	c.txs = nil
+	copy(data[11:], []byte{0xAA, 0xBB})
+	if _, err := d.WriteAt(data, 5); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.writes(); len(got) != 1 || got[0] != (tx{0x50, 16, 8, 0}) {
+		t.Errorf("got writes %v, want the page at 16", got)
+	}
+
+	got := make([]byte, 20)
+	if n, err := d.ReadAt(got, 5); n != 20 || err != nil || !bytes.Equal(got, data) {
+		t.Errorf("got %d, %v, % x", n, err, got)
+	}
+}
+
+// TestBlockAddress checks that the address bits beyond the word address of
+// the 24C04, 24C08 and 24C16 go to the I2C address.
+func TestBlockAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  eeprom.Config
+	}{
+		{"24C04", eeprom.AT24C04},
+		{"24C08", eeprom.AT24C08},
+		{"24C16", eeprom.AT24C16},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, d := newChip(t, tc.cfg, 1)
+			size := int(tc.cfg.Size)
+			data := pattern(size, 7)
+			if _, err := d.WriteAt(data, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(c.mem, data) {
+				t.Error("wrong memory content")
+			}
+			for i, w := range c.writes() {
+				if int(w.addr) != eeprom.Address|w.ptr>>8 {
+					t.Errorf("write %d at %#x to address %#x", i, w.ptr, w.addr)
+				}
+			}
+
+			// a read of the whole memory is split at the blocks
+			c.txs = nil
+			got := make([]byte, size)
+			if _, err := d.ReadAt(got, 0); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("ReadAt: %v", err)
+			}
+			if len(c.txs) != size/256 {
+				t.Errorf("read in %d transactions, want %d", len(c.txs), size/256)
+			}
+			for i, r := range c.txs {
+				if r.ptr != i*256 || r.read != 256 || r.addr != uint16(eeprom.Address+i) {
+					t.Errorf("read %d: %v", i, r)
+				}
+			}
+
+			// around the last block boundary
+			c.txs = nil
+			if _, err := d.ReadAt(got[:4], int64(size-258)); err != nil || !bytes.Equal(got[:4], data[size-258:size-254]) {
+				t.Errorf("ReadAt: %v, % x", err, got[:4])
+			}
+			last := uint16(eeprom.Address + size/256 - 1)
+			if len(c.txs) != 2 || c.txs[0].addr != last-1 || c.txs[0].read != 2 || c.txs[1].addr != last || c.txs[1].ptr != size-256 {
+				t.Errorf("reads %v", c.txs)
+			}
+		})
+	}
+}
+
+func TestTwoByteAddress(t *testing.T) {
+	c, d := newChip(t, eeprom.AT24C32, 2)
+	data := pattern(40, 3)
+	if _, err := d.WriteAt(data, 0x7F0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.mem[0x7F0:0x818], data) {
+		t.Errorf("memory % x", c.mem[0x7F0:0x818])
+	}
+	want := []tx{{0x50, 0x7F0, 16, 0}, {0x50, 0x800, 24, 0}}
+	if got := c.writes(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got writes %v, want %v", got, want)
+	}
+	if _, err := d.WriteAt(data, 0xFF0); err != eeprom.ErrOutOfRange {
+		t.Errorf("got %v, want %v", err, eeprom.ErrOutOfRange)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	c, d := newChip(t, eeprom.AT24C02, 1)
+	c.busy = 1000
+	if _, err := d.WriteAt([]byte{1}, 0); err != eeprom.ErrWriteTimeout {
+		t.Fatalf("got %v, want %v", err, eeprom.ErrWriteTimeout)
+	}
+	// polled about every millisecond for 20ms
+	if c.polls < 5 || c.polls > 40 {
+		t.Errorf("polled %d times", c.polls)
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	c, d := newChip(t, eeprom.AT24C01, 1)
+	buf := make([]byte, 8)
+	for _, offset := range []int64{-1, 121, 128} {
+		if _, err := d.ReadAt(buf, offset); err != eeprom.ErrOutOfRange {
+			t.Errorf("ReadAt %d: got %v", offset, err)
+		}
+		if _, err := d.WriteAt(buf, offset); err != eeprom.ErrOutOfRange {
+			t.Errorf("WriteAt %d: got %v", offset, err)
+		}
+	}
+	if len(c.txs) != 0 {
+		t.Errorf("%d transactions", len(c.txs))
+	}
+	if err := d.Configure(eeprom.Config{Size: 4096, PageSize: 32, AddressBytes: 1}); err != eeprom.ErrInvalidConfig {
+		t.Errorf("Configure: got %v, want %v", err, eeprom.ErrInvalidConfig)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	c, d := newChip(t, eeprom.AT24C01, 1)
+	copy(c.mem, pattern(128, 0))
+	for _, tc := range []struct {
+		offset int64
+		whence int
+		want   int64
+		err    error
+	}{
+		{10, io.SeekStart, 10, nil},
+		{5, io.SeekCurrent, 15, nil},
+		{-8, io.SeekEnd, 120, nil},
+		{0, io.SeekEnd, 128, nil},
+		{1, io.SeekEnd, 0, eeprom.ErrOutOfRange},
+		{-1, io.SeekStart, 0, eeprom.ErrOutOfRange},
+	} {
+		pos, err := d.Seek(tc.offset, tc.whence)
+		if err != tc.err || err == nil && pos != tc.want {
+			t.Errorf("Seek(%d, %d): got %d, %v, want %d, %v", tc.offset, tc.whence, pos, err, tc.want, tc.err)
+		}
+	}
+
+	if _, err := d.Seek(0, 3); err == nil {
+		t.Error("Seek with an invalid whence")
+	}
+
+	d.Seek(120, io.SeekStart)
+	buf := make([]byte, 16)
+	if n, err := d.Read(buf); n != 8 || err != nil || buf[0] != 120 {
+		t.Errorf("Read: got %d, %v, % x", n, err, buf[:n])
+	}
+	if n, err := d.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read at the end: got %d, %v", n, err)
+	}
+
+	d.Seek(-4, io.SeekCurrent)
+	if n, err := d.Write([]byte{0xAA, 0xBB}); n != 2 || err != nil || c.mem[124] != 0xAA || c.mem[125] != 0xBB {
+		t.Errorf("Write: got %d, %v", n, err)
+	}
+	if pos, _ := d.Seek(0, io.SeekCurrent); pos != 126 {
+		t.Errorf("at %d after Write, want 126", pos)
+	}
+}
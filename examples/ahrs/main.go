@@ -0,0 +1,48 @@
+// This example estimates the orientation of an LSM6DS3 IMU and a MAG3110
+// magnetometer with a Madgwick filter, and prints the roll, pitch and
+// heading. The gyroscope bias is measured first, with the board at rest.
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/ahrs"
+	"tinygo.org/x/drivers/calibration"
+	"tinygo.org/x/drivers/lsm6ds3"
+	"tinygo.org/x/drivers/mag3110"
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{})
+
+	imu := lsm6ds3.New(machine.I2C0)
+	imu.Configure(lsm6ds3.Configuration{})
+	if !imu.Connected() {
+		println("LSM6DS3 not connected")
+		return
+	}
+	mag := mag3110.New(machine.I2C0)
+	mag.Configure()
+
+	println("keep the board still")
+	var gc calibration.GyroCalibrator
+	calibration.Record(&gc, calibration.NoError(imu.ReadRotation), 200, 10*time.Millisecond)
+	bias, _ := gc.Result()
+	gyro := calibration.NewGyroscope(calibration.NoError(imu.ReadRotation), bias)
+
+	a := ahrs.New(ahrs.NewMadgwick(0.1),
+		calibration.NoError(imu.ReadAcceleration),
+		gyro.ReadRotation,
+		calibration.Int16(mag.ReadMagnetic))
+	for i := 0; ; i++ {
+		if err := a.Update(); err != nil {
+			println("update:", err.Error())
+		}
+		if i%20 == 0 {
+			roll, pitch, heading := a.Quaternion().Euler()
+			println("roll:", int32(roll), "pitch:", int32(pitch), "heading:", int32(heading))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
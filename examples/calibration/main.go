@@ -0,0 +1,65 @@
+// This example calibrates the accelerometer and the magnetometer of a BBC
+// micro:bit, prints the calibration to store it, and then prints corrected
+// readings.
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/calibration"
+	"tinygo.org/x/drivers/mag3110"
+	"tinygo.org/x/drivers/mma8653"
+)
+
+var positions = [...]string{"X up", "X down", "Y up", "Y down", "Z up", "Z down"}
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{})
+
+	accel := mma8653.New(machine.I2C0)
+	accel.Configure(mma8653.DataRate200Hz, mma8653.Sensitivity2G)
+	mag := mag3110.New(machine.I2C0)
+	mag.Configure()
+
+	var cal calibration.Calibration
+	var err error
+
+	println("hold the board still in each position until it is done")
+	var ac calibration.AccelCalibrator
+	for p := calibration.XUp; p <= calibration.ZDown; p++ {
+		println("position:", positions[p])
+		for ac.Count(p) < 100 {
+			x, y, z, _ := accel.ReadAcceleration()
+			ac.Add(x, y, z)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if cal.Accel, err = ac.Result(); err != nil {
+		println("accelerometer:", err.Error())
+	}
+
+	println("turn the board in all directions for 30 seconds")
+	var mc calibration.MagCalibrator
+	calibration.Record(&mc, calibration.Int16(mag.ReadMagnetic), 600, 50*time.Millisecond)
+	if cal.Mag, err = mc.Result(); err != nil {
+		println("magnetometer:", err.Error())
+	}
+
+	data, _ := cal.MarshalBinary()
+	print("calibration:")
+	for _, b := range data {
+		print(" ", b)
+	}
+	println()
+
+	correctedAccel := calibration.NewAccelerometer(accel.ReadAcceleration, cal.Accel)
+	correctedMag := calibration.NewMagnetometer(calibration.Int16(mag.ReadMagnetic), cal.Mag)
+	for {
+		x, y, z, _ := correctedAccel.ReadAcceleration()
+		println("acceleration:", x, y, z)
+		x, y, z, _ = correctedMag.ReadMagnetic()
+		println("magnetic:", x, y, z)
+		time.Sleep(500 * time.Millisecond)
+	}
+}
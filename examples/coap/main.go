@@ -0,0 +1,66 @@
+// This example uses an ESP8266/ESP32 running the espat firmware to serve a
+// CoAP resource with the current uptime, which clients can observe.
+//
+// Try it with libcoap: coap-client -m get -s 30 coap://<device-ip>/uptime
+package main
+
+import (
+	"machine"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/espat"
+	"tinygo.org/x/drivers/net/coap"
+)
+
+// access point info
+const ssid = "YOURSSID"
+const pass = "YOURPASS"
+
+// these are the default pins for the Arduino Nano33 IoT.
+// change these to connect to a different UART or pins for the ESP8266/ESP32
+var (
+	uart = machine.UART1
+	tx   = machine.PA22
+	rx   = machine.PA23
+
+	adaptor *espat.Device
+)
+
+func main() {
+	uart.Configure(machine.UARTConfig{TX: tx, RX: rx})
+	adaptor = espat.New(uart)
+	adaptor.Configure()
+	for !adaptor.Connected() {
+		println("Connecting to wifi adaptor...")
+		time.Sleep(1 * time.Second)
+	}
+	adaptor.Echo(false)
+	adaptor.SetWifiMode(espat.WifiModeClient)
+	for adaptor.ConnectToAP(ssid, pass, 10) != nil {
+		println("Connecting to " + ssid + "...")
+	}
+
+	server, err := coap.Listen(coap.DefaultPort)
+	if err != nil {
+		println("Listen failed:", err.Error())
+		return
+	}
+
+	start := time.Now()
+	server.HandleObservable("/uptime", func(resp, req *coap.Message) {
+		resp.Options.SetUint(coap.ContentType, uint32(coap.TextPlain))
+		resp.Payload = []byte(strconv.Itoa(int(time.Since(start).Seconds())))
+	})
+
+	last := time.Now()
+	for {
+		if err := server.Poll(100 * time.Millisecond); err != nil {
+			println("Poll failed:", err.Error())
+		}
+		if time.Since(last) > 5*time.Second {
+			server.Notify("/uptime")
+			last = time.Now()
+		}
+	}
+}
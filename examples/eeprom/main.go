@@ -0,0 +1,42 @@
+// This example uses the AT24C32 EEPROM of a DS3231 RTC board, written across
+// page boundaries and read back through io.ReaderAt and io.WriterAt.
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/ds3231"
+	"tinygo.org/x/drivers/eeprom"
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{})
+
+	rom := eeprom.New(machine.I2C0)
+	rom.Address = ds3231.EEPROMAddress
+	if err := rom.Configure(eeprom.AT24C32); err != nil {
+		println("could not configure:", err.Error())
+		return
+	}
+
+	// 100 bytes starting in the middle of a 32 byte page
+	values := make([]byte, 100)
+	for i := range values {
+		values[i] = byte('A' + i%26)
+	}
+	if _, err := rom.WriteAt(values, 20); err != nil {
+		println("could not write:", err.Error())
+		return
+	}
+
+	data := make([]byte, len(values))
+	for {
+		if _, err := rom.ReadAt(data, 20); err != nil {
+			println("could not read:", err.Error())
+			return
+		}
+		println(string(data))
+		time.Sleep(time.Second)
+	}
+}
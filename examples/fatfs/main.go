@@ -0,0 +1,72 @@
+// This example mounts the CIRCUITPY FAT volume on the QSPI flash of an
+// Adafruit board, lists the files in its root directory and appends a line
+// to a log file. If the flash holds no FAT filesystem, it is formatted.
+package main
+
+import (
+	"io"
+	"machine"
+	"os"
+	"time"
+
+	"tinygo.org/x/drivers/fatfs"
+	"tinygo.org/x/drivers/flash"
+)
+
+func main() {
+	time.Sleep(3 * time.Second)
+
+	dev := flash.NewQSPI(
+		machine.QSPI_CS,
+		machine.QSPI_SCK,
+		machine.QSPI_DATA0,
+		machine.QSPI_DATA1,
+		machine.QSPI_DATA2,
+		machine.QSPI_DATA3,
+	)
+	if err := dev.Configure(&flash.DeviceConfig{Identifier: flash.DefaultDeviceIdentifier}); err != nil {
+		fail("configure flash", err)
+	}
+
+	fs := &fatfs.FS{}
+	if err := fs.Mount(dev); err != nil {
+		println("No filesystem found, formatting...")
+		if err := fatfs.Format(dev, &fatfs.FormatConfig{Label: "CIRCUITPY", FATs: 1}); err != nil {
+			fail("format", err)
+		}
+		if err := fs.Mount(dev); err != nil {
+			fail("mount", err)
+		}
+	}
+
+	files, err := fs.ReadDir("/")
+	if err != nil {
+		fail("read dir", err)
+	}
+	for _, fi := range files {
+		if fi.IsDir() {
+			println(fi.Name() + "/")
+		} else {
+			println(fi.Name(), fi.Size())
+		}
+	}
+
+	f, err := fs.Open("/log.txt", os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		fail("open log", err)
+	}
+	if _, err := io.WriteString(f, "hello from TinyGo\n"); err != nil {
+		fail("write log", err)
+	}
+	if err := f.Close(); err != nil {
+		fail("close log", err)
+	}
+	println("Done.")
+}
+
+func fail(msg string, err error) {
+	for {
+		println(msg+":", err.Error())
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,110 @@
+// This example stages a signed firmware image with the ota package on an
+// emulated flash chip. The download is interrupted by a power loss halfway
+// and resumed where it stopped, as it would be after a reboot.
+//
+// It runs on a microcontroller as well as on a computer:
+//
+// go run ./examples/flash/ota
+package main
+
+import (
+	"crypto/ed25519"
+
+	"tinygo.org/x/drivers/flash/flashemu"
+	"tinygo.org/x/drivers/flash/ota"
+)
+
+const (
+	pageSize   = 256
+	sectorSize = 4096
+	chunkSize  = 512 // size of the messages the image arrives in
+)
+
+// two metadata sectors followed by two slots
+var slots = []ota.Slot{{Start: 2, Blocks: 8}, {Start: 10, Blocks: 8}}
+
+func main() {
+	// the private key is only known to the build server
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	pub := key.Public().(ed25519.PublicKey)
+
+	firmware := make([]byte, 20000)
+	for i := range firmware {
+		firmware[i] = byte(i * 7)
+	}
+	header := ota.NewHeader(2, firmware, key)
+	image := append(header.Bytes(), firmware...)
+
+	dev := flashemu.New(18*sectorSize, pageSize, sectorSize)
+	dev.Strict = true
+	m := ota.New(dev, 0, slots, pub)
+	if err := m.Mount(); err != nil {
+		fail("mount", err)
+	}
+
+	// receive the first part of the image, until the power is lost
+	u, err := m.Begin(1)
+	if err != nil {
+		fail("begin", err)
+	}
+	dev.PowerLossAt(40)
+	if err := send(u, image); err != flashemu.ErrPowerLoss {
+		fail("expected power loss", err)
+	}
+	dev.PowerOn()
+
+	// after the reboot, ask the server for the rest of the image
+	m = ota.New(dev, 0, slots, pub)
+	if err := m.Mount(); err != nil {
+		fail("mount", err)
+	}
+	if u, err = m.Resume(1); err != nil {
+		fail("resume", err)
+	}
+	println("resuming at", u.Offset(), "of", len(image), "bytes")
+	if err := send(u, image[u.Offset():]); err != nil {
+		fail("write", err)
+	}
+	if err := u.Finish(); err != nil {
+		fail("finish", err)
+	}
+
+	st, err := m.Status(1)
+	if err != nil {
+		fail("status", err)
+	}
+	println("slot 1:", st.State.String(), "version", st.Header.Version)
+
+	// this is what the new firmware does once it has booted successfully
+	if err := m.Confirm(1); err != nil {
+		fail("confirm", err)
+	}
+	st, _ = m.Status(1)
+	println("slot 1:", st.State.String())
+}
+
+// send writes data to u in chunks, like the messages of a download.
+func send(u *ota.Update, data []byte) error {
+	for len(data) > 0 {
+		n := chunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := u.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func fail(msg string, err error) {
+	if err != nil {
+		msg += ": " + err.Error()
+	}
+	panic(msg)
+}
@@ -0,0 +1,86 @@
+// This example splits the QSPI flash of an Adafruit board into partitions:
+// two firmware update slots, a configuration store and a filesystem. If the
+// flash holds no partition table, one is written, erasing any CircuitPython
+// files. The configuration store then counts the number of boots.
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/flash"
+	"tinygo.org/x/drivers/flash/kvstore"
+	"tinygo.org/x/drivers/flash/partition"
+)
+
+const (
+	kB = 1024
+	MB = 1024 * kB
+)
+
+func main() {
+	time.Sleep(3 * time.Second)
+
+	dev := flash.NewQSPI(
+		machine.QSPI_CS,
+		machine.QSPI_SCK,
+		machine.QSPI_DATA0,
+		machine.QSPI_DATA1,
+		machine.QSPI_DATA2,
+		machine.QSPI_DATA3,
+	)
+	if err := dev.Configure(&flash.DeviceConfig{Identifier: flash.DefaultDeviceIdentifier}); err != nil {
+		fail("configure flash", err)
+	}
+
+	// the table is in the first erase block
+	table, err := partition.ReadTable(dev, 0)
+	if err != nil {
+		println("No partition table found, writing one...")
+		table, err = partition.WriteTable(dev, 0, []partition.Partition{
+			{Name: "ota-meta", Offset: 4 * kB, Size: 4 * kB, Type: partition.TypeFirmware},
+			{Name: "ota-a", Offset: 64 * kB, Size: 512 * kB, Type: partition.TypeFirmware},
+			{Name: "ota-b", Offset: 576 * kB, Size: 512 * kB, Type: partition.TypeFirmware},
+			{Name: "config", Offset: 1088 * kB, Size: 64 * kB, Type: partition.TypeConfig},
+			{Name: "fs", Offset: 1152 * kB, Size: dev.Size() - 1152*kB, Type: partition.TypeFilesystem},
+		})
+		if err != nil {
+			fail("write partition table", err)
+		}
+	}
+	for _, p := range table.Partitions {
+		println(p.Name, p.Type.String(), p.Offset, p.Size)
+	}
+
+	config, err := table.Open("config")
+	if err != nil {
+		fail("open config", err)
+	}
+	store := kvstore.New(config, 0, config.Size()/config.EraseBlockSize())
+	if err := store.Mount(); err != nil {
+		fail("mount config", err)
+	}
+	var buf [4]byte
+	n, _ := store.Get("boots", buf[:])
+	count := uint32(0)
+	if n == 4 {
+		count = uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
+	}
+	count++
+	buf = [4]byte{byte(count), byte(count >> 8), byte(count >> 16), byte(count >> 24)}
+	if err := store.Set("boots", buf[:]); err != nil {
+		fail("set", err)
+	}
+
+	for {
+		println("boot count:", count)
+		time.Sleep(time.Second)
+	}
+}
+
+func fail(msg string, err error) {
+	for {
+		println(msg+":", err.Error())
+		time.Sleep(time.Second)
+	}
+}
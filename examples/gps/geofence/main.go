@@ -0,0 +1,54 @@
+// This example reports when the receiver leaves or enters a zone, and logs
+// the track as GPX to the serial console, a point every 20m or minute.
+package main
+
+import (
+	"context"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+	"tinygo.org/x/drivers/gps/geo"
+)
+
+var (
+	depot = geo.Circle{Center: geo.Point{Latitude: 48.1173, Longitude: 11.5167}, Radius: 150}
+	city  = geo.Polygon{
+		{Latitude: 48.06, Longitude: 11.46},
+		{Latitude: 48.06, Longitude: 11.64},
+		{Latitude: 48.18, Longitude: 11.64},
+		{Latitude: 48.18, Longitude: 11.46},
+	}
+)
+
+func main() {
+	println("GPS Geofence Example")
+	machine.UART1.Configure(machine.UARTConfig{BaudRate: 9600})
+	ublox := gps.NewUART(&machine.UART1)
+
+	monitor := geo.Monitor{
+		Zones:   []geo.Zone{{Name: "depot", Fence: depot}, {Name: "city", Fence: city}},
+		Confirm: 3,
+	}
+	track := geo.NewGPXWriter(machine.Serial, "delivery")
+	recorder := geo.Recorder{
+		MinDistance: 20,
+		MinInterval: time.Second,
+		MaxInterval: time.Minute,
+		Output:      track,
+	}
+
+	for fix := range ublox.Stream().Fixes(context.Background()) {
+		for _, e := range monitor.Update(fix) {
+			println(e.Type.String(), e.Zone.Name, e.Fix.Time.Format("15:04:05"))
+		}
+		if _, _, err := recorder.Add(fix); err != nil {
+			println(err.Error())
+		}
+		if fix.Valid {
+			println("distance to depot:", int(geo.Distance(geo.FixPoint(fix), depot.Center)), "m",
+				"bearing:", int(geo.Bearing(geo.FixPoint(fix), depot.Center)))
+		}
+	}
+	track.Close()
+}
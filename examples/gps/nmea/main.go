@@ -0,0 +1,64 @@
+// This example decodes NMEA sentences in the format of a multi-GNSS receiver,
+// without a receiver attached. The sentences span midnight of new year, and
+// the second after it has no GSA and GSV sentences.
+package main
+
+import (
+	"fmt"
+
+	"tinygo.org/x/drivers/gps"
+)
+
+var sentences = []string{
+	"$GNRMC,235959.00,A,4717.11399,N,00833.91590,E,0.011,,311223,,,A,V*1F",
+	"$GNVTG,,T,,M,0.011,N,0.020,K,A*3F",
+	"$GNGGA,235959.00,4717.11399,N,00833.91590,E,1,09,1.01,499.6,M,48.0,M,,*4E",
+	"$GNGSA,A,3,23,29,07,08,09,18,26,,,,,,1.94,1.01,1.66,1*0D",
+	"$GNGSA,A,3,65,72,,,,,,,,,,,1.94,1.01,1.66,2*09",
+	"$GPGSV,3,1,10,07,47,130,38,08,33,091,34,09,29,250,33,18,06,049,,1*6A",
+	"$GPGSV,3,2,10,23,32,297,40,26,14,045,30,27,67,306,,29,19,214,36,1*6F",
+	"$GPGSV,3,3,10,30,10,324,,31,,,,1*50",
+	"$GLGSV,1,1,03,65,41,313,35,72,57,055,31,88,05,174,,1*48",
+	"$GNGLL,4717.11399,N,00833.91590,E,235959.00,A,A*7C",
+	"$GNGGA,000000.00,4717.11400,N,00833.91591,E,1,09,1.01,499.7,M,48.0,M,,*48",
+	"$GNRMC,000001.00,V,,,,,,,010124,,,N,V*1E",
+	"$GNGGA,000001.00,,,,,0,00,99.99,,,,,,*79",
+	"$GNGSA,A,1,,,,,,,,,,,,,99.99,99.99,99.99,1*33",
+}
+
+func main() {
+	var decoder gps.Decoder
+	for _, sentence := range sentences {
+		fix, ok, err := decoder.Decode(sentence)
+		if err != nil {
+			println(sentence, err.Error())
+			continue
+		}
+		if ok {
+			show(fix)
+		}
+	}
+	if fix, ok := decoder.Flush(); ok {
+		show(fix)
+	}
+}
+
+func show(fix gps.Fix) {
+	print(fix.Time.Format("2006-01-02 15:04:05"))
+	if !fix.Valid {
+		println(" no fix")
+		return
+	}
+	print(", lat=", fmt.Sprintf("%f", fix.Latitude))
+	print(", long=", fmt.Sprintf("%f", fix.Longitude))
+	print(", altitude=", fix.Altitude)
+	print(", hdop=", fmt.Sprintf("%.2f", fix.HDOP))
+	println()
+	for _, sat := range fix.SatellitesInView {
+		print("  ", sat.Talker, " ", sat.PRN, " snr=", sat.SNR)
+		if sat.Used {
+			print(" used")
+		}
+		println()
+	}
+}
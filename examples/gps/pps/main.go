@@ -0,0 +1,70 @@
+// This example speeds up the first fix with AssistNow Offline data and the
+// time of a DS3231 real time clock, then keeps the clock on UTC with the
+// time pulse of the receiver, connected to pin D2.
+package main
+
+import (
+	"machine"
+	"strings"
+	"time"
+
+	"tinygo.org/x/drivers/ds3231"
+	"tinygo.org/x/drivers/gps"
+	"tinygo.org/x/drivers/gps/pps"
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// assistNow stands for AssistNow Offline data, as downloaded from the u-blox
+// services and stored in flash or on an SD card.
+var assistNow = strings.NewReader("")
+
+func main() {
+	println("GPS PPS Example")
+	machine.I2C0.Configure(machine.I2CConfig{})
+	rtc := ds3231.New(machine.I2C0)
+	rtc.Configure()
+
+	machine.UART1.Configure(machine.UARTConfig{BaudRate: 9600})
+	ublox := gps.NewUART(&machine.UART1)
+	client := ublox.UBX()
+
+	if now, err := rtc.ReadTime(); err == nil && rtc.IsTimeValid() {
+		if err := client.Send(ubx.MgaIniTime(now, 2*time.Second)); err != nil {
+			println("time:", err.Error())
+		}
+		n, err := client.Assist(assistNow, ubx.AssistOptions{Date: now})
+		if err != nil {
+			println("assistance:", err.Error())
+		}
+		println("assistance messages sent:", n)
+	}
+	if err := pps.Configure(client); err != nil {
+		println("time pulse:", err.Error())
+	}
+
+	sync := pps.Discipliner{Clock: &rtc, Interval: 24 * time.Hour}
+	pin := machine.D2
+	pin.Configure(machine.PinConfig{Mode: machine.PinInput})
+	pin.SetInterrupt(machine.PinRising, func(machine.Pin) { sync.Edge() })
+
+	stream := ublox.Stream()
+	stream.UBX = func(m ubx.Message) {
+		if t, err := ubx.ParseNavTimeUTC(m); err == nil {
+			sync.Update(t)
+		}
+	}
+	for {
+		if _, _, err := stream.Poll(); err != nil {
+			println(err.Error())
+		}
+		set, err := sync.Poll()
+		if err != nil {
+			println(err.Error())
+		}
+		if set {
+			now, _ := rtc.ReadTime()
+			println("clock set to", now.Format(time.RFC3339))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
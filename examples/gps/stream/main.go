@@ -0,0 +1,46 @@
+// This example reads fixes in a goroutine and receives them over a channel,
+// so that the main loop keeps blinking the LED whether or not the receiver
+// sends data.
+package main
+
+import (
+	"context"
+	"fmt"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+)
+
+func main() {
+	println("GPS Stream Example")
+	machine.UART1.Configure(machine.UARTConfig{BaudRate: 9600})
+	ublox := gps.NewUART(&machine.UART1)
+
+	led := machine.LED
+	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	fixes := ublox.Stream().Fixes(context.Background())
+	last := time.Now()
+	for {
+		select {
+		case fix := <-fixes:
+			last = time.Now()
+			if fix.Valid {
+				print(fix.Time.Format("2006-01-02 15:04:05"))
+				print(", lat=", fmt.Sprintf("%f", fix.Latitude))
+				print(", long=", fmt.Sprintf("%f", fix.Longitude))
+				print(", altitude=", fix.Altitude)
+				println()
+			} else {
+				println("No fix")
+			}
+		case <-time.After(250 * time.Millisecond):
+			if time.Since(last) > 5*time.Second {
+				println("No data from the receiver")
+				last = time.Now()
+			}
+		}
+		led.Set(!led.Get())
+	}
+}
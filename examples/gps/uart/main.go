@@ -12,18 +12,23 @@ func main() {
 	machine.UART1.Configure(machine.UARTConfig{BaudRate: 9600})
 	ublox := gps.NewUART(&machine.UART1)
 	parser := gps.Parser(ublox)
-	var fix gps.Fix
 	for {
-		fix = parser.NextFix()
+		fix, err := parser.NextFix()
+		if err != nil {
+			println(err.Error())
+			continue
+		}
 		if fix.Valid {
-			print(fix.Time.Format("15:04:05"))
+			print(fix.Time.Format("2006-01-02 15:04:05"))
 			print(", lat=", fmt.Sprintf("%f", fix.Latitude))
 			print(", long=", fmt.Sprintf("%f", fix.Longitude))
 			print(", altitude:=", fix.Altitude)
 			print(", satellites=", fix.Satellites)
+			print(", speed=", fmt.Sprintf("%.1f", fix.Speed))
+			print(", hdop=", fmt.Sprintf("%.1f", fix.HDOP))
 			println()
 		} else {
-			println("No fix")
+			println("No fix,", len(fix.SatellitesInView), "satellites in view")
 		}
 	}
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+func main() {
+	println("GPS UBX Example")
+	machine.UART1.Configure(machine.UARTConfig{BaudRate: 9600})
+	ublox := gps.NewUART(&machine.UART1)
+	client := ublox.UBX()
+
+	if m, err := client.Request(ubx.Poll(ubx.ClassMON, ubx.IDMonVer)); err == nil {
+		if v, err := ubx.ParseMonVer(m); err == nil {
+			println("receiver:", v.Hardware, v.Software)
+		}
+	}
+
+	// a solution every second as NAV-PVT, without the NMEA sentences
+	for _, m := range []ubx.Message{
+		ubx.CfgRate(1000, 1),
+		ubx.CfgDynamicModel(ubx.Pedestrian),
+		ubx.CfgMsg(ubx.ClassNAV, ubx.IDNavPVT, 1),
+		ubx.CfgMsg(0xF0, 0x00, 0), // GGA
+		ubx.CfgMsg(0xF0, 0x01, 0), // GLL
+		ubx.CfgMsg(0xF0, 0x02, 0), // GSA
+		ubx.CfgMsg(0xF0, 0x03, 0), // GSV
+		ubx.CfgMsg(0xF0, 0x04, 0), // RMC
+		ubx.CfgMsg(0xF0, 0x05, 0), // VTG
+	} {
+		if err := client.Send(m); err != nil {
+			println("configuration failed:", err.Error())
+		}
+	}
+
+	client.Timeout = 2 * time.Second
+	for {
+		m, err := client.Read()
+		if err != nil {
+			println(err.Error())
+			continue
+		}
+		pvt, err := ubx.ParseNavPVT(m)
+		if err != nil {
+			continue
+		}
+		if pvt.Flags&ubx.GNSSFixOK == 0 {
+			println("No fix")
+			continue
+		}
+		print(pvt.Time.Format("2006-01-02 15:04:05"))
+		print(", lat=", pvt.Latitude)
+		print(", long=", pvt.Longitude)
+		print(", altitude=", pvt.HeightMSL/1000)
+		print(", satellites=", pvt.NumSV)
+		print(", speed=", pvt.GroundSpeed, "mm/s")
+		println()
+	}
+}
@@ -0,0 +1,57 @@
+// This example runs on a Linux, macOS or Windows host and uses the operating
+// system network stack in place of a wifi module, so the same code that talks
+// to the drivers net package on a microcontroller can be tried on a PC. It
+// starts a small HTTP server on the loopback interface and fetches a page
+// from it through the drivers net package:
+//
+//	go run ./examples/hostnet
+package main
+
+import (
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+	"tinygo.org/x/drivers/net/hostnet"
+)
+
+var buf [256]byte
+
+func main() {
+	// the stand-in server, as firmware would talk to on the local network
+	ln, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		println("Listen failed: " + err.Error())
+		return
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello from", r.Host)
+	}))
+
+	net.UseDriver(hostnet.New())
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		println("Dial failed: " + err.Error())
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintln(conn, "GET / HTTP/1.1")
+	fmt.Fprintln(conn, "Host:", ln.Addr().String())
+	fmt.Fprintln(conn, "Connection: close")
+	fmt.Fprintln(conn)
+
+	for last := time.Now(); time.Since(last) < time.Second; {
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			break
+		}
+		if n > 0 {
+			print(string(buf[:n]))
+			last = time.Now()
+		}
+	}
+}
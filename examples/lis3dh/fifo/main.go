@@ -0,0 +1,59 @@
+// Samples the LIS3DH of the Adafruit Circuit Playground Express at 400 Hz
+// through its FIFO, and reads the samples in batches when the watermark
+// interrupt is raised, sleeping in between.
+package main
+
+import (
+	"machine"
+	"runtime/volatile"
+	"time"
+
+	"tinygo.org/x/drivers/lis3dh"
+)
+
+var i2c = machine.I2C1
+
+// intPin is the INT1 pin of the LIS3DH on the Circuit Playground Express.
+const intPin = machine.PA13
+
+func main() {
+	i2c.Configure(machine.I2CConfig{SCL: machine.SCL1_PIN, SDA: machine.SDA1_PIN})
+
+	accel := lis3dh.New(i2c)
+	accel.Address = lis3dh.Address1 // address on the Circuit Playground Express
+	accel.Configure()
+	accel.SetRange(lis3dh.RANGE_2_G)
+	accel.SetDataRate(lis3dh.DATARATE_400_HZ)
+
+	var ready volatile.Register8
+	intPin.Configure(machine.PinConfig{Mode: machine.PinInput})
+	intPin.SetInterrupt(machine.PinRising, func(machine.Pin) { ready.Set(1) })
+
+	if err := accel.ConfigureFIFO(lis3dh.FIFO_STREAM, 25, false); err != nil {
+		println("fifo:", err.Error())
+	}
+	if err := accel.ConfigureInterrupts(lis3dh.INT_WATERMARK, 0); err != nil {
+		println("interrupts:", err.Error())
+	}
+
+	var samples [32][3]int32
+	for {
+		for ready.Get() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		ready.Set(0)
+
+		n, err := accel.ReadFIFO(samples[:])
+		if err != nil {
+			println("read:", err.Error())
+			continue
+		}
+		var sum [3]int32
+		for _, s := range samples[:n] {
+			for i := range sum {
+				sum[i] += s[i]
+			}
+		}
+		println("samples:", n, "X:", sum[0]/int32(n), "Y:", sum[1]/int32(n), "Z:", sum[2]/int32(n))
+	}
+}
@@ -0,0 +1,74 @@
+// This example mounts a littlefs filesystem on the QSPI flash of an Adafruit
+// board and counts the number of boots in a file, which survives power loss
+// at any time. If the flash holds no littlefs filesystem, it is formatted,
+// erasing any CircuitPython files.
+package main
+
+import (
+	"machine"
+	"os"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/flash"
+	"tinygo.org/x/drivers/littlefs"
+)
+
+func main() {
+	time.Sleep(3 * time.Second)
+
+	dev := flash.NewQSPI(
+		machine.QSPI_CS,
+		machine.QSPI_SCK,
+		machine.QSPI_DATA0,
+		machine.QSPI_DATA1,
+		machine.QSPI_DATA2,
+		machine.QSPI_DATA3,
+	)
+	if err := dev.Configure(&flash.DeviceConfig{Identifier: flash.DefaultDeviceIdentifier}); err != nil {
+		fail("configure flash", err)
+	}
+
+	fs := &littlefs.FS{}
+	if err := fs.Mount(dev); err != nil {
+		println("No filesystem found, formatting...")
+		if err := littlefs.Format(dev, nil); err != nil {
+			fail("format", err)
+		}
+		if err := fs.Mount(dev); err != nil {
+			fail("mount", err)
+		}
+	}
+
+	f, err := fs.Open("/boot_count", os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		fail("open", err)
+	}
+	buf := make([]byte, 16)
+	n, _ := f.Read(buf)
+	count, _ := strconv.Atoi(string(buf[:n]))
+	count++
+	if err := f.Truncate(0); err != nil {
+		fail("truncate", err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(count)), 0); err != nil {
+		fail("write", err)
+	}
+	if err := f.Close(); err != nil {
+		fail("close", err)
+	}
+	println("boot count:", count)
+
+	used, err := fs.Used()
+	if err != nil {
+		fail("traverse", err)
+	}
+	println("blocks used:", used, "of", fs.BlockCount())
+}
+
+func fail(msg string, err error) {
+	for {
+		println(msg+":", err.Error())
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,56 @@
+// This example samples a BME280, a LIS3DH and a BH1750 at their own rates
+// and prints the statistics of the last minute every 10 seconds.
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/bh1750"
+	"tinygo.org/x/drivers/bme280"
+	"tinygo.org/x/drivers/lis3dh"
+	"tinygo.org/x/drivers/scheduler"
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{})
+
+	bme := bme280.New(machine.I2C0)
+	bme.Configure()
+	accel := lis3dh.New(machine.I2C0)
+	accel.Configure()
+	light := bh1750.New(machine.I2C0)
+	light.Configure()
+
+	s := scheduler.New(scheduler.SystemClock)
+	climate := s.Add("bme280", time.Second, 60, 2, func(v []int32) (err error) {
+		v[0], err = bme.ReadTemperature()
+		if err == nil {
+			v[1], err = bme.ReadHumidity()
+		}
+		return err
+	})
+	motion := s.Add("lis3dh", 10*time.Millisecond, 100, 3, scheduler.Read3(accel.ReadAcceleration))
+	lux := s.Add("bh1750", 5*time.Second, 12, 1, func(v []int32) error {
+		v[0] = light.Illuminance()
+		return nil
+	})
+
+	report := time.Now()
+	for {
+		next := s.RunPending()
+		if time.Since(report) >= 10*time.Second {
+			report = report.Add(10 * time.Second)
+			show("temperature", climate.Channels[0].Stats())
+			show("humidity", climate.Channels[1].Stats())
+			show("acceleration z", motion.Channels[2].Stats())
+			show("illuminance", lux.Channels[0].Stats())
+			println("overruns:", motion.Overruns, "errors:", climate.Errors)
+		}
+		time.Sleep(time.Until(next))
+	}
+}
+
+func show(name string, st scheduler.Stats) {
+	println(name, "min:", st.Min, "mean:", int32(st.Mean), "max:", st.Max, "last:", st.Last)
+}
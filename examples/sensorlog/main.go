@@ -0,0 +1,77 @@
+// This example logs a BME280, an SHT3x, a VEML6070 and an AMG88xx every 10
+// seconds in the compact binary format over semihosting. Enable semihosting in the debugger
+// and redirect the output to a file, then convert it on the host with:
+//
+//	go run tinygo.org/x/drivers/sensorlog/cmd/sensorlog2csv log.bin > log.csv
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/amg88xx"
+	"tinygo.org/x/drivers/bme280"
+	"tinygo.org/x/drivers/scheduler"
+	"tinygo.org/x/drivers/semihosting"
+	"tinygo.org/x/drivers/sensorlog"
+	"tinygo.org/x/drivers/sht3x"
+	"tinygo.org/x/drivers/veml6070"
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{})
+
+	bme := bme280.New(machine.I2C0)
+	bme.Configure()
+	sht := sht3x.New(machine.I2C0)
+	uv := veml6070.New(machine.I2C0)
+	uv.Configure()
+	camera := amg88xx.New(machine.I2C0)
+	camera.Configure(amg88xx.Config{})
+
+	fields := []sensorlog.Field{
+		{Name: "bme280 temperature", Unit: "°C", Decimals: 3},
+		{Name: "bme280 humidity", Unit: "%", Decimals: 2},
+		{Name: "sht3x temperature", Unit: "°C", Decimals: 3},
+		{Name: "sht3x humidity", Unit: "%", Decimals: 2},
+		{Name: "uva", Unit: "mW/m²"},
+	}
+	fields = append(fields, sensorlog.Fields("pixel", 64, "°C", 3)...)
+	logger := sensorlog.New(semihosting.Stdout.Writer(), sensorlog.Binary, fields...)
+
+	var pixels [64]int16
+	s := scheduler.New(scheduler.SystemClock)
+	task := s.Add("log", 10*time.Second, 1, len(fields), func(v []int32) error {
+		var err error
+		if v[0], err = bme.ReadTemperature(); err != nil {
+			return err
+		}
+		if v[1], err = bme.ReadHumidity(); err != nil {
+			return err
+		}
+		t, h, err := sht.ReadTemperatureHumidity()
+		if err != nil {
+			return err
+		}
+		v[2], v[3] = t, int32(h)
+		uva, err := uv.ReadUVALightIntensity()
+		if err != nil {
+			return err
+		}
+		v[4] = int32(uva)
+		camera.ReadPixels(&pixels)
+		for i, p := range pixels {
+			v[5+i] = int32(p)
+		}
+		return nil
+	})
+	task.OnSample = func(t time.Time, v []int32) {
+		if err := logger.Log(t, v); err != nil {
+			println("log:", err.Error())
+		}
+	}
+
+	for {
+		time.Sleep(time.Until(s.RunPending()))
+	}
+}
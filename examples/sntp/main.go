@@ -0,0 +1,65 @@
+// This example uses an ESP8266/ESP32 running the espat firmware to query the
+// NTP server pool and keep a DS3231 real time clock in sync.
+package main
+
+import (
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/ds3231"
+	"tinygo.org/x/drivers/espat"
+	"tinygo.org/x/drivers/net/sntp"
+)
+
+// access point info
+const ssid = "YOURSSID"
+const pass = "YOURPASS"
+
+// these are the default pins for the Arduino Nano33 IoT.
+// change these to connect to a different UART or pins for the ESP8266/ESP32
+var (
+	uart = machine.UART1
+	tx   = machine.PA22
+	rx   = machine.PA23
+
+	adaptor *espat.Device
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{})
+	rtc := ds3231.New(machine.I2C0)
+	rtc.Configure()
+
+	uart.Configure(machine.UARTConfig{TX: tx, RX: rx})
+	adaptor = espat.New(uart)
+	adaptor.Configure()
+	for !adaptor.Connected() {
+		println("Connecting to wifi adaptor...")
+		time.Sleep(1 * time.Second)
+	}
+	adaptor.Echo(false)
+	adaptor.SetWifiMode(espat.WifiModeClient)
+	for adaptor.ConnectToAP(ssid, pass, 10) != nil {
+		println("Connecting to " + ssid + "...")
+	}
+
+	d := sntp.Discipliner{
+		Client:    &sntp.Client{},
+		RTC:       &rtc,
+		ReadTime:  rtc.ReadTime,
+		Interval:  10 * time.Minute,
+		Threshold: 500 * time.Millisecond,
+	}
+
+	for {
+		if err := d.Sync(); err != nil {
+			println("Sync failed:", err.Error())
+		} else {
+			t, _ := rtc.ReadTime()
+			println("RTC time:", t.Format(time.RFC3339))
+			println("Drift (ms):", d.Stats.Last.Milliseconds(), "mean:", d.Stats.Mean.Milliseconds(),
+				"ppm:", int32(d.Stats.PPM), "corrections:", d.Stats.Corrections)
+		}
+		time.Sleep(d.Interval)
+	}
+}
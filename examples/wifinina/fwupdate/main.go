@@ -0,0 +1,64 @@
+// This example updates the root certificates of a device with WiFiNINA
+// firmware, or turns the board into a serial bridge to the NINA module so the
+// firmware can be flashed from a computer using:
+//
+// esptool.py --port /dev/ttyACM0 --baud 115200 write_flash 0 NINA_W102.bin
+//
+// Set passthrough to choose the mode.
+package main
+
+import (
+	"machine"
+	"strings"
+	"time"
+
+	"tinygo.org/x/drivers/wifinina"
+)
+
+// set to true to bridge the USB serial port to the NINA bootloader
+const passthrough = false
+
+// certificates to install, as concatenated PEM blocks
+const certificates = `-----BEGIN CERTIFICATE-----
+...
+-----END CERTIFICATE-----
+`
+
+var (
+
+	// these are the default pins for the Arduino Nano33 IoT.
+	uart = &machine.UART2
+	tx   = machine.NINA_TX
+	rx   = machine.NINA_RX
+
+	// this is the ESP chip that has the WIFININA firmware flashed on it
+	adaptor = &wifinina.Device{
+		CS:    machine.NINA_CS,
+		ACK:   machine.NINA_ACK,
+		GPIO0: machine.NINA_GPIO0,
+		RESET: machine.NINA_RESETN,
+	}
+
+	console = &machine.UART0
+)
+
+func main() {
+	time.Sleep(3 * time.Second)
+
+	uart.Configure(machine.UARTConfig{TX: tx, RX: rx, BaudRate: wifinina.BootloaderBaudRate})
+
+	if passthrough {
+		adaptor.Passthrough(console, uart)
+	}
+
+	println("Uploading certificates...")
+	err := adaptor.UploadCertificates(uart, strings.NewReader(certificates), len(certificates))
+	if err != nil {
+		println("Upload failed:", err.Error())
+	} else {
+		println("Done.")
+	}
+	for {
+		time.Sleep(time.Hour)
+	}
+}
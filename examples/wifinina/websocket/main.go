@@ -0,0 +1,88 @@
+// This example opens a WebSocket connection using a device with WiFiNINA
+// firmware, sends a message every few seconds and prints what the server
+// sends back.
+package main
+
+import (
+	"machine"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/net/websocket"
+	"tinygo.org/x/drivers/wifinina"
+)
+
+// access point info
+const ssid = ""
+const pass = ""
+
+// WebSocket server to connect to. Replace with your own.
+const url = "ws://echo.websocket.org/"
+
+var (
+	// these are the default pins for the Arduino Nano33 IoT.
+	spi = machine.NINA_SPI
+
+	// this is the ESP chip that has the WIFININA firmware flashed on it
+	adaptor = &wifinina.Device{
+		SPI:   spi,
+		CS:    machine.NINA_CS,
+		ACK:   machine.NINA_ACK,
+		GPIO0: machine.NINA_GPIO0,
+		RESET: machine.NINA_RESETN,
+	}
+)
+
+var buf [256]byte
+
+func main() {
+	// Configure SPI for 8Mhz, Mode 0, MSB First
+	spi.Configure(machine.SPIConfig{
+		Frequency: 8 * 1e6,
+		MOSI:      machine.NINA_MOSI,
+		MISO:      machine.NINA_MISO,
+		SCK:       machine.NINA_SCK,
+	})
+
+	adaptor.Configure()
+	connectToAP()
+
+	conn, err := websocket.Dial(url, nil)
+	for ; err != nil; conn, err = websocket.Dial(url, nil) {
+		println("connection failed: " + err.Error())
+		time.Sleep(5 * time.Second)
+	}
+	conn.ReadTimeout = 5 * time.Second
+	println("Connected!")
+
+	for i := 0; ; i++ {
+		if err := conn.WriteText("hello " + strconv.Itoa(i)); err != nil {
+			println("Write error: " + err.Error())
+			return
+		}
+		_, n, err := conn.ReadMessage(buf[:])
+		switch err {
+		case nil, websocket.ErrMessageTooBig:
+			println("Received: " + string(buf[:n]))
+		case websocket.ErrTimeout:
+			println("No reply")
+		default:
+			println("Read error: " + err.Error())
+			return
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// connect to access point
+func connectToAP() {
+	time.Sleep(2 * time.Second)
+	println("Connecting to " + ssid)
+	adaptor.SetPassphrase(ssid, pass)
+	for st, _ := adaptor.GetConnectionStatus(); st != wifinina.StatusConnected; {
+		println("Connection status: " + st.String())
+		time.Sleep(1 * time.Second)
+		st, _ = adaptor.GetConnectionStatus()
+	}
+	println("Connected.")
+}
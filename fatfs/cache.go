@@ -0,0 +1,169 @@
+package fatfs
+
+import "tinygo.org/x/drivers"
+
+// blockCache is a write-back cache of erase blocks. Writes modify cached
+// copies of whole erase blocks, which are erased and reprogrammed when they
+// are evicted or flushed.
+type blockCache struct {
+	dev       drivers.BlockDevice
+	blockSize int64 // multiple of the erase block size, at least 512
+	eraseSize int64
+	blocks    []cacheBlock
+	tick      uint32
+}
+
+type cacheBlock struct {
+	index int64 // block number, or -1 if unused
+	data  []byte
+	dirty bool
+	used  uint32 // for LRU replacement
+}
+
+func (c *blockCache) init(dev drivers.BlockDevice, n int) {
+	c.dev = dev
+	c.eraseSize = dev.EraseBlockSize()
+	c.blockSize = c.eraseSize
+	for c.blockSize < 512 {
+		c.blockSize += c.eraseSize
+	}
+	if len(c.blocks) != n || int64(len(c.blocks[0].data)) != c.blockSize {
+		c.blocks = make([]cacheBlock, n)
+		for i := range c.blocks {
+			c.blocks[i].data = make([]byte, c.blockSize)
+		}
+	}
+	for i := range c.blocks {
+		c.blocks[i].index = -1
+		c.blocks[i].dirty = false
+	}
+}
+
+// lookup returns the cached block with the given index, or nil.
+func (c *blockCache) lookup(index int64) *cacheBlock {
+	for i := range c.blocks {
+		if c.blocks[i].index == index {
+			c.tick++
+			c.blocks[i].used = c.tick
+			return &c.blocks[i]
+		}
+	}
+	return nil
+}
+
+// get returns the cached block with the given index, loading it into the
+// least recently used slot if needed. If load is false, the block will be
+// completely overwritten and is not read from the device.
+func (c *blockCache) get(index int64, load bool) (*cacheBlock, error) {
+	if b := c.lookup(index); b != nil {
+		return b, nil
+	}
+	b := &c.blocks[0]
+	for i := range c.blocks {
+		if c.blocks[i].index < 0 {
+			b = &c.blocks[i]
+			break
+		}
+		if c.blocks[i].used < b.used {
+			b = &c.blocks[i]
+		}
+	}
+	if err := c.writeBack(b); err != nil {
+		return nil, err
+	}
+	b.index = -1
+	if load {
+		if _, err := c.dev.ReadAt(b.data, index*c.blockSize); err != nil {
+			return nil, err
+		}
+	}
+	b.index = index
+	c.tick++
+	b.used = c.tick
+	return b, nil
+}
+
+// writeBack erases and programs a dirty block.
+func (c *blockCache) writeBack(b *cacheBlock) error {
+	if !b.dirty {
+		return nil
+	}
+	n := c.blockSize / c.eraseSize
+	if err := c.dev.EraseBlocks(b.index*n, n); err != nil {
+		return err
+	}
+	if _, err := c.dev.WriteAt(b.data, b.index*c.blockSize); err != nil {
+		return err
+	}
+	b.dirty = false
+	return nil
+}
+
+// flush writes all dirty blocks to the device.
+func (c *blockCache) flush() error {
+	for i := range c.blocks {
+		if err := c.writeBack(&c.blocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads len(p) bytes at byte offset off, from the cache where
+// possible.
+func (c *blockCache) read(off int64, p []byte) error {
+	for len(p) > 0 {
+		index := off / c.blockSize
+		start := off - index*c.blockSize
+		n := int64(len(p))
+		if n > c.blockSize-start {
+			n = c.blockSize - start
+		}
+		if b := c.lookup(index); b != nil {
+			copy(p[:n], b.data[start:])
+		} else if _, err := c.dev.ReadAt(p[:n], off); err != nil {
+			return err
+		}
+		p = p[n:]
+		off += n
+	}
+	return nil
+}
+
+// write writes p at byte offset off into the cache.
+func (c *blockCache) write(off int64, p []byte) error {
+	for len(p) > 0 {
+		index := off / c.blockSize
+		start := off - index*c.blockSize
+		n := int64(len(p))
+		if n > c.blockSize-start {
+			n = c.blockSize - start
+		}
+		b, err := c.get(index, n < c.blockSize)
+		if err != nil {
+			return err
+		}
+		copy(b.data[start:], p[:n])
+		b.dirty = true
+		p = p[n:]
+		off += n
+	}
+	return nil
+}
+
+// zero clears n bytes at byte offset off.
+func (c *blockCache) zero(off, n int64) error {
+	var zeros [64]byte
+	for n > 0 {
+		chunk := int64(len(zeros))
+		if n < chunk {
+			chunk = n
+		}
+		if err := c.write(off, zeros[:chunk]); err != nil {
+			return err
+		}
+		off += chunk
+		n -= chunk
+	}
+	return nil
+}
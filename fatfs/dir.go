@@ -0,0 +1,640 @@
+package fatfs
+
+import (
+	"encoding/binary"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	dirEntrySize = 32
+
+	attrReadOnly  = 0x01
+	attrHidden    = 0x02
+	attrSystem    = 0x04
+	attrVolumeID  = 0x08
+	attrDirectory = 0x10
+	attrArchive   = 0x20
+	attrLongName  = 0x0F
+
+	// NTRes flags used by Windows for all lowercase short names
+	lowerBase = 0x08
+	lowerExt  = 0x10
+
+	entryFree     = 0xE5
+	lfnLast       = 0x40
+	lfnChars      = 13
+	maxNameLen    = 255
+	maxLFNEntries = (maxNameLen + lfnChars - 1) / lfnChars
+)
+
+// entry is a directory entry with its long name, if any.
+type entry struct {
+	name  string
+	raw   [dirEntrySize]byte // the short entry
+	dir   uint32             // cluster of the directory, 0 for the fixed root
+	index int                // index of the first slot (long or short)
+	slots int                // number of slots including the short entry
+	off   int64              // byte offset of the short entry
+}
+
+func (e *entry) isDir() bool {
+	return e.raw[11]&attrDirectory != 0
+}
+
+func (e *entry) cluster() uint32 {
+	return uint32(binary.LittleEndian.Uint16(e.raw[20:]))<<16 |
+		uint32(binary.LittleEndian.Uint16(e.raw[26:]))
+}
+
+func (e *entry) setCluster(c uint32) {
+	binary.LittleEndian.PutUint16(e.raw[20:], uint16(c>>16))
+	binary.LittleEndian.PutUint16(e.raw[26:], uint16(c))
+}
+
+func (e *entry) size() uint32 {
+	return binary.LittleEndian.Uint32(e.raw[28:])
+}
+
+func (e *entry) setSize(size uint32) {
+	binary.LittleEndian.PutUint32(e.raw[28:], size)
+}
+
+func (e *entry) modTime() time.Time {
+	return decodeTime(binary.LittleEndian.Uint16(e.raw[24:]), binary.LittleEndian.Uint16(e.raw[22:]))
+}
+
+// touch sets the modification time, and the creation time if create is
+// set.
+func (e *entry) touch(t time.Time, create bool) {
+	date, tm := encodeTime(t)
+	binary.LittleEndian.PutUint16(e.raw[22:], tm)
+	binary.LittleEndian.PutUint16(e.raw[24:], date)
+	binary.LittleEndian.PutUint16(e.raw[18:], date)
+	if create {
+		e.raw[13] = 0
+		binary.LittleEndian.PutUint16(e.raw[14:], tm)
+		binary.LittleEndian.PutUint16(e.raw[16:], date)
+	}
+}
+
+func encodeTime(t time.Time) (date, tm uint16) {
+	if t.Year() < 1980 {
+		return 1<<5 | 1, 0
+	}
+	date = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	tm = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return
+}
+
+func decodeTime(date, tm uint16) time.Time {
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0x0F), int(date&0x1F),
+		int(tm>>11), int(tm>>5&0x3F), int(tm&0x1F)*2, 0, time.UTC)
+}
+
+// rootDir returns the cluster of the root directory, which is 0 for the
+// fixed root directory of FAT12 and FAT16.
+func (fs *FS) rootDir() uint32 {
+	if fs.typ == FAT32 {
+		return fs.rootCluster
+	}
+	return 0
+}
+
+// dirIter iterates over the 32 byte slots of a directory.
+type dirIter struct {
+	fs    *FS
+	start uint32 // first cluster, 0 for the fixed root directory
+	cur   uint32 // current cluster
+	index int    // index of the slot returned by the next call to next
+}
+
+func (fs *FS) iterDir(cluster uint32) dirIter {
+	return dirIter{fs: fs, start: cluster, cur: cluster}
+}
+
+// next returns the byte offset of the next slot, or false at the end of
+// the directory.
+func (it *dirIter) next() (int64, bool, error) {
+	fs := it.fs
+	if it.start == 0 {
+		if it.index >= fs.rootEntries {
+			return 0, false, nil
+		}
+		off := fs.rootStart + int64(it.index)*dirEntrySize
+		it.index++
+		return off, true, nil
+	}
+	perCluster := int(fs.clusterSize / dirEntrySize)
+	if it.index > 0 && it.index%perCluster == 0 {
+		next, err := fs.next(it.cur)
+		if err != nil || next == 0 {
+			return 0, false, err
+		}
+		it.cur = next
+	}
+	off := fs.clusterOffset(it.cur) + int64(it.index%perCluster)*dirEntrySize
+	it.index++
+	return off, true, nil
+}
+
+// skip advances the iterator by n slots.
+func (it *dirIter) skip(n int) error {
+	for i := 0; i < n; i++ {
+		if _, ok, err := it.next(); err != nil || !ok {
+			if err == nil {
+				err = ErrCorrupt
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// scanDir calls fn for every file and directory entry of a directory,
+// including "." and "..", until fn returns false.
+func (fs *FS) scanDir(dir uint32, fn func(e *entry) bool) error {
+	var lfn [maxLFNEntries * lfnChars]uint16
+	var raw [dirEntrySize]byte
+	var e entry
+	lfnCount, lfnNext, lfnStart := 0, 0, 0
+	var lfnSum byte
+
+	it := fs.iterDir(dir)
+	for {
+		index := it.index
+		off, ok, err := it.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fs.cache.read(off, raw[:]); err != nil {
+			return err
+		}
+		if raw[0] == 0 {
+			return nil
+		}
+		if raw[0] == entryFree {
+			lfnCount = 0
+			continue
+		}
+		if raw[11]&0x3F == attrLongName {
+			ord := int(raw[0] & 0x3F)
+			if raw[0]&lfnLast != 0 {
+				if ord == 0 || ord > maxLFNEntries {
+					lfnCount = 0
+					continue
+				}
+				lfnCount, lfnStart, lfnSum = ord, index, raw[13]
+				for i := range lfn {
+					lfn[i] = 0xFFFF
+				}
+			} else if lfnCount == 0 || ord != lfnNext || raw[13] != lfnSum {
+				lfnCount = 0
+				continue
+			}
+			chars := lfn[(ord-1)*lfnChars:]
+			for i := 0; i < 5; i++ {
+				chars[i] = binary.LittleEndian.Uint16(raw[1+2*i:])
+			}
+			for i := 0; i < 6; i++ {
+				chars[5+i] = binary.LittleEndian.Uint16(raw[14+2*i:])
+			}
+			for i := 0; i < 2; i++ {
+				chars[11+i] = binary.LittleEndian.Uint16(raw[28+2*i:])
+			}
+			lfnNext = ord - 1
+			continue
+		}
+		if raw[11]&attrVolumeID != 0 {
+			lfnCount = 0
+			continue
+		}
+
+		e = entry{raw: raw, dir: dir, index: index, slots: 1, off: off}
+		if lfnNext == 0 && lfnCount > 0 && lfnStart+lfnCount == index && lfnSum == checksum(raw[:11]) {
+			n := 0
+			for n < lfnCount*lfnChars && lfn[n] != 0 && lfn[n] != 0xFFFF {
+				n++
+			}
+			e.name = string(utf16.Decode(lfn[:n]))
+			e.index = lfnStart
+			e.slots = lfnCount + 1
+		} else {
+			e.name = shortName(raw[:])
+		}
+		lfnCount, lfnNext = 0, 0
+		if !fn(&e) {
+			return nil
+		}
+	}
+}
+
+// lookup finds name in a directory. Both the long and the short name of
+// entries match, ignoring case.
+func (fs *FS) lookup(dir uint32, name string) (e entry, found bool, err error) {
+	err = fs.scanDir(dir, func(cur *entry) bool {
+		if strings.EqualFold(cur.name, name) || strings.EqualFold(shortName(cur.raw[:]), name) {
+			e, found = *cur, true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// resolve looks up a path. It returns the directory containing the last
+// element of the path and its entry, if it exists. The root directory has
+// no entry; isRoot is set for it.
+func (fs *FS) resolve(p string) (dir uint32, name string, e entry, found, isRoot bool, err error) {
+	if !fs.mounted {
+		err = ErrNotMounted
+		return
+	}
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return fs.rootDir(), "", entry{}, true, true, nil
+	}
+	parts := strings.Split(p[1:], "/")
+	dir = fs.rootDir()
+	for i, part := range parts {
+		e, found, err = fs.lookup(dir, part)
+		if err != nil {
+			return
+		}
+		if i == len(parts)-1 {
+			name = part
+			return
+		}
+		if !found {
+			err = ErrNotExist
+			return
+		}
+		if !e.isDir() {
+			err = ErrNotDir
+			return
+		}
+		dir = e.cluster()
+		if dir == 0 {
+			// ".." of a subdirectory of the root
+			dir = fs.rootDir()
+		}
+	}
+	return
+}
+
+// createEntry adds an entry named name to a directory. The short entry is
+// taken from tmpl, except for its name.
+func (fs *FS) createEntry(dir uint32, name string, tmpl *entry) (entry, error) {
+	if !validName(name) {
+		return entry{}, ErrInvalidName
+	}
+	e := *tmpl
+	e.dir = dir
+	e.name = name
+	var lfn []uint16
+	short, ntres, ok := fitsShort(name)
+	if !ok {
+		lfn = utf16.Encode([]rune(name))
+		if len(lfn) > maxNameLen {
+			return entry{}, ErrInvalidName
+		}
+		var err error
+		short, err = fs.uniqueShortName(dir, name)
+		if err != nil {
+			return entry{}, err
+		}
+		ntres = 0
+	}
+	copy(e.raw[:11], short[:])
+	e.raw[12] = ntres
+
+	n := (len(lfn) + lfnChars - 1) / lfnChars
+	e.slots = n + 1
+	index, err := fs.findFree(dir, e.slots)
+	if err != nil {
+		return entry{}, err
+	}
+	e.index = index
+
+	it := fs.iterDir(dir)
+	if err := it.skip(index); err != nil {
+		return entry{}, err
+	}
+	sum := checksum(short[:])
+	var slot [dirEntrySize]byte
+	for ord := n; ord >= 1; ord-- {
+		off, ok, err := it.next()
+		if err != nil || !ok {
+			if err == nil {
+				err = ErrCorrupt
+			}
+			return entry{}, err
+		}
+		slot[0] = byte(ord)
+		if ord == n {
+			slot[0] |= lfnLast
+		}
+		slot[11] = attrLongName
+		slot[12] = 0
+		slot[13] = sum
+		slot[26], slot[27] = 0, 0
+		for i := 0; i < lfnChars; i++ {
+			c := uint16(0xFFFF)
+			if j := (ord-1)*lfnChars + i; j < len(lfn) {
+				c = lfn[j]
+			} else if j == len(lfn) {
+				c = 0
+			}
+			var pos int
+			switch {
+			case i < 5:
+				pos = 1 + 2*i
+			case i < 11:
+				pos = 14 + 2*(i-5)
+			default:
+				pos = 28 + 2*(i-11)
+			}
+			binary.LittleEndian.PutUint16(slot[pos:], c)
+		}
+		if err := fs.cache.write(off, slot[:]); err != nil {
+			return entry{}, err
+		}
+	}
+	off, ok, err := it.next()
+	if err != nil || !ok {
+		if err == nil {
+			err = ErrCorrupt
+		}
+		return entry{}, err
+	}
+	e.off = off
+	return e, fs.cache.write(off, e.raw[:])
+}
+
+// findFree returns the index of n consecutive free slots in a directory,
+// growing the directory if needed.
+func (fs *FS) findFree(dir uint32, n int) (int, error) {
+	var b [1]byte
+	it := fs.iterDir(dir)
+	start, count := 0, 0
+	for {
+		index := it.index
+		off, ok, err := it.next()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		if err := fs.cache.read(off, b[:]); err != nil {
+			return 0, err
+		}
+		if b[0] != 0 && b[0] != entryFree {
+			count = 0
+			continue
+		}
+		if count == 0 {
+			start = index
+		}
+		count++
+		if count == n {
+			return start, nil
+		}
+	}
+	if dir == 0 {
+		return 0, ErrDirFull
+	}
+	// the new clusters are zeroed, so all their slots are free
+	if count == 0 {
+		start = it.index
+	}
+	perCluster := int(fs.clusterSize / dirEntrySize)
+	last := it.cur
+	for count < n {
+		c, err := fs.allocate(last, true)
+		if err != nil {
+			return 0, err
+		}
+		last = c
+		count += perCluster
+	}
+	return start, nil
+}
+
+// removeEntry marks all slots of an entry as free.
+func (fs *FS) removeEntry(e *entry) error {
+	it := fs.iterDir(e.dir)
+	if err := it.skip(e.index); err != nil {
+		return err
+	}
+	free := [1]byte{entryFree}
+	for i := 0; i < e.slots; i++ {
+		off, ok, err := it.next()
+		if err != nil || !ok {
+			if err == nil {
+				err = ErrCorrupt
+			}
+			return err
+		}
+		if err := fs.cache.write(off, free[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntry writes the short entry of e back to its directory.
+func (fs *FS) writeEntry(e *entry) error {
+	return fs.cache.write(e.off, e.raw[:])
+}
+
+// isEmptyDir reports whether a directory has no entries besides "." and
+// "..".
+func (fs *FS) isEmptyDir(dir uint32) (bool, error) {
+	empty := true
+	err := fs.scanDir(dir, func(e *entry) bool {
+		if e.raw[0] == '.' && (e.raw[1] == ' ' || e.raw[1] == '.' && e.raw[2] == ' ') {
+			return true
+		}
+		empty = false
+		return false
+	})
+	return empty, err
+}
+
+// checksum computes the checksum of a short name stored in long name
+// entries.
+func checksum(short []byte) byte {
+	var sum byte
+	for _, c := range short[:11] {
+		sum = (sum&1)<<7 + sum>>1 + c
+	}
+	return sum
+}
+
+// shortName returns the 8.3 name of a short entry, honoring the lowercase
+// flags set by Windows.
+func shortName(raw []byte) string {
+	var buf [12]byte
+	n := 0
+	for i := 0; i < 8 && raw[i] != ' '; i++ {
+		c := raw[i]
+		if i == 0 && c == 0x05 {
+			c = entryFree
+		}
+		if raw[12]&lowerBase != 0 && c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[n] = c
+		n++
+	}
+	if raw[8] != ' ' {
+		buf[n] = '.'
+		n++
+		for i := 8; i < 11 && raw[i] != ' '; i++ {
+			c := raw[i]
+			if raw[12]&lowerExt != 0 && c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			buf[n] = c
+			n++
+		}
+	}
+	return string(buf[:n])
+}
+
+// validName reports whether name may be used as a long file name.
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	if name[len(name)-1] == '.' || name[len(name)-1] == ' ' {
+		return false
+	}
+	for _, c := range name {
+		if c < 0x20 || strings.ContainsRune(`"*/:<>?\|`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isShortChar reports whether c may appear in a short name.
+func isShortChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("!#$%&'()-@^_`{}~", c) >= 0
+}
+
+// fitsShort returns the short entry name for name if it can be stored
+// without a long name: 8.3 characters, and each part either all uppercase
+// or all lowercase.
+func fitsShort(name string) (short [11]byte, ntres byte, ok bool) {
+	base, ext := name, ""
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	if len(base) == 0 || len(base) > 8 || len(ext) > 3 || strings.IndexByte(base, '.') >= 0 {
+		return short, 0, false
+	}
+	for i := range short {
+		short[i] = ' '
+	}
+	part := func(s string, dst []byte, flag byte) bool {
+		lower, upper := false, false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c >= 'a' && c <= 'z':
+				lower = true
+				c -= 'a' - 'A'
+			case c >= 'A' && c <= 'Z':
+				upper = true
+			}
+			if !isShortChar(c) {
+				return false
+			}
+			dst[i] = c
+		}
+		if lower && upper {
+			return false
+		}
+		if lower {
+			ntres |= flag
+		}
+		return true
+	}
+	if !part(base, short[:8], lowerBase) || !part(ext, short[8:], lowerExt) {
+		return short, 0, false
+	}
+	return short, ntres, true
+}
+
+// uniqueShortName generates a short name like "LONGFI~1.TXT" for a long
+// name that is not used yet in dir.
+func (fs *FS) uniqueShortName(dir uint32, name string) (short [11]byte, err error) {
+	base, ext := name, ""
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	convert := func(s string, max int) []byte {
+		var out []byte
+		for _, r := range strings.ToUpper(s) {
+			if len(out) == max {
+				break
+			}
+			if r == ' ' || r == '.' {
+				continue
+			}
+			c := byte('_')
+			if r < 0x80 && isShortChar(byte(r)) {
+				c = byte(r)
+			}
+			out = append(out, c)
+		}
+		return out
+	}
+	b := convert(base, 8)
+	e := convert(ext, 3)
+	for i := range short {
+		short[i] = ' '
+	}
+	copy(short[8:], e)
+
+	var tail [8]byte
+	for n := 1; n < 1000000; n++ {
+		t := len(tail)
+		for v := n; v > 0; v /= 10 {
+			t--
+			tail[t] = byte('0' + v%10)
+		}
+		t--
+		tail[t] = '~'
+		keep := len(b)
+		if keep > 8-(len(tail)-t) {
+			keep = 8 - (len(tail) - t)
+		}
+		copy(short[:], b[:keep])
+		copy(short[keep:], tail[t:])
+		for i := keep + len(tail) - t; i < 8; i++ {
+			short[i] = ' '
+		}
+
+		exists := false
+		err = fs.scanDir(dir, func(cur *entry) bool {
+			if string(cur.raw[:11]) == string(short[:]) {
+				exists = true
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return
+		}
+		if !exists {
+			return short, nil
+		}
+	}
+	return short, ErrExist
+}
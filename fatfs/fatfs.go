@@ -0,0 +1,435 @@
+// Package fatfs implements the FAT12, FAT16 and FAT32 filesystems on top of
+// a block device such as flash.Device, for example to access the CIRCUITPY
+// volume on the QSPI flash of Adafruit boards.
+//
+// Long file names are supported. Since the filesystem is shared with other
+// operating systems, paths are case-insensitive but case-preserving and use
+// "/" as separator.
+//
+// Flash memory can only be written after erasing a whole erase block, so
+// the filesystem keeps a small write-back cache of erase blocks. Call Sync
+// or close all files to make sure that changes are on the device.
+//
+//	fs := &fatfs.FS{}
+//	if err := fs.Mount(dev); err != nil {
+//		return err
+//	}
+//	f, err := fs.Open("/boot_out.txt", os.O_RDONLY)
+package fatfs // import "tinygo.org/x/drivers/fatfs"
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"tinygo.org/x/drivers"
+)
+
+var (
+	ErrNotFAT       = errors.New("fatfs: no FAT filesystem found")
+	ErrNotMounted   = errors.New("fatfs: not mounted")
+	ErrNotExist     = errors.New("fatfs: file does not exist")
+	ErrExist        = errors.New("fatfs: file already exists")
+	ErrIsDir        = errors.New("fatfs: is a directory")
+	ErrNotDir       = errors.New("fatfs: not a directory")
+	ErrNotEmpty     = errors.New("fatfs: directory not empty")
+	ErrInvalidName  = errors.New("fatfs: invalid file name")
+	ErrNoSpace      = errors.New("fatfs: no space left on device")
+	ErrDirFull      = errors.New("fatfs: root directory full")
+	ErrReadOnly     = errors.New("fatfs: file not open for writing")
+	ErrWriteOnly    = errors.New("fatfs: file not open for reading")
+	ErrClosed       = errors.New("fatfs: file already closed")
+	ErrInvalidSeek  = errors.New("fatfs: invalid seek offset")
+	ErrFileTooLarge = errors.New("fatfs: file too large")
+	ErrCorrupt      = errors.New("fatfs: filesystem corrupt")
+	ErrTooSmall     = errors.New("fatfs: device too small")
+)
+
+// Type is the FAT variant of a filesystem.
+type Type uint8
+
+const (
+	FAT12 Type = 12
+	FAT16 Type = 16
+	FAT32 Type = 32
+)
+
+// FS is a mounted FAT filesystem.
+type FS struct {
+	// CacheBlocks is the number of erase blocks kept in the write-back
+	// cache. It must be set before Mount. If zero, one block is cached for
+	// each copy of the FAT and one for the data, so that a file can be
+	// written without flushing a block of the FAT for every cluster.
+	CacheBlocks int
+
+	// Clock returns the time used for file timestamps. If nil, all
+	// timestamps are set to the FAT epoch of 1980-01-01.
+	Clock func() time.Time
+
+	dev   drivers.BlockDevice
+	cache blockCache
+
+	typ         Type
+	base        int64 // byte offset of the volume on the device
+	sectorSize  int64
+	clusterSize int64
+	fatStart    int64 // byte offset of the first FAT
+	fatSize     int64 // size of one FAT in bytes
+	numFATs     int
+	rootStart   int64 // byte offset of the FAT12/16 root directory
+	rootEntries int
+	dataStart   int64 // byte offset of cluster 2
+	clusters    uint32
+	rootCluster uint32 // FAT32 only
+	fsInfo      int64  // byte offset of the FAT32 FSInfo sector, or 0
+	fsInfoDirty bool
+	nextFree    uint32
+	mounted     bool
+}
+
+// Mount mounts the filesystem on dev. The volume may either start at the
+// beginning of the device or be the first FAT partition of an MBR
+// partition table.
+func (fs *FS) Mount(dev drivers.BlockDevice) error {
+	fs.mounted = false
+	fs.dev = dev
+
+	var bs [512]byte
+	if _, err := dev.ReadAt(bs[:], 0); err != nil {
+		return err
+	}
+	fs.base = 0
+	if !isBootSector(bs[:]) {
+		// look for a FAT partition in the MBR
+		if bs[510] != 0x55 || bs[511] != 0xAA {
+			return ErrNotFAT
+		}
+		found := false
+		for i := 0; i < 4; i++ {
+			entry := bs[0x1BE+16*i:]
+			switch entry[4] {
+			case 0x01, 0x04, 0x06, 0x0B, 0x0C, 0x0E:
+				fs.base = int64(binary.LittleEndian.Uint32(entry[8:])) * 512
+				found = true
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return ErrNotFAT
+		}
+		if _, err := dev.ReadAt(bs[:], fs.base); err != nil {
+			return err
+		}
+		if !isBootSector(bs[:]) {
+			return ErrNotFAT
+		}
+	}
+
+	le := binary.LittleEndian
+	fs.sectorSize = int64(le.Uint16(bs[0x0B:]))
+	fs.clusterSize = fs.sectorSize * int64(bs[0x0D])
+	reserved := int64(le.Uint16(bs[0x0E:]))
+	fs.numFATs = int(bs[0x10])
+	fs.rootEntries = int(le.Uint16(bs[0x11:]))
+	total := int64(le.Uint16(bs[0x13:]))
+	if total == 0 {
+		total = int64(le.Uint32(bs[0x20:]))
+	}
+	fatSectors := int64(le.Uint16(bs[0x16:]))
+	if fatSectors == 0 {
+		fatSectors = int64(le.Uint32(bs[0x24:]))
+	}
+	rootSectors := (int64(fs.rootEntries)*32 + fs.sectorSize - 1) / fs.sectorSize
+
+	fs.fatStart = fs.base + reserved*fs.sectorSize
+	fs.fatSize = fatSectors * fs.sectorSize
+	fs.rootStart = fs.fatStart + int64(fs.numFATs)*fs.fatSize
+	fs.dataStart = fs.rootStart + rootSectors*fs.sectorSize
+	dataSectors := total - reserved - int64(fs.numFATs)*fatSectors - rootSectors
+	if dataSectors <= 0 || fs.base+total*fs.sectorSize > dev.Size() {
+		return ErrCorrupt
+	}
+	fs.clusters = uint32(dataSectors * fs.sectorSize / fs.clusterSize)
+
+	switch {
+	case fs.clusters < 4085:
+		fs.typ = FAT12
+	case fs.clusters < 65525:
+		fs.typ = FAT16
+	default:
+		fs.typ = FAT32
+	}
+	fs.fsInfo = 0
+	if fs.typ == FAT32 {
+		fs.rootCluster = le.Uint32(bs[0x2C:])
+		if info := int64(le.Uint16(bs[0x30:])); info != 0 && info != 0xFFFF {
+			fs.fsInfo = fs.base + info*fs.sectorSize
+		}
+	}
+	if int64(fs.clusters+2)*int64(fs.typ)/8 > fs.fatSize {
+		return ErrCorrupt
+	}
+	n := fs.CacheBlocks
+	if n <= 0 {
+		n = fs.numFATs + 1
+	}
+	fs.cache.init(dev, n)
+	fs.nextFree = 2
+	fs.fsInfoDirty = false
+	fs.mounted = true
+	return nil
+}
+
+// isBootSector reports whether bs looks like a FAT boot sector.
+func isBootSector(bs []byte) bool {
+	if bs[510] != 0x55 || bs[511] != 0xAA {
+		return false
+	}
+	if bs[0] != 0xEB && bs[0] != 0xE9 {
+		return false
+	}
+	bps := binary.LittleEndian.Uint16(bs[0x0B:])
+	spc := bs[0x0D]
+	return (bps == 512 || bps == 1024 || bps == 2048 || bps == 4096) &&
+		spc != 0 && spc&(spc-1) == 0 &&
+		binary.LittleEndian.Uint16(bs[0x0E:]) != 0 &&
+		bs[0x10] != 0
+}
+
+// Unmount writes all cached data to the device and unmounts the filesystem.
+// Files that are still open must not be used anymore.
+func (fs *FS) Unmount() error {
+	err := fs.Sync()
+	fs.mounted = false
+	return err
+}
+
+// Sync writes all cached data to the device.
+func (fs *FS) Sync() error {
+	if !fs.mounted {
+		return ErrNotMounted
+	}
+	if fs.fsInfoDirty {
+		// the free cluster count is no longer known, which is allowed by
+		// the specification and makes the host recompute it
+		var unknown = [4]byte{0xFF, 0xFF, 0xFF, 0xFF}
+		if err := fs.cache.write(fs.fsInfo+488, unknown[:]); err != nil {
+			return err
+		}
+		// once is enough until the next mount
+		fs.fsInfo = 0
+		fs.fsInfoDirty = false
+	}
+	return fs.cache.flush()
+}
+
+// Type returns the FAT variant of the mounted filesystem.
+func (fs *FS) Type() Type {
+	return fs.typ
+}
+
+// ClusterSize returns the allocation unit of the filesystem in bytes.
+func (fs *FS) ClusterSize() int64 {
+	return fs.clusterSize
+}
+
+// Size returns the size of the data area in bytes.
+func (fs *FS) Size() int64 {
+	return int64(fs.clusters) * fs.clusterSize
+}
+
+// Free returns the number of free bytes. It reads the whole FAT.
+func (fs *FS) Free() (int64, error) {
+	if !fs.mounted {
+		return 0, ErrNotMounted
+	}
+	free := int64(0)
+	for c := uint32(2); c < fs.clusters+2; c++ {
+		v, err := fs.fatEntry(c)
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			free++
+		}
+	}
+	return free * fs.clusterSize, nil
+}
+
+// clusterOffset returns the byte offset of cluster c.
+func (fs *FS) clusterOffset(c uint32) int64 {
+	return fs.dataStart + int64(c-2)*fs.clusterSize
+}
+
+// eoc returns the end of chain marker.
+func (fs *FS) eoc() uint32 {
+	switch fs.typ {
+	case FAT12:
+		return 0xFFF
+	case FAT16:
+		return 0xFFFF
+	default:
+		return 0x0FFFFFFF
+	}
+}
+
+// isEOC reports whether the FAT entry v ends a chain.
+func (fs *FS) isEOC(v uint32) bool {
+	switch fs.typ {
+	case FAT12:
+		return v >= 0xFF8
+	case FAT16:
+		return v >= 0xFFF8
+	default:
+		return v >= 0x0FFFFFF8
+	}
+}
+
+// fatEntry returns the FAT entry of cluster c from the first FAT.
+func (fs *FS) fatEntry(c uint32) (uint32, error) {
+	var b [4]byte
+	switch fs.typ {
+	case FAT12:
+		off := int64(c) + int64(c)/2
+		if err := fs.cache.read(fs.fatStart+off, b[:2]); err != nil {
+			return 0, err
+		}
+		v := uint32(binary.LittleEndian.Uint16(b[:]))
+		if c&1 != 0 {
+			return v >> 4, nil
+		}
+		return v & 0xFFF, nil
+	case FAT16:
+		if err := fs.cache.read(fs.fatStart+int64(c)*2, b[:2]); err != nil {
+			return 0, err
+		}
+		return uint32(binary.LittleEndian.Uint16(b[:])), nil
+	default:
+		if err := fs.cache.read(fs.fatStart+int64(c)*4, b[:]); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint32(b[:]) & 0x0FFFFFFF, nil
+	}
+}
+
+// setFATEntry sets the FAT entry of cluster c in all FATs.
+func (fs *FS) setFATEntry(c, v uint32) error {
+	var b [4]byte
+	for i := 0; i < fs.numFATs; i++ {
+		start := fs.fatStart + int64(i)*fs.fatSize
+		switch fs.typ {
+		case FAT12:
+			off := start + int64(c) + int64(c)/2
+			if err := fs.cache.read(off, b[:2]); err != nil {
+				return err
+			}
+			old := binary.LittleEndian.Uint16(b[:])
+			if c&1 != 0 {
+				old = old&0x000F | uint16(v)<<4
+			} else {
+				old = old&0xF000 | uint16(v)&0xFFF
+			}
+			binary.LittleEndian.PutUint16(b[:], old)
+			if err := fs.cache.write(off, b[:2]); err != nil {
+				return err
+			}
+		case FAT16:
+			binary.LittleEndian.PutUint16(b[:], uint16(v))
+			if err := fs.cache.write(start+int64(c)*2, b[:2]); err != nil {
+				return err
+			}
+		default:
+			off := start + int64(c)*4
+			if err := fs.cache.read(off, b[:]); err != nil {
+				return err
+			}
+			old := binary.LittleEndian.Uint32(b[:])
+			binary.LittleEndian.PutUint32(b[:], old&0xF0000000|v&0x0FFFFFFF)
+			if err := fs.cache.write(off, b[:]); err != nil {
+				return err
+			}
+		}
+	}
+	if fs.fsInfo != 0 {
+		fs.fsInfoDirty = true
+	}
+	return nil
+}
+
+// next returns the cluster following c in its chain, or 0 at the end of
+// the chain.
+func (fs *FS) next(c uint32) (uint32, error) {
+	v, err := fs.fatEntry(c)
+	if err != nil {
+		return 0, err
+	}
+	if fs.isEOC(v) {
+		return 0, nil
+	}
+	if v < 2 || v >= fs.clusters+2 {
+		return 0, ErrCorrupt
+	}
+	return v, nil
+}
+
+// allocate finds a free cluster, marks it as the end of a chain and links
+// it to prev unless prev is zero. If zero is set, the cluster is cleared.
+func (fs *FS) allocate(prev uint32, zero bool) (uint32, error) {
+	c := fs.nextFree
+	for i := uint32(0); i < fs.clusters; i++ {
+		if c < 2 || c >= fs.clusters+2 {
+			c = 2
+		}
+		v, err := fs.fatEntry(c)
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			if err := fs.setFATEntry(c, fs.eoc()); err != nil {
+				return 0, err
+			}
+			if prev != 0 {
+				if err := fs.setFATEntry(prev, c); err != nil {
+					return 0, err
+				}
+			}
+			if zero {
+				if err := fs.cache.zero(fs.clusterOffset(c), fs.clusterSize); err != nil {
+					return 0, err
+				}
+			}
+			fs.nextFree = c + 1
+			return c, nil
+		}
+		c++
+	}
+	return 0, ErrNoSpace
+}
+
+// freeChain marks all clusters of the chain starting at c as free.
+func (fs *FS) freeChain(c uint32) error {
+	for c != 0 {
+		next, err := fs.next(c)
+		if err != nil {
+			return err
+		}
+		if err := fs.setFATEntry(c, 0); err != nil {
+			return err
+		}
+		if c < fs.nextFree {
+			fs.nextFree = c
+		}
+		c = next
+	}
+	return nil
+}
+
+// now returns the current time for timestamps.
+func (fs *FS) now() time.Time {
+	if fs.Clock == nil {
+		return time.Time{}
+	}
+	return fs.Clock()
+}
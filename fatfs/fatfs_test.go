@@ -0,0 +1,370 @@
+package fatfs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"tinygo.org/x/drivers/fatfs"
+	"tinygo.org/x/drivers/flash/flashemu"
+)
+
+// image is a device backed by a disk image, as created by mkfs.fat.
+type image []byte
+
+func (img image) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, img[off:]), nil
+}
+
+func (img image) WriteAt(p []byte, off int64) (int, error) {
+	return copy(img[off:], p), nil
+}
+
+func (img image) Size() int64           { return int64(len(img)) }
+func (img image) WriteBlockSize() int64 { return 512 }
+func (img image) EraseBlockSize() int64 { return 512 }
+
+func (img image) EraseBlocks(start, n int64) error {
+	for i := start * 512; i < (start+n)*512; i++ {
+		img[i] = 0xFF
+	}
+	return nil
+}
+
+func writeFile(t *testing.T, fs *fatfs.FS, name string, data []byte) {
+	t.Helper()
+	f, err := fs.Create(name)
+	if err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close %s: %v", name, err)
+	}
+}
+
+func readFile(t *testing.T, fs *fatfs.FS, name string) []byte {
+	t.Helper()
+	f, err := fs.Open(name, os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+func names(t *testing.T, fs *fatfs.FS, dir string) []string {
+	t.Helper()
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("readdir %s: %v", dir, err)
+	}
+	var list []string
+	for _, fi := range infos {
+		list = append(list, fi.Name())
+	}
+	sort.Strings(list)
+	return list
+}
+
+// pattern returns n bytes of test data that differ between seeds.
+func pattern(n, seed int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7 + seed*13 + i>>8)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		typ  fatfs.Type
+		size int64
+	}{
+		{fatfs.FAT12, 1 << 20},
+		{fatfs.FAT16, 8 << 20},
+		{fatfs.FAT32, 40 << 20},
+	} {
+		t.Run(fmt.Sprint("FAT", tc.typ), func(t *testing.T) {
+			dev := flashemu.New(tc.size, 256, 4096)
+			dev.Strict = true
+			if err := fatfs.Format(dev, &fatfs.FormatConfig{Type: tc.typ, Label: "tinygo"}); err != nil {
+				t.Fatal("format:", err)
+			}
+			fs := &fatfs.FS{}
+			if err := fs.Mount(dev); err != nil {
+				t.Fatal("mount:", err)
+			}
+			if fs.Type() != tc.typ {
+				t.Fatalf("type: got FAT%d", fs.Type())
+			}
+
+			big := pattern(3*int(fs.ClusterSize())+100, 1)
+			if err := fs.Mkdir("/Sub Directory"); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, fs, "/README.TXT", []byte("hello"))
+			writeFile(t, fs, "/Sub Directory/A rather long file name.data", big)
+			writeFile(t, fs, "/Sub Directory/old.txt", []byte("renamed"))
+			writeFile(t, fs, "/gone.txt", []byte("removed"))
+			if err := fs.Rename("/Sub Directory/old.txt", "/new name.txt"); err != nil {
+				t.Fatal("rename:", err)
+			}
+			if err := fs.Remove("/gone.txt"); err != nil {
+				t.Fatal("remove:", err)
+			}
+			if err := fs.Unmount(); err != nil {
+				t.Fatal("unmount:", err)
+			}
+
+			fs = &fatfs.FS{}
+			if err := fs.Mount(dev); err != nil {
+				t.Fatal("remount:", err)
+			}
+			if got, want := fmt.Sprint(names(t, fs, "/")), "[README.TXT Sub Directory new name.txt]"; got != want {
+				t.Errorf("root: got %s, want %s", got, want)
+			}
+			if got := readFile(t, fs, "/readme.txt"); string(got) != "hello" {
+				t.Errorf("README.TXT: got %q", got)
+			}
+			if got := readFile(t, fs, "/sub directory/a rather long file name.data"); !bytes.Equal(got, big) {
+				t.Errorf("long file name: got %d bytes, want %d", len(got), len(big))
+			}
+			if got := readFile(t, fs, "/new name.txt"); string(got) != "renamed" {
+				t.Errorf("renamed file: got %q", got)
+			}
+			if _, err := fs.Stat("/gone.txt"); err != fatfs.ErrNotExist {
+				t.Errorf("removed file: got %v", err)
+			}
+		})
+	}
+}
+
+// TestEraseCount checks that the default cache keeps the FAT copies and the
+// data block cached while small files are written.
+func TestEraseCount(t *testing.T) {
+	dev := flashemu.New(2<<20, 256, 4096)
+	if err := fatfs.Format(dev, nil); err != nil {
+		t.Fatal("format:", err)
+	}
+	fs := &fatfs.FS{}
+	if err := fs.Mount(dev); err != nil {
+		t.Fatal("mount:", err)
+	}
+	_, _, before := dev.Stats()
+	for i := 0; i < 40; i++ {
+		writeFile(t, fs, fmt.Sprintf("/log%02d.txt", i), pattern(4000, i))
+	}
+	_, _, after := dev.Stats()
+	// closing a file writes its data, the directory and both FATs, which
+	// takes about 6 erases; with the FATs evicting each other the blocks
+	// are written for each cluster instead
+	if erases := after - before; erases > 300 {
+		t.Errorf("writing 40 files took %d erases", erases)
+	}
+}
+
+// run runs a command from dosfstools or mtools, skipping the test if it is
+// not installed.
+func run(t *testing.T, name string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not installed", name)
+	}
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", name, err, out)
+	}
+	return string(out)
+}
+
+// TestReadMkfsImage reads files copied with mtools into volumes created by
+// mkfs.fat.
+func TestReadMkfsImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fatfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tc := range []struct {
+		fat  string
+		size int // in kB
+	}{
+		{"12", 1024},
+		{"16", 8192},
+		{"32", 40960},
+	} {
+		t.Run("FAT"+tc.fat, func(t *testing.T) {
+			path := filepath.Join(dir, "fat"+tc.fat+".img")
+			src := filepath.Join(dir, "A long file name.bin")
+			data := pattern(10000, 3)
+			if err := ioutil.WriteFile(src, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			run(t, "mkfs.fat", "-C", "-F", tc.fat, "-s", "1", "-n", "TINYGO", path, fmt.Sprint(tc.size))
+			run(t, "mmd", "-i", path, "::/Sub dir")
+			run(t, "mcopy", "-i", path, src, "::/Sub dir/")
+
+			img, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fs := &fatfs.FS{}
+			if err := fs.Mount(image(img)); err != nil {
+				t.Fatal("mount:", err)
+			}
+			if got := fmt.Sprint(fs.Type()); got != tc.fat {
+				t.Errorf("type: got FAT%s", got)
+			}
+			if got := readFile(t, fs, "/Sub dir/A long file name.bin"); !bytes.Equal(got, data) {
+				t.Errorf("got %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+// testdataImage returns the image testdata/name.img.gz, skipping the test
+// if it is not there.
+func testdataImage(t *testing.T, name string) image {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name+".img.gz"))
+	if os.IsNotExist(err) {
+		t.Skipf("testdata/%s.img.gz not available", name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image(img)
+}
+
+// TestReadTestdataImage reads the volumes of TestReadMkfsImage from images
+// kept in testdata, so that they are checked without dosfstools and mtools.
+//
+// The images are not in the tree yet: they must be created with the real
+// tools, which were not available when this test was written, and not
+// written by hand. With dosfstools and mtools installed, for each FAT type
+// and size of TestReadMkfsImage:
+//
+//	mkfs.fat -C -F 12 -s 1 -n TINYGO fat12.img 1024
+//	mmd -i fat12.img "::/Sub dir"
+//	mcopy -i fat12.img "A long file name.bin" "::/Sub dir/"
+//	gzip -9 fat12.img
+//
+// where "A long file name.bin" holds pattern(10000, 3).
+func TestReadTestdataImage(t *testing.T) {
+	for _, fat := range []string{"12", "16", "32"} {
+		t.Run("FAT"+fat, func(t *testing.T) {
+			img := testdataImage(t, "fat"+fat)
+			fs := &fatfs.FS{}
+			if err := fs.Mount(img); err != nil {
+				t.Fatal("mount:", err)
+			}
+			if got := fmt.Sprint(fs.Type()); got != fat {
+				t.Errorf("type: got FAT%s", got)
+			}
+			if got := readFile(t, fs, "/Sub dir/A long file name.bin"); !bytes.Equal(got, pattern(10000, 3)) {
+				t.Errorf("got %d bytes, want 10000", len(got))
+			}
+		})
+	}
+}
+
+// TestWriteMkfsImage writes to a volume created by mkfs.fat, and checks the
+// result with fsck.fat and mtools.
+func TestWriteMkfsImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fatfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fat16.img")
+	run(t, "mkfs.fat", "-C", "-F", "16", path, "8192")
+
+	img, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &fatfs.FS{}
+	if err := fs.Mount(image(img)); err != nil {
+		t.Fatal("mount:", err)
+	}
+	if err := fs.Mkdir("/Sub dir"); err != nil {
+		t.Fatal(err)
+	}
+	data := pattern(10000, 4)
+	writeFile(t, fs, "/Sub dir/A long file name.bin", data)
+	if err := fs.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, img, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, "fsck.fat", "-n", path)
+	dst := filepath.Join(dir, "out.bin")
+	run(t, "mcopy", "-i", path, "::/Sub dir/A long file name.bin", dst)
+	if got, err := ioutil.ReadFile(dst); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("mcopy: got %d bytes, %v", len(got), err)
+	}
+}
+
+// TestFormatFsck checks volumes created by Format with fsck.fat.
+func TestFormatFsck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fatfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tc := range []struct {
+		typ  fatfs.Type
+		size int64
+	}{
+		{fatfs.FAT12, 1 << 20},
+		{fatfs.FAT16, 8 << 20},
+		{fatfs.FAT32, 40 << 20},
+	} {
+		t.Run(fmt.Sprint("FAT", tc.typ), func(t *testing.T) {
+			img := make(image, tc.size)
+			if err := fatfs.Format(img, &fatfs.FormatConfig{Type: tc.typ}); err != nil {
+				t.Fatal("format:", err)
+			}
+			fs := &fatfs.FS{}
+			if err := fs.Mount(img); err != nil {
+				t.Fatal("mount:", err)
+			}
+			writeFile(t, fs, "/A long file name.txt", pattern(5000, 5))
+			if err := fs.Unmount(); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, fmt.Sprint("fat", tc.typ, ".img"))
+			if err := ioutil.WriteFile(path, img, 0644); err != nil {
+				t.Fatal(err)
+			}
+			run(t, "fsck.fat", "-n", path)
+			if out := run(t, "mdir", "-i", path, "::/"); !bytes.Contains([]byte(out), []byte("A long file name.txt")) {
+				t.Errorf("mdir:\n%s", out)
+			}
+		})
+	}
+}
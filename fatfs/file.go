@@ -0,0 +1,549 @@
+package fatfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// File is an open file of a FS.
+type File struct {
+	fs    *FS
+	entry entry
+	flag  int
+	pos   int64
+	dirty bool // the directory entry needs to be written
+
+	// cluster containing the byte at offset curIndex*clusterSize
+	cur      uint32
+	curIndex int64
+
+	closed bool
+}
+
+// FileInfo describes a file and implements os.FileInfo.
+type FileInfo struct {
+	name    string
+	size    int64
+	attr    byte
+	modTime time.Time
+}
+
+// Name returns the base name of the file.
+func (fi *FileInfo) Name() string { return fi.name }
+
+// Size returns the length of the file in bytes.
+func (fi *FileInfo) Size() int64 { return fi.size }
+
+// Mode returns the file mode bits derived from the FAT attributes.
+func (fi *FileInfo) Mode() os.FileMode {
+	mode := os.FileMode(0666)
+	if fi.attr&attrReadOnly != 0 {
+		mode = 0444
+	}
+	if fi.IsDir() {
+		mode |= os.ModeDir | 0111
+	}
+	return mode
+}
+
+// ModTime returns the modification time.
+func (fi *FileInfo) ModTime() time.Time { return fi.modTime }
+
+// IsDir reports whether the file is a directory.
+func (fi *FileInfo) IsDir() bool { return fi.attr&attrDirectory != 0 }
+
+// Sys returns the FAT attribute byte.
+func (fi *FileInfo) Sys() interface{} { return fi.attr }
+
+func (e *entry) info() *FileInfo {
+	return &FileInfo{
+		name:    e.name,
+		size:    int64(e.size()),
+		attr:    e.raw[11],
+		modTime: e.modTime(),
+	}
+}
+
+// Open opens the named file with the given os.O_* flags, such as
+// os.O_RDONLY or os.O_WRONLY|os.O_CREATE|os.O_TRUNC. Directories can't be
+// opened; use ReadDir instead.
+func (fs *FS) Open(name string, flag int) (*File, error) {
+	dir, base, e, found, isRoot, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if isRoot || found && e.isDir() {
+		return nil, ErrIsDir
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if found {
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, ErrExist
+		}
+	} else {
+		if flag&os.O_CREATE == 0 {
+			return nil, ErrNotExist
+		}
+		var tmpl entry
+		tmpl.raw[11] = attrArchive
+		tmpl.touch(fs.now(), true)
+		e, err = fs.createEntry(dir, base, &tmpl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f := &File{fs: fs, entry: e, flag: flag}
+	if writable && flag&os.O_TRUNC != 0 && e.size() > 0 {
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Create creates or truncates the named file and opens it for reading and
+// writing.
+func (fs *FS) Create(name string) (*File, error) {
+	return fs.Open(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// Stat returns information about the named file or directory.
+func (fs *FS) Stat(name string) (*FileInfo, error) {
+	_, _, e, found, isRoot, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if isRoot {
+		return &FileInfo{name: "/", attr: attrDirectory}, nil
+	}
+	if !found {
+		return nil, ErrNotExist
+	}
+	return e.info(), nil
+}
+
+// ReadDir returns the entries of the named directory, without "." and "..".
+func (fs *FS) ReadDir(name string) ([]*FileInfo, error) {
+	_, _, e, found, isRoot, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotExist
+	}
+	dir := fs.rootDir()
+	if !isRoot {
+		if !e.isDir() {
+			return nil, ErrNotDir
+		}
+		dir = e.cluster()
+	}
+	var list []*FileInfo
+	err = fs.scanDir(dir, func(e *entry) bool {
+		if e.name != "." && e.name != ".." {
+			list = append(list, e.info())
+		}
+		return true
+	})
+	return list, err
+}
+
+// Mkdir creates a directory.
+func (fs *FS) Mkdir(name string) error {
+	dir, base, _, found, isRoot, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if found || isRoot {
+		return ErrExist
+	}
+	c, err := fs.allocate(0, true)
+	if err != nil {
+		return err
+	}
+	var tmpl entry
+	tmpl.raw[11] = attrDirectory
+	tmpl.touch(fs.now(), true)
+	tmpl.setCluster(c)
+	if _, err := fs.createEntry(dir, base, &tmpl); err != nil {
+		fs.freeChain(c)
+		return err
+	}
+
+	// "." and ".." entries, where ".." of a subdirectory of the root
+	// refers to cluster 0
+	dot := tmpl
+	copy(dot.raw[:11], ".          ")
+	dot.off = fs.clusterOffset(c)
+	if err := fs.writeEntry(&dot); err != nil {
+		return err
+	}
+	if dir == fs.rootDir() {
+		dir = 0
+	}
+	dot.setCluster(dir)
+	copy(dot.raw[:11], "..         ")
+	dot.off += dirEntrySize
+	return fs.writeEntry(&dot)
+}
+
+// Remove removes a file or an empty directory.
+func (fs *FS) Remove(name string) error {
+	_, _, e, found, isRoot, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if isRoot {
+		return ErrInvalidName
+	}
+	if !found {
+		return ErrNotExist
+	}
+	if e.isDir() {
+		empty, err := fs.isEmptyDir(e.cluster())
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return ErrNotEmpty
+		}
+	}
+	if err := fs.removeEntry(&e); err != nil {
+		return err
+	}
+	if c := e.cluster(); c != 0 {
+		return fs.freeChain(c)
+	}
+	return nil
+}
+
+// Rename moves a file or directory. The new name must not exist yet.
+func (fs *FS) Rename(oldname, newname string) error {
+	_, _, e, found, isRoot, err := fs.resolve(oldname)
+	if err != nil {
+		return err
+	}
+	if isRoot {
+		return ErrInvalidName
+	}
+	if !found {
+		return ErrNotExist
+	}
+	oldpath := strings.ToUpper(path.Clean("/" + oldname))
+	newpath := strings.ToUpper(path.Clean("/" + newname))
+	if e.isDir() && strings.HasPrefix(newpath, oldpath+"/") {
+		// can't move a directory into itself
+		return ErrInvalidName
+	}
+
+	dir, base, existing, found, isRoot, err := fs.resolve(newname)
+	if err != nil {
+		return err
+	}
+	if isRoot {
+		return ErrExist
+	}
+	if found {
+		if existing.dir != e.dir || existing.index != e.index {
+			return ErrExist
+		}
+		// only the case of the name changes
+		if err := fs.removeEntry(&e); err != nil {
+			return err
+		}
+		_, err := fs.createEntry(dir, base, &e)
+		return err
+	}
+
+	// add the new entry before removing the old one, so that the file is
+	// not lost if the operation is interrupted
+	ne, err := fs.createEntry(dir, base, &e)
+	if err != nil {
+		return err
+	}
+	if err := fs.removeEntry(&e); err != nil {
+		return err
+	}
+	if e.isDir() && ne.dir != e.dir {
+		// update ".." of the moved directory
+		var dotdot entry
+		dotdot.off = fs.clusterOffset(e.cluster()) + dirEntrySize
+		if err := fs.cache.read(dotdot.off, dotdot.raw[:]); err != nil {
+			return err
+		}
+		parent := dir
+		if parent == fs.rootDir() {
+			parent = 0
+		}
+		dotdot.setCluster(parent)
+		return fs.writeEntry(&dotdot)
+	}
+	return nil
+}
+
+// Name returns the name of the file as passed to Open, without directory.
+func (f *File) Name() string {
+	return f.entry.name
+}
+
+// Stat returns information about the file.
+func (f *File) Stat() (*FileInfo, error) {
+	if f.closed {
+		return nil, ErrClosed
+	}
+	return f.entry.info(), nil
+}
+
+// Read reads up to len(p) bytes from the current position.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes starting at offset off.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, ErrWriteOnly
+	}
+	size := int64(f.entry.size())
+	if off >= size {
+		return 0, io.EOF
+	}
+	if remain := size - off; int64(len(p)) > remain {
+		p = p[:remain]
+		err = io.EOF
+	}
+	for len(p) > 0 {
+		c, err := f.clusterAt(off, false)
+		if err != nil {
+			return n, err
+		}
+		start := off % f.fs.clusterSize
+		chunk := f.fs.clusterSize - start
+		if chunk > int64(len(p)) {
+			chunk = int64(len(p))
+		}
+		if err := f.fs.cache.read(f.fs.clusterOffset(c)+start, p[:chunk]); err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+		n += int(chunk)
+		off += chunk
+	}
+	return n, err
+}
+
+// Write writes p at the current position, or at the end of the file if it
+// was opened with os.O_APPEND.
+func (f *File) Write(p []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		f.pos = int64(f.entry.size())
+	}
+	n, err := f.WriteAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+// WriteAt writes p starting at offset off, growing the file if needed. A
+// gap between the end of the file and off is filled with zeros.
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, ErrReadOnly
+	}
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	if off+int64(len(p)) > 0xFFFFFFFF {
+		return 0, ErrFileTooLarge
+	}
+	if size := int64(f.entry.size()); off > size {
+		if err := f.zeroRange(size, off-size); err != nil {
+			return 0, err
+		}
+	}
+	for len(p) > 0 {
+		c, err := f.clusterAt(off, true)
+		if err != nil {
+			return n, err
+		}
+		start := off % f.fs.clusterSize
+		chunk := f.fs.clusterSize - start
+		if chunk > int64(len(p)) {
+			chunk = int64(len(p))
+		}
+		if err := f.fs.cache.write(f.fs.clusterOffset(c)+start, p[:chunk]); err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+		n += int(chunk)
+		off += chunk
+		if off > int64(f.entry.size()) {
+			f.entry.setSize(uint32(off))
+		}
+	}
+	f.entry.raw[11] |= attrArchive
+	f.entry.touch(f.fs.now(), false)
+	f.dirty = true
+	return n, nil
+}
+
+// zeroRange writes n zero bytes at offset off.
+func (f *File) zeroRange(off, n int64) error {
+	var zeros [64]byte
+	for n > 0 {
+		chunk := int64(len(zeros))
+		if n < chunk {
+			chunk = n
+		}
+		if _, err := f.WriteAt(zeros[:chunk], off); err != nil {
+			return err
+		}
+		off += chunk
+		n -= chunk
+	}
+	return nil
+}
+
+// clusterAt returns the cluster holding the byte at offset off, allocating
+// clusters if grow is set.
+func (f *File) clusterAt(off int64, grow bool) (uint32, error) {
+	fs := f.fs
+	index := off / fs.clusterSize
+	if f.entry.cluster() == 0 {
+		if !grow {
+			return 0, ErrCorrupt
+		}
+		c, err := fs.allocate(0, false)
+		if err != nil {
+			return 0, err
+		}
+		f.entry.setCluster(c)
+		f.dirty = true
+		f.cur, f.curIndex = c, 0
+	}
+	if f.cur == 0 || index < f.curIndex {
+		f.cur, f.curIndex = f.entry.cluster(), 0
+	}
+	for f.curIndex < index {
+		next, err := fs.next(f.cur)
+		if err != nil {
+			return 0, err
+		}
+		if next == 0 {
+			if !grow {
+				return 0, ErrCorrupt
+			}
+			next, err = fs.allocate(f.cur, false)
+			if err != nil {
+				return 0, err
+			}
+		}
+		f.cur = next
+		f.curIndex++
+	}
+	return f.cur, nil
+}
+
+// Seek sets the position for the next Read or Write.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(f.entry.size())
+	default:
+		return f.pos, ErrInvalidSeek
+	}
+	if offset < 0 {
+		return f.pos, ErrInvalidSeek
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	if f.closed {
+		return ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return ErrReadOnly
+	}
+	if size < 0 || size > 0xFFFFFFFF {
+		return ErrInvalidSeek
+	}
+	cur := int64(f.entry.size())
+	if size > cur {
+		return f.zeroRange(cur, size-cur)
+	}
+	fs := f.fs
+	if size == 0 {
+		if c := f.entry.cluster(); c != 0 {
+			if err := fs.freeChain(c); err != nil {
+				return err
+			}
+		}
+		f.entry.setCluster(0)
+	} else {
+		last, err := f.clusterAt(size-1, false)
+		if err != nil {
+			return err
+		}
+		next, err := fs.next(last)
+		if err != nil {
+			return err
+		}
+		if next != 0 {
+			if err := fs.setFATEntry(last, fs.eoc()); err != nil {
+				return err
+			}
+			if err := fs.freeChain(next); err != nil {
+				return err
+			}
+		}
+	}
+	f.cur, f.curIndex = 0, 0
+	f.entry.setSize(uint32(size))
+	f.entry.touch(fs.now(), false)
+	f.dirty = true
+	return nil
+}
+
+// Sync writes the directory entry of the file and all cached data to the
+// device.
+func (f *File) Sync() error {
+	if f.closed {
+		return ErrClosed
+	}
+	if f.dirty {
+		if err := f.fs.writeEntry(&f.entry); err != nil {
+			return err
+		}
+		f.dirty = false
+	}
+	return f.fs.Sync()
+}
+
+// Close syncs and closes the file.
+func (f *File) Close() error {
+	if f.closed {
+		return ErrClosed
+	}
+	err := f.Sync()
+	f.closed = true
+	return err
+}
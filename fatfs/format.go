@@ -0,0 +1,248 @@
+package fatfs
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"tinygo.org/x/drivers"
+)
+
+// FormatConfig holds the parameters for Format. The zero value selects
+// sensible defaults for the size of the device.
+type FormatConfig struct {
+	// Type forces a FAT variant. If zero, FAT32 is used for volumes of
+	// 512MB and more, and FAT12 or FAT16 otherwise, depending on the number
+	// of clusters.
+	Type Type
+
+	// SectorsPerCluster is the cluster size in 512 byte sectors, a power of
+	// two. If zero, the smallest cluster size valid for the type is used up
+	// to 512MB, and 4kB and more for larger FAT32 volumes.
+	SectorsPerCluster int
+
+	// FATs is the number of copies of the FAT, 2 if zero. A single FAT
+	// halves the number of flash erases caused by allocations.
+	FATs int
+
+	// RootEntries is the size of the FAT12/16 root directory, 512 if zero.
+	RootEntries int
+
+	// Label is the volume label, up to 11 characters.
+	Label string
+
+	// VolumeID is the volume serial number.
+	VolumeID uint32
+}
+
+// layout is the geometry of a volume to format.
+type layout struct {
+	typ      Type
+	total    uint32 // sectors
+	spc      uint32
+	reserved uint32
+	fats     uint32
+	rootSecs uint32
+	fatSecs  uint32
+	clusters uint32
+}
+
+func typeFor(clusters uint32) Type {
+	switch {
+	case clusters < 4085:
+		return FAT12
+	case clusters < 65525:
+		return FAT16
+	default:
+		return FAT32
+	}
+}
+
+// compute calculates the FAT size and number of clusters.
+func (l *layout) compute() bool {
+	if l.typ == FAT32 {
+		l.reserved, l.rootSecs = 32, 0
+	} else {
+		l.reserved = 1
+	}
+	l.fatSecs = 1
+	for {
+		meta := l.reserved + l.fats*l.fatSecs + l.rootSecs
+		if meta >= l.total {
+			return false
+		}
+		l.clusters = (l.total - meta) / l.spc
+		need := (uint64(l.clusters+2)*uint64(l.typ) + 8*512 - 1) / (8 * 512)
+		if uint32(need) <= l.fatSecs {
+			return l.clusters > 0
+		}
+		l.fatSecs = uint32(need)
+	}
+}
+
+// Format creates an empty FAT filesystem on the whole device.
+func Format(dev drivers.BlockDevice, config *FormatConfig) error {
+	if config == nil {
+		config = &FormatConfig{}
+	}
+	size := dev.Size() / 512
+	if size > 0xFFFFFFFF {
+		size = 0xFFFFFFFF
+	}
+	l := layout{total: uint32(size), fats: uint32(config.FATs)}
+	if l.fats == 0 {
+		l.fats = 2
+	}
+	rootEntries := config.RootEntries
+	if rootEntries == 0 {
+		rootEntries = 512
+	}
+	l.rootSecs = uint32(rootEntries*dirEntrySize+511) / 512
+
+	l.typ = config.Type
+	if l.typ == 0 {
+		l.typ = FAT16
+		if dev.Size() >= 512*1024*1024 {
+			l.typ = FAT32
+		}
+	}
+	spc := []uint32{uint32(config.SectorsPerCluster)}
+	if spc[0] == 0 {
+		spc = []uint32{1, 2, 4, 8, 16, 32, 64, 128}
+		if l.typ == FAT32 && config.Type == 0 {
+			spc = spc[3:]
+		}
+	}
+	found := false
+	for _, l.spc = range spc {
+		if !l.compute() {
+			continue
+		}
+		t := typeFor(l.clusters)
+		if config.Type == 0 && l.typ != FAT32 && t != FAT32 {
+			if t != l.typ {
+				// the FAT entry size changes the number of clusters
+				l.typ = t
+				if !l.compute() || typeFor(l.clusters) != t {
+					continue
+				}
+			}
+			found = true
+			break
+		}
+		if t == l.typ {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrTooSmall
+	}
+
+	fs := &FS{}
+	fs.cache.init(dev, int(l.fats)+1)
+	le := binary.LittleEndian
+
+	// boot sector
+	var bs [512]byte
+	copy(bs[0:], "\xEB\x3C\x90TINYGO  ")
+	le.PutUint16(bs[0x0B:], 512)
+	bs[0x0D] = byte(l.spc)
+	le.PutUint16(bs[0x0E:], uint16(l.reserved))
+	bs[0x10] = byte(l.fats)
+	bs[0x15] = 0xF8
+	le.PutUint16(bs[0x18:], 63)
+	le.PutUint16(bs[0x1A:], 255)
+	if l.typ != FAT32 && l.total < 0x10000 {
+		le.PutUint16(bs[0x13:], uint16(l.total))
+	} else {
+		le.PutUint32(bs[0x20:], l.total)
+	}
+	label := []byte("NO NAME    ")
+	if config.Label != "" {
+		label = []byte(strings.ToUpper(config.Label) + "           ")[:11]
+	}
+	ext := bs[0x24:]
+	if l.typ == FAT32 {
+		bs[1] = 0x58
+		le.PutUint32(bs[0x24:], l.fatSecs)
+		le.PutUint32(bs[0x2C:], 2)
+		le.PutUint16(bs[0x30:], 1)
+		le.PutUint16(bs[0x32:], 6)
+		ext = bs[0x40:]
+		copy(ext[0x12:], "FAT32   ")
+	} else {
+		le.PutUint16(bs[0x11:], uint16(l.rootSecs*512/dirEntrySize))
+		le.PutUint16(bs[0x16:], uint16(l.fatSecs))
+		if l.typ == FAT12 {
+			copy(ext[0x12:], "FAT12   ")
+		} else {
+			copy(ext[0x12:], "FAT16   ")
+		}
+	}
+	ext[0] = 0x80
+	ext[2] = 0x29
+	le.PutUint32(ext[3:], config.VolumeID)
+	copy(ext[7:], label)
+	bs[510], bs[511] = 0x55, 0xAA
+
+	if err := fs.cache.zero(0, int64(l.reserved)*512); err != nil {
+		return err
+	}
+	if err := fs.cache.write(0, bs[:]); err != nil {
+		return err
+	}
+	if l.typ == FAT32 {
+		var info [512]byte
+		le.PutUint32(info[0:], 0x41615252)
+		le.PutUint32(info[484:], 0x61417272)
+		le.PutUint32(info[488:], l.clusters-1)
+		le.PutUint32(info[492:], 3)
+		le.PutUint32(info[508:], 0xAA550000)
+		for _, sector := range []int64{1, 7} {
+			if err := fs.cache.write(sector*512, info[:]); err != nil {
+				return err
+			}
+		}
+		if err := fs.cache.write(6*512, bs[:]); err != nil {
+			return err
+		}
+	}
+
+	// FATs with the reserved entries, and the FAT32 root directory
+	var start []byte
+	switch l.typ {
+	case FAT12:
+		start = []byte{0xF8, 0xFF, 0xFF}
+	case FAT16:
+		start = []byte{0xF8, 0xFF, 0xFF, 0xFF}
+	default:
+		start = []byte{0xF8, 0xFF, 0xFF, 0x0F, 0xFF, 0xFF, 0xFF, 0x0F, 0xFF, 0xFF, 0xFF, 0x0F}
+	}
+	for i := uint32(0); i < l.fats; i++ {
+		off := int64(l.reserved+i*l.fatSecs) * 512
+		if err := fs.cache.zero(off, int64(l.fatSecs)*512); err != nil {
+			return err
+		}
+		if err := fs.cache.write(off, start); err != nil {
+			return err
+		}
+	}
+
+	root := int64(l.reserved+l.fats*l.fatSecs) * 512
+	rootSize := int64(l.rootSecs) * 512
+	if l.typ == FAT32 {
+		rootSize = int64(l.spc) * 512
+	}
+	if err := fs.cache.zero(root, rootSize); err != nil {
+		return err
+	}
+	if config.Label != "" {
+		var vol [dirEntrySize]byte
+		copy(vol[:11], label)
+		vol[11] = attrVolumeID
+		if err := fs.cache.write(root, vol[:]); err != nil {
+			return err
+		}
+	}
+	return fs.cache.flush()
+}
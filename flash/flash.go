@@ -19,6 +19,9 @@ const (
 type Device struct {
 	trans transport
 	attrs Attrs
+
+	timeout   time.Duration // maximum duration of the operation in progress
+	suspended bool          // an erase or program is suspended
 }
 
 // DeviceConfig contains the parameters that can be set when configuring a
@@ -83,6 +86,18 @@ type Attrs struct {
 	// Enable bit is in the first byte and the Read Status Register 2 command
 	// (0x35) is unsupported.
 	SingleStatusByte bool
+
+	// Erase commands supported by the chip, smallest first, as discovered
+	// through SFDP. Unused entries have a zero Size.
+	EraseTypes [4]EraseType
+
+	// Commands to suspend and resume an erase or program in progress, zero if
+	// unsupported.
+	SuspendOpcode, ResumeOpcode byte
+
+	// Addresses are sent as 4 bytes, for chips of more than 16MiB that
+	// don't support 3 byte addresses.
+	FourByteAddress bool
 }
 
 // Configure sets up the device and the underlying transport mechanism.  The
@@ -106,6 +121,26 @@ func (dev *Device) Configure(config *DeviceConfig) (err error) {
 		dev.attrs = Attrs{JedecID: id}
 	}
 
+	// fall back to the parameters the chip describes itself, and complete the
+	// ones of known chips with the erase and suspend commands
+	if sfdp, err := ParseSFDP(dev.ReadSFDP); err == nil {
+		attrs := sfdp.Attrs(id)
+		if dev.attrs.TotalSize == 0 {
+			dev.attrs = attrs
+		}
+		if dev.attrs.EraseTypes[0].Size == 0 {
+			dev.attrs.EraseTypes = attrs.EraseTypes
+		}
+		if dev.attrs.SuspendOpcode == 0 {
+			dev.attrs.SuspendOpcode = attrs.SuspendOpcode
+			dev.attrs.ResumeOpcode = attrs.ResumeOpcode
+		}
+	}
+
+	if err := dev.trans.setFourByteAddress(dev.attrs.FourByteAddress); err != nil {
+		return err
+	}
+
 	// We don't know what state the flash is in so wait for any remaining
 	// writes and then reset.
 
@@ -173,10 +208,7 @@ func (dev *Device) Configure(config *DeviceConfig) (err error) {
 
 	// disable sector protection if the chip has it
 	if dev.attrs.HasSectorProtection {
-		if err := dev.WriteEnable(); err != nil {
-			return err
-		}
-		if err := dev.trans.writeCommand(cmdWriteStatus, []byte{0x00}); err != nil {
+		if err := dev.Unprotect(); err != nil {
 			return err
 		}
 	}
@@ -243,6 +275,9 @@ func (dev *Device) ReadAt(buf []byte, addr int64) (int, error) {
 // one page at a time, starting at the provided address. This method assumes
 // that the destination is already erased.
 func (dev *Device) WriteAt(buf []byte, addr int64) (n int, err error) {
+	if dev.suspended {
+		return 0, ErrSuspended
+	}
 	remain := uint32(len(buf))
 	idx := uint32(0)
 	loc := uint32(addr)
@@ -287,51 +322,244 @@ func (dev *Device) EraseBlockSize() int64 {
 // transparently coalesce ranges of blocks into larger bundles if the chip
 // supports this. The start and len parameters are in block numbers, use
 // EraseBlockSize to map addresses to blocks.
+//
+// Each part of the range is erased with the largest aligned erase command
+// that fits, and the whole chip at once if the range covers it. This method
+// returns after the last erase command is started, not when it completes.
 func (dev *Device) EraseBlocks(start, len int64) error {
-	// TODO: maybe combine sector erase operations into block erase operations
-	for i := start; i < start+len; i++ {
-		if err := dev.EraseSector(uint32(i)); err != nil {
+	if start < 0 || len < 0 || len > dev.Size()/SectorSize-start {
+		return ErrInvalidAddrRange
+	}
+	addr := uint32(start) * SectorSize
+	end := uint32(start+len) * SectorSize
+	if addr == 0 && end == dev.attrs.TotalSize {
+		return dev.EraseAll()
+	}
+
+	types := dev.attrs.EraseTypes
+	if types[0].Size == 0 {
+		types = defaultEraseTypes
+	}
+	for addr < end {
+		var et EraseType
+		for _, t := range types {
+			if t.Size > et.Size && addr%t.Size == 0 && end-addr >= t.Size {
+				et = t
+			}
+		}
+		if et.Size == 0 {
+			return ErrInvalidAddrRange
+		}
+		if err := dev.erase(et.Opcode, addr, et.Size); err != nil {
 			return err
 		}
+		addr += et.Size
 	}
 	return nil
 }
 
+// defaultEraseTypes are the erase commands of chips that don't describe
+// theirs.
+var defaultEraseTypes = [4]EraseType{
+	{Size: SectorSize, Opcode: cmdEraseSector},
+	{Size: 32 * 1024, Opcode: cmdEraseBlock32},
+	{Size: BlockSize, Opcode: cmdEraseBlock},
+}
+
 func (dev *Device) WriteEnable() error {
 	return dev.trans.runCommand(cmdWriteEnable)
 }
 
 // EraseBlock erases a block of memory at the specified index
 func (dev *Device) EraseBlock(blockNumber uint32) error {
-	if err := dev.WaitUntilReady(); err != nil {
+	return dev.erase(cmdEraseBlock, blockNumber*BlockSize, BlockSize)
+}
+
+// EraseSector erases a sector of memory at the given index
+func (dev *Device) EraseSector(sectorNumber uint32) error {
+	return dev.erase(cmdEraseSector, sectorNumber*SectorSize, SectorSize)
+}
+
+// EraseChip erases the entire flash memory chip
+func (dev *Device) EraseAll() error {
+	return dev.erase(cmdEraseChip, 0, dev.attrs.TotalSize)
+}
+
+// erase starts the erase command cmd of size bytes at addr.
+func (dev *Device) erase(cmd byte, addr, size uint32) (err error) {
+	if dev.suspended {
+		return ErrSuspended
+	}
+	if err = dev.WaitUntilReady(); err != nil {
 		return err
 	}
-	if err := dev.WriteEnable(); err != nil {
+	if err = dev.WriteEnable(); err != nil {
 		return err
 	}
-	return dev.trans.eraseCommand(cmdEraseBlock, blockNumber*BlockSize)
+	if cmd == cmdEraseChip {
+		err = dev.trans.runCommand(cmd)
+	} else {
+		err = dev.trans.eraseCommand(cmd, addr)
+	}
+	// chips typically take up to 2s for a 64kB block
+	dev.timeout = time.Second + time.Duration((size+BlockSize-1)/BlockSize)*2*time.Second
+	return err
 }
 
-// EraseSector erases a sector of memory at the given index
-func (dev *Device) EraseSector(sectorNumber uint32) error {
-	if err := dev.WaitUntilReady(); err != nil {
+// Suspend suspends the erase or program in progress, so that other parts of
+// the memory can be read. It returns false if there was nothing to suspend or
+// the chip doesn't support it. The memory being erased or programmed must not
+// be accessed until Resume is called, and other erases and programs fail with
+// ErrSuspended.
+func (dev *Device) Suspend() (bool, error) {
+	if dev.attrs.SuspendOpcode == 0 || dev.suspended {
+		return false, nil
+	}
+	if s, err := dev.ReadStatus(); err != nil || s&0x01 == 0 {
+		return false, err
+	}
+	if err := dev.trans.runCommand(dev.attrs.SuspendOpcode); err != nil {
+		return false, err
+	}
+	dev.suspended = true
+	// suspending takes a few tens of microseconds
+	expire := time.Now().UnixNano() + int64(time.Millisecond)
+	for s, err := dev.ReadStatus(); (s & 0x01) > 0; s, err = dev.ReadStatus() {
+		if err != nil {
+			return true, err
+		}
+		if time.Now().UnixNano() > expire {
+			return true, ErrWaitExpired
+		}
+	}
+	return true, nil
+}
+
+// Resume resumes the erase or program suspended by Suspend.
+func (dev *Device) Resume() error {
+	if !dev.suspended {
+		return nil
+	}
+	if err := dev.trans.runCommand(dev.attrs.ResumeOpcode); err != nil {
 		return err
 	}
-	if err := dev.WriteEnable(); err != nil {
+	dev.suspended = false
+	return nil
+}
+
+// Protect write-protects len bytes of memory starting at start, and removes
+// the protection of the rest. Chips with individually protected sectors
+// (HasSectorProtection) accept any range aligned to SectorSize. Other chips
+// use the block protect bits of the status register, which can only protect
+// 1/64th of the memory (but at least one 64kB block) times a power of two,
+// either at the top or at the bottom of the memory.
+func (dev *Device) Protect(start, len int64) error {
+	if len == 0 {
+		return dev.Unprotect()
+	}
+	size := int64(dev.attrs.TotalSize)
+	if start < 0 || len < 0 || start+len > size {
+		return ErrInvalidAddrRange
+	}
+
+	if dev.attrs.HasSectorProtection {
+		if start%SectorSize != 0 || len%SectorSize != 0 {
+			return ErrInvalidAddrRange
+		}
+		if err := dev.Unprotect(); err != nil {
+			return err
+		}
+		for addr := start; addr < start+len; addr += SectorSize {
+			if err := dev.WaitUntilReady(); err != nil {
+				return err
+			}
+			if err := dev.WriteEnable(); err != nil {
+				return err
+			}
+			if err := dev.trans.eraseCommand(cmdProtectSector, uint32(addr)); err != nil {
+				return err
+			}
+		}
+		return dev.WaitUntilReady()
+	}
+
+	// BP2..0 of n protects 1<<(n-1) units, 7 protects everything
+	var bp byte
+	unit := size >> 6
+	if unit < BlockSize {
+		unit = BlockSize
+	}
+	for n, l := byte(1), unit; n < 7 && l < size; n, l = n+1, l<<1 {
+		if l == len {
+			bp = n
+		}
+	}
+	if len == size {
+		bp = 7
+	}
+	if bp == 0 {
+		return ErrInvalidAddrRange
+	}
+	var tb byte
+	switch {
+	case start+len == size:
+	case start == 0 && !dev.attrs.SingleStatusByte:
+		tb = statusTopBottom
+	default:
+		return ErrInvalidAddrRange
+	}
+	status, err := dev.ReadStatus()
+	if err != nil {
 		return err
 	}
-	return dev.trans.eraseCommand(cmdEraseSector, sectorNumber*SectorSize)
+	return dev.writeStatus(status&^dev.protectBits() | bp<<2 | tb)
 }
 
-// EraseChip erases the entire flash memory chip
-func (dev *Device) EraseAll() error {
+// Unprotect removes the write protection of the whole memory.
+func (dev *Device) Unprotect() error {
+	if dev.attrs.HasSectorProtection {
+		// global unprotect
+		return dev.writeStatus(0x00)
+	}
+	status, err := dev.ReadStatus()
+	if err != nil {
+		return err
+	}
+	return dev.writeStatus(status &^ dev.protectBits())
+}
+
+// protectBits returns the bits of status register 1 controlling the
+// protected area. The quad enable bit of single byte status registers takes
+// the place of the sector/block bit.
+func (dev *Device) protectBits() byte {
+	if dev.attrs.SingleStatusByte {
+		return 0x3C // BP3..0
+	}
+	return 0x7C // SEC, TB, BP2..0
+}
+
+// writeStatus writes status register 1, preserving status register 2.
+func (dev *Device) writeStatus(status byte) error {
+	buf := []byte{status, 0x00}
+	if !dev.attrs.WriteStatusSplit && !dev.attrs.SingleStatusByte && !dev.attrs.HasSectorProtection {
+		// status register 2, holding the quad enable bit, is written too
+		var err error
+		if buf[1], err = dev.ReadStatus2(); err != nil {
+			return err
+		}
+	} else {
+		buf = buf[:1]
+	}
 	if err := dev.WaitUntilReady(); err != nil {
 		return err
 	}
 	if err := dev.WriteEnable(); err != nil {
 		return err
 	}
-	return dev.trans.runCommand(cmdEraseChip)
+	if err := dev.trans.writeCommand(cmdWriteStatus, buf); err != nil {
+		return err
+	}
+	return dev.WaitUntilReady()
 }
 
 // ReadStatus reads the value from status register 1 of the device
@@ -351,8 +579,19 @@ func (dev *Device) ReadStatus2() (status byte, err error) {
 // WaitUntilReady queries the status register until the device is ready for the
 // next operation.
 func (dev *Device) WaitUntilReady() error {
-	expire := time.Now().UnixNano() + int64(1*time.Second)
-	for s, err := dev.ReadStatus(); (s & 0x03) > 0; s, err = dev.ReadStatus() {
+	timeout := 1 * time.Second
+	if dev.timeout > timeout {
+		timeout = dev.timeout
+	}
+	busy := byte(0x03)
+	if dev.suspended {
+		// the write enable latch stays set during the suspended operation
+		busy = 0x01
+	} else {
+		dev.timeout = 0
+	}
+	expire := time.Now().UnixNano() + int64(timeout)
+	for s, err := dev.ReadStatus(); (s & busy) > 0; s, err = dev.ReadStatus() {
 		if err != nil {
 			return err
 		}
@@ -378,8 +617,12 @@ const (
 	cmdWriteEnable     = 0x06 // write-enable memory
 	cmdWriteDisable    = 0x04 // write-protect memory
 	cmdEraseSector     = 0x20 // erase a sector of memory
+	cmdEraseBlock32    = 0x52 // erase a 32kB block of memory
 	cmdEraseBlock      = 0xD8 // erase a block of memory
 	cmdEraseChip       = 0xC7 // erase the entire chip
+	cmdProtectSector   = 0x36 // protect a sector, with individual sector protection
+
+	statusTopBottom = 0x20 // TB bit of status register 1: protect from the bottom
 )
 
 type Error uint8
@@ -389,6 +632,10 @@ const (
 	ErrInvalidClockSpeed Error = iota
 	ErrInvalidAddrRange
 	ErrWaitExpired
+	ErrNoSFDP
+	ErrVerifyFailed
+	ErrAddressSize
+	ErrSuspended
 )
 
 func (err Error) Error() string {
@@ -399,6 +646,14 @@ func (err Error) Error() string {
 		return "flash: invalid address range"
 	case ErrWaitExpired:
 		return "flash: wait until ready expired"
+	case ErrNoSFDP:
+		return "flash: no SFDP basic flash parameter table"
+	case ErrVerifyFailed:
+		return "flash: verify failed"
+	case ErrAddressSize:
+		return "flash: 4 byte addresses not supported by the transport"
+	case ErrSuspended:
+		return "flash: erase or program suspended"
 	default:
 		return "flash: unspecified error"
 	}
@@ -0,0 +1,104 @@
+package flash
+
+import "testing"
+
+// fakeTransport records the commands sent to a chip that finishes erases
+// and programs instantly, unless busy is set.
+type fakeTransport struct {
+	busy   bool
+	erases []uint32
+	writes []uint32
+}
+
+func (tr *fakeTransport) configure(config *DeviceConfig)  {}
+func (tr *fakeTransport) supportQuadMode() bool           { return false }
+func (tr *fakeTransport) setClockSpeed(hz uint32) error   { return nil }
+func (tr *fakeTransport) setFourByteAddress(bool) error   { return nil }
+func (tr *fakeTransport) writeCommand(byte, []byte) error { return nil }
+func (tr *fakeTransport) readMemory(uint32, []byte) error { return nil }
+func (tr *fakeTransport) readSFDP(uint32, []byte) error   { return nil }
+func (tr *fakeTransport) eraseCommand(cmd byte, addr uint32) error {
+	tr.erases = append(tr.erases, addr)
+	return nil
+}
+
+func (tr *fakeTransport) writeMemory(addr uint32, data []byte) error {
+	tr.writes = append(tr.writes, addr)
+	return nil
+}
+
+func (tr *fakeTransport) runCommand(cmd byte) error {
+	if cmd == 0x75 {
+		tr.busy = false
+	}
+	return nil
+}
+
+func (tr *fakeTransport) readCommand(cmd byte, rsp []byte) error {
+	rsp[0] = 0
+	if cmd == cmdReadStatus && tr.busy {
+		rsp[0] = 0x03
+	}
+	return nil
+}
+
+func newFakeDevice() (*Device, *fakeTransport) {
+	tr := &fakeTransport{}
+	dev := &Device{
+		trans: tr,
+		attrs: Attrs{TotalSize: 1 << 20, SuspendOpcode: 0x75, ResumeOpcode: 0x7A},
+	}
+	return dev, tr
+}
+
+func TestEraseBlocksRange(t *testing.T) {
+	dev, tr := newFakeDevice()
+	blocks := dev.Size() / dev.EraseBlockSize()
+	for _, r := range [][2]int64{{-1, 1}, {0, -1}, {blocks, 1}, {blocks - 1, 2}, {1 << 52, 1 << 52}, {1 << 62, 1 << 62}} {
+		if err := dev.EraseBlocks(r[0], r[1]); err != ErrInvalidAddrRange {
+			t.Errorf("EraseBlocks(%d, %d): got %v, want %v", r[0], r[1], err, ErrInvalidAddrRange)
+		}
+	}
+	if len(tr.erases) != 0 {
+		t.Errorf("erased %#x", tr.erases)
+	}
+	if err := dev.EraseBlocks(blocks-1, 1); err != nil {
+		t.Errorf("last block: %v", err)
+	}
+	if len(tr.erases) != 1 || tr.erases[0] != uint32(dev.Size()-SectorSize) {
+		t.Errorf("erased %#x", tr.erases)
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	dev, tr := newFakeDevice()
+	if err := dev.EraseBlocks(0, 16); err != nil {
+		t.Fatal(err)
+	}
+	tr.busy = true
+	if ok, err := dev.Suspend(); !ok || err != nil {
+		t.Fatalf("suspend: %v, %v", ok, err)
+	}
+	if err := dev.EraseBlocks(16, 1); err != ErrSuspended {
+		t.Errorf("erase while suspended: got %v, want %v", err, ErrSuspended)
+	}
+	if err := dev.EraseSector(16); err != ErrSuspended {
+		t.Errorf("sector erase while suspended: got %v, want %v", err, ErrSuspended)
+	}
+	if _, err := dev.WriteAt([]byte{1}, 0x20000); err != ErrSuspended {
+		t.Errorf("write while suspended: got %v, want %v", err, ErrSuspended)
+	}
+	if len(tr.erases) != 1 || len(tr.writes) != 0 {
+		t.Errorf("erased %#x, wrote %#x while suspended", tr.erases, tr.writes)
+	}
+
+	if err := dev.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.EraseBlocks(16, 1); err != nil {
+		t.Errorf("erase after resume: %v", err)
+	}
+	if _, err := dev.WriteAt([]byte{1}, 0x20000); err != nil {
+		t.Errorf("write after resume: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package flashemu provides an in-memory emulator of a NOR flash chip.
+//
+// The emulator implements the same block device methods as flash.Device, so
+// that filesystems, logs and other code built on flash can be run and tested
+// on a development machine. It follows the rules of real NOR flash: a write
+// can only clear bits, an erase sets a whole sector to 0xFF, and a page
+// program that runs past the end of a page wraps around to the start of the
+// same page. It can also count erase cycles per sector and simulate a power
+// loss in the middle of a chosen program or erase operation:
+//
+//	dev := flashemu.New(1024*1024, 256, 4096)
+//	dev.PowerLossAt(10) // the 10th program or erase is torn
+//	err := runWorkload(dev) // fails with flashemu.ErrPowerLoss
+//	dev.PowerOn()
+//	checkRecovery(dev)
+package flashemu // import "tinygo.org/x/drivers/flash/flashemu"
+
+import (
+	"errors"
+)
+
+var (
+	ErrOutOfRange = errors.New("flashemu: address out of range")
+	ErrNotErased  = errors.New("flashemu: write to bits that are not erased")
+	ErrWornOut    = errors.New("flashemu: sector exceeded its erase endurance")
+	ErrPowerLoss  = errors.New("flashemu: power lost")
+)
+
+// Op identifies the kind of operation reported to a Device's Trace hook.
+type Op uint8
+
+const (
+	OpRead Op = iota
+	OpProgram
+	OpErase
+)
+
+// Device is an emulated NOR flash chip.
+type Device struct {
+	// Strict makes WriteAt fail with ErrNotErased instead of silently
+	// AND-ing the data into memory when it would have to set a bit that is
+	// currently 0. This catches missing erases, but must be off to test code
+	// that deliberately overwrites data, for example to clear flag bits.
+	Strict bool
+
+	// Endurance is the number of erase cycles after which a sector fails to
+	// erase with ErrWornOut. Zero means unlimited.
+	Endurance uint32
+
+	// Trace, if set, is called for every read, page program and sector
+	// erase with its address and length in bytes.
+	Trace func(op Op, addr int64, length int)
+
+	mem        []byte
+	pageSize   int64
+	sectorSize int64
+	erases     []uint32
+
+	reads    uint64
+	programs uint64
+	erasures uint64
+
+	// power loss injection: the operation with this number (counted in
+	// programs+erasures) is torn, after which the device is off
+	failAt uint64
+	off    bool
+}
+
+// New returns an erased device of size bytes, with the given page (write
+// block) and sector (erase block) sizes. Typical SPI NOR flash uses 256 byte
+// pages and 4096 byte sectors. The size must be a multiple of the sector
+// size, which must be a multiple of the page size.
+func New(size, pageSize, sectorSize int64) *Device {
+	if pageSize <= 0 || sectorSize%pageSize != 0 || size%sectorSize != 0 {
+		panic("flashemu: invalid geometry")
+	}
+	dev := &Device{
+		mem:        make([]byte, size),
+		pageSize:   pageSize,
+		sectorSize: sectorSize,
+		erases:     make([]uint32, size/sectorSize),
+	}
+	for i := range dev.mem {
+		dev.mem[i] = 0xFF
+	}
+	return dev
+}
+
+// Size returns the size of the memory in bytes.
+func (dev *Device) Size() int64 {
+	return int64(len(dev.mem))
+}
+
+// WriteBlockSize returns the page size.
+func (dev *Device) WriteBlockSize() int64 {
+	return dev.pageSize
+}
+
+// EraseBlockSize returns the sector size.
+func (dev *Device) EraseBlockSize() int64 {
+	return dev.sectorSize
+}
+
+// ReadAt satisfies the io.ReaderAt interface.
+func (dev *Device) ReadAt(buf []byte, addr int64) (int, error) {
+	if dev.off {
+		return 0, ErrPowerLoss
+	}
+	if addr < 0 || addr+int64(len(buf)) > dev.Size() {
+		return 0, ErrOutOfRange
+	}
+	dev.reads++
+	if dev.Trace != nil {
+		dev.Trace(OpRead, addr, len(buf))
+	}
+	return copy(buf, dev.mem[addr:]), nil
+}
+
+// WriteAt satisfies the io.WriterAt interface and writes data one page at a
+// time, the same way flash.Device does. Like on real flash, each byte is
+// AND-ed into the current content, so the destination should be erased.
+func (dev *Device) WriteAt(buf []byte, addr int64) (n int, err error) {
+	if addr < 0 || addr+int64(len(buf)) > dev.Size() {
+		return 0, ErrOutOfRange
+	}
+	for n < len(buf) {
+		loc := addr + int64(n)
+		toWrite := dev.pageSize - loc%dev.pageSize
+		if remain := int64(len(buf) - n); remain < toWrite {
+			toWrite = remain
+		}
+		if err = dev.ProgramPage(loc, buf[n:n+int(toWrite)]); err != nil {
+			return n, err
+		}
+		n += int(toWrite)
+	}
+	return n, nil
+}
+
+// ProgramPage emulates a single page program command. Data that runs past
+// the end of the page containing addr wraps around to the beginning of that
+// page, and only the last page size bytes of data are written, as on real
+// chips.
+func (dev *Device) ProgramPage(addr int64, data []byte) error {
+	if dev.off {
+		return ErrPowerLoss
+	}
+	if addr < 0 || addr >= dev.Size() {
+		return ErrOutOfRange
+	}
+	if int64(len(data)) > dev.pageSize {
+		data = data[int64(len(data))-dev.pageSize:]
+	}
+	page := addr - addr%dev.pageSize
+	offset := addr - page
+	if dev.Strict {
+		for i, b := range data {
+			a := page + (offset+int64(i))%dev.pageSize
+			if b&^dev.mem[a] != 0 {
+				return ErrNotErased
+			}
+		}
+	}
+	if dev.Trace != nil {
+		dev.Trace(OpProgram, addr, len(data))
+	}
+	n := len(data)
+	torn := dev.tick()
+	if torn {
+		// only the first half of the data makes it into the array
+		n /= 2
+	}
+	for i, b := range data[:n] {
+		dev.mem[page+(offset+int64(i))%dev.pageSize] &= b
+	}
+	dev.programs++
+	if torn {
+		return ErrPowerLoss
+	}
+	return nil
+}
+
+// EraseBlocks erases len sectors starting at sector start.
+func (dev *Device) EraseBlocks(start, len int64) error {
+	for i := start; i < start+len; i++ {
+		if err := dev.EraseSector(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EraseSector sets all bytes of the given sector to 0xFF.
+func (dev *Device) EraseSector(sector int64) error {
+	if dev.off {
+		return ErrPowerLoss
+	}
+	if sector < 0 || sector >= int64(len(dev.erases)) {
+		return ErrOutOfRange
+	}
+	if dev.Endurance > 0 && dev.erases[sector] >= dev.Endurance {
+		return ErrWornOut
+	}
+	addr := sector * dev.sectorSize
+	if dev.Trace != nil {
+		dev.Trace(OpErase, addr, int(dev.sectorSize))
+	}
+	end := addr + dev.sectorSize
+	torn := dev.tick()
+	if torn {
+		// an interrupted erase leaves the sector partially erased
+		end = addr + dev.sectorSize/2
+	}
+	for i := addr; i < end; i++ {
+		dev.mem[i] = 0xFF
+	}
+	dev.erases[sector]++
+	dev.erasures++
+	if torn {
+		return ErrPowerLoss
+	}
+	return nil
+}
+
+// EraseAll erases the whole chip.
+func (dev *Device) EraseAll() error {
+	return dev.EraseBlocks(0, int64(len(dev.erases)))
+}
+
+// PowerLossAt arranges for the n-th following program or erase operation,
+// counting from 1, to be interrupted by a power loss: a page program only
+// writes the first half of its data and a sector erase only erases the
+// first half of the sector. The operation and all following accesses fail
+// with ErrPowerLoss until PowerOn is called. Zero disables the injection.
+func (dev *Device) PowerLossAt(n uint64) {
+	if n == 0 {
+		dev.failAt = 0
+		return
+	}
+	dev.failAt = dev.programs + dev.erasures + n
+}
+
+// PowerOn restores power after a simulated power loss. The memory content
+// is preserved.
+func (dev *Device) PowerOn() {
+	dev.off = false
+	dev.failAt = 0
+}
+
+// PoweredOff reports whether a simulated power loss has occurred.
+func (dev *Device) PoweredOff() bool {
+	return dev.off
+}
+
+// tick is called before each program or erase and reports whether that
+// operation should be torn.
+func (dev *Device) tick() bool {
+	if dev.failAt != 0 && dev.programs+dev.erasures+1 == dev.failAt {
+		dev.off = true
+		dev.failAt = 0
+		return true
+	}
+	return false
+}
+
+// EraseCount returns the number of times the given sector was erased.
+func (dev *Device) EraseCount(sector int64) uint32 {
+	return dev.erases[sector]
+}
+
+// EraseCounts returns the erase counters of all sectors. The slice is owned
+// by the device.
+func (dev *Device) EraseCounts() []uint32 {
+	return dev.erases
+}
+
+// Stats returns the number of reads, page programs and sector erases
+// performed so far.
+func (dev *Device) Stats() (reads, programs, erases uint64) {
+	return dev.reads, dev.programs, dev.erasures
+}
+
+// Bytes returns the memory array of the device, for inspection or to
+// preload an image. The slice is owned by the device.
+func (dev *Device) Bytes() []byte {
+	return dev.mem
+}
@@ -0,0 +1,604 @@
+// Package kvstore implements a small key/value store for NOR flash memory,
+// such as flash.Device, intended for configuration data like calibration
+// values and wifi credentials.
+//
+// The store is a log: every Set or Delete appends a CRC protected record to
+// the current sector, and the newest record of a key wins. The sectors of
+// the store are used as a ring. When the last free sector is taken into use,
+// the live records of the oldest sector are copied forward and the oldest
+// sector is erased, so that all sectors are erased equally often and at
+// least one sector is always free.
+//
+// Updates are atomic: if power is lost at any point, the store mounts with
+// either the old or the new value of the key that was being written, and
+// all other keys unchanged.
+//
+//	store := kvstore.New(dev, 0, 4) // the first four erase blocks
+//	if err := store.Mount(); err != nil {
+//		return err
+//	}
+//	store.Set("ssid", []byte("tinygo"))
+//	n, err := store.Get("ssid", buf)
+package kvstore // import "tinygo.org/x/drivers/flash/kvstore"
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"tinygo.org/x/drivers"
+)
+
+// MaxKeyLen is the maximum length of a key in bytes.
+const MaxKeyLen = 64
+
+var (
+	ErrNotFound       = errors.New("kvstore: key not found")
+	ErrInvalidKey     = errors.New("kvstore: invalid key length")
+	ErrValueTooLarge  = errors.New("kvstore: value too large")
+	ErrNoSpace        = errors.New("kvstore: no space left")
+	ErrTooFewSectors  = errors.New("kvstore: at least two sectors required")
+	ErrNotMounted     = errors.New("kvstore: not mounted")
+	ErrInvalidSectors = errors.New("kvstore: sectors out of range")
+)
+
+// Every sector in use starts with a header:
+//
+//	magic  uint32
+//	seq    uint32 // position of the sector in the log
+//	crc    uint32 // of magic and seq
+//	state  uint32 // 0xFFFFFFFF while in use, cleared before erasing
+//
+// followed by records, each aligned to 4 bytes:
+//
+//	crc    uint32 // of the rest of the header, key and value
+//	keyLen uint8
+//	flags  uint8
+//	valLen uint16
+//	key    [keyLen]byte
+//	value  [valLen]byte
+//
+// All integers are little endian.
+const (
+	sectorMagic      = 0x0153564B // "KVS\x01"
+	sectorHeaderSize = 16
+	stateOffset      = 12
+	recordHeaderSize = 8
+	flagDeleted      = 0x01
+)
+
+// Store is a key/value store on a range of erase blocks of a device.
+type Store struct {
+	dev        drivers.BlockDevice
+	first      int64
+	count      int64
+	sectorSize int64
+
+	seqs []uint32 // sequence number of every sector in the log
+	ends []int64  // offset after the last valid record of every sector
+
+	head    int64 // sector that records are appended to
+	tail    int64 // oldest sector of the log
+	used    int64 // number of sectors in the log
+	pos     int64 // write offset in the head sector
+	mounted bool
+
+	hdrbuf  [recordHeaderSize + MaxKeyLen]byte
+	copybuf [32]byte
+}
+
+// record is the location and header of a record.
+type record struct {
+	sector int64
+	off    int64
+	keyLen int
+	flags  byte
+	valLen int
+}
+
+func (r *record) size() int64 {
+	return align(int64(recordHeaderSize + r.keyLen + r.valLen))
+}
+
+func align(n int64) int64 {
+	return (n + 3) &^ 3
+}
+
+// New returns a store on count erase blocks of dev, starting at erase block
+// first. Mount must be called before using it.
+func New(dev drivers.BlockDevice, first, count int64) *Store {
+	return &Store{
+		dev:        dev,
+		first:      first,
+		count:      count,
+		sectorSize: dev.EraseBlockSize(),
+	}
+}
+
+// Mount reads the state of the store from the device, recovering from an
+// interrupted update if necessary. An empty or unformatted memory range is
+// initialized as an empty store.
+func (s *Store) Mount() error {
+	s.mounted = false
+	if s.count < 2 {
+		return ErrTooFewSectors
+	}
+	if s.first < 0 {
+		return ErrInvalidSectors
+	}
+	if s.seqs == nil {
+		s.seqs = make([]uint32, s.count)
+		s.ends = make([]int64, s.count)
+	}
+
+	var hdr [sectorHeaderSize]byte
+	valid := make([]bool, s.count)
+	found := false
+	for i := int64(0); i < s.count; i++ {
+		if _, err := s.dev.ReadAt(hdr[:], s.addr(i, 0)); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(hdr[0:]) != sectorMagic ||
+			binary.LittleEndian.Uint32(hdr[8:]) != crc32.ChecksumIEEE(hdr[:8]) ||
+			binary.LittleEndian.Uint32(hdr[stateOffset:]) != 0xFFFFFFFF {
+			continue
+		}
+		valid[i] = true
+		s.seqs[i] = binary.LittleEndian.Uint32(hdr[4:])
+		if !found || int32(s.seqs[i]-s.seqs[s.head]) > 0 {
+			s.head = i
+		}
+		found = true
+	}
+	if !found {
+		return s.init()
+	}
+
+	// the log consists of the sectors before the head with consecutive
+	// sequence numbers; anything else is free
+	s.tail = s.head
+	s.used = 1
+	for s.used < s.count {
+		prev := (s.tail + s.count - 1) % s.count
+		if !valid[prev] || s.seqs[prev] != s.seqs[s.tail]-1 {
+			break
+		}
+		s.tail = prev
+		s.used++
+	}
+
+	for i, n := s.tail, int64(0); n < s.used; i, n = (i+1)%s.count, n+1 {
+		end, err := s.scan(i)
+		if err != nil {
+			return err
+		}
+		s.ends[i] = end
+	}
+
+	s.pos = s.ends[s.head]
+	blank, err := s.isBlank(s.head, s.pos)
+	if err != nil {
+		return err
+	}
+	if !blank {
+		// an interrupted write left data behind the last valid record, so
+		// the rest of the sector can't be programmed reliably
+		s.pos = s.sectorSize
+	}
+
+	if s.used == s.count {
+		// power was lost while moving the live records out of the oldest
+		// sector: the head only holds copies, so start over
+		if err := s.prepare(s.head, s.seqs[s.head]); err != nil {
+			return err
+		}
+		if err := s.collect(); err != nil {
+			return err
+		}
+	}
+	s.mounted = true
+	return nil
+}
+
+// Format erases all sectors of the store and mounts it empty.
+func (s *Store) Format() error {
+	if s.count < 2 {
+		return ErrTooFewSectors
+	}
+	if err := s.dev.EraseBlocks(s.first, s.count); err != nil {
+		return err
+	}
+	return s.Mount()
+}
+
+// init starts an empty log in the first sector.
+func (s *Store) init() error {
+	if err := s.prepare(0, 1); err != nil {
+		return err
+	}
+	s.head, s.tail, s.used = 0, 0, 1
+	s.mounted = true
+	return nil
+}
+
+// Get reads the value of key into buf and returns the length of the value.
+// If buf is too small, it returns the length of the value and
+// io.ErrShortBuffer.
+func (s *Store) Get(key string, buf []byte) (int, error) {
+	if !s.mounted {
+		return 0, ErrNotMounted
+	}
+	r, ok, err := s.find(key)
+	if err != nil {
+		return 0, err
+	}
+	if !ok || r.flags&flagDeleted != 0 {
+		return 0, ErrNotFound
+	}
+	if len(buf) < r.valLen {
+		return r.valLen, io.ErrShortBuffer
+	}
+	off := r.off + recordHeaderSize + int64(r.keyLen)
+	if _, err := s.dev.ReadAt(buf[:r.valLen], s.addr(r.sector, off)); err != nil {
+		return 0, err
+	}
+	return r.valLen, nil
+}
+
+// Set stores value under key, replacing any previous value. Setting a key
+// to the value it already has does not write to the device. It returns
+// ErrNoSpace if the live records would no longer fit into all but one of the
+// sectors.
+func (s *Store) Set(key string, value []byte) error {
+	if !s.mounted {
+		return ErrNotMounted
+	}
+	if len(key) == 0 || len(key) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+	if len(value) > 0xFFFF || align(int64(recordHeaderSize+len(key)+len(value))) > s.sectorSize-sectorHeaderSize {
+		return ErrValueTooLarge
+	}
+	r, ok, err := s.find(key)
+	if err != nil {
+		return err
+	}
+	if ok && r.flags&flagDeleted == 0 && r.valLen == len(value) {
+		equal, err := s.equal(&r, value)
+		if err != nil || equal {
+			return err
+		}
+	}
+	return s.append(key, 0, value)
+}
+
+// Delete removes key from the store. Deleting a key that does not exist is
+// not an error.
+func (s *Store) Delete(key string) error {
+	if !s.mounted {
+		return ErrNotMounted
+	}
+	if len(key) == 0 || len(key) > MaxKeyLen {
+		return ErrInvalidKey
+	}
+	r, ok, err := s.find(key)
+	if err != nil || !ok || r.flags&flagDeleted != 0 {
+		return err
+	}
+	return s.append(key, flagDeleted, nil)
+}
+
+// Range calls fn for every key in the store with the length of its value,
+// until fn returns false.
+func (s *Store) Range(fn func(key string, size int) bool) error {
+	if !s.mounted {
+		return ErrNotMounted
+	}
+	var keybuf [MaxKeyLen]byte
+	return s.each(func(r *record, key []byte) (bool, error) {
+		if r.flags&flagDeleted != 0 {
+			return true, nil
+		}
+		k := string(copyKey(keybuf[:], key))
+		live, err := s.isLive(r, k)
+		if err != nil || !live {
+			return err == nil, err
+		}
+		return fn(k, r.valLen), nil
+	})
+}
+
+// append writes a new record to the head sector, moving on to the next
+// sector as needed.
+func (s *Store) append(key string, flags byte, value []byte) error {
+	size := align(int64(recordHeaderSize + len(key) + len(value)))
+	for tries := int64(0); s.pos+size > s.sectorSize; tries++ {
+		if tries == s.count {
+			return ErrNoSpace
+		}
+		if err := s.advance(); err != nil {
+			// the log may be in an intermediate state that only Mount
+			// knows how to recover from
+			s.mounted = false
+			return err
+		}
+	}
+
+	hdr := s.hdrbuf[:recordHeaderSize+len(key)]
+	hdr[4] = byte(len(key))
+	hdr[5] = flags
+	binary.LittleEndian.PutUint16(hdr[6:], uint16(len(value)))
+	copy(hdr[recordHeaderSize:], key)
+	crc := crc32.Update(crc32.ChecksumIEEE(hdr[4:]), crc32.IEEETable, value)
+	binary.LittleEndian.PutUint32(hdr[0:], crc)
+
+	return s.write(hdr, value, size)
+}
+
+// write programs a record at the write position. The header, which contains
+// the CRC, is written first so that a record is only valid once complete.
+func (s *Store) write(hdr, value []byte, size int64) error {
+	pos := s.pos
+	// if anything goes wrong, don't try to program this sector again
+	s.pos = s.sectorSize
+	if _, err := s.dev.WriteAt(hdr, s.addr(s.head, pos)); err != nil {
+		return err
+	}
+	if len(value) > 0 {
+		if _, err := s.dev.WriteAt(value, s.addr(s.head, pos+int64(len(hdr)))); err != nil {
+			return err
+		}
+	}
+	s.pos = pos + size
+	s.ends[s.head] = s.pos
+	return nil
+}
+
+// advance starts a new head sector. If that was the last free sector, the
+// oldest sector is collected.
+func (s *Store) advance() error {
+	next := (s.head + 1) % s.count
+	if err := s.prepare(next, s.seqs[s.head]+1); err != nil {
+		return err
+	}
+	s.head = next
+	s.used++
+	if s.used == s.count {
+		return s.collect()
+	}
+	return nil
+}
+
+// prepare erases sector i if necessary and writes its header.
+func (s *Store) prepare(i int64, seq uint32) error {
+	blank, err := s.isBlank(i, 0)
+	if err != nil {
+		return err
+	}
+	if !blank {
+		if err := s.dev.EraseBlocks(s.first+i, 1); err != nil {
+			return err
+		}
+	}
+	var hdr [stateOffset]byte
+	binary.LittleEndian.PutUint32(hdr[0:], sectorMagic)
+	binary.LittleEndian.PutUint32(hdr[4:], seq)
+	binary.LittleEndian.PutUint32(hdr[8:], crc32.ChecksumIEEE(hdr[:8]))
+	if _, err := s.dev.WriteAt(hdr[:], s.addr(i, 0)); err != nil {
+		return err
+	}
+	s.seqs[i] = seq
+	s.ends[i] = sectorHeaderSize
+	s.pos = sectorHeaderSize
+	return nil
+}
+
+// collect copies the live records of the tail sector to the head sector and
+// erases the tail sector.
+func (s *Store) collect() error {
+	t := s.tail
+	var keybuf [MaxKeyLen]byte
+	err := s.eachIn(t, func(r *record, key []byte) (bool, error) {
+		if r.flags&flagDeleted != 0 {
+			// nothing older than the tail can be shadowed by the tombstone
+			return true, nil
+		}
+		live, err := s.isLive(r, string(copyKey(keybuf[:], key)))
+		if err != nil || !live {
+			return err == nil, err
+		}
+		return true, s.copyRecord(r)
+	})
+	if err != nil {
+		return err
+	}
+
+	// invalidate the sector before erasing it, in case the erase is
+	// interrupted
+	var zero [4]byte
+	if _, err := s.dev.WriteAt(zero[:], s.addr(t, stateOffset)); err != nil {
+		return err
+	}
+	if err := s.dev.EraseBlocks(s.first+t, 1); err != nil {
+		return err
+	}
+	s.tail = (t + 1) % s.count
+	s.used--
+	return nil
+}
+
+// copyRecord copies r unchanged to the write position of the head sector.
+func (s *Store) copyRecord(r *record) error {
+	size := r.size()
+	if s.pos+size > s.sectorSize {
+		return ErrNoSpace
+	}
+	pos := s.pos
+	s.pos = s.sectorSize
+	n := int64(recordHeaderSize + r.keyLen + r.valLen)
+	for done := int64(0); done < n; {
+		chunk := s.copybuf[:]
+		if n-done < int64(len(chunk)) {
+			chunk = chunk[:n-done]
+		}
+		if _, err := s.dev.ReadAt(chunk, s.addr(r.sector, r.off+done)); err != nil {
+			return err
+		}
+		if _, err := s.dev.WriteAt(chunk, s.addr(s.head, pos+done)); err != nil {
+			return err
+		}
+		done += int64(len(chunk))
+	}
+	s.pos = pos + size
+	s.ends[s.head] = s.pos
+	return nil
+}
+
+// find returns the newest record of key.
+func (s *Store) find(key string) (found record, ok bool, err error) {
+	err = s.each(func(r *record, k []byte) (bool, error) {
+		if string(k) == key {
+			found, ok = *r, true
+		}
+		return true, nil
+	})
+	return
+}
+
+// isLive reports whether r is the newest record of its key.
+func (s *Store) isLive(r *record, key string) (bool, error) {
+	newest, ok, err := s.find(key)
+	return ok && newest.sector == r.sector && newest.off == r.off, err
+}
+
+// equal reports whether the value of r equals value.
+func (s *Store) equal(r *record, value []byte) (bool, error) {
+	off := r.off + recordHeaderSize + int64(r.keyLen)
+	for len(value) > 0 {
+		chunk := s.copybuf[:]
+		if len(value) < len(chunk) {
+			chunk = chunk[:len(value)]
+		}
+		if _, err := s.dev.ReadAt(chunk, s.addr(r.sector, off)); err != nil {
+			return false, err
+		}
+		if string(chunk) != string(value[:len(chunk)]) {
+			return false, nil
+		}
+		value = value[len(chunk):]
+		off += int64(len(chunk))
+	}
+	return true, nil
+}
+
+// each calls fn for all valid records from the oldest to the newest. The
+// key slice is only valid during the call.
+func (s *Store) each(fn func(r *record, key []byte) (bool, error)) error {
+	for i, n := s.tail, int64(0); n < s.used; i, n = (i+1)%s.count, n+1 {
+		if err := s.eachIn(i, fn); err != nil {
+			if err == errStop {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+var errStop = errors.New("stop")
+
+// eachIn calls fn for all valid records of sector i.
+func (s *Store) eachIn(i int64, fn func(r *record, key []byte) (bool, error)) error {
+	// fn may call find, so each level of iteration needs its own buffer
+	var keybuf [MaxKeyLen]byte
+	var hdr [recordHeaderSize]byte
+	r := record{sector: i}
+	for r.off = sectorHeaderSize; r.off < s.ends[i]; r.off += r.size() {
+		if _, err := s.dev.ReadAt(hdr[:], s.addr(i, r.off)); err != nil {
+			return err
+		}
+		r.keyLen = int(hdr[4])
+		r.flags = hdr[5]
+		r.valLen = int(binary.LittleEndian.Uint16(hdr[6:]))
+		key := keybuf[:r.keyLen]
+		if _, err := s.dev.ReadAt(key, s.addr(i, r.off+recordHeaderSize)); err != nil {
+			return err
+		}
+		more, err := fn(&r, key)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return errStop
+		}
+	}
+	return nil
+}
+
+// scan returns the offset after the last valid record of sector i,
+// checking the CRC of every record.
+func (s *Store) scan(i int64) (int64, error) {
+	var hdr [recordHeaderSize]byte
+	off := int64(sectorHeaderSize)
+	for off+recordHeaderSize <= s.sectorSize {
+		if _, err := s.dev.ReadAt(hdr[:], s.addr(i, off)); err != nil {
+			return 0, err
+		}
+		r := record{
+			keyLen: int(hdr[4]),
+			valLen: int(binary.LittleEndian.Uint16(hdr[6:])),
+		}
+		if r.keyLen == 0 || r.keyLen > MaxKeyLen || off+r.size() > s.sectorSize {
+			// either free space or an incomplete record
+			break
+		}
+		crc := crc32.ChecksumIEEE(hdr[4:])
+		n := int64(r.keyLen + r.valLen)
+		for done := int64(0); done < n; {
+			chunk := s.copybuf[:]
+			if n-done < int64(len(chunk)) {
+				chunk = chunk[:n-done]
+			}
+			if _, err := s.dev.ReadAt(chunk, s.addr(i, off+recordHeaderSize+done)); err != nil {
+				return 0, err
+			}
+			crc = crc32.Update(crc, crc32.IEEETable, chunk)
+			done += int64(len(chunk))
+		}
+		if crc != binary.LittleEndian.Uint32(hdr[0:]) {
+			break
+		}
+		off += r.size()
+	}
+	return off, nil
+}
+
+// isBlank reports whether sector i is erased from offset off onwards.
+func (s *Store) isBlank(i, off int64) (bool, error) {
+	for off < s.sectorSize {
+		chunk := s.copybuf[:]
+		if s.sectorSize-off < int64(len(chunk)) {
+			chunk = chunk[:s.sectorSize-off]
+		}
+		if _, err := s.dev.ReadAt(chunk, s.addr(i, off)); err != nil {
+			return false, err
+		}
+		for _, b := range chunk {
+			if b != 0xFF {
+				return false, nil
+			}
+		}
+		off += int64(len(chunk))
+	}
+	return true, nil
+}
+
+// addr returns the device address of offset off in sector i of the store.
+func (s *Store) addr(i, off int64) int64 {
+	return (s.first+i)*s.sectorSize + off
+}
+
+func copyKey(dst, key []byte) []byte {
+	return dst[:copy(dst, key)]
+}
@@ -0,0 +1,229 @@
+package kvstore_test
+
+import (
+	"bytes"
+	"testing"
+
+	"tinygo.org/x/drivers/flash/flashemu"
+	"tinygo.org/x/drivers/flash/kvstore"
+)
+
+const (
+	pageSize   = 128
+	sectorSize = 512
+	sectors    = 3
+	operations = 200
+)
+
+var keys = []string{"ssid", "pass", "accel", "gyro", "mag", "tz"}
+
+// op is a single update of the workload.
+type op struct {
+	key    string
+	value  string
+	delete bool
+}
+
+func newStore(t *testing.T) (*flashemu.Device, *kvstore.Store) {
+	dev := flashemu.New(sectors*sectorSize, pageSize, sectorSize)
+	dev.Strict = true
+	store := kvstore.New(dev, 0, sectors)
+	if err := store.Format(); err != nil {
+		t.Fatal("format:", err)
+	}
+	return dev, store
+}
+
+func TestSetGetDelete(t *testing.T) {
+	dev, store := newStore(t)
+	if err := store.Set("ssid", []byte("tinygo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("pass", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("ssid", []byte("gopher")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store reads the same after mounting it again
+	store = kvstore.New(dev, 0, sectors)
+	if err := store.Mount(); err != nil {
+		t.Fatal(err)
+	}
+	var buf [16]byte
+	n, err := store.Get("ssid", buf[:])
+	if err != nil || string(buf[:n]) != "gopher" {
+		t.Errorf("ssid: got %q, %v", buf[:n], err)
+	}
+	if _, err := store.Get("pass", buf[:]); err != kvstore.ErrNotFound {
+		t.Errorf("pass: got %v, want %v", err, kvstore.ErrNotFound)
+	}
+	if err := store.Set("", nil); err != kvstore.ErrInvalidKey {
+		t.Errorf("empty key: got %v, want %v", err, kvstore.ErrInvalidKey)
+	}
+	if err := store.Set("big", bytes.Repeat([]byte{1}, sectorSize)); err != kvstore.ErrValueTooLarge {
+		t.Errorf("large value: got %v, want %v", err, kvstore.ErrValueTooLarge)
+	}
+}
+
+// TestPowerLoss checks that the store survives a power loss during any
+// single program or erase operation of a workload of updates and deletes.
+func TestPowerLoss(t *testing.T) {
+	workload := makeWorkload()
+
+	// a run without faults gives the number of operations to interrupt
+	dev, store := newStore(t)
+	_, programs0, erases0 := dev.Stats()
+	for i, o := range workload {
+		if err := apply(store, o); err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+	}
+	_, programs, erases := dev.Stats()
+	total := programs + erases - programs0 - erases0
+	verify(t, store, workload, len(workload), false)
+
+	// every sector is in use, and they wear evenly
+	counts := dev.EraseCounts()
+	min, max := counts[0], counts[0]
+	for _, n := range counts {
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	if min == 0 || max-min > 1 {
+		t.Errorf("uneven erase counts %v", counts)
+	}
+
+	for fault := uint64(1); fault <= total; fault++ {
+		dev, store := newStore(t)
+		dev.PowerLossAt(fault)
+
+		interrupted := -1
+		for i, o := range workload {
+			if err := apply(store, o); err != nil {
+				if err != flashemu.ErrPowerLoss {
+					t.Fatalf("fault %d: operation %d: %v", fault, i, err)
+				}
+				interrupted = i
+				break
+			}
+		}
+		if interrupted < 0 {
+			t.Fatalf("fault %d: the power was not lost", fault)
+		}
+
+		dev.PowerOn()
+		store = kvstore.New(dev, 0, sectors)
+		if err := store.Mount(); err != nil {
+			t.Fatalf("fault %d: mount: %v", fault, err)
+		}
+		verify(t, store, workload, interrupted, true)
+
+		// the store must remain usable
+		for i := interrupted; i < len(workload); i++ {
+			if err := apply(store, workload[i]); err != nil {
+				t.Fatalf("fault %d: operation %d: %v", fault, i, err)
+			}
+		}
+		verify(t, store, workload, len(workload), false)
+		if t.Failed() {
+			t.Fatalf("fault %d of %d", fault, total)
+		}
+	}
+	t.Logf("%d power loss points recovered", total)
+}
+
+// makeWorkload returns a pseudo-random sequence of updates and deletes.
+func makeWorkload() []op {
+	var ops []op
+	x := uint32(1)
+	for i := 0; i < operations; i++ {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		o := op{key: keys[x%uint32(len(keys))]}
+		if x%8 == 0 {
+			o.delete = true
+		} else {
+			n := int(x>>8) % 40
+			value := make([]byte, n)
+			for j := range value {
+				value[j] = byte('a' + (i+j)%26)
+			}
+			o.value = string(value)
+		}
+		ops = append(ops, o)
+	}
+	return ops
+}
+
+func apply(store *kvstore.Store, o op) error {
+	if o.delete {
+		return store.Delete(o.key)
+	}
+	return store.Set(o.key, []byte(o.value))
+}
+
+// state returns the expected content of the store after the first n
+// operations of the workload.
+func state(workload []op, n int) map[string]string {
+	m := make(map[string]string)
+	for _, o := range workload[:n] {
+		if o.delete {
+			delete(m, o.key)
+		} else {
+			m[o.key] = o.value
+		}
+	}
+	return m
+}
+
+// verify checks that the store holds the values after the first n
+// operations of the workload. If interrupted is set, operation n may also
+// have completed.
+func verify(t *testing.T, store *kvstore.Store, workload []op, n int, interrupted bool) {
+	t.Helper()
+	expected := state(workload, n)
+	var after map[string]string
+	if interrupted {
+		after = state(workload, n+1)
+	}
+	matches := func(m map[string]string, k, got string, present bool) bool {
+		want, ok := m[k]
+		return present == ok && got == want
+	}
+
+	var buf [64]byte
+	for _, k := range keys {
+		size, err := store.Get(k, buf[:])
+		if err != nil && err != kvstore.ErrNotFound {
+			t.Errorf("get %s: %v", k, err)
+			continue
+		}
+		got, present := string(buf[:size]), err == nil
+		if matches(expected, k, got, present) {
+			continue
+		}
+		if after != nil && k == workload[n].key && matches(after, k, got, present) {
+			continue
+		}
+		t.Errorf("%s: unexpected value %q (present %v)", k, got, present)
+	}
+
+	count := 0
+	store.Range(func(key string, size int) bool {
+		count++
+		return true
+	})
+	if count != len(expected) && (after == nil || count != len(after)) {
+		t.Errorf("unexpected number of keys %d", count)
+	}
+}
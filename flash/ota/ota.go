@@ -0,0 +1,691 @@
+// Package ota stages firmware updates in flash memory, such as an external
+// flash.Device, for a bootloader to install.
+//
+// An image is a signed header followed by the firmware:
+//
+//	magic     uint32 // "OTAI"
+//	version   uint32 // firmware version, for the application to interpret
+//	size      uint32 // size of the firmware in bytes
+//	flags     uint32 // reserved, zero
+//	hash      [32]byte // SHA-256 of the firmware
+//	reserved  [16]byte // zero
+//	signature [64]byte // Ed25519 signature of the bytes above
+//
+// Images are streamed into one of several slots with Update.Write, for
+// example straight from an HTTP response body or from MQTT messages. The
+// progress is recorded in the metadata as every erase block of the slot is
+// completed, so that after a power loss the download can be resumed where
+// it stopped. When the whole image is written, Finish verifies its hash and
+// marks the slot as pending. The bootloader installs a pending image, and the
+// new firmware calls Confirm once it runs correctly, or Rollback.
+//
+// The metadata is kept in two erase blocks, each a log of 128 byte slot
+// records, all integers little endian:
+//
+//	magic    uint32 // "OTA1"
+//	slot     uint8
+//	_        [3]byte
+//	seq      uint32 // increases with every record
+//	size     uint32 // size of the image, including the header
+//	crc      uint32 // CRC-32 of the 16 bytes above
+//	state    uint8  // bits are cleared for pending, confirmed and rolled back
+//	_        [11]byte
+//	progress [96]byte // a bit is cleared for every erase block written
+//
+// The record with the highest sequence number of a slot describes it. The
+// state and progress bits are cleared in place, without erasing. Records are
+// appended to the sector holding the highest sequence number. When it is full
+// and a new update begins, the other sector is erased and the records of the
+// other slots are copied there with new sequence numbers. The old copies stay
+// valid until the next time the sectors are switched, and Mount finishes a
+// copy that was interrupted by a power loss, so no record is ever lost.
+package ota // import "tinygo.org/x/drivers/flash/ota"
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"tinygo.org/x/drivers"
+)
+
+// HeaderSize is the size of the image header.
+const HeaderSize = 128
+
+var (
+	ErrNotMounted    = errors.New("ota: not mounted")
+	ErrInvalidSlot   = errors.New("ota: invalid slot")
+	ErrSlotTooLarge  = errors.New("ota: slot has too many erase blocks")
+	ErrInvalidKey    = errors.New("ota: invalid public key")
+	ErrInvalidHeader = errors.New("ota: invalid image header")
+	ErrBadSignature  = errors.New("ota: bad image signature")
+	ErrImageTooLarge = errors.New("ota: image larger than slot")
+	ErrExtraData     = errors.New("ota: data past the end of the image")
+	ErrIncomplete    = errors.New("ota: image incomplete")
+	ErrHashMismatch  = errors.New("ota: image hash mismatch")
+	ErrNoUpdate      = errors.New("ota: no update in progress")
+	ErrInvalidState  = errors.New("ota: invalid slot state")
+	ErrMetadataFull  = errors.New("ota: too many slots for the metadata sectors")
+	errInvalidRecord = errors.New("ota: invalid metadata record")
+)
+
+// Slot is a range of erase blocks that holds an image.
+type Slot struct {
+	Start, Blocks int64
+}
+
+// State is the state of a slot.
+type State uint8
+
+const (
+	// Empty: no image was ever written to the slot.
+	Empty State = iota
+
+	// Receiving: an image is being written.
+	Receiving
+
+	// Pending: a complete and verified image waits to be installed.
+	Pending
+
+	// Confirmed: the image was installed and confirmed to work.
+	Confirmed
+
+	// RolledBack: the image was installed but rolled back.
+	RolledBack
+)
+
+func (s State) String() string {
+	switch s {
+	case Empty:
+		return "empty"
+	case Receiving:
+		return "receiving"
+	case Pending:
+		return "pending"
+	case Confirmed:
+		return "confirmed"
+	case RolledBack:
+		return "rolled back"
+	default:
+		return "invalid"
+	}
+}
+
+const (
+	imageMagic  = 0x4941544F // "OTAI"
+	recordMagic = 0x3141544F // "OTA1"
+
+	recordSize     = 128
+	stateOffset    = 20
+	progressOffset = 32
+	maxBlocks      = (recordSize - progressOffset) * 8
+
+	statePending    = 0x01
+	stateConfirmed  = 0x02
+	stateRolledBack = 0x04
+)
+
+// Header is the header of an image.
+type Header struct {
+	Version   uint32
+	Size      uint32
+	Hash      [sha256.Size]byte
+	Signature [ed25519.SignatureSize]byte
+}
+
+// NewHeader returns the signed header of an image containing firmware. It is
+// meant for the tools that build images.
+func NewHeader(version uint32, firmware []byte, key ed25519.PrivateKey) Header {
+	h := Header{
+		Version: version,
+		Size:    uint32(len(firmware)),
+		Hash:    sha256.Sum256(firmware),
+	}
+	b := h.Bytes()
+	copy(h.Signature[:], ed25519.Sign(key, b[:HeaderSize-ed25519.SignatureSize]))
+	return h
+}
+
+// Bytes returns the encoded header.
+func (h *Header) Bytes() []byte {
+	b := make([]byte, HeaderSize)
+	binary.LittleEndian.PutUint32(b[0:], imageMagic)
+	binary.LittleEndian.PutUint32(b[4:], h.Version)
+	binary.LittleEndian.PutUint32(b[8:], h.Size)
+	copy(b[16:], h.Hash[:])
+	copy(b[HeaderSize-ed25519.SignatureSize:], h.Signature[:])
+	return b
+}
+
+// parseHeader decodes b and checks its signature with key.
+func parseHeader(b []byte, key ed25519.PublicKey) (Header, error) {
+	var h Header
+	if binary.LittleEndian.Uint32(b[0:]) != imageMagic {
+		return h, ErrInvalidHeader
+	}
+	h.Version = binary.LittleEndian.Uint32(b[4:])
+	h.Size = binary.LittleEndian.Uint32(b[8:])
+	copy(h.Hash[:], b[16:])
+	copy(h.Signature[:], b[HeaderSize-ed25519.SignatureSize:])
+	if !ed25519.Verify(key, b[:HeaderSize-ed25519.SignatureSize], h.Signature[:]) {
+		return h, ErrBadSignature
+	}
+	return h, nil
+}
+
+// Manager keeps track of the images in a set of slots.
+type Manager struct {
+	dev       drivers.BlockDevice
+	meta      int64
+	slots     []Slot
+	key       ed25519.PublicKey
+	blockSize int64
+
+	// offsets are relative to the first metadata sector
+	records []int64 // offset of the record of every slot, -1 if none
+	active  int64   // metadata sector new records are appended to, 0 or 1
+	seq     uint32  // highest sequence number in the metadata
+	pos     int64   // offset of the first free record
+	mounted bool
+
+	buf [recordSize]byte
+}
+
+// New returns a manager of images in slots, with the metadata in erase blocks
+// meta and meta+1 of dev. Images must be signed with the private key of key.
+// Mount must be called before using it.
+func New(dev drivers.BlockDevice, meta int64, slots []Slot, key ed25519.PublicKey) *Manager {
+	return &Manager{
+		dev:       dev,
+		meta:      meta,
+		slots:     slots,
+		key:       key,
+		blockSize: dev.EraseBlockSize(),
+		records:   make([]int64, len(slots)),
+	}
+}
+
+// Mount reads the metadata sectors. Empty or unformatted sectors leave all
+// slots empty. It returns ErrInvalidSlot if the slots overlap each other or
+// the metadata sectors.
+func (m *Manager) Mount() error {
+	m.mounted = false
+	if len(m.key) != ed25519.PublicKeySize {
+		return ErrInvalidKey
+	}
+	if m.blockSize <= HeaderSize || m.meta < 0 {
+		return ErrInvalidSlot
+	}
+	for i, s := range m.slots {
+		if s.Blocks > maxBlocks {
+			return ErrSlotTooLarge
+		}
+		if s.Blocks < 1 || s.Start < 0 || overlap(s, Slot{Start: m.meta, Blocks: 2}) {
+			return ErrInvalidSlot
+		}
+		for _, other := range m.slots[:i] {
+			if overlap(s, other) {
+				return ErrInvalidSlot
+			}
+		}
+	}
+	for i := range m.records {
+		m.records[i] = -1
+	}
+
+	seqs := make([]uint32, len(m.slots))
+	var top [2]uint32 // highest sequence number in each sector
+	var found [2]bool
+	var free [2]int64
+	for sector := int64(0); sector < 2; sector++ {
+		start := sector * m.blockSize
+		free[sector] = start + m.blockSize
+		for off := start; off < start+m.blockSize; off += recordSize {
+			if _, err := m.dev.ReadAt(m.buf[:progressOffset], m.metaAddr(off)); err != nil {
+				return err
+			}
+			if isErased(m.buf[:stateOffset]) {
+				free[sector] = off
+				break
+			}
+			slot, seq, err := m.parseRecord(m.buf[:])
+			if err != nil {
+				// a torn record, skip it
+				continue
+			}
+			if m.records[slot] < 0 || int32(seq-seqs[slot]) > 0 {
+				m.records[slot] = off
+				seqs[slot] = seq
+			}
+			if !found[sector] || int32(seq-top[sector]) > 0 {
+				top[sector] = seq
+				found[sector] = true
+			}
+		}
+	}
+	m.active = 0
+	if found[1] && (!found[0] || int32(top[1]-top[0]) > 0) {
+		m.active = 1
+	}
+	m.seq = top[m.active]
+	m.pos = free[m.active]
+
+	// finish copying the records to the active sector
+	for slot, off := range m.records {
+		if off < 0 || off/m.blockSize == m.active {
+			continue
+		}
+		var rec [recordSize]byte
+		if _, err := m.dev.ReadAt(rec[:], m.metaAddr(off)); err != nil {
+			return err
+		}
+		if err := m.appendRecord(slot, rec[:]); err != nil {
+			return err
+		}
+	}
+	m.mounted = true
+	return nil
+}
+
+// SlotStatus is the state of a slot and the header of its image.
+type SlotStatus struct {
+	State  State
+	Header Header
+
+	// Written is the number of bytes of the image, including the header,
+	// recorded as written.
+	Written int64
+}
+
+// Status returns the state of a slot.
+func (m *Manager) Status(slot int) (SlotStatus, error) {
+	var st SlotStatus
+	if err := m.check(slot); err != nil {
+		return st, err
+	}
+	off := m.records[slot]
+	if off < 0 {
+		return st, nil
+	}
+	if _, err := m.dev.ReadAt(m.buf[:], m.metaAddr(off)); err != nil {
+		return st, err
+	}
+	st.State = recordState(m.buf[stateOffset])
+	size := int64(binary.LittleEndian.Uint32(m.buf[12:]))
+	st.Written = m.progress(m.buf[progressOffset:]) * m.blockSize
+	if st.Written > size {
+		st.Written = size
+	}
+	if st.Written >= HeaderSize {
+		b := make([]byte, HeaderSize)
+		if _, err := m.dev.ReadAt(b, m.slotAddr(slot, 0)); err != nil {
+			return st, err
+		}
+		// the signature was checked when the image was received
+		st.Header, _ = parseHeader(b, m.key)
+	}
+	return st, nil
+}
+
+// Image returns a reader of the firmware in a slot, without the header. The
+// slot must be pending or confirmed.
+func (m *Manager) Image(slot int) (*io.SectionReader, error) {
+	st, err := m.Status(slot)
+	if err != nil {
+		return nil, err
+	}
+	if st.State != Pending && st.State != Confirmed {
+		return nil, ErrInvalidState
+	}
+	return io.NewSectionReader(m.dev, m.slotAddr(slot, HeaderSize), int64(st.Header.Size)), nil
+}
+
+// Confirm marks the pending image in slot as confirmed.
+func (m *Manager) Confirm(slot int) error {
+	return m.transition(slot, stateConfirmed, Pending)
+}
+
+// Rollback marks the pending or confirmed image in slot as rolled back.
+func (m *Manager) Rollback(slot int) error {
+	return m.transition(slot, stateRolledBack, Pending, Confirmed)
+}
+
+// transition clears bit of the state of slot, which must be in one of the
+// states from.
+func (m *Manager) transition(slot int, bit byte, from ...State) error {
+	st, err := m.Status(slot)
+	if err != nil {
+		return err
+	}
+	for _, s := range from {
+		if s == st.State {
+			return m.clearBits(m.records[slot]+stateOffset, bit)
+		}
+	}
+	return ErrInvalidState
+}
+
+// Update is an image being written to a slot.
+type Update struct {
+	m      *Manager
+	slot   int
+	off    int64 // offset in the slot of the next byte
+	end    int64 // size of the image, known once the header is complete
+	header [HeaderSize]byte
+}
+
+// Begin starts writing a new image to slot, discarding what it contained.
+// Nothing is written until the header is complete.
+func (m *Manager) Begin(slot int) (*Update, error) {
+	if err := m.check(slot); err != nil {
+		return nil, err
+	}
+	return &Update{m: m, slot: slot}, nil
+}
+
+// Resume continues the update of slot that was interrupted, for example by a
+// power loss. The image must be written again from Offset on, which is at
+// the start of the first erase block that wasn't completed; zero means the
+// whole image.
+func (m *Manager) Resume(slot int) (*Update, error) {
+	st, err := m.Status(slot)
+	if err != nil {
+		return nil, err
+	}
+	if st.State != Receiving {
+		return nil, ErrNoUpdate
+	}
+	u := &Update{m: m, slot: slot}
+	if st.Written >= HeaderSize {
+		// the header as signed, with the flags and reserved bytes that
+		// Header leaves out
+		if _, err := m.dev.ReadAt(u.header[:], m.slotAddr(slot, 0)); err != nil {
+			return nil, err
+		}
+		u.off = st.Written
+		u.end = int64(HeaderSize + st.Header.Size)
+	}
+	return u, nil
+}
+
+// Offset returns the offset in the image of the next byte to write.
+func (u *Update) Offset() int64 {
+	return u.off
+}
+
+// Header returns the header of the image, once it has been written.
+func (u *Update) Header() (Header, bool) {
+	if u.off < HeaderSize {
+		return Header{}, false
+	}
+	h, _ := parseHeader(u.header[:], u.m.key)
+	return h, true
+}
+
+// Write satisfies the io.Writer interface, writing the next part of the
+// image. The header is checked as soon as it is complete, and the write
+// fails with ErrBadSignature if it wasn't signed with the right key.
+func (u *Update) Write(p []byte) (n int, err error) {
+	m := u.m
+	if !m.mounted {
+		return 0, ErrNotMounted
+	}
+	for len(p) > 0 {
+		if u.off < HeaderSize {
+			c := copy(u.header[u.off:], p)
+			u.off += int64(c)
+			n += c
+			p = p[c:]
+			if u.off == HeaderSize {
+				if err = u.start(); err != nil {
+					u.off = 0
+					return
+				}
+			}
+			continue
+		}
+		if u.off >= u.end {
+			return n, ErrExtraData
+		}
+		if u.off%m.blockSize == 0 {
+			if err = m.dev.EraseBlocks(m.slots[u.slot].Start+u.off/m.blockSize, 1); err != nil {
+				return
+			}
+		}
+		c := m.blockSize - u.off%m.blockSize
+		if rest := u.end - u.off; rest < c {
+			c = rest
+		}
+		if int64(len(p)) < c {
+			c = int64(len(p))
+		}
+		if _, err = m.dev.WriteAt(p[:c], m.slotAddr(u.slot, u.off)); err != nil {
+			return
+		}
+		u.off += c
+		n += int(c)
+		p = p[c:]
+		if u.off%m.blockSize == 0 || u.off == u.end {
+			if err = u.done((u.off - 1) / m.blockSize); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// start checks the complete header, and records the new image in the
+// metadata before writing the header to the slot.
+func (u *Update) start() error {
+	m := u.m
+	h, err := parseHeader(u.header[:], m.key)
+	if err != nil {
+		return err
+	}
+	u.end = HeaderSize + int64(h.Size)
+	if u.end > m.slots[u.slot].Blocks*m.blockSize {
+		return ErrImageTooLarge
+	}
+	if err := m.newRecord(u.slot, u.end); err != nil {
+		return err
+	}
+	if err := m.dev.EraseBlocks(m.slots[u.slot].Start, 1); err != nil {
+		return err
+	}
+	if _, err := m.dev.WriteAt(u.header[:], m.slotAddr(u.slot, 0)); err != nil {
+		return err
+	}
+	if u.end == HeaderSize {
+		return u.done(0)
+	}
+	return nil
+}
+
+// done records that erase block i of the slot is completely written.
+func (u *Update) done(i int64) error {
+	return u.m.clearBits(u.m.records[u.slot]+progressOffset+i/8, 1<<(i%8))
+}
+
+// Finish checks that the whole image was written and that the SHA-256 of the
+// firmware read back from the memory matches the header, and marks the slot
+// as pending.
+func (u *Update) Finish() error {
+	m := u.m
+	if u.off < HeaderSize || u.off != u.end {
+		return ErrIncomplete
+	}
+	h, err := parseHeader(u.header[:], m.key)
+	if err != nil {
+		return err
+	}
+	sum := sha256.New()
+	buf := make([]byte, 256)
+	for off := int64(HeaderSize); off < u.end; off += int64(len(buf)) {
+		if u.end-off < int64(len(buf)) {
+			buf = buf[:u.end-off]
+		}
+		if _, err := m.dev.ReadAt(buf, m.slotAddr(u.slot, off)); err != nil {
+			return err
+		}
+		sum.Write(buf)
+	}
+	if string(sum.Sum(nil)) != string(h.Hash[:]) {
+		return ErrHashMismatch
+	}
+	return m.clearBits(m.records[u.slot]+stateOffset, statePending)
+}
+
+// newRecord appends a record for an image of size bytes in slot, switching
+// the metadata sectors if the active one is full.
+func (m *Manager) newRecord(slot int, size int64) error {
+	if m.pos+recordSize > (m.active+1)*m.blockSize {
+		if err := m.compact(slot); err != nil {
+			return err
+		}
+	}
+	for i := range m.buf {
+		m.buf[i] = 0xFF
+	}
+	binary.LittleEndian.PutUint32(m.buf[0:], recordMagic)
+	m.buf[4] = byte(slot)
+	binary.LittleEndian.PutUint32(m.buf[12:], uint32(size))
+	return m.appendRecord(slot, m.buf[:stateOffset])
+}
+
+// compact erases the other metadata sector and copies the records of all
+// slots but skip there. The old copies remain valid until the records are
+// complete, as they have lower sequence numbers.
+func (m *Manager) compact(skip int) error {
+	saved := make([][recordSize]byte, 0, len(m.slots))
+	for i, off := range m.records {
+		if off < 0 || i == skip {
+			continue
+		}
+		var rec [recordSize]byte
+		if _, err := m.dev.ReadAt(rec[:], m.metaAddr(off)); err != nil {
+			return err
+		}
+		saved = append(saved, rec)
+	}
+	if int64(len(saved)+1)*recordSize > m.blockSize {
+		return ErrMetadataFull
+	}
+	m.active = 1 - m.active
+	m.pos = m.active * m.blockSize
+	if err := m.dev.EraseBlocks(m.meta+m.active, 1); err != nil {
+		return err
+	}
+	for _, rec := range saved {
+		if err := m.appendRecord(int(rec[4]), rec[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendRecord writes the record for slot in b, a header or a whole record,
+// with the next sequence number to the active metadata sector.
+func (m *Manager) appendRecord(slot int, b []byte) error {
+	if m.pos+recordSize > (m.active+1)*m.blockSize {
+		return ErrMetadataFull
+	}
+	m.seq++
+	binary.LittleEndian.PutUint32(b[8:], m.seq)
+	binary.LittleEndian.PutUint32(b[16:], crc32.ChecksumIEEE(b[:16]))
+	off := m.pos
+	// if anything goes wrong, don't program this record again
+	m.pos += recordSize
+	if _, err := m.dev.WriteAt(b, m.metaAddr(off)); err != nil {
+		return err
+	}
+	m.records[slot] = off
+	return nil
+}
+
+// clearBits clears the bits of mask in the metadata byte at off.
+func (m *Manager) clearBits(off int64, mask byte) error {
+	var b [1]byte
+	if _, err := m.dev.ReadAt(b[:], m.metaAddr(off)); err != nil {
+		return err
+	}
+	if b[0]&mask == 0 {
+		return nil
+	}
+	b[0] &^= mask
+	_, err := m.dev.WriteAt(b[:], m.metaAddr(off))
+	return err
+}
+
+// parseRecord checks the record header in b and returns its slot and
+// sequence number.
+func (m *Manager) parseRecord(b []byte) (int, uint32, error) {
+	if binary.LittleEndian.Uint32(b[0:]) != recordMagic ||
+		binary.LittleEndian.Uint32(b[16:]) != crc32.ChecksumIEEE(b[:16]) ||
+		int(b[4]) >= len(m.slots) {
+		return 0, 0, errInvalidRecord
+	}
+	return int(b[4]), binary.LittleEndian.Uint32(b[8:]), nil
+}
+
+// progress returns the number of erase blocks completed according to the
+// bitmap of a record.
+func (m *Manager) progress(bitmap []byte) int64 {
+	n := int64(0)
+	for _, b := range bitmap[:recordSize-progressOffset] {
+		for bit := byte(1); bit != 0; bit <<= 1 {
+			if b&bit != 0 {
+				return n
+			}
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Manager) check(slot int) error {
+	if !m.mounted {
+		return ErrNotMounted
+	}
+	if slot < 0 || slot >= len(m.slots) {
+		return ErrInvalidSlot
+	}
+	return nil
+}
+
+// overlap returns whether two ranges of erase blocks overlap.
+func overlap(a, b Slot) bool {
+	return a.Start < b.Start+b.Blocks && b.Start < a.Start+a.Blocks
+}
+
+func (m *Manager) metaAddr(off int64) int64 {
+	return m.meta*m.blockSize + off
+}
+
+func (m *Manager) slotAddr(slot int, off int64) int64 {
+	return m.slots[slot].Start*m.blockSize + off
+}
+
+func recordState(b byte) State {
+	switch {
+	case b&stateRolledBack == 0:
+		return RolledBack
+	case b&stateConfirmed == 0:
+		return Confirmed
+	case b&statePending == 0:
+		return Pending
+	default:
+		return Receiving
+	}
+}
+
+func isErased(b []byte) bool {
+	for _, c := range b {
+		if c != 0xFF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,373 @@
+package ota_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+	"testing"
+
+	"tinygo.org/x/drivers/flash/flashemu"
+	"tinygo.org/x/drivers/flash/ota"
+)
+
+const (
+	pageSize   = 128
+	sectorSize = 512
+	chunkSize  = 100
+)
+
+// two metadata sectors followed by two slots
+var slots = []ota.Slot{{Start: 2, Blocks: 8}, {Start: 10, Blocks: 8}}
+
+var key = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+func newDevice() *flashemu.Device {
+	dev := flashemu.New(18*sectorSize, pageSize, sectorSize)
+	dev.Strict = true
+	return dev
+}
+
+func mount(t *testing.T, dev *flashemu.Device) *ota.Manager {
+	t.Helper()
+	m := ota.New(dev, 0, slots, key.Public().(ed25519.PublicKey))
+	if err := m.Mount(); err != nil {
+		t.Fatal("mount:", err)
+	}
+	return m
+}
+
+// image returns a signed image of n bytes of firmware.
+func image(version uint32, n int) []byte {
+	firmware := make([]byte, n)
+	for i := range firmware {
+		firmware[i] = byte(i*7 + int(version))
+	}
+	h := ota.NewHeader(version, firmware, key)
+	return append(h.Bytes(), firmware...)
+}
+
+// write writes img to u in chunks, starting at the offset of u.
+func write(u *ota.Update, img []byte) error {
+	for off := u.Offset(); off < int64(len(img)); off += chunkSize {
+		end := off + chunkSize
+		if end > int64(len(img)) {
+			end = int64(len(img))
+		}
+		if _, err := u.Write(img[off:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func install(m *ota.Manager, slot int, img []byte) error {
+	u, err := m.Begin(slot)
+	if err != nil {
+		return err
+	}
+	if err := write(u, img); err != nil {
+		return err
+	}
+	return u.Finish()
+}
+
+// check verifies the state of slot and, unless it is empty or receiving,
+// the firmware of img.
+func check(t *testing.T, m *ota.Manager, slot int, state ota.State, img []byte) {
+	t.Helper()
+	st, err := m.Status(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != state {
+		t.Fatalf("slot %d: got state %v, want %v", slot, st.State, state)
+	}
+	if state == ota.Empty || state == ota.Receiving {
+		return
+	}
+	r, err := m.Image(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firmware, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(firmware, img[ota.HeaderSize:]) {
+		t.Errorf("slot %d: firmware differs", slot)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dev := newDevice()
+	m := mount(t, dev)
+	check(t, m, 0, ota.Empty, nil)
+
+	img := image(2, 3000)
+	if err := install(m, 0, img); err != nil {
+		t.Fatal(err)
+	}
+	check(t, m, 0, ota.Pending, img)
+	if st, _ := m.Status(0); st.Header.Version != 2 || st.Written != int64(len(img)) {
+		t.Errorf("got version %d, %d bytes written", st.Header.Version, st.Written)
+	}
+
+	// the bootloader installed the image, which works
+	m = mount(t, dev)
+	check(t, m, 0, ota.Pending, img)
+	if err := m.Confirm(0); err != nil {
+		t.Fatal(err)
+	}
+	check(t, m, 0, ota.Confirmed, img)
+	if err := m.Confirm(0); err != ota.ErrInvalidState {
+		t.Errorf("confirm twice: got %v, want %v", err, ota.ErrInvalidState)
+	}
+	if err := m.Rollback(0); err != nil {
+		t.Fatal(err)
+	}
+	m = mount(t, dev)
+	if st, _ := m.Status(0); st.State != ota.RolledBack {
+		t.Errorf("got state %v, want %v", st.State, ota.RolledBack)
+	}
+	if _, err := m.Image(0); err != ota.ErrInvalidState {
+		t.Errorf("image of rolled back slot: got %v, want %v", err, ota.ErrInvalidState)
+	}
+	if err := m.Confirm(1); err != ota.ErrInvalidState {
+		t.Errorf("confirm empty slot: got %v, want %v", err, ota.ErrInvalidState)
+	}
+}
+
+func TestResume(t *testing.T) {
+	dev := newDevice()
+	m := mount(t, dev)
+	img := image(3, 3000)
+	u, err := m.Begin(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(u, img[:1700]); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Finish(); err != ota.ErrIncomplete {
+		t.Errorf("finish: got %v, want %v", err, ota.ErrIncomplete)
+	}
+
+	// after a reboot, only the completed erase blocks count
+	m = mount(t, dev)
+	if _, err := m.Resume(0); err != ota.ErrNoUpdate {
+		t.Errorf("resume empty slot: got %v, want %v", err, ota.ErrNoUpdate)
+	}
+	u, err = m.Resume(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Offset() != 3*sectorSize {
+		t.Errorf("got offset %d, want %d", u.Offset(), 3*sectorSize)
+	}
+	if h, ok := u.Header(); !ok || h.Version != 3 {
+		t.Errorf("got header %v, %v", h, ok)
+	}
+	if err := write(u, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Write([]byte{0}); err != ota.ErrExtraData {
+		t.Errorf("write past the end: got %v, want %v", err, ota.ErrExtraData)
+	}
+	if err := u.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, m, 1, ota.Pending, img)
+}
+
+// TestResumeFlags resumes an image whose header has flags and reserved
+// bytes set, which the signature covers but Header leaves out.
+func TestResumeFlags(t *testing.T) {
+	dev := newDevice()
+	m := mount(t, dev)
+	img := image(3, 3000)
+	img[12] = 0x01
+	img[60] = 0x5A
+	copy(img[ota.HeaderSize-ed25519.SignatureSize:], ed25519.Sign(key, img[:ota.HeaderSize-ed25519.SignatureSize]))
+	u, err := m.Begin(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(u, img[:1700]); err != nil {
+		t.Fatal(err)
+	}
+
+	m = mount(t, dev)
+	u, err = m.Resume(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := write(u, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Finish(); err != nil {
+		t.Fatal("finish:", err)
+	}
+	check(t, m, 0, ota.Pending, img)
+}
+
+// TestLayout checks that Mount rejects slots that overlap each other or the
+// metadata sectors.
+func TestLayout(t *testing.T) {
+	pub := key.Public().(ed25519.PublicKey)
+	for _, tc := range []struct {
+		meta  int64
+		slots []ota.Slot
+		err   error
+	}{
+		{0, slots, nil},
+		{16, []ota.Slot{{Start: 0, Blocks: 8}, {Start: 8, Blocks: 8}}, nil},
+		{0, []ota.Slot{{Start: 1, Blocks: 8}}, ota.ErrInvalidSlot},
+		{0, []ota.Slot{{Start: 0, Blocks: 1}}, ota.ErrInvalidSlot},
+		{4, []ota.Slot{{Start: 0, Blocks: 5}}, ota.ErrInvalidSlot},
+		{4, []ota.Slot{{Start: 5, Blocks: 2}}, ota.ErrInvalidSlot},
+		{0, []ota.Slot{{Start: 2, Blocks: 8}, {Start: 9, Blocks: 8}}, ota.ErrInvalidSlot},
+		{0, []ota.Slot{{Start: 10, Blocks: 8}, {Start: 2, Blocks: 9}}, ota.ErrInvalidSlot},
+		{0, []ota.Slot{{Start: -1, Blocks: 1}}, ota.ErrInvalidSlot},
+		{0, []ota.Slot{{Start: 2, Blocks: 0}}, ota.ErrInvalidSlot},
+		{-1, []ota.Slot{{Start: 2, Blocks: 8}}, ota.ErrInvalidSlot},
+	} {
+		m := ota.New(newDevice(), tc.meta, tc.slots, pub)
+		if err := m.Mount(); err != tc.err {
+			t.Errorf("metadata at %d, slots %v: got %v, want %v", tc.meta, tc.slots, err, tc.err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dev := newDevice()
+	m := mount(t, dev)
+
+	// signed with another key
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	img := image(4, 1000)
+	h := ota.NewHeader(4, img[ota.HeaderSize:], other)
+	u, err := m.Begin(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Write(h.Bytes()); err != ota.ErrBadSignature {
+		t.Errorf("other key: got %v, want %v", err, ota.ErrBadSignature)
+	}
+	check(t, m, 0, ota.Empty, nil)
+
+	// modified header
+	bad := append([]byte(nil), img...)
+	bad[4]++
+	u, _ = m.Begin(0)
+	if err := write(u, bad); err != ota.ErrBadSignature {
+		t.Errorf("modified header: got %v, want %v", err, ota.ErrBadSignature)
+	}
+
+	// modified firmware
+	bad = append([]byte(nil), img...)
+	bad[len(bad)-1]++
+	u, _ = m.Begin(0)
+	if err := write(u, bad); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Finish(); err != ota.ErrHashMismatch {
+		t.Errorf("modified firmware: got %v, want %v", err, ota.ErrHashMismatch)
+	}
+	check(t, m, 0, ota.Receiving, nil)
+
+	// too large for the slot
+	u, _ = m.Begin(0)
+	if err := write(u, image(5, 8*sectorSize)); err != ota.ErrImageTooLarge {
+		t.Errorf("large image: got %v, want %v", err, ota.ErrImageTooLarge)
+	}
+}
+
+// TestPowerLoss checks that a pending update of one slot survives a power
+// loss at any point while updates of the other slot fill the metadata
+// sectors, which are switched several times.
+func TestPowerLoss(t *testing.T) {
+	pending := image(1, 1500)
+	updates := [][]byte{image(2, 400), image(3, 100), image(4, 700), image(5, 0), image(6, 300), image(7, 200)}
+
+	setup := func() (*flashemu.Device, *ota.Manager) {
+		dev := newDevice()
+		m := mount(t, dev)
+		if err := install(m, 0, pending); err != nil {
+			t.Fatal(err)
+		}
+		return dev, m
+	}
+
+	// a run without faults gives the number of operations to interrupt
+	dev, m := setup()
+	_, programs0, erases0 := dev.Stats()
+	for _, img := range updates {
+		if err := install(m, 1, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, programs, erases := dev.Stats()
+	total := programs + erases - programs0 - erases0
+	if erases-erases0 < uint64(len(updates)+2) {
+		t.Fatalf("the metadata sectors were not switched: %d erases", erases-erases0)
+	}
+
+	for fault := uint64(1); fault <= total; fault++ {
+		dev, m := setup()
+		dev.PowerLossAt(fault)
+		interrupted := -1
+		for i, img := range updates {
+			if err := install(m, 1, img); err != nil {
+				if err != flashemu.ErrPowerLoss {
+					t.Fatalf("fault %d: update %d: %v", fault, i, err)
+				}
+				interrupted = i
+				break
+			}
+		}
+		if interrupted < 0 {
+			t.Fatalf("fault %d: the power was not lost", fault)
+		}
+
+		dev.PowerOn()
+		m = mount(t, dev)
+		check(t, m, 0, ota.Pending, pending)
+		st, err := m.Status(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch st.State {
+		case ota.Pending:
+			// the previous update, or the interrupted one if it was
+			// marked just before the power loss
+			ok := st.Header.Version == uint32(interrupted+2)
+			if interrupted > 0 {
+				ok = ok || st.Header.Version == uint32(interrupted+1)
+			}
+			if !ok {
+				t.Errorf("fault %d: slot 1 has version %d pending", fault, st.Header.Version)
+			}
+		case ota.Receiving:
+		case ota.Empty:
+			if interrupted > 0 {
+				t.Errorf("fault %d: slot 1 lost", fault)
+			}
+		default:
+			t.Errorf("fault %d: slot 1 is %v", fault, st.State)
+		}
+
+		// the manager must remain usable
+		for _, img := range updates[interrupted:] {
+			if err := install(m, 1, img); err != nil {
+				t.Fatalf("fault %d: %v", fault, err)
+			}
+		}
+		m = mount(t, dev)
+		check(t, m, 0, ota.Pending, pending)
+		check(t, m, 1, ota.Pending, updates[len(updates)-1])
+		if t.Failed() {
+			t.Fatalf("fault %d of %d", fault, total)
+		}
+	}
+	t.Logf("%d power loss points recovered", total)
+}
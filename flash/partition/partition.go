@@ -0,0 +1,308 @@
+// Package partition splits a flash memory, such as flash.Device, into named
+// regions described by a partition table stored on the memory itself.
+//
+// Every partition is opened as a Device of its own, with the same interface
+// as the whole memory but addresses relative to the start of the partition
+// and accesses outside of it refused, so that for example a filesystem, the
+// firmware update slots and a configuration store can each be handed just
+// their part of the memory:
+//
+//	table, err := partition.ReadTable(dev, 0)
+//	if err != nil {
+//		return err
+//	}
+//	fs, err := table.Open("fs")
+//
+// The table takes a whole erase block. It starts with a header:
+//
+//	magic    uint32 // "PTBL"
+//	version  uint16 // 1
+//	count    uint16 // number of entries
+//	crc      uint32 // CRC-32 of the entries
+//	reserved [4]byte
+//
+// followed by 32 byte entries:
+//
+//	name     [16]byte // zero padded
+//	offset   uint32 // in bytes, a multiple of the erase block size
+//	size     uint32 // in bytes, a multiple of the erase block size
+//	type     uint8
+//	flags    uint8
+//	reserved [6]byte
+//
+// All integers are little endian.
+package partition // import "tinygo.org/x/drivers/flash/partition"
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"tinygo.org/x/drivers"
+)
+
+// MaxNameLen is the maximum length of a partition name in bytes.
+const MaxNameLen = 16
+
+var (
+	ErrNoTable          = errors.New("partition: no partition table")
+	ErrNotFound         = errors.New("partition: partition not found")
+	ErrInvalidPartition = errors.New("partition: invalid partition")
+	ErrOverlap          = errors.New("partition: partitions overlap")
+	ErrTooMany          = errors.New("partition: too many partitions")
+	ErrOutOfBounds      = errors.New("partition: access outside of partition")
+	ErrReadOnly         = errors.New("partition: partition is read-only")
+)
+
+const (
+	tableMagic   = 0x4C425450 // "PTBL"
+	tableVersion = 1
+	headerSize   = 16
+	entrySize    = 32
+)
+
+// Type is the kind of content of a partition.
+type Type uint8
+
+const (
+	TypeData Type = iota
+	TypeFirmware
+	TypeFilesystem
+	TypeConfig
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeData:
+		return "data"
+	case TypeFirmware:
+		return "firmware"
+	case TypeFilesystem:
+		return "filesystem"
+	case TypeConfig:
+		return "config"
+	default:
+		return "unknown"
+	}
+}
+
+// Flags are properties of a partition.
+type Flags uint8
+
+const (
+	// FlagReadOnly makes Open return a device that refuses writes and
+	// erases.
+	FlagReadOnly Flags = 1 << iota
+)
+
+// Partition is an entry of the partition table.
+type Partition struct {
+	Name   string
+	Offset int64
+	Size   int64
+	Type   Type
+	Flags  Flags
+}
+
+// Table is the partition table of a memory.
+type Table struct {
+	dev        drivers.BlockDevice
+	block      int64
+	Partitions []Partition
+}
+
+// ReadTable reads the partition table in erase block block of dev.
+func ReadTable(dev drivers.BlockDevice, block int64) (*Table, error) {
+	bs := dev.EraseBlockSize()
+	var hdr [headerSize]byte
+	if _, err := dev.ReadAt(hdr[:], block*bs); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr[0:]) != tableMagic ||
+		binary.LittleEndian.Uint16(hdr[4:]) != tableVersion {
+		return nil, ErrNoTable
+	}
+	count := int64(binary.LittleEndian.Uint16(hdr[6:]))
+	if headerSize+count*entrySize > bs {
+		return nil, ErrNoTable
+	}
+	buf := make([]byte, count*entrySize)
+	if _, err := dev.ReadAt(buf, block*bs+headerSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr[8:]) != crc32.ChecksumIEEE(buf) {
+		return nil, ErrNoTable
+	}
+
+	t := &Table{dev: dev, block: block}
+	for e := buf; len(e) > 0; e = e[entrySize:] {
+		name := e[:MaxNameLen]
+		for i, c := range name {
+			if c == 0 {
+				name = name[:i]
+				break
+			}
+		}
+		t.Partitions = append(t.Partitions, Partition{
+			Name:   string(name),
+			Offset: int64(binary.LittleEndian.Uint32(e[16:])),
+			Size:   int64(binary.LittleEndian.Uint32(e[20:])),
+			Type:   Type(e[24]),
+			Flags:  Flags(e[25]),
+		})
+	}
+	return t, nil
+}
+
+// WriteTable checks the partitions and writes them as the partition table in
+// erase block block of dev, replacing any previous table. Partitions must be
+// aligned to erase blocks, fit in the memory, and not overlap each other or
+// the table. If power is lost while the table is written, it is lost.
+func WriteTable(dev drivers.BlockDevice, block int64, partitions []Partition) (*Table, error) {
+	bs := dev.EraseBlockSize()
+	if headerSize+int64(len(partitions))*entrySize > bs || len(partitions) > 0xFFFF {
+		return nil, ErrTooMany
+	}
+	table := Partition{Offset: block * bs, Size: bs}
+	for i, p := range partitions {
+		if p.Name == "" || len(p.Name) > MaxNameLen || p.Offset < 0 || p.Size <= 0 ||
+			p.Offset%bs != 0 || p.Size%bs != 0 || p.Offset+p.Size > dev.Size() ||
+			p.Offset+p.Size > 0xFFFFFFFF {
+			return nil, ErrInvalidPartition
+		}
+		if overlap(p, table) {
+			return nil, ErrOverlap
+		}
+		for _, q := range partitions[:i] {
+			if q.Name == p.Name {
+				return nil, ErrInvalidPartition
+			}
+			if overlap(p, q) {
+				return nil, ErrOverlap
+			}
+		}
+	}
+
+	buf := make([]byte, headerSize+len(partitions)*entrySize)
+	for i, p := range partitions {
+		e := buf[headerSize+i*entrySize:]
+		copy(e, p.Name)
+		binary.LittleEndian.PutUint32(e[16:], uint32(p.Offset))
+		binary.LittleEndian.PutUint32(e[20:], uint32(p.Size))
+		e[24] = byte(p.Type)
+		e[25] = byte(p.Flags)
+	}
+	binary.LittleEndian.PutUint32(buf[0:], tableMagic)
+	binary.LittleEndian.PutUint16(buf[4:], tableVersion)
+	binary.LittleEndian.PutUint16(buf[6:], uint16(len(partitions)))
+	binary.LittleEndian.PutUint32(buf[8:], crc32.ChecksumIEEE(buf[headerSize:]))
+
+	if err := dev.EraseBlocks(block, 1); err != nil {
+		return nil, err
+	}
+	if _, err := dev.WriteAt(buf, block*bs); err != nil {
+		return nil, err
+	}
+	return &Table{
+		dev:        dev,
+		block:      block,
+		Partitions: append([]Partition(nil), partitions...),
+	}, nil
+}
+
+func overlap(p, q Partition) bool {
+	return p.Offset < q.Offset+q.Size && q.Offset < p.Offset+p.Size
+}
+
+// Find returns the partition called name.
+func (t *Table) Find(name string) (Partition, error) {
+	for _, p := range t.Partitions {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Partition{}, ErrNotFound
+}
+
+// Open returns the device of the partition called name.
+func (t *Table) Open(name string) (*Device, error) {
+	p, err := t.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	return New(t.dev, p)
+}
+
+// Device is a partition of a memory. Addresses and erase block numbers are
+// relative to the start of the partition. It satisfies the
+// drivers.BlockDevice interface.
+type Device struct {
+	dev       drivers.BlockDevice
+	partition Partition
+	blockSize int64
+}
+
+// New returns the device of partition p of dev, which need not be in a
+// partition table.
+func New(dev drivers.BlockDevice, p Partition) (*Device, error) {
+	bs := dev.EraseBlockSize()
+	if p.Offset < 0 || p.Size <= 0 || p.Offset%bs != 0 || p.Size%bs != 0 ||
+		p.Offset+p.Size > dev.Size() {
+		return nil, ErrInvalidPartition
+	}
+	return &Device{dev: dev, partition: p, blockSize: bs}, nil
+}
+
+// Partition returns the table entry of the device.
+func (d *Device) Partition() Partition {
+	return d.partition
+}
+
+// ReadAt satisfies the io.ReaderAt interface.
+func (d *Device) ReadAt(buf []byte, off int64) (int, error) {
+	if !d.inside(off, int64(len(buf))) {
+		return 0, ErrOutOfBounds
+	}
+	return d.dev.ReadAt(buf, d.partition.Offset+off)
+}
+
+// WriteAt satisfies the io.WriterAt interface.
+func (d *Device) WriteAt(buf []byte, off int64) (int, error) {
+	if d.partition.Flags&FlagReadOnly != 0 {
+		return 0, ErrReadOnly
+	}
+	if !d.inside(off, int64(len(buf))) {
+		return 0, ErrOutOfBounds
+	}
+	return d.dev.WriteAt(buf, d.partition.Offset+off)
+}
+
+// Size returns the size of the partition in bytes.
+func (d *Device) Size() int64 {
+	return d.partition.Size
+}
+
+// WriteBlockSize returns the write block size of the memory.
+func (d *Device) WriteBlockSize() int64 {
+	return d.dev.WriteBlockSize()
+}
+
+// EraseBlockSize returns the erase block size of the memory.
+func (d *Device) EraseBlockSize() int64 {
+	return d.blockSize
+}
+
+// EraseBlocks erases len blocks starting at block start of the partition.
+func (d *Device) EraseBlocks(start, len int64) error {
+	if d.partition.Flags&FlagReadOnly != 0 {
+		return ErrReadOnly
+	}
+	if !d.inside(start*d.blockSize, len*d.blockSize) {
+		return ErrOutOfBounds
+	}
+	return d.dev.EraseBlocks(d.partition.Offset/d.blockSize+start, len)
+}
+
+func (d *Device) inside(off, n int64) bool {
+	return off >= 0 && n >= 0 && off+n <= d.partition.Size
+}
@@ -0,0 +1,223 @@
+package partition_test
+
+import (
+	"bytes"
+	"testing"
+
+	"tinygo.org/x/drivers/flash/flashemu"
+	"tinygo.org/x/drivers/flash/partition"
+)
+
+const (
+	pageSize   = 128
+	sectorSize = 512
+	sectors    = 32
+)
+
+var partitions = []partition.Partition{
+	{Name: "boot", Offset: 1 * sectorSize, Size: 7 * sectorSize, Type: partition.TypeFirmware, Flags: partition.FlagReadOnly},
+	{Name: "filesystem-16byt", Offset: 16 * sectorSize, Size: 16 * sectorSize, Type: partition.TypeFilesystem},
+	{Name: "config", Offset: 8 * sectorSize, Size: 2 * sectorSize, Type: partition.TypeConfig},
+}
+
+func newDevice() *flashemu.Device {
+	dev := flashemu.New(sectors*sectorSize, pageSize, sectorSize)
+	dev.Strict = true
+	return dev
+}
+
+func TestTable(t *testing.T) {
+	dev := newDevice()
+	if _, err := partition.ReadTable(dev, 0); err != partition.ErrNoTable {
+		t.Errorf("erased: got %v, want %v", err, partition.ErrNoTable)
+	}
+	for _, block := range []int64{0, 10} {
+		if _, err := partition.WriteTable(dev, block, partitions); err != nil {
+			t.Fatal(err)
+		}
+		table, err := partition.ReadTable(dev, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(table.Partitions) != len(partitions) {
+			t.Fatalf("got %v", table.Partitions)
+		}
+		for i, p := range table.Partitions {
+			if p != partitions[i] {
+				t.Errorf("got %+v, want %+v", p, partitions[i])
+			}
+		}
+		if p, err := table.Find("config"); err != nil || p != partitions[2] {
+			t.Errorf("Find: got %+v, %v", p, err)
+		}
+		if _, err := table.Open("swap"); err != partition.ErrNotFound {
+			t.Errorf("Open: got %v, want %v", err, partition.ErrNotFound)
+		}
+	}
+
+	// a changed byte of an entry fails the CRC
+	dev.Bytes()[10*sectorSize+16+40] ^= 1
+	if _, err := partition.ReadTable(dev, 10); err != partition.ErrNoTable {
+		t.Errorf("corrupted: got %v, want %v", err, partition.ErrNoTable)
+	}
+
+	// an empty table
+	if _, err := partition.WriteTable(dev, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if table, err := partition.ReadTable(dev, 0); err != nil || len(table.Partitions) != 0 {
+		t.Errorf("got %v, %v", table, err)
+	}
+}
+
+func TestWriteTableErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		p    partition.Partition
+		err  error
+	}{
+		{"no name", partition.Partition{Offset: 12 * sectorSize, Size: sectorSize}, partition.ErrInvalidPartition},
+		{"long name", partition.Partition{Name: "seventeen-letters", Offset: 12 * sectorSize, Size: sectorSize}, partition.ErrInvalidPartition},
+		{"same name", partition.Partition{Name: "config", Offset: 12 * sectorSize, Size: sectorSize}, partition.ErrInvalidPartition},
+		{"unaligned offset", partition.Partition{Name: "p", Offset: 12*sectorSize + pageSize, Size: sectorSize}, partition.ErrInvalidPartition},
+		{"unaligned size", partition.Partition{Name: "p", Offset: 12 * sectorSize, Size: sectorSize + pageSize}, partition.ErrInvalidPartition},
+		{"empty", partition.Partition{Name: "p", Offset: 12 * sectorSize}, partition.ErrInvalidPartition},
+		{"negative offset", partition.Partition{Name: "p", Offset: -sectorSize, Size: sectorSize}, partition.ErrInvalidPartition},
+		{"past the end", partition.Partition{Name: "p", Offset: 31 * sectorSize, Size: 2 * sectorSize}, partition.ErrInvalidPartition},
+		{"overlap", partition.Partition{Name: "p", Offset: 9 * sectorSize, Size: 3 * sectorSize}, partition.ErrOverlap},
+		{"inside another", partition.Partition{Name: "p", Offset: 20 * sectorSize, Size: sectorSize}, partition.ErrOverlap},
+		{"over the table", partition.Partition{Name: "p", Offset: 0, Size: sectorSize}, partition.ErrOverlap},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dev := newDevice()
+			if _, err := partition.WriteTable(dev, 0, append(partitions, tc.p)); err != tc.err {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+			// the memory is untouched
+			if _, programs, erases := dev.Stats(); programs != 0 || erases != 0 {
+				t.Errorf("%d programs, %d erases", programs, erases)
+			}
+		})
+	}
+
+	// the table is before the partitions, but may be anywhere
+	if _, err := partition.WriteTable(newDevice(), 8, partitions); err != partition.ErrOverlap {
+		t.Errorf("table in a partition: got %v, want %v", err, partition.ErrOverlap)
+	}
+	if _, err := partition.WriteTable(newDevice(), 12, partitions); err != nil {
+		t.Errorf("table between partitions: %v", err)
+	}
+}
+
+func TestTooMany(t *testing.T) {
+	// (512 - 16) / 32 entries fit in a block
+	var ps []partition.Partition
+	for i := 1; i <= 16; i++ {
+		ps = append(ps, partition.Partition{Name: string(rune('a' + i)), Offset: int64(i) * sectorSize, Size: sectorSize})
+	}
+	dev := newDevice()
+	if _, err := partition.WriteTable(dev, 0, ps); err != partition.ErrTooMany {
+		t.Errorf("16 partitions: got %v, want %v", err, partition.ErrTooMany)
+	}
+	if _, err := partition.WriteTable(dev, 0, ps[:15]); err != nil {
+		t.Errorf("15 partitions: %v", err)
+	}
+	if table, err := partition.ReadTable(dev, 0); err != nil || len(table.Partitions) != 15 {
+		t.Errorf("got %v, %v", table, err)
+	}
+
+	// a count that doesn't fit is not a table
+	dev.Bytes()[6] = 16
+	if _, err := partition.ReadTable(dev, 0); err != partition.ErrNoTable {
+		t.Errorf("count of 16: got %v, want %v", err, partition.ErrNoTable)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	dev := newDevice()
+	table, err := partition.WriteTable(dev, 0, partitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := table.Open("config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Size() != 2*sectorSize || config.EraseBlockSize() != sectorSize || config.WriteBlockSize() != pageSize {
+		t.Errorf("size %d, erase block %d, write block %d", config.Size(), config.EraseBlockSize(), config.WriteBlockSize())
+	}
+
+	// addresses are relative to the partition
+	data := []byte("calibration")
+	if n, err := config.WriteAt(data, 2*sectorSize-int64(len(data))); n != len(data) || err != nil {
+		t.Fatalf("WriteAt: got %d, %v", n, err)
+	}
+	if !bytes.Equal(dev.Bytes()[10*sectorSize-len(data):10*sectorSize], data) {
+		t.Error("written at the wrong address")
+	}
+	buf := make([]byte, len(data))
+	if n, err := config.ReadAt(buf, 2*sectorSize-int64(len(data))); n != len(data) || err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("ReadAt: got %d, %v, %q", n, err, buf)
+	}
+	if err := config.EraseBlocks(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if dev.EraseCount(9) != 1 || dev.EraseCount(8) != 0 || dev.EraseCount(10) != 0 {
+		t.Errorf("erased sectors %v", dev.EraseCounts()[:12])
+	}
+
+	// and accesses outside of it refused
+	for _, off := range []int64{-1, 2*sectorSize - 1, 2 * sectorSize} {
+		if _, err := config.ReadAt(buf, off); err != partition.ErrOutOfBounds {
+			t.Errorf("ReadAt %d: got %v, want %v", off, err, partition.ErrOutOfBounds)
+		}
+		if _, err := config.WriteAt(buf, off); err != partition.ErrOutOfBounds {
+			t.Errorf("WriteAt %d: got %v, want %v", off, err, partition.ErrOutOfBounds)
+		}
+	}
+	for _, blocks := range [][2]int64{{-1, 1}, {1, 2}, {2, 1}, {0, -1}} {
+		if err := config.EraseBlocks(blocks[0], blocks[1]); err != partition.ErrOutOfBounds {
+			t.Errorf("EraseBlocks %v: got %v, want %v", blocks, err, partition.ErrOutOfBounds)
+		}
+	}
+	if dev.EraseCount(7) != 0 || dev.EraseCount(10) != 0 {
+		t.Errorf("erased sectors %v", dev.EraseCounts()[:12])
+	}
+
+	// a read-only partition can only be read
+	boot, err := table.Open("boot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := boot.WriteAt(buf, 0); err != partition.ErrReadOnly {
+		t.Errorf("WriteAt: got %v, want %v", err, partition.ErrReadOnly)
+	}
+	if err := boot.EraseBlocks(0, 1); err != partition.ErrReadOnly {
+		t.Errorf("EraseBlocks: got %v, want %v", err, partition.ErrReadOnly)
+	}
+	if _, err := boot.ReadAt(buf, 0); err != nil {
+		t.Errorf("ReadAt: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	dev := newDevice()
+	for _, p := range []partition.Partition{
+		{Offset: pageSize, Size: sectorSize},
+		{Offset: sectorSize, Size: pageSize},
+		{Offset: sectorSize},
+		{Offset: 30 * sectorSize, Size: 4 * sectorSize},
+	} {
+		if _, err := partition.New(dev, p); err != partition.ErrInvalidPartition {
+			t.Errorf("%+v: got %v, want %v", p, err, partition.ErrInvalidPartition)
+		}
+	}
+	// without a table
+	d, err := partition.New(dev, partition.Partition{Offset: 30 * sectorSize, Size: 2 * sectorSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EraseBlocks(0, 2); err != nil || dev.EraseCount(30) != 1 || dev.EraseCount(31) != 1 {
+		t.Errorf("EraseBlocks: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package flash
+
+import "encoding/binary"
+
+// SFDP holds the parameters read from the Serial Flash Discoverable
+// Parameters (JEDEC JESD216) of a chip, taken from its Basic Flash
+// Parameter Table.
+type SFDP struct {
+	// Revision of the Basic Flash Parameter Table.
+	Major, Minor uint8
+
+	// Density is the size of the memory in bytes.
+	Density uint64
+
+	// AddressBytes is 3 or 4, the number of address bytes used by default.
+	// Chips of more than 16MiB may only support 4 byte addresses.
+	AddressBytes uint8
+
+	// EraseTypes lists the supported erase commands, smallest first.
+	EraseTypes [4]EraseType
+
+	// Fast read modes, named after the number of lines used for the
+	// command, address and data. The zero value is unsupported.
+	FastRead112, FastRead122, FastRead114, FastRead144 ReadMode
+
+	// PageSize is the size of a program page, 256 if not specified.
+	PageSize uint32
+
+	// QuadEnable is the quad enable requirement (QER): how to set the bit
+	// that enables the quad data lines. Zero if the chip has no such bit or
+	// the table doesn't tell.
+	QuadEnable QuadEnableRequirement
+
+	// Suspend and resume opcodes for program and erase operations, zero
+	// if unsupported.
+	ProgramSuspend, ProgramResume, EraseSuspend, EraseResume byte
+
+	hasQER bool // the table is recent enough to include QuadEnable
+}
+
+// EraseType is an erase command and the size it erases.
+type EraseType struct {
+	Size   uint32
+	Opcode byte
+}
+
+// ReadMode is a fast read command and the number of clocks between the
+// address and the data, including mode clocks.
+type ReadMode struct {
+	Opcode      byte
+	DummyClocks uint8
+}
+
+// QuadEnableRequirement encodes the location of the quad enable bit.
+type QuadEnableRequirement uint8
+
+const (
+	// QENone: the chip has no quad enable bit.
+	QENone QuadEnableRequirement = iota
+
+	// QESR2Bit1: bit 1 of status register 2, written together with status
+	// register 1 using 0x01. Writing one byte clears status register 2.
+	QESR2Bit1
+
+	// QESR1Bit6: bit 6 of status register 1, written with 0x01.
+	QESR1Bit6
+
+	// QESR2Bit7: bit 7 of status register 2, written with 0x3E and read
+	// with 0x3F.
+	QESR2Bit7
+
+	// QESR2Bit1NoClear: bit 1 of status register 2, written together with
+	// status register 1 using 0x01.
+	QESR2Bit1NoClear
+
+	// QESR2Bit1Read35: like QESR2Bit1NoClear, status register 2 is read with
+	// 0x35.
+	QESR2Bit1Read35
+
+	// QESR2Bit1Write31: bit 1 of status register 2, written with 0x31 and
+	// read with 0x35.
+	QESR2Bit1Write31
+)
+
+const (
+	cmdReadSFDP = 0x5A // read the SFDP tables, with 8 dummy clocks
+
+	sfdpSignature = 0x50444653 // "SFDP"
+	sfdpBasicID   = 0xFF00     // parameter ID of the Basic Flash Parameter Table
+)
+
+// ReadSFDP reads from the SFDP address space of the chip.
+func (dev *Device) ReadSFDP(addr uint32, buf []byte) error {
+	if err := dev.WaitUntilReady(); err != nil {
+		return err
+	}
+	return dev.trans.readSFDP(addr, buf)
+}
+
+// ParseSFDP reads the SFDP header and the Basic Flash Parameter Table using
+// read, which reads from the SFDP address space, such as Device.ReadSFDP.
+func ParseSFDP(read func(addr uint32, buf []byte) error) (*SFDP, error) {
+	var hdr [8]byte
+	if err := read(0, hdr[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(hdr[:]) != sfdpSignature || hdr[5] != 1 {
+		return nil, ErrNoSFDP
+	}
+
+	// pick the most recent basic table of major revision 1
+	params := make([]byte, 8*(int(hdr[6])+1))
+	if err := read(8, params); err != nil {
+		return nil, err
+	}
+	var best []byte
+	for p := params; len(p) >= 8; p = p[8:] {
+		id := uint16(p[7])<<8 | uint16(p[0])
+		if id != sfdpBasicID || p[2] != 1 || p[3] < 9 {
+			continue
+		}
+		if best == nil || p[1] > best[1] {
+			best = p[:8]
+		}
+	}
+	if best == nil {
+		return nil, ErrNoSFDP
+	}
+	words := int(best[3])
+	if words > 20 {
+		words = 20
+	}
+	table := make([]byte, 4*words)
+	ptr := uint32(best[4]) | uint32(best[5])<<8 | uint32(best[6])<<16
+	if err := read(ptr, table); err != nil {
+		return nil, err
+	}
+	s := parseBasicTable(table)
+	s.Major, s.Minor = best[2], best[1]
+	return s, nil
+}
+
+// parseBasicTable decodes the DWORDs of a Basic Flash Parameter Table.
+func parseBasicTable(table []byte) *SFDP {
+	dw := func(n int) uint32 {
+		// DWORDs are numbered from 1 in the standard
+		if 4*n > len(table) {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(table[4*(n-1):])
+	}
+	s := &SFDP{PageSize: PageSize}
+
+	d1 := dw(1)
+	switch (d1 >> 17) & 3 {
+	case 2:
+		s.AddressBytes = 4
+	default:
+		s.AddressBytes = 3
+	}
+	if d2 := dw(2); d2&0x80000000 == 0 {
+		s.Density = (uint64(d2) + 1) / 8
+	} else if n := d2 & 0x7FFFFFFF; n >= 3 && n < 67 {
+		s.Density = 1 << (n - 3)
+	}
+
+	mode := func(v uint32) ReadMode {
+		return ReadMode{Opcode: byte(v >> 8), DummyClocks: uint8(v&0x1F) + uint8((v>>5)&0x7)}
+	}
+	if d1&(1<<21) != 0 {
+		s.FastRead144 = mode(dw(3))
+	}
+	if d1&(1<<22) != 0 {
+		s.FastRead114 = mode(dw(3) >> 16)
+	}
+	if d1&(1<<16) != 0 {
+		s.FastRead112 = mode(dw(4))
+	}
+	if d1&(1<<20) != 0 {
+		s.FastRead122 = mode(dw(4) >> 16)
+	}
+
+	// erase types, with the 4kB erase of DWORD 1 as a fallback
+	n := 0
+	for _, v := range []uint32{dw(8), dw(8) >> 16, dw(9), dw(9) >> 16} {
+		if exp := v & 0xFF; exp != 0 && exp < 32 {
+			s.EraseTypes[n] = EraseType{Size: 1 << exp, Opcode: byte(v >> 8)}
+			n++
+		}
+	}
+	if n == 0 && d1&3 == 1 {
+		s.EraseTypes[0] = EraseType{Size: SectorSize, Opcode: byte(d1 >> 8)}
+		n = 1
+	}
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && s.EraseTypes[j].Size < s.EraseTypes[j-1].Size; j-- {
+			s.EraseTypes[j], s.EraseTypes[j-1] = s.EraseTypes[j-1], s.EraseTypes[j]
+		}
+	}
+
+	// JESD216A and later
+	if len(table) >= 4*16 {
+		if exp := (dw(11) >> 4) & 0xF; exp != 0 {
+			s.PageSize = 1 << exp
+		}
+		if dw(12)&(1<<31) == 0 {
+			d13 := dw(13)
+			s.ProgramResume = byte(d13)
+			s.ProgramSuspend = byte(d13 >> 8)
+			s.EraseResume = byte(d13 >> 16)
+			s.EraseSuspend = byte(d13 >> 24)
+		}
+		s.QuadEnable = QuadEnableRequirement((dw(15) >> 20) & 7)
+		s.hasQER = true
+	}
+	return s
+}
+
+// Attrs returns the attributes of a chip described by the SFDP tables.
+// Only the features used by this package are reported: quad reads are
+// supported if the chip has the 0x6B command with 8 dummy clocks and a quad
+// enable bit that Configure knows how to set.
+func (s *SFDP) Attrs(id JedecID) Attrs {
+	attrs := Attrs{
+		TotalSize:        uint32(s.Density),
+		JedecID:          id,
+		SupportsFastRead: true,
+		EraseTypes:       s.EraseTypes,
+		SuspendOpcode:    s.EraseSuspend,
+		ResumeOpcode:     s.EraseResume,
+	}
+	if s.AddressBytes == 4 {
+		attrs.FourByteAddress = true
+	} else if s.Density > 1<<24 {
+		// only the first 16MiB can be reached with 3 byte addresses
+		attrs.TotalSize = 1 << 24
+	}
+	switch s.QuadEnable {
+	case QESR2Bit1, QESR2Bit1NoClear, QESR2Bit1Read35:
+		attrs.QuadEnableBitMask = 0x02
+	case QESR1Bit6:
+		attrs.QuadEnableBitMask = 0x40
+		attrs.SingleStatusByte = true
+	case QESR2Bit1Write31:
+		attrs.QuadEnableBitMask = 0x02
+		attrs.WriteStatusSplit = true
+	}
+	attrs.SupportsQSPI = s.FastRead114 == ReadMode{Opcode: cmdQuadRead, DummyClocks: 8} &&
+		(attrs.QuadEnableBitMask != 0 || s.QuadEnable == QENone && s.hasQER)
+	return attrs
+}
@@ -0,0 +1,230 @@
+package flash
+
+import "testing"
+
+// sfdpDump is the start of the SFDP address space of a chip: the header,
+// the parameter headers and the Basic Flash Parameter Table.
+//
+// The tables below are typed by hand from the JESD216 layouts and the SFDP
+// sections of the datasheets of the named chips. They are not dumps read
+// from real W25Q or GD25Q chips, none of which were available, so a mistake
+// in reading a datasheet would be repeated in both the table and the
+// expectations. Dumps from real chips should replace them.
+type sfdpDump struct {
+	name  string
+	id    JedecID
+	data  []byte
+	sfdp  SFDP
+	attrs Attrs
+}
+
+// dump places the parameter headers after the SFDP header and the basic
+// table at ptr.
+func dump(header, params []byte, ptr int, table []byte) []byte {
+	b := make([]byte, ptr+len(table))
+	for i := range b {
+		b[i] = 0xFF
+	}
+	copy(b, header)
+	copy(b[8:], params)
+	copy(b[ptr:], table)
+	return b
+}
+
+var standardEraseTypes = [4]EraseType{
+	{Size: 4096, Opcode: 0x20},
+	{Size: 32768, Opcode: 0x52},
+	{Size: 65536, Opcode: 0xD8},
+}
+
+var sfdpDumps = []sfdpDump{
+	{
+		// JESD216B table with suspend commands and the quad enable bit
+		name: "W25Q128JV",
+		id:   JedecID{0xEF, 0x40, 0x18},
+		data: dump(
+			[]byte{0x53, 0x46, 0x44, 0x50, 0x06, 0x01, 0x00, 0xFF},
+			[]byte{0x00, 0x06, 0x01, 0x10, 0x80, 0x00, 0x00, 0xFF},
+			0x80,
+			[]byte{
+				0xE5, 0x20, 0xF9, 0xFF, 0xFF, 0xFF, 0xFF, 0x07,
+				0x44, 0xEB, 0x08, 0x6B, 0x08, 0x3B, 0x42, 0xBB,
+				0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00,
+				0xFF, 0xFF, 0x40, 0xEB, 0x0C, 0x20, 0x0F, 0x52,
+				0x10, 0xD8, 0x00, 0x00, 0x36, 0x02, 0xA6, 0x00,
+				0x82, 0xEA, 0x14, 0xC9, 0xE9, 0x63, 0x76, 0x33,
+				0x7A, 0x75, 0x7A, 0x75, 0xF7, 0xA2, 0xD5, 0x5C,
+				0x19, 0xF7, 0x4D, 0xFF, 0xE9, 0x30, 0xF8, 0x80,
+			}),
+		sfdp: SFDP{
+			Major: 1, Minor: 6,
+			Density:        16 << 20,
+			AddressBytes:   3,
+			EraseTypes:     standardEraseTypes,
+			FastRead112:    ReadMode{Opcode: 0x3B, DummyClocks: 8},
+			FastRead122:    ReadMode{Opcode: 0xBB, DummyClocks: 4},
+			FastRead114:    ReadMode{Opcode: 0x6B, DummyClocks: 8},
+			FastRead144:    ReadMode{Opcode: 0xEB, DummyClocks: 6},
+			PageSize:       256,
+			QuadEnable:     QESR2Bit1NoClear,
+			ProgramSuspend: 0x75, ProgramResume: 0x7A,
+			EraseSuspend: 0x75, EraseResume: 0x7A,
+			hasQER: true,
+		},
+		attrs: Attrs{
+			TotalSize:         16 << 20,
+			JedecID:           JedecID{0xEF, 0x40, 0x18},
+			QuadEnableBitMask: 0x02,
+			SupportsFastRead:  true,
+			SupportsQSPI:      true,
+			EraseTypes:        standardEraseTypes,
+			SuspendOpcode:     0x75,
+			ResumeOpcode:      0x7A,
+		},
+	},
+	{
+		// JESD216 table of 9 DWORDs, which doesn't tell how to enable the
+		// quad data lines
+		name: "GD25Q64C",
+		id:   JedecID{0xC8, 0x40, 0x17},
+		data: dump(
+			[]byte{0x53, 0x46, 0x44, 0x50, 0x00, 0x01, 0x01, 0xFF},
+			[]byte{
+				0x00, 0x00, 0x01, 0x09, 0x30, 0x00, 0x00, 0xFF,
+				0xC8, 0x00, 0x01, 0x03, 0x60, 0x00, 0x00, 0xFF,
+			},
+			0x30,
+			[]byte{
+				0xE5, 0x20, 0xF1, 0xFF, 0xFF, 0xFF, 0xFF, 0x03,
+				0x44, 0xEB, 0x08, 0x6B, 0x08, 0x3B, 0x80, 0xBB,
+				0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0xFF,
+				0xFF, 0xFF, 0x44, 0xEB, 0x0C, 0x20, 0x0F, 0x52,
+				0x10, 0xD8, 0x00, 0xFF,
+			}),
+		sfdp: SFDP{
+			Major: 1, Minor: 0,
+			Density:      8 << 20,
+			AddressBytes: 3,
+			EraseTypes:   standardEraseTypes,
+			FastRead112:  ReadMode{Opcode: 0x3B, DummyClocks: 8},
+			FastRead122:  ReadMode{Opcode: 0xBB, DummyClocks: 4},
+			FastRead114:  ReadMode{Opcode: 0x6B, DummyClocks: 8},
+			FastRead144:  ReadMode{Opcode: 0xEB, DummyClocks: 6},
+			PageSize:     256,
+		},
+		attrs: Attrs{
+			TotalSize:        8 << 20,
+			JedecID:          JedecID{0xC8, 0x40, 0x17},
+			SupportsFastRead: true,
+			EraseTypes:       standardEraseTypes,
+		},
+	},
+	{
+		// JESD216 table followed by a vendor table
+		name: "MX25L12835F",
+		id:   JedecID{0xC2, 0x20, 0x18},
+		data: dump(
+			[]byte{0x53, 0x46, 0x44, 0x50, 0x00, 0x01, 0x01, 0xFF},
+			[]byte{
+				0x00, 0x00, 0x01, 0x09, 0x30, 0x00, 0x00, 0xFF,
+				0xC2, 0x00, 0x01, 0x04, 0x60, 0x00, 0x00, 0xFF,
+			},
+			0x30,
+			[]byte{
+				0xE5, 0x20, 0xF1, 0xFF, 0xFF, 0xFF, 0xFF, 0x07,
+				0x44, 0xEB, 0x08, 0x6B, 0x08, 0x3B, 0x04, 0xBB,
+				0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0xFF,
+				0xFF, 0xFF, 0x44, 0xEB, 0x0C, 0x20, 0x0F, 0x52,
+				0x10, 0xD8, 0x00, 0xFF,
+			}),
+		sfdp: SFDP{
+			Major: 1, Minor: 0,
+			Density:      16 << 20,
+			AddressBytes: 3,
+			EraseTypes:   standardEraseTypes,
+			FastRead112:  ReadMode{Opcode: 0x3B, DummyClocks: 8},
+			FastRead122:  ReadMode{Opcode: 0xBB, DummyClocks: 4},
+			FastRead114:  ReadMode{Opcode: 0x6B, DummyClocks: 8},
+			FastRead144:  ReadMode{Opcode: 0xEB, DummyClocks: 6},
+			PageSize:     256,
+		},
+		attrs: Attrs{
+			TotalSize:        16 << 20,
+			JedecID:          JedecID{0xC2, 0x20, 0x18},
+			SupportsFastRead: true,
+			EraseTypes:       standardEraseTypes,
+		},
+	},
+}
+
+// reader returns a function reading from the SFDP address space in data.
+func reader(data []byte) func(addr uint32, buf []byte) error {
+	return func(addr uint32, buf []byte) error {
+		for i := range buf {
+			buf[i] = 0xFF
+			if int(addr)+i < len(data) {
+				buf[i] = data[int(addr)+i]
+			}
+		}
+		return nil
+	}
+}
+
+func TestParseSFDP(t *testing.T) {
+	for _, d := range sfdpDumps {
+		t.Run(d.name, func(t *testing.T) {
+			s, err := ParseSFDP(reader(d.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *s != d.sfdp {
+				t.Errorf("got %+v\nwant %+v", *s, d.sfdp)
+			}
+			if attrs := s.Attrs(d.id); attrs != d.attrs {
+				t.Errorf("attrs: got %+v\nwant %+v", attrs, d.attrs)
+			}
+		})
+	}
+}
+
+func TestParseSFDPNone(t *testing.T) {
+	// no SFDP support, the chip doesn't drive the data line
+	if _, err := ParseSFDP(reader(nil)); err != ErrNoSFDP {
+		t.Errorf("got %v, want %v", err, ErrNoSFDP)
+	}
+	// only a vendor table
+	data := dump(
+		[]byte{0x53, 0x46, 0x44, 0x50, 0x00, 0x01, 0x00, 0xFF},
+		[]byte{0xC2, 0x00, 0x01, 0x04, 0x10, 0x00, 0x00, 0xFF},
+		0x10, make([]byte, 16))
+	if _, err := ParseSFDP(reader(data)); err != ErrNoSFDP {
+		t.Errorf("vendor table: got %v, want %v", err, ErrNoSFDP)
+	}
+}
+
+// TestSFDPAddressBytes checks the size of chips of more than 16MiB, using
+// the W25Q128JV table with a larger density and other address modes.
+func TestSFDPAddressBytes(t *testing.T) {
+	for _, tc := range []struct {
+		mode  byte // DWORD 1 bits 17-18
+		bytes uint8
+		size  uint32
+		four  bool
+	}{
+		{0, 3, 16 << 20, false},
+		{1, 3, 16 << 20, false},
+		{2, 4, 32 << 20, true},
+	} {
+		data := append([]byte(nil), sfdpDumps[0].data...)
+		data[0x82] = data[0x82]&^0x06 | tc.mode<<1
+		data[0x87] = 0x0F // 256Mbit
+		s, err := ParseSFDP(reader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs := s.Attrs(JedecID{0xEF, 0x40, 0x19})
+		if s.AddressBytes != tc.bytes || attrs.TotalSize != tc.size || attrs.FourByteAddress != tc.four {
+			t.Errorf("mode %d: got %d address bytes, size %d, 4 byte addresses %v", tc.mode, s.AddressBytes, attrs.TotalSize, attrs.FourByteAddress)
+		}
+	}
+}
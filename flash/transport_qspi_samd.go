@@ -73,6 +73,16 @@ const (
 		sam.QSPI_INSTRFRAME_DATAEN |
 		(sam.QSPI_INSTRFRAME_TFRTYPE_WRITEMEMORY << sam.QSPI_INSTRFRAME_TFRTYPE_Pos)
 
+	// Instruction frame to read the SFDP tables, using single-bit transfers
+	iframeReadSFDP = 0x0 |
+		sam.QSPI_INSTRFRAME_WIDTH_SINGLE_BIT_SPI |
+		sam.QSPI_INSTRFRAME_ADDRLEN_24BITS |
+		sam.QSPI_INSTRFRAME_INSTREN |
+		sam.QSPI_INSTRFRAME_ADDREN |
+		sam.QSPI_INSTRFRAME_DATAEN |
+		(8 << sam.QSPI_INSTRFRAME_DUMMYLEN_Pos) |
+		(sam.QSPI_INSTRFRAME_TFRTYPE_READ << sam.QSPI_INSTRFRAME_TFRTYPE_Pos)
+
 	// Instruction frame for running an erase command that requires and address
 	iframeEraseCommand = 0x0 |
 		sam.QSPI_INSTRFRAME_WIDTH_SINGLE_BIT_SPI |
@@ -121,6 +131,14 @@ func (q qspiTransport) configure(config *DeviceConfig) {
 	sam.QSPI.CTRLA.SetBits(sam.QSPI_CTRLA_ENABLE)
 }
 
+func (q qspiTransport) setFourByteAddress(enable bool) error {
+	// the memory is mapped into a 16MiB window, which 3 byte addresses cover
+	if enable {
+		return ErrAddressSize
+	}
+	return nil
+}
+
 func (q qspiTransport) supportQuadMode() bool {
 	return true
 }
@@ -190,6 +208,16 @@ func (q qspiTransport) writeMemory(addr uint32, data []byte) (err error) {
 	return
 }
 
+func (q qspiTransport) readSFDP(addr uint32, buf []byte) (err error) {
+	q.disableAndClearCache()
+	sam.QSPI.INSTRADDR.Set(addr)
+	q.runInstruction(cmdReadSFDP, iframeReadSFDP)
+	q.readInto(buf, 0)
+	q.endTransfer()
+	q.enableCache()
+	return
+}
+
 func (q qspiTransport) eraseCommand(cmd byte, addr uint32) (err error) {
 	q.disableAndClearCache()
 	sam.QSPI.INSTRADDR.Set(addr)
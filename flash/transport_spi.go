@@ -12,6 +12,8 @@ type transport interface {
 	eraseCommand(cmd byte, address uint32) (err error)
 	readMemory(addr uint32, rsp []byte) (err error)
 	writeMemory(addr uint32, data []byte) (err error)
+	readSFDP(addr uint32, rsp []byte) (err error)
+	setFourByteAddress(enable bool) error
 }
 
 // NewSPI returns a pointer to a flash device that uses a SPI peripheral to
@@ -34,6 +36,8 @@ type spiTransport struct {
 	miso machine.Pin
 	sck  machine.Pin
 	ss   machine.Pin
+
+	fourByteAddress bool
 }
 
 func (tr *spiTransport) configure(config *DeviceConfig) {
@@ -62,6 +66,11 @@ func (tr *spiTransport) setClockSpeed(hz uint32) error {
 	return nil
 }
 
+func (tr *spiTransport) setFourByteAddress(enable bool) error {
+	tr.fourByteAddress = enable
+	return nil
+}
+
 func (tr *spiTransport) supportQuadMode() bool {
 	return false
 }
@@ -125,16 +134,27 @@ func (tr *spiTransport) writeMemory(addr uint32, data []byte) (err error) {
 	return
 }
 
-func (tr *spiTransport) sendAddress(cmd byte, addr uint32) error {
-	_, err := tr.spi.Transfer(byte(cmd))
-	if err == nil {
-		_, err = tr.spi.Transfer(byte((addr >> 16) & 0xFF))
+func (tr *spiTransport) readSFDP(addr uint32, rsp []byte) (err error) {
+	tr.ss.Low()
+	if err = tr.sendAddress(cmdReadSFDP, addr); err == nil {
+		// 8 dummy clocks
+		if _, err = tr.spi.Transfer(0xFF); err == nil {
+			err = tr.readInto(rsp)
+		}
 	}
-	if err == nil {
-		_, err = tr.spi.Transfer(byte((addr >> 8) & 0xFF))
+	tr.ss.High()
+	return
+}
+
+func (tr *spiTransport) sendAddress(cmd byte, addr uint32) error {
+	shift := 16
+	if tr.fourByteAddress && cmd != cmdReadSFDP {
+		// the SFDP tables always use 3 byte addresses
+		shift = 24
 	}
-	if err == nil {
-		_, err = tr.spi.Transfer(byte(addr & 0xFF))
+	_, err := tr.spi.Transfer(byte(cmd))
+	for ; shift >= 0 && err == nil; shift -= 8 {
+		_, err = tr.spi.Transfer(byte(addr >> uint(shift)))
 	}
 	return err
 }
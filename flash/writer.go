@@ -0,0 +1,200 @@
+package flash
+
+import (
+	"hash/crc32"
+	"io"
+
+	"tinygo.org/x/drivers"
+)
+
+// Writer overwrites arbitrary ranges of a memory such as Device, which by
+// itself can only write to erased memory. Writes are buffered one erase block
+// at a time; when a write moves on to another block, or on Flush, the block
+// is erased and written back if needed. Blocks whose new content only clears
+// bits are programmed without erasing, and unchanged pages are skipped.
+//
+// Data is only safe on the memory after Flush. If power is lost while a
+// block is written back, the whole block may be lost.
+type Writer struct {
+	// Verify makes the writer read back every block it writes and compare it
+	// with the expected content, failing with ErrVerifyFailed on a mismatch.
+	Verify bool
+
+	dev   drivers.BlockDevice
+	buf   []byte // content of the buffered block
+	page  []byte // scratch buffer of a write block
+	block int64  // number of the buffered block, -1 if none
+	dirty bool
+}
+
+// NewWriter returns a Writer that writes to dev.
+func NewWriter(dev drivers.BlockDevice) *Writer {
+	return &Writer{
+		dev:   dev,
+		buf:   make([]byte, dev.EraseBlockSize()),
+		page:  make([]byte, dev.WriteBlockSize()),
+		block: -1,
+	}
+}
+
+// WriteAt satisfies the io.WriterAt interface. The written data is buffered
+// and may only reach the memory on a later write or Flush.
+func (w *Writer) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off+int64(len(p)) > w.dev.Size() {
+		return 0, ErrInvalidAddrRange
+	}
+	bs := int64(len(w.buf))
+	for n < len(p) {
+		if err = w.load((off + int64(n)) / bs); err != nil {
+			return
+		}
+		n += copy(w.buf[(off+int64(n))%bs:], p[n:])
+		w.dirty = true
+	}
+	return
+}
+
+// ReadAt satisfies the io.ReaderAt interface, returning the data written so
+// far, including buffered data.
+func (w *Writer) ReadAt(p []byte, off int64) (int, error) {
+	n, err := w.dev.ReadAt(p, off)
+	if err != nil || w.block < 0 {
+		return n, err
+	}
+	bs := int64(len(w.buf))
+	start, end := w.block*bs, (w.block+1)*bs
+	if off < end && off+int64(len(p)) > start {
+		if off < start {
+			copy(p[start-off:], w.buf)
+		} else {
+			copy(p, w.buf[off-start:])
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the buffered block to the memory.
+func (w *Writer) Flush() error {
+	if !w.dirty {
+		return nil
+	}
+	bs := int64(len(w.buf))
+	ps := int64(len(w.page))
+	addr := w.block * bs
+
+	// erasing is only needed to set bits
+	erase := false
+	for off := int64(0); off < bs && !erase; off += ps {
+		if _, err := w.dev.ReadAt(w.page, addr+off); err != nil {
+			return err
+		}
+		for i, c := range w.buf[off : off+ps] {
+			if c&^w.page[i] != 0 {
+				erase = true
+				break
+			}
+		}
+	}
+	if erase {
+		if err := w.dev.EraseBlocks(w.block, 1); err != nil {
+			return err
+		}
+	}
+
+	for off := int64(0); off < bs; off += ps {
+		data := w.buf[off : off+ps]
+		if erase {
+			if isErased(data) {
+				continue
+			}
+		} else {
+			if _, err := w.dev.ReadAt(w.page, addr+off); err != nil {
+				return err
+			}
+			if string(w.page) == string(data) {
+				continue
+			}
+		}
+		if _, err := w.dev.WriteAt(data, addr+off); err != nil {
+			return err
+		}
+	}
+
+	if w.Verify {
+		if err := verify(w.dev, w.buf, addr, w.page); err != nil {
+			return err
+		}
+	}
+	w.dirty = false
+	return nil
+}
+
+// load makes block the buffered block, writing back the previous one.
+func (w *Writer) load(block int64) error {
+	if block == w.block {
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.block = -1
+	if _, err := w.dev.ReadAt(w.buf, block*int64(len(w.buf))); err != nil {
+		return err
+	}
+	w.block = block
+	return nil
+}
+
+// Verify reads back len(buf) bytes starting at addr and compares them with
+// buf, returning ErrVerifyFailed if they differ.
+func (dev *Device) Verify(buf []byte, addr int64) error {
+	return verify(dev, buf, addr, make([]byte, PageSize))
+}
+
+// Checksum returns the CRC-32 (IEEE) of length bytes of memory starting at
+// addr, the same checksum as computed by the hash/crc32 package.
+func (dev *Device) Checksum(addr, length int64) (uint32, error) {
+	var crc uint32
+	buf := make([]byte, PageSize)
+	for length > 0 {
+		if length < int64(len(buf)) {
+			buf = buf[:length]
+		}
+		if _, err := dev.ReadAt(buf, addr); err != nil {
+			return 0, err
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, buf)
+		addr += int64(len(buf))
+		length -= int64(len(buf))
+	}
+	return crc, nil
+}
+
+// verify compares buf with the memory at addr, reading it in chunks of the
+// size of tmp.
+func verify(r io.ReaderAt, buf []byte, addr int64, tmp []byte) error {
+	for len(buf) > 0 {
+		if len(buf) < len(tmp) {
+			tmp = tmp[:len(buf)]
+		}
+		if _, err := r.ReadAt(tmp, addr); err != nil {
+			return err
+		}
+		if string(tmp) != string(buf[:len(tmp)]) {
+			return ErrVerifyFailed
+		}
+		buf = buf[len(tmp):]
+		addr += int64(len(tmp))
+	}
+	return nil
+}
+
+// isErased returns whether all bytes of buf are 0xFF.
+func isErased(buf []byte) bool {
+	for _, c := range buf {
+		if c != 0xFF {
+			return false
+		}
+	}
+	return true
+}
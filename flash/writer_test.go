@@ -0,0 +1,249 @@
+package flash
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+
+	"tinygo.org/x/drivers/flash/flashemu"
+)
+
+// emuTransport runs the commands of a Device on an emulated chip.
+type emuTransport struct {
+	fakeTransport
+	mem *flashemu.Device
+}
+
+func (tr *emuTransport) readMemory(addr uint32, buf []byte) error {
+	_, err := tr.mem.ReadAt(buf, int64(addr))
+	return err
+}
+
+func (tr *emuTransport) writeMemory(addr uint32, data []byte) error {
+	return tr.mem.ProgramPage(int64(addr), data)
+}
+
+func (tr *emuTransport) eraseCommand(cmd byte, addr uint32) error {
+	size := map[byte]int64{cmdEraseSector: SectorSize, cmdEraseBlock32: 32 * 1024, cmdEraseBlock: BlockSize}[cmd]
+	return tr.mem.EraseBlocks(int64(addr)/SectorSize, size/SectorSize)
+}
+
+func (tr *emuTransport) runCommand(cmd byte) error {
+	if cmd == cmdEraseChip {
+		return tr.mem.EraseAll()
+	}
+	return nil
+}
+
+// newEmuDevice returns a Device on an emulated chip of 64 kB.
+func newEmuDevice() (*Device, *flashemu.Device) {
+	mem := flashemu.New(64*1024, PageSize, SectorSize)
+	mem.Strict = true
+	dev := &Device{
+		trans: &emuTransport{mem: mem},
+		attrs: Attrs{TotalSize: 64 * 1024},
+	}
+	return dev, mem
+}
+
+// newWriterDevice returns an emulated chip with small erase blocks, filled
+// with random data, and a copy of its content.
+func newWriterDevice(t *testing.T) (*flashemu.Device, []byte) {
+	mem := flashemu.New(8*1024, 256, 1024)
+	mem.Strict = true
+	want := make([]byte, mem.Size())
+	rand.New(rand.NewSource(1)).Read(want)
+	if _, err := mem.WriteAt(want, 0); err != nil {
+		t.Fatal(err)
+	}
+	return mem, want
+}
+
+// check compares the memory with want.
+func check(t *testing.T, mem *flashemu.Device, want []byte) {
+	t.Helper()
+	if got := mem.Bytes(); !bytes.Equal(got, want) {
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("first difference at %#x: got %#02x, want %#02x", i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestWriterUnaligned(t *testing.T) {
+	mem, want := newWriterDevice(t)
+	w := NewWriter(mem)
+	_, _, erases := mem.Stats()
+
+	// from the middle of a page of block 0 to the middle of block 3
+	data := bytes.Repeat([]byte{0x5A, 0xA5, 0xFF, 0x00}, 625)
+	if n, err := w.WriteAt(data, 700); n != len(data) || err != nil {
+		t.Fatalf("WriteAt: %d, %v", n, err)
+	}
+	copy(want[700:], data)
+
+	// the buffered block is read back before it is flushed
+	got := make([]byte, 3000)
+	if _, err := w.ReadAt(got, 500); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want[500:3500]) {
+		t.Error("ReadAt does not return the written data")
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, mem, want)
+	if _, _, n := mem.Stats(); n-erases != 4 {
+		t.Errorf("erased %d blocks, want 4", n-erases)
+	}
+
+	if _, err := w.WriteAt(data, mem.Size()-int64(len(data))+1); err != ErrInvalidAddrRange {
+		t.Errorf("WriteAt past the end: got %v, want %v", err, ErrInvalidAddrRange)
+	}
+	if _, err := w.WriteAt(data[:1], -1); err != ErrInvalidAddrRange {
+		t.Errorf("WriteAt before the start: got %v, want %v", err, ErrInvalidAddrRange)
+	}
+}
+
+// TestWriterClearBits checks that a write that only clears bits is programmed
+// without erasing, and that unchanged pages are not programmed again.
+func TestWriterClearBits(t *testing.T) {
+	mem, want := newWriterDevice(t)
+	w := NewWriter(mem)
+	_, programs, erases := mem.Stats()
+
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = want[2100+i] & 0x0F
+	}
+	if _, err := w.WriteAt(data, 2100); err != nil {
+		t.Fatal(err)
+	}
+	copy(want[2100:], data)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, mem, want)
+	// 2100 to 2400 is in the pages at 2048 and 2304 of block 2
+	if _, p, e := mem.Stats(); e != erases || p-programs != 2 {
+		t.Errorf("%d erases and %d programs, want 0 and 2", e-erases, p-programs)
+	}
+}
+
+// TestWriterFlush checks that flushing a partly written block keeps the rest
+// of it, and skips the pages left erased.
+func TestWriterFlush(t *testing.T) {
+	mem, want := newWriterDevice(t)
+	if err := mem.EraseBlocks(4, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.WriteAt(want[4096:4096+512], 4096); err != nil {
+		t.Fatal(err)
+	}
+	for i := 4096 + 512; i < 5120; i++ {
+		want[i] = 0xFF
+	}
+	w := NewWriter(mem)
+	w.Verify = true
+	_, programs, erases := mem.Stats()
+
+	// set bits in the first page, so that the block must be erased
+	data := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	if _, err := w.WriteAt(data, 4100); err != nil {
+		t.Fatal(err)
+	}
+	copy(want[4100:], data)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, mem, want)
+	// the two pages with data are programmed, and the two erased ones not
+	if _, p, e := mem.Stats(); e-erases != 1 || p-programs != 2 {
+		t.Errorf("%d erases and %d programs, want 1 and 2", e-erases, p-programs)
+	}
+
+	// nothing left to write
+	reads, programs, erases := mem.Stats()
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if r, p, e := mem.Stats(); r != reads || p != programs || e != erases {
+		t.Error("Flush accessed the memory without buffered changes")
+	}
+}
+
+// stuckBit is a memory with a bit that cannot be set.
+type stuckBit struct {
+	*flashemu.Device
+	addr int64
+}
+
+func (d stuckBit) EraseBlocks(start, len int64) error {
+	err := d.Device.EraseBlocks(start, len)
+	d.Bytes()[d.addr] &^= 0x10
+	return err
+}
+
+func TestWriterVerify(t *testing.T) {
+	mem, want := newWriterDevice(t)
+	// like a real chip, program the bit without reporting that it stays 0
+	mem.Strict = false
+	want[1500] = 0xFF
+	w := NewWriter(stuckBit{mem, 1500})
+	w.Verify = true
+	if _, err := w.WriteAt(want[1024:2048], 1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != ErrVerifyFailed {
+		t.Errorf("got %v, want %v", err, ErrVerifyFailed)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	dev, mem := newEmuDevice()
+	data := make([]byte, 3*SectorSize)
+	rand.New(rand.NewSource(2)).Read(data)
+	if _, err := dev.WriteAt(data, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mem.Bytes()[1000:1000+len(data)], data) {
+		t.Fatal("WriteAt did not write the data")
+	}
+
+	if err := dev.Verify(data, 1000); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	// a mismatch in the last byte
+	data[len(data)-1] ^= 0x01
+	if err := dev.Verify(data, 1000); err != ErrVerifyFailed {
+		t.Errorf("Verify: got %v, want %v", err, ErrVerifyFailed)
+	}
+	if err := dev.Verify(data[:len(data)-1], 1000); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	data[len(data)-1] ^= 0x01
+
+	for _, n := range []int{0, 1, PageSize, len(data)} {
+		sum, err := dev.Checksum(1000, int64(n))
+		if want := crc32.ChecksumIEEE(data[:n]); sum != want || err != nil {
+			t.Errorf("Checksum of %d bytes: got %#08x, %v, want %#08x", n, sum, err, want)
+		}
+	}
+
+	// rewriting through a Writer erases the sectors with the chip commands
+	w := NewWriter(dev)
+	copy(data[100:], bytes.Repeat([]byte{0xFF}, 5000))
+	if _, err := w.WriteAt(data[100:5100], 1100); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Verify(data, 1000); err != nil {
+		t.Errorf("Verify after rewriting: %v", err)
+	}
+}
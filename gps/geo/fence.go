@@ -0,0 +1,141 @@
+package geo
+
+import "tinygo.org/x/drivers/gps"
+
+// Fence is an area on the surface of the earth.
+type Fence interface {
+	Contains(p Point) bool
+}
+
+// Circle is the area within Radius meters of Center.
+type Circle struct {
+	Center Point
+	Radius float32
+}
+
+// Contains returns whether p is inside the circle.
+func (c Circle) Contains(p Point) bool {
+	return Distance(c.Center, p) <= c.Radius
+}
+
+// Polygon is the area enclosed by a list of vertices, without repeating the
+// first one at the end. Edges are straight lines in latitude and longitude,
+// which is close enough to the great circles for areas up to a few tens of
+// kilometers; polygons must not cross the 180th meridian.
+type Polygon []Point
+
+// Contains returns whether p is inside the polygon, by the even-odd rule.
+func (poly Polygon) Contains(p Point) bool {
+	inside := false
+	j := len(poly) - 1
+	for i := range poly {
+		a, b := poly[i], poly[j]
+		if (a.Latitude > p.Latitude) != (b.Latitude > p.Latitude) {
+			lon := a.Longitude + (p.Latitude-a.Latitude)*(b.Longitude-a.Longitude)/(b.Latitude-a.Latitude)
+			if p.Longitude < lon {
+				inside = !inside
+			}
+		}
+		j = i
+	}
+	return inside
+}
+
+// Zone is a named fence watched by a Monitor.
+type Zone struct {
+	Name  string
+	Fence Fence
+}
+
+// EventType tells whether an Event is an entry or an exit.
+type EventType uint8
+
+const (
+	Enter EventType = iota + 1
+	Exit
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Enter:
+		return "enter"
+	case Exit:
+		return "exit"
+	default:
+		return "unknown"
+	}
+}
+
+// Event reports that the receiver entered or left a zone.
+type Event struct {
+	Type EventType
+	Zone *Zone
+
+	// Fix is the fix that confirmed the crossing.
+	Fix gps.Fix
+}
+
+// Monitor watches fixes for crossings of the boundaries of zones.
+//
+// The first fix inside a zone gives an Enter event, but starting outside
+// gives none. Exit events only follow a known entry.
+type Monitor struct {
+	Zones []Zone
+
+	// Confirm is the number of consecutive fixes on the other side of a
+	// boundary needed to report a crossing, so that position noise near the
+	// boundary does not give a burst of events. 1 if zero.
+	Confirm int
+
+	state  []zoneState
+	events []Event
+}
+
+type zoneState struct {
+	known  bool
+	inside bool
+	count  int // consecutive fixes on the other side
+}
+
+// Update checks a fix against the zones and returns the events it
+// confirms. Invalid fixes are ignored. The returned slice is only valid until
+// the next call.
+func (m *Monitor) Update(fix gps.Fix) []Event {
+	m.events = m.events[:0]
+	if !fix.Valid {
+		return m.events
+	}
+	for len(m.state) < len(m.Zones) {
+		m.state = append(m.state, zoneState{})
+	}
+	confirm := m.Confirm
+	if confirm < 1 {
+		confirm = 1
+	}
+	p := FixPoint(fix)
+	for i := range m.Zones {
+		s := &m.state[i]
+		inside := m.Zones[i].Fence.Contains(p)
+		if s.known && inside == s.inside {
+			s.count = 0
+			continue
+		}
+		s.count++
+		if s.count < confirm {
+			continue
+		}
+		s.count = 0
+		if inside {
+			m.events = append(m.events, Event{Type: Enter, Zone: &m.Zones[i], Fix: fix})
+		} else if s.known {
+			m.events = append(m.events, Event{Type: Exit, Zone: &m.Zones[i], Fix: fix})
+		}
+		s.known, s.inside = true, inside
+	}
+	return m.events
+}
+
+// Inside returns whether the receiver is known to be inside zone i.
+func (m *Monitor) Inside(i int) bool {
+	return i < len(m.state) && m.state[i].known && m.state[i].inside
+}
@@ -0,0 +1,134 @@
+package geo_test
+
+import (
+	"testing"
+
+	"tinygo.org/x/drivers/gps"
+	"tinygo.org/x/drivers/gps/geo"
+)
+
+var zurich = geo.Point{Latitude: 47.3769, Longitude: 8.5417}
+
+func TestCircle(t *testing.T) {
+	c := geo.Circle{Center: zurich, Radius: 100}
+	for _, bearing := range []float32{0, 45, 90, 180, 270} {
+		if p := geo.Destination(zurich, bearing, 99); !c.Contains(p) {
+			t.Errorf("99 m at %v°: outside", bearing)
+		}
+		if p := geo.Destination(zurich, bearing, 101); c.Contains(p) {
+			t.Errorf("101 m at %v°: inside", bearing)
+		}
+	}
+	if !c.Contains(zurich) {
+		t.Error("center outside")
+	}
+}
+
+func TestPolygon(t *testing.T) {
+	// a U open to the north, 2 by 2 km, with a notch 1 km deep
+	u := geo.Polygon{
+		{Latitude: 47.00, Longitude: 8.00},
+		{Latitude: 47.00, Longitude: 8.03},
+		{Latitude: 47.02, Longitude: 8.03},
+		{Latitude: 47.02, Longitude: 8.02},
+		{Latitude: 47.01, Longitude: 8.02},
+		{Latitude: 47.01, Longitude: 8.01},
+		{Latitude: 47.02, Longitude: 8.01},
+		{Latitude: 47.02, Longitude: 8.00},
+	}
+	for _, tc := range []struct {
+		name   string
+		p      geo.Point
+		inside bool
+	}{
+		{"base", geo.Point{Latitude: 47.005, Longitude: 8.015}, true},
+		{"left arm", geo.Point{Latitude: 47.015, Longitude: 8.005}, true},
+		{"right arm", geo.Point{Latitude: 47.015, Longitude: 8.025}, true},
+		{"notch", geo.Point{Latitude: 47.015, Longitude: 8.015}, false},
+		{"north", geo.Point{Latitude: 47.025, Longitude: 8.005}, false},
+		{"south", geo.Point{Latitude: 46.995, Longitude: 8.015}, false},
+		{"east", geo.Point{Latitude: 47.005, Longitude: 8.035}, false},
+		{"west", geo.Point{Latitude: 47.005, Longitude: 7.995}, false},
+	} {
+		if got := u.Contains(tc.p); got != tc.inside {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.inside)
+		}
+	}
+
+	// south and west of zero
+	square := geo.Polygon{
+		{Latitude: -33.9, Longitude: -70.7},
+		{Latitude: -33.9, Longitude: -70.6},
+		{Latitude: -33.8, Longitude: -70.6},
+		{Latitude: -33.8, Longitude: -70.7},
+	}
+	if !square.Contains(geo.Point{Latitude: -33.85, Longitude: -70.65}) || square.Contains(geo.Point{Latitude: -33.85, Longitude: -70.55}) {
+		t.Error("wrong square")
+	}
+	if (geo.Polygon{}).Contains(zurich) {
+		t.Error("inside an empty polygon")
+	}
+}
+
+// fixAt returns a valid fix at p.
+func fixAt(p geo.Point) gps.Fix {
+	return gps.Fix{Valid: true, Latitude: p.Latitude, Longitude: p.Longitude}
+}
+
+func TestMonitor(t *testing.T) {
+	in := func(d float32) gps.Fix { return fixAt(geo.Destination(zurich, 90, d)) }
+	out := func(d float32) gps.Fix { return fixAt(geo.Destination(zurich, 90, 100+d)) }
+	m := geo.Monitor{
+		Zones: []geo.Zone{
+			{Name: "home", Fence: geo.Circle{Center: zurich, Radius: 100}},
+			{Name: "everywhere", Fence: geo.Circle{Center: zurich, Radius: 1e6}},
+		},
+		Confirm: 2,
+	}
+	for i, step := range []struct {
+		fix  gps.Fix
+		want string // events, as type and zone
+	}{
+		// starting outside, confirmed silently
+		{out(5), ""},
+		{out(5), "enter everywhere"},
+		// noise across the boundary is not a crossing
+		{in(-5), ""},
+		{out(5), ""},
+		{in(-5), ""},
+		{gps.Fix{Latitude: zurich.Latitude, Longitude: zurich.Longitude}, ""}, // not valid
+		{in(-5), "enter home"},
+		{in(-50), ""},
+		{out(1), ""},
+		{in(-1), ""},
+		{out(1), ""},
+		{out(20), "exit home"},
+		{out(30), ""},
+	} {
+		got := ""
+		for _, e := range m.Update(step.fix) {
+			if got != "" {
+				got += ", "
+			}
+			got += e.Type.String() + " " + e.Zone.Name
+			if e.Fix.Latitude != step.fix.Latitude || e.Fix.Longitude != step.fix.Longitude {
+				t.Errorf("step %d: event with fix %+v", i, e.Fix)
+			}
+		}
+		if got != step.want {
+			t.Errorf("step %d: got %q, want %q", i, got, step.want)
+		}
+	}
+	if m.Inside(0) || !m.Inside(1) || m.Inside(2) {
+		t.Errorf("inside %v %v", m.Inside(0), m.Inside(1))
+	}
+
+	// a single fix inside is an entry without Confirm
+	m = geo.Monitor{Zones: []geo.Zone{{Name: "home", Fence: geo.Circle{Center: zurich, Radius: 100}}}}
+	if events := m.Update(in(0)); len(events) != 1 || events[0].Type != geo.Enter {
+		t.Errorf("got %v", events)
+	}
+	if events := m.Update(out(1)); len(events) != 1 || events[0].Type != geo.Exit {
+		t.Errorf("got %v", events)
+	}
+}
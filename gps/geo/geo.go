@@ -0,0 +1,153 @@
+// Package geo provides geodesy for the positions of GNSS receivers:
+// distances and bearings, geofences that report when a receiver enters or
+// leaves a zone, and a track recorder with GPX and NMEA log export.
+//
+// Computations use float32, as gps.Fix does, with math functions of the
+// package's own, since float64 is slow on microcontrollers. Distances are
+// accurate to about a meter, on top of the 0.3% error of the spherical earth
+// model of Distance; VincentyDistance uses the WGS84 ellipsoid and float64
+// for when that is not good enough, which leaves the rounding of the float32
+// coordinates.
+package geo // import "tinygo.org/x/drivers/gps/geo"
+
+import (
+	"errors"
+	"math"
+
+	"tinygo.org/x/drivers/gps"
+)
+
+// EarthRadius is the mean radius of the earth in meters.
+const EarthRadius = 6371008.8
+
+// ErrNoConvergence is returned by VincentyDistance for nearly antipodal
+// points, for which the method fails.
+var ErrNoConvergence = errors.New("geo: distance did not converge")
+
+// Point is a position in degrees, north and east positive.
+type Point struct {
+	Latitude  float32
+	Longitude float32
+}
+
+// FixPoint returns the position of a fix.
+func FixPoint(fix gps.Fix) Point {
+	return Point{Latitude: fix.Latitude, Longitude: fix.Longitude}
+}
+
+// deltaLongitude returns b - a in degrees, in [-180, 180].
+func deltaLongitude(a, b float32) float32 {
+	// shifted so that the near sides of the meridian cancel exactly
+	d := b - a
+	if d > 180 {
+		d = (b - 180) - (a + 180)
+	} else if d < -180 {
+		d = (b + 180) - (a - 180)
+	}
+	return d
+}
+
+// Distance returns the great circle distance between a and b in meters,
+// computed with the haversine formula.
+func Distance(a, b Point) float32 {
+	sinLat := sin((b.Latitude - a.Latitude) * radians / 2)
+	sinLon := sin(deltaLongitude(a.Longitude, b.Longitude) * radians / 2)
+	h := sinLat*sinLat + cos(a.Latitude*radians)*cos(b.Latitude*radians)*sinLon*sinLon
+	if h > 1 {
+		h = 1
+	}
+	return 2 * EarthRadius * atan2(sqrt(h), sqrt(1-h))
+}
+
+// Bearing returns the initial bearing of the great circle from a to b, in
+// degrees clockwise from north in [0, 360).
+func Bearing(a, b Point) float32 {
+	lat1, lat2 := a.Latitude*radians, b.Latitude*radians
+	dLon := deltaLongitude(a.Longitude, b.Longitude) * radians
+	sinHalf := sin(dLon / 2)
+	// cos(lat1)sin(lat2) - sin(lat1)cos(lat2)cos(dLon), without the
+	// cancellation of nearby points
+	x := sin(lat2-lat1) + 2*sin(lat1)*cos(lat2)*sinHalf*sinHalf
+	y := sin(dLon) * cos(lat2)
+	bearing := atan2(y, x) * degrees
+	if bearing < 0 {
+		bearing += 360
+	}
+	if bearing >= 360 {
+		bearing -= 360
+	}
+	return bearing
+}
+
+// Destination returns the point at distance meters from p along the great
+// circle of initial bearing degrees.
+func Destination(p Point, bearing, distance float32) Point {
+	lat1 := p.Latitude * radians
+	theta := bearing * radians
+	delta := distance / EarthRadius
+	sinLat1, cosLat1 := sin(lat1), cos(lat1)
+	sinDelta, cosDelta := sin(delta), cos(delta)
+	sinLat2 := sinLat1*cosDelta + cosLat1*sinDelta*cos(theta)
+	lat2 := asin(sinLat2)
+	dLon := atan2(sin(theta)*sinDelta*cosLat1, cosDelta-sinLat1*sinLat2)
+	lon := p.Longitude + dLon*degrees
+	if lon > 180 {
+		lon -= 360
+	} else if lon < -180 {
+		lon += 360
+	}
+	return Point{Latitude: lat2 * degrees, Longitude: lon}
+}
+
+// WGS84 ellipsoid.
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// VincentyDistance returns the distance between a and b in meters on the
+// WGS84 ellipsoid, with Vincenty's inverse formula. It computes in float64,
+// and the formula is accurate to a millimeter, but the float32 coordinates
+// of the points are only resolved to a few decimeters: the distance from
+// Flinders Peak to Buninyong comes out as 54972.03 m instead of 54972.27 m.
+func VincentyDistance(a, b Point) (float32, error) {
+	L := float64(deltaLongitude(a.Longitude, b.Longitude)) * radians
+	U1 := math.Atan((1 - wgs84F) * math.Tan(float64(a.Latitude)*radians))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(float64(b.Latitude)*radians))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	for i := 0; i < 100; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		t := cosU1*sinU2 - sinU1*cosU2*cosLambda
+		sinSigma := math.Sqrt(cosU2*sinLambda*cosU2*sinLambda + t*t)
+		if sinSigma == 0 {
+			return 0, nil // same point
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0 // on the equator
+		if cos2Alpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		C := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		prev := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*
+			(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) > 1e-12 {
+			continue
+		}
+
+		u2 := cos2Alpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+		A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+		B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+		deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+			B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+		return float32(wgs84B * A * (sigma - deltaSigma)), nil
+	}
+	return 0, ErrNoConvergence
+}
@@ -0,0 +1,36 @@
+package geo_test
+
+import (
+	"testing"
+
+	"tinygo.org/x/drivers/gps/geo"
+)
+
+// dms returns degrees, minutes and seconds in degrees.
+func dms(d, m, s float64) float32 {
+	if d < 0 {
+		return float32(d - m/60 - s/3600)
+	}
+	return float32(d + m/60 + s/3600)
+}
+
+// TestVincentyDistance uses the example of Vincenty's paper, from Flinders
+// Peak to Buninyong, which are 54972.271 m apart.
+func TestVincentyDistance(t *testing.T) {
+	flinders := geo.Point{Latitude: dms(-37, 57, 3.72030), Longitude: dms(144, 25, 29.52440)}
+	buninyong := geo.Point{Latitude: dms(-37, 39, 10.15610), Longitude: dms(143, 55, 35.38390)}
+	d, err := geo.VincentyDistance(flinders, buninyong)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the coordinates are rounded to float32
+	if d < 54971.77 || d > 54972.77 {
+		t.Errorf("got %.3f m, want 54972.271 m", d)
+	}
+	if d := geo.Distance(flinders, buninyong); d < 54972.271*0.997 || d > 54972.271*1.003 {
+		t.Errorf("haversine: got %.3f m", d)
+	}
+	if d, err := geo.VincentyDistance(flinders, flinders); d != 0 || err != nil {
+		t.Errorf("same point: got %v, %v", d, err)
+	}
+}
@@ -0,0 +1,96 @@
+package geo
+
+import "math"
+
+// float32 versions of the functions of the math package, which only works
+// with float64: most microcontrollers have no float64 hardware, and some no
+// floating point hardware at all. They are accurate to a few units in the
+// last place, plenty for positions stored as float32.
+
+const (
+	pi     = math.Pi
+	halfPi = math.Pi / 2
+	twoPi  = 2 * math.Pi
+
+	radians = math.Pi / 180
+	degrees = 180 / math.Pi
+)
+
+// sin returns the sine of x radians.
+func sin(x float32) float32 {
+	// reduce to [-pi, pi], then to [-pi/2, pi/2]
+	if x < -pi || x > pi {
+		x -= twoPi * float32(int32(x/twoPi+sign(x)*0.5))
+	}
+	if x > halfPi {
+		x = pi - x
+	} else if x < -halfPi {
+		x = -pi - x
+	}
+	x2 := x * x
+	return x * (1 + x2*(-1.0/6+x2*(1.0/120+x2*(-1.0/5040+x2*(1.0/362880+x2*(-1.0/39916800))))))
+}
+
+// cos returns the cosine of x radians.
+func cos(x float32) float32 {
+	return sin(x + halfPi)
+}
+
+// atan returns the arctangent of x in radians.
+func atan(x float32) float32 {
+	if x < 0 {
+		return -atan(-x)
+	}
+	if x > 1 {
+		return halfPi - atan(1/x)
+	}
+	var offset float32
+	if x > 0.41421356 { // tan(pi/8)
+		offset = pi / 4
+		x = (x - 1) / (x + 1)
+	}
+	x2 := x * x
+	return offset + x*(1+x2*(-1.0/3+x2*(1.0/5+x2*(-1.0/7+x2*(1.0/9+x2*(-1.0/11+x2*(1.0/13+x2*(-1.0/15))))))))
+}
+
+// atan2 returns the angle of the point (x, y) in radians, in [-pi, pi].
+func atan2(y, x float32) float32 {
+	switch {
+	case x > 0:
+		return atan(y / x)
+	case x < 0 && y >= 0:
+		return atan(y/x) + pi
+	case x < 0:
+		return atan(y/x) - pi
+	case y > 0:
+		return halfPi
+	case y < 0:
+		return -halfPi
+	default:
+		return 0
+	}
+}
+
+// sqrt returns the square root of x, or 0 if x is not positive.
+func sqrt(x float32) float32 {
+	if x <= 0 {
+		return 0
+	}
+	g := math.Float32frombits(0x1FBD1DF5 + math.Float32bits(x)>>1)
+	for i := 0; i < 3; i++ {
+		g = 0.5 * (g + x/g)
+	}
+	return g
+}
+
+// asin returns the arcsine of x in radians.
+func asin(x float32) float32 {
+	return atan2(x, sqrt(1-x*x))
+}
+
+func sign(x float32) float32 {
+	if x < 0 {
+		return -1
+	}
+	return 1
+}
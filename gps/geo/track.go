@@ -0,0 +1,277 @@
+package geo
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+)
+
+// TrackPoint is a recorded position.
+type TrackPoint struct {
+	Point
+	Time       time.Time
+	Altitude   float32 // above mean sea level in meters
+	Speed      float32 // over ground in meters per second
+	Course     float32 // over ground in degrees
+	Satellites int16
+	HDOP       float32
+}
+
+// FixTrackPoint returns the track point of a fix.
+func FixTrackPoint(fix gps.Fix) TrackPoint {
+	return TrackPoint{
+		Point:      FixPoint(fix),
+		Time:       fix.Time,
+		Altitude:   float32(fix.Altitude),
+		Speed:      fix.Speed,
+		Course:     fix.Course,
+		Satellites: fix.Satellites,
+		HDOP:       fix.HDOP,
+	}
+}
+
+// TrackWriter stores track points, for example in a log file.
+type TrackWriter interface {
+	WritePoint(p TrackPoint) error
+}
+
+// Recorder selects the fixes worth keeping for a track: a point when the
+// receiver has moved MinDistance, at most every MinInterval, and at least
+// every MaxInterval while it stands still.
+type Recorder struct {
+	// MinDistance is the distance in meters from the last point needed to
+	// record a new one. Every fix is recorded if zero.
+	MinDistance float32
+
+	// MinInterval is the minimum time between points.
+	MinInterval time.Duration
+
+	// MaxInterval, if not zero, is the time after which a point is
+	// recorded even if the receiver did not move.
+	MaxInterval time.Duration
+
+	// Output, if set, receives the recorded points.
+	Output TrackWriter
+
+	last     TrackPoint
+	started  bool
+	distance float32
+}
+
+// Add offers a fix to the recorder. It returns the track point and true if
+// the fix is recorded, and the error of the output if writing it fails.
+// Invalid fixes are ignored.
+func (r *Recorder) Add(fix gps.Fix) (TrackPoint, bool, error) {
+	if !fix.Valid {
+		return TrackPoint{}, false, nil
+	}
+	p := FixTrackPoint(fix)
+	var d float32
+	if r.started {
+		dt := p.Time.Sub(r.last.Time)
+		if dt < r.MinInterval {
+			return TrackPoint{}, false, nil
+		}
+		d = Distance(r.last.Point, p.Point)
+		if d < r.MinDistance && (r.MaxInterval == 0 || dt < r.MaxInterval) {
+			return TrackPoint{}, false, nil
+		}
+	}
+	r.last, r.started = p, true
+	r.distance += d
+	if r.Output != nil {
+		if err := r.Output.WritePoint(p); err != nil {
+			return p, true, err
+		}
+	}
+	return p, true, nil
+}
+
+// Distance returns the length of the recorded track in meters.
+func (r *Recorder) Distance() float32 {
+	return r.distance
+}
+
+// Reset starts a new track.
+func (r *Recorder) Reset() {
+	r.started = false
+	r.distance = 0
+}
+
+// GPXWriter writes a track in the GPX 1.1 format. Call Close at the end of
+// the track to complete the document.
+type GPXWriter struct {
+	w       io.Writer
+	name    string
+	started bool
+	buf     []byte
+}
+
+// NewGPXWriter returns a writer of a track called name to w.
+func NewGPXWriter(w io.Writer, name string) *GPXWriter {
+	return &GPXWriter{w: w, name: name}
+}
+
+// WritePoint writes a track point, after the start of the document if it
+// is the first.
+func (g *GPXWriter) WritePoint(p TrackPoint) error {
+	b := g.buf[:0]
+	if !g.started {
+		b = append(b, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+			`<gpx version="1.1" creator="tinygo.org/x/drivers/gps/geo" xmlns="http://www.topografix.com/GPX/1/1">`+"\n"+
+			"<trk><name>"...)
+		b = appendEscaped(b, g.name)
+		b = append(b, "</name><trkseg>\n"...)
+	}
+	b = append(b, `<trkpt lat="`...)
+	b = strconv.AppendFloat(b, float64(p.Latitude), 'f', 6, 32)
+	b = append(b, `" lon="`...)
+	b = strconv.AppendFloat(b, float64(p.Longitude), 'f', 6, 32)
+	b = append(b, `"><ele>`...)
+	b = strconv.AppendFloat(b, float64(p.Altitude), 'f', 1, 32)
+	b = append(b, "</ele>"...)
+	if !p.Time.IsZero() {
+		b = append(b, "<time>"...)
+		b = p.Time.UTC().AppendFormat(b, "2006-01-02T15:04:05Z")
+		b = append(b, "</time>"...)
+	}
+	if p.Satellites > 0 {
+		b = append(b, "<sat>"...)
+		b = strconv.AppendInt(b, int64(p.Satellites), 10)
+		b = append(b, "</sat>"...)
+	}
+	if p.HDOP > 0 {
+		b = append(b, "<hdop>"...)
+		b = strconv.AppendFloat(b, float64(p.HDOP), 'f', 1, 32)
+		b = append(b, "</hdop>"...)
+	}
+	b = append(b, "</trkpt>\n"...)
+	g.buf = b
+	if _, err := g.w.Write(b); err != nil {
+		return err
+	}
+	g.started = true
+	return nil
+}
+
+// Close writes the end of the document. It does not close the underlying
+// writer. A track without points gives no document at all.
+func (g *GPXWriter) Close() error {
+	if !g.started {
+		return nil
+	}
+	g.started = false
+	_, err := io.WriteString(g.w, "</trkseg></trk>\n</gpx>\n")
+	return err
+}
+
+func appendEscaped(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<':
+			b = append(b, "&lt;"...)
+		case '>':
+			b = append(b, "&gt;"...)
+		case '&':
+			b = append(b, "&amp;"...)
+		case '"':
+			b = append(b, "&quot;"...)
+		default:
+			b = append(b, s[i])
+		}
+	}
+	return b
+}
+
+// NMEAWriter writes track points as GGA and RMC sentences, the format of
+// receiver logs, which the gps package and most GNSS tools can read back.
+type NMEAWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewNMEAWriter returns a writer of NMEA sentences to w.
+func NewNMEAWriter(w io.Writer) *NMEAWriter {
+	return &NMEAWriter{w: w}
+}
+
+// WritePoint writes the GGA and RMC sentences of a track point.
+func (n *NMEAWriter) WritePoint(p TrackPoint) error {
+	t := p.Time.UTC()
+	b := n.buf[:0]
+
+	start := len(b)
+	b = append(b, "$GPGGA,"...)
+	b = t.AppendFormat(b, "150405.00")
+	b = appendCoordinates(b, p.Point)
+	b = append(b, ",1,"...)
+	b = strconv.AppendInt(b, int64(p.Satellites), 10)
+	b = append(b, ',')
+	b = strconv.AppendFloat(b, float64(p.HDOP), 'f', 1, 32)
+	b = append(b, ',')
+	b = strconv.AppendFloat(b, float64(p.Altitude), 'f', 1, 32)
+	b = append(b, ",M,,M,,"...)
+	b = appendChecksum(b, start)
+
+	start = len(b)
+	b = append(b, "$GPRMC,"...)
+	b = t.AppendFormat(b, "150405.00")
+	b = append(b, ",A"...)
+	b = appendCoordinates(b, p.Point)
+	b = append(b, ',')
+	b = strconv.AppendFloat(b, float64(p.Speed*(3600.0/1852)), 'f', 2, 32)
+	b = append(b, ',')
+	b = strconv.AppendFloat(b, float64(p.Course), 'f', 2, 32)
+	b = append(b, ',')
+	b = t.AppendFormat(b, "020106")
+	b = append(b, ",,,A"...)
+	b = appendChecksum(b, start)
+
+	n.buf = b
+	_, err := n.w.Write(b)
+	return err
+}
+
+// appendCoordinates appends ",ddmm.mmmmm,N,dddmm.mmmmm,E".
+func appendCoordinates(b []byte, p Point) []byte {
+	b = appendAngle(b, p.Latitude, 2, 'N', 'S')
+	return appendAngle(b, p.Longitude, 3, 'E', 'W')
+}
+
+func appendAngle(b []byte, angle float32, width int, pos, neg byte) []byte {
+	hemisphere := pos
+	if angle < 0 {
+		angle = -angle
+		hemisphere = neg
+	}
+	deg := int(angle)
+	min := (angle - float32(deg)) * 60
+	if min >= 59.999995 { // would round to 60
+		deg++
+		min = 0
+	}
+	b = append(b, ',')
+	digits := strconv.Itoa(deg)
+	for i := len(digits); i < width; i++ {
+		b = append(b, '0')
+	}
+	b = append(b, digits...)
+	if min < 10 {
+		b = append(b, '0')
+	}
+	b = strconv.AppendFloat(b, float64(min), 'f', 5, 32)
+	return append(b, ',', hemisphere)
+}
+
+// appendChecksum appends the checksum and line end of the sentence that
+// starts at b[start].
+func appendChecksum(b []byte, start int) []byte {
+	var cs byte
+	for _, c := range b[start+1:] {
+		cs ^= c
+	}
+	const hex = "0123456789ABCDEF"
+	return append(b, '*', hex[cs>>4], hex[cs&0xF], '\r', '\n')
+}
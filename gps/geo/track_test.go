@@ -0,0 +1,199 @@
+package geo_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+	"tinygo.org/x/drivers/gps/geo"
+)
+
+var start = time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+// points records the points written to it, and fails with err if set.
+type points struct {
+	points []geo.TrackPoint
+	err    error
+}
+
+func (w *points) WritePoint(p geo.TrackPoint) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.points = append(w.points, p)
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	var out points
+	r := geo.Recorder{MinDistance: 10, MinInterval: 2 * time.Second, MaxInterval: 30 * time.Second, Output: &out}
+	fix := func(i int, d float32) gps.Fix {
+		f := fixAt(geo.Destination(zurich, 0, d))
+		f.Time = start.Add(time.Duration(i) * time.Second)
+		return f
+	}
+	var recorded []int
+	for i := 0; i <= 75; i++ {
+		// 6 m/s to the north, then standing still
+		d := float32(6 * i)
+		if i > 10 {
+			d = 60
+		}
+		if i == 20 {
+			if _, ok, _ := r.Add(gps.Fix{Time: fix(i, d).Time}); ok {
+				t.Error("recorded an invalid fix")
+			}
+		}
+		p, ok, err := r.Add(fix(i, d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			recorded = append(recorded, i)
+			if !p.Time.Equal(fix(i, d).Time) {
+				t.Errorf("point at %v, want %v", p.Time, fix(i, d).Time)
+			}
+		}
+	}
+	// every 2 s while moving 12 m, and every 30 s while still
+	want := []int{0, 2, 4, 6, 8, 10, 40, 70}
+	if len(recorded) != len(want) || len(out.points) != len(want) {
+		t.Fatalf("recorded %v, wrote %d points, want %v", recorded, len(out.points), want)
+	}
+	for i := range want {
+		if recorded[i] != want[i] {
+			t.Errorf("recorded %v, want %v", recorded, want)
+			break
+		}
+	}
+	// float32 latitudes are about 0.4 m apart here
+	if d := r.Distance(); d < 58 || d > 62 {
+		t.Errorf("distance %v, want 60", d)
+	}
+
+	// the error of the output
+	out.err = errors.New("full")
+	if _, ok, err := r.Add(fix(200, 60)); !ok || err != out.err {
+		t.Errorf("got %v, %v, want %v", ok, err, out.err)
+	}
+
+	// a new track starts at the next fix
+	out.err = nil
+	r.Reset()
+	if _, ok, _ := r.Add(fix(201, 60)); !ok || r.Distance() != 0 {
+		t.Errorf("after Reset: recorded %v, distance %v", ok, r.Distance())
+	}
+
+	// all fixes without thresholds
+	r = geo.Recorder{}
+	for i := 0; i < 3; i++ {
+		if _, ok, _ := r.Add(fix(0, 0)); !ok {
+			t.Errorf("fix %d not recorded", i)
+		}
+	}
+}
+
+var track = []geo.TrackPoint{
+	{
+		Point: zurich, Time: start, Altitude: 408.5,
+		Speed: 5, Course: 123.45, Satellites: 9, HDOP: 0.8,
+	},
+	{
+		// exact in float32
+		Point: geo.Point{Latitude: -33.84375, Longitude: -70.65625}, Time: start.Add(time.Second), Altitude: -2,
+	},
+}
+
+func TestGPXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := geo.NewGPXWriter(&buf, `Tom & Jerry's "<walk>"`)
+	if err := w.Close(); err != nil || buf.Len() != 0 {
+		t.Errorf("empty track: %v, %q", err, buf.String())
+	}
+	for _, p := range track {
+		if err := w.WritePoint(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="tinygo.org/x/drivers/gps/geo" xmlns="http://www.topografix.com/GPX/1/1">
+<trk><name>Tom &amp; Jerry's &quot;&lt;walk&gt;&quot;</name><trkseg>
+<trkpt lat="47.376900" lon="8.541700"><ele>408.5</ele><time>2024-06-15T12:00:00Z</time><sat>9</sat><hdop>0.8</hdop></trkpt>
+<trkpt lat="-33.843750" lon="-70.656250"><ele>-2.0</ele><time>2024-06-15T12:00:01Z</time></trkpt>
+</trkseg></trk>
+</gpx>
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// which is valid XML
+	var gpx struct {
+		Name   string `xml:"trk>name"`
+		Points []struct {
+			Lat float64 `xml:"lat,attr"`
+			Lon float64 `xml:"lon,attr"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &gpx); err != nil {
+		t.Fatal(err)
+	}
+	if gpx.Name != `Tom & Jerry's "<walk>"` || len(gpx.Points) != 2 || gpx.Points[1].Lon != -70.65625 {
+		t.Errorf("got %+v", gpx)
+	}
+}
+
+func TestNMEAWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := geo.NewNMEAWriter(&buf)
+	// and a point whose minutes round up to the next degree
+	points := append(track[:len(track):len(track)], geo.TrackPoint{
+		Point: geo.Point{Latitude: 0.99999994, Longitude: -0.99999994},
+		Time:  start.Add(2 * time.Second),
+	})
+	for _, p := range points {
+		if err := w.WritePoint(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.Contains(buf.String(), ",0100.00000,N,00100.00000,W,") {
+		t.Errorf("minutes not rounded:\n%s", buf.String())
+	}
+
+	// read back with the gps package
+	s := gps.NewStream(bytes.NewReader(buf.Bytes()))
+	var fixes []gps.Fix
+	for {
+		fix, ok, err := s.Poll()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			fixes = append(fixes, fix)
+		}
+	}
+	if len(fixes) != len(points) {
+		t.Fatalf("got %d fixes, want %d:\n%s", len(fixes), len(points), buf.String())
+	}
+	for i, f := range fixes {
+		p := points[i]
+		if !f.Valid || !f.Time.Equal(p.Time) ||
+			math.Abs(float64(f.Latitude-p.Latitude)) > 1e-6 || math.Abs(float64(f.Longitude-p.Longitude)) > 1e-6 ||
+			f.Altitude != int32(p.Altitude) || f.Satellites != p.Satellites || f.HDOP != p.HDOP ||
+			math.Abs(float64(f.Speed-p.Speed)) > 0.01 || f.Course != p.Course {
+			t.Errorf("fix %d: got %+v, want %+v", i, f, p)
+		}
+	}
+}
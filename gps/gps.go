@@ -4,109 +4,85 @@ package gps // import "tinygo.org/x/drivers/gps"
 import (
 	"encoding/hex"
 	"machine"
-	"strings"
 	"time"
 )
 
 // Device wraps a connection to a GPS device.
 type GPSDevice struct {
-	buffer   []byte
-	bufIdx   int
-	sentence strings.Builder
-	uart     *machine.UART
-	bus      *machine.I2C
-	address  uint16
+	reader  *Reader
+	uart    *machine.UART
+	bus     *machine.I2C
+	address uint16
 }
 
 // NewUART creates a new UART GPS connection. The UART must already be configured.
 func NewUART(uart *machine.UART) GPSDevice {
 	return GPSDevice{
-		uart:     uart,
-		buffer:   make([]byte, bufferSize),
-		bufIdx:   bufferSize,
-		sentence: strings.Builder{},
+		reader: NewReader(uart),
+		uart:   uart,
 	}
 }
 
 // NewI2C creates a new I2C GPS connection.
 func NewI2C(bus *machine.I2C) GPSDevice {
 	return GPSDevice{
-		bus:      bus,
-		address:  I2C_ADDRESS,
-		buffer:   make([]byte, bufferSize),
-		bufIdx:   bufferSize,
-		sentence: strings.Builder{},
+		reader:  NewReader(i2cStream{bus: bus, address: I2C_ADDRESS}),
+		bus:     bus,
+		address: I2C_ADDRESS,
 	}
 }
 
 // ReadNextSentence returns the next valid NMEA sentence from the GPS device.
+// It waits as long as it takes, see Stream to read without blocking.
 func (gps *GPSDevice) NextSentence() (sentence string) {
-	sentence = gps.readNextSentence()
-	for !validSentence(sentence) {
-		sentence = gps.readNextSentence()
+	for {
+		f, err := gps.reader.ReadFrame()
+		if err != nil {
+			time.Sleep(pollInterval)
+			continue
+		}
+		if f.Sentence != "" {
+			return f.Sentence
+		}
 	}
-	return sentence
 }
 
-// readNextSentence returns the next sentence from the GPS device.
-func (gps *GPSDevice) readNextSentence() (sentence string) {
-	gps.sentence.Reset()
-	var b byte = ' '
-
-	for b != '$' {
-		b = gps.readNextByte()
-	}
-
-	for b != '*' {
-		gps.sentence.WriteByte(b)
-		b = gps.readNextByte()
-	}
-	gps.sentence.WriteByte(b)
-	gps.sentence.WriteByte(gps.readNextByte())
-	gps.sentence.WriteByte(gps.readNextByte())
-
-	sentence = gps.sentence.String()
-	return sentence
+// Stream returns a stream of the fixes of the GPS device, which decodes
+// the data received without blocking.
+func (gps *GPSDevice) Stream() *Stream {
+	return newStream(gps.reader)
 }
 
-func (gps *GPSDevice) readNextByte() (b byte) {
-	gps.bufIdx += 1
-	if gps.bufIdx >= bufferSize {
-		gps.fillBuffer()
-	}
-	return gps.buffer[gps.bufIdx]
+// Read reads the data available from the GPS device, if any, without
+// waiting. It satisfies the io.Reader interface.
+func (gps *GPSDevice) Read(p []byte) (int, error) {
+	return gps.reader.Read(p)
 }
 
-func (gps *GPSDevice) fillBuffer() {
-	if gps.uart != nil {
-		gps.uartFillBuffer()
-	} else {
-		gps.i2cFillBuffer()
-	}
+// i2cStream reads the data stream of a receiver on the I2C bus, the DDC
+// interface of u-blox receivers.
+type i2cStream struct {
+	bus     *machine.I2C
+	address uint16
 }
 
-func (gps *GPSDevice) uartFillBuffer() {
-	for gps.uart.Buffered() < bufferSize {
-		time.Sleep(100 * time.Millisecond)
+// Read reads as much of the data available as fits in p.
+func (s i2cStream) Read(p []byte) (int, error) {
+	var lengthBytes [2]byte
+	if err := s.bus.Tx(s.address, []byte{BYTES_AVAIL_REG}, lengthBytes[0:2]); err != nil {
+		return 0, err
 	}
-	gps.uart.Read(gps.buffer[0:bufferSize])
-	gps.bufIdx = 0
-}
-
-func (gps *GPSDevice) i2cFillBuffer() {
-	for gps.available() < bufferSize {
-		time.Sleep(100 * time.Millisecond)
+	n := int(lengthBytes[0])*256 + int(lengthBytes[1])
+	if n > len(p) {
+		n = len(p)
 	}
-	gps.bus.Tx(gps.address, []byte{DATA_STREAM_REG}, gps.buffer[0:bufferSize])
-	gps.bufIdx = 0
-}
-
-// Available returns how many bytes of GPS data are currently available.
-func (gps *GPSDevice) available() (available int) {
-	var lengthBytes [2]byte
-	gps.bus.Tx(gps.address, []byte{BYTES_AVAIL_REG}, lengthBytes[0:2])
-	available = int(lengthBytes[0])*256 + int(lengthBytes[1])
-	return available
+	if n == 0 {
+		return 0, nil
+	}
+	if err := s.bus.Tx(s.address, []byte{DATA_STREAM_REG}, p[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
 // WriteBytes sends data/commands to the GPS device
@@ -118,6 +94,19 @@ func (gps *GPSDevice) WriteBytes(bytes []byte) {
 	}
 }
 
+// Write sends data/commands to the GPS device. It satisfies the io.Writer
+// interface.
+func (gps *GPSDevice) Write(p []byte) (int, error) {
+	gps.WriteBytes(p)
+	return len(p), nil
+}
+
+// ReadByte returns the next byte of data from the GPS device, or ErrNoData
+// if none is available. It satisfies the io.ByteReader interface.
+func (gps *GPSDevice) ReadByte() (byte, error) {
+	return gps.reader.ReadByte()
+}
+
 // validSentence checks if a sentence has been received uncorrupted
 func validSentence(sentence string) bool {
 	if len(sentence) < 4 || sentence[0] != '$' || sentence[len(sentence)-3] != '*' {
@@ -127,6 +116,7 @@ func validSentence(sentence string) bool {
 	for i := 1; i < len(sentence)-3; i++ {
 		cs ^= sentence[i]
 	}
+	// the checksum may be in upper or lower case
 	checksum := hex.EncodeToString([]byte{cs})
-	return (checksum[0] == sentence[len(sentence)-2]) && (checksum[1] == sentence[len(sentence)-1])
+	return checksum[0] == sentence[len(sentence)-2]|0x20 && checksum[1] == sentence[len(sentence)-1]|0x20
 }
@@ -1,23 +1,49 @@
 package gps
 
 import (
-	"strconv"
-	"strings"
 	"time"
 )
 
 type GPSParser struct {
 	gpsDevice GPSDevice
+	decoder   Decoder
 }
 
 // fix is a GPS location fix
 type Fix struct {
-	Valid      bool
-	Time       time.Time
-	Latitude   float32
-	Longitude  float32
-	Altitude   int32
+	// Valid is true if the receiver has a position fix.
+	Valid bool
+
+	// Time is the UTC date and time of the fix. Until the receiver reports
+	// the date, in an RMC or ZDA sentence, it is the time of day on January
+	// 1 of year 0.
+	Time time.Time
+
+	Latitude  float32
+	Longitude float32
+
+	// Altitude is the height above mean sea level in meters.
+	Altitude int32
+
+	// Satellites is the number of satellites used in the fix.
 	Satellites int16
+
+	Quality Quality
+	FixType FixType
+
+	// Speed is the speed over ground in meters per second, and Course the
+	// true course over ground in degrees.
+	Speed  float32
+	Course float32
+
+	// Dilution of precision.
+	HDOP float32
+	VDOP float32
+	PDOP float32
+
+	// SatellitesInView lists the satellites of all systems reported in GSV
+	// sentences.
+	SatellitesInView []Satellite
 }
 
 func Parser(gpsDevice GPSDevice) GPSParser {
@@ -26,99 +52,211 @@ func Parser(gpsDevice GPSDevice) GPSParser {
 	}
 }
 
-// NextFix returns the next GPS location Fix from the GPS device
-func (parser *GPSParser) NextFix() (fix Fix) {
-	var ggaSentence = nextGGA(parser.gpsDevice)
-	var ggaFields = strings.Split(ggaSentence, ",")
-	fix.Altitude = findAltitude(ggaFields)
-	fix.Satellites = findSatellites(ggaFields)
-	fix.Longitude = findLongitude(ggaFields)
-	fix.Latitude = findLatitude(ggaFields)
-	fix.Time = findTime(ggaFields)
-	fix.Valid = (fix.Altitude != -99999) && (fix.Satellites > 0)
-	return fix
-}
-
-// nextGGA returns the next GGA type sentence from the GPS device
-// $--GGA,,,,,,,,,,,,,,*hh
-func nextGGA(gpsDevice GPSDevice) (sentence string) {
+// NextFix returns the next GPS location Fix from the GPS device, merged from
+// all the sentences the receiver sends for that fix.
+func (parser *GPSParser) NextFix() (Fix, error) {
 	for {
-		sentence = gpsDevice.NextSentence()
-		if sentence[3:6] == "GGA" {
-			return sentence
+		fix, ok, err := parser.decoder.Decode(parser.gpsDevice.NextSentence())
+		if err == ErrUnsupportedSentence {
+			continue
 		}
+		if err != nil || ok {
+			return fix, err
+		}
+	}
+}
+
+// Decoder merges the NMEA sentences that a receiver sends for every fix,
+// which may come from several satellite systems, into Fix values.
+//
+// The sentences of a fix are taken to end when a sentence with a different
+// time arrives, or another RMC or GGA sentence.
+type Decoder struct {
+	fix     Fix
+	clock   time.Time // time of day of the fix, zero if unknown
+	seen    uint8     // sentences of the fix
+	started bool      // a sentence of the fix has been decoded
+	used    []usedSatellite
+	dated   bool // the fix includes the date
+
+	date      time.Time // last known date at midnight UTC
+	lastClock time.Time // time of day that date belongs to
+}
+
+type usedSatellite struct {
+	system int8 // NMEA 4.10 system ID, 0 if unknown
+	prn    int16
+}
+
+const (
+	seenRMC = 1 << iota
+	seenGGA
+	seenGLL
+)
+
+// Decode decodes a sentence. When the sentence starts a new fix, it returns
+// the previous one and true.
+func (d *Decoder) Decode(sentence string) (fix Fix, ok bool, err error) {
+	s, err := ParseNMEA(sentence)
+	if err != nil {
+		return
+	}
+	if d.started && d.boundary(s) {
+		fix, ok = d.finish(), true
 	}
+	d.apply(s)
+	return
 }
 
-// findTime returns the time from a GGA sentence:
-// $--GGA,hhmmss.ss,,,,,,,,,,,,,*xx
-func findTime(ggaFields []string) time.Time {
-	if len(ggaFields) < 1 || len(ggaFields[1]) < 6 {
-		return time.Time{}
+// Flush returns the fix of the sentences decoded so far, if any, without
+// waiting for the next fix to start.
+func (d *Decoder) Flush() (Fix, bool) {
+	if !d.started {
+		return Fix{}, false
 	}
-	ts := strings.Builder{}
-	ts.WriteString(ggaFields[1][0:2])
-	ts.WriteString(":")
-	ts.WriteString(ggaFields[1][2:4])
-	ts.WriteString(":")
-	ts.WriteString(ggaFields[1][4:6])
-	var t, _ = time.Parse("15:04:05", ts.String())
-
-	return t
+	return d.finish(), true
 }
 
-// findAltitude returns the altitude from a GGA sentence:
-// $--GGA,,,,,,,,,25.8,,,,,*63
-func findAltitude(ggaFields []string) int32 {
-	if len(ggaFields) > 8 && len(ggaFields[9]) > 0 {
-		var v, _ = strconv.ParseFloat(ggaFields[9], 32)
-		return int32(v)
+// boundary returns whether s belongs to the next fix.
+func (d *Decoder) boundary(s interface{}) bool {
+	var t time.Time
+	switch s := s.(type) {
+	case RMC:
+		if d.seen&seenRMC != 0 {
+			return true
+		}
+		t = timeOfDay(s.Time)
+	case GGA:
+		if d.seen&seenGGA != 0 {
+			return true
+		}
+		t = s.Time
+	case GLL:
+		t = s.Time
+	case ZDA:
+		t = timeOfDay(s.Time)
 	}
-	return -99999
+	return !t.IsZero() && !d.clock.IsZero() && !t.Equal(d.clock)
 }
 
-// findLatitude returns the Latitude from a GGA sentence:
-// $--GGA,,ddmm.mmmmm,x,,,,,,,,,,,*hh
-func findLatitude(ggaFields []string) float32 {
-	if len(ggaFields) > 2 && len(ggaFields[2]) > 8 {
-		var dd = ggaFields[2][0:2]
-		var mm = ggaFields[2][2:]
-		var d, _ = strconv.ParseFloat(dd, 32)
-		var m, _ = strconv.ParseFloat(mm, 32)
-		var v = float32(d + (m / 60))
-		if ggaFields[3] == "S" {
-			v *= -1
+// apply merges s into the fix.
+func (d *Decoder) apply(s interface{}) {
+	d.started = true
+	f := &d.fix
+	switch s := s.(type) {
+	case RMC:
+		d.seen |= seenRMC
+		d.setTime(s.Time)
+		if d.seen&seenGGA == 0 {
+			f.Valid = s.Valid
+			f.Latitude, f.Longitude = s.Latitude, s.Longitude
 		}
-		return v
+		f.Speed = s.SpeedKnots * knots
+		f.Course = s.Course
+	case GGA:
+		d.seen |= seenGGA
+		d.setTime(s.Time)
+		f.Valid = s.Quality != QualityInvalid
+		f.Latitude, f.Longitude = s.Latitude, s.Longitude
+		f.Quality = s.Quality
+		f.Satellites = s.Satellites
+		f.HDOP = s.HDOP
+		f.Altitude = int32(s.Altitude)
+	case GSA:
+		f.FixType = s.FixType
+		f.PDOP, f.HDOP, f.VDOP = s.PDOP, s.HDOP, s.VDOP
+		for _, prn := range s.PRNs {
+			d.used = append(d.used, usedSatellite{system: systemID(s.Talker, s.SystemID), prn: prn})
+		}
+	case GSV:
+		f.SatellitesInView = append(f.SatellitesInView, s.Satellites...)
+	case VTG:
+		f.Speed = s.SpeedKnots * knots
+		f.Course = s.Course
+	case GLL:
+		d.seen |= seenGLL
+		d.setTime(s.Time)
+		if d.seen&(seenRMC|seenGGA) == 0 {
+			f.Valid = s.Valid
+			f.Latitude, f.Longitude = s.Latitude, s.Longitude
+		}
+	case ZDA:
+		d.setTime(s.Time)
 	}
-	return 0.0
 }
 
-// findLatitude returns the longitude from a GGA sentence:
-// $--GGA,,,,dddmm.mmmmm,x,,,,,,,,,*hh
-func findLongitude(ggaFields []string) float32 {
-	if len(ggaFields) > 4 && len(ggaFields[4]) > 8 {
-		var ddd = ggaFields[4][0:3]
-		var mm = ggaFields[4][3:]
-		var d, _ = strconv.ParseFloat(ddd, 32)
-		var m, _ = strconv.ParseFloat(mm, 32)
-		var v = float32(d + (m / 60))
-		if ggaFields[5] == "W" {
-			v *= -1
+// setTime records the time, and the date if t has one.
+func (d *Decoder) setTime(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	d.clock = timeOfDay(t)
+	if t.Year() > 0 {
+		d.date = t.Truncate(24 * time.Hour)
+		d.lastClock = d.clock
+		d.dated = true
+	}
+}
+
+// finish completes the fix and starts the next one.
+func (d *Decoder) finish() Fix {
+	f := d.fix
+	if !d.clock.IsZero() {
+		f.Time = d.clock
+		if !d.date.IsZero() {
+			if !d.dated && d.clock.Before(d.lastClock) {
+				// past midnight since the date was last reported
+				d.date = d.date.AddDate(0, 0, 1)
+			}
+			d.lastClock = d.clock
+			f.Time = d.date.Add(d.clock.Sub(midnight))
+		}
+	}
+	for i := range f.SatellitesInView {
+		sat := &f.SatellitesInView[i]
+		system := systemID(sat.Talker, 0)
+		for _, u := range d.used {
+			if u.prn == sat.PRN && (u.system == 0 || system == 0 || u.system == system) {
+				sat.Used = true
+			}
 		}
-		return v
 	}
-	return 0.0
+
+	d.fix = Fix{}
+	d.clock = time.Time{}
+	d.seen = 0
+	d.started = false
+	d.used = d.used[:0]
+	d.dated = false
+	return f
 }
 
-// findSatellites returns the satellites from a GGA sentence:
-// $--GGA,,,,,,,nn,,,,,,,*hh
-func findSatellites(ggaFields []string) (n int16) {
-	if len(ggaFields) > 6 && len(ggaFields[7]) > 0 {
-		var nn = ggaFields[7]
-		var v, _ = strconv.ParseInt(nn, 10, 32)
-		n = int16(v)
-		return n
+// midnight is the start of the day of the times of day.
+var midnight = time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// timeOfDay returns the time of day of t on January 1 of year 0.
+func timeOfDay(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(0, time.January, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// systemID returns the NMEA 4.10 system ID of a talker, or id if given.
+func systemID(talker string, id int8) int8 {
+	if id != 0 {
+		return id
+	}
+	switch talker {
+	case "GP":
+		return 1
+	case "GL":
+		return 2
+	case "GA":
+		return 3
+	case "BD", "GB":
+		return 4
+	default:
+		return 0
 	}
-	return 0
 }
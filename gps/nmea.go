@@ -0,0 +1,624 @@
+package gps
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSentence     = errors.New("gps: invalid NMEA sentence")
+	ErrUnsupportedSentence = errors.New("gps: unsupported NMEA sentence")
+	ErrInvalidField        = errors.New("gps: invalid NMEA field")
+)
+
+// knots converts knots to meters per second.
+const knots = 1852.0 / 3600
+
+// Quality is the fix quality indicator of a GGA sentence.
+type Quality uint8
+
+const (
+	QualityInvalid Quality = iota
+	QualityGPS
+	QualityDGPS
+	QualityPPS
+	QualityRTK
+	QualityFloatRTK
+	QualityEstimated
+	QualityManual
+	QualitySimulation
+)
+
+// FixType is the kind of fix reported by a GSA sentence.
+type FixType uint8
+
+const (
+	FixUnknown FixType = iota
+	FixNone
+	Fix2D
+	Fix3D
+)
+
+// RMC is the recommended minimum data sentence.
+type RMC struct {
+	Talker     string
+	Time       time.Time // UTC date and time
+	Valid      bool
+	Latitude   float32
+	Longitude  float32
+	SpeedKnots float32
+	Course     float32 // true course in degrees
+	Variation  float32 // magnetic variation in degrees, negative to the west
+	Mode       byte    // positioning mode, such as 'A' for autonomous
+}
+
+// GGA is the fix data sentence.
+type GGA struct {
+	Talker     string
+	Time       time.Time // UTC time of day
+	Latitude   float32
+	Longitude  float32
+	Quality    Quality
+	Satellites int16 // number of satellites used
+	HDOP       float32
+	Altitude   float32 // above mean sea level in meters
+	Separation float32 // of the geoid above the WGS84 ellipsoid in meters
+}
+
+// GSA is the DOP and active satellites sentence.
+type GSA struct {
+	Talker   string
+	Auto     bool // the receiver selects 2D or 3D automatically
+	FixType  FixType
+	PRNs     []int16 // satellites used in the fix
+	PDOP     float32
+	HDOP     float32
+	VDOP     float32
+	SystemID int8 // GNSS system of NMEA 4.10 receivers, 0 if absent
+}
+
+// GSV is one of the messages of a satellites in view sentence.
+type GSV struct {
+	Talker     string
+	Messages   int // total number of messages
+	Message    int // number of this message, from 1
+	InView     int // total number of satellites in view
+	Satellites []Satellite
+}
+
+// Satellite describes a satellite in view.
+type Satellite struct {
+	Talker    string // of the GSV sentence, which identifies the system
+	PRN       int16
+	Elevation int16 // in degrees, -1 if unknown
+	Azimuth   int16 // in degrees, -1 if unknown
+	SNR       int16 // in dBHz, -1 if not tracked
+	Used      bool  // used in the fix, according to GSA
+}
+
+// VTG is the course over ground and ground speed sentence.
+type VTG struct {
+	Talker         string
+	Course         float32 // true course in degrees
+	MagneticCourse float32
+	SpeedKnots     float32
+	SpeedKmh       float32
+	Mode           byte
+}
+
+// GLL is the geographic position sentence.
+type GLL struct {
+	Talker    string
+	Latitude  float32
+	Longitude float32
+	Time      time.Time // UTC time of day
+	Valid     bool
+	Mode      byte
+}
+
+// ZDA is the time and date sentence.
+type ZDA struct {
+	Talker string
+	Time   time.Time // UTC date and time
+	Zone   time.Duration
+}
+
+// ParseNMEA decodes an NMEA sentence, including its checksum, into a value
+// of type RMC, GGA, GSA, GSV, VTG, GLL or ZDA. It returns
+// ErrUnsupportedSentence for other sentence types.
+func ParseNMEA(sentence string) (interface{}, error) {
+	f, err := splitSentence(sentence)
+	if err != nil {
+		return nil, err
+	}
+	switch f.kind() {
+	case "RMC":
+		return f.rmc()
+	case "GGA":
+		return f.gga()
+	case "GSA":
+		return f.gsa()
+	case "GSV":
+		return f.gsv()
+	case "VTG":
+		return f.vtg()
+	case "GLL":
+		return f.gll()
+	case "ZDA":
+		return f.zda()
+	default:
+		return nil, ErrUnsupportedSentence
+	}
+}
+
+// ParseRMC decodes an RMC sentence.
+// $--RMC,hhmmss.ss,A,ddmm.mm,N,dddmm.mm,E,x.x,x.x,ddmmyy,x.x,E,m*hh
+func ParseRMC(sentence string) (RMC, error) {
+	f, err := splitKind(sentence, "RMC")
+	if err != nil {
+		return RMC{}, err
+	}
+	return f.rmc()
+}
+
+// ParseGGA decodes a GGA sentence.
+// $--GGA,hhmmss.ss,ddmm.mm,N,dddmm.mm,E,q,nn,x.x,x.x,M,x.x,M,x.x,nnnn*hh
+func ParseGGA(sentence string) (GGA, error) {
+	f, err := splitKind(sentence, "GGA")
+	if err != nil {
+		return GGA{}, err
+	}
+	return f.gga()
+}
+
+// ParseGSA decodes a GSA sentence.
+// $--GSA,a,f,nn,nn,nn,nn,nn,nn,nn,nn,nn,nn,nn,nn,x.x,x.x,x.x[,s]*hh
+func ParseGSA(sentence string) (GSA, error) {
+	f, err := splitKind(sentence, "GSA")
+	if err != nil {
+		return GSA{}, err
+	}
+	return f.gsa()
+}
+
+// ParseGSV decodes a GSV sentence.
+// $--GSV,t,n,nn,pp,ee,aaa,ss,...[,s]*hh
+func ParseGSV(sentence string) (GSV, error) {
+	f, err := splitKind(sentence, "GSV")
+	if err != nil {
+		return GSV{}, err
+	}
+	return f.gsv()
+}
+
+// ParseVTG decodes a VTG sentence.
+// $--VTG,x.x,T,x.x,M,x.x,N,x.x,K,m*hh
+func ParseVTG(sentence string) (VTG, error) {
+	f, err := splitKind(sentence, "VTG")
+	if err != nil {
+		return VTG{}, err
+	}
+	return f.vtg()
+}
+
+// ParseGLL decodes a GLL sentence.
+// $--GLL,ddmm.mm,N,dddmm.mm,E,hhmmss.ss,A,m*hh
+func ParseGLL(sentence string) (GLL, error) {
+	f, err := splitKind(sentence, "GLL")
+	if err != nil {
+		return GLL{}, err
+	}
+	return f.gll()
+}
+
+// ParseZDA decodes a ZDA sentence.
+// $--ZDA,hhmmss.ss,dd,mm,yyyy,zh,zm*hh
+func ParseZDA(sentence string) (ZDA, error) {
+	f, err := splitKind(sentence, "ZDA")
+	if err != nil {
+		return ZDA{}, err
+	}
+	return f.zda()
+}
+
+// fields are the comma separated fields of a sentence, the first being the
+// talker and sentence type.
+type fields []string
+
+func splitSentence(sentence string) (fields, error) {
+	sentence = strings.TrimRight(sentence, "\r\n")
+	if !validSentence(sentence) || len(sentence) < 9 {
+		return nil, ErrInvalidSentence
+	}
+	f := fields(strings.Split(sentence[1:len(sentence)-3], ","))
+	if len(f[0]) != 5 {
+		return nil, ErrInvalidSentence
+	}
+	return f, nil
+}
+
+func splitKind(sentence, kind string) (fields, error) {
+	f, err := splitSentence(sentence)
+	if err == nil && f.kind() != kind {
+		err = ErrUnsupportedSentence
+	}
+	return f, err
+}
+
+func (f fields) talker() string {
+	return f[0][:2]
+}
+
+func (f fields) kind() string {
+	return f[0][2:]
+}
+
+// get returns field i, or an empty string if the sentence is shorter.
+func (f fields) get(i int) string {
+	if i < len(f) {
+		return f[i]
+	}
+	return ""
+}
+
+func (f fields) rmc() (s RMC, err error) {
+	if len(f) < 10 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	if s.Time, err = parseDateTime(f[9], f[1]); err != nil {
+		return
+	}
+	s.Valid = f[2] == "A"
+	if s.Latitude, err = parseLatitude(f[3], f[4]); err != nil {
+		return
+	}
+	if s.Longitude, err = parseLongitude(f[5], f[6]); err != nil {
+		return
+	}
+	if s.SpeedKnots, err = parseFloat(f[7]); err != nil {
+		return
+	}
+	if s.Course, err = parseFloat(f[8]); err != nil {
+		return
+	}
+	if s.Variation, err = parseFloat(f.get(10)); err != nil {
+		return
+	}
+	if f.get(11) == "W" {
+		s.Variation = -s.Variation
+	}
+	s.Mode = firstByte(f.get(12))
+	return
+}
+
+func (f fields) gga() (s GGA, err error) {
+	if len(f) < 12 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	if s.Time, err = parseTime(f[1]); err != nil {
+		return
+	}
+	if s.Latitude, err = parseLatitude(f[2], f[3]); err != nil {
+		return
+	}
+	if s.Longitude, err = parseLongitude(f[4], f[5]); err != nil {
+		return
+	}
+	q, err := parseInt(f[6])
+	if err != nil {
+		return
+	}
+	s.Quality = Quality(q)
+	n, err := parseInt(f[7])
+	if err != nil {
+		return
+	}
+	s.Satellites = int16(n)
+	if s.HDOP, err = parseFloat(f[8]); err != nil {
+		return
+	}
+	if s.Altitude, err = parseFloat(f[9]); err != nil {
+		return
+	}
+	s.Separation, err = parseFloat(f[11])
+	return
+}
+
+func (f fields) gsa() (s GSA, err error) {
+	if len(f) < 18 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	s.Auto = f[1] == "A"
+	t, err := parseInt(f[2])
+	if err != nil {
+		return
+	}
+	s.FixType = FixType(t)
+	for _, v := range f[3:15] {
+		if v == "" {
+			continue
+		}
+		prn, err := parseInt(v)
+		if err != nil {
+			return s, err
+		}
+		s.PRNs = append(s.PRNs, int16(prn))
+	}
+	if s.PDOP, err = parseFloat(f[15]); err != nil {
+		return
+	}
+	if s.HDOP, err = parseFloat(f[16]); err != nil {
+		return
+	}
+	if s.VDOP, err = parseFloat(f[17]); err != nil {
+		return
+	}
+	id, err := parseInt(f.get(18))
+	s.SystemID = int8(id)
+	return
+}
+
+func (f fields) gsv() (s GSV, err error) {
+	if len(f) < 4 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	if s.Messages, err = parseInt(f[1]); err != nil {
+		return
+	}
+	if s.Message, err = parseInt(f[2]); err != nil {
+		return
+	}
+	if s.InView, err = parseInt(f[3]); err != nil {
+		return
+	}
+	// groups of 4 fields, possibly followed by the signal ID of NMEA 4.10
+	for i := 4; i+4 <= len(f); i += 4 {
+		if f[i] == "" {
+			continue
+		}
+		sat := Satellite{Talker: s.Talker}
+		var v [4]int
+		for j := range v {
+			if f[i+j] == "" {
+				v[j] = -1
+			} else if v[j], err = strconv.Atoi(f[i+j]); err != nil {
+				return s, ErrInvalidField
+			}
+		}
+		sat.PRN, sat.Elevation, sat.Azimuth, sat.SNR = int16(v[0]), int16(v[1]), int16(v[2]), int16(v[3])
+		s.Satellites = append(s.Satellites, sat)
+	}
+	return
+}
+
+func (f fields) vtg() (s VTG, err error) {
+	if len(f) < 5 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	if f[2] != "T" {
+		// NMEA 2.0 and older: course, magnetic course, knots, km/h
+		if s.Course, err = parseFloat(f[1]); err != nil {
+			return
+		}
+		if s.MagneticCourse, err = parseFloat(f[2]); err != nil {
+			return
+		}
+		if s.SpeedKnots, err = parseFloat(f[3]); err != nil {
+			return
+		}
+		s.SpeedKmh, err = parseFloat(f[4])
+		return
+	}
+	if len(f) < 9 {
+		return s, ErrInvalidField
+	}
+	if s.Course, err = parseFloat(f[1]); err != nil {
+		return
+	}
+	if s.MagneticCourse, err = parseFloat(f[3]); err != nil {
+		return
+	}
+	if s.SpeedKnots, err = parseFloat(f[5]); err != nil {
+		return
+	}
+	if s.SpeedKmh, err = parseFloat(f[7]); err != nil {
+		return
+	}
+	s.Mode = firstByte(f.get(9))
+	return
+}
+
+func (f fields) gll() (s GLL, err error) {
+	if len(f) < 7 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	if s.Latitude, err = parseLatitude(f[1], f[2]); err != nil {
+		return
+	}
+	if s.Longitude, err = parseLongitude(f[3], f[4]); err != nil {
+		return
+	}
+	if s.Time, err = parseTime(f[5]); err != nil {
+		return
+	}
+	s.Valid = f[6] == "A"
+	s.Mode = firstByte(f.get(7))
+	return
+}
+
+func (f fields) zda() (s ZDA, err error) {
+	if len(f) < 5 {
+		return s, ErrInvalidField
+	}
+	s.Talker = f.talker()
+	if f[2] != "" || f[3] != "" || f[4] != "" {
+		var day, month, year int
+		if day, err = parseInt(f[2]); err != nil {
+			return
+		}
+		if month, err = parseInt(f[3]); err != nil {
+			return
+		}
+		if year, err = parseInt(f[4]); err != nil {
+			return
+		}
+		if len(f[4]) != 4 || day < 1 || day > 31 || month < 1 || month > 12 {
+			return s, ErrInvalidField
+		}
+		if s.Time, err = parseTime(f[1]); err != nil || s.Time.IsZero() {
+			return
+		}
+		s.Time = s.Time.AddDate(year, month-1, day-1)
+	}
+	hours, err := parseInt(f.get(5))
+	if err != nil {
+		return
+	}
+	minutes, err := parseInt(f.get(6))
+	if hours < 0 {
+		minutes = -minutes
+	}
+	s.Zone = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	return
+}
+
+// parseTime parses hhmmss.sss into a time of day on January 1 of year 0,
+// like time.Parse does. An empty field gives the zero time.
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if len(v) < 6 {
+		return time.Time{}, ErrInvalidField
+	}
+	var hms [3]int
+	for i := range hms {
+		d0, d1 := v[2*i]-'0', v[2*i+1]-'0'
+		if d0 > 9 || d1 > 9 {
+			return time.Time{}, ErrInvalidField
+		}
+		hms[i] = int(d0)*10 + int(d1)
+	}
+	if hms[0] > 23 || hms[1] > 59 || hms[2] > 60 {
+		return time.Time{}, ErrInvalidField
+	}
+	var nsec int
+	if len(v) > 6 {
+		if v[6] != '.' {
+			return time.Time{}, ErrInvalidField
+		}
+		scale := int(time.Second)
+		for _, c := range v[7:] {
+			if c < '0' || c > '9' {
+				return time.Time{}, ErrInvalidField
+			}
+			scale /= 10
+			nsec += int(c-'0') * scale
+		}
+	}
+	return time.Date(0, time.January, 1, hms[0], hms[1], hms[2], nsec, time.UTC), nil
+}
+
+// parseDateTime parses an RMC date ddmmyy and time. Without a date, it
+// returns the time of day like parseTime.
+func parseDateTime(date, clock string) (time.Time, error) {
+	t, err := parseTime(clock)
+	if err != nil || date == "" || t.IsZero() {
+		return t, err
+	}
+	if len(date) != 6 {
+		return time.Time{}, ErrInvalidField
+	}
+	d, err := strconv.Atoi(date)
+	if err != nil {
+		return time.Time{}, ErrInvalidField
+	}
+	day, month, year := d/10000, d/100%100, d%100
+	if day < 1 || day > 31 || month < 1 || month > 12 {
+		return time.Time{}, ErrInvalidField
+	}
+	// two digit years are 1980 to 2079
+	if year < 80 {
+		year += 2000
+	} else {
+		year += 1900
+	}
+	return t.AddDate(year, month-1, day-1), nil
+}
+
+// parseLatitude parses ddmm.mmmm and the N or S hemisphere.
+func parseLatitude(v, hemisphere string) (float32, error) {
+	deg, err := parseCoordinate(v, 90)
+	if hemisphere == "S" {
+		deg = -deg
+	} else if hemisphere != "N" && v != "" {
+		return 0, ErrInvalidField
+	}
+	return deg, err
+}
+
+// parseLongitude parses dddmm.mmmm and the E or W hemisphere.
+func parseLongitude(v, hemisphere string) (float32, error) {
+	deg, err := parseCoordinate(v, 180)
+	if hemisphere == "W" {
+		deg = -deg
+	} else if hemisphere != "E" && v != "" {
+		return 0, ErrInvalidField
+	}
+	return deg, err
+}
+
+func parseCoordinate(v string, max float64) (float32, error) {
+	if v == "" {
+		return 0, nil
+	}
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil || x < 0 {
+		return 0, ErrInvalidField
+	}
+	deg := float64(int(x / 100))
+	min := x - deg*100
+	if min >= 60 || deg+min/60 > max {
+		return 0, ErrInvalidField
+	}
+	return float32(deg + min/60), nil
+}
+
+// parseFloat parses a decimal field, empty fields are zero.
+func parseFloat(v string) (float32, error) {
+	if v == "" {
+		return 0, nil
+	}
+	x, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		return 0, ErrInvalidField
+	}
+	return float32(x), nil
+}
+
+// parseInt parses an integer field, empty fields are zero.
+func parseInt(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	x, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, ErrInvalidField
+	}
+	return x, nil
+}
+
+func firstByte(v string) byte {
+	if v == "" {
+		return 0
+	}
+	return v[0]
+}
@@ -0,0 +1,405 @@
+package gps_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+)
+
+// checksum completes a sentence without its checksum.
+func checksum(sentence string) string {
+	var cs byte
+	for i := 1; i < len(sentence); i++ {
+		cs ^= sentence[i]
+	}
+	return fmt.Sprintf("%s*%02X", sentence, cs)
+}
+
+// withTalker returns sentence as sent by another talker.
+func withTalker(sentence, talker string) string {
+	return checksum("$" + talker + sentence[3:strings.IndexByte(sentence, '*')])
+}
+
+// The examples of the NMEA 0183 sentence descriptions commonly quoted for
+// GPS receivers.
+var sentences = []struct {
+	sentence string
+	want     interface{}
+}{
+	{
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A",
+		gps.RMC{
+			Time:       time.Date(1994, time.March, 23, 12, 35, 19, 0, time.UTC),
+			Valid:      true,
+			Latitude:   48 + 7.038/60,
+			Longitude:  11 + 31.0/60,
+			SpeedKnots: 22.4,
+			Course:     84.4,
+			Variation:  -3.1,
+		},
+	},
+	{
+		"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47",
+		gps.GGA{
+			Time:       time.Date(0, time.January, 1, 12, 35, 19, 0, time.UTC),
+			Latitude:   48 + 7.038/60,
+			Longitude:  11 + 31.0/60,
+			Quality:    gps.QualityGPS,
+			Satellites: 8,
+			HDOP:       0.9,
+			Altitude:   545.4,
+			Separation: 46.9,
+		},
+	},
+	{
+		"$GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3,2.1*39",
+		gps.GSA{
+			Auto:    true,
+			FixType: gps.Fix3D,
+			PRNs:    []int16{4, 5, 9, 12, 24},
+			PDOP:    2.5,
+			HDOP:    1.3,
+			VDOP:    2.1,
+		},
+	},
+	{
+		"$GPGSV,2,1,08,01,40,083,46,02,17,308,41,12,07,344,39,14,22,228,45*75",
+		gps.GSV{
+			Messages: 2,
+			Message:  1,
+			InView:   8,
+			Satellites: []gps.Satellite{
+				{PRN: 1, Elevation: 40, Azimuth: 83, SNR: 46},
+				{PRN: 2, Elevation: 17, Azimuth: 308, SNR: 41},
+				{PRN: 12, Elevation: 7, Azimuth: 344, SNR: 39},
+				{PRN: 14, Elevation: 22, Azimuth: 228, SNR: 45},
+			},
+		},
+	},
+	{
+		"$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*48",
+		gps.VTG{Course: 54.7, MagneticCourse: 34.4, SpeedKnots: 5.5, SpeedKmh: 10.2},
+	},
+	{
+		"$GPGLL,4916.45,N,12311.12,W,225444,A,*1D",
+		gps.GLL{
+			Latitude:  49 + 16.45/60,
+			Longitude: -(123 + 11.12/60),
+			Time:      time.Date(0, time.January, 1, 22, 54, 44, 0, time.UTC),
+			Valid:     true,
+		},
+	},
+	{
+		"$GPZDA,201530.00,04,07,2002,00,00*60",
+		gps.ZDA{Time: time.Date(2002, time.July, 4, 20, 15, 30, 0, time.UTC)},
+	},
+}
+
+// setTalker sets the talker of a parsed sentence, and of its satellites.
+func setTalker(v interface{}, talker string) interface{} {
+	switch s := v.(type) {
+	case gps.RMC:
+		s.Talker = talker
+		return s
+	case gps.GGA:
+		s.Talker = talker
+		return s
+	case gps.GSA:
+		s.Talker = talker
+		return s
+	case gps.GSV:
+		s.Talker = talker
+		sats := append([]gps.Satellite(nil), s.Satellites...)
+		for i := range sats {
+			sats[i].Talker = talker
+		}
+		s.Satellites = sats
+		return s
+	case gps.VTG:
+		s.Talker = talker
+		return s
+	case gps.GLL:
+		s.Talker = talker
+		return s
+	case gps.ZDA:
+		s.Talker = talker
+		return s
+	}
+	return v
+}
+
+func TestParseNMEA(t *testing.T) {
+	for _, tc := range sentences {
+		for _, talker := range []string{"GP", "GN", "GL", "GA", "BD", "GB"} {
+			sentence := withTalker(tc.sentence, talker)
+			if talker == "GP" && sentence != tc.sentence {
+				t.Fatalf("checksum of %s: got %s", tc.sentence, sentence)
+			}
+			got, err := gps.ParseNMEA(sentence)
+			if err != nil {
+				t.Errorf("%s: %v", sentence, err)
+				continue
+			}
+			if want := setTalker(tc.want, talker); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s:\ngot  %+v\nwant %+v", sentence, got, want)
+			}
+		}
+	}
+}
+
+// TestParseMulti checks sentences in the NMEA 4.10 format of multi-GNSS
+// receivers, with system and signal IDs and mode indicators.
+func TestParseMulti(t *testing.T) {
+	for _, tc := range []struct {
+		sentence string
+		want     interface{}
+	}{
+		{
+			"$GNRMC,235959.00,A,4717.11399,N,00833.91590,E,0.011,,311223,,,A,V",
+			gps.RMC{
+				Talker:     "GN",
+				Time:       time.Date(2023, time.December, 31, 23, 59, 59, 0, time.UTC),
+				Valid:      true,
+				Latitude:   47 + 17.11399/60,
+				Longitude:  8 + 33.91590/60,
+				SpeedKnots: 0.011,
+				Mode:       'A',
+			},
+		},
+		{
+			"$GNRMC,000001.00,V,,,,,,,010124,,,N,V",
+			gps.RMC{
+				Talker: "GN",
+				Time:   time.Date(2024, time.January, 1, 0, 0, 1, 0, time.UTC),
+				Mode:   'N',
+			},
+		},
+		{
+			"$GNGGA,000001.00,,,,,0,00,99.99,,,,,,",
+			gps.GGA{
+				Talker: "GN",
+				Time:   time.Date(0, time.January, 1, 0, 0, 1, 0, time.UTC),
+				HDOP:   99.99,
+			},
+		},
+		{
+			"$GNGSA,A,3,65,72,,,,,,,,,,,1.94,1.01,1.66,2",
+			gps.GSA{
+				Talker:   "GN",
+				Auto:     true,
+				FixType:  gps.Fix3D,
+				PRNs:     []int16{65, 72},
+				PDOP:     1.94,
+				HDOP:     1.01,
+				VDOP:     1.66,
+				SystemID: 2,
+			},
+		},
+		{
+			"$GPGSV,3,3,10,30,10,324,,31,,,,1",
+			gps.GSV{
+				Talker:   "GP",
+				Messages: 3,
+				Message:  3,
+				InView:   10,
+				Satellites: []gps.Satellite{
+					{Talker: "GP", PRN: 30, Elevation: 10, Azimuth: 324, SNR: -1},
+					{Talker: "GP", PRN: 31, Elevation: -1, Azimuth: -1, SNR: -1},
+				},
+			},
+		},
+		{
+			"$GNVTG,,T,,M,0.011,N,0.020,K,A",
+			gps.VTG{Talker: "GN", SpeedKnots: 0.011, SpeedKmh: 0.02, Mode: 'A'},
+		},
+		{
+			"$GNGLL,,,,,000001.00,V,N",
+			gps.GLL{
+				Talker: "GN",
+				Time:   time.Date(0, time.January, 1, 0, 0, 1, 0, time.UTC),
+				Mode:   'N',
+			},
+		},
+		{
+			"$GNZDA,003000.50,01,01,2024,-03,30",
+			gps.ZDA{
+				Talker: "GN",
+				Time:   time.Date(2024, time.January, 1, 0, 30, 0, 5e8, time.UTC),
+				Zone:   -3*time.Hour - 30*time.Minute,
+			},
+		},
+	} {
+		got, err := gps.ParseNMEA(checksum(tc.sentence))
+		if err != nil {
+			t.Errorf("%s: %v", tc.sentence, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tc.sentence, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		sentence string
+		err      error
+	}{
+		{"$GPRMC,1235x9,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,243519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,320394,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,23039,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,123519,A,4860.038,N,01131.000,E,022.4,084.4,230394,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,123519,A,4807.038,X,01131.000,E,022.4,084.4,230394,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,123519,A,4807.038,N,18131.000,E,022.4,084.4,230394,003.1,W", gps.ErrInvalidField},
+		{"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4", gps.ErrInvalidField},
+		{"$GPGGA,123519,4807.038,N,01131.000,E,x,08,0.9,545.4,M,46.9,M,,", gps.ErrInvalidField},
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4.1,M,46.9,M,,", gps.ErrInvalidField},
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9", gps.ErrInvalidField},
+		{"$GPGSA,A,3,04,a5,,09,12,,,24,,,,,2.5,1.3,2.1", gps.ErrInvalidField},
+		{"$GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3", gps.ErrInvalidField},
+		{"$GPGSV,2,1,08,01,40,083,4x", gps.ErrInvalidField},
+		{"$GPGSV,2,1,08,01,40,083,46,02,17,3o8,41", gps.ErrInvalidField},
+		{"$GPVTG,054.7,T,034.4,M,0.5.5,N,010.2,K", gps.ErrInvalidField},
+		{"$GPVTG,054.7,T,034.4,M", gps.ErrInvalidField},
+		{"$GPGLL,4916.45,N,-12311.12,W,225444,A,", gps.ErrInvalidField},
+		{"$GPGLL,4916.45,N,12311.12,W,2254,A,", gps.ErrInvalidField},
+		{"$GPZDA,201530.00,04,07,02,00,00", gps.ErrInvalidField},
+		{"$GPZDA,201530.00,04,13,2002,00,00", gps.ErrInvalidField},
+		{"$GPZDA,201530:00,04,07,2002,00,00", gps.ErrInvalidField},
+		{"$GPTXT,01,01,02,ANTSTATUS=OK", gps.ErrUnsupportedSentence},
+		{"$GPRM", gps.ErrInvalidSentence},
+		{"$GPSRMC,1", gps.ErrInvalidSentence},
+	} {
+		if _, err := gps.ParseNMEA(checksum(tc.sentence)); err != tc.err {
+			t.Errorf("%s: got %v, want %v", tc.sentence, err, tc.err)
+		}
+	}
+
+	for _, sentence := range []string{
+		"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*46",
+		"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,",
+		"GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47",
+	} {
+		if _, err := gps.ParseNMEA(sentence); err != gps.ErrInvalidSentence {
+			t.Errorf("%s: got %v, want %v", sentence, err, gps.ErrInvalidSentence)
+		}
+	}
+	if _, err := gps.ParseRMC(sentences[1].sentence); err != gps.ErrUnsupportedSentence {
+		t.Errorf("ParseRMC of GGA: got %v, want %v", err, gps.ErrUnsupportedSentence)
+	}
+	if _, err := gps.ParseGGA(sentences[1].sentence + "\r\n"); err != nil {
+		t.Errorf("ParseGGA with line end: %v", err)
+	}
+}
+
+// decode returns the fixes of the sentences, which are completed with their
+// checksums.
+func decode(t *testing.T, sentences []string) []gps.Fix {
+	t.Helper()
+	var d gps.Decoder
+	var fixes []gps.Fix
+	for _, s := range sentences {
+		fix, ok, err := d.Decode(checksum(s))
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if ok {
+			fixes = append(fixes, fix)
+		}
+	}
+	if fix, ok := d.Flush(); ok {
+		fixes = append(fixes, fix)
+	}
+	return fixes
+}
+
+// TestDecoder checks the merging of the sentences of several systems that a
+// multi-GNSS receiver sends for every fix.
+func TestDecoder(t *testing.T) {
+	fixes := decode(t, []string{
+		"$GNRMC,120000.00,A,4717.11399,N,00833.91590,E,1.944,90.0,150624,,,A,V",
+		"$GNVTG,90.0,T,,M,1.944,N,3.600,K,A",
+		"$GNGGA,120000.00,4717.11399,N,00833.91590,E,1,05,1.01,499.6,M,48.0,M,,",
+		"$GNGSA,A,3,07,08,09,,,,,,,,,,1.94,1.01,1.66,1",
+		"$GNGSA,A,3,65,72,,,,,,,,,,,1.94,1.01,1.66,2",
+		"$GPGSV,1,1,04,07,47,130,38,08,33,091,34,09,29,250,33,65,06,049,,1",
+		"$GLGSV,1,1,02,65,41,313,35,72,57,055,31,1",
+		"$GAGSV,1,1,01,07,20,200,30,7",
+		"$GNGLL,4717.11399,N,00833.91590,E,120000.00,A,A",
+		"$GNRMC,120001.00,A,4717.11400,N,00833.91600,E,0.000,,150624,,,A,V",
+		"$GNGGA,120001.00,4717.11400,N,00833.91600,E,1,05,1.02,499.7,M,48.0,M,,",
+	})
+	if len(fixes) != 2 {
+		t.Fatalf("got %d fixes, want 2", len(fixes))
+	}
+	f := fixes[0]
+	if !f.Valid || f.Quality != gps.QualityGPS || f.FixType != gps.Fix3D || f.Satellites != 5 {
+		t.Errorf("got valid %v, quality %d, fix type %d, %d satellites", f.Valid, f.Quality, f.FixType, f.Satellites)
+	}
+	if want := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC); !f.Time.Equal(want) {
+		t.Errorf("got time %v, want %v", f.Time, want)
+	}
+	if f.Altitude != 499 || f.HDOP != 1.01 || f.PDOP != 1.94 || f.VDOP != 1.66 {
+		t.Errorf("got altitude %d, DOP %v %v %v", f.Altitude, f.HDOP, f.PDOP, f.VDOP)
+	}
+	if f.Speed < 0.99 || f.Speed > 1.01 || f.Course != 90 {
+		t.Errorf("got speed %v, course %v", f.Speed, f.Course)
+	}
+	// GPS 65 and Galileo 07 are not used, although GPS 07 and GLONASS 65 are
+	var used []string
+	for _, sat := range f.SatellitesInView {
+		if sat.Used {
+			used = append(used, fmt.Sprint(sat.Talker, sat.PRN))
+		}
+	}
+	if got, want := strings.Join(used, " "), "GP7 GP8 GP9 GL65 GL72"; got != want {
+		t.Errorf("used satellites: got %s, want %s", got, want)
+	}
+	if len(f.SatellitesInView) != 7 {
+		t.Errorf("got %d satellites in view, want 7", len(f.SatellitesInView))
+	}
+	if f := fixes[1]; f.HDOP != 1.02 || f.Speed != 0 || len(f.SatellitesInView) != 0 {
+		t.Errorf("second fix: got HDOP %v, speed %v, %d satellites in view", f.HDOP, f.Speed, len(f.SatellitesInView))
+	}
+}
+
+// TestDecoderMidnight checks the date of fixes without a date after
+// midnight.
+func TestDecoderMidnight(t *testing.T) {
+	fixes := decode(t, []string{
+		// before the date is known
+		"$GNGGA,235958.00,4717.11399,N,00833.91590,E,1,09,1.01,499.6,M,48.0,M,,",
+		"$GNRMC,235959.00,A,4717.11399,N,00833.91590,E,0.011,,311223,,,A,V",
+		"$GNGGA,235959.00,4717.11399,N,00833.91590,E,1,09,1.01,499.6,M,48.0,M,,",
+		// only GGA sentences from here
+		"$GNGGA,235959.50,4717.11399,N,00833.91590,E,1,09,1.01,499.6,M,48.0,M,,",
+		"$GNGGA,000000.00,4717.11400,N,00833.91591,E,1,09,1.01,499.7,M,48.0,M,,",
+		"$GNGGA,000000.50,4717.11400,N,00833.91591,E,1,09,1.01,499.7,M,48.0,M,,",
+		"$GNRMC,000001.00,A,4717.11400,N,00833.91591,E,0.011,,010124,,,A,V",
+		"$GNGGA,235959.00,4717.11400,N,00833.91591,E,1,09,1.01,499.7,M,48.0,M,,",
+		"$GNGGA,000000.00,4717.11400,N,00833.91591,E,1,09,1.01,499.7,M,48.0,M,,",
+	})
+	want := []time.Time{
+		time.Date(0, time.January, 1, 23, 59, 58, 0, time.UTC),
+		time.Date(2023, time.December, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2023, time.December, 31, 23, 59, 59, 5e8, time.UTC),
+		time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, time.January, 1, 0, 0, 0, 5e8, time.UTC),
+		time.Date(2024, time.January, 1, 0, 0, 1, 0, time.UTC),
+		time.Date(2024, time.January, 1, 23, 59, 59, 0, time.UTC),
+		time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if len(fixes) != len(want) {
+		t.Fatalf("got %d fixes, want %d", len(fixes), len(want))
+	}
+	for i, f := range fixes {
+		if !f.Time.Equal(want[i]) {
+			t.Errorf("fix %d: got %v, want %v", i, f.Time, want[i])
+		}
+	}
+}
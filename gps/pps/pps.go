@@ -0,0 +1,147 @@
+// Package pps sets a real time clock, such as the DS3231, from the time
+// pulse of a u-blox GNSS receiver.
+//
+// The receiver marks the top of every UTC second with a pulse, then tells
+// the time of that second in a NAV-TIMEUTC message a little later. Setting
+// the clock right at the next pulse aligns it to UTC to within the time
+// the program takes to react, as clocks like the DS3231 restart their second
+// when it is written.
+//
+// Configure the receiver with Configure, call Edge from the interrupt of the
+// pin the time pulse is connected to, pass the NAV-TIMEUTC messages to
+// Update and call Poll as often as possible:
+//
+//	sync := pps.Discipliner{Clock: &rtc, Interval: 24 * time.Hour}
+//	pin.SetInterrupt(machine.PinRising, func(machine.Pin) { sync.Edge() })
+//	stream.UBX = func(m ubx.Message) {
+//		if t, err := ubx.ParseNavTimeUTC(m); err == nil {
+//			sync.Update(t)
+//		}
+//	}
+//	for {
+//		if set, err := sync.Poll(); set {
+//			...
+//		}
+//		...
+//	}
+package pps // import "tinygo.org/x/drivers/gps/pps"
+
+import (
+	"sync/atomic"
+	"time"
+
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// Clock is a real time clock with a resolution of a second.
+type Clock interface {
+	SetTime(t time.Time) error
+	ReadTime() (time.Time, error)
+}
+
+// Configure sets up the time pulse of the receiver to a pulse per second
+// and enables the NAV-TIMEUTC message.
+func Configure(c *ubx.Client) error {
+	if err := c.Send(ubx.CfgTimePulse(ubx.PPS)); err != nil {
+		return err
+	}
+	return c.Send(ubx.CfgMsg(ubx.ClassNAV, ubx.IDNavTimeUTC, 1))
+}
+
+// Discipliner keeps a clock on UTC with the time pulse of a receiver.
+type Discipliner struct {
+	Clock Clock
+
+	// Interval, if not zero, is how often the clock is set even if it
+	// reads the right second, to bring its phase back onto the pulse.
+	// Otherwise the clock is only set when it is off by a second or more.
+	Interval time.Duration
+
+	// Now returns the current time, time.Now if nil. Only the time since a
+	// pulse is taken from it.
+	Now func() time.Time
+
+	edges    uint32 // pulses, updated by Edge
+	edgeTime int64  // Now of the last pulse in ns
+
+	ref      time.Time // UTC of pulse number refEdge
+	refEdge  uint32
+	hasRef   bool
+	lastEdge uint32 // last pulse seen by Poll
+	lastSet  time.Time
+	checked  bool // the clock was read since the last pulse
+	wrong    bool // and was off
+}
+
+// Edge records a pulse. It is safe to call from an interrupt.
+func (d *Discipliner) Edge() {
+	atomic.StoreInt64(&d.edgeTime, d.now())
+	atomic.AddUint32(&d.edges, 1)
+}
+
+// Update takes the time of the last navigation epoch, which names the last
+// pulse. Times that are not valid UTC, not on the second or too late for
+// the last pulse are ignored.
+func (d *Discipliner) Update(t ubx.NavTimeUTC) {
+	if t.Valid&ubx.ValidUTC == 0 {
+		return
+	}
+	sec := t.Time.Round(time.Second)
+	if offset := t.Time.Sub(sec); offset > time.Millisecond || offset < -time.Millisecond {
+		return // not the epoch of a pulse, at a navigation rate above 1Hz
+	}
+	edges := atomic.LoadUint32(&d.edges)
+	since := d.now() - atomic.LoadInt64(&d.edgeTime)
+	if edges == 0 || since > int64(time.Second) {
+		return
+	}
+	d.ref, d.refEdge, d.hasRef = sec, edges, true
+}
+
+// Poll sets the clock at a pulse if it needs it, and returns whether it
+// did: at the first pulse, when it read the wrong second in the middle of the
+// previous one, and every Interval. Poll must be called well within a second
+// of the pulse, the sooner the better: the delay is the error of the clock.
+func (d *Discipliner) Poll() (bool, error) {
+	edges := atomic.LoadUint32(&d.edges)
+	if !d.hasRef {
+		d.lastEdge = edges
+		return false, nil
+	}
+	utc := d.ref.Add(time.Duration(edges-d.refEdge) * time.Second)
+	if edges != d.lastEdge {
+		d.lastEdge = edges
+		d.checked = false
+		if edges == d.refEdge || !(d.lastSet.IsZero() || d.wrong ||
+			(d.Interval != 0 && utc.Sub(d.lastSet) >= d.Interval)) {
+			return false, nil
+		}
+		if err := d.Clock.SetTime(utc); err != nil {
+			return false, err
+		}
+		d.lastSet, d.wrong = utc, false
+		return true, nil
+	}
+
+	// halfway to the next pulse, the clock must read the second of the
+	// last one
+	since := d.now() - atomic.LoadInt64(&d.edgeTime)
+	if d.checked || d.lastSet.IsZero() || since < int64(time.Second/2) {
+		return false, nil
+	}
+	d.checked = true
+	now, err := d.Clock.ReadTime()
+	if err != nil {
+		return false, err
+	}
+	d.wrong = !now.Equal(utc)
+	return false, nil
+}
+
+// now returns the current time in ns.
+func (d *Discipliner) now() int64 {
+	if d.Now != nil {
+		return d.Now().UnixNano()
+	}
+	return time.Now().UnixNano()
+}
@@ -0,0 +1,223 @@
+package pps_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps/pps"
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// rtc is a clock that records the times it is set to, and reads time.
+type rtc struct {
+	set   []time.Time
+	time  time.Time
+	reads int
+	err   error
+}
+
+func (c *rtc) SetTime(t time.Time) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.set = append(c.set, t)
+	c.time = t
+	return nil
+}
+
+func (c *rtc) ReadTime() (time.Time, error) {
+	c.reads++
+	return c.time, nil
+}
+
+// sim drives a Discipliner with pulses on a manual clock.
+type sim struct {
+	d   pps.Discipliner
+	rtc rtc
+	now time.Time
+	utc time.Time // of the next pulse
+}
+
+var start = time.Date(2024, 6, 30, 23, 59, 50, 0, time.UTC)
+
+func newSim(interval time.Duration) *sim {
+	s := &sim{now: time.Unix(1000, 0), utc: start}
+	s.d = pps.Discipliner{Clock: &s.rtc, Interval: interval, Now: func() time.Time { return s.now }}
+	return s
+}
+
+// pulse moves to the next pulse and, if report, passes its time to Update
+// 100ms later.
+func (s *sim) pulse(report bool) {
+	s.now = s.now.Truncate(time.Second).Add(time.Second)
+	s.d.Edge()
+	if report {
+		s.now = s.now.Add(100 * time.Millisecond)
+		s.d.Update(ubx.NavTimeUTC{Time: s.utc, Valid: ubx.ValidUTC})
+	}
+	s.utc = s.utc.Add(time.Second)
+}
+
+func (s *sim) poll(t *testing.T) bool {
+	t.Helper()
+	set, err := s.d.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+// check compares the times the clock was set with want.
+func (s *sim) check(t *testing.T, want ...time.Time) {
+	t.Helper()
+	if len(s.rtc.set) != len(want) {
+		t.Fatalf("set the clock to %v, want %v", s.rtc.set, want)
+	}
+	for i := range want {
+		if !s.rtc.set[i].Equal(want[i]) {
+			t.Errorf("set the clock to %v, want %v", s.rtc.set, want)
+		}
+	}
+}
+
+func TestFirstSet(t *testing.T) {
+	s := newSim(0)
+	if s.poll(t) {
+		t.Error("set without a time")
+	}
+	// the pulse that the time names is already past
+	s.pulse(true)
+	if s.poll(t) {
+		t.Error("set at the pulse of the time")
+	}
+	s.pulse(false)
+	if !s.poll(t) {
+		t.Error("not set at the next pulse")
+	}
+	s.check(t, start.Add(time.Second))
+
+	for i := 0; i < 5; i++ {
+		s.pulse(false)
+		if s.poll(t) {
+			t.Fatal("set again without need")
+		}
+	}
+	s.check(t, start.Add(time.Second))
+}
+
+func TestUpdateIgnored(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		update func(s *sim)
+	}{
+		{"not valid", func(s *sim) {
+			s.pulse(false)
+			s.d.Update(ubx.NavTimeUTC{Time: start, Valid: ubx.ValidTOW | ubx.ValidWKN})
+		}},
+		{"not on the second", func(s *sim) {
+			s.pulse(false)
+			s.d.Update(ubx.NavTimeUTC{Time: start.Add(2 * time.Millisecond), Valid: ubx.ValidUTC})
+		}},
+		{"too late", func(s *sim) {
+			s.pulse(false)
+			s.now = s.now.Add(1500 * time.Millisecond)
+			s.d.Update(ubx.NavTimeUTC{Time: start, Valid: ubx.ValidUTC})
+		}},
+		{"before the first pulse", func(s *sim) {
+			s.d.Update(ubx.NavTimeUTC{Time: start, Valid: ubx.ValidUTC})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSim(0)
+			tc.update(s)
+			s.pulse(false)
+			s.pulse(false)
+			if s.poll(t) {
+				t.Error("set the clock")
+			}
+		})
+	}
+
+	// a time within a millisecond of the second is rounded
+	s := newSim(0)
+	s.pulse(false)
+	s.d.Update(ubx.NavTimeUTC{Time: start.Add(-500 * time.Microsecond), Valid: ubx.ValidUTC})
+	s.pulse(false)
+	if !s.poll(t) {
+		t.Error("not set")
+	}
+	s.check(t, start.Add(time.Second))
+}
+
+// TestWrongSecond checks that a clock that reads the wrong second halfway
+// between pulses is set at the next one.
+func TestWrongSecond(t *testing.T) {
+	s := newSim(0)
+	s.pulse(true)
+	s.poll(t)
+	s.pulse(false)
+	s.poll(t)
+
+	s.now = s.now.Add(400 * time.Millisecond)
+	s.poll(t)
+	if s.rtc.reads != 0 {
+		t.Error("read the clock before halfway")
+	}
+	s.now = s.now.Add(200 * time.Millisecond)
+	s.poll(t)
+	s.poll(t)
+	if s.rtc.reads != 1 {
+		t.Errorf("read the clock %d times, want 1", s.rtc.reads)
+	}
+
+	// right
+	s.rtc.time = start.Add(2 * time.Second)
+	s.pulse(false)
+	if s.poll(t) {
+		t.Error("set a clock that was right")
+	}
+
+	// a second behind
+	s.rtc.time = start.Add(time.Second)
+	s.now = s.now.Add(600 * time.Millisecond)
+	s.poll(t)
+	s.pulse(false)
+	if !s.poll(t) {
+		t.Error("did not set a clock that was wrong")
+	}
+	s.check(t, start.Add(time.Second), start.Add(3*time.Second))
+	if s.rtc.reads != 2 {
+		t.Errorf("read the clock %d times, want 2", s.rtc.reads)
+	}
+}
+
+func TestInterval(t *testing.T) {
+	s := newSim(10 * time.Second)
+	s.pulse(true)
+	s.poll(t)
+	for i := 1; i <= 21; i++ {
+		s.pulse(false)
+		s.poll(t)
+	}
+	s.check(t, start.Add(time.Second), start.Add(11*time.Second), start.Add(21*time.Second))
+}
+
+func TestSetError(t *testing.T) {
+	s := newSim(0)
+	s.rtc.err = errors.New("bus error")
+	s.pulse(true)
+	s.d.Poll()
+	s.pulse(false)
+	if set, err := s.d.Poll(); set || err != s.rtc.err {
+		t.Errorf("got %v, %v, want %v", set, err, s.rtc.err)
+	}
+
+	// tried again at the next pulse
+	s.rtc.err = nil
+	s.pulse(false)
+	if !s.poll(t) {
+		t.Error("not set")
+	}
+	s.check(t, start.Add(2*time.Second))
+}
@@ -0,0 +1,130 @@
+package gps
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// ErrNoData is returned by the non-blocking reads when the receiver has no
+// more data available for now. It is ubx.ErrNoData, so that a ubx.Client
+// reading from a Reader or a GPSDevice waits for more data.
+var ErrNoData = ubx.ErrNoData
+
+const (
+	// maxSentence is the longest NMEA sentence accepted, longer than the
+	// 82 characters of the standard for the proprietary sentences.
+	maxSentence = 120
+
+	// pollInterval is how long the blocking reads wait for more data.
+	pollInterval = 10 * time.Millisecond
+)
+
+// Frame is an NMEA sentence or a UBX message read by a Reader.
+type Frame struct {
+	// Sentence is the NMEA sentence, from the $ to the checksum, or empty if
+	// the frame is a UBX message.
+	Sentence string
+
+	UBX ubx.Message
+}
+
+// Reader splits the data of a receiver, read from any io.Reader, into NMEA
+// sentences and UBX messages, which may be interleaved. Sentences with a bad
+// checksum and corrupted UBX messages are skipped.
+//
+// The source may be non-blocking: a read that returns no data and no error
+// makes ReadFrame return ErrNoData, so that a program can do other work and
+// try again later. UARTs of the machine package behave that way.
+type Reader struct {
+	r          io.Reader
+	buf        [bufferSize]byte
+	pos, n     int
+	sentence   []byte
+	collecting bool
+	ubx        ubx.Parser
+}
+
+// NewReader returns a reader of the receiver data in r, for example a UART,
+// the I2C stream of NewI2C or a log file.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, sentence: make([]byte, 0, maxSentence)}
+}
+
+// ReadByte returns the next byte of raw data, or ErrNoData if none is
+// available.
+func (r *Reader) ReadByte() (byte, error) {
+	if r.pos == r.n {
+		n, err := r.r.Read(r.buf[:])
+		if n <= 0 {
+			if err == nil {
+				err = ErrNoData
+			}
+			return 0, err
+		}
+		r.pos, r.n = 0, n
+	}
+	c := r.buf[r.pos]
+	r.pos++
+	return c, nil
+}
+
+// Read reads raw data, from what the reader has buffered first. It satisfies
+// the io.Reader interface.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos < r.n {
+		n := copy(p, r.buf[r.pos:r.n])
+		r.pos += n
+		return n, nil
+	}
+	return r.r.Read(p)
+}
+
+// ReadFrame returns the next frame in the data available now. It returns
+// ErrNoData if there is no complete frame, and the error of the source, such
+// as io.EOF, if reading fails. The payload of a UBX message is only valid
+// until the next call.
+func (r *Reader) ReadFrame() (Frame, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return Frame{}, err
+		}
+		if m, ok, _ := r.ubx.Feed(c); ok {
+			r.collecting = false
+			return Frame{UBX: m}, nil
+		}
+		switch {
+		case c == '$':
+			r.sentence = append(r.sentence[:0], c)
+			r.collecting = true
+		case !r.collecting:
+		case len(r.sentence) == maxSentence:
+			r.collecting = false
+		default:
+			r.sentence = append(r.sentence, c)
+			if n := len(r.sentence); n > 3 && r.sentence[n-3] == '*' {
+				r.collecting = false
+				if s := string(r.sentence); validSentence(s) {
+					return Frame{Sentence: s}, nil
+				}
+			}
+		}
+	}
+}
+
+// WaitFrame returns the next frame, waiting for data until ctx is done.
+func (r *Reader) WaitFrame(ctx context.Context) (Frame, error) {
+	for {
+		f, err := r.ReadFrame()
+		if err != ErrNoData {
+			return f, err
+		}
+		if err := ctx.Err(); err != nil {
+			return Frame{}, err
+		}
+		time.Sleep(pollInterval)
+	}
+}
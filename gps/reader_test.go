@@ -0,0 +1,275 @@
+package gps_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps"
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// No log recorded from a receiver is available: the data of these tests is
+// made of the sentences of the decoder tests and of UBX frames built from
+// the layouts of the protocol specification.
+
+// source is a non-blocking reader that returns its chunks one at a time,
+// with no data between them, and then io.EOF.
+type source struct {
+	chunks [][]byte
+	empty  bool
+}
+
+func (s *source) Read(p []byte) (int, error) {
+	if len(s.chunks) == 0 {
+		return 0, io.EOF
+	}
+	if s.empty = !s.empty; s.empty {
+		return 0, nil
+	}
+	n := copy(p, s.chunks[0])
+	if s.chunks[0] = s.chunks[0][n:]; len(s.chunks[0]) == 0 {
+		s.chunks = s.chunks[1:]
+	}
+	return n, nil
+}
+
+// idle is a receiver that sends nothing.
+type idle struct{}
+
+func (idle) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+// split splits data into chunks of n bytes.
+func split(data []byte, n int) [][]byte {
+	var chunks [][]byte
+	for len(data) > n {
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return append(chunks, data)
+}
+
+func ubxFrame(class, id byte, payload ...byte) []byte {
+	return ubx.Message{Class: class, ID: id, Payload: payload}.Bytes()
+}
+
+// navPVT returns a NAV-PVT message of a 3D fix at t.
+func navPVT(t time.Time) []byte {
+	p := make([]byte, 92)
+	le := binary.LittleEndian
+	le.PutUint16(p[4:], uint16(t.Year()))
+	p[6], p[7], p[8], p[9], p[10] = byte(t.Month()), byte(t.Day()), byte(t.Hour()), byte(t.Minute()), byte(t.Second())
+	p[11] = ubx.ValidDate | ubx.ValidTime
+	p[20], p[21], p[23] = byte(ubx.Fix3D), ubx.GNSSFixOK, 9
+	le.PutUint32(p[24:], 85652650)  // longitude
+	le.PutUint32(p[28:], 472852330) // latitude
+	le.PutUint32(p[36:], 499600)    // height above sea level in mm
+	le.PutUint32(p[60:], 1000)      // ground speed in mm/s
+	le.PutUint32(p[64:], 9000000)   // heading of motion in 1e-5 degrees
+	le.PutUint16(p[76:], 194)
+	return ubxFrame(ubx.ClassNAV, ubx.IDNavPVT, p...)
+}
+
+func lines(sentences ...string) []byte {
+	var b []byte
+	for _, s := range sentences {
+		b = append(b, checksum(s)+"\r\n"...)
+	}
+	return b
+}
+
+// readFrames returns the frames read from r until an error other than
+// gps.ErrNoData.
+func readFrames(r *gps.Reader) ([]string, error) {
+	var frames []string
+	for {
+		f, err := r.ReadFrame()
+		if err == gps.ErrNoData {
+			continue
+		}
+		if err != nil {
+			return frames, err
+		}
+		if f.Sentence != "" {
+			frames = append(frames, f.Sentence)
+		} else {
+			frames = append(frames, string(f.UBX.Bytes()))
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	rmc := checksum("$GNRMC,120000.00,A,4717.11399,N,00833.91590,E,1.944,90.0,150624,,,A,V")
+	gga := checksum("$GNGGA,120000.00,4717.11399,N,00833.91590,E,1,05,1.01,499.6,M,48.0,M,,")
+	ack := ubxFrame(ubx.ClassACK, ubx.IDAckAck, ubx.ClassCFG, 0x01)
+	// a payload that starts like a sentence
+	status := ubxFrame(ubx.ClassNAV, ubx.IDNavStatus, []byte("$GPGGA,1*00\x03\xdd\x00\x00\x00")...)
+	bad := rmc[:len(rmc)-1] + "0"
+	if bad == rmc {
+		bad = rmc[:len(rmc)-1] + "1"
+	}
+	corrupted := append([]byte(nil), ack...)
+	corrupted[6]++
+
+	data := bytes.Join([][]byte{
+		[]byte("\x00\xffnoise"), []byte(rmc + "\r\n"),
+		ack,
+		[]byte(gga), // without a line end
+		status,
+		[]byte(bad + "\r\n"),
+		corrupted,
+		[]byte("$GNGGA,1200"), // cut by a UBX frame
+		ack,
+	}, nil)
+	want := []string{rmc, string(ack), gga, string(status), string(ack)}
+
+	for _, n := range []int{1, 7, len(data)} {
+		r := gps.NewReader(&source{chunks: split(append([]byte(nil), data...), n)})
+		frames, err := readFrames(r)
+		if err != io.EOF {
+			t.Errorf("chunks of %d: got %v, want %v", n, err, io.EOF)
+		}
+		if len(frames) != len(want) {
+			t.Fatalf("chunks of %d: got %q, want %q", n, frames, want)
+		}
+		for i := range want {
+			if frames[i] != want[i] {
+				t.Errorf("chunks of %d: frame %d is %q, want %q", n, i, frames[i], want[i])
+			}
+		}
+	}
+}
+
+func TestReadFrameLowerCaseChecksum(t *testing.T) {
+	s := checksum("$GNGLL,4717.11399,N,00833.91590,E,120000.00,A,A")
+	s = s[:len(s)-2] + strings.ToLower(s[len(s)-2:])
+	frames, err := readFrames(gps.NewReader(strings.NewReader(s + "\r\n")))
+	if err != io.EOF || len(frames) != 1 || frames[0] != s {
+		t.Errorf("got %q, %v", frames, err)
+	}
+}
+
+// TestMaxSentence checks that sentences of up to 120 characters are read,
+// and longer ones skipped.
+func TestMaxSentence(t *testing.T) {
+	sentence := func(n int) string {
+		// with 3 characters of checksum
+		s := "$PUBX,00," + strings.Repeat("0", n-3-9)
+		return checksum(s)
+	}
+	long, max := sentence(121), sentence(120)
+	if len(long) != 121 || len(max) != 120 {
+		t.Fatalf("lengths %d and %d", len(long), len(max))
+	}
+	frames, err := readFrames(gps.NewReader(strings.NewReader(long + "\r\n" + max + "\r\n" + long + max)))
+	if err != io.EOF || len(frames) != 2 || frames[0] != max || frames[1] != max {
+		t.Errorf("got %q, %v", frames, err)
+	}
+}
+
+// mixedLog is the data of a receiver that outputs NAV-PVT, and then NMEA
+// sentences with other UBX messages between them.
+var mixedLog = bytes.Join([][]byte{
+	navPVT(time.Date(2024, 6, 15, 11, 59, 59, 0, time.UTC)),
+	lines(
+		"$GNRMC,120000.00,A,4717.11399,N,00833.91590,E,1.944,90.0,150624,,,A,V",
+		"$GNGGA,120000.00,4717.11399,N,00833.91590,E,1,05,1.01,499.6,M,48.0,M,,",
+	),
+	ubxFrame(ubx.ClassACK, ubx.IDAckAck, ubx.ClassCFG, 0x01),
+	lines("$GNGSA,A,3,07,08,09,,,,,,,,,,1.94,1.01,1.66,1"),
+	ubxFrame(ubx.ClassNAV, ubx.IDNavStatus, make([]byte, 16)...),
+	lines(
+		"$GNRMC,120001.00,A,4717.11400,N,00833.91600,E,0.000,,150624,,,A,V",
+		"$GNGGA,120001.00,4717.11400,N,00833.91600,E,1,05,1.02,499.7,M,48.0,M,,",
+	),
+}, nil)
+
+var mixedTimes = []time.Time{
+	time.Date(2024, 6, 15, 11, 59, 59, 0, time.UTC),
+	time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC),
+	time.Date(2024, 6, 15, 12, 0, 1, 0, time.UTC),
+}
+
+func TestStreamPoll(t *testing.T) {
+	s := gps.NewStream(&source{chunks: split(append([]byte(nil), mixedLog...), 16)})
+	ubxCount := 0
+	s.UBX = func(ubx.Message) { ubxCount++ }
+	var fixes []gps.Fix
+	polls := 0
+	for {
+		fix, ok, err := s.Poll()
+		polls++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			fixes = append(fixes, fix)
+		}
+	}
+	if len(fixes) != len(mixedTimes) || ubxCount != 3 {
+		t.Fatalf("got %d fixes and %d UBX messages, want %d and 3", len(fixes), ubxCount, len(mixedTimes))
+	}
+	if polls < len(mixedLog)/16 {
+		t.Errorf("Poll returned without data only %d times", polls)
+	}
+	for i, f := range fixes {
+		if !f.Time.Equal(mixedTimes[i]) || !f.Valid {
+			t.Errorf("fix %d: time %v, valid %v", i, f.Time, f.Valid)
+		}
+	}
+	// the fix of NAV-PVT
+	f := fixes[0]
+	if f.FixType != gps.Fix3D || f.Quality != gps.QualityGPS || f.Satellites != 9 || f.Altitude != 499 ||
+		f.Latitude != float32(472852330)/1e7 || f.Longitude != float32(85652650)/1e7 ||
+		f.Speed != 1 || f.Course != 90 || f.PDOP != 1.94 {
+		t.Errorf("NAV-PVT fix: %+v", f)
+	}
+	// and the last, flushed at the end of the data
+	if f := fixes[2]; f.HDOP != 1.02 || f.Altitude != 499 {
+		t.Errorf("last fix: %+v", f)
+	}
+	if _, ok, err := s.Poll(); ok || err != io.EOF {
+		t.Errorf("after the end: got %v, %v", ok, err)
+	}
+}
+
+func TestStreamFixes(t *testing.T) {
+	s := gps.NewStream(&source{chunks: split(append([]byte(nil), mixedLog...), 64)})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var times []time.Time
+	for fix := range s.Fixes(ctx) {
+		times = append(times, fix.Time)
+	}
+	if s.Err() != io.EOF {
+		t.Errorf("got %v, want %v", s.Err(), io.EOF)
+	}
+	if len(times) != len(mixedTimes) {
+		t.Fatalf("got fixes at %v, want %v", times, mixedTimes)
+	}
+	for i := range times {
+		if !times[i].Equal(mixedTimes[i]) {
+			t.Errorf("fix %d at %v, want %v", i, times[i], mixedTimes[i])
+		}
+	}
+
+	// a receiver that sends nothing, until ctx is done
+	s = gps.NewStream(idle{})
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	for range s.Fixes(ctx) {
+		t.Error("got a fix")
+	}
+	if s.Err() != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", s.Err(), context.DeadlineExceeded)
+	}
+}
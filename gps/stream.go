@@ -0,0 +1,155 @@
+package gps
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// Stream decodes the fixes of a receiver without blocking the program: Poll
+// decodes what has arrived so far, Next waits with a context, and Run and
+// Fixes deliver fixes to a callback or a channel.
+//
+// Fixes are merged from NMEA sentences by a Decoder. UBX NAV-PVT messages are
+// fixes of their own, so a receiver should be configured to output either.
+// Sentences that cannot be decoded are skipped.
+type Stream struct {
+	// UBX, if set, is called with every UBX message of the stream. The
+	// payload is only valid during the call.
+	UBX func(ubx.Message)
+
+	reader  *Reader
+	decoder Decoder
+	err     error
+}
+
+// NewStream returns a stream of the fixes in the receiver data read from r.
+func NewStream(r io.Reader) *Stream {
+	return newStream(NewReader(r))
+}
+
+func newStream(r *Reader) *Stream {
+	return &Stream{reader: r}
+}
+
+// Reader returns the reader of the stream, to send UBX messages with a
+// ubx.Client while the stream is not in use, for example.
+func (s *Stream) Reader() *Reader {
+	return s.reader
+}
+
+// Poll decodes the data available now. It returns a fix and true when it
+// completes one, and false when it needs more data. At the end of the data
+// it returns the last fix, then io.EOF.
+func (s *Stream) Poll() (Fix, bool, error) {
+	for {
+		f, err := s.reader.ReadFrame()
+		if err == ErrNoData {
+			return Fix{}, false, nil
+		}
+		if err == io.EOF {
+			if fix, ok := s.decoder.Flush(); ok {
+				return fix, true, nil
+			}
+		}
+		if err != nil {
+			return Fix{}, false, err
+		}
+		if f.Sentence == "" {
+			if s.UBX != nil {
+				s.UBX(f.UBX)
+			}
+			if pvt, err := ubx.ParseNavPVT(f.UBX); err == nil {
+				return pvtFix(pvt), true, nil
+			}
+			continue
+		}
+		if fix, ok, err := s.decoder.Decode(f.Sentence); err == nil && ok {
+			return fix, true, nil
+		}
+	}
+}
+
+// Next returns the next fix, waiting for data until ctx is done.
+func (s *Stream) Next(ctx context.Context) (Fix, error) {
+	for {
+		fix, ok, err := s.Poll()
+		if err != nil || ok {
+			return fix, err
+		}
+		if err := ctx.Err(); err != nil {
+			return Fix{}, err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Run calls fn with every fix until ctx is done or reading fails, and returns
+// the reason it stopped. It is meant to run in a goroutine of its own.
+func (s *Stream) Run(ctx context.Context, fn func(Fix)) error {
+	for {
+		fix, err := s.Next(ctx)
+		if err != nil {
+			return err
+		}
+		fn(fix)
+	}
+}
+
+// Fixes runs the stream in a new goroutine and returns the channel it sends
+// the fixes to. The channel is closed when ctx is done or reading fails; Err
+// then returns the reason.
+func (s *Stream) Fixes(ctx context.Context) <-chan Fix {
+	ch := make(chan Fix, 1)
+	go func() {
+		s.err = s.Run(ctx, func(fix Fix) {
+			select {
+			case ch <- fix:
+			case <-ctx.Done():
+			}
+		})
+		close(ch)
+	}()
+	return ch
+}
+
+// Err returns the reason the channel of Fixes was closed.
+func (s *Stream) Err() error {
+	return s.err
+}
+
+// pvtFix converts a NAV-PVT solution to a Fix.
+func pvtFix(p ubx.NavPVT) Fix {
+	fix := Fix{
+		Valid:      p.Flags&ubx.GNSSFixOK != 0,
+		Time:       p.Time,
+		Latitude:   float32(p.Latitude) / 1e7,
+		Longitude:  float32(p.Longitude) / 1e7,
+		Altitude:   p.HeightMSL / 1000,
+		Satellites: int16(p.NumSV),
+		Speed:      float32(p.GroundSpeed) / 1000,
+		Course:     float32(p.HeadMotion) / 1e5,
+		PDOP:       float32(p.PDOP) / 100,
+	}
+	switch p.FixType {
+	case ubx.NoFix, ubx.TimeOnly:
+		fix.FixType = FixNone
+	case ubx.Fix2D, ubx.DeadReckoning:
+		fix.FixType = Fix2D
+	default:
+		fix.FixType = Fix3D
+	}
+	switch {
+	case !fix.Valid:
+		fix.Quality = QualityInvalid
+	case p.Flags&ubx.DiffSolution != 0:
+		fix.Quality = QualityDGPS
+	case p.FixType == ubx.DeadReckoning:
+		fix.Quality = QualityEstimated
+	default:
+		fix.Quality = QualityGPS
+	}
+	return fix
+}
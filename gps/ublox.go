@@ -1,53 +1,36 @@
 package gps
 
 import (
-	"errors"
-	"time"
+	"tinygo.org/x/drivers/gps/ubx"
 )
 
-// flight mode disables the GPS COCOM limits
-var flight_mode_cmd = [...]byte{
-	0xB5, 0x62, 0x06, 0x24, 0x24, 0x00, 0xFF, 0xFF, 0x06, 0x03, 0x00, 0x00, 0x00,
-	0x00, 0x10, 0x27, 0x00, 0x00, 0x05, 0x00, 0xFA, 0x00, 0xFA, 0x00, 0x64, 0x00,
-	0x2C, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-	0x00, 0x00, 0x00, 0x16, 0xDC}
-
-// Sets CFG-GNSS to disable everything other than GPS GNSS
-// solution. Failure to do this means GPS power saving
-// doesn't work. Not needed for MAX7, needed for MAX8's
-var cfg_gnss_cmd = [...]byte{
-	0xB5, 0x62, 0x06, 0x3E, 0x2C, 0x00, 0x00, 0x00,
-	0x20, 0x05, 0x00, 0x08, 0x10, 0x00, 0x01, 0x00,
-	0x01, 0x01, 0x01, 0x01, 0x03, 0x00, 0x00, 0x00,
-	0x01, 0x01, 0x03, 0x08, 0x10, 0x00, 0x00, 0x00,
-	0x01, 0x01, 0x05, 0x00, 0x03, 0x00, 0x00, 0x00,
-	0x01, 0x01, 0x06, 0x08, 0x0E, 0x00, 0x00, 0x00,
-	0x01, 0x01, 0xFC, 0x11}
-
+// FlightMode selects the airborne dynamic model of u-blox receivers, which
+// lifts the altitude limit of 12000m.
 func FlightMode(gpsDevice GPSDevice) (err error) {
-	err = sendCommand(gpsDevice, flight_mode_cmd[:])
-	return err
+	return sendCommand(gpsDevice, ubx.CfgDynamicModel(ubx.Airborne1G))
 }
 
+// SetCfgGNSS configures u-blox receivers to use GPS and SBAS only. Failure to
+// do this means GPS power saving doesn't work. Not needed for MAX7, needed for
+// MAX8's.
 func SetCfgGNSS(gpsDevice GPSDevice) (err error) {
-	err = sendCommand(gpsDevice, cfg_gnss_cmd[:])
-	return err
+	return sendCommand(gpsDevice, ubx.CfgGNSS([]ubx.GNSS{
+		{ID: ubx.GPS, Enable: true, MinChannels: 8, MaxChannels: 16},
+		{ID: ubx.SBAS, Enable: true, MinChannels: 1, MaxChannels: 3},
+		{ID: ubx.BeiDou, MinChannels: 8, MaxChannels: 16},
+		{ID: ubx.QZSS, MinChannels: 0, MaxChannels: 3},
+		{ID: ubx.GLONASS, MinChannels: 8, MaxChannels: 14},
+	}))
+}
+
+// UBX returns a client for the UBX protocol of u-blox receivers over the
+// connection of the device.
+func (gps *GPSDevice) UBX() *ubx.Client {
+	return ubx.NewClient(gps, gps)
 }
 
-func sendCommand(gpsDevice GPSDevice, command []byte) (err error) {
-	gpsDevice.WriteBytes(command)
-	start := time.Now()
-	for time.Now().Sub(start) < 1000 {
-		if gpsDevice.readNextByte() == '\n' {
-			if gpsDevice.readNextByte() == 0xB5 {
-				gpsDevice.readNextByte()
-				if gpsDevice.readNextByte() == 0x05 {
-					if gpsDevice.readNextByte() == 0x01 {
-						return
-					}
-				}
-			}
-		}
-	}
-	return errors.New("no ACK to GPS command")
+// sendCommand sends a UBX configuration message and waits for the receiver to
+// acknowledge it.
+func sendCommand(gpsDevice GPSDevice, m ubx.Message) error {
+	return gpsDevice.UBX().Send(m)
 }
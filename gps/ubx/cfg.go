@@ -0,0 +1,132 @@
+package ubx
+
+import "encoding/binary"
+
+// CfgRate returns the CFG-RATE message that sets the navigation rate: a
+// measurement every measurementMs milliseconds, and a navigation solution
+// every cycles measurements, aligned to GPS time.
+func CfgRate(measurementMs, cycles uint16) Message {
+	p := make([]byte, 6)
+	binary.LittleEndian.PutUint16(p[0:], measurementMs)
+	binary.LittleEndian.PutUint16(p[2:], cycles)
+	binary.LittleEndian.PutUint16(p[4:], 1) // GPS time
+	return Message{Class: ClassCFG, ID: IDCfgRate, Payload: p}
+}
+
+// CfgMsg returns the CFG-MSG message that sets the output rate of the
+// message of class and id on the port the message is received on: once every
+// rate navigation solutions, or never if rate is 0. It applies to NMEA
+// sentences as well, for example class 0xF0 ID 0x03 for GSV.
+func CfgMsg(class, id, rate uint8) Message {
+	return Message{Class: ClassCFG, ID: IDCfgMsg, Payload: []byte{class, id, rate}}
+}
+
+// CfgPowerSave returns the CFG-RXM message that selects the power save mode,
+// or continuous mode if enable is false. Receivers of the 8 series only save
+// power with GPS as the single satellite system besides SBAS and QZSS, see
+// CfgGNSS.
+func CfgPowerSave(enable bool) Message {
+	p := []byte{8, 0}
+	if enable {
+		p[1] = 1
+	}
+	return Message{Class: ClassCFG, ID: IDCfgRxm, Payload: p}
+}
+
+// DynamicModel is a dynamic platform model of the receiver, which bounds the
+// motion it expects.
+type DynamicModel uint8
+
+const (
+	Portable   DynamicModel = 0
+	Stationary DynamicModel = 2
+	Pedestrian DynamicModel = 3
+	Automotive DynamicModel = 4
+	Sea        DynamicModel = 5
+	Airborne1G DynamicModel = 6 // airborne with less than 1g acceleration
+	Airborne2G DynamicModel = 7
+	Airborne4G DynamicModel = 8
+	Wrist      DynamicModel = 9
+)
+
+// CfgDynamicModel returns the CFG-NAV5 message that selects the dynamic
+// model, leaving the other navigation settings unchanged. The airborne models
+// lift the altitude limit of 12000m that applies to the others, and are
+// needed for example in high-altitude balloons.
+func CfgDynamicModel(model DynamicModel) Message {
+	p := make([]byte, 36)
+	binary.LittleEndian.PutUint16(p[0:], 0x0001) // apply the dynamic model only
+	p[2] = byte(model)
+	return Message{Class: ClassCFG, ID: IDCfgNav5, Payload: p}
+}
+
+// GNSS is the configuration of a satellite system for CfgGNSS.
+type GNSS struct {
+	ID     GNSSID
+	Enable bool
+
+	// MinChannels is the number of tracking channels reserved for the
+	// system, MaxChannels the maximum number it may use.
+	MinChannels uint8
+	MaxChannels uint8
+
+	// Signals selects the signals to track, the receiver specific sigCfgMask
+	// field. If zero, the primary signal: L1C/A, E1 or B1I.
+	Signals uint8
+}
+
+// CfgGNSS returns the CFG-GNSS message that configures the satellite
+// systems. Systems that are not listed keep their configuration.
+func CfgGNSS(systems []GNSS) Message {
+	p := make([]byte, 4+8*len(systems))
+	p[2] = 0xFF // use all the tracking channels
+	p[3] = byte(len(systems))
+	for i, s := range systems {
+		b := p[4+8*i:]
+		b[0] = byte(s.ID)
+		b[1] = s.MinChannels
+		b[2] = s.MaxChannels
+		signals := s.Signals
+		if signals == 0 {
+			signals = 1
+		}
+		flags := uint32(signals) << 16
+		if s.Enable {
+			flags |= 1
+		}
+		binary.LittleEndian.PutUint32(b[4:], flags)
+	}
+	return Message{Class: ClassCFG, ID: IDCfgGNSS, Payload: p}
+}
+
+// Protocol masks of CfgBaudRate.
+const (
+	ProtoUBX   = 0x01
+	ProtoNMEA  = 0x02
+	ProtoRTCM3 = 0x20
+)
+
+// CfgBaudRate returns the CFG-PRT message that configures UART port (1 or 2)
+// for 8N1 at baud, with the input and output protocol masks in and out.
+//
+// The receiver switches to the new rate before it acknowledges the message,
+// so the acknowledgement is usually lost: send it with Client.Write and
+// reconfigure the UART.
+func CfgBaudRate(port uint8, baud uint32, in, out uint16) Message {
+	p := make([]byte, 20)
+	p[0] = port
+	binary.LittleEndian.PutUint32(p[4:], 0x08C0) // 8 bits, no parity, 1 stop bit
+	binary.LittleEndian.PutUint32(p[8:], baud)
+	binary.LittleEndian.PutUint16(p[12:], in)
+	binary.LittleEndian.PutUint16(p[14:], out)
+	return Message{Class: ClassCFG, ID: IDCfgPrt, Payload: p}
+}
+
+// CfgSave returns the CFG-CFG message that saves the current configuration
+// to the non-volatile memory of the receiver, so that it survives a power
+// cycle.
+func CfgSave() Message {
+	p := make([]byte, 12)
+	binary.LittleEndian.PutUint32(p[4:], 0x1F1F)
+	return Message{Class: ClassCFG, ID: IDCfgCfg, Payload: p}
+}
@@ -0,0 +1,137 @@
+package ubx
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNak     = errors.New("ubx: message rejected")
+	ErrTimeout = errors.New("ubx: no response")
+
+	// ErrNoData is the error of a non-blocking reader that has no data
+	// available yet, such as gps.Reader.
+	ErrNoData = errors.New("ubx: no data available")
+)
+
+// Client exchanges UBX messages with a receiver.
+type Client struct {
+	// Timeout is how long to wait for a response, 1s if zero.
+	Timeout time.Duration
+
+	// Handler, if set, is called with the messages received while waiting
+	// for a response that are not the response.
+	Handler func(Message)
+
+	w      io.Writer
+	r      io.ByteReader
+	parser Parser
+	buf    []byte
+}
+
+// NewClient returns a client that sends messages to w and receives them from
+// r. The receiver may send NMEA sentences in between, which are skipped.
+//
+// The reader may be non-blocking: when it returns ErrNoData, the read is
+// retried until the timeout. Other errors, such as io.EOF, are returned.
+func NewClient(w io.Writer, r io.ByteReader) *Client {
+	return &Client{w: w, r: r}
+}
+
+// Write sends m without waiting for a response.
+func (c *Client) Write(m Message) error {
+	c.buf = m.Append(c.buf[:0])
+	_, err := c.w.Write(c.buf)
+	return err
+}
+
+// Send sends m and, for configuration messages, waits for the receiver to
+// acknowledge it. It returns ErrNak if the receiver rejects the message.
+func (c *Client) Send(m Message) error {
+	if err := c.Write(m); err != nil {
+		return err
+	}
+	if m.Class != ClassCFG {
+		return nil
+	}
+	_, err := c.wait(m.Class, m.ID, false)
+	return err
+}
+
+// Request sends m, usually a poll from Poll, and returns the response: the
+// next message of the same class and ID. Its payload is valid until the next
+// call of the client.
+func (c *Client) Request(m Message) (Message, error) {
+	if err := c.Write(m); err != nil {
+		return Message{}, err
+	}
+	return c.wait(m.Class, m.ID, true)
+}
+
+// Read returns the next message from the receiver. Its payload is valid until
+// the next call of the client.
+func (c *Client) Read() (Message, error) {
+	deadline := time.Now().Add(c.timeout())
+	for {
+		m, ok, err := c.next(deadline)
+		if err != nil || ok {
+			return m, err
+		}
+	}
+}
+
+// wait waits for the acknowledgement of the message of class and id, or the
+// message itself if response is true.
+func (c *Client) wait(class, id byte, response bool) (Message, error) {
+	deadline := time.Now().Add(c.timeout())
+	for {
+		m, ok, err := c.next(deadline)
+		if err != nil {
+			return m, err
+		}
+		if !ok {
+			continue
+		}
+		if response && m.Is(class, id) {
+			return m, nil
+		}
+		if ack, err := ParseAck(m); err == nil && ack.Class == class && ack.ID == id {
+			if !ack.Ack {
+				return Message{}, ErrNak
+			}
+			if !response {
+				return m, nil
+			}
+			continue // keep waiting for the polled message
+		}
+		if c.Handler != nil {
+			c.Handler(m)
+		}
+	}
+}
+
+// next reads a byte and returns the message it completes, if any. Corrupted
+// frames are skipped.
+func (c *Client) next(deadline time.Time) (Message, bool, error) {
+	if time.Now().After(deadline) {
+		return Message{}, false, ErrTimeout
+	}
+	b, err := c.r.ReadByte()
+	if err == ErrNoData {
+		time.Sleep(time.Millisecond)
+		return Message{}, false, nil
+	}
+	if err != nil {
+		return Message{}, false, err
+	}
+	m, ok, _ := c.parser.Feed(b)
+	return m, ok, nil
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return time.Second
+	}
+	return c.Timeout
+}
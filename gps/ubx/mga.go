@@ -0,0 +1,160 @@
+package ubx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// MGA message IDs.
+const (
+	IDMgaANO = 0x20
+	IDMgaINI = 0x40
+	IDMgaAck = 0x60
+)
+
+// IDCfgNavX5 is the ID of CFG-NAVX5, the expert navigation settings.
+const IDCfgNavX5 = 0x23
+
+// MgaIniTime returns the MGA-INI-TIME_UTC message that tells the receiver
+// the approximate time, to the given accuracy, which shortens the time to
+// first fix. It is the first message to send with AssistNow data.
+func MgaIniTime(t time.Time, accuracy time.Duration) Message {
+	t = t.UTC()
+	p := make([]byte, 24)
+	p[0] = 0x10
+	p[3] = 0x80 // number of leap seconds unknown
+	binary.LittleEndian.PutUint16(p[4:], uint16(t.Year()))
+	p[6] = byte(t.Month())
+	p[7] = byte(t.Day())
+	p[8] = byte(t.Hour())
+	p[9] = byte(t.Minute())
+	p[10] = byte(t.Second())
+	binary.LittleEndian.PutUint32(p[12:], uint32(t.Nanosecond()))
+	seconds := accuracy / time.Second
+	if seconds > 0xFFFF {
+		seconds = 0xFFFF
+	}
+	binary.LittleEndian.PutUint16(p[16:], uint16(seconds))
+	binary.LittleEndian.PutUint32(p[20:], uint32(accuracy%time.Second))
+	return Message{Class: ClassMGA, ID: IDMgaINI, Payload: p}
+}
+
+// MgaIniPos returns the MGA-INI-POS_LLH message that tells the receiver its
+// approximate position: latitude and longitude in 1e-7 degrees, altitude
+// above the ellipsoid and accuracy in cm.
+func MgaIniPos(latitude, longitude, altitude int32, accuracy uint32) Message {
+	p := make([]byte, 20)
+	p[0] = 0x01
+	binary.LittleEndian.PutUint32(p[4:], uint32(latitude))
+	binary.LittleEndian.PutUint32(p[8:], uint32(longitude))
+	binary.LittleEndian.PutUint32(p[12:], uint32(altitude))
+	binary.LittleEndian.PutUint32(p[16:], accuracy)
+	return Message{Class: ClassMGA, ID: IDMgaINI, Payload: p}
+}
+
+// CfgAidingAck returns the CFG-NAVX5 message that makes the receiver
+// acknowledge every assistance message with MGA-ACK, for Assist.
+func CfgAidingAck(enable bool) Message {
+	p := make([]byte, 40)
+	binary.LittleEndian.PutUint16(p[0:], 2)      // message version
+	binary.LittleEndian.PutUint16(p[2:], 0x0400) // apply ackAiding only
+	if enable {
+		p[17] = 1
+	}
+	return Message{Class: ClassCFG, ID: IDCfgNavX5, Payload: p}
+}
+
+// AssistOptions are the options of Client.Assist.
+type AssistOptions struct {
+	// Date, if not zero, selects the AssistNow Offline (MGA-ANO) messages of
+	// that day, as the receiver only needs the current day out of the weeks
+	// of data in the file. Other messages are all sent.
+	Date time.Time
+
+	// Ack waits for the receiver to acknowledge every message, after
+	// CfgAidingAck. Otherwise messages are sent every Interval, 5ms if
+	// zero, so as not to overflow the input buffer of the receiver.
+	Ack      bool
+	Interval time.Duration
+}
+
+// Assist sends the assistance messages in r to the receiver: AssistNow
+// Online or Offline data as downloaded from the u-blox services, which is a
+// sequence of UBX MGA messages. It returns the number of messages the
+// receiver accepted, or sent if it does not acknowledge them.
+//
+// For AssistNow Online, send the time and position with MgaIniTime and
+// MgaIniPos first, if the receiver does not know them.
+func (c *Client) Assist(r io.Reader, opts AssistOptions) (int, error) {
+	var p Parser
+	var buf [64]byte
+	interval := opts.Interval
+	if interval == 0 {
+		interval = 5 * time.Millisecond
+	}
+	sent := 0
+	for {
+		n, err := r.Read(buf[:])
+		for _, b := range buf[:n] {
+			m, ok, _ := p.Feed(b)
+			if !ok || m.Class != ClassMGA || !wanted(m, opts.Date) {
+				continue
+			}
+			if err := c.Write(m); err != nil {
+				return sent, err
+			}
+			if !opts.Ack {
+				sent++
+				time.Sleep(interval)
+				continue
+			}
+			accepted, err := c.waitAiding(m)
+			if err != nil {
+				return sent, err
+			}
+			if accepted {
+				sent++
+			}
+		}
+		if err == io.EOF {
+			return sent, nil
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+}
+
+// wanted returns whether an assistance message is for date.
+func wanted(m Message, date time.Time) bool {
+	if date.IsZero() || m.ID != IDMgaANO || len(m.Payload) < 7 {
+		return true
+	}
+	y, mo, d := date.UTC().Date()
+	return int(m.Payload[4])+2000 == y && time.Month(m.Payload[5]) == mo && int(m.Payload[6]) == d
+}
+
+// waitAiding waits for the MGA-ACK of m, and returns whether the receiver
+// accepted it.
+func (c *Client) waitAiding(m Message) (bool, error) {
+	deadline := time.Now().Add(c.timeout())
+	for {
+		a, ok, err := c.next(deadline)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		p := a.Payload
+		if a.Is(ClassMGA, IDMgaAck) && len(p) == 8 && p[3] == m.ID &&
+			len(m.Payload) >= 4 && bytes.Equal(p[4:8], m.Payload[:4]) {
+			return p[0] == 1, nil
+		}
+		if c.Handler != nil {
+			c.Handler(a)
+		}
+	}
+}
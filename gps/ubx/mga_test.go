@@ -0,0 +1,142 @@
+package ubx_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+func TestMgaIniTime(t *testing.T) {
+	// converted to UTC
+	at := time.Date(2024, 3, 9, 14, 14, 15, 500000000, time.FixedZone("CET", 3600))
+	m := ubx.MgaIniTime(at, 2500*time.Millisecond)
+	if !m.Is(ubx.ClassMGA, ubx.IDMgaINI) {
+		t.Fatalf("got class %#x, ID %#x", m.Class, m.ID)
+	}
+	want := []byte{
+		0x10, 0, 0, 0x80, // TIME_UTC, leap seconds unknown
+		0xE8, 0x07, 3, 9, 13, 14, 15, 0,
+		0x00, 0x65, 0xCD, 0x1D, // 500000000 ns
+		2, 0, 0, 0, // 2 s
+		0x00, 0x65, 0xCD, 0x1D, // and 500000000 ns of accuracy
+	}
+	if !bytes.Equal(m.Payload, want) {
+		t.Errorf("got  % x\nwant % x", m.Payload, want)
+	}
+
+	m = ubx.MgaIniTime(at, 100000*time.Second)
+	if m.Payload[16] != 0xFF || m.Payload[17] != 0xFF {
+		t.Errorf("accuracy of %d s", int(m.Payload[16])|int(m.Payload[17])<<8)
+	}
+}
+
+func TestMgaIniPos(t *testing.T) {
+	m := ubx.MgaIniPos(374000000, -1225000000, 1500, 10000)
+	want := []byte{
+		0x01, 0, 0, 0, // POS_LLH
+		0x80, 0xC9, 0x4A, 0x16,
+		0xC0, 0xFB, 0xFB, 0xB6,
+		0xDC, 0x05, 0, 0,
+		0x10, 0x27, 0, 0,
+	}
+	if !m.Is(ubx.ClassMGA, ubx.IDMgaINI) || !bytes.Equal(m.Payload, want) {
+		t.Errorf("got %#x %#x % x\nwant % x", m.Class, m.ID, m.Payload, want)
+	}
+}
+
+func TestCfgAidingAck(t *testing.T) {
+	for _, enable := range []bool{true, false} {
+		m := ubx.CfgAidingAck(enable)
+		want := make([]byte, 40)
+		want[0], want[3] = 2, 0x04 // version 2, ackAiding mask
+		if enable {
+			want[17] = 1
+		}
+		if !m.Is(ubx.ClassCFG, ubx.IDCfgNavX5) || !bytes.Equal(m.Payload, want) {
+			t.Errorf("%v: got %#x %#x % x", enable, m.Class, m.ID, m.Payload)
+		}
+	}
+}
+
+// ano returns an MGA-ANO message of a satellite for a day.
+func ano(sv byte, year, month, day int) []byte {
+	p := make([]byte, 76)
+	p[0], p[2] = 0x00, sv
+	p[4], p[5], p[6] = byte(year-2000), byte(month), byte(day)
+	return frame(ubx.ClassMGA, ubx.IDMgaANO, p...)
+}
+
+// mgaAck returns the MGA-ACK of a message, accepted or not.
+func mgaAck(m []byte, accepted bool) []byte {
+	p := []byte{0, 0, 0, m[3], m[6], m[7], m[8], m[9]}
+	if accepted {
+		p[0] = 1
+	}
+	return frame(ubx.ClassMGA, ubx.IDMgaAck, p...)
+}
+
+func TestAssist(t *testing.T) {
+	ini := ubx.MgaIniTime(time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC), time.Second).Bytes()
+	data := concat(
+		ini,
+		ano(1, 2024, 3, 8),
+		ano(1, 2024, 3, 9),
+		frame(ubx.ClassNAV, ubx.IDNavStatus, make([]byte, 16)...), // not assistance
+		ano(2, 2024, 3, 9),
+		ano(1, 2024, 3, 10),
+		ano(1, 2025, 3, 9),
+	)
+
+	for _, tc := range []struct {
+		name string
+		date time.Time
+		want [][]byte
+	}{
+		{"all", time.Time{}, [][]byte{ini, ano(1, 2024, 3, 8), ano(1, 2024, 3, 9), ano(2, 2024, 3, 9), ano(1, 2024, 3, 10), ano(1, 2025, 3, 9)}},
+		// the day in UTC
+		{"day", time.Date(2024, 3, 8, 20, 0, 0, 0, time.FixedZone("", -5*3600)), [][]byte{ini, ano(1, 2024, 3, 9), ano(2, 2024, 3, 9)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &receiver{err: io.EOF}
+			n, err := ubx.NewClient(r, r).Assist(bytes.NewReader(data), ubx.AssistOptions{Date: tc.date, Interval: time.Nanosecond})
+			if n != len(tc.want) || err != nil {
+				t.Errorf("got %d, %v, want %d", n, err, len(tc.want))
+			}
+			if want := concat(tc.want...); !bytes.Equal(r.written.Bytes(), want) {
+				t.Errorf("wrote %d bytes, want %d", r.written.Len(), len(want))
+			}
+		})
+	}
+}
+
+func TestAssistAck(t *testing.T) {
+	first, second := ano(1, 2024, 3, 9), ano(2, 2024, 3, 9)
+	r := &receiver{
+		data: concat(
+			mgaAck(first, true),
+			frame(ubx.ClassNAV, ubx.IDNavStatus, make([]byte, 16)...),
+			mgaAck(first, true), // not for the second message
+			mgaAck(second, false),
+		),
+		err: ubx.ErrNoData,
+	}
+	c := ubx.NewClient(r, r)
+	c.Timeout = 20 * time.Millisecond
+	handled := 0
+	c.Handler = func(ubx.Message) { handled++ }
+	n, err := c.Assist(bytes.NewReader(concat(first, second)), ubx.AssistOptions{Ack: true})
+	if n != 1 || err != nil || handled != 2 {
+		t.Errorf("got %d accepted, %v, %d handled, want 1 and 2", n, err, handled)
+	}
+
+	// no acknowledgement
+	r = &receiver{err: ubx.ErrNoData}
+	c = ubx.NewClient(r, r)
+	c.Timeout = 20 * time.Millisecond
+	if n, err := c.Assist(bytes.NewReader(first), ubx.AssistOptions{Ack: true}); n != 0 || err != ubx.ErrTimeout {
+		t.Errorf("got %d, %v, want %v", n, err, ubx.ErrTimeout)
+	}
+}
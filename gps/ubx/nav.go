@@ -0,0 +1,233 @@
+package ubx
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// GNSSID identifies a satellite system.
+type GNSSID uint8
+
+const (
+	GPS     GNSSID = 0
+	SBAS    GNSSID = 1
+	Galileo GNSSID = 2
+	BeiDou  GNSSID = 3
+	IMES    GNSSID = 4
+	QZSS    GNSSID = 5
+	GLONASS GNSSID = 6
+)
+
+// FixType is the type of a navigation solution.
+type FixType uint8
+
+const (
+	NoFix FixType = iota
+	DeadReckoning
+	Fix2D
+	Fix3D
+	GNSSDeadReckoning
+	TimeOnly
+)
+
+// Validity flags of NavPVT.Valid.
+const (
+	ValidDate     = 0x01
+	ValidTime     = 0x02
+	FullyResolved = 0x04
+	ValidMag      = 0x08
+)
+
+// Fix status flags of NavPVT.Flags.
+const (
+	GNSSFixOK    = 0x01
+	DiffSolution = 0x02
+	HeadVehValid = 0x20
+)
+
+// NavPVT is the navigation position velocity time solution (NAV-PVT).
+type NavPVT struct {
+	ITOW uint32 // GPS time of week of the navigation epoch in ms
+
+	// Time is the UTC time of the solution, if Valid has ValidDate and
+	// ValidTime set.
+	Time         time.Time
+	Valid        uint8
+	TimeAccuracy uint32 // in ns
+
+	FixType FixType
+	Flags   uint8
+	NumSV   uint8 // satellites used
+
+	Longitude, Latitude int32  // in 1e-7 degrees
+	Height              int32  // above the ellipsoid in mm
+	HeightMSL           int32  // above mean sea level in mm
+	HAccuracy           uint32 // in mm
+	VAccuracy           uint32 // in mm
+
+	VelN, VelE, VelD int32  // NED velocity in mm/s
+	GroundSpeed      int32  // in mm/s
+	HeadMotion       int32  // heading of motion in 1e-5 degrees
+	SpeedAccuracy    uint32 // in mm/s
+	HeadAccuracy     uint32 // in 1e-5 degrees
+	PDOP             uint16 // in 0.01
+}
+
+// ParseNavPVT decodes a NAV-PVT message.
+func ParseNavPVT(m Message) (p NavPVT, err error) {
+	if !m.Is(ClassNAV, IDNavPVT) {
+		return p, ErrWrongMessage
+	}
+	b := m.Payload
+	if len(b) < 84 {
+		return p, ErrPayloadLength
+	}
+	le := binary.LittleEndian
+	p.ITOW = le.Uint32(b[0:])
+	p.Valid = b[11]
+	p.TimeAccuracy = le.Uint32(b[12:])
+	if p.Valid&(ValidDate|ValidTime) == ValidDate|ValidTime {
+		p.Time = time.Date(int(le.Uint16(b[4:])), time.Month(b[6]), int(b[7]),
+			int(b[8]), int(b[9]), int(b[10]), 0, time.UTC).
+			Add(time.Duration(int32(le.Uint32(b[16:]))))
+	}
+	p.FixType = FixType(b[20])
+	p.Flags = b[21]
+	p.NumSV = b[23]
+	p.Longitude = int32(le.Uint32(b[24:]))
+	p.Latitude = int32(le.Uint32(b[28:]))
+	p.Height = int32(le.Uint32(b[32:]))
+	p.HeightMSL = int32(le.Uint32(b[36:]))
+	p.HAccuracy = le.Uint32(b[40:])
+	p.VAccuracy = le.Uint32(b[44:])
+	p.VelN = int32(le.Uint32(b[48:]))
+	p.VelE = int32(le.Uint32(b[52:]))
+	p.VelD = int32(le.Uint32(b[56:]))
+	p.GroundSpeed = int32(le.Uint32(b[60:]))
+	p.HeadMotion = int32(le.Uint32(b[64:]))
+	p.SpeedAccuracy = le.Uint32(b[68:])
+	p.HeadAccuracy = le.Uint32(b[72:])
+	p.PDOP = le.Uint16(b[76:])
+	return p, nil
+}
+
+// NavSat lists the satellites in view (NAV-SAT).
+type NavSat struct {
+	ITOW       uint32
+	Satellites []SatInfo
+}
+
+// SatInfo describes a satellite of NavSat.
+type SatInfo struct {
+	GNSS      GNSSID
+	SV        uint8 // satellite number within the system
+	CNO       uint8 // carrier to noise ratio in dBHz
+	Elevation int8  // in degrees, -91 if unknown
+	Azimuth   int16 // in degrees
+	Residual  int16 // pseudorange residual in 0.1m
+	Flags     uint32
+}
+
+// Used returns whether the satellite is used in the navigation solution.
+func (s SatInfo) Used() bool {
+	return s.Flags&0x08 != 0
+}
+
+// Quality returns the signal quality indicator, 0 (no signal) to 7 (code and
+// carrier locked).
+func (s SatInfo) Quality() uint8 {
+	return uint8(s.Flags & 0x07)
+}
+
+// ParseNavSat decodes a NAV-SAT message.
+func ParseNavSat(m Message) (s NavSat, err error) {
+	if !m.Is(ClassNAV, IDNavSat) {
+		return s, ErrWrongMessage
+	}
+	b := m.Payload
+	if len(b) < 8 || len(b) != 8+12*int(b[5]) {
+		return s, ErrPayloadLength
+	}
+	le := binary.LittleEndian
+	s.ITOW = le.Uint32(b[0:])
+	s.Satellites = make([]SatInfo, b[5])
+	for i := range s.Satellites {
+		e := b[8+12*i:]
+		s.Satellites[i] = SatInfo{
+			GNSS:      GNSSID(e[0]),
+			SV:        e[1],
+			CNO:       e[2],
+			Elevation: int8(e[3]),
+			Azimuth:   int16(le.Uint16(e[4:])),
+			Residual:  int16(le.Uint16(e[6:])),
+			Flags:     le.Uint32(e[8:]),
+		}
+	}
+	return s, nil
+}
+
+// NavStatus is the receiver navigation status (NAV-STATUS).
+type NavStatus struct {
+	ITOW    uint32
+	FixType FixType
+	Flags   uint8 // GNSSFixOK, DiffSolution, 0x04 week valid, 0x08 time of week valid
+	FixStat uint8
+	Flags2  uint8
+	TTFF    uint32 // time to first fix in ms
+	MSSS    uint32 // ms since startup or reset
+}
+
+// ParseNavStatus decodes a NAV-STATUS message.
+func ParseNavStatus(m Message) (s NavStatus, err error) {
+	if !m.Is(ClassNAV, IDNavStatus) {
+		return s, ErrWrongMessage
+	}
+	b := m.Payload
+	if len(b) != 16 {
+		return s, ErrPayloadLength
+	}
+	le := binary.LittleEndian
+	return NavStatus{
+		ITOW:    le.Uint32(b[0:]),
+		FixType: FixType(b[4]),
+		Flags:   b[5],
+		FixStat: b[6],
+		Flags2:  b[7],
+		TTFF:    le.Uint32(b[8:]),
+		MSSS:    le.Uint32(b[12:]),
+	}, nil
+}
+
+// MonVer is the receiver and software version (MON-VER).
+type MonVer struct {
+	Software   string
+	Hardware   string
+	Extensions []string // such as "PROTVER=18.00" and "GPS;GLO;GAL;BDS"
+}
+
+// ParseMonVer decodes a MON-VER message.
+func ParseMonVer(m Message) (v MonVer, err error) {
+	if !m.Is(ClassMON, IDMonVer) {
+		return v, ErrWrongMessage
+	}
+	b := m.Payload
+	if len(b) < 40 || (len(b)-40)%30 != 0 {
+		return v, ErrPayloadLength
+	}
+	v.Software = cString(b[:30])
+	v.Hardware = cString(b[30:40])
+	for e := b[40:]; len(e) > 0; e = e[30:] {
+		v.Extensions = append(v.Extensions, cString(e[:30]))
+	}
+	return v, nil
+}
+
+// cString returns the zero terminated string in b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,99 @@
+package ubx
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Timing message IDs.
+const (
+	IDNavTimeUTC = 0x21
+	IDCfgTP5     = 0x31
+)
+
+// TimePulse is the configuration of a time pulse output of the receiver,
+// for CfgTimePulse. Periods and lengths are rounded to microseconds.
+type TimePulse struct {
+	// Index selects the output: 0 for TIMEPULSE, 1 for TIMEPULSE2.
+	Index uint8
+
+	// Period and Length are the period and length of the pulses while the
+	// receiver has no fix, zero Length for no pulses.
+	Period time.Duration
+	Length time.Duration
+
+	// PeriodLocked and LengthLocked apply once the receiver is locked to
+	// GNSS time.
+	PeriodLocked time.Duration
+	LengthLocked time.Duration
+
+	// FallingEdge puts the top of the second on the falling edge of the
+	// pulse instead of the rising edge.
+	FallingEdge bool
+
+	// CableDelay is the delay of the antenna cable in ns, to compensate.
+	CableDelay int16
+}
+
+// PPS is a TimePulse of one 100ms pulse per second at the top of every UTC
+// second, on the rising edge, only once locked to GNSS time.
+var PPS = TimePulse{
+	Period:       time.Second,
+	PeriodLocked: time.Second,
+	LengthLocked: 100 * time.Millisecond,
+}
+
+// CfgTimePulse returns the CFG-TP5 message that configures a time pulse
+// output, aligned to UTC.
+func CfgTimePulse(tp TimePulse) Message {
+	p := make([]byte, 32)
+	le := binary.LittleEndian
+	p[0] = tp.Index
+	le.PutUint16(p[4:], uint16(tp.CableDelay))
+	le.PutUint32(p[8:], uint32(tp.Period/time.Microsecond))
+	le.PutUint32(p[12:], uint32(tp.PeriodLocked/time.Microsecond))
+	le.PutUint32(p[16:], uint32(tp.Length/time.Microsecond))
+	le.PutUint32(p[20:], uint32(tp.LengthLocked/time.Microsecond))
+	// active, locked to the GNSS frequency, use the locked values when
+	// locked, lengths in us, aligned to the top of the second, UTC
+	flags := uint32(0x01 | 0x02 | 0x04 | 0x10 | 0x20)
+	if !tp.FallingEdge {
+		flags |= 0x40
+	}
+	le.PutUint32(p[28:], flags)
+	return Message{Class: ClassCFG, ID: IDCfgTP5, Payload: p}
+}
+
+// Validity flags of NavTimeUTC.Valid.
+const (
+	ValidTOW = 0x01
+	ValidWKN = 0x02
+	ValidUTC = 0x04
+)
+
+// NavTimeUTC is the UTC time of a navigation epoch (NAV-TIMEUTC).
+type NavTimeUTC struct {
+	ITOW     uint32 // GPS time of week in ms
+	Accuracy uint32 // in ns
+	Time     time.Time
+	Valid    uint8
+}
+
+// ParseNavTimeUTC decodes a NAV-TIMEUTC message.
+func ParseNavTimeUTC(m Message) (t NavTimeUTC, err error) {
+	if !m.Is(ClassNAV, IDNavTimeUTC) {
+		return t, ErrWrongMessage
+	}
+	b := m.Payload
+	if len(b) != 20 {
+		return t, ErrPayloadLength
+	}
+	le := binary.LittleEndian
+	t.ITOW = le.Uint32(b[0:])
+	t.Accuracy = le.Uint32(b[4:])
+	t.Time = time.Date(int(le.Uint16(b[12:])), time.Month(b[14]), int(b[15]),
+		int(b[16]), int(b[17]), int(b[18]), 0, time.UTC).
+		Add(time.Duration(int32(le.Uint32(b[8:]))))
+	t.Valid = b[19]
+	return t, nil
+}
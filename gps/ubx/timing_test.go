@@ -0,0 +1,34 @@
+package ubx_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+func TestCfgTimePulse(t *testing.T) {
+	m := ubx.CfgTimePulse(ubx.PPS)
+	if !m.Is(ubx.ClassCFG, ubx.IDCfgTP5) {
+		t.Fatalf("got class %#x, ID %#x", m.Class, m.ID)
+	}
+	want := []byte{
+		0, 0, 0, 0, // TIMEPULSE
+		0, 0, 0, 0, // no cable or RF group delay
+		0x40, 0x42, 0x0F, 0x00, // 1s period
+		0x40, 0x42, 0x0F, 0x00, // 1s period when locked
+		0, 0, 0, 0, // no pulses
+		0xA0, 0x86, 0x01, 0x00, // 100ms pulses when locked
+		0, 0, 0, 0, // no user delay
+		0x77, 0, 0, 0, // the receiver's default flags
+	}
+	if !bytes.Equal(m.Payload, want) {
+		t.Errorf("got % x\nwant % x", m.Payload, want)
+	}
+
+	m = ubx.CfgTimePulse(ubx.TimePulse{Index: 1, Period: time.Millisecond, Length: time.Microsecond, FallingEdge: true, CableDelay: -50})
+	if m.Payload[0] != 1 || m.Payload[4] != 0xCE || m.Payload[5] != 0xFF || m.Payload[28] != 0x37 {
+		t.Errorf("got % x", m.Payload)
+	}
+}
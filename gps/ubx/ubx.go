@@ -0,0 +1,197 @@
+// Package ubx implements the UBX binary protocol of u-blox GNSS receivers:
+// framing and checksums, decoding of the most used messages, and builders
+// for configuration messages.
+//
+// A frame consists of two sync characters, the message class and ID, the
+// little endian length of the payload, the payload and a two byte Fletcher
+// checksum:
+//
+//	0xB5 0x62 class id len_lo len_hi payload... ck_a ck_b
+//
+// Receivers answer every configuration message with ACK-ACK or ACK-NAK.
+// Client sends messages and waits for the matching acknowledgement or
+// response.
+//
+// Protocol specification:
+// https://www.u-blox.com/sites/default/files/products/documents/u-blox8-M8_ReceiverDescrProtSpec_UBX-13003221.pdf
+package ubx // import "tinygo.org/x/drivers/gps/ubx"
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Message classes.
+const (
+	ClassNAV = 0x01
+	ClassRXM = 0x02
+	ClassINF = 0x04
+	ClassACK = 0x05
+	ClassCFG = 0x06
+	ClassMON = 0x0A
+	ClassAID = 0x0B
+	ClassTIM = 0x0D
+	ClassMGA = 0x13
+)
+
+// Message IDs, by class.
+const (
+	IDNavStatus = 0x03
+	IDNavPVT    = 0x07
+	IDNavSat    = 0x35
+
+	IDAckNak = 0x00
+	IDAckAck = 0x01
+
+	IDCfgPrt  = 0x00
+	IDCfgMsg  = 0x01
+	IDCfgRst  = 0x04
+	IDCfgRate = 0x08
+	IDCfgCfg  = 0x09
+	IDCfgRxm  = 0x11
+	IDCfgNav5 = 0x24
+	IDCfgGNSS = 0x3E
+
+	IDMonVer = 0x04
+)
+
+const (
+	sync1 = 0xB5
+	sync2 = 0x62
+
+	headerSize = 6
+)
+
+var (
+	ErrChecksum      = errors.New("ubx: checksum mismatch")
+	ErrTooLong       = errors.New("ubx: message too long")
+	ErrPayloadLength = errors.New("ubx: unexpected payload length")
+	ErrWrongMessage  = errors.New("ubx: unexpected message class or ID")
+)
+
+// Message is a UBX message.
+type Message struct {
+	Class   byte
+	ID      byte
+	Payload []byte
+}
+
+// Is returns whether m has the given class and ID.
+func (m Message) Is(class, id byte) bool {
+	return m.Class == class && m.ID == id
+}
+
+// Append appends the frame of m to dst and returns the extended buffer.
+func (m Message) Append(dst []byte) []byte {
+	start := len(dst)
+	dst = append(dst, sync1, sync2, m.Class, m.ID, byte(len(m.Payload)), byte(len(m.Payload)>>8))
+	dst = append(dst, m.Payload...)
+	a, b := checksum(dst[start+2:])
+	return append(dst, a, b)
+}
+
+// Bytes returns the frame of m.
+func (m Message) Bytes() []byte {
+	return m.Append(make([]byte, 0, headerSize+len(m.Payload)+2))
+}
+
+// checksum computes the 8-bit Fletcher checksum of the class, ID, length and
+// payload of a frame.
+func checksum(data []byte) (a, b byte) {
+	for _, c := range data {
+		a += c
+		b += a
+	}
+	return
+}
+
+// Parser extracts UBX messages from a stream of bytes, which may contain
+// other protocols such as NMEA in between.
+type Parser struct {
+	// MaxPayload is the size of the largest payload accepted, 1024 bytes if
+	// zero. Longer messages are dropped with ErrTooLong.
+	MaxPayload int
+
+	buf   []byte
+	state uint8
+	need  int
+}
+
+const (
+	stateSync1 = iota
+	stateSync2
+	stateHeader
+	statePayload
+)
+
+// Feed adds a byte of the stream. When it completes a message, it returns it
+// and true. The payload of the message is only valid until the next call.
+// Frames with a bad checksum give ErrChecksum.
+func (p *Parser) Feed(c byte) (msg Message, ok bool, err error) {
+	switch p.state {
+	case stateSync1:
+		if c == sync1 {
+			p.state = stateSync2
+		}
+	case stateSync2:
+		switch c {
+		case sync2:
+			p.buf = p.buf[:0]
+			p.state = stateHeader
+		case sync1:
+		default:
+			p.state = stateSync1
+		}
+	case stateHeader:
+		p.buf = append(p.buf, c)
+		if len(p.buf) == headerSize-2 {
+			length := int(binary.LittleEndian.Uint16(p.buf[2:]))
+			max := p.MaxPayload
+			if max == 0 {
+				max = 1024
+			}
+			if length > max {
+				p.state = stateSync1
+				return msg, false, ErrTooLong
+			}
+			p.need = len(p.buf) + length + 2
+			p.state = statePayload
+		}
+	case statePayload:
+		p.buf = append(p.buf, c)
+		if len(p.buf) == p.need {
+			p.state = stateSync1
+			n := len(p.buf)
+			a, b := checksum(p.buf[:n-2])
+			if a != p.buf[n-2] || b != p.buf[n-1] {
+				return msg, false, ErrChecksum
+			}
+			msg = Message{Class: p.buf[0], ID: p.buf[1], Payload: p.buf[4 : n-2]}
+			return msg, true, nil
+		}
+	}
+	return
+}
+
+// Ack is the acknowledgement of a configuration message.
+type Ack struct {
+	Class, ID byte // of the acknowledged message
+	Ack       bool // false for ACK-NAK
+}
+
+// ParseAck decodes an ACK-ACK or ACK-NAK message.
+func ParseAck(m Message) (Ack, error) {
+	if m.Class != ClassACK || (m.ID != IDAckAck && m.ID != IDAckNak) {
+		return Ack{}, ErrWrongMessage
+	}
+	if len(m.Payload) != 2 {
+		return Ack{}, ErrPayloadLength
+	}
+	return Ack{Class: m.Payload[0], ID: m.Payload[1], Ack: m.ID == IDAckAck}, nil
+}
+
+// Poll returns the message that polls the message of class and id: the same
+// message with an empty payload.
+func Poll(class, id byte) Message {
+	return Message{Class: class, ID: id}
+}
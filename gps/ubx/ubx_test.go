@@ -0,0 +1,379 @@
+package ubx_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/gps/ubx"
+)
+
+// The frames of these tests are built from the layouts of the protocol
+// specification: no frames captured from a receiver are available.
+
+// frame returns the frame of a message.
+func frame(class, id byte, payload ...byte) []byte {
+	return ubx.Message{Class: class, ID: id, Payload: payload}.Bytes()
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestMessageBytes(t *testing.T) {
+	// CFG-MSG polling NAV-PVT, with the checksum computed by hand over
+	// 06 01 02 00 01 07
+	got := frame(ubx.ClassCFG, ubx.IDCfgMsg, 0x01, 0x07)
+	want := []byte{0xB5, 0x62, 0x06, 0x01, 0x02, 0x00, 0x01, 0x07, 0x11, 0x3A}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+}
+
+func TestParser(t *testing.T) {
+	ack := frame(ubx.ClassACK, ubx.IDAckAck, ubx.ClassCFG, ubx.IDCfgRate)
+	bad := frame(ubx.ClassNAV, ubx.IDNavStatus, 1, 2, 3)
+	bad[len(bad)-1]++
+	long := []byte{0xB5, 0x62, 0x01, 0x07, 0x01, 0x04} // 1025 bytes
+
+	for _, tc := range []struct {
+		name   string
+		stream []byte
+		errs   []error
+		want   int // messages
+	}{
+		{"frame", ack, nil, 1},
+		{"after NMEA", concat([]byte("$GPTXT,01,01,02,ANTSTATUS=OK*3B\r\n"), ack), nil, 1},
+		{"repeated sync", concat([]byte{0xB5, 0xB5}, ack[1:]), nil, 1},
+		{"broken sync", concat([]byte{0xB5, 0x00, 0x62}, ack), nil, 1},
+		{"empty payload", frame(ubx.ClassMON, ubx.IDMonVer), nil, 1},
+		{"checksum", concat(bad, ack), []error{ubx.ErrChecksum}, 1},
+		{"too long", concat(long, ack), []error{ubx.ErrTooLong}, 1},
+		{"two frames", concat(ack, ack), nil, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var p ubx.Parser
+			var errs []error
+			n := 0
+			for _, c := range tc.stream {
+				m, ok, err := p.Feed(c)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				if !ok {
+					continue
+				}
+				n++
+				if !bytes.HasSuffix(tc.stream, m.Bytes()) {
+					t.Errorf("got %+v", m)
+				}
+			}
+			if n != tc.want {
+				t.Errorf("got %d messages, want %d", n, tc.want)
+			}
+			if len(errs) != len(tc.errs) || len(errs) > 0 && errs[0] != tc.errs[0] {
+				t.Errorf("got errors %v, want %v", errs, tc.errs)
+			}
+		})
+	}
+
+	// MaxPayload
+	p := ubx.Parser{MaxPayload: 1}
+	var err error
+	for _, c := range ack {
+		if _, _, e := p.Feed(c); e != nil {
+			err = e
+		}
+	}
+	if err != ubx.ErrTooLong {
+		t.Errorf("got %v, want %v", err, ubx.ErrTooLong)
+	}
+}
+
+func TestParseAck(t *testing.T) {
+	for _, tc := range []struct {
+		m    ubx.Message
+		want ubx.Ack
+		err  error
+	}{
+		{ubx.Message{Class: ubx.ClassACK, ID: ubx.IDAckAck, Payload: []byte{0x06, 0x24}}, ubx.Ack{Class: 0x06, ID: 0x24, Ack: true}, nil},
+		{ubx.Message{Class: ubx.ClassACK, ID: ubx.IDAckNak, Payload: []byte{0x06, 0x24}}, ubx.Ack{Class: 0x06, ID: 0x24}, nil},
+		{ubx.Message{Class: ubx.ClassACK, ID: ubx.IDAckAck, Payload: []byte{0x06}}, ubx.Ack{}, ubx.ErrPayloadLength},
+		{ubx.Message{Class: ubx.ClassACK, ID: 0x02, Payload: []byte{0x06, 0x24}}, ubx.Ack{}, ubx.ErrWrongMessage},
+		{ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDAckAck, Payload: []byte{0x06, 0x24}}, ubx.Ack{}, ubx.ErrWrongMessage},
+	} {
+		if ack, err := ubx.ParseAck(tc.m); ack != tc.want || err != tc.err {
+			t.Errorf("%+v: got %+v, %v, want %+v, %v", tc.m, ack, err, tc.want, tc.err)
+		}
+	}
+}
+
+// receiver is the connection to a receiver: it records what is written, and
+// returns the bytes of data, then err.
+type receiver struct {
+	written bytes.Buffer
+	data    []byte
+	err     error
+}
+
+func (r *receiver) Write(p []byte) (int, error) {
+	return r.written.Write(p)
+}
+
+func (r *receiver) ReadByte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	c := r.data[0]
+	r.data = r.data[1:]
+	return c, nil
+}
+
+func TestClient(t *testing.T) {
+	rate := ubx.Message{Class: ubx.ClassCFG, ID: ubx.IDCfgRate, Payload: []byte{0xE8, 0x03, 0x01, 0x00, 0x01, 0x00}}
+	ack := frame(ubx.ClassACK, ubx.IDAckAck, ubx.ClassCFG, ubx.IDCfgRate)
+	nak := frame(ubx.ClassACK, ubx.IDAckNak, ubx.ClassCFG, ubx.IDCfgRate)
+	otherAck := frame(ubx.ClassACK, ubx.IDAckAck, ubx.ClassCFG, ubx.IDCfgMsg)
+	status := frame(ubx.ClassNAV, ubx.IDNavStatus, make([]byte, 16)...)
+	monVer := frame(ubx.ClassMON, ubx.IDMonVer, make([]byte, 40)...)
+
+	for _, tc := range []struct {
+		name    string
+		request bool
+		m       ubx.Message
+		data    []byte
+		err     error // of the reader once data is read
+		want    error
+		handled int
+	}{
+		{"ack", false, rate, concat([]byte("$GPGSV*00\r\n"), ack), ubx.ErrNoData, nil, 0},
+		{"nak", false, rate, nak, ubx.ErrNoData, ubx.ErrNak, 0},
+		{"other messages", false, rate, concat(status, otherAck, ack), ubx.ErrNoData, nil, 2},
+		{"no ack", false, rate, status, ubx.ErrNoData, ubx.ErrTimeout, 1},
+		{"end of file", false, rate, status, io.EOF, io.EOF, 1},
+		{"not configuration", false, ubx.Poll(ubx.ClassMON, ubx.IDMonVer), nil, io.EOF, nil, 0},
+		{"response", true, ubx.Poll(ubx.ClassMON, ubx.IDMonVer), concat(status, monVer), ubx.ErrNoData, nil, 1},
+		// a poll of a configuration is acknowledged after the response
+		{"acked response", true, ubx.Poll(ubx.ClassCFG, ubx.IDCfgRate), concat(frame(ubx.ClassCFG, ubx.IDCfgRate, rate.Payload...), ack), io.EOF, nil, 0},
+		{"nak instead of response", true, ubx.Poll(ubx.ClassCFG, ubx.IDCfgRate), nak, ubx.ErrNoData, ubx.ErrNak, 0},
+		{"no response", true, ubx.Poll(ubx.ClassMON, ubx.IDMonVer), status, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &receiver{data: tc.data, err: tc.err}
+			c := ubx.NewClient(r, r)
+			c.Timeout = 20 * time.Millisecond
+			handled := 0
+			c.Handler = func(ubx.Message) { handled++ }
+
+			var err error
+			if tc.request {
+				var m ubx.Message
+				m, err = c.Request(tc.m)
+				if err == nil && !m.Is(tc.m.Class, tc.m.ID) {
+					t.Errorf("got class %#x, ID %#x", m.Class, m.ID)
+				}
+			} else {
+				err = c.Send(tc.m)
+			}
+			if err != tc.want {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			if handled != tc.handled {
+				t.Errorf("handled %d messages, want %d", handled, tc.handled)
+			}
+			if !bytes.Equal(r.written.Bytes(), tc.m.Bytes()) {
+				t.Errorf("wrote % x", r.written.Bytes())
+			}
+		})
+	}
+}
+
+func TestClientRead(t *testing.T) {
+	bad := frame(ubx.ClassNAV, ubx.IDNavStatus, 1, 2, 3)
+	bad[len(bad)-2]++
+	r := &receiver{data: concat(bad, frame(ubx.ClassNAV, ubx.IDNavStatus, make([]byte, 16)...)), err: io.EOF}
+	c := ubx.NewClient(r, r)
+	if m, err := c.Read(); err != nil || !m.Is(ubx.ClassNAV, ubx.IDNavStatus) {
+		t.Errorf("got %+v, %v", m, err)
+	}
+	if _, err := c.Read(); err != io.EOF {
+		t.Errorf("got %v, want %v", err, io.EOF)
+	}
+}
+
+// signed returns the two's complement of v.
+func signed(v int32) uint32 {
+	return uint32(v)
+}
+
+// navPVT returns the payload of a NAV-PVT message of u-blox 8, of 92 bytes.
+func navPVT() []byte {
+	b := make([]byte, 92)
+	le := binary.LittleEndian
+	le.PutUint32(b[0:], 345600000) // iTOW
+	le.PutUint16(b[4:], 2024)      // year
+	b[6], b[7] = 2, 29             // month, day
+	b[8], b[9], b[10] = 23, 59, 59 // hour, min, sec
+	b[11] = ubx.ValidDate | ubx.ValidTime | ubx.FullyResolved
+	le.PutUint32(b[12:], 25)            // tAcc
+	le.PutUint32(b[16:], signed(-5000)) // nano
+	b[20] = byte(ubx.Fix3D)
+	b[21] = ubx.GNSSFixOK | ubx.HeadVehValid
+	b[23] = 11                                // numSV
+	le.PutUint32(b[24:], signed(-1225000000)) // lon
+	le.PutUint32(b[28:], 374000000)           // lat
+	le.PutUint32(b[32:], signed(-12345))      // height
+	le.PutUint32(b[36:], 20500)               // hMSL
+	le.PutUint32(b[40:], 1500)                // hAcc
+	le.PutUint32(b[44:], 2500)                // vAcc
+	le.PutUint32(b[48:], signed(-100))        // velN
+	le.PutUint32(b[52:], 200)                 // velE
+	le.PutUint32(b[56:], signed(-300))        // velD
+	le.PutUint32(b[60:], 224)                 // gSpeed
+	le.PutUint32(b[64:], 11656505)            // headMot
+	le.PutUint32(b[68:], 400)                 // sAcc
+	le.PutUint32(b[72:], 500000)              // headAcc
+	le.PutUint16(b[76:], 135)                 // pDOP
+	return b
+}
+
+func TestParseNavPVT(t *testing.T) {
+	m := ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavPVT, Payload: navPVT()}
+	p, err := ubx.ParseNavPVT(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ubx.NavPVT{
+		ITOW:          345600000,
+		Time:          time.Date(2024, 2, 29, 23, 59, 58, 999995000, time.UTC),
+		Valid:         0x07,
+		TimeAccuracy:  25,
+		FixType:       ubx.Fix3D,
+		Flags:         0x21,
+		NumSV:         11,
+		Longitude:     -1225000000,
+		Latitude:      374000000,
+		Height:        -12345,
+		HeightMSL:     20500,
+		HAccuracy:     1500,
+		VAccuracy:     2500,
+		VelN:          -100,
+		VelE:          200,
+		VelD:          -300,
+		GroundSpeed:   224,
+		HeadMotion:    11656505,
+		SpeedAccuracy: 400,
+		HeadAccuracy:  500000,
+		PDOP:          135,
+	}
+	if p != want {
+		t.Errorf("got  %+v\nwant %+v", p, want)
+	}
+
+	// without a valid time
+	m.Payload[11] = ubx.ValidDate
+	if p, err := ubx.ParseNavPVT(m); err != nil || !p.Time.IsZero() {
+		t.Errorf("got %v, %v, want no time", p.Time, err)
+	}
+	// the payload of u-blox 7 is shorter
+	if _, err := ubx.ParseNavPVT(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavPVT, Payload: m.Payload[:84]}); err != nil {
+		t.Errorf("84 bytes: %v", err)
+	}
+	if _, err := ubx.ParseNavPVT(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavPVT, Payload: m.Payload[:83]}); err != ubx.ErrPayloadLength {
+		t.Errorf("83 bytes: got %v, want %v", err, ubx.ErrPayloadLength)
+	}
+	if _, err := ubx.ParseNavPVT(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavSat, Payload: m.Payload}); err != ubx.ErrWrongMessage {
+		t.Errorf("NAV-SAT: got %v, want %v", err, ubx.ErrWrongMessage)
+	}
+}
+
+func TestParseNavSat(t *testing.T) {
+	payload := []byte{
+		0x10, 0x27, 0, 0, // iTOW
+		1, 2, 0, 0, // version, numSvs
+		byte(ubx.GPS), 12, 45, 67, 0x0E, 0x01, 0xF6, 0xFF, 0x1F, 0x00, 0x00, 0x00,
+		byte(ubx.GLONASS), 3, 0, 0xA5, 0, 0, 0, 0, 0x01, 0, 0, 0,
+	}
+	s, err := ubx.ParseNavSat(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavSat, Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ubx.SatInfo{
+		{GNSS: ubx.GPS, SV: 12, CNO: 45, Elevation: 67, Azimuth: 270, Residual: -10, Flags: 0x1F},
+		{GNSS: ubx.GLONASS, SV: 3, Elevation: -91, Flags: 0x01},
+	}
+	if s.ITOW != 10000 || len(s.Satellites) != len(want) {
+		t.Fatalf("got %+v", s)
+	}
+	for i := range want {
+		if s.Satellites[i] != want[i] {
+			t.Errorf("satellite %d: got %+v, want %+v", i, s.Satellites[i], want[i])
+		}
+	}
+	if !s.Satellites[0].Used() || s.Satellites[0].Quality() != 7 || s.Satellites[1].Used() || s.Satellites[1].Quality() != 1 {
+		t.Error("wrong Used or Quality")
+	}
+
+	for _, n := range []int{7, 19, 21} {
+		b := append([]byte(nil), payload[:n]...)
+		if n > 5 {
+			b[5] = 1
+		}
+		if _, err := ubx.ParseNavSat(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavSat, Payload: b}); err != ubx.ErrPayloadLength {
+			t.Errorf("%d bytes: got %v, want %v", n, err, ubx.ErrPayloadLength)
+		}
+	}
+}
+
+func TestParseNavStatus(t *testing.T) {
+	payload := []byte{
+		0x10, 0x27, 0, 0, // iTOW
+		byte(ubx.Fix2D), 0x0D, 0x01, 0x08,
+		0x88, 0x13, 0, 0, // ttff
+		0x40, 0x42, 0x0F, 0, // msss
+	}
+	s, err := ubx.ParseNavStatus(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavStatus, Payload: payload})
+	want := ubx.NavStatus{ITOW: 10000, FixType: ubx.Fix2D, Flags: 0x0D, FixStat: 0x01, Flags2: 0x08, TTFF: 5000, MSSS: 1000000}
+	if s != want || err != nil {
+		t.Errorf("got %+v, %v, want %+v", s, err, want)
+	}
+	if _, err := ubx.ParseNavStatus(ubx.Message{Class: ubx.ClassNAV, ID: ubx.IDNavStatus, Payload: payload[:15]}); err != ubx.ErrPayloadLength {
+		t.Errorf("got %v, want %v", err, ubx.ErrPayloadLength)
+	}
+}
+
+func TestParseMonVer(t *testing.T) {
+	field := func(s string, n int) []byte {
+		b := make([]byte, n)
+		copy(b, s)
+		return b
+	}
+	payload := concat(
+		field("ROM CORE 3.01 (107888)", 30),
+		field("00080000", 10),
+		field("FWVER=SPG 3.01", 30),
+		field("PROTVER=18.00", 30),
+		field("GPS;GLO;GAL;BDS", 30),
+	)
+	v, err := ubx.ParseMonVer(ubx.Message{Class: ubx.ClassMON, ID: ubx.IDMonVer, Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Software != "ROM CORE 3.01 (107888)" || v.Hardware != "00080000" || len(v.Extensions) != 3 ||
+		v.Extensions[0] != "FWVER=SPG 3.01" || v.Extensions[1] != "PROTVER=18.00" || v.Extensions[2] != "GPS;GLO;GAL;BDS" {
+		t.Errorf("got %+v", v)
+	}
+
+	// a field without terminating zero
+	full := concat(bytes.Repeat([]byte{'A'}, 30), field("", 10))
+	if v, err := ubx.ParseMonVer(ubx.Message{Class: ubx.ClassMON, ID: ubx.IDMonVer, Payload: full}); err != nil || len(v.Software) != 30 || v.Extensions != nil {
+		t.Errorf("got %+v, %v", v, err)
+	}
+	for _, n := range []int{39, 41, 69} {
+		if _, err := ubx.ParseMonVer(ubx.Message{Class: ubx.ClassMON, ID: ubx.IDMonVer, Payload: payload[:n]}); err != ubx.ErrPayloadLength {
+			t.Errorf("%d bytes: got %v, want %v", n, err, ubx.ErrPayloadLength)
+		}
+	}
+}
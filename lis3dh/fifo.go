@@ -0,0 +1,83 @@
+package lis3dh
+
+// ConfigureFIFO enables the FIFO in the given mode, or disables it in
+// FIFO_BYPASS mode, with a watermark, the number of samples from 1 to 31 at
+// which INT_WATERMARK is raised. In FIFO_STREAM_TO_FIFO mode, the trigger is
+// the interrupt signaled on INT1, or on INT2 if trigger2 is true.
+func (d *Device) ConfigureFIFO(mode FIFOMode, watermark uint8, trigger2 bool) error {
+	ctl := uint8(mode)<<6 | watermark&0x1F
+	if trigger2 {
+		ctl |= 0x20
+	}
+	if err := d.bus.WriteRegister(uint8(d.Address), REG_FIFOCTRL, []byte{ctl}); err != nil {
+		return err
+	}
+	// FIFO_EN
+	return d.updateRegister(REG_CTRL5, 0x40, mode != FIFO_BYPASS)
+}
+
+// FIFOCount returns the number of samples in the FIFO.
+func (d *Device) FIFOCount() (int, error) {
+	src := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), REG_FIFOSRC, src); err != nil {
+		return 0, err
+	}
+	switch {
+	case src[0]&0x20 != 0: // EMPTY
+		return 0, nil
+	case src[0]&0x40 != 0: // OVRN_FIFO: all 32 samples are filled
+		return 32, nil
+	}
+	return int(src[0] & 0x1F), nil
+}
+
+// ReadFIFO reads the oldest samples of the FIFO into samples, as x, y and z
+// in µg, and returns how many it read: at most len(samples), and at most the
+// number in the FIFO.
+func (d *Device) ReadFIFO(samples [][3]int32) (int, error) {
+	count, err := d.FIFOCount()
+	if err != nil {
+		return 0, err
+	}
+	if count > len(samples) {
+		count = len(samples)
+	}
+	// With the FIFO enabled, the address of a burst read rolls back from
+	// the last data register to the first, so several samples can be read at
+	// once.
+	var data [8 * 6]byte
+	for n := 0; n < count; {
+		chunk := count - n
+		if chunk > 8 {
+			chunk = 8
+		}
+		buf := data[:chunk*6]
+		if err := d.bus.ReadRegister(uint8(d.Address), REG_OUT_X_L|0x80, buf); err != nil {
+			return n, err
+		}
+		for i := 0; i < chunk; i++ {
+			b := buf[i*6:]
+			samples[n+i] = [3]int32{
+				d.convert(int16(uint16(b[1])<<8 | uint16(b[0]))),
+				d.convert(int16(uint16(b[3])<<8 | uint16(b[2]))),
+				d.convert(int16(uint16(b[5])<<8 | uint16(b[4]))),
+			}
+		}
+		n += chunk
+	}
+	return count, nil
+}
+
+// updateRegister sets or clears the bits of mask in a register.
+func (d *Device) updateRegister(reg, mask uint8, set bool) error {
+	data := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), reg, data); err != nil {
+		return err
+	}
+	if set {
+		data[0] |= mask
+	} else {
+		data[0] &^= mask
+	}
+	return d.bus.WriteRegister(uint8(d.Address), reg, data)
+}
@@ -0,0 +1,212 @@
+package lis3dh
+
+import "time"
+
+// ConfigureInterrupts sets the interrupts signaled on the INT1 and INT2
+// pins, which are active high. Interrupts other than INT_DATA_READY and
+// those of the FIFO are latched until ReadInterrupts.
+func (d *Device) ConfigureInterrupts(int1, int2 Interrupt) error {
+	if int1&INT_DOUBLE_TAP != 0 {
+		int1 |= INT_TAP
+	}
+	if int2&INT_DOUBLE_TAP != 0 {
+		int2 |= INT_TAP
+	}
+	ctrl3 := uint8(int1 & (INT_TAP | INT_FREE_FALL | INT_ACTIVITY | INT_DATA_READY | INT_WATERMARK | INT_OVERRUN))
+	ctrl6 := uint8(int2 & (INT_TAP | INT_FREE_FALL | INT_ACTIVITY | INT_INACTIVITY))
+	if err := d.bus.WriteRegister(uint8(d.Address), REG_CTRL3, []byte{ctrl3}); err != nil {
+		return err
+	}
+	if err := d.bus.WriteRegister(uint8(d.Address), REG_CTRL6, []byte{ctrl6}); err != nil {
+		return err
+	}
+	// LIR_INT1 and LIR_INT2
+	return d.updateRegister(REG_CTRL5, 0x0A, true)
+}
+
+// ReadInterrupts returns the interrupts raised, and clears those latched.
+// INT_INACTIVITY is not reported: the INT2 pin shows the state.
+func (d *Device) ReadInterrupts() (Interrupt, error) {
+	var src [5]byte
+	for i, reg := range [...]uint8{REG_INT1SRC, REG_INT2SRC, REG_CLICKSRC, REG_FIFOSRC, REG_STATUS2} {
+		if err := d.bus.ReadRegister(uint8(d.Address), reg, src[i:i+1]); err != nil {
+			return 0, err
+		}
+	}
+	var ints Interrupt
+	for _, bit := range [...]struct {
+		src, mask uint8
+		ints      Interrupt
+	}{
+		{0, 0x40, INT_FREE_FALL},  // IA
+		{1, 0x40, INT_ACTIVITY},   // IA
+		{2, 0x10, INT_TAP},        // SCLICK
+		{2, 0x20, INT_DOUBLE_TAP}, // DCLICK
+		{3, 0x80, INT_WATERMARK},  // WTM
+		{3, 0x40, INT_OVERRUN},    // OVRN_FIFO
+		{4, 0x08, INT_DATA_READY}, // ZYXDA
+	} {
+		if src[bit.src]&bit.mask != 0 {
+			ints |= bit.ints
+		}
+	}
+	return ints, nil
+}
+
+// TapConfig configures the detection of taps.
+type TapConfig struct {
+	// Threshold is the acceleration of a tap in µg, up to 127 steps of 16
+	// mg at RANGE_2_G, 32 mg at RANGE_4_G, 62 mg at RANGE_8_G and 186 mg at
+	// RANGE_16_G.
+	Threshold int32
+
+	// Duration is the longest time the acceleration of a tap stays above
+	// the threshold, up to 127 samples.
+	Duration time.Duration
+
+	// Latency is the time after a tap before the window for a second tap,
+	// and Window the length of that window, both up to 255 samples. Double
+	// taps are only detected if Window is set.
+	Latency time.Duration
+	Window  time.Duration
+
+	// Axes are the axes on which taps are detected.
+	Axes Axes
+}
+
+// ConfigureTap configures the detection of single and double taps, which
+// raise INT_TAP and INT_DOUBLE_TAP. Durations depend on the data rate, which
+// must be set before.
+func (d *Device) ConfigureTap(cfg TapConfig) error {
+	var click uint8
+	for i := uint8(0); i < 3; i++ {
+		if cfg.Axes&(1<<i) != 0 {
+			click |= 1 << (2 * i) // XS, YS or ZS
+			if cfg.Window > 0 {
+				click |= 2 << (2 * i) // XD, YD or ZD
+			}
+		}
+	}
+	return d.writeRegisters(
+		REG_CLICKCFG, click,
+		REG_CLICKTHS, 0x80|d.threshold(cfg.Threshold), // LIR_Click
+		REG_TIMELIMIT, d.samples(cfg.Duration, 1, 127),
+		REG_TIMELATEN, d.samples(cfg.Latency, 1, 255),
+		REG_TIMEWINDO, d.samples(cfg.Window, 1, 255),
+	)
+}
+
+// ConfigureFreeFall configures the detection of free fall, which raises
+// INT_FREE_FALL when the acceleration on all axes stays below threshold, in
+// µg, for duration, up to 127 samples. Typical values are 350 mg and 30 ms.
+func (d *Device) ConfigureFreeFall(threshold int32, duration time.Duration) error {
+	return d.writeRegisters(
+		REG_INT1CFG, 0x95, // AOI, ZLIE, YLIE, XLIE
+		REG_INT1THS, d.threshold(threshold),
+		REG_INT1DUR, d.samples(duration, 1, 127),
+	)
+}
+
+// ConfigureActivity configures the detection of activity, which raises
+// INT_ACTIVITY when the acceleration on any of axes, high-pass filtered so
+// that gravity is ignored, exceeds threshold in µg for duration, up to 127
+// samples.
+func (d *Device) ConfigureActivity(threshold int32, duration time.Duration, axes Axes) error {
+	var cfg uint8
+	for i := uint8(0); i < 3; i++ {
+		if axes&(1<<i) != 0 {
+			cfg |= 2 << (2 * i) // XHIE, YHIE or ZHIE
+		}
+	}
+	err := d.writeRegisters(
+		REG_INT2CFG, cfg,
+		REG_INT2THS, d.threshold(threshold),
+		REG_INT2DUR, d.samples(duration, 1, 127),
+	)
+	if err != nil {
+		return err
+	}
+	// HPIS2, and reset the filter by reading the reference
+	if err := d.updateRegister(REG_CTRL2, 0x02, true); err != nil {
+		return err
+	}
+	return d.bus.ReadRegister(uint8(d.Address), REG_REFERENCE, []byte{0})
+}
+
+// ConfigureInactivity configures the detection of inactivity: when the
+// acceleration stays below threshold in µg for duration, up to 2041
+// samples, the device goes to low power at 10 Hz until the threshold is
+// exceeded. INT_INACTIVITY on INT2 is high while it is inactive.
+func (d *Device) ConfigureInactivity(threshold int32, duration time.Duration) error {
+	// the duration is (8 × ACT_DUR + 1) samples
+	return d.writeRegisters(
+		REG_ACTTHS, d.threshold(threshold),
+		REG_ACTDUR, d.samples(duration, 8, 255),
+	)
+}
+
+// threshold returns an acceleration in µg in steps of the threshold
+// registers, which depend on the range.
+func (d *Device) threshold(v int32) uint8 {
+	step := int32(16000)
+	switch d.r {
+	case RANGE_4_G:
+		step = 32000
+	case RANGE_8_G:
+		step = 62000
+	case RANGE_16_G:
+		step = 186000
+	}
+	v = (v + step/2) / step
+	if v < 0 {
+		return 0
+	}
+	if v > 127 {
+		return 127
+	}
+	return uint8(v)
+}
+
+// samples returns a duration in units of per samples at the data rate, up
+// to max.
+func (d *Device) samples(t time.Duration, per, max int64) uint8 {
+	var hz int64
+	switch d.rate {
+	case DATARATE_1_HZ:
+		hz = 1
+	case DATARATE_10_HZ:
+		hz = 10
+	case DATARATE_25_HZ:
+		hz = 25
+	case DATARATE_50_HZ:
+		hz = 50
+	case DATARATE_100_HZ:
+		hz = 100
+	case DATARATE_200_HZ:
+		hz = 200
+	case DATARATE_400_HZ:
+		hz = 400
+	case DATARATE_LOWPOWER_1K6HZ:
+		hz = 1600
+	case DATARATE_LOWPOWER_5KHZ:
+		hz = 1344 // in normal mode
+	}
+	n := (int64(t)*hz/int64(time.Second) + per/2) / per
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return uint8(max)
+	}
+	return uint8(n)
+}
+
+// writeRegisters writes pairs of register and value.
+func (d *Device) writeRegisters(pairs ...uint8) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := d.bus.WriteRegister(uint8(d.Address), pairs[i], pairs[i+1:i+2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
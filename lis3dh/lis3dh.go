@@ -13,6 +13,7 @@ type Device struct {
 	bus     machine.I2C
 	Address uint16
 	r       Range
+	rate    DataRate
 }
 
 // New creates a new LIS3DH connection. The I2C bus must already be configured.
@@ -59,6 +60,9 @@ func (d *Device) SetDataRate(rate DataRate) {
 	ctl1[0] &^= 0xf0
 	ctl1[0] |= (byte(rate) << 4)
 	d.bus.WriteRegister(uint8(d.Address), REG_CTRL1, ctl1)
+
+	// store the new rate
+	d.rate = rate
 }
 
 // SetRange sets the G range for LIS3DH.
@@ -97,6 +101,11 @@ func (d *Device) ReadRange() (r Range) {
 // -1000000.
 func (d *Device) ReadAcceleration() (int32, int32, int32, error) {
 	x, y, z := d.ReadRawAcceleration()
+	return d.convert(x), d.convert(y), d.convert(z), nil
+}
+
+// convert converts a raw value to µg, according to the range.
+func (d *Device) convert(raw int16) int32 {
 	divider := float32(1)
 	switch d.r {
 	case RANGE_16_G:
@@ -108,8 +117,7 @@ func (d *Device) ReadAcceleration() (int32, int32, int32, error) {
 	case RANGE_2_G:
 		divider = 16380
 	}
-
-	return int32(float32(x) / divider * 1000000), int32(float32(y) / divider * 1000000), int32(float32(z) / divider * 1000000), nil
+	return int32(float32(raw) / divider * 1000000)
 }
 
 // ReadRawAcceleration returns the raw x, y and z axis from the LIS3DH
@@ -0,0 +1,216 @@
+package lis3dh_test
+
+import (
+	"machine"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/lis3dh"
+)
+
+// chip simulates the registers of a LIS3DH through the I2C hooks of the
+// machine package. A burst read of the data registers pops samples from
+// fifo, and FIFO_SRC counts them.
+type chip struct {
+	regs  [64]byte
+	fifo  [][6]byte
+	reads []uint8 // registers in the order read
+	burst []int   // lengths of the burst reads of the data registers
+}
+
+func newChip(t *testing.T) (*chip, lis3dh.Device) {
+	c := &chip{}
+	machine.ReadHook = func(addr, reg uint8, buf []byte) error {
+		if addr != lis3dh.Address0 {
+			t.Errorf("read from address %#x", addr)
+		}
+		c.reads = append(c.reads, reg)
+		if reg == lis3dh.REG_OUT_X_L|0x80 {
+			c.burst = append(c.burst, len(buf))
+			for len(buf) > 0 {
+				if len(c.fifo) == 0 {
+					t.Fatal("read past the end of the FIFO")
+				}
+				buf = buf[copy(buf, c.fifo[0][:]):]
+				c.fifo = c.fifo[1:]
+			}
+			c.regs[lis3dh.REG_FIFOSRC] = uint8(len(c.fifo))
+			if len(c.fifo) == 0 {
+				c.regs[lis3dh.REG_FIFOSRC] = 0x20 // EMPTY
+			}
+			return nil
+		}
+		copy(buf, c.regs[reg&0x7F:])
+		return nil
+	}
+	machine.WriteHook = func(addr, reg uint8, buf []byte) error {
+		copy(c.regs[reg&0x7F:], buf)
+		return nil
+	}
+	t.Cleanup(func() { machine.ReadHook, machine.WriteHook = nil, nil })
+	d := lis3dh.New(machine.I2C0)
+	d.SetRange(lis3dh.RANGE_4_G)
+	d.SetDataRate(lis3dh.DATARATE_100_HZ)
+	return c, d
+}
+
+// sample returns the data registers of a raw sample.
+func sample(x, y, z int16) [6]byte {
+	return [6]byte{byte(x), byte(x >> 8), byte(y), byte(y >> 8), byte(z), byte(z >> 8)}
+}
+
+func TestFIFOCount(t *testing.T) {
+	c, d := newChip(t)
+	for _, tc := range []struct {
+		src  uint8
+		want int
+	}{
+		{0x20, 0},         // EMPTY
+		{0x00, 0},         // no sample, and not empty yet
+		{0x80 | 0x0A, 10}, // WTM
+		{0x1F, 31},
+		{0x40 | 0x1F, 32}, // OVRN_FIFO
+	} {
+		c.regs[lis3dh.REG_FIFOSRC] = tc.src
+		if n, err := d.FIFOCount(); n != tc.want || err != nil {
+			t.Errorf("FIFO_SRC %#02x: got %d, %v, want %d", tc.src, n, err, tc.want)
+		}
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(lis3dh.FIFO_STREAM, 16, true); err != nil {
+		t.Fatal(err)
+	}
+	if c.regs[lis3dh.REG_FIFOCTRL] != 0xB0 || c.regs[lis3dh.REG_CTRL5]&0x40 == 0 {
+		t.Errorf("FIFO_CTRL_REG %#02x, CTRL_REG5 %#02x", c.regs[lis3dh.REG_FIFOCTRL], c.regs[lis3dh.REG_CTRL5])
+	}
+
+	for i := int16(0); i < 20; i++ {
+		c.fifo = append(c.fifo, sample(8190, -i, 4095))
+	}
+	c.regs[lis3dh.REG_FIFOSRC] = 20
+	samples := make([][3]int32, 32)
+	n, err := d.ReadFIFO(samples)
+	if n != 20 || err != nil {
+		t.Fatalf("got %d samples, %v, want 20", n, err)
+	}
+	// at most 8 samples of 6 bytes per read
+	if len(c.burst) != 3 || c.burst[0] != 48 || c.burst[1] != 48 || c.burst[2] != 24 {
+		t.Errorf("read bursts of %d bytes, want 48, 48 and 24", c.burst)
+	}
+	for i, s := range samples[:n] {
+		// 8190 per g at ±4 g
+		want := [3]int32{1000000, int32(float32(-i) / 8190 * 1000000), 500000}
+		if s != want {
+			t.Errorf("sample %d: got %v, want %v", i, s, want)
+		}
+	}
+	if n, err := d.ReadFIFO(samples); n != 0 || err != nil {
+		t.Errorf("empty FIFO: got %d, %v", n, err)
+	}
+
+	if err := d.ConfigureFIFO(lis3dh.FIFO_BYPASS, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if c.regs[lis3dh.REG_FIFOCTRL] != 0 || c.regs[lis3dh.REG_CTRL5]&0x40 != 0 {
+		t.Errorf("FIFO_CTRL_REG %#02x, CTRL_REG5 %#02x", c.regs[lis3dh.REG_FIFOCTRL], c.regs[lis3dh.REG_CTRL5])
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	c, d := newChip(t)
+	err := d.ConfigureInterrupts(lis3dh.INT_DOUBLE_TAP|lis3dh.INT_WATERMARK, lis3dh.INT_ACTIVITY|lis3dh.INT_INACTIVITY|lis3dh.INT_OVERRUN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a double tap needs the tap interrupt, and INT_OVERRUN is not
+	// available on INT2
+	if c.regs[lis3dh.REG_CTRL3] != 0x84 || c.regs[lis3dh.REG_CTRL6] != 0x28 || c.regs[lis3dh.REG_CTRL5]&0x0A != 0x0A {
+		t.Errorf("CTRL_REG3 %#02x, CTRL_REG6 %#02x, CTRL_REG5 %#02x", c.regs[lis3dh.REG_CTRL3], c.regs[lis3dh.REG_CTRL6], c.regs[lis3dh.REG_CTRL5])
+	}
+
+	c.regs[lis3dh.REG_INT1SRC] = 0x40
+	c.regs[lis3dh.REG_CLICKSRC] = 0x30
+	c.regs[lis3dh.REG_FIFOSRC] = 0x80 | 16
+	c.regs[lis3dh.REG_STATUS2] = 0x08
+	want := lis3dh.INT_FREE_FALL | lis3dh.INT_TAP | lis3dh.INT_DOUBLE_TAP | lis3dh.INT_WATERMARK | lis3dh.INT_DATA_READY
+	if ints, err := d.ReadInterrupts(); ints != want || err != nil {
+		t.Errorf("got %#02x, %v, want %#02x", ints, err, want)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(d *lis3dh.Device) error
+		regs      map[uint8]uint8
+	}{
+		{"tap", func(d *lis3dh.Device) error {
+			return d.ConfigureTap(lis3dh.TapConfig{
+				Threshold: 500000,
+				Duration:  50 * time.Millisecond,
+				Latency:   100 * time.Millisecond,
+				Window:    300 * time.Millisecond,
+				Axes:      lis3dh.AXIS_X | lis3dh.AXIS_Z,
+			})
+		}, map[uint8]uint8{
+			// 32 mg per step at ±4 g, samples at 100 Hz
+			lis3dh.REG_CLICKCFG:  0x33,
+			lis3dh.REG_CLICKTHS:  0x80 | 16,
+			lis3dh.REG_TIMELIMIT: 5,
+			lis3dh.REG_TIMELATEN: 10,
+			lis3dh.REG_TIMEWINDO: 30,
+		}},
+		{"single tap limits", func(d *lis3dh.Device) error {
+			return d.ConfigureTap(lis3dh.TapConfig{Threshold: 8000000, Duration: 2 * time.Second, Latency: 3 * time.Second, Axes: lis3dh.AXIS_Y})
+		}, map[uint8]uint8{
+			lis3dh.REG_CLICKCFG:  0x04,
+			lis3dh.REG_CLICKTHS:  0x80 | 127,
+			lis3dh.REG_TIMELIMIT: 127,
+			lis3dh.REG_TIMELATEN: 255,
+			lis3dh.REG_TIMEWINDO: 0,
+		}},
+		{"free fall", func(d *lis3dh.Device) error {
+			return d.ConfigureFreeFall(350000, 30*time.Millisecond)
+		}, map[uint8]uint8{
+			lis3dh.REG_INT1CFG: 0x95,
+			lis3dh.REG_INT1THS: 11,
+			lis3dh.REG_INT1DUR: 3,
+		}},
+		{"activity", func(d *lis3dh.Device) error {
+			return d.ConfigureActivity(1000000, 20*time.Millisecond, lis3dh.AXIS_Y)
+		}, map[uint8]uint8{
+			lis3dh.REG_INT2CFG: 0x08,
+			lis3dh.REG_INT2THS: 31,
+			lis3dh.REG_INT2DUR: 2,
+			lis3dh.REG_CTRL2:   0xA8 | 0x02,
+		}},
+		{"inactivity", func(d *lis3dh.Device) error {
+			return d.ConfigureInactivity(100000, 10*time.Second)
+		}, map[uint8]uint8{
+			// 8 samples per step
+			lis3dh.REG_ACTTHS: 3,
+			lis3dh.REG_ACTDUR: 125,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, d := newChip(t)
+			for reg := range tc.regs {
+				c.regs[reg] = 0xA8
+			}
+			if err := tc.configure(&d); err != nil {
+				t.Fatal(err)
+			}
+			for reg, want := range tc.regs {
+				if got := c.regs[reg]; got != want {
+					t.Errorf("register %#02x: got %d, want %d", reg, got, want)
+				}
+			}
+			if tc.name == "activity" && c.reads[len(c.reads)-1] != lis3dh.REG_REFERENCE {
+				t.Error("the high-pass filter was not reset by reading REFERENCE")
+			}
+		})
+	}
+}
@@ -41,6 +41,10 @@ const (
 	REG_INT1SRC   = 0x31
 	REG_INT1THS   = 0x32
 	REG_INT1DUR   = 0x33
+	REG_INT2CFG   = 0x34
+	REG_INT2SRC   = 0x35
+	REG_INT2THS   = 0x36
+	REG_INT2DUR   = 0x37
 	REG_CLICKCFG  = 0x38
 	REG_CLICKSRC  = 0x39
 	REG_CLICKTHS  = 0x3A
@@ -75,3 +79,41 @@ const (
 	DATARATE_LOWPOWER_1K6HZ          = 8
 	DATARATE_LOWPOWER_5KHZ           = 9
 )
+
+// FIFOMode is the mode of the FIFO of 32 samples.
+type FIFOMode uint8
+
+// FIFO modes.
+const (
+	FIFO_BYPASS         FIFOMode = 0 // no FIFO
+	FIFO_FIFO           FIFOMode = 1 // collect samples until full, then stop
+	FIFO_STREAM         FIFOMode = 2 // keep the latest samples, dropping the oldest
+	FIFO_STREAM_TO_FIFO FIFOMode = 3 // stream until a trigger, then collect until full
+)
+
+// Interrupt is a set of interrupts.
+type Interrupt uint8
+
+// Interrupts. INT_DATA_READY, INT_WATERMARK and INT_OVERRUN can only be
+// signaled on INT1, and INT_INACTIVITY only on INT2.
+const (
+	INT_TAP        Interrupt = 0x80
+	INT_FREE_FALL  Interrupt = 0x40
+	INT_ACTIVITY   Interrupt = 0x20
+	INT_DATA_READY Interrupt = 0x10
+	INT_INACTIVITY Interrupt = 0x08
+	INT_WATERMARK  Interrupt = 0x04
+	INT_OVERRUN    Interrupt = 0x02
+	INT_DOUBLE_TAP Interrupt = 0x01
+)
+
+// Axes is a set of axes, for the detection of taps and activity.
+type Axes uint8
+
+// Axes.
+const (
+	AXIS_X   Axes = 0x01
+	AXIS_Y   Axes = 0x02
+	AXIS_Z   Axes = 0x04
+	AXIS_ALL Axes = AXIS_X | AXIS_Y | AXIS_Z
+)
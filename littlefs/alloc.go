@@ -0,0 +1,117 @@
+package littlefs
+
+// allocator hands out free blocks. Blocks are free unless they are
+// reachable from the metadata or an open file, so a bitmap of used blocks
+// is built by traversing the filesystem whenever it runs out. Blocks
+// allocated since the last acknowledgement may not be reachable yet and are
+// kept as well.
+type allocator struct {
+	used     []uint32
+	inflight []uint32
+	count    uint32
+	next     uint32
+	valid    bool
+}
+
+func (a *allocator) init(count, seed uint32) {
+	words := (count + 31) / 32
+	a.used = make([]uint32, words)
+	a.inflight = make([]uint32, words)
+	a.count = count
+	a.next = seed % count
+	a.valid = false
+}
+
+func (a *allocator) mark(b uint32) {
+	if b < a.count {
+		a.used[b/32] |= 1 << (b % 32)
+	}
+}
+
+// ack marks the blocks allocated so far as reachable.
+func (a *allocator) ack() {
+	for i := range a.inflight {
+		a.inflight[i] = 0
+	}
+}
+
+// alloc returns a free block, starting where the last allocation left off
+// so that writes are spread over the whole device.
+func (a *allocator) alloc(fs *FS) (uint32, error) {
+	for pass := 0; pass < 2; pass++ {
+		if !a.valid {
+			if err := a.rebuild(fs); err != nil {
+				return 0, err
+			}
+		}
+		for i := uint32(0); i < a.count; i++ {
+			b := a.next
+			if a.next++; a.next == a.count {
+				a.next = 0
+			}
+			if a.used[b/32]&(1<<(b%32)) == 0 {
+				a.used[b/32] |= 1 << (b % 32)
+				a.inflight[b/32] |= 1 << (b % 32)
+				return b, nil
+			}
+		}
+		a.valid = false
+	}
+	return 0, ErrNoSpace
+}
+
+// rebuild marks the blocks in use.
+func (a *allocator) rebuild(fs *FS) error {
+	copy(a.used, a.inflight)
+	if err := fs.traverse(func(b uint32) error {
+		a.mark(b)
+		return nil
+	}); err != nil {
+		return err
+	}
+	a.valid = true
+	return nil
+}
+
+// traverse calls fn for every block in use: all metadata pairs, the blocks
+// of all files and those written by open files.
+func (fs *FS) traverse(fn func(block uint32) error) error {
+	tail := [2]uint32{0, 1}
+	for n := uint32(0); !pairIsNull(tail); n++ {
+		if n > fs.blockCount {
+			return ErrCorrupt
+		}
+		for _, b := range tail {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		m, err := fs.fetch(tail)
+		if err != nil {
+			return err
+		}
+		for i := range m.entries {
+			e := &m.entries[i]
+			if e.stype == typeCTZStruct && len(e.sdata) >= 8 {
+				c := pairFrom(e.sdata)
+				if err := fs.ctzTraverse(c[0], c[1], fn); err != nil {
+					return err
+				}
+			}
+		}
+		tail = m.tail
+	}
+	for _, f := range fs.files {
+		if !f.inline {
+			if err := fs.ctzTraverse(f.head, f.size, fn); err != nil {
+				return err
+			}
+		}
+		if f.writing {
+			if err := fs.ctzTraverse(f.block, f.pos, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package littlefs
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Files that don't fit in their metadata entry are stored in a backwards
+// CTZ skip-list: block n of a file starts with ctz(n)+1 pointers to blocks
+// n-1, n-2, n-4, ... and is followed by data. This allows appending and
+// random access in O(log n) reads, without ever modifying a written block.
+
+// ctzIndex returns the index of the block holding file offset off, and
+// the offset within that block.
+func (fs *FS) ctzIndex(off uint32) (index, boff uint32) {
+	b := fs.blockSize - 2*4
+	i := off / b
+	if i == 0 {
+		return 0, off
+	}
+	i = (off - 4*(uint32(bits.OnesCount32(i-1))+2)) / b
+	return i, off - b*i - 4*uint32(bits.OnesCount32(i))
+}
+
+// ctzFind returns the block and block offset of file offset pos, in the
+// file of size bytes whose last block is head.
+func (fs *FS) ctzFind(head, size, pos uint32) (uint32, uint32, error) {
+	if size == 0 {
+		return blockNull, 0, nil
+	}
+	current, _ := fs.ctzIndex(size - 1)
+	target, off := fs.ctzIndex(pos)
+	for current > target {
+		skip := uint32(31 - bits.LeadingZeros32(current-target))
+		if tz := uint32(bits.TrailingZeros32(current)); tz < skip {
+			skip = tz
+		}
+		var err error
+		if head, err = fs.readU32(head, 4*skip); err != nil {
+			return 0, 0, err
+		}
+		current -= 1 << skip
+	}
+	return head, off, nil
+}
+
+// ctzExtend allocates the block following file offset size, in the file
+// whose last block is head. An incomplete last block is copied instead, as
+// written blocks can't be appended to. It returns the new block and the
+// offset to continue writing at.
+func (fs *FS) ctzExtend(head, size uint32) (uint32, uint32, error) {
+	nblock, err := fs.alloc.alloc(fs)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := fs.erase(nblock); err != nil {
+		return 0, 0, err
+	}
+	if size == 0 {
+		return nblock, 0, nil
+	}
+
+	index, noff := fs.ctzIndex(size - 1)
+	noff++
+	if noff != fs.blockSize {
+		buf := make([]byte, noff)
+		if err := fs.read(head, 0, buf); err != nil {
+			return 0, 0, err
+		}
+		if err := fs.prog(nblock, 0, buf); err != nil {
+			return 0, 0, err
+		}
+		return nblock, noff, nil
+	}
+
+	// append a block with its skip pointers
+	index++
+	skips := uint32(bits.TrailingZeros32(index)) + 1
+	ptrs := make([]byte, 4*skips)
+	for i := uint32(0); i < skips; i++ {
+		binary.LittleEndian.PutUint32(ptrs[4*i:], head)
+		if i != skips-1 {
+			if head, err = fs.readU32(head, 4*i); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if err := fs.prog(nblock, 0, ptrs); err != nil {
+		return 0, 0, err
+	}
+	return nblock, 4 * skips, nil
+}
+
+// ctzTraverse calls fn for every block of a file.
+func (fs *FS) ctzTraverse(head, size uint32, fn func(uint32) error) error {
+	if size == 0 {
+		return nil
+	}
+	index, _ := fs.ctzIndex(size - 1)
+	for {
+		if err := fn(head); err != nil {
+			return err
+		}
+		if index == 0 {
+			return nil
+		}
+		var err error
+		if head, err = fs.readU32(head, 0); err != nil {
+			return err
+		}
+		index--
+	}
+}
@@ -0,0 +1,524 @@
+package littlefs
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// FileInfo describes a file and implements os.FileInfo.
+type FileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+// Name returns the base name of the file.
+func (fi *FileInfo) Name() string { return fi.name }
+
+// Size returns the length of the file in bytes.
+func (fi *FileInfo) Size() int64 { return fi.size }
+
+// Mode returns the file mode bits. littlefs doesn't store permissions.
+func (fi *FileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0777
+	}
+	return 0666
+}
+
+// ModTime returns the zero time, littlefs doesn't store timestamps.
+func (fi *FileInfo) ModTime() time.Time { return time.Time{} }
+
+// IsDir reports whether the file is a directory.
+func (fi *FileInfo) IsDir() bool { return fi.isDir }
+
+// Sys returns nil.
+func (fi *FileInfo) Sys() interface{} { return nil }
+
+func (e *mentry) info() *FileInfo {
+	fi := &FileInfo{name: string(e.name), isDir: e.typ == typeDir}
+	switch e.stype {
+	case typeInlineStruct:
+		fi.size = int64(len(e.sdata))
+	case typeCTZStruct:
+		if len(e.sdata) >= 8 {
+			fi.size = int64(pairFrom(e.sdata)[1])
+		}
+	}
+	return fi
+}
+
+var rootPair = [2]uint32{0, 1}
+
+// lookup is the result of resolving a path.
+type lookup struct {
+	m      *mdir // pair holding the entry, or where to insert it
+	id     int
+	found  bool
+	isRoot bool
+	name   string
+}
+
+func (l *lookup) entry() *mentry {
+	return &l.m.entries[l.id]
+}
+
+// cleanPath splits a path into its elements.
+func cleanPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// resolve looks up a path. If only the last element is missing, the
+// lookup tells where to create it.
+func (fs *FS) resolve(name string) (*lookup, error) {
+	if !fs.mounted {
+		return nil, ErrNotMounted
+	}
+	elems := cleanPath(name)
+	if len(elems) == 0 {
+		m, err := fs.fetch(rootPair)
+		if err != nil {
+			return nil, err
+		}
+		return &lookup{m: m, found: true, isRoot: true, name: "/"}, nil
+	}
+	dir := rootPair
+	for i, elem := range elems {
+		l, err := fs.find(dir, elem)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(elems)-1 {
+			return l, nil
+		}
+		if !l.found {
+			return nil, ErrNotExist
+		}
+		e := l.entry()
+		if e.typ != typeDir || len(e.sdata) < 8 {
+			return nil, ErrNotDir
+		}
+		dir = pairFrom(e.sdata)
+	}
+	panic("unreachable")
+}
+
+// find looks up name in the directory starting at pair. Entries are kept
+// sorted within each metadata pair, so a missing name is inserted before
+// the first greater name, or at the end of the directory.
+func (fs *FS) find(pair [2]uint32, name string) (*lookup, error) {
+	key := []byte(name)
+	for n := uint32(0); ; n++ {
+		if n > fs.blockCount {
+			return nil, ErrCorrupt
+		}
+		m, err := fs.fetch(pair)
+		if err != nil {
+			return nil, err
+		}
+		insert := -1
+		for id := range m.entries {
+			if !fs.visible(m, id) {
+				continue
+			}
+			switch c := bytes.Compare(m.entries[id].name, key); {
+			case c == 0:
+				return &lookup{m: m, id: id, found: true, name: name}, nil
+			case c > 0 && insert < 0:
+				insert = id
+			}
+		}
+		if insert >= 0 || !m.split {
+			if insert < 0 {
+				insert = len(m.entries)
+			}
+			return &lookup{m: m, id: insert, name: name}, nil
+		}
+		pair = m.tail
+	}
+}
+
+// checkName validates the name of a new entry.
+func (fs *FS) checkName(name string) error {
+	if name == "" || name == "." || name == ".." || uint32(len(name)) > fs.nameMax {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// Stat returns information about the named file or directory.
+func (fs *FS) Stat(name string) (*FileInfo, error) {
+	l, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if l.isRoot {
+		return &FileInfo{name: "/", isDir: true}, nil
+	}
+	if !l.found {
+		return nil, ErrNotExist
+	}
+	return l.entry().info(), nil
+}
+
+// ReadDir returns the entries of the named directory, without "." and "..".
+func (fs *FS) ReadDir(name string) ([]*FileInfo, error) {
+	l, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if !l.found {
+		return nil, ErrNotExist
+	}
+	pair := rootPair
+	if !l.isRoot {
+		e := l.entry()
+		if e.typ != typeDir || len(e.sdata) < 8 {
+			return nil, ErrNotDir
+		}
+		pair = pairFrom(e.sdata)
+	}
+	var list []*FileInfo
+	for n := uint32(0); ; n++ {
+		if n > fs.blockCount {
+			return nil, ErrCorrupt
+		}
+		m, err := fs.fetch(pair)
+		if err != nil {
+			return nil, err
+		}
+		for id := range m.entries {
+			if fs.visible(m, id) {
+				list = append(list, m.entries[id].info())
+			}
+		}
+		if !m.split {
+			return list, nil
+		}
+		pair = m.tail
+	}
+}
+
+// Mkdir creates a directory.
+func (fs *FS) Mkdir(name string) error {
+	if err := fs.consistent(); err != nil {
+		return err
+	}
+	l, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if l.found {
+		return ErrExist
+	}
+	if err := fs.checkName(l.name); err != nil {
+		return err
+	}
+	fs.alloc.ack()
+
+	// the new directory is linked into the list of all metadata pairs
+	// after the last pair of its parent
+	cwd := l.m
+	pred := cwd
+	for pred.split {
+		if pred, err = fs.fetch(pred.tail); err != nil {
+			return err
+		}
+	}
+	dir, err := fs.allocPair()
+	if err != nil {
+		return err
+	}
+	dir.tail = pred.tail
+	if err := fs.compact(dir); err != nil {
+		return err
+	}
+	if pred != cwd {
+		// the directory is an orphan until its entry is committed
+		fs.prepOrphans(+1)
+		if err := fs.commit(pred, attr{mktag(typeSoftTail, 0x3ff, 8), pairData(dir.pair)}); err != nil {
+			return err
+		}
+		fs.prepOrphans(-1)
+	}
+
+	id := uint32(l.id)
+	attrs := []attr{
+		{mktag(typeCreate, id, 0), nil},
+		{mktag(typeDir, id, uint32(len(l.name))), []byte(l.name)},
+		{mktag(typeDirStruct, id, 8), pairData(dir.pair)},
+	}
+	if !cwd.split {
+		attrs = append(attrs, attr{mktag(typeSoftTail, 0x3ff, 8), pairData(dir.pair)})
+	}
+	return fs.commit(cwd, attrs...)
+}
+
+// Remove removes a file or an empty directory.
+func (fs *FS) Remove(name string) error {
+	if err := fs.consistent(); err != nil {
+		return err
+	}
+	l, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if l.isRoot {
+		return ErrInvalidName
+	}
+	if !l.found {
+		return ErrNotExist
+	}
+	fs.alloc.ack()
+	var dir *mdir
+	if e := l.entry(); e.typ == typeDir {
+		if dir, err = fs.fetch(pairFrom(e.sdata)); err != nil {
+			return err
+		}
+		if len(dir.entries) > 0 || dir.split {
+			return ErrNotEmpty
+		}
+		// the pair is an orphan until it is dropped from the list
+		fs.prepOrphans(+1)
+	}
+	if err := fs.commit(l.m, attr{mktag(typeDelete, uint32(l.id), 0), nil}); err != nil {
+		return err
+	}
+	if dir != nil {
+		fs.prepOrphans(-1)
+		return fs.dropDir(dir)
+	}
+	return nil
+}
+
+// Rename renames a file or directory, replacing a file or empty directory
+// of the new name.
+func (fs *FS) Rename(oldname, newname string) error {
+	if err := fs.consistent(); err != nil {
+		return err
+	}
+	ol, err := fs.resolve(oldname)
+	if err != nil {
+		return err
+	}
+	if ol.isRoot {
+		return ErrInvalidName
+	}
+	if !ol.found {
+		return ErrNotExist
+	}
+	oe := *ol.entry()
+	if oe.typ == typeDir {
+		oldp, newp := path.Clean("/"+oldname), path.Clean("/"+newname)
+		if strings.HasPrefix(newp, oldp+"/") {
+			return ErrInvalidName
+		}
+	}
+	nl, err := fs.resolve(newname)
+	if err != nil {
+		return err
+	}
+	if nl.isRoot {
+		return ErrExist
+	}
+	if err := fs.checkName(nl.name); err != nil {
+		return err
+	}
+	fs.alloc.ack()
+
+	samePair := pairOverlaps(ol.m.pair, nl.m.pair)
+	oldID, newID := uint32(ol.id), uint32(nl.id)
+	var prev *mdir
+	if !nl.found {
+		if samePair && newID <= oldID {
+			oldID++
+		}
+	} else {
+		pe := nl.entry()
+		switch {
+		case pe.typ != oe.typ && pe.typ == typeDir:
+			return ErrIsDir
+		case pe.typ != oe.typ:
+			return ErrNotDir
+		case samePair && newID == oldID:
+			return nil
+		case pe.typ == typeDir:
+			if prev, err = fs.fetch(pairFrom(pe.sdata)); err != nil {
+				return err
+			}
+			if len(prev.entries) > 0 || prev.split {
+				return ErrNotEmpty
+			}
+			fs.prepOrphans(+1)
+		}
+	}
+
+	// a move between pairs takes two commits; the pending move in the
+	// global state hides the old entry in between
+	if !samePair {
+		fs.prepMove(uint32(ol.id), ol.m.pair)
+	}
+	var attrs []attr
+	if nl.found {
+		attrs = append(attrs, attr{mktag(typeDelete, newID, 0), nil})
+	}
+	attrs = append(attrs,
+		attr{mktag(typeCreate, newID, 0), nil},
+		attr{mktag(oe.typ, newID, uint32(len(nl.name))), []byte(nl.name)})
+	attrs = append(attrs, oe.tags(newID)[1:]...)
+	if samePair {
+		attrs = append(attrs, attr{mktag(typeDelete, oldID, 0), nil})
+	}
+	if err := fs.commit(nl.m, attrs...); err != nil {
+		return err
+	}
+	if !samePair {
+		fs.prepMove(0x3ff, [2]uint32{})
+		om, err := fs.fetch(ol.m.pair)
+		if err != nil {
+			return err
+		}
+		if err := fs.commit(om, attr{mktag(typeDelete, uint32(ol.id), 0), nil}); err != nil {
+			return err
+		}
+	}
+	fs.renameOpen(path.Clean("/"+oldname), path.Clean("/"+newname))
+	if prev != nil {
+		fs.prepOrphans(-1)
+		return fs.dropDir(prev)
+	}
+	return nil
+}
+
+// pred returns the metadata pair whose tail is pair.
+func (fs *FS) pred(pair [2]uint32) (*mdir, error) {
+	tail := rootPair
+	for n := uint32(0); !pairIsNull(tail); n++ {
+		if n > fs.blockCount {
+			return nil, ErrCorrupt
+		}
+		m, err := fs.fetch(tail)
+		if err != nil {
+			return nil, err
+		}
+		if pairOverlaps(m.tail, pair) {
+			return m, nil
+		}
+		tail = m.tail
+	}
+	return nil, ErrNotExist
+}
+
+// dropDir removes the pair of a deleted directory from the list of
+// metadata pairs. Its predecessor takes over its share of the global
+// state.
+func (fs *FS) dropDir(dir *mdir) error {
+	pred, err := fs.pred(dir.pair)
+	if err != nil {
+		return err
+	}
+	return fs.drop(pred, dir)
+}
+
+func (fs *FS) drop(pred, m *mdir) error {
+	fs.gdelta = fs.gdelta.xor(m.ms)
+	typ := uint32(typeSoftTail)
+	if m.split {
+		typ = typeHardTail
+	}
+	return fs.commit(pred, attr{mktag(typ, 0x3ff, 8), pairData(m.tail)})
+}
+
+// consistent finishes operations interrupted by power loss: a pending move
+// between metadata pairs is completed, and orphaned directories are removed
+// from the list of metadata pairs.
+func (fs *FS) consistent() error {
+	if !fs.mounted {
+		return ErrNotMounted
+	}
+	if fs.gdisk.hasMove() {
+		m, err := fs.fetch(fs.gdisk.pair)
+		if err != nil {
+			return err
+		}
+		id := tagID(fs.gdisk.tag)
+		fs.prepMove(0x3ff, [2]uint32{})
+		if err := fs.commit(m, attr{mktag(typeDelete, id, 0), nil}); err != nil {
+			return err
+		}
+	}
+	if fs.gstate.orphans() == 0 {
+		return nil
+	}
+
+	pred, err := fs.fetch(rootPair)
+	if err != nil {
+		return err
+	}
+	for n := uint32(0); !pairIsNull(pred.tail); n++ {
+		if n > fs.blockCount {
+			return ErrCorrupt
+		}
+		m, err := fs.fetch(pred.tail)
+		if err != nil {
+			return err
+		}
+		if !pred.split {
+			parent, found, err := fs.parentOf(m.pair)
+			if err != nil {
+				return err
+			}
+			if !found {
+				if err := fs.drop(pred, m); err != nil {
+					return err
+				}
+				continue
+			}
+			if !pairSync(parent, m.pair) {
+				// the directory was moved to a new pair
+				if err := fs.commit(pred, attr{mktag(typeSoftTail, 0x3ff, 8), pairData(parent)}); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		pred = m
+	}
+	fs.prepOrphans(-int(fs.gstate.orphans()))
+	root, err := fs.fetch(rootPair)
+	if err != nil {
+		return err
+	}
+	return fs.commit(root)
+}
+
+// parentOf looks for the directory entry referencing pair.
+func (fs *FS) parentOf(pair [2]uint32) ([2]uint32, bool, error) {
+	tail := rootPair
+	for n := uint32(0); !pairIsNull(tail); n++ {
+		if n > fs.blockCount {
+			return tail, false, ErrCorrupt
+		}
+		m, err := fs.fetch(tail)
+		if err != nil {
+			return tail, false, err
+		}
+		for i := range m.entries {
+			e := &m.entries[i]
+			if e.typ == typeDir && e.stype == typeDirStruct && len(e.sdata) >= 8 {
+				if p := pairFrom(e.sdata); pairOverlaps(p, pair) {
+					return p, true, nil
+				}
+			}
+		}
+		tail = m.tail
+	}
+	return tail, false, nil
+}
@@ -0,0 +1,478 @@
+package littlefs
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// File is an open file of a FS.
+//
+// Writes are copy-on-write: they go to newly allocated blocks and only
+// become visible to other readers, and after power loss, when the file is
+// synced or closed.
+type File struct {
+	fs   *FS
+	name string // absolute path
+	flag int
+	pos  uint32
+
+	// contents as of the last flush: inline data or a skip-list
+	inline bool
+	buf    []byte
+	head   uint32
+	size   uint32
+
+	// while writing, the new skip-list ends in block, with pos bytes
+	// written so far
+	writing bool
+	block   uint32
+	off     uint32
+
+	dirty  bool // the metadata entry needs to be written
+	closed bool
+}
+
+// Open opens the named file with the given os.O_* flags, such as
+// os.O_RDONLY or os.O_WRONLY|os.O_CREATE|os.O_TRUNC. Directories can't be
+// opened; use ReadDir instead.
+func (fs *FS) Open(name string, flag int) (*File, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if writable || flag&os.O_CREATE != 0 {
+		if err := fs.consistent(); err != nil {
+			return nil, err
+		}
+	}
+	l, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if l.isRoot || l.found && l.entry().typ == typeDir {
+		return nil, ErrIsDir
+	}
+	f := &File{fs: fs, name: path.Clean("/" + name), flag: flag, inline: true}
+	if l.found {
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, ErrExist
+		}
+		e := l.entry()
+		switch e.stype {
+		case typeInlineStruct:
+			f.buf = append([]byte(nil), e.sdata...)
+		case typeCTZStruct:
+			if len(e.sdata) < 8 {
+				return nil, ErrCorrupt
+			}
+			c := pairFrom(e.sdata)
+			f.inline, f.head, f.size = false, c[0], c[1]
+		}
+	} else {
+		if flag&os.O_CREATE == 0 {
+			return nil, ErrNotExist
+		}
+		if err := fs.checkName(l.name); err != nil {
+			return nil, err
+		}
+		fs.alloc.ack()
+		id := uint32(l.id)
+		if err := fs.commit(l.m,
+			attr{mktag(typeCreate, id, 0), nil},
+			attr{mktag(typeReg, id, uint32(len(l.name))), []byte(l.name)},
+			attr{mktag(typeInlineStruct, id, 0), nil}); err != nil {
+			return nil, err
+		}
+	}
+	if writable && flag&os.O_TRUNC != 0 && f.fileSize() > 0 {
+		f.truncateEmpty()
+	}
+	fs.files = append(fs.files, f)
+	return f, nil
+}
+
+// Create creates or truncates the named file and opens it for reading and
+// writing.
+func (fs *FS) Create(name string) (*File, error) {
+	return fs.Open(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// renameOpen updates the names of open files after a rename.
+func (fs *FS) renameOpen(oldname, newname string) {
+	for _, f := range fs.files {
+		if f.name == oldname {
+			f.name = newname
+		} else if strings.HasPrefix(f.name, oldname+"/") {
+			f.name = newname + f.name[len(oldname):]
+		}
+	}
+}
+
+// Name returns the name of the file as passed to Open, without directory.
+func (f *File) Name() string {
+	return path.Base(f.name)
+}
+
+// Stat returns information about the file.
+func (f *File) Stat() (*FileInfo, error) {
+	if f.closed {
+		return nil, ErrClosed
+	}
+	return &FileInfo{name: f.Name(), size: int64(f.fileSize())}, nil
+}
+
+func (f *File) fileSize() uint32 {
+	if f.inline {
+		return uint32(len(f.buf))
+	}
+	if f.writing && f.pos > f.size {
+		return f.pos
+	}
+	return f.size
+}
+
+func (f *File) truncateEmpty() {
+	f.inline, f.buf, f.head, f.size = true, nil, 0, 0
+	f.dirty = true
+}
+
+// Read reads up to len(p) bytes from the current position.
+func (f *File) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	n, err := f.ReadAt(p, int64(f.pos))
+	f.pos += uint32(n)
+	return n, err
+}
+
+// ReadAt reads len(p) bytes starting at offset off.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == os.O_WRONLY {
+		return 0, ErrWriteOnly
+	}
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	if err := f.flush(); err != nil {
+		return 0, err
+	}
+	size := int64(f.fileSize())
+	if off >= size {
+		return 0, io.EOF
+	}
+	if rest := size - off; int64(len(p)) > rest {
+		p = p[:rest]
+		err = io.EOF
+	}
+	if f.inline {
+		return copy(p, f.buf[off:]), err
+	}
+	for n < len(p) {
+		pos := uint32(off) + uint32(n)
+		block, boff, rerr := f.fs.ctzFind(f.head, f.size, pos)
+		if rerr != nil {
+			return n, rerr
+		}
+		chunk := min32(uint32(len(p)-n), f.fs.blockSize-boff)
+		if rerr := f.fs.read(block, boff, p[n:n+int(chunk)]); rerr != nil {
+			return n, rerr
+		}
+		n += int(chunk)
+	}
+	return n, err
+}
+
+// Write writes len(p) bytes at the current position, or at the end of the
+// file if it was opened with os.O_APPEND.
+func (f *File) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, ErrReadOnly
+	}
+	if f.flag&os.O_APPEND != 0 {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+		f.pos = f.fileSize()
+	}
+	if uint64(f.pos)+uint64(len(p)) > uint64(f.fs.fileMax) {
+		return 0, ErrFileTooLarge
+	}
+	f.fs.alloc.ack()
+	if size := f.fileSize(); !f.writing && f.pos > size {
+		// fill the gap with zeros
+		end := f.pos
+		f.pos = size
+		if err := f.writeZeros(end - size); err != nil {
+			return 0, err
+		}
+	}
+	f.dirty = true
+	if err := f.write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteAt writes len(p) bytes at offset off. The file position is not
+// changed.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(f.fs.fileMax) {
+		return 0, ErrInvalidSeek
+	}
+	if f.flag&os.O_APPEND != 0 {
+		return 0, ErrInvalidSeek
+	}
+	pos := f.pos
+	if uint32(off) != pos {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+		f.pos = uint32(off)
+	}
+	n, err := f.Write(p)
+	if ferr := f.flush(); err == nil {
+		err = ferr
+	}
+	f.pos = pos
+	return n, err
+}
+
+func (f *File) writeZeros(n uint32) error {
+	var zero [64]byte
+	for n > 0 {
+		chunk := min32(n, uint32(len(zero)))
+		if err := f.write(zero[:chunk]); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// write writes p at the current position, inline while the file is small
+// and to a new skip-list otherwise.
+func (f *File) write(p []byte) error {
+	if f.inline {
+		if end := f.pos + uint32(len(p)); end <= f.fs.inlineMax {
+			if end > uint32(len(f.buf)) {
+				f.buf = append(f.buf, make([]byte, end-uint32(len(f.buf)))...)
+			}
+			copy(f.buf[f.pos:], p)
+			f.pos = end
+			return nil
+		}
+		if err := f.outline(); err != nil {
+			return err
+		}
+	}
+	fs := f.fs
+	for len(p) > 0 {
+		if !f.writing {
+			// branch off the old skip-list at the current position
+			var err error
+			head := uint32(0)
+			if f.pos > 0 {
+				if head, _, err = fs.ctzFind(f.head, f.size, f.pos-1); err != nil {
+					return err
+				}
+			}
+			if f.block, f.off, err = fs.ctzExtend(head, f.pos); err != nil {
+				return err
+			}
+			f.writing = true
+		}
+		if f.off == fs.blockSize {
+			var err error
+			if f.block, f.off, err = fs.ctzExtend(f.block, f.pos); err != nil {
+				return err
+			}
+		}
+		n := min32(uint32(len(p)), fs.blockSize-f.off)
+		if err := fs.prog(f.block, f.off, p[:n]); err != nil {
+			return err
+		}
+		f.off += n
+		f.pos += n
+		p = p[n:]
+	}
+	return nil
+}
+
+// outline moves inline data to a skip-list.
+func (f *File) outline() error {
+	data, pos := f.buf, f.pos
+	f.inline, f.buf, f.head, f.size = false, nil, 0, 0
+	f.pos = 0
+	if err := f.write(data); err != nil {
+		return err
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	f.pos = pos
+	return nil
+}
+
+// flush copies the rest of the old contents behind the data written, and
+// makes the new skip-list the contents of the file.
+func (f *File) flush() error {
+	if !f.writing {
+		return nil
+	}
+	pos := f.pos
+	buf := make([]byte, 256)
+	for f.pos < f.size {
+		block, boff, err := f.fs.ctzFind(f.head, f.size, f.pos)
+		if err != nil {
+			return err
+		}
+		n := min32(min32(f.size-f.pos, f.fs.blockSize-boff), uint32(len(buf)))
+		if err := f.fs.read(block, boff, buf[:n]); err != nil {
+			return err
+		}
+		if err := f.write(buf[:n]); err != nil {
+			return err
+		}
+	}
+	f.head, f.size = f.block, f.pos
+	f.writing = false
+	f.pos = pos
+	return nil
+}
+
+// Seek sets the position for the next Read or Write.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, ErrClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(f.pos)
+	case io.SeekEnd:
+		offset += int64(f.fileSize())
+	}
+	if offset < 0 || offset > int64(f.fs.fileMax) {
+		return 0, ErrInvalidSeek
+	}
+	if uint32(offset) != f.pos {
+		if err := f.flush(); err != nil {
+			return 0, err
+		}
+		f.pos = uint32(offset)
+	}
+	return offset, nil
+}
+
+// Truncate changes the size of the file. The position is not changed.
+func (f *File) Truncate(size int64) error {
+	if f.closed {
+		return ErrClosed
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return ErrReadOnly
+	}
+	if size < 0 || size > int64(f.fs.fileMax) {
+		return ErrInvalidSeek
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	f.fs.alloc.ack()
+	n, cur := uint32(size), f.fileSize()
+	switch {
+	case n == cur:
+		return nil
+	case n == 0:
+		f.truncateEmpty()
+	case n < cur && f.inline:
+		f.buf = f.buf[:n]
+	case n < cur:
+		// the skip-list only points backwards, so it can be cut anywhere
+		head, _, err := f.fs.ctzFind(f.head, f.size, n-1)
+		if err != nil {
+			return err
+		}
+		f.head, f.size = head, n
+	default:
+		pos := f.pos
+		f.pos = cur
+		if err := f.writeZeros(n - cur); err != nil {
+			return err
+		}
+		if err := f.flush(); err != nil {
+			return err
+		}
+		f.pos = pos
+	}
+	f.dirty = true
+	return nil
+}
+
+// Sync commits the contents of the file to the filesystem.
+func (f *File) Sync() error {
+	if f.closed {
+		return ErrClosed
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if !f.dirty {
+		return nil
+	}
+	fs := f.fs
+	if err := fs.consistent(); err != nil {
+		return err
+	}
+	l, err := fs.resolve(f.name)
+	if err != nil {
+		return err
+	}
+	if !l.found {
+		return ErrNotExist
+	}
+	fs.alloc.ack()
+	id := uint32(l.id)
+	var a attr
+	if f.inline {
+		a = attr{mktag(typeInlineStruct, id, uint32(len(f.buf))), f.buf}
+	} else {
+		ctz := make([]byte, 8)
+		binary.LittleEndian.PutUint32(ctz, f.head)
+		binary.LittleEndian.PutUint32(ctz[4:], f.size)
+		a = attr{mktag(typeCTZStruct, id, 8), ctz}
+	}
+	if err := fs.commit(l.m, a); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+// Close syncs and closes the file.
+func (f *File) Close() error {
+	if f.closed {
+		return ErrClosed
+	}
+	var err error
+	if f.flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		err = f.Sync()
+	}
+	f.closed = true
+	for i, o := range f.fs.files {
+		if o == f {
+			f.fs.files = append(f.fs.files[:i], f.fs.files[i+1:]...)
+			break
+		}
+	}
+	return err
+}
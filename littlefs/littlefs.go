@@ -0,0 +1,424 @@
+// Package littlefs implements the littlefs v2 filesystem on top of a block
+// device such as flash.Device.
+//
+// littlefs is designed for flash memory: metadata is stored in logs that
+// are appended to and compacted in pairs of erase blocks, file data is
+// written copy-on-write, and blocks are allocated round-robin starting at a
+// pseudorandom block, so that the filesystem survives power loss at any
+// point and spreads wear over the whole device. The on-disk format is
+// compatible with version 2.0 and 2.1 of the reference implementation
+// (https://github.com/littlefs-project/littlefs), so images can be created
+// and inspected with its tools.
+//
+//	fs := &littlefs.FS{}
+//	if err := fs.Mount(dev); err != nil {
+//		if err := littlefs.Format(dev, nil); err != nil {
+//			return err
+//		}
+//		...
+//	}
+//	f, err := fs.Open("/config.txt", os.O_RDWR|os.O_CREATE)
+package littlefs // import "tinygo.org/x/drivers/littlefs"
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"tinygo.org/x/drivers"
+)
+
+var (
+	ErrNotLittleFS  = errors.New("littlefs: no littlefs filesystem found")
+	ErrVersion      = errors.New("littlefs: unsupported on-disk version")
+	ErrGeometry     = errors.New("littlefs: block size does not match the device")
+	ErrNotMounted   = errors.New("littlefs: not mounted")
+	ErrNotExist     = errors.New("littlefs: file does not exist")
+	ErrExist        = errors.New("littlefs: file already exists")
+	ErrIsDir        = errors.New("littlefs: is a directory")
+	ErrNotDir       = errors.New("littlefs: not a directory")
+	ErrNotEmpty     = errors.New("littlefs: directory not empty")
+	ErrInvalidName  = errors.New("littlefs: invalid file name")
+	ErrNoSpace      = errors.New("littlefs: no space left on device")
+	ErrReadOnly     = errors.New("littlefs: file not open for writing")
+	ErrWriteOnly    = errors.New("littlefs: file not open for reading")
+	ErrClosed       = errors.New("littlefs: file already closed")
+	ErrInvalidSeek  = errors.New("littlefs: invalid seek offset")
+	ErrFileTooLarge = errors.New("littlefs: file too large")
+	ErrCorrupt      = errors.New("littlefs: filesystem corrupt")
+)
+
+const (
+	// disk version written by this package; 2.1 is read as well
+	diskVersion = 0x00020000
+
+	defaultNameMax = 255
+	defaultFileMax = 2147483647
+	defaultAttrMax = 1022
+
+	blockNull = 0xFFFFFFFF
+)
+
+// Config holds the geometry of a filesystem. Zero fields are taken from the
+// device: the program size from WriteBlockSize, the block size from
+// EraseBlockSize and the block count from Size.
+type Config struct {
+	// ProgSize is the minimum size of a write. Commits are padded to it.
+	ProgSize int64
+
+	// BlockSize is the size of an erase unit, a multiple of the device's
+	// erase block size.
+	BlockSize int64
+
+	// BlockCount is the number of blocks of the filesystem.
+	BlockCount int64
+}
+
+// FS is a mounted littlefs filesystem.
+type FS struct {
+	// Config overrides the geometry taken from the device. It must be set
+	// before Mount.
+	Config Config
+
+	dev        drivers.BlockDevice
+	progSize   uint32
+	blockSize  uint32
+	blockCount uint32
+	eraseSize  int64
+	nameMax    uint32
+	fileMax    uint32
+	attrMax    uint32
+	inlineMax  uint32
+
+	// global state: on disk, in memory, and state taken over from
+	// metadata pairs dropped from the list
+	gdisk  gstate
+	gstate gstate
+	gdelta gstate
+
+	alloc allocator
+	seed  uint32
+	files []*File
+	buf   []byte // one block, used while fetching metadata pairs
+
+	mounted bool
+}
+
+// gstate is the global state, which is spread over the metadata pairs and
+// combined with XOR. It records a pending move and the number of orphaned
+// metadata pairs.
+type gstate struct {
+	tag  uint32
+	pair [2]uint32
+}
+
+func (g gstate) xor(o gstate) gstate {
+	return gstate{g.tag ^ o.tag, [2]uint32{g.pair[0] ^ o.pair[0], g.pair[1] ^ o.pair[1]}}
+}
+
+func (g gstate) isZero() bool {
+	return g.tag == 0 && g.pair[0] == 0 && g.pair[1] == 0
+}
+
+func (g gstate) hasMove() bool {
+	return tagType1(g.tag) != 0
+}
+
+func (g gstate) hasMoveHere(pair [2]uint32) bool {
+	return g.hasMove() && pairOverlaps(g.pair, pair)
+}
+
+func (g gstate) orphans() uint32 {
+	return tagSize(g.tag) & 0x1ff
+}
+
+func (g gstate) encode() []byte {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint32(b[0:], g.tag)
+	binary.LittleEndian.PutUint32(b[4:], g.pair[0])
+	binary.LittleEndian.PutUint32(b[8:], g.pair[1])
+	return b
+}
+
+func decodeGstate(b []byte) gstate {
+	var g gstate
+	if len(b) >= 12 {
+		g.tag = binary.LittleEndian.Uint32(b[0:])
+		g.pair[0] = binary.LittleEndian.Uint32(b[4:])
+		g.pair[1] = binary.LittleEndian.Uint32(b[8:])
+	}
+	return g
+}
+
+// prepMove records a pending move of entry id in pair, or clears it if id
+// is 0x3ff.
+func (fs *FS) prepMove(id uint32, pair [2]uint32) {
+	fs.gstate.tag &^= mktag(0x7ff, 0x3ff, 0)
+	if id != 0x3ff {
+		fs.gstate.tag |= mktag(typeDelete, id, 0)
+		fs.gstate.pair = pair
+	} else {
+		fs.gstate.pair = [2]uint32{}
+	}
+}
+
+// prepOrphans adjusts the count of orphaned metadata pairs.
+func (fs *FS) prepOrphans(n int) {
+	fs.gstate.tag = uint32(int32(fs.gstate.tag) + int32(n))
+	fs.gstate.tag &^= 0x80000000
+	if fs.gstate.orphans() != 0 {
+		fs.gstate.tag |= 0x80000000
+	}
+}
+
+// pairOverlaps reports whether two metadata pairs share a block, which
+// means they refer to the same pair.
+func pairOverlaps(a, b [2]uint32) bool {
+	return a[0] == b[0] || a[1] == b[1] || a[0] == b[1] || a[1] == b[0]
+}
+
+// pairSync reports whether two pairs consist of the same blocks.
+func pairSync(a, b [2]uint32) bool {
+	return a[0] == b[0] && a[1] == b[1] || a[0] == b[1] && a[1] == b[0]
+}
+
+func pairIsNull(p [2]uint32) bool {
+	return p[0] == blockNull || p[1] == blockNull
+}
+
+// crc implements the CRC used by littlefs: CRC-32 with polynomial
+// 0x04c11db7, without the final inversion.
+func crc(c uint32, data []byte) uint32 {
+	return ^crc32.Update(^c, crc32.IEEETable, data)
+}
+
+// setup derives the geometry from the device and the configuration.
+func (fs *FS) setup(dev drivers.BlockDevice) error {
+	fs.dev = dev
+	fs.eraseSize = dev.EraseBlockSize()
+	prog := fs.Config.ProgSize
+	if prog == 0 {
+		prog = dev.WriteBlockSize()
+	}
+	bs := fs.Config.BlockSize
+	if bs == 0 {
+		bs = fs.eraseSize
+	}
+	count := fs.Config.BlockCount
+	if count == 0 {
+		count = dev.Size() / bs
+	}
+	if prog <= 0 || bs < 128 || bs%prog != 0 || bs%fs.eraseSize != 0 || count < 2 || bs > 0x7FFFFFFF {
+		return ErrGeometry
+	}
+	fs.progSize = uint32(prog)
+	fs.blockSize = uint32(bs)
+	fs.blockCount = uint32(count)
+	fs.nameMax = defaultNameMax
+	fs.fileMax = defaultFileMax
+	fs.attrMax = defaultAttrMax
+	fs.inlineMax = fs.blockSize / 8
+	if fs.inlineMax > fs.attrMax {
+		fs.inlineMax = fs.attrMax
+	}
+	if uint32(len(fs.buf)) != fs.blockSize {
+		fs.buf = make([]byte, fs.blockSize)
+	}
+	fs.gdisk, fs.gstate, fs.gdelta = gstate{}, gstate{}, gstate{}
+	fs.files = fs.files[:0]
+	fs.seed = 0
+	return nil
+}
+
+// Format creates an empty filesystem on dev. The config may be nil.
+func Format(dev drivers.BlockDevice, config *Config) error {
+	fs := &FS{}
+	if config != nil {
+		fs.Config = *config
+	}
+	if err := fs.setup(dev); err != nil {
+		return err
+	}
+	fs.alloc.init(fs.blockCount, 0)
+	fs.alloc.valid = true
+	fs.alloc.mark(0)
+	fs.alloc.mark(1)
+
+	var sb [24]byte
+	binary.LittleEndian.PutUint32(sb[0:], diskVersion)
+	binary.LittleEndian.PutUint32(sb[4:], fs.blockSize)
+	binary.LittleEndian.PutUint32(sb[8:], fs.blockCount)
+	binary.LittleEndian.PutUint32(sb[12:], fs.nameMax)
+	binary.LittleEndian.PutUint32(sb[16:], fs.fileMax)
+	binary.LittleEndian.PutUint32(sb[20:], fs.attrMax)
+
+	root := &mdir{
+		pair: [2]uint32{0, 1},
+		tail: [2]uint32{blockNull, blockNull},
+		entries: []mentry{{
+			typ:   typeSuperblock,
+			name:  []byte("littlefs"),
+			stype: typeInlineStruct,
+			sdata: sb[:],
+		}},
+	}
+	rev, err := fs.readU32(root.pair[0], 0)
+	if err != nil {
+		return err
+	}
+	root.rev = rev
+	// write both blocks, so that no older filesystem can be found
+	if err := fs.compact(root); err != nil {
+		return err
+	}
+	if err := fs.compact(root); err != nil {
+		return err
+	}
+	_, err = fs.fetch([2]uint32{0, 1})
+	return err
+}
+
+// Mount mounts the filesystem on dev.
+func (fs *FS) Mount(dev drivers.BlockDevice) error {
+	fs.mounted = false
+	if err := fs.setup(dev); err != nil {
+		return err
+	}
+
+	// walk the list of all metadata pairs, collecting the global state
+	tail := [2]uint32{0, 1}
+	first := true
+	for n := uint32(0); !pairIsNull(tail); n++ {
+		if n > fs.blockCount {
+			return ErrCorrupt
+		}
+		m, err := fs.fetch(tail)
+		if err != nil {
+			if first {
+				return ErrNotLittleFS
+			}
+			return err
+		}
+		if first {
+			if err := fs.checkSuperblock(m); err != nil {
+				return err
+			}
+			first = false
+		}
+		fs.gdisk = fs.gdisk.xor(m.ms)
+		tail = m.tail
+	}
+	fs.gstate = fs.gdisk
+	fs.alloc.init(fs.blockCount, fs.seed)
+	fs.mounted = true
+	return nil
+}
+
+// checkSuperblock verifies the superblock entry of the root pair.
+func (fs *FS) checkSuperblock(m *mdir) error {
+	if len(m.entries) == 0 {
+		return ErrNotLittleFS
+	}
+	e := &m.entries[0]
+	if e.typ != typeSuperblock || string(e.name) != "littlefs" || e.stype != typeInlineStruct || len(e.sdata) < 24 {
+		return ErrNotLittleFS
+	}
+	le := binary.LittleEndian
+	version := le.Uint32(e.sdata[0:])
+	if version>>16 != 2 || version&0xffff > 1 {
+		return ErrVersion
+	}
+	if le.Uint32(e.sdata[4:]) != fs.blockSize {
+		return ErrGeometry
+	}
+	count := le.Uint32(e.sdata[8:])
+	if count > uint32(fs.dev.Size()/int64(fs.blockSize)) {
+		return ErrGeometry
+	}
+	fs.blockCount = count
+	if v := le.Uint32(e.sdata[12:]); v != 0 && v < fs.nameMax {
+		fs.nameMax = v
+	}
+	if v := le.Uint32(e.sdata[16:]); v != 0 && v < fs.fileMax {
+		fs.fileMax = v
+	}
+	if v := le.Uint32(e.sdata[20:]); v != 0 && v < fs.attrMax {
+		fs.attrMax = v
+		if fs.inlineMax > v {
+			fs.inlineMax = v
+		}
+	}
+	return nil
+}
+
+// Unmount closes all open files and unmounts the filesystem.
+func (fs *FS) Unmount() error {
+	if !fs.mounted {
+		return ErrNotMounted
+	}
+	var err error
+	for len(fs.files) > 0 {
+		if cerr := fs.files[0].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	fs.mounted = false
+	return err
+}
+
+// BlockSize returns the block size of the filesystem.
+func (fs *FS) BlockSize() int64 {
+	return int64(fs.blockSize)
+}
+
+// BlockCount returns the number of blocks of the filesystem.
+func (fs *FS) BlockCount() int64 {
+	return int64(fs.blockCount)
+}
+
+// Used returns the number of blocks in use.
+func (fs *FS) Used() (int64, error) {
+	if !fs.mounted {
+		return 0, ErrNotMounted
+	}
+	n := int64(0)
+	err := fs.traverse(func(block uint32) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// blockAddr returns the device address of offset off in block b.
+func (fs *FS) blockAddr(b, off uint32) int64 {
+	return int64(b)*int64(fs.blockSize) + int64(off)
+}
+
+func (fs *FS) read(b, off uint32, p []byte) error {
+	if b >= fs.blockCount || off+uint32(len(p)) > fs.blockSize {
+		return ErrCorrupt
+	}
+	_, err := fs.dev.ReadAt(p, fs.blockAddr(b, off))
+	return err
+}
+
+func (fs *FS) readU32(b, off uint32) (uint32, error) {
+	var w [4]byte
+	if err := fs.read(b, off, w[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(w[:]), nil
+}
+
+func (fs *FS) prog(b, off uint32, p []byte) error {
+	if b >= fs.blockCount || off+uint32(len(p)) > fs.blockSize {
+		return ErrCorrupt
+	}
+	_, err := fs.dev.WriteAt(p, fs.blockAddr(b, off))
+	return err
+}
+
+func (fs *FS) erase(b uint32) error {
+	n := int64(fs.blockSize) / fs.eraseSize
+	return fs.dev.EraseBlocks(int64(b)*n, n)
+}
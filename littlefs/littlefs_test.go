@@ -0,0 +1,595 @@
+package littlefs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/drivers/flash/flashemu"
+	"tinygo.org/x/drivers/littlefs"
+)
+
+const (
+	pageSize   = 128
+	blockSize  = 512
+	blocks     = 64
+	operations = 60
+)
+
+// image is a device backed by a filesystem image as written by the
+// reference tools, with 4kB blocks.
+type image []byte
+
+func (img image) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, img[off:]), nil
+}
+
+func (img image) WriteAt(p []byte, off int64) (int, error) {
+	return copy(img[off:], p), nil
+}
+
+func (img image) Size() int64           { return int64(len(img)) }
+func (img image) WriteBlockSize() int64 { return 256 }
+func (img image) EraseBlockSize() int64 { return 4096 }
+
+func (img image) EraseBlocks(start, n int64) error {
+	for i := start * 4096; i < (start+n)*4096; i++ {
+		img[i] = 0xFF
+	}
+	return nil
+}
+
+func newFS(t *testing.T) (*flashemu.Device, *littlefs.FS) {
+	dev := flashemu.New(blocks*blockSize, pageSize, blockSize)
+	dev.Strict = true
+	if err := littlefs.Format(dev, nil); err != nil {
+		t.Fatal("format:", err)
+	}
+	fs := &littlefs.FS{}
+	if err := fs.Mount(dev); err != nil {
+		t.Fatal("mount:", err)
+	}
+	return dev, fs
+}
+
+func writeFile(fs *littlefs.FS, name string, data []byte) error {
+	f, err := fs.Open(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readFile(fs *littlefs.FS, name string) ([]byte, error) {
+	f, err := fs.Open(name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// snapshot returns the content of all files, and directories with a
+// trailing slash.
+func snapshot(fs *littlefs.FS) (map[string]string, error) {
+	m := make(map[string]string)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range infos {
+			name := path.Join(dir, fi.Name())
+			if fi.IsDir() {
+				m[name+"/"] = ""
+				if err := walk(name); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := readFile(fs, name)
+			if err != nil {
+				return err
+			}
+			if int64(len(data)) != fi.Size() {
+				return fmt.Errorf("%s: read %d bytes of %d", name, len(data), fi.Size())
+			}
+			m[name] = string(data)
+		}
+		return nil
+	}
+	return m, walk("/")
+}
+
+func dump(m map[string]string) string {
+	var list []string
+	for name, data := range m {
+		list = append(list, fmt.Sprintf("%s (%d)", name, len(data)))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+func equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// pattern returns n bytes of test data that differ between seeds.
+func pattern(n, seed int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7 + seed*13 + i>>8)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	dev, fs := newFS(t)
+	big := pattern(5*blockSize+100, 1)
+	if err := fs.Mkdir("/config"); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"/config/wifi.txt": []byte("ssid=tinygo"),
+		"/firmware.bin":    big,
+		"/old.txt":         []byte("renamed"),
+		"/gone.txt":        []byte("removed"),
+	} {
+		if err := writeFile(fs, name, data); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	if err := fs.Rename("/old.txt", "/config/new.txt"); err != nil {
+		t.Fatal("rename:", err)
+	}
+	if err := fs.Remove("/gone.txt"); err != nil {
+		t.Fatal("remove:", err)
+	}
+	if err := fs.Remove("/config"); err != littlefs.ErrNotEmpty {
+		t.Errorf("remove directory: got %v, want %v", err, littlefs.ErrNotEmpty)
+	}
+	if _, err := fs.Stat("/gone.txt"); err != littlefs.ErrNotExist {
+		t.Errorf("removed file: got %v, want %v", err, littlefs.ErrNotExist)
+	}
+	if err := fs.Unmount(); err != nil {
+		t.Fatal("unmount:", err)
+	}
+
+	fs = &littlefs.FS{}
+	if err := fs.Mount(dev); err != nil {
+		t.Fatal("remount:", err)
+	}
+	got, err := snapshot(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"/config/":         "",
+		"/config/wifi.txt": "ssid=tinygo",
+		"/config/new.txt":  "renamed",
+		"/firmware.bin":    string(big),
+	}
+	if !equal(got, want) {
+		t.Errorf("got %s, want %s", dump(got), dump(want))
+	}
+}
+
+// op is a single change of the workload.
+type op struct {
+	kind string // "write", "remove", "rename" or "mkdir"
+	name string
+	to   string
+	data []byte
+}
+
+// makeWorkload returns a pseudo-random sequence of changes, which are all
+// valid when applied in order.
+func makeWorkload() []op {
+	names := []string{"/a", "/b", "/c", "/dir/x", "/dir/y"}
+	ops := []op{{kind: "mkdir", name: "/dir"}}
+	exists := make(map[string]bool)
+	x := uint32(1)
+	for i := 0; len(ops) < operations; i++ {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		name := names[x%uint32(len(names))]
+		to := names[(x>>8)%uint32(len(names))]
+		switch {
+		case x%8 == 0 && exists[name]:
+			ops = append(ops, op{kind: "remove", name: name})
+			exists[name] = false
+		case x%8 == 1 && exists[name] && name != to:
+			ops = append(ops, op{kind: "rename", name: name, to: to})
+			exists[name], exists[to] = false, true
+		default:
+			// sizes from inline data up to several blocks
+			n := int(x>>16) % (3 * blockSize)
+			if x%4 == 0 {
+				n %= 40
+			}
+			ops = append(ops, op{kind: "write", name: name, data: pattern(n, i)})
+			exists[name] = true
+		}
+	}
+	return ops
+}
+
+func apply(fs *littlefs.FS, o op) error {
+	switch o.kind {
+	case "mkdir":
+		return fs.Mkdir(o.name)
+	case "remove":
+		return fs.Remove(o.name)
+	case "rename":
+		return fs.Rename(o.name, o.to)
+	default:
+		return writeFile(fs, o.name, o.data)
+	}
+}
+
+// state returns the expected content after the first n operations of the
+// workload.
+func state(workload []op, n int) map[string]string {
+	m := make(map[string]string)
+	for _, o := range workload[:n] {
+		switch o.kind {
+		case "mkdir":
+			m[o.name+"/"] = ""
+		case "remove":
+			delete(m, o.name)
+		case "rename":
+			m[o.to] = m[o.name]
+			delete(m, o.name)
+		default:
+			m[o.name] = string(o.data)
+		}
+	}
+	return m
+}
+
+// verify checks that the filesystem holds the content after the first n
+// operations of the workload. If interrupted is set, operation n may also
+// have completed, which is reported. Creating a file is a separate commit
+// from writing it, so an interrupted write may also leave a new file empty.
+func verify(t *testing.T, fs *littlefs.FS, workload []op, n int, interrupted bool) (completed bool) {
+	t.Helper()
+	got, err := snapshot(fs)
+	if err != nil {
+		t.Errorf("after %d operations: %v", n, err)
+		return false
+	}
+	want := state(workload, n)
+	if equal(got, want) {
+		return false
+	}
+	if !interrupted {
+		t.Errorf("after %d operations: got %s, want %s", n, dump(got), dump(want))
+		return false
+	}
+	if equal(got, state(workload, n+1)) {
+		return true
+	}
+	if o := workload[n]; o.kind == "write" {
+		if _, ok := want[o.name]; !ok {
+			want[o.name] = ""
+			if equal(got, want) {
+				return false
+			}
+		}
+	}
+	t.Errorf("operation %d interrupted: got %s", n, dump(got))
+	return false
+}
+
+// TestPowerLoss checks that the filesystem survives a power loss during any
+// single program or erase operation of a workload.
+func TestPowerLoss(t *testing.T) {
+	workload := makeWorkload()
+
+	// a run without faults gives the number of operations to interrupt
+	dev, fs := newFS(t)
+	_, programs0, erases0 := dev.Stats()
+	for i, o := range workload {
+		if err := apply(fs, o); err != nil {
+			t.Fatalf("operation %d: %v", i, err)
+		}
+	}
+	_, programs, erases := dev.Stats()
+	total := programs + erases - programs0 - erases0
+	verify(t, fs, workload, len(workload), false)
+
+	for fault := uint64(1); fault <= total; fault++ {
+		dev, fs := newFS(t)
+		dev.PowerLossAt(fault)
+
+		interrupted := -1
+		for i, o := range workload {
+			if err := apply(fs, o); err != nil {
+				if err != flashemu.ErrPowerLoss {
+					t.Fatalf("fault %d: operation %d: %v", fault, i, err)
+				}
+				interrupted = i
+				break
+			}
+		}
+		if interrupted < 0 {
+			t.Fatalf("fault %d: the power was not lost", fault)
+		}
+
+		dev.PowerOn()
+		fs = &littlefs.FS{}
+		if err := fs.Mount(dev); err != nil {
+			t.Fatalf("fault %d: mount: %v", fault, err)
+		}
+		if verify(t, fs, workload, interrupted, true) {
+			interrupted++
+		}
+
+		// the filesystem must remain usable
+		for i := interrupted; i < len(workload); i++ {
+			if err := apply(fs, workload[i]); err != nil {
+				t.Fatalf("fault %d: operation %d: %v", fault, i, err)
+			}
+		}
+		verify(t, fs, workload, len(workload), false)
+		if t.Failed() {
+			t.Fatalf("fault %d of %d", fault, total)
+		}
+	}
+	t.Logf("%d power loss points recovered", total)
+}
+
+// tool returns the path of a reference tool, skipping the test if it is not
+// installed.
+func tool(t *testing.T, name string) string {
+	t.Helper()
+	p, err := exec.LookPath(name)
+	if err != nil {
+		t.Skipf("%s not installed", name)
+	}
+	return p
+}
+
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", filepath.Base(name), err, out)
+	}
+}
+
+// files is the tree stored in the images of the interoperability tests.
+var files = map[string]string{
+	"/hello.txt":                 "Hello, littlefs!\n",
+	"/config/":                   "",
+	"/config/a-longer-name.json": `{"interval": 60}`,
+	"/data/":                     "",
+	"/data/log.bin":              string(pattern(3*4096+1000, 2)),
+}
+
+func writeTree(t *testing.T, dir string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the files below dir in the form of files.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	m := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		name := "/" + filepath.ToSlash(p[len(dir)+1:])
+		if fi.IsDir() {
+			m[name+"/"] = ""
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		m[name] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// fromReference creates an image of the files with a reference tool and
+// checks its content.
+func fromReference(t *testing.T, create func(src, img string)) {
+	dir, err := ioutil.TempDir("", "littlefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, img := filepath.Join(dir, "src"), filepath.Join(dir, "fs.img")
+	writeTree(t, src)
+	create(src, img)
+
+	data, err := ioutil.ReadFile(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &littlefs.FS{}
+	if err := fs.Mount(image(data)); err != nil {
+		t.Fatal("mount:", err)
+	}
+	got, err := snapshot(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(got, files) {
+		t.Errorf("got %s, want %s", dump(got), dump(files))
+	}
+
+	// the image must remain writable
+	if err := writeFile(fs, "/data/new.txt", []byte("written by tinygo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// toReference writes the files with this package and extracts them with a
+// reference tool.
+func toReference(t *testing.T, extract func(img, dst string)) {
+	dir, err := ioutil.TempDir("", "littlefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	img := make(image, 32*4096)
+	if err := littlefs.Format(img, nil); err != nil {
+		t.Fatal("format:", err)
+	}
+	fs := &littlefs.FS{}
+	if err := fs.Mount(img); err != nil {
+		t.Fatal("mount:", err)
+	}
+	for name, data := range files {
+		if strings.HasSuffix(name, "/") {
+			err = fs.Mkdir(name)
+		} else {
+			err = writeFile(fs, name, []byte(data))
+		}
+		if err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	if err := fs.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+	path, dst := filepath.Join(dir, "fs.img"), filepath.Join(dir, "dst")
+	if err := ioutil.WriteFile(path, img, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	extract(path, dst)
+	if got := readTree(t, dst); !equal(got, files) {
+		t.Errorf("got %s, want %s", dump(got), dump(files))
+	}
+}
+
+func TestMklittlefs(t *testing.T) {
+	mk := tool(t, "mklittlefs")
+	t.Run("read", func(t *testing.T) {
+		fromReference(t, func(src, img string) {
+			run(t, mk, "-c", src, "-b", "4096", "-p", "256", "-s", fmt.Sprint(32*4096), img)
+		})
+	})
+	t.Run("write", func(t *testing.T) {
+		toReference(t, func(img, dst string) {
+			run(t, mk, "-u", dst, "-b", "4096", "-p", "256", "-s", fmt.Sprint(32*4096), img)
+		})
+	})
+}
+
+func TestLittlefsPython(t *testing.T) {
+	lp := tool(t, "littlefs-python")
+	t.Run("read", func(t *testing.T) {
+		fromReference(t, func(src, img string) {
+			run(t, lp, "create", "--block-size", "4096", "--block-count", "32", src, img)
+		})
+	})
+	t.Run("write", func(t *testing.T) {
+		toReference(t, func(img, dst string) {
+			run(t, lp, "extract", "--block-size", "4096", img, dst)
+		})
+	})
+}
+
+// TestReferenceImage mounts an image written by the reference
+// implementation and kept in testdata, so that the format is checked
+// without the reference tools installed.
+//
+// The image is not in the tree yet: it must be created by littlefs v2
+// itself, which was not available when this test was written, and not
+// written by hand. With littlefs-python installed:
+//
+//	littlefs-python create --block-size 4096 --block-count 32 src reference.img
+//	gzip -9 reference.img
+//
+// where src holds the tree of files, as written by writeTree.
+func TestReferenceImage(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "reference.img.gz"))
+	if os.IsNotExist(err) {
+		t.Skip("testdata/reference.img.gz not available")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &littlefs.FS{}
+	if err := fs.Mount(image(data)); err != nil {
+		t.Fatal("mount:", err)
+	}
+	got, err := snapshot(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(got, files) {
+		t.Errorf("got %s, want %s", dump(got), dump(files))
+	}
+}
+
+func TestMountEmpty(t *testing.T) {
+	img := make(image, 8*4096)
+	for i := range img {
+		img[i] = 0xFF
+	}
+	fs := &littlefs.FS{}
+	if err := fs.Mount(img); err != littlefs.ErrNotLittleFS {
+		t.Errorf("got %v, want %v", err, littlefs.ErrNotLittleFS)
+	}
+	if err := fs.Mount(image(bytes.Repeat([]byte{0}, 8*4096))); err != littlefs.ErrNotLittleFS {
+		t.Errorf("zeroed: got %v, want %v", err, littlefs.ErrNotLittleFS)
+	}
+}
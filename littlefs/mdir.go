@@ -0,0 +1,489 @@
+package littlefs
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Metadata tags are 32-bit big endian words, XORed with the previous tag:
+//
+//	[1|-- 11 type --|-- 10 id --|-- 10 size --]
+//
+// A set top bit marks an invalid tag, which ends the log. A size of 0x3ff
+// marks a deleted attribute without data.
+const (
+	typeName         = 0x000
+	typeReg          = 0x001
+	typeDir          = 0x002
+	typeSuperblock   = 0x0ff
+	typeStruct       = 0x200
+	typeDirStruct    = 0x200
+	typeInlineStruct = 0x201
+	typeCTZStruct    = 0x202
+	typeUserAttr     = 0x300
+	typeSplice       = 0x400
+	typeCreate       = 0x401
+	typeDelete       = 0x4ff
+	typeCRC          = 0x500
+	typeTail         = 0x600
+	typeSoftTail     = 0x600
+	typeHardTail     = 0x601
+	typeGlobals      = 0x700
+	typeMoveState    = 0x7ff
+)
+
+func mktag(typ, id, size uint32) uint32 {
+	return typ<<20 | id<<10 | size
+}
+
+func tagIsValid(t uint32) bool  { return t&0x80000000 == 0 }
+func tagType1(t uint32) uint32  { return (t & 0x70000000) >> 20 }
+func tagType2(t uint32) uint32  { return (t & 0x78000000) >> 20 }
+func tagType3(t uint32) uint32  { return (t & 0x7ff00000) >> 20 }
+func tagChunk(t uint32) uint8   { return uint8(t >> 20) }
+func tagID(t uint32) uint32     { return (t & 0x000ffc00) >> 10 }
+func tagSize(t uint32) uint32   { return t & 0x3ff }
+func tagIsDelete(t uint32) bool { return tagSize(t) == 0x3ff }
+
+// tagDSize returns the size of a tag including its data.
+func tagDSize(t uint32) uint32 {
+	if tagIsDelete(t) {
+		return 4
+	}
+	return 4 + tagSize(t)
+}
+
+// attr is a tag with its data, as written in a commit.
+type attr struct {
+	tag  uint32
+	data []byte
+}
+
+// uattr is a user attribute of an entry.
+type uattr struct {
+	typ  uint8
+	data []byte
+}
+
+// mentry is an entry of a metadata pair: a file, a directory or the
+// superblock.
+type mentry struct {
+	typ   uint32 // name tag type, zero if the entry has no name yet
+	name  []byte
+	stype uint32 // struct tag type
+	sdata []byte
+	attrs []uattr
+}
+
+// mdir is a metadata pair and its decoded contents.
+type mdir struct {
+	pair   [2]uint32 // pair[0] holds the current log
+	rev    uint32
+	off    uint32 // end of the last commit
+	etag   uint32 // tag to XOR the next commit with
+	erased bool   // the rest of the block can be appended to
+	tail   [2]uint32
+	split  bool // tail is a hard tail, continuing the same directory
+	ms     gstate
+
+	entries []mentry
+}
+
+func (m *mdir) clone() *mdir {
+	c := *m
+	c.entries = make([]mentry, len(m.entries), len(m.entries)+2)
+	copy(c.entries, m.entries)
+	return &c
+}
+
+// apply updates the decoded contents with one tag.
+func (m *mdir) apply(tag uint32, data []byte) {
+	id := tagID(tag)
+	switch tagType1(tag) {
+	case typeName, typeStruct, typeUserAttr:
+		if id >= 0x3ff {
+			return
+		}
+		for uint32(len(m.entries)) <= id {
+			m.entries = append(m.entries, mentry{})
+		}
+		e := &m.entries[id]
+		switch tagType1(tag) {
+		case typeName:
+			if !tagIsDelete(tag) {
+				e.typ, e.name = tagType3(tag), data
+			}
+		case typeStruct:
+			if !tagIsDelete(tag) {
+				e.stype, e.sdata = tagType3(tag), data
+			}
+		default:
+			e.setAttr(tagChunk(tag), data, tagIsDelete(tag))
+		}
+	case typeSplice:
+		switch tagType3(tag) {
+		case typeCreate:
+			if id <= uint32(len(m.entries)) {
+				m.entries = append(m.entries, mentry{})
+				copy(m.entries[id+1:], m.entries[id:])
+				m.entries[id] = mentry{}
+			}
+		case typeDelete:
+			if id < uint32(len(m.entries)) {
+				m.entries = append(m.entries[:id:id], m.entries[id+1:]...)
+			}
+		}
+	case typeTail:
+		if len(data) >= 8 {
+			m.tail[0] = binary.LittleEndian.Uint32(data)
+			m.tail[1] = binary.LittleEndian.Uint32(data[4:])
+			m.split = tagChunk(tag)&1 != 0
+		}
+	case typeGlobals:
+		if tagType3(tag) == typeMoveState {
+			m.ms = decodeGstate(data)
+		}
+	}
+}
+
+func (e *mentry) setAttr(typ uint8, data []byte, del bool) {
+	attrs := make([]uattr, 0, len(e.attrs)+1)
+	for _, a := range e.attrs {
+		if a.typ != typ {
+			attrs = append(attrs, a)
+		}
+	}
+	if !del {
+		attrs = append(attrs, uattr{typ, data})
+	}
+	e.attrs = attrs
+}
+
+// tags returns the tags describing entry id, as written by a compaction.
+func (e *mentry) tags(id uint32) []attr {
+	if e.typ == 0 {
+		return nil
+	}
+	list := []attr{{mktag(e.typ, id, uint32(len(e.name))), e.name}}
+	if e.stype != 0 {
+		list = append(list, attr{mktag(e.stype, id, uint32(len(e.sdata))), e.sdata})
+	}
+	for _, a := range e.attrs {
+		list = append(list, attr{mktag(typeUserAttr|uint32(a.typ), id, uint32(len(a.data))), a.data})
+	}
+	return list
+}
+
+func pairData(p [2]uint32) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, p[0])
+	binary.LittleEndian.PutUint32(b[4:], p[1])
+	return b
+}
+
+func pairFrom(b []byte) [2]uint32 {
+	return [2]uint32{binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])}
+}
+
+// scmp compares two revision counts, taking overflow into account.
+func scmp(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// fetch reads a metadata pair, picking the block with the most recent
+// valid commit.
+func (fs *FS) fetch(pair [2]uint32) (*mdir, error) {
+	var revs [2]uint32
+	for i := range revs {
+		var err error
+		if revs[i], err = fs.readU32(pair[i], 0); err != nil {
+			return nil, err
+		}
+	}
+	r := 0
+	if scmp(revs[1], revs[0]) > 0 {
+		r = 1
+	}
+	for i := 0; i < 2; i++ {
+		b := pair[(r+i)%2]
+		if err := fs.read(b, 0, fs.buf); err != nil {
+			return nil, err
+		}
+		if m := fs.parse(fs.buf); m != nil {
+			m.pair = [2]uint32{b, pair[(r+i+1)%2]}
+			return m, nil
+		}
+	}
+	return nil, ErrCorrupt
+}
+
+// parse decodes the log of one block of a metadata pair. It returns nil if
+// the block holds no valid commit.
+func (fs *FS) parse(buf []byte) *mdir {
+	m := &mdir{tail: [2]uint32{blockNull, blockNull}}
+	var pending []attr
+	valid := false
+	size := uint32(len(buf))
+	rev := binary.LittleEndian.Uint32(buf)
+	c := crc(0xffffffff, buf[:4])
+	ptag := uint32(0xffffffff)
+	for off := uint32(4); off+4 <= size; {
+		tag := binary.BigEndian.Uint32(buf[off:]) ^ ptag
+		if !tagIsValid(tag) || off+tagDSize(tag) > size {
+			break
+		}
+		c = crc(c, buf[off:off+4])
+		ptag = tag
+		if tagType2(tag) == typeCRC {
+			if tagSize(tag) < 4 || binary.LittleEndian.Uint32(buf[off+4:]) != c {
+				break
+			}
+			ptag ^= uint32(tagChunk(tag)&1) << 31
+			fs.seed = crc(fs.seed, buf[off+4:off+8])
+			for _, a := range pending {
+				m.apply(a.tag, a.data)
+			}
+			pending = pending[:0]
+			off += tagDSize(tag)
+			m.off, m.etag = off, ptag
+			c = 0xffffffff
+			valid = true
+			continue
+		}
+		data := buf[off+4 : off+tagDSize(tag)]
+		c = crc(c, data)
+		pending = append(pending, attr{tag, append([]byte(nil), data...)})
+		off += tagDSize(tag)
+	}
+	if !valid {
+		return nil
+	}
+	m.rev = rev
+	m.erased = m.off%fs.progSize == 0
+	for _, b := range buf[m.off:] {
+		if b != 0xff {
+			m.erased = false
+			break
+		}
+	}
+	return m
+}
+
+// visible reports whether entry id of m is a file or directory that is not
+// hidden by a pending move.
+func (fs *FS) visible(m *mdir, id int) bool {
+	typ := m.entries[id].typ
+	if typ != typeReg && typ != typeDir {
+		return false
+	}
+	return !(fs.gdisk.hasMoveHere(m.pair) && tagID(fs.gdisk.tag) == uint32(id))
+}
+
+// commit appends attrs to the log of m, or compacts the pair if they don't
+// fit. Any change of the global state is written along.
+func (fs *FS) commit(m *mdir, attrs ...attr) error {
+	n := m.clone()
+	for _, a := range attrs {
+		n.apply(a.tag, a.data)
+	}
+	delta := fs.gstate.xor(fs.gdisk).xor(fs.gdelta)
+	if !delta.isZero() {
+		n.ms = m.ms.xor(delta)
+		attrs = append(attrs, attr{mktag(typeMoveState, 0x3ff, 12), n.ms.encode()})
+	}
+
+	size := uint32(0)
+	for _, a := range attrs {
+		size += 4 + uint32(len(a.data))
+	}
+	if m.erased && alignUp(m.off+size+8, fs.progSize) <= fs.blockSize {
+		off, etag, err := fs.writeCommit(m.pair[0], m.off, m.etag, 0xffffffff, nil, attrs)
+		if err != nil {
+			return err
+		}
+		n.off, n.etag = off, etag
+	} else if err := fs.compact(n); err != nil {
+		return err
+	}
+	*m = *n
+	fs.gdisk = fs.gstate
+	fs.gdelta = gstate{}
+	return nil
+}
+
+func alignUp(n, a uint32) uint32 {
+	return (n + a - 1) / a * a
+}
+
+// writeCommit programs a commit at off in block b, followed by its CRC and
+// padding to the program size. It returns the end of the commit and the
+// tag the next commit is XORed with.
+func (fs *FS) writeCommit(b, off, ptag, c uint32, head []byte, attrs []attr) (uint32, uint32, error) {
+	var buf bytes.Buffer
+	buf.Write(head)
+	var w [4]byte
+	for _, a := range attrs {
+		binary.BigEndian.PutUint32(w[:], a.tag^ptag)
+		buf.Write(w[:])
+		buf.Write(a.data)
+		ptag = a.tag
+	}
+	c = crc(c, buf.Bytes())
+
+	// CRC tags fill the rest of the program unit. Their lowest type bit
+	// flips the valid bit of the next tag, so that the erased state that
+	// follows reads as an invalid tag.
+	end := alignUp(off+uint32(buf.Len())+8, fs.progSize)
+	start := off
+	off += uint32(buf.Len())
+	if err := fs.prog(b, start, buf.Bytes()); err != nil {
+		return 0, 0, err
+	}
+	for off < end {
+		noff := off + 4
+		noff += min32(end-noff, 0x3fe)
+		if noff < end {
+			noff = min32(noff, end-8)
+		}
+		erased := uint32(0xffffffff)
+		if noff < fs.blockSize {
+			var err error
+			if erased, err = fs.readU32(b, noff); err != nil {
+				return 0, 0, err
+			}
+		}
+		reset := ^erased >> 31 & 1
+		tag := mktag(typeCRC+reset, 0x3ff, noff-off-4)
+		var footer [8]byte
+		binary.BigEndian.PutUint32(footer[:], tag^ptag)
+		c = crc(c, footer[:4])
+		binary.LittleEndian.PutUint32(footer[4:], c)
+		if err := fs.prog(b, off, footer[:]); err != nil {
+			return 0, 0, err
+		}
+		off = noff
+		ptag = tag ^ reset<<31
+		c = 0xffffffff
+	}
+
+	// read back the commit to catch bad blocks
+	check := make([]byte, end-start)
+	if err := fs.read(b, start, check); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(check[:buf.Len()], buf.Bytes()) {
+		return 0, 0, ErrCorrupt
+	}
+	return end, ptag, nil
+}
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// compactSize returns the size of the compacted tags of entries.
+func compactSize(entries []mentry) uint32 {
+	size := uint32(0)
+	for i := range entries {
+		for _, a := range entries[i].tags(0) {
+			size += 4 + uint32(len(a.data))
+		}
+	}
+	return size
+}
+
+// compact writes the contents of m to the other block of its pair. If they
+// take more than half a block, the trailing entries are split off into new
+// metadata pairs first.
+func (fs *FS) compact(m *mdir) error {
+	// room for the revision count, tail, global state and CRC
+	limit := fs.blockSize - 40
+	if half := alignUp(fs.blockSize/2, fs.progSize); half < limit {
+		limit = half
+	}
+	end := len(m.entries)
+	for {
+		split := 0
+		for end-split > 1 {
+			if end-split < 0xff && compactSize(m.entries[split:end]) <= limit {
+				break
+			}
+			split += (end - split) / 2
+		}
+		if split == 0 {
+			break
+		}
+		tail, err := fs.allocPair()
+		if err != nil {
+			return err
+		}
+		tail.entries = append([]mentry(nil), m.entries[split:end]...)
+		tail.tail, tail.split = m.tail, m.split
+		if err := fs.compactBlock(tail); err != nil {
+			return err
+		}
+		m.entries = m.entries[:split:split]
+		m.tail, m.split = tail.pair, true
+		end = split
+	}
+	if compactSize(m.entries) > fs.blockSize-40 {
+		return ErrNoSpace
+	}
+	return fs.compactBlock(m)
+}
+
+// compactBlock erases the inactive block of m and writes all of m to it.
+func (fs *FS) compactBlock(m *mdir) error {
+	var attrs []attr
+	for i := range m.entries {
+		attrs = append(attrs, m.entries[i].tags(uint32(i))...)
+	}
+	if !pairIsNull(m.tail) {
+		typ := uint32(typeSoftTail)
+		if m.split {
+			typ = typeHardTail
+		}
+		attrs = append(attrs, attr{mktag(typ, 0x3ff, 8), pairData(m.tail)})
+	}
+	if !m.ms.isZero() {
+		attrs = append(attrs, attr{mktag(typeMoveState, 0x3ff, 12), m.ms.encode()})
+	}
+
+	b := m.pair[1]
+	if err := fs.erase(b); err != nil {
+		return err
+	}
+	var rev [4]byte
+	binary.LittleEndian.PutUint32(rev[:], m.rev+1)
+	off, etag, err := fs.writeCommit(b, 0, 0xffffffff, 0xffffffff, rev[:], attrs)
+	if err != nil {
+		return err
+	}
+	m.rev++
+	m.pair[0], m.pair[1] = m.pair[1], m.pair[0]
+	m.off, m.etag, m.erased = off, etag, true
+	return nil
+}
+
+// allocPair allocates a new, empty metadata pair. It is written by the
+// first commit.
+func (fs *FS) allocPair() (*mdir, error) {
+	m := &mdir{tail: [2]uint32{blockNull, blockNull}}
+	for i := 0; i < 2; i++ {
+		b, err := fs.alloc.alloc(fs)
+		if err != nil {
+			return nil, err
+		}
+		m.pair[(i+1)%2] = b
+	}
+	// continue the revision count of the old contents, if any
+	rev, err := fs.readU32(m.pair[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	m.rev = rev
+	return m, nil
+}
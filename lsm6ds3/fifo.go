@@ -0,0 +1,154 @@
+package lsm6ds3
+
+// FIFOConfig configures the FIFO.
+type FIFOConfig struct {
+	Mode FIFOMode
+
+	// Watermark is the number of samples at which INT_WATERMARK is raised.
+	Watermark uint16
+
+	// Gyro stores the rotation with the acceleration. The gyroscope must
+	// then run at the same sample rate as the accelerometer.
+	Gyro bool
+}
+
+// FIFOSample is a sample of the FIFO, in µg and µ°/s.
+type FIFOSample struct {
+	Accel [3]int32
+	Gyro  [3]int32 // zero unless FIFOConfig.Gyro
+}
+
+// ConfigureFIFO configures the FIFO, which stores samples at the sample rate
+// of the accelerometer. Configure must be called before.
+func (d *Device) ConfigureFIFO(cfg FIFOConfig) error {
+	d.fifoGyro = cfg.Gyro
+	words := uint16(d.fifoWords()) * cfg.Watermark
+	if words > 0xFFF {
+		words = 0xFFF
+	}
+	dec := uint8(0x01) // accelerometer without decimation
+	if cfg.Gyro {
+		dec |= 0x01 << 3 // gyroscope without decimation
+	}
+	// ODR_FIFO has the codes of the sample rates of the accelerometer
+	odr := uint8(d.accelSampleRate) >> 1
+	return d.writeRegisters(
+		// the mode goes through bypass, which empties the FIFO
+		FIFO_CTRL5, 0,
+		FIFO_CTRL1, uint8(words),
+		FIFO_CTRL2, uint8(words>>8),
+		FIFO_CTRL3, dec,
+		FIFO_CTRL4, 0,
+		FIFO_CTRL5, odr|uint8(cfg.Mode),
+	)
+}
+
+// fifoWords returns the number of values of 16 bits of a sample.
+func (d *Device) fifoWords() int {
+	if d.fifoGyro {
+		return 6
+	}
+	return 3
+}
+
+// FIFOCount returns the number of samples in the FIFO.
+func (d *Device) FIFOCount() (int, error) {
+	status := []byte{0, 0}
+	if err := d.bus.ReadRegister(uint8(d.Address), FIFO_STATUS1, status); err != nil {
+		return 0, err
+	}
+	if status[1]&0x10 != 0 { // FIFO_EMPTY
+		return 0, nil
+	}
+	words := int(status[1]&0x0F)<<8 | int(status[0])
+	return words / d.fifoWords(), nil
+}
+
+// ReadFIFO reads the oldest samples of the FIFO into samples, and returns
+// how many it read: at most len(samples), and at most the number in the
+// FIFO.
+func (d *Device) ReadFIFO(samples []FIFOSample) (int, error) {
+	if err := d.alignFIFO(); err != nil {
+		return 0, err
+	}
+	count, err := d.FIFOCount()
+	if err != nil {
+		return 0, err
+	}
+	if count > len(samples) {
+		count = len(samples)
+	}
+	words := d.fifoWords()
+	accelScale, gyroScale := d.accelScale(), d.gyroScale()
+
+	// The address of a burst read of the FIFO rolls back from
+	// FIFO_DATA_OUT_H to FIFO_DATA_OUT_L, so several samples can be read at
+	// once.
+	var data [8 * 12]byte
+	for n := 0; n < count; {
+		chunk := count - n
+		if chunk > 8 {
+			chunk = 8
+		}
+		buf := data[:chunk*words*2]
+		if err := d.bus.ReadRegister(uint8(d.Address), FIFO_DATA_OUT_L, buf); err != nil {
+			return n, err
+		}
+		for i := 0; i < chunk; i++ {
+			b := buf[i*words*2:]
+			s := &samples[n+i]
+			*s = FIFOSample{}
+			if d.fifoGyro {
+				// the gyroscope comes first
+				for j := range s.Gyro {
+					s.Gyro[j] = int32(int16(uint16(b[2*j+1])<<8|uint16(b[2*j]))) * gyroScale
+				}
+				b = b[6:]
+			}
+			for j := range s.Accel {
+				s.Accel[j] = int32(int16(uint16(b[2*j+1])<<8|uint16(b[2*j]))) * accelScale
+			}
+		}
+		n += chunk
+	}
+	return count, nil
+}
+
+// alignFIFO drops values until the next one is the first of a sample, for
+// example after an overrun.
+func (d *Device) alignFIFO() error {
+	pattern := []byte{0, 0}
+	if err := d.bus.ReadRegister(uint8(d.Address), FIFO_STATUS3, pattern); err != nil {
+		return err
+	}
+	next := int(pattern[1]&0x03)<<8 | int(pattern[0])
+	if next == 0 {
+		return nil
+	}
+	for i := next; i < d.fifoWords(); i++ {
+		if err := d.bus.ReadRegister(uint8(d.Address), FIFO_DATA_OUT_L, d.dataBufferTwo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRegisters writes pairs of register and value.
+func (d *Device) writeRegisters(pairs ...uint8) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := d.bus.WriteRegister(uint8(d.Address), pairs[i], pairs[i+1:i+2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateRegister sets the bits of mask in a register to those of value.
+func (d *Device) updateRegister(reg, mask, value uint8) error {
+	data := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), reg, data); err != nil {
+		return err
+	}
+	data[0] = data[0]&^mask | value&mask
+	return d.bus.WriteRegister(uint8(d.Address), reg, data)
+}
@@ -0,0 +1,192 @@
+package lsm6ds3
+
+import "time"
+
+// ConfigureInterrupts sets the interrupts signaled on the INT1 and INT2
+// pins, which are active high. Interrupts of taps, free fall, activity and
+// inactivity are latched until ReadInterrupts.
+func (d *Device) ConfigureInterrupts(int1, int2 Interrupt) error {
+	for _, r := range [...]struct {
+		reg, mask uint8
+		value     uint8
+	}{
+		{INT1_CTRL, 0x3B, uint8(int1)},
+		{INT2_CTRL, 0x3B, uint8(int2)},
+		{MD1_CFG, 0xF8, uint8(int1 >> 8)},
+		{MD2_CFG, 0xF8, uint8(int2 >> 8)},
+		{TAP_CFG, 0x01, 0x01}, // LIR
+	} {
+		if err := d.updateRegister(r.reg, r.mask, r.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadInterrupts returns the interrupts raised, and clears those latched.
+// INT_INACTIVITY is reported while the device is inactive.
+func (d *Device) ReadInterrupts() (Interrupt, error) {
+	var src [4]byte
+	for i, reg := range [...]uint8{STATUS, FIFO_STATUS2, WAKE_UP_SRC, TAP_SRC} {
+		if err := d.bus.ReadRegister(uint8(d.Address), reg, src[i:i+1]); err != nil {
+			return 0, err
+		}
+	}
+	var ints Interrupt
+	for _, bit := range [...]struct {
+		src, mask uint8
+		ints      Interrupt
+	}{
+		{0, 0x01, INT_DATA_READY},      // XLDA
+		{0, 0x02, INT_GYRO_DATA_READY}, // GDA
+		{1, 0x80, INT_WATERMARK},       // FTH
+		{1, 0x40, INT_OVERRUN},         // FIFO_OVER_RUN
+		{1, 0x20, INT_FIFO_FULL},       // FIFO_FULL
+		{2, 0x20, INT_FREE_FALL},       // FF_IA
+		{2, 0x10, INT_INACTIVITY},      // SLEEP_STATE_IA
+		{2, 0x08, INT_ACTIVITY},        // WU_IA
+		{3, 0x20, INT_SINGLE_TAP},      // SINGLE_TAP
+		{3, 0x10, INT_DOUBLE_TAP},      // DOUBLE_TAP
+	} {
+		if src[bit.src]&bit.mask != 0 {
+			ints |= bit.ints
+		}
+	}
+	return ints, nil
+}
+
+// TapConfig configures the detection of taps.
+type TapConfig struct {
+	// Threshold is the acceleration of a tap in µg, up to 31 steps of 1/32
+	// of the range.
+	Threshold int32
+
+	// Duration is the longest time the acceleration of a tap stays above
+	// the threshold, up to 3 steps of 8 samples.
+	Duration time.Duration
+
+	// Latency is the time after a tap during which another one is ignored,
+	// up to 3 steps of 4 samples, and Window the longest time between the
+	// taps of a double tap, up to 15 steps of 32 samples. Double taps are
+	// only detected if Window is set.
+	Latency time.Duration
+	Window  time.Duration
+
+	// Axes are the axes on which taps are detected.
+	Axes Axes
+}
+
+// ConfigureTap configures the detection of single and double taps, which
+// raise INT_SINGLE_TAP and INT_DOUBLE_TAP. Durations depend on the sample
+// rate of the accelerometer.
+func (d *Device) ConfigureTap(cfg TapConfig) error {
+	var double uint8
+	if cfg.Window > 0 {
+		double = 0x80 // SINGLE_DOUBLE_TAP
+	}
+	dur := d.samples(cfg.Window, 32, 15)<<4 |
+		d.samples(cfg.Latency, 4, 3)<<2 |
+		d.samples(cfg.Duration, 8, 3)
+	for _, r := range [...]struct {
+		reg, mask uint8
+		value     uint8
+	}{
+		{TAP_THS_6D, 0x1F, d.threshold(cfg.Threshold, 32, 31)},
+		{INT_DUR2, 0xFF, dur},
+		{WAKE_UP_THS, 0x80, double},
+		{TAP_CFG, 0x0E, uint8(cfg.Axes&AXIS_ALL) << 1}, // TAP_X_EN, TAP_Y_EN, TAP_Z_EN
+	} {
+		if err := d.updateRegister(r.reg, r.mask, r.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigureFreeFall configures the detection of free fall, which raises
+// INT_FREE_FALL when the acceleration on all axes stays below threshold, in
+// µg, for duration, up to 63 samples. The threshold is rounded up to one of
+// 156, 219, 250, 312, 344, 406, 469 and 500 mg.
+func (d *Device) ConfigureFreeFall(threshold int32, duration time.Duration) error {
+	var ths uint8
+	for ths < 7 && threshold > [...]int32{156250, 218750, 250000, 312500, 343750, 406250, 468750}[ths] {
+		ths++
+	}
+	n := d.samples(duration, 1, 63)
+	if err := d.updateRegister(WAKE_UP_DUR, 0x80, n<<2); err != nil { // FF_DUR5
+		return err
+	}
+	return d.updateRegister(FREE_FALL, 0xFF, n<<3|ths)
+}
+
+// ConfigureActivity configures the detection of activity, which raises
+// INT_ACTIVITY when the acceleration on any axis, high-pass filtered so that
+// gravity is ignored, exceeds threshold in µg, up to 63 steps of 1/64 of the
+// range, for duration, up to 3 samples.
+func (d *Device) ConfigureActivity(threshold int32, duration time.Duration) error {
+	if err := d.updateRegister(WAKE_UP_THS, 0x3F, d.threshold(threshold, 64, 63)); err != nil {
+		return err
+	}
+	return d.updateRegister(WAKE_UP_DUR, 0x60, d.samples(duration, 1, 3)<<5)
+}
+
+// ConfigureInactivity enables the detection of inactivity when duration is
+// not zero: when the threshold of ConfigureActivity is not exceeded for
+// duration, up to 15 steps of 512 samples, the accelerometer goes to 12.5
+// Hz and the gyroscope to sleep, and INT_INACTIVITY is raised until
+// activity.
+func (d *Device) ConfigureInactivity(duration time.Duration) error {
+	var inactivity uint8
+	n := d.samples(duration, 512, 15)
+	if duration > 0 {
+		inactivity = 0x40 // INACTIVITY
+		if n == 0 {
+			n = 1
+		}
+	}
+	if err := d.updateRegister(WAKE_UP_DUR, 0x0F, n); err != nil {
+		return err
+	}
+	return d.updateRegister(WAKE_UP_THS, 0x40, inactivity)
+}
+
+// threshold returns an acceleration in µg in steps of 1/div of the range,
+// up to max.
+func (d *Device) threshold(v int32, div, max int64) uint8 {
+	fs := int64(2000000)
+	switch d.accelRange {
+	case ACCEL_4G:
+		fs = 4000000
+	case ACCEL_8G:
+		fs = 8000000
+	case ACCEL_16G:
+		fs = 16000000
+	}
+	n := (int64(v)*div + fs/2) / fs
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return uint8(max)
+	}
+	return uint8(n)
+}
+
+// samples returns a duration in units of per samples at the sample rate of
+// the accelerometer, up to max.
+func (d *Device) samples(t time.Duration, per, max int64) uint8 {
+	// in mHz, from ACCEL_SR_13 to ACCEL_SR_13330
+	rates := [...]int64{12500, 26000, 52000, 104000, 208000, 416000, 833000, 1660000, 3330000, 6660000, 13330000}
+	i := int(d.accelSampleRate>>4) - 1
+	if i < 0 || i >= len(rates) {
+		return 0
+	}
+	n := (int64(t)*rates[i]/(1000*int64(time.Second)) + per/2) / per
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return uint8(max)
+	}
+	return uint8(n)
+}
@@ -27,6 +27,7 @@ type Device struct {
 	gyroSampleRate  GyroSampleRate
 	dataBufferSix   []uint8
 	dataBufferTwo   []uint8
+	fifoGyro        bool
 }
 
 // Configuration for LSM6DS3 device.
@@ -128,15 +129,7 @@ func (d *Device) Connected() bool {
 // -1000000.
 func (d *Device) ReadAcceleration() (x int32, y int32, z int32) {
 	d.bus.ReadRegister(uint8(d.Address), OUTX_L_XL, d.dataBufferSix)
-	// k comes from "Table 3. Mechanical characteristics" 3 of the datasheet * 1000
-	k := int32(61) // 2G
-	if d.accelRange == ACCEL_4G {
-		k = 122
-	} else if d.accelRange == ACCEL_8G {
-		k = 244
-	} else if d.accelRange == ACCEL_16G {
-		k = 488
-	}
+	k := d.accelScale()
 	x = int32(int16((uint16(d.dataBufferSix[1])<<8)|uint16(d.dataBufferSix[0]))) * k
 	y = int32(int16((uint16(d.dataBufferSix[3])<<8)|uint16(d.dataBufferSix[2]))) * k
 	z = int32(int16((uint16(d.dataBufferSix[5])<<8)|uint16(d.dataBufferSix[4]))) * k
@@ -149,6 +142,29 @@ func (d *Device) ReadAcceleration() (x int32, y int32, z int32) {
 // you would get a value close to 360000000.
 func (d *Device) ReadRotation() (x int32, y int32, z int32) {
 	d.bus.ReadRegister(uint8(d.Address), OUTX_L_G, d.dataBufferSix)
+	k := d.gyroScale()
+	x = int32(int16((uint16(d.dataBufferSix[1])<<8)|uint16(d.dataBufferSix[0]))) * k
+	y = int32(int16((uint16(d.dataBufferSix[3])<<8)|uint16(d.dataBufferSix[2]))) * k
+	z = int32(int16((uint16(d.dataBufferSix[5])<<8)|uint16(d.dataBufferSix[4]))) * k
+	return
+}
+
+// accelScale returns the acceleration in µg of a unit of the raw values.
+func (d *Device) accelScale() int32 {
+	// k comes from "Table 3. Mechanical characteristics" 3 of the datasheet * 1000
+	k := int32(61) // 2G
+	if d.accelRange == ACCEL_4G {
+		k = 122
+	} else if d.accelRange == ACCEL_8G {
+		k = 244
+	} else if d.accelRange == ACCEL_16G {
+		k = 488
+	}
+	return k
+}
+
+// gyroScale returns the rotation in µ°/s of a unit of the raw values.
+func (d *Device) gyroScale() int32 {
 	// k comes from "Table 3. Mechanical characteristics" 3 of the datasheet * 1000
 	k := int32(4375) // 125DPS
 	if d.gyroRange == GYRO_250DPS {
@@ -160,10 +176,7 @@ func (d *Device) ReadRotation() (x int32, y int32, z int32) {
 	} else if d.gyroRange == GYRO_2000DPS {
 		k = 70000
 	}
-	x = int32(int16((uint16(d.dataBufferSix[1])<<8)|uint16(d.dataBufferSix[0]))) * k
-	y = int32(int16((uint16(d.dataBufferSix[3])<<8)|uint16(d.dataBufferSix[2]))) * k
-	z = int32(int16((uint16(d.dataBufferSix[5])<<8)|uint16(d.dataBufferSix[4]))) * k
-	return
+	return k
 }
 
 // ReadTemperature returns the temperature in celsius milli degrees (°C/1000)
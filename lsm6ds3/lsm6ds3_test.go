@@ -0,0 +1,312 @@
+package lsm6ds3_test
+
+import (
+	"machine"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/lsm6ds3"
+)
+
+// chip simulates the registers of a LSM6DS3 through the I2C hooks of the
+// machine package. Reads of FIFO_DATA_OUT_L pop values of 16 bits from fifo,
+// and FIFO_STATUS1 to FIFO_STATUS4 follow them.
+type chip struct {
+	regs    [128]byte
+	fifo    []int16
+	words   int // values of a sample
+	pattern int // position in its sample of the first value of fifo
+	burst   []int
+}
+
+func newChip(t *testing.T) (*chip, lsm6ds3.Device) {
+	c := &chip{words: 3}
+	machine.ReadHook = func(addr, reg uint8, buf []byte) error {
+		if addr != lsm6ds3.Address {
+			t.Errorf("read from address %#x", addr)
+		}
+		if reg == lsm6ds3.FIFO_DATA_OUT_L {
+			c.burst = append(c.burst, len(buf))
+			for i := 0; i+1 < len(buf); i += 2 {
+				if len(c.fifo) == 0 {
+					t.Fatal("read past the end of the FIFO")
+				}
+				buf[i], buf[i+1] = byte(c.fifo[0]), byte(c.fifo[0]>>8)
+				c.fifo = c.fifo[1:]
+				c.pattern = (c.pattern + 1) % c.words
+			}
+			c.update()
+			return nil
+		}
+		copy(buf, c.regs[reg:])
+		return nil
+	}
+	machine.WriteHook = func(addr, reg uint8, buf []byte) error {
+		copy(c.regs[reg:], buf)
+		return nil
+	}
+	t.Cleanup(func() { machine.ReadHook, machine.WriteHook = nil, nil })
+	d := lsm6ds3.New(machine.I2C0)
+	d.Configure(lsm6ds3.Configuration{
+		AccelRange:      lsm6ds3.ACCEL_4G,
+		AccelSampleRate: lsm6ds3.ACCEL_SR_104,
+		GyroRange:       lsm6ds3.GYRO_500DPS,
+		GyroSampleRate:  lsm6ds3.GYRO_SR_104,
+	})
+	return c, d
+}
+
+// load fills the FIFO with values, starting at position pattern of a
+// sample of the given number of values.
+func (c *chip) load(words, pattern int, values ...int16) {
+	c.words, c.pattern = words, pattern
+	c.fifo = values
+	c.burst = nil
+	c.update()
+}
+
+func (c *chip) update() {
+	n := len(c.fifo)
+	c.regs[lsm6ds3.FIFO_STATUS1] = uint8(n)
+	c.regs[lsm6ds3.FIFO_STATUS2] = uint8(n>>8) & 0x0F
+	if n == 0 {
+		c.regs[lsm6ds3.FIFO_STATUS2] |= 0x10 // FIFO_EMPTY
+	}
+	c.regs[lsm6ds3.FIFO_STATUS3] = uint8(c.pattern)
+	c.regs[lsm6ds3.FIFO_STATUS4] = uint8(c.pattern >> 8)
+}
+
+func TestConfigureFIFO(t *testing.T) {
+	c, d := newChip(t)
+	for _, tc := range []struct {
+		cfg  lsm6ds3.FIFOConfig
+		regs [5]uint8 // FIFO_CTRL1 to FIFO_CTRL5
+	}{
+		// the watermark is counted in values, and the rate is that of the
+		// accelerometer
+		{lsm6ds3.FIFOConfig{Mode: lsm6ds3.FIFO_STREAM, Watermark: 10, Gyro: true}, [5]uint8{60, 0, 0x09, 0, 0x26}},
+		{lsm6ds3.FIFOConfig{Mode: lsm6ds3.FIFO_FIFO, Watermark: 100}, [5]uint8{44, 1, 0x01, 0, 0x21}},
+		{lsm6ds3.FIFOConfig{Mode: lsm6ds3.FIFO_STREAM, Watermark: 1000, Gyro: true}, [5]uint8{0xFF, 0x0F, 0x09, 0, 0x26}},
+	} {
+		if err := d.ConfigureFIFO(tc.cfg); err != nil {
+			t.Fatal(err)
+		}
+		var got [5]uint8
+		copy(got[:], c.regs[lsm6ds3.FIFO_CTRL1:])
+		if got != tc.regs {
+			t.Errorf("%+v: got %#02x, want %#02x", tc.cfg, got, tc.regs)
+		}
+	}
+}
+
+func TestFIFOCount(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(lsm6ds3.FIFOConfig{Mode: lsm6ds3.FIFO_STREAM}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		status [2]uint8
+		want   int
+	}{
+		{[2]uint8{0, 0x10}, 0},       // FIFO_EMPTY
+		{[2]uint8{7, 0x80}, 2},       // FTH, and a partial sample
+		{[2]uint8{0xFF, 0x2F}, 1365}, // FIFO_FULL with 4095 values
+	} {
+		c.regs[lsm6ds3.FIFO_STATUS1], c.regs[lsm6ds3.FIFO_STATUS2] = tc.status[0], tc.status[1]
+		if n, err := d.FIFOCount(); n != tc.want || err != nil {
+			t.Errorf("FIFO_STATUS %#02x: got %d, %v, want %d", tc.status, n, err, tc.want)
+		}
+	}
+}
+
+func TestReadFIFO(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(lsm6ds3.FIFOConfig{Mode: lsm6ds3.FIFO_STREAM}); err != nil {
+		t.Fatal(err)
+	}
+	var values []int16
+	for i := int16(0); i < 20; i++ {
+		values = append(values, i, -i, 8197)
+	}
+	c.load(3, 0, values...)
+	samples := make([]lsm6ds3.FIFOSample, 32)
+	n, err := d.ReadFIFO(samples)
+	if n != 20 || err != nil {
+		t.Fatalf("got %d samples, %v, want 20", n, err)
+	}
+	// at most 8 samples per read
+	if len(c.burst) != 3 || c.burst[0] != 48 || c.burst[1] != 48 || c.burst[2] != 24 {
+		t.Errorf("read bursts of %d bytes, want 48, 48 and 24", c.burst)
+	}
+	for i, s := range samples[:n] {
+		// 122 µg per unit at ±4 g
+		want := lsm6ds3.FIFOSample{Accel: [3]int32{int32(i) * 122, -int32(i) * 122, 1000034}}
+		if s != want {
+			t.Errorf("sample %d: got %+v, want %+v", i, s, want)
+		}
+	}
+}
+
+// TestAlignFIFO checks that ReadFIFO drops the rest of a sample that was
+// partly overwritten.
+func TestAlignFIFO(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(lsm6ds3.FIFOConfig{Mode: lsm6ds3.FIFO_STREAM, Gyro: true}); err != nil {
+		t.Fatal(err)
+	}
+	// the last 4 values of a sample, then 2 samples of the rotation and the
+	// acceleration
+	c.load(6, 2,
+		-1, -1, -1, -1,
+		100, -100, 0, 1000, 0, -1000,
+		1, 2, 3, 4, 5, 6,
+	)
+	samples := make([]lsm6ds3.FIFOSample, 4)
+	n, err := d.ReadFIFO(samples)
+	if n != 2 || err != nil {
+		t.Fatalf("got %d samples, %v, want 2", n, err)
+	}
+	if len(c.burst) != 5 || c.burst[0] != 2 || c.burst[4] != 24 {
+		t.Errorf("read bursts of %d bytes, want 4 of 2 and one of 24", c.burst)
+	}
+	// 17.5 m°/s per unit at ±500 °/s
+	want := []lsm6ds3.FIFOSample{
+		{Gyro: [3]int32{1750000, -1750000, 0}, Accel: [3]int32{122000, 0, -122000}},
+		{Gyro: [3]int32{17500, 35000, 52500}, Accel: [3]int32{488, 610, 732}},
+	}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d: got %+v, want %+v", i, samples[i], want[i])
+		}
+	}
+
+	// aligned
+	c.load(6, 0, 1, 2, 3, 4, 5, 6)
+	if n, err := d.ReadFIFO(samples); n != 1 || err != nil || len(c.burst) != 1 {
+		t.Errorf("got %d samples in %d reads, %v, want 1 in 1", n, len(c.burst), err)
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	c, d := newChip(t)
+	c.regs[lsm6ds3.INT1_CTRL] = 0xC4
+	c.regs[lsm6ds3.MD1_CFG] = 0x07
+	err := d.ConfigureInterrupts(lsm6ds3.INT_WATERMARK|lsm6ds3.INT_SINGLE_TAP|lsm6ds3.INT_FREE_FALL, lsm6ds3.INT_ACTIVITY|lsm6ds3.INT_INACTIVITY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the other bits of the registers are kept
+	for _, r := range []struct{ reg, want uint8 }{
+		{lsm6ds3.INT1_CTRL, 0xCC},
+		{lsm6ds3.MD1_CFG, 0x57},
+		{lsm6ds3.INT2_CTRL, 0},
+		{lsm6ds3.MD2_CFG, 0xA0},
+		{lsm6ds3.TAP_CFG, 0x01},
+	} {
+		if got := c.regs[r.reg]; got != r.want {
+			t.Errorf("register %#02x: got %#02x, want %#02x", r.reg, got, r.want)
+		}
+	}
+
+	c.regs[lsm6ds3.STATUS] = 0x03
+	c.regs[lsm6ds3.FIFO_STATUS2] = 0x80 | 0x20
+	c.regs[lsm6ds3.WAKE_UP_SRC] = 0x20 | 0x08
+	c.regs[lsm6ds3.TAP_SRC] = 0x10
+	want := lsm6ds3.INT_DATA_READY | lsm6ds3.INT_GYRO_DATA_READY | lsm6ds3.INT_WATERMARK | lsm6ds3.INT_FIFO_FULL |
+		lsm6ds3.INT_FREE_FALL | lsm6ds3.INT_ACTIVITY | lsm6ds3.INT_DOUBLE_TAP
+	if ints, err := d.ReadInterrupts(); ints != want || err != nil {
+		t.Errorf("got %#04x, %v, want %#04x", ints, err, want)
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		preset    uint8
+		configure func(d *lsm6ds3.Device) error
+		regs      map[uint8]uint8
+	}{
+		{"tap", 0, func(d *lsm6ds3.Device) error {
+			return d.ConfigureTap(lsm6ds3.TapConfig{
+				Threshold: 1500000,
+				Duration:  80 * time.Millisecond,
+				Latency:   40 * time.Millisecond,
+				Window:    300 * time.Millisecond,
+				Axes:      lsm6ds3.AXIS_ALL,
+			})
+		}, map[uint8]uint8{
+			// 1/32 of ±4 g per step, samples at 104 Hz
+			lsm6ds3.TAP_THS_6D:  12,
+			lsm6ds3.INT_DUR2:    0x15,
+			lsm6ds3.WAKE_UP_THS: 0x80,
+			lsm6ds3.TAP_CFG:     0x0E,
+		}},
+		{"tap limits", 0xFF, func(d *lsm6ds3.Device) error {
+			return d.ConfigureTap(lsm6ds3.TapConfig{
+				Threshold: 20000000,
+				Duration:  time.Second,
+				Latency:   time.Second,
+				Axes:      lsm6ds3.AXIS_Y,
+			})
+		}, map[uint8]uint8{
+			lsm6ds3.TAP_THS_6D:  0xFF,
+			lsm6ds3.INT_DUR2:    0x0F,
+			lsm6ds3.WAKE_UP_THS: 0x7F,
+			lsm6ds3.TAP_CFG:     0xF5,
+		}},
+		{"free fall", 0, func(d *lsm6ds3.Device) error {
+			return d.ConfigureFreeFall(300000, 400*time.Millisecond)
+		}, map[uint8]uint8{
+			// 41 samples, of which bit 5 goes to WAKE_UP_DUR, and 312 mg
+			lsm6ds3.WAKE_UP_DUR: 0x80,
+			lsm6ds3.FREE_FALL:   0x4B,
+		}},
+		{"free fall limits", 0xFF, func(d *lsm6ds3.Device) error {
+			return d.ConfigureFreeFall(600000, 100*time.Millisecond)
+		}, map[uint8]uint8{
+			lsm6ds3.WAKE_UP_DUR: 0x7F,
+			lsm6ds3.FREE_FALL:   10<<3 | 7,
+		}},
+		{"activity", 0xFF, func(d *lsm6ds3.Device) error {
+			return d.ConfigureActivity(500000, 10*time.Millisecond)
+		}, map[uint8]uint8{
+			// 1/64 of ±4 g per step
+			lsm6ds3.WAKE_UP_THS: 0xC8,
+			lsm6ds3.WAKE_UP_DUR: 0xBF,
+		}},
+		{"inactivity", 0, func(d *lsm6ds3.Device) error {
+			return d.ConfigureInactivity(10 * time.Second)
+		}, map[uint8]uint8{
+			// 512 samples per step
+			lsm6ds3.WAKE_UP_DUR: 2,
+			lsm6ds3.WAKE_UP_THS: 0x40,
+		}},
+		{"short inactivity", 0, func(d *lsm6ds3.Device) error {
+			return d.ConfigureInactivity(time.Second)
+		}, map[uint8]uint8{
+			lsm6ds3.WAKE_UP_DUR: 1,
+			lsm6ds3.WAKE_UP_THS: 0x40,
+		}},
+		{"no inactivity", 0xFF, func(d *lsm6ds3.Device) error {
+			return d.ConfigureInactivity(0)
+		}, map[uint8]uint8{
+			lsm6ds3.WAKE_UP_DUR: 0xF0,
+			lsm6ds3.WAKE_UP_THS: 0xBF,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, d := newChip(t)
+			for reg := range tc.regs {
+				c.regs[reg] = tc.preset
+			}
+			if err := tc.configure(&d); err != nil {
+				t.Fatal(err)
+			}
+			for reg, want := range tc.regs {
+				if got := c.regs[reg]; got != want {
+					t.Errorf("register %#02x: got %#02x, want %#02x", reg, got, want)
+				}
+			}
+		})
+	}
+}
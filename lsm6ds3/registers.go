@@ -41,6 +41,27 @@ const (
 	STEP_COUNT_DELTA     = 0x15
 	TAP_CFG              = 0x58
 	INT1_CTRL            = 0x0D
+	INT2_CTRL            = 0x0E
+	FIFO_CTRL1           = 0x06
+	FIFO_CTRL2           = 0x07
+	FIFO_CTRL3           = 0x08
+	FIFO_CTRL4           = 0x09
+	FIFO_CTRL5           = 0x0A
+	FIFO_STATUS1         = 0x3A
+	FIFO_STATUS2         = 0x3B
+	FIFO_STATUS3         = 0x3C
+	FIFO_STATUS4         = 0x3D
+	FIFO_DATA_OUT_L      = 0x3E
+	FIFO_DATA_OUT_H      = 0x3F
+	WAKE_UP_SRC          = 0x1B
+	TAP_SRC              = 0x1C
+	TAP_THS_6D           = 0x59
+	INT_DUR2             = 0x5A
+	WAKE_UP_THS          = 0x5B
+	WAKE_UP_DUR          = 0x5C
+	FREE_FALL            = 0x5D
+	MD1_CFG              = 0x5E
+	MD2_CFG              = 0x5F
 
 	ACCEL_2G  AccelRange = 0x00
 	ACCEL_4G  AccelRange = 0x08
@@ -81,3 +102,43 @@ const (
 	GYRO_SR_833  GyroSampleRate = 0x70
 	GYRO_SR_1666 GyroSampleRate = 0x80
 )
+
+// FIFOMode is the mode of the FIFO of 4096 values of 16 bits.
+type FIFOMode uint8
+
+// FIFO modes.
+const (
+	FIFO_BYPASS           FIFOMode = 0 // no FIFO
+	FIFO_FIFO             FIFOMode = 1 // collect samples until full, then stop
+	FIFO_STREAM_TO_FIFO   FIFOMode = 3 // stream until an event, then collect until full
+	FIFO_BYPASS_TO_STREAM FIFOMode = 4 // no FIFO until an event, then stream
+	FIFO_STREAM           FIFOMode = 6 // keep the latest samples, dropping the oldest
+)
+
+// Interrupt is a set of interrupts.
+type Interrupt uint16
+
+// Interrupts.
+const (
+	INT_DATA_READY      Interrupt = 0x0001
+	INT_GYRO_DATA_READY Interrupt = 0x0002
+	INT_WATERMARK       Interrupt = 0x0008
+	INT_OVERRUN         Interrupt = 0x0010
+	INT_FIFO_FULL       Interrupt = 0x0020
+	INT_DOUBLE_TAP      Interrupt = 0x0800
+	INT_FREE_FALL       Interrupt = 0x1000
+	INT_ACTIVITY        Interrupt = 0x2000
+	INT_SINGLE_TAP      Interrupt = 0x4000
+	INT_INACTIVITY      Interrupt = 0x8000
+)
+
+// Axes is a set of axes, for the detection of taps.
+type Axes uint8
+
+// Axes.
+const (
+	AXIS_X   Axes = 0x04
+	AXIS_Y   Axes = 0x02
+	AXIS_Z   Axes = 0x01
+	AXIS_ALL Axes = AXIS_X | AXIS_Y | AXIS_Z
+)
@@ -0,0 +1,206 @@
+package mpu6050
+
+import "errors"
+
+// ErrFIFOOverflow is returned by ReadFIFO when the FIFO was full, and has
+// been emptied.
+var ErrFIFOOverflow = errors.New("mpu6050: FIFO overflow")
+
+// fifoSize is the size of the FIFO in bytes.
+const fifoSize = 1024
+
+// FIFOConfig configures the FIFO.
+type FIFOConfig struct {
+	Accel bool // store the acceleration
+	Gyro  bool // store the rotation
+}
+
+// FIFOSample is a sample of the FIFO, in µg and µ°/s.
+type FIFOSample struct {
+	Accel [3]int32 // zero unless FIFOConfig.Accel
+	Gyro  [3]int32 // zero unless FIFOConfig.Gyro
+}
+
+// ConfigureFIFO empties the FIFO of 1024 bytes, and enables it if any of
+// the measurements is stored, or disables it. Samples are stored at the
+// sample rate set by SetSampleRate. A sample takes 6 bytes per measurement,
+// so the FIFO holds 85 samples of both, and it must be read before it
+// fills. There is no watermark. A full FIFO drops its oldest bytes rather
+// than whole samples, so what remains is no longer aligned to samples;
+// INT_FIFO_OVERFLOW is raised, and ReadFIFO discards the data.
+func (d Device) ConfigureFIFO(cfg FIFOConfig) error {
+	var enable uint8
+	if cfg.Accel {
+		enable |= 0x08 // ACCEL_FIFO_EN
+	}
+	if cfg.Gyro {
+		enable |= 0x70 // XG_FIFO_EN, YG_FIFO_EN and ZG_FIFO_EN
+	}
+	// stop the FIFO before changing what it stores
+	if err := d.updateRegister(USER_CTRL, 0x40, 0); err != nil {
+		return err
+	}
+	if err := d.bus.WriteRegister(uint8(d.Address), FIFO_EN, []byte{enable}); err != nil {
+		return err
+	}
+	return d.resetFIFO(enable != 0)
+}
+
+// resetFIFO stops and empties the FIFO, and starts it again if enable.
+func (d Device) resetFIFO(enable bool) error {
+	if err := d.updateRegister(USER_CTRL, 0x40, 0); err != nil {
+		return err
+	}
+	if err := d.updateRegister(USER_CTRL, 0x04, 0x04); err != nil { // FIFO_RESET
+		return err
+	}
+	if !enable {
+		return nil
+	}
+	return d.updateRegister(USER_CTRL, 0x40, 0x40) // FIFO_EN
+}
+
+// fifoLayout returns whether the FIFO stores the acceleration and the
+// rotation, and the size of a sample in bytes.
+func (d Device) fifoLayout() (accel, gyro bool, size int, err error) {
+	data := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), FIFO_EN, data); err != nil {
+		return false, false, 0, err
+	}
+	accel = data[0]&0x08 != 0
+	gyro = data[0]&0x70 == 0x70
+	if accel {
+		size += 6
+	}
+	if gyro {
+		size += 6
+	}
+	return accel, gyro, size, nil
+}
+
+// FIFOCount returns the number of samples in the FIFO.
+func (d Device) FIFOCount() (int, error) {
+	_, _, size, err := d.fifoLayout()
+	if err != nil || size == 0 {
+		return 0, err
+	}
+	n, err := d.fifoBytes()
+	return n / size, err
+}
+
+// fifoBytes returns the number of bytes in the FIFO.
+func (d Device) fifoBytes() (int, error) {
+	data := []byte{0, 0}
+	if err := d.bus.ReadRegister(uint8(d.Address), FIFO_COUNTH, data); err != nil {
+		return 0, err
+	}
+	return int(data[0])<<8 | int(data[1]), nil
+}
+
+// ReadFIFO reads the oldest samples of the FIFO into samples, and returns
+// how many it read: at most len(samples), and at most the number in the
+// FIFO. If the FIFO is full, its data is no longer aligned to samples:
+// ReadFIFO empties it and returns ErrFIFOOverflow, and the next samples
+// are stored from the start of the FIFO.
+func (d Device) ReadFIFO(samples []FIFOSample) (int, error) {
+	accel, gyro, size, err := d.fifoLayout()
+	if err != nil || size == 0 {
+		return 0, err
+	}
+	n, err := d.fifoBytes()
+	if err != nil {
+		return 0, err
+	}
+	if n >= fifoSize {
+		// neither 6 nor 12 divides 1024, so a full FIFO has dropped bytes
+		if err := d.resetFIFO(true); err != nil {
+			return 0, err
+		}
+		return 0, ErrFIFOOverflow
+	}
+	count := n / size
+	if count > len(samples) {
+		count = len(samples)
+	}
+
+	// Successive reads of FIFO_R_W return successive bytes of the FIFO, so
+	// several samples can be read at once.
+	var data [8 * 12]byte
+	for n := 0; n < count; {
+		chunk := count - n
+		if chunk > 8 {
+			chunk = 8
+		}
+		buf := data[:chunk*size]
+		if err := d.bus.ReadRegister(uint8(d.Address), FIFO_R_W, buf); err != nil {
+			return n, err
+		}
+		for i := 0; i < chunk; i++ {
+			b := buf[i*size:]
+			s := &samples[n+i]
+			*s = FIFOSample{}
+			// in the order of the registers, and scaled as in ReadAcceleration
+			// and ReadRotation
+			if accel {
+				for j := range s.Accel {
+					s.Accel[j] = int32(int16(uint16(b[2*j])<<8|uint16(b[2*j+1]))) * 15625 / 256
+				}
+				b = b[6:]
+			}
+			if gyro {
+				for j := range s.Gyro {
+					s.Gyro[j] = int32(int16(uint16(b[2*j])<<8|uint16(b[2*j+1]))) * 15625 / 2048 * 1000
+				}
+			}
+		}
+		n += chunk
+	}
+	return count, nil
+}
+
+// SetSampleRate sets the sample rate of the measurements, the FIFO and
+// INT_DATA_READY, in Hz. It is divided from the rate of the gyroscope, 8
+// kHz, or 1 kHz when its low pass filter is enabled. The accelerometer is
+// measured at 1 kHz, so above that the same acceleration is repeated.
+func (d Device) SetSampleRate(hz uint16) error {
+	data := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), CONFIG, data); err != nil {
+		return err
+	}
+	base := uint32(1000)
+	if dlpf := data[0] & 0x07; dlpf == 0 || dlpf == 7 {
+		base = 8000
+	}
+	div := uint32(256)
+	if hz > 0 {
+		div = (base + uint32(hz)/2) / uint32(hz)
+	}
+	if div < 1 {
+		div = 1
+	}
+	if div > 256 {
+		div = 256
+	}
+	// the rate is base / (1 + SMPLRT_DIV)
+	return d.bus.WriteRegister(uint8(d.Address), SMPLRT_DIV, []byte{uint8(div - 1)})
+}
+
+// writeRegisters writes pairs of register and value.
+func (d Device) writeRegisters(pairs ...uint8) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := d.bus.WriteRegister(uint8(d.Address), pairs[i], pairs[i+1:i+2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateRegister sets the bits of mask in a register to those of value.
+func (d Device) updateRegister(reg, mask, value uint8) error {
+	data := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), reg, data); err != nil {
+		return err
+	}
+	data[0] = data[0]&^mask | value&mask
+	return d.bus.WriteRegister(uint8(d.Address), reg, data)
+}
@@ -0,0 +1,85 @@
+package mpu6050
+
+import "time"
+
+// ConfigureInterrupts enables the interrupts in ints, signaled on the INT
+// pin, which is active high and latched until ReadInterrupts. The MPU6050
+// has no detection of taps.
+func (d Device) ConfigureInterrupts(ints Interrupt) error {
+	return d.writeRegisters(
+		INT_PIN_CFG, 0x20, // LATCH_INT_EN
+		INT_ENABLE, uint8(ints),
+	)
+}
+
+// ReadInterrupts returns the interrupts raised, and clears them. The device
+// also interrupts when inactivity ends, which is not reported as
+// INT_INACTIVITY.
+func (d Device) ReadInterrupts() (Interrupt, error) {
+	data := []byte{0}
+	if err := d.bus.ReadRegister(uint8(d.Address), INT_STATUS, data); err != nil {
+		return 0, err
+	}
+	ints := Interrupt(data[0]) & (INT_FREE_FALL | INT_ACTIVITY | INT_INACTIVITY | INT_FIFO_OVERFLOW | INT_DATA_READY)
+	if ints&INT_INACTIVITY != 0 {
+		if err := d.bus.ReadRegister(uint8(d.Address), MOT_DETECT_STATUS, data); err != nil {
+			return 0, err
+		}
+		if data[0]&0x01 == 0 { // ZRMOT
+			ints &^= INT_INACTIVITY
+		}
+	}
+	return ints, nil
+}
+
+// ConfigureFreeFall configures the detection of free fall, which raises
+// INT_FREE_FALL when the acceleration on all axes stays below threshold, in
+// µg up to 510 mg, for duration, up to 255 ms.
+func (d Device) ConfigureFreeFall(threshold int32, duration time.Duration) error {
+	return d.writeRegisters(
+		FF_THR, scale(int64(threshold), 2000),
+		FF_DUR, scale(int64(duration), int64(time.Millisecond)),
+	)
+}
+
+// ConfigureActivity configures the detection of activity, which raises
+// INT_ACTIVITY when the acceleration on any axis, high-pass filtered so that
+// gravity is ignored, exceeds threshold in µg, up to 510 mg, for duration,
+// up to 255 ms. The filter also applies to free fall and inactivity.
+func (d Device) ConfigureActivity(threshold int32, duration time.Duration) error {
+	err := d.writeRegisters(
+		MOT_THR, scale(int64(threshold), 2000),
+		MOT_DUR, scale(int64(duration), int64(time.Millisecond)),
+	)
+	if err != nil {
+		return err
+	}
+	return d.updateRegister(ACCEL_CONFIG, 0x07, 0x01) // ACCEL_HPF at 5 Hz
+}
+
+// ConfigureInactivity configures the detection of inactivity, which raises
+// INT_INACTIVITY when the acceleration on all axes, high-pass filtered as
+// for activity, stays below threshold in µg, up to 510 mg, for duration, up
+// to 16 s.
+func (d Device) ConfigureInactivity(threshold int32, duration time.Duration) error {
+	err := d.writeRegisters(
+		ZRMOT_THR, scale(int64(threshold), 2000),
+		ZRMOT_DUR, scale(int64(duration), int64(64*time.Millisecond)),
+	)
+	if err != nil {
+		return err
+	}
+	return d.updateRegister(ACCEL_CONFIG, 0x07, 0x01) // ACCEL_HPF at 5 Hz
+}
+
+// scale returns v in units of lsb, rounded and clamped to a byte.
+func scale(v, lsb int64) uint8 {
+	n := (v + lsb/2) / lsb
+	if n < 0 {
+		return 0
+	}
+	if n > 255 {
+		return 255
+	}
+	return uint8(n)
+}
@@ -0,0 +1,287 @@
+package mpu6050_test
+
+import (
+	"machine"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/mpu6050"
+)
+
+// chip simulates the registers of a MPU6050 through the I2C hooks of the
+// machine package. Reads of FIFO_R_W pop bytes from fifo, and FIFO_COUNTH
+// and FIFO_COUNTL count them.
+type chip struct {
+	regs     [128]byte
+	fifo     []byte
+	userCtrl []uint8 // values written to USER_CTRL
+	burst    []int
+}
+
+func newChip(t *testing.T) (*chip, mpu6050.Device) {
+	c := &chip{}
+	machine.ReadHook = func(addr, reg uint8, buf []byte) error {
+		if addr != mpu6050.Address {
+			t.Errorf("read from address %#x", addr)
+		}
+		if reg == mpu6050.FIFO_R_W {
+			c.burst = append(c.burst, len(buf))
+			if len(buf) > len(c.fifo) {
+				t.Fatal("read past the end of the FIFO")
+			}
+			c.fifo = c.fifo[copy(buf, c.fifo):]
+			c.count()
+			return nil
+		}
+		copy(buf, c.regs[reg:])
+		return nil
+	}
+	machine.WriteHook = func(addr, reg uint8, buf []byte) error {
+		copy(c.regs[reg:], buf)
+		if reg == mpu6050.USER_CTRL {
+			c.userCtrl = append(c.userCtrl, buf[0])
+			if buf[0]&0x04 != 0 { // FIFO_RESET clears itself
+				c.fifo = nil
+				c.count()
+				c.regs[reg] &^= 0x04
+			}
+		}
+		return nil
+	}
+	t.Cleanup(func() { machine.ReadHook, machine.WriteHook = nil, nil })
+	return c, mpu6050.New(machine.I2C0)
+}
+
+func (c *chip) count() {
+	c.regs[mpu6050.FIFO_COUNTH] = uint8(len(c.fifo) >> 8)
+	c.regs[mpu6050.FIFO_COUNTL] = uint8(len(c.fifo))
+}
+
+// push adds the big endian values of a sample to the FIFO.
+func (c *chip) push(values ...int16) {
+	for _, v := range values {
+		c.fifo = append(c.fifo, byte(v>>8), byte(v))
+	}
+	c.count()
+}
+
+func TestConfigureFIFO(t *testing.T) {
+	c, d := newChip(t)
+	c.regs[mpu6050.USER_CTRL] = 0x40
+	c.push(1, 2, 3)
+	if err := d.ConfigureFIFO(mpu6050.FIFOConfig{Accel: true, Gyro: true}); err != nil {
+		t.Fatal(err)
+	}
+	if c.regs[mpu6050.FIFO_EN] != 0x78 || len(c.fifo) != 0 {
+		t.Errorf("FIFO_EN %#02x with %d bytes in the FIFO", c.regs[mpu6050.FIFO_EN], len(c.fifo))
+	}
+	// stopped, reset, and started again
+	if want := []uint8{0x00, 0x00, 0x04, 0x40}; !equal(c.userCtrl, want) {
+		t.Errorf("wrote USER_CTRL %#02x, want %#02x", c.userCtrl, want)
+	}
+
+	c.userCtrl = nil
+	if err := d.ConfigureFIFO(mpu6050.FIFOConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint8{0x00, 0x00, 0x04}; c.regs[mpu6050.FIFO_EN] != 0 || !equal(c.userCtrl, want) {
+		t.Errorf("FIFO_EN %#02x, wrote USER_CTRL %#02x, want %#02x", c.regs[mpu6050.FIFO_EN], c.userCtrl, want)
+	}
+}
+
+func TestFIFOCount(t *testing.T) {
+	c, d := newChip(t)
+	c.regs[mpu6050.FIFO_COUNTH], c.regs[mpu6050.FIFO_COUNTL] = 0x01, 0x02
+	for _, tc := range []struct {
+		enable uint8
+		want   int
+	}{
+		{0x08, 43}, // 258 bytes of samples of 6 bytes
+		{0x78, 21}, // of 12 bytes
+		{0x10, 0},  // a single axis of the gyroscope is not a sample
+		{0x00, 0},
+	} {
+		c.regs[mpu6050.FIFO_EN] = tc.enable
+		if n, err := d.FIFOCount(); n != tc.want || err != nil {
+			t.Errorf("FIFO_EN %#02x: got %d, %v, want %d", tc.enable, n, err, tc.want)
+		}
+	}
+}
+
+func TestReadFIFO(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(mpu6050.FIFOConfig{Accel: true, Gyro: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := int16(0); i < 20; i++ {
+		c.push(i, -16384, 16384, 131, -131, i)
+	}
+	// one more byte of the next sample
+	c.fifo = append(c.fifo, 0)
+	c.count()
+
+	samples := make([]mpu6050.FIFOSample, 32)
+	n, err := d.ReadFIFO(samples)
+	if n != 20 || err != nil {
+		t.Fatalf("got %d samples, %v, want 20", n, err)
+	}
+	// at most 8 samples per read
+	if len(c.burst) != 3 || c.burst[0] != 96 || c.burst[1] != 96 || c.burst[2] != 48 {
+		t.Errorf("read bursts of %d bytes, want 96, 96 and 48", c.burst)
+	}
+	for i, s := range samples[:n] {
+		// 16384 per g, and 131 per °/s, at the default ranges
+		want := mpu6050.FIFOSample{
+			Accel: [3]int32{int32(i) * 15625 / 256, -1000000, 1000000},
+			Gyro:  [3]int32{999000, -999000, int32(i) * 15625 / 2048 * 1000},
+		}
+		if s != want {
+			t.Errorf("sample %d: got %+v, want %+v", i, s, want)
+		}
+	}
+	if len(c.fifo) != 1 {
+		t.Errorf("%d bytes left in the FIFO, want 1", len(c.fifo))
+	}
+}
+
+// TestReadFIFOOverflow checks that a full FIFO, which is no longer aligned
+// to samples, is emptied rather than read.
+func TestReadFIFOOverflow(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureFIFO(mpu6050.FIFOConfig{Accel: true}); err != nil {
+		t.Fatal(err)
+	}
+	for len(c.fifo) < 1024 {
+		c.push(1)
+	}
+	c.userCtrl = nil
+	samples := make([]mpu6050.FIFOSample, 8)
+	if n, err := d.ReadFIFO(samples); n != 0 || err != mpu6050.ErrFIFOOverflow {
+		t.Fatalf("got %d, %v, want %v", n, err, mpu6050.ErrFIFOOverflow)
+	}
+	if want := []uint8{0x00, 0x04, 0x40}; len(c.burst) != 0 || len(c.fifo) != 0 || !equal(c.userCtrl, want) {
+		t.Errorf("read %d times, %d bytes left, wrote USER_CTRL %#02x, want %#02x", len(c.burst), len(c.fifo), c.userCtrl, want)
+	}
+
+	// the next samples are aligned again
+	c.push(16384, 0, 0)
+	if n, err := d.ReadFIFO(samples); n != 1 || err != nil || samples[0].Accel[0] != 1000000 {
+		t.Errorf("got %d samples, %v, %+v", n, err, samples[0])
+	}
+}
+
+func TestSetSampleRate(t *testing.T) {
+	c, d := newChip(t)
+	for _, tc := range []struct {
+		config uint8
+		hz     uint16
+		div    uint8
+	}{
+		{0x00, 100, 79}, // 8 kHz without the low pass filter
+		{0x03, 100, 9},  // 1 kHz with it
+		{0x07, 1000, 7},
+		{0x03, 2000, 0},
+		{0x03, 0, 255},
+		{0x00, 1, 255},
+	} {
+		c.regs[mpu6050.CONFIG] = tc.config
+		if err := d.SetSampleRate(tc.hz); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.regs[mpu6050.SMPLRT_DIV]; got != tc.div {
+			t.Errorf("CONFIG %#02x, %d Hz: got SMPLRT_DIV %d, want %d", tc.config, tc.hz, got, tc.div)
+		}
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	c, d := newChip(t)
+	if err := d.ConfigureInterrupts(mpu6050.INT_FREE_FALL | mpu6050.INT_DATA_READY); err != nil {
+		t.Fatal(err)
+	}
+	if c.regs[mpu6050.INT_PIN_CFG] != 0x20 || c.regs[mpu6050.INT_ENABLE] != 0x81 {
+		t.Errorf("INT_PIN_CFG %#02x, INT_ENABLE %#02x", c.regs[mpu6050.INT_PIN_CFG], c.regs[mpu6050.INT_ENABLE])
+	}
+
+	// the zero motion interrupt is also raised when motion starts again,
+	// and I2C_MST_INT is not reported
+	c.regs[mpu6050.INT_STATUS] = 0x20 | 0x10 | 0x08
+	for _, tc := range []struct {
+		status uint8
+		want   mpu6050.Interrupt
+	}{
+		{0x01, mpu6050.INT_INACTIVITY | mpu6050.INT_FIFO_OVERFLOW},
+		{0x00, mpu6050.INT_FIFO_OVERFLOW},
+	} {
+		c.regs[mpu6050.MOT_DETECT_STATUS] = tc.status
+		if ints, err := d.ReadInterrupts(); ints != tc.want || err != nil {
+			t.Errorf("MOT_DETECT_STATUS %#02x: got %#02x, %v, want %#02x", tc.status, ints, err, tc.want)
+		}
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(d mpu6050.Device) error
+		regs      map[uint8]uint8
+	}{
+		{"free fall", func(d mpu6050.Device) error {
+			return d.ConfigureFreeFall(400000, 100*time.Millisecond)
+		}, map[uint8]uint8{
+			// 2 mg and 1 ms per unit
+			mpu6050.FF_THR:       200,
+			mpu6050.FF_DUR:       100,
+			mpu6050.ACCEL_CONFIG: 0x1F,
+		}},
+		{"free fall limits", func(d mpu6050.Device) error {
+			return d.ConfigureFreeFall(-1, time.Second)
+		}, map[uint8]uint8{
+			mpu6050.FF_THR: 0,
+			mpu6050.FF_DUR: 255,
+		}},
+		{"activity", func(d mpu6050.Device) error {
+			return d.ConfigureActivity(20000, 5*time.Millisecond)
+		}, map[uint8]uint8{
+			mpu6050.MOT_THR: 10,
+			mpu6050.MOT_DUR: 5,
+			// the range is kept, and the high-pass filter set to 5 Hz
+			mpu6050.ACCEL_CONFIG: 0x19,
+		}},
+		{"inactivity", func(d mpu6050.Device) error {
+			return d.ConfigureInactivity(4000, time.Second)
+		}, map[uint8]uint8{
+			// 64 ms per unit
+			mpu6050.ZRMOT_THR:    2,
+			mpu6050.ZRMOT_DUR:    16,
+			mpu6050.ACCEL_CONFIG: 0x19,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, d := newChip(t)
+			for reg := range tc.regs {
+				c.regs[reg] = 0x1F
+			}
+			if err := tc.configure(d); err != nil {
+				t.Fatal(err)
+			}
+			for reg, want := range tc.regs {
+				if got := c.regs[reg]; got != want {
+					t.Errorf("register %#02x: got %d, want %d", reg, got, want)
+				}
+			}
+		})
+	}
+}
+
+func equal(a, b []uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -19,6 +19,14 @@ const (
 	ACCEL_CONFIG = 0x1C // Accelerometer configuration
 	FIFO_EN      = 0x23 // FIFO enable
 
+	// Motion detection, from revision 3.2 of the register map
+	FF_THR    = 0x1D // Free fall acceleration threshold
+	FF_DUR    = 0x1E // Free fall duration
+	MOT_THR   = 0x1F // Motion detection threshold
+	MOT_DUR   = 0x20 // Motion detection duration
+	ZRMOT_THR = 0x21 // Zero motion detection threshold
+	ZRMOT_DUR = 0x22 // Zero motion detection duration
+
 	// I2C pass-through configuration
 	I2C_MST_CTRL   = 0x24
 	I2C_SLV0_ADDR  = 0x25
@@ -91,6 +99,8 @@ const (
 	EXT_SENS_DATA_22 = 0x5F
 	EXT_SENS_DATA_23 = 0x60
 
+	MOT_DETECT_STATUS = 0x61 // Motion detection status, from revision 3.2
+
 	// I2C slave data out
 	I2C_SLV0_DO      = 0x63
 	I2C_SLV1_DO      = 0x64
@@ -99,6 +109,7 @@ const (
 	I2C_MST_DELAY_CT = 0x67
 
 	SIGNAL_PATH_RES = 0x68 // Signal path reset
+	MOT_DETECT_CTRL = 0x69 // Motion detection control, from revision 3.2
 	USER_CTRL       = 0x6A // User control
 	PWR_MGMT_1      = 0x6B // Power Management 1
 	PWR_MGMT_2      = 0x6C // Power Management 2
@@ -107,3 +118,16 @@ const (
 	FIFO_R_W        = 0x74 // FIFO read/write
 	WHO_AM_I        = 0x75 // Who am I
 )
+
+// Interrupt is a set of interrupts, with the bits of INT_ENABLE.
+type Interrupt uint8
+
+// Interrupts. INT_FREE_FALL, INT_ACTIVITY and INT_INACTIVITY come from
+// revision 3.2 of the register map.
+const (
+	INT_FREE_FALL     Interrupt = 0x80
+	INT_ACTIVITY      Interrupt = 0x40 // motion
+	INT_INACTIVITY    Interrupt = 0x20 // zero motion
+	INT_FIFO_OVERFLOW Interrupt = 0x10
+	INT_DATA_READY    Interrupt = 0x01
+)
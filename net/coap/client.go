@@ -0,0 +1,414 @@
+package coap
+
+import (
+	"io"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+)
+
+const (
+	// DefaultPort is the well-known CoAP port.
+	DefaultPort = 5683
+
+	// DefaultResponseTimeout is the time to wait for a separate response
+	// after a request has been acknowledged, or for the response to a
+	// non-confirmable request.
+	DefaultResponseTimeout = 30 * time.Second
+)
+
+// ResponseError is returned when a server answers with an error code.
+type ResponseError struct {
+	Code Code
+}
+
+func (e ResponseError) Error() string {
+	return "coap: server responded " + e.Code.String()
+}
+
+// Client sends requests to a single CoAP server.
+type Client struct {
+	endpoint
+
+	// AckTimeout is the initial retransmission timeout of confirmable
+	// requests, doubled after each retransmission.
+	AckTimeout time.Duration
+
+	// MaxRetransmit is the number of times a confirmable request is
+	// retransmitted before ErrTimeout is returned.
+	MaxRetransmit int
+
+	// ResponseTimeout is the time to wait for a separate response or the
+	// response to a non-confirmable request.
+	ResponseTimeout time.Duration
+
+	// BlockSize is the preferred block size for block-wise transfers. It is
+	// rounded down to a power of two between 16 and 1024.
+	BlockSize int
+
+	observations []*Observation
+}
+
+// Dial creates a client for the server at address, which is a host name or
+// IP address with an optional port.
+func Dial(address string) (*Client, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if raddr.Port == 0 {
+		raddr.Port = DefaultPort
+	}
+	conn, err := net.DialUDP("udp", &net.UDPAddr{Port: DefaultPort}, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient creates a client that exchanges datagrams over conn.
+func NewClient(conn io.ReadWriter) *Client {
+	c := &Client{
+		AckTimeout:      DefaultAckTimeout,
+		MaxRetransmit:   DefaultMaxRetransmit,
+		ResponseTimeout: DefaultResponseTimeout,
+		BlockSize:       DefaultBlockSize,
+	}
+	c.init(conn)
+	return c
+}
+
+// NewRequest returns a confirmable request for the given method and path.
+func (c *Client) NewRequest(method Code, path string) *Message {
+	req := &Message{Type: Confirmable, Code: method}
+	req.SetPath(path)
+	return req
+}
+
+// Get retrieves the resource at path.
+func (c *Client) Get(path string) (*Message, error) {
+	return c.Do(c.NewRequest(GET, path))
+}
+
+// Post sends payload to the resource at path.
+func (c *Client) Post(path string, format ContentFormat, payload []byte) (*Message, error) {
+	req := c.NewRequest(POST, path)
+	req.Options.SetUint(ContentType, uint32(format))
+	req.Payload = payload
+	return c.Do(req)
+}
+
+// Put replaces the resource at path with payload.
+func (c *Client) Put(path string, format ContentFormat, payload []byte) (*Message, error) {
+	req := c.NewRequest(PUT, path)
+	req.Options.SetUint(ContentType, uint32(format))
+	req.Payload = payload
+	return c.Do(req)
+}
+
+// Delete deletes the resource at path.
+func (c *Client) Delete(path string) (*Message, error) {
+	return c.Do(c.NewRequest(DELETE, path))
+}
+
+// Do sends a request and waits for the matching response. A message ID and
+// token are assigned if not set. Confirmable requests are retransmitted with
+// exponential back-off until they are acknowledged; both piggybacked and
+// separate responses are accepted. Notifications for active observations
+// that arrive in the meantime are dispatched to their handlers.
+func (c *Client) Do(req *Message) (*Message, error) {
+	if req.MessageID == 0 {
+		req.MessageID = c.nextMessageID()
+	}
+	if len(req.Token) == 0 {
+		req.Token = c.newToken()
+	}
+	if err := c.send(req); err != nil {
+		return nil, err
+	}
+
+	confirmable := req.Type == Confirmable
+	acked := !confirmable
+	timeout := c.retransmitTimeout(c.AckTimeout)
+	if acked {
+		timeout = c.ResponseTimeout
+	}
+	retransmits := 0
+	expire := time.Now().Add(timeout)
+
+	resp := &Message{}
+	for {
+		// a stray datagram may have been consumed right before the
+		// deadline, so check it before waiting again
+		err := ErrTimeout
+		if wait := time.Until(expire); wait > 0 {
+			err = c.receive(resp, wait)
+		}
+		if err == ErrTimeout {
+			if acked || retransmits >= c.MaxRetransmit {
+				return nil, ErrTimeout
+			}
+			retransmits++
+			timeout *= 2
+			expire = time.Now().Add(timeout)
+			if err := c.send(req); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.MessageID == req.MessageID && resp.Type == Reset && confirmable:
+			return nil, ErrReset
+		case resp.MessageID == req.MessageID && resp.Type == Acknowledgement && confirmable:
+			if resp.Code == Empty {
+				// the response will follow in a separate message
+				acked = true
+				expire = time.Now().Add(c.ResponseTimeout)
+				continue
+			}
+			if tokenEqual(resp.Token, req.Token) {
+				return resp, nil
+			}
+		case (resp.Type == Confirmable || resp.Type == NonConfirmable) &&
+			!resp.Code.IsRequest() && tokenEqual(resp.Token, req.Token):
+			if resp.Type == Confirmable {
+				if err := c.sendEmpty(Acknowledgement, resp.MessageID); err != nil {
+					return nil, err
+				}
+			}
+			return resp, nil
+		default:
+			if err := c.dispatch(resp); err != nil {
+				return nil, err
+			}
+			// the message may have been handed to an observation handler
+			resp = &Message{}
+		}
+	}
+}
+
+// GetBlockwise retrieves the resource at path using a block-wise transfer,
+// writing the body to w as the blocks arrive. This allows fetching resources
+// much larger than the available memory, such as firmware images.
+func (c *Client) GetBlockwise(path string, w io.Writer) error {
+	block := Block{SZX: BlockSZX(c.BlockSize)}
+	for {
+		req := c.NewRequest(GET, path)
+		req.Options.SetBlock(Block2, block)
+		resp, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		if !resp.Code.IsSuccess() {
+			return ResponseError{resp.Code}
+		}
+		b2, ok := resp.Options.Block(Block2)
+		if !ok {
+			// the server sent the whole body at once
+			if block.Num != 0 {
+				return ErrUnexpectedBlock
+			}
+			_, err = w.Write(resp.Payload)
+			return err
+		}
+		if b2.Offset() != block.Offset() {
+			return ErrUnexpectedBlock
+		}
+		if _, err := w.Write(resp.Payload); err != nil {
+			return err
+		}
+		if !b2.More {
+			return nil
+		}
+		// the server may have picked a smaller block size
+		block.SZX = b2.SZX
+		block.Num = uint32((b2.Offset() + len(resp.Payload)) / block.Size())
+	}
+}
+
+// PutBlockwise sends the body read from r to the resource at path using a
+// block-wise transfer with the given method, usually PUT or POST. If size is
+// positive it is sent in the Size1 option so the server can reject bodies
+// that are too large early. The final response is returned.
+func (c *Client) PutBlockwise(method Code, path string, format ContentFormat, r io.Reader, size int) (*Message, error) {
+	szx := BlockSZX(c.BlockSize)
+	bsize := 1 << (szx + 4)
+	cur := make([]byte, bsize)
+	next := make([]byte, bsize)
+
+	n, err := io.ReadFull(r, cur)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	for num := uint32(0); ; num++ {
+		// read ahead to find out whether this is the last block
+		m := 0
+		if n == bsize {
+			m, err = io.ReadFull(r, next)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return nil, err
+			}
+		}
+
+		req := c.NewRequest(method, path)
+		req.Options.SetUint(ContentType, uint32(format))
+		req.Options.SetBlock(Block1, Block{Num: num, More: m > 0, SZX: szx})
+		if num == 0 && size > 0 {
+			req.Options.SetUint(Size1, uint32(size))
+		}
+		req.Payload = cur[:n]
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if m == 0 {
+			return resp, nil
+		}
+		if resp.Code != Continue {
+			if resp.Code.IsSuccess() {
+				// the server does not support block-wise transfers
+				return nil, ErrUnexpectedBlock
+			}
+			return resp, ResponseError{resp.Code}
+		}
+		if b1, ok := resp.Options.Block(Block1); ok && (b1.Num != num || b1.SZX != szx) {
+			return nil, ErrUnexpectedBlock
+		}
+		cur, next = next, cur
+		n = m
+	}
+}
+
+// Poll waits up to timeout for a notification of an active observation and
+// dispatches it. It returns nil if nothing arrived in time.
+func (c *Client) Poll(timeout time.Duration) error {
+	m := &Message{}
+	err := c.receive(m, timeout)
+	if err == ErrTimeout {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.dispatch(m)
+}
+
+// dispatch handles a message that does not belong to an outstanding request.
+func (c *Client) dispatch(m *Message) error {
+	if m.Type == Acknowledgement || m.Type == Reset {
+		// a late or duplicate acknowledgement
+		return nil
+	}
+	for _, o := range c.observations {
+		if tokenEqual(o.token, m.Token) {
+			if m.Type == Confirmable {
+				if err := c.sendEmpty(Acknowledgement, m.MessageID); err != nil {
+					return err
+				}
+			}
+			o.notify(m)
+			return nil
+		}
+	}
+	if m.Type == Confirmable {
+		// reject messages we can't process, which also tells the server to
+		// stop sending notifications for observations we forgot about
+		return c.sendEmpty(Reset, m.MessageID)
+	}
+	return nil
+}
+
+func (c *Client) newToken() []byte {
+	v := c.random()
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func (c *Client) removeObservation(o *Observation) {
+	for i, obs := range c.observations {
+		if obs == o {
+			c.observations = append(c.observations[:i], c.observations[i+1:]...)
+			return
+		}
+	}
+}
+
+// Observation is a registration for notifications about changes of a
+// resource (RFC 7641).
+type Observation struct {
+	client  *Client
+	path    string
+	token   []byte
+	handler func(m *Message)
+	seq     uint32
+	last    time.Time
+}
+
+// Observe registers interest in the resource at path. The handler is called
+// with the current representation and then with every notification received
+// while the client is polled with Poll or Do. An error is returned if the
+// server does not support observing the resource.
+func (c *Client) Observe(path string, handler func(m *Message)) (*Observation, error) {
+	req := c.NewRequest(GET, path)
+	req.Options.SetUint(Observe, 0)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Code.IsSuccess() {
+		return nil, ResponseError{resp.Code}
+	}
+	handler(resp)
+	seq, ok := resp.Options.Uint(Observe)
+	if !ok {
+		return nil, ErrObserveCancelled
+	}
+	o := &Observation{
+		client:  c,
+		path:    path,
+		token:   req.Token,
+		handler: handler,
+		seq:     seq,
+		last:    time.Now(),
+	}
+	c.observations = append(c.observations, o)
+	return o, nil
+}
+
+// Cancel deregisters the observation at the server.
+func (o *Observation) Cancel() error {
+	o.client.removeObservation(o)
+	req := o.client.NewRequest(GET, o.path)
+	req.Token = o.token
+	req.Options.SetUint(Observe, 1)
+	_, err := o.client.Do(req)
+	return err
+}
+
+// notify delivers a notification to the handler unless it is older than the
+// last one received. A notification with an error code or without an
+// Observe option ends the observation.
+func (o *Observation) notify(m *Message) {
+	seq, ok := m.Options.Uint(Observe)
+	if !ok || !m.Code.IsSuccess() {
+		o.client.removeObservation(o)
+		o.handler(m)
+		return
+	}
+	now := time.Now()
+	if !fresher(seq, o.seq) && now.Sub(o.last) < 128*time.Second {
+		return
+	}
+	o.seq = seq
+	o.last = now
+	o.handler(m)
+}
+
+// fresher reports whether Observe sequence number v1 is newer than v2, using
+// the 24-bit serial number arithmetic of RFC 7641 section 3.4.
+func fresher(v1, v2 uint32) bool {
+	return (v1 < v2 && v2-v1 > 1<<23) || (v1 > v2 && v1-v2 < 1<<23)
+}
@@ -0,0 +1,436 @@
+package coap
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+)
+
+// loopback is a net.DeviceDriver stand-in that delivers each write as one
+// datagram to its peer.
+type loopback struct {
+	mu    *sync.Mutex
+	queue [][]byte
+	peer  *loopback
+
+	// drop is the number of next writes that are lost
+	drop int
+
+	// writes counts the datagrams written, including those lost
+	writes int
+}
+
+// newLoopback returns two connected drivers.
+func newLoopback() (*loopback, *loopback) {
+	mu := &sync.Mutex{}
+	a, b := &loopback{mu: mu}, &loopback{mu: mu}
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func (l *loopback) GetDNS(domain string) (string, error)                     { return "127.0.0.1", nil }
+func (l *loopback) ConnectTCPSocket(addr, port string) error                 { return nil }
+func (l *loopback) ConnectSSLSocket(addr, port string) error                 { return nil }
+func (l *loopback) ConnectUDPSocket(addr, sendport, listenport string) error { return nil }
+func (l *loopback) DisconnectSocket() error                                  { return nil }
+func (l *loopback) StartSocketSend(size int) error                           { return nil }
+func (l *loopback) Response(timeout int) ([]byte, error)                     { return nil, nil }
+
+func (l *loopback) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writes++
+	if l.drop > 0 {
+		l.drop--
+		return len(b), nil
+	}
+	l.peer.queue = append(l.peer.queue, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (l *loopback) ReadSocket(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		return 0, nil
+	}
+	n := copy(b, l.queue[0])
+	l.queue = l.queue[1:]
+	return n, nil
+}
+
+func (l *loopback) IsSocketDataAvailable() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue) > 0
+}
+
+func (l *loopback) stats() (writes int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writes
+}
+
+// testServer runs a server on drv until stop is called. Notifications are
+// sent from the serving goroutine, as Server is not safe for concurrent use.
+type testServer struct {
+	*Server
+	notify chan string
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+func startServer(t *testing.T, drv *loopback, setup func(s *Server)) *testServer {
+	s := &testServer{
+		Server: NewServer(&net.SerialConn{Adaptor: drv}),
+		notify: make(chan string),
+		done:   make(chan struct{}),
+	}
+	setup(s.Server)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.done:
+				return
+			case path := <-s.notify:
+				if err := s.Notify(path); err != nil {
+					t.Error(err)
+				}
+			default:
+				if err := s.Poll(time.Millisecond); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+	return s
+}
+
+// stop stops serving. It may be called more than once.
+func (s *testServer) stop() {
+	s.once.Do(func() { close(s.done) })
+	s.wg.Wait()
+}
+
+func newTestClient(drv *loopback) *Client {
+	c := NewClient(&net.SerialConn{Adaptor: drv})
+	c.AckTimeout = 20 * time.Millisecond
+	c.ResponseTimeout = 200 * time.Millisecond
+	return c
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := &Message{
+		Type:      Confirmable,
+		Code:      PUT,
+		MessageID: 0x1234,
+		Token:     []byte{1, 2, 3, 4},
+		Payload:   []byte("payload"),
+	}
+	m.SetPath("/a/much/longer/path/segment/than/thirteen/bytes")
+	m.Options.SetUint(ContentType, uint32(AppJSON))
+	m.Options.SetUint(Size1, 70000)
+	m.Options.SetBlock(Block1, Block{Num: 300, More: true, SZX: 2})
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Message
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != m.Type || got.Code != m.Code || got.MessageID != m.MessageID ||
+		!bytes.Equal(got.Token, m.Token) || !bytes.Equal(got.Payload, m.Payload) {
+		t.Errorf("got %+v, want %+v", got, m)
+	}
+	if got.Path() != "/a/much/longer/path/segment/than/thirteen/bytes" {
+		t.Errorf("path %q", got.Path())
+	}
+	if v, _ := got.Options.Uint(Size1); v != 70000 {
+		t.Errorf("Size1 %d", v)
+	}
+	if blk, _ := got.Options.Block(Block1); blk != (Block{Num: 300, More: true, SZX: 2}) {
+		t.Errorf("Block1 %+v", blk)
+	}
+
+	for _, data := range [][]byte{
+		{0x40},                         // too short
+		{0x80, 0x01, 0x00, 0x01},       // version 2
+		{0x49, 0x01, 0x00, 0x01},       // token length 9
+		{0x40, 0x01, 0x00, 0x01, 0xF0}, // reserved option nibble
+	} {
+		if err := new(Message).UnmarshalBinary(data); err == nil {
+			t.Errorf("% x: no error", data)
+		}
+	}
+}
+
+func TestDialGet(t *testing.T) {
+	client, server := newLoopback()
+	net.ActiveDevice = client
+	defer func() { net.ActiveDevice = nil }()
+
+	s := startServer(t, server, func(s *Server) {
+		s.Handle("/hello", func(resp, req *Message) {
+			resp.Payload = []byte("world")
+		})
+	})
+	defer s.stop()
+
+	c, err := Dial("127.0.0.1:5683")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AckTimeout = 20 * time.Millisecond
+	resp, err := c.Get("/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != Content || string(resp.Payload) != "world" {
+		t.Errorf("got %v %q", resp.Code, resp.Payload)
+	}
+	resp, err = c.Get("/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != NotFound {
+		t.Errorf("got %v, want %v", resp.Code, NotFound)
+	}
+}
+
+func TestRetransmit(t *testing.T) {
+	client, server := newLoopback()
+	calls := 0
+	s := startServer(t, server, func(s *Server) {
+		s.Handle("/count", func(resp, req *Message) {
+			calls++
+			resp.Payload = []byte("ok")
+		})
+	})
+	defer s.stop()
+
+	// the first request and the first response are lost
+	client.drop = 1
+	c := newTestClient(client)
+	if _, err := c.Get("/count"); err != nil {
+		t.Fatal(err)
+	}
+	server.mu.Lock()
+	server.drop = 1
+	server.mu.Unlock()
+	if _, err := c.Get("/count"); err != nil {
+		t.Fatal(err)
+	}
+	s.stop()
+	// the retransmission of the second request is answered from the
+	// deduplication cache
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+	if w := client.stats(); w != 4 {
+		t.Errorf("client wrote %d datagrams, want 4", w)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	client, _ := newLoopback()
+	c := newTestClient(client)
+	c.MaxRetransmit = 2
+	start := time.Now()
+	if _, err := c.Get("/nobody"); err != ErrTimeout {
+		t.Fatalf("got %v, want %v", err, ErrTimeout)
+	}
+	// 20 + 40 + 80 ms, up to 1.5 times longer with jitter
+	if d := time.Since(start); d < 140*time.Millisecond || d > time.Second {
+		t.Errorf("timed out after %v", d)
+	}
+	if w := client.stats(); w != 3 {
+		t.Errorf("client wrote %d datagrams, want 3", w)
+	}
+}
+
+func TestTimeoutWithStrayDatagrams(t *testing.T) {
+	client, noise := newLoopback()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// acknowledgements that match no request keep arriving
+		for mid := uint16(1); ; mid++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			b, _ := (&Message{Type: Acknowledgement, MessageID: mid}).MarshalBinary()
+			noise.Write(b)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	c := newTestClient(client)
+	c.MaxRetransmit = 1
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Get("/nobody")
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != ErrTimeout {
+			t.Errorf("got %v, want %v", err, ErrTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Do did not time out")
+	}
+}
+
+// malformed is a driver that always has a malformed datagram to read.
+type malformed struct {
+	*loopback
+}
+
+func (m malformed) ReadSocket(b []byte) (int, error) {
+	b[0] = 0x40 // a header cut short
+	return 1, nil
+}
+
+func TestTimeoutWithMalformedDatagrams(t *testing.T) {
+	drv, _ := newLoopback()
+	c := NewClient(&net.SerialConn{Adaptor: malformed{drv}})
+	c.AckTimeout = 20 * time.Millisecond
+	c.MaxRetransmit = 1
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Get("/nobody")
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != ErrTimeout {
+			t.Errorf("got %v, want %v", err, ErrTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Do did not time out")
+	}
+}
+
+func TestBlockwise(t *testing.T) {
+	body := []byte(strings.Repeat("0123456789abcdef", 70)) // 1120 bytes
+	var uploaded []byte
+	client, server := newLoopback()
+	s := startServer(t, server, func(s *Server) {
+		s.BlockSize = 64
+		s.Handle("/firmware", func(resp, req *Message) {
+			switch req.Code {
+			case GET:
+				resp.Payload = body
+			case PUT:
+				b1, _ := req.Options.Block(Block1)
+				if b1.Offset() != len(uploaded) {
+					resp.Code = RequestEntityIncomplete
+					return
+				}
+				uploaded = append(uploaded, req.Payload...)
+				resp.Code = Changed
+			}
+		})
+	})
+	defer s.stop()
+
+	c := newTestClient(client)
+	c.BlockSize = 128 // the server picks its smaller block size
+	var buf bytes.Buffer
+	if err := c.GetBlockwise("/firmware", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), body) {
+		t.Errorf("GetBlockwise: got %d bytes, want %d", buf.Len(), len(body))
+	}
+
+	c.BlockSize = 64
+	resp, err := c.PutBlockwise(PUT, "/firmware", AppOctets, bytes.NewReader(body[:700]), 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != Changed {
+		t.Errorf("PutBlockwise: got %v", resp.Code)
+	}
+	s.stop()
+	if !bytes.Equal(uploaded, body[:700]) {
+		t.Errorf("PutBlockwise: server got %d bytes, want 700", len(uploaded))
+	}
+}
+
+func TestObserve(t *testing.T) {
+	client, server := newLoopback()
+	var mu sync.Mutex
+	value := "20.5"
+	s := startServer(t, server, func(s *Server) {
+		s.HandleObservable("/temperature", func(resp, req *Message) {
+			mu.Lock()
+			resp.Payload = []byte(value)
+			mu.Unlock()
+		})
+	})
+	defer s.stop()
+
+	c := newTestClient(client)
+	var got []string
+	obs, err := c.Observe("/temperature", func(m *Message) {
+		got = append(got, string(m.Payload))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	value = "21.0"
+	mu.Unlock()
+	s.notify <- "/temperature"
+	for deadline := time.Now().Add(time.Second); len(got) < 2 && time.Now().Before(deadline); {
+		if err := c.Poll(10 * time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := obs.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "20.5" || got[1] != "21.0" {
+		t.Errorf("got notifications %q", got)
+	}
+
+	// after cancelling, no more notifications arrive
+	s.notify <- "/temperature"
+	if err := c.Poll(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got notifications %q after Cancel", got)
+	}
+}
+
+func TestFresher(t *testing.T) {
+	for _, tc := range []struct {
+		v1, v2 uint32
+		want   bool
+	}{
+		{1, 0, true},
+		{0, 1, false},
+		{5, 5, false},
+		{0, 0xffffff, true}, // wrapped around
+		{0xffffff, 0, false},
+		{1 << 22, 0, true},
+	} {
+		if got := fresher(tc.v1, tc.v2); got != tc.want {
+			t.Errorf("fresher(%d, %d) = %v, want %v", tc.v1, tc.v2, got, tc.want)
+		}
+	}
+}
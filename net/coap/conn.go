@@ -0,0 +1,122 @@
+package coap
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	// DefaultAckTimeout is the initial retransmission timeout for
+	// confirmable messages.
+	DefaultAckTimeout = 2 * time.Second
+
+	// DefaultMaxRetransmit is the number of retransmissions of a confirmable
+	// message before giving up.
+	DefaultMaxRetransmit = 4
+
+	// DefaultMaxMessageSize is the size of the receive and transmit buffers.
+	// It fits a 1024 byte block plus header and options.
+	DefaultMaxMessageSize = 1152
+
+	// DefaultBlockSize is the preferred block size for block-wise transfers.
+	// It is kept small so that a message fits into the socket buffers of
+	// common wifi modules.
+	DefaultBlockSize = 256
+)
+
+// pollInterval is the time between reads while waiting for a datagram, as
+// the drivers net connections do not block.
+const pollInterval = 2 * time.Millisecond
+
+// endpoint holds the state shared by clients and servers: the connection,
+// buffers and message ID generator.
+type endpoint struct {
+	conn io.ReadWriter
+	rx   []byte
+	tx   []byte
+	mid  uint16
+	rnd  uint32
+}
+
+func (e *endpoint) init(conn io.ReadWriter) {
+	e.conn = conn
+	e.rx = make([]byte, DefaultMaxMessageSize)
+	e.tx = make([]byte, 0, DefaultMaxMessageSize)
+	e.rnd = uint32(time.Now().UnixNano()) | 1
+	e.mid = uint16(e.random())
+}
+
+// random returns the next value of a xorshift generator. It is only used for
+// message IDs, tokens and retransmission jitter, none of which need to be
+// cryptographically secure.
+func (e *endpoint) random() uint32 {
+	e.rnd ^= e.rnd << 13
+	e.rnd ^= e.rnd >> 17
+	e.rnd ^= e.rnd << 5
+	return e.rnd
+}
+
+func (e *endpoint) nextMessageID() uint16 {
+	e.mid++
+	return e.mid
+}
+
+// send encodes and writes a single message.
+func (e *endpoint) send(m *Message) error {
+	b, err := m.AppendBinary(e.tx[:0])
+	if err != nil {
+		return err
+	}
+	if len(b) > cap(e.tx) {
+		return ErrMessageTooLarge
+	}
+	e.tx = b
+	_, err = e.conn.Write(b)
+	return err
+}
+
+// sendEmpty sends an empty ACK or RST for the given message ID.
+func (e *endpoint) sendEmpty(t Type, mid uint16) error {
+	return e.send(&Message{Type: t, MessageID: mid})
+}
+
+// receive waits up to timeout for a datagram and decodes it into m.
+// Malformed datagrams are discarded. With a timeout of zero or less, only a
+// datagram that is already available is returned.
+func (e *endpoint) receive(m *Message, timeout time.Duration) error {
+	expire := time.Now().Add(timeout)
+	for {
+		n, err := e.conn.Read(e.rx)
+		if err != nil {
+			return err
+		}
+		if n > 0 && m.UnmarshalBinary(e.rx[:n]) == nil {
+			return nil
+		}
+		// checked after malformed datagrams too, which may keep arriving
+		if !time.Now().Before(expire) {
+			return ErrTimeout
+		}
+		if n == 0 {
+			time.Sleep(pollInterval)
+		}
+	}
+}
+
+// retransmitTimeout returns the initial retransmission timeout, a random
+// duration between ackTimeout and 1.5 times ackTimeout.
+func (e *endpoint) retransmitTimeout(ackTimeout time.Duration) time.Duration {
+	return ackTimeout + time.Duration(uint64(ackTimeout/2)*uint64(e.random()%1024)/1024)
+}
+
+func tokenEqual(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,302 @@
+// Package coap implements the Constrained Application Protocol (RFC 7252)
+// over the UDP support in the drivers net package.
+//
+// Both a client and a small resource server are provided. Confirmable
+// messages are retransmitted with exponential back-off, and block-wise
+// transfers (RFC 7959) and resource observation (RFC 7641) are supported so
+// that large payloads such as firmware images can be moved in small pieces.
+//
+// The client and server only need an io.ReadWriter that delivers one
+// datagram per Read and sends one datagram per Write, such as the
+// connections returned by net.DialUDP and net.ListenUDP.
+package coap // import "tinygo.org/x/drivers/net/coap"
+
+import (
+	"errors"
+	"strings"
+)
+
+// Type is the CoAP message type.
+type Type uint8
+
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+func (t Type) String() string {
+	switch t {
+	case Confirmable:
+		return "CON"
+	case NonConfirmable:
+		return "NON"
+	case Acknowledgement:
+		return "ACK"
+	case Reset:
+		return "RST"
+	default:
+		return "?"
+	}
+}
+
+// Code is the CoAP request method or response code, encoded as a 3-bit class
+// and a 5-bit detail.
+type Code uint8
+
+const (
+	Empty Code = 0
+
+	GET    Code = 1
+	POST   Code = 2
+	PUT    Code = 3
+	DELETE Code = 4
+
+	Created  Code = 2<<5 | 1
+	Deleted  Code = 2<<5 | 2
+	Valid    Code = 2<<5 | 3
+	Changed  Code = 2<<5 | 4
+	Content  Code = 2<<5 | 5
+	Continue Code = 2<<5 | 31
+
+	BadRequest               Code = 4<<5 | 0
+	Unauthorized             Code = 4<<5 | 1
+	BadOption                Code = 4<<5 | 2
+	Forbidden                Code = 4<<5 | 3
+	NotFound                 Code = 4<<5 | 4
+	MethodNotAllowed         Code = 4<<5 | 5
+	NotAcceptable            Code = 4<<5 | 6
+	RequestEntityIncomplete  Code = 4<<5 | 8
+	PreconditionFailed       Code = 4<<5 | 12
+	RequestEntityTooLarge    Code = 4<<5 | 13
+	UnsupportedContentFormat Code = 4<<5 | 15
+
+	InternalServerError  Code = 5<<5 | 0
+	NotImplemented       Code = 5<<5 | 1
+	BadGateway           Code = 5<<5 | 2
+	ServiceUnavailable   Code = 5<<5 | 3
+	GatewayTimeout       Code = 5<<5 | 4
+	ProxyingNotSupported Code = 5<<5 | 5
+)
+
+// Class returns the class of the code, e.g. 2 for 2.05 Content.
+func (c Code) Class() uint8 {
+	return uint8(c) >> 5
+}
+
+// Detail returns the detail of the code, e.g. 5 for 2.05 Content.
+func (c Code) Detail() uint8 {
+	return uint8(c) & 0x1f
+}
+
+// IsRequest returns true if the code is a request method.
+func (c Code) IsRequest() bool {
+	return c.Class() == 0 && c != Empty
+}
+
+// IsSuccess returns true for response codes of class 2.
+func (c Code) IsSuccess() bool {
+	return c.Class() == 2
+}
+
+// String returns the code in the dotted c.dd notation.
+func (c Code) String() string {
+	d := c.Detail()
+	return string([]byte{'0' + c.Class(), '.', '0' + d/10, '0' + d%10})
+}
+
+// ContentFormat is the numeric identifier of a media type.
+type ContentFormat uint16
+
+const (
+	TextPlain     ContentFormat = 0
+	AppLinkFormat ContentFormat = 40
+	AppXML        ContentFormat = 41
+	AppOctets     ContentFormat = 42
+	AppEXI        ContentFormat = 47
+	AppJSON       ContentFormat = 50
+	AppCBOR       ContentFormat = 60
+)
+
+var (
+	ErrMessageTooShort  = errors.New("coap: message too short")
+	ErrInvalidVersion   = errors.New("coap: invalid version")
+	ErrInvalidTokenLen  = errors.New("coap: invalid token length")
+	ErrInvalidOption    = errors.New("coap: invalid option encoding")
+	ErrMessageTooLarge  = errors.New("coap: message too large")
+	ErrTimeout          = errors.New("coap: timeout")
+	ErrReset            = errors.New("coap: reset by peer")
+	ErrUnexpectedBlock  = errors.New("coap: unexpected block")
+	ErrObserveCancelled = errors.New("coap: observation cancelled")
+)
+
+// Message is a CoAP message.
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageID uint16
+	Token     []byte
+	Options   Options
+	Payload   []byte
+}
+
+// Path returns the Uri-Path options joined with slashes.
+func (m *Message) Path() string {
+	return m.Options.Path()
+}
+
+// SetPath replaces the Uri-Path options with the segments of path.
+func (m *Message) SetPath(path string) {
+	m.Options.SetPath(path)
+}
+
+// MarshalBinary encodes the message.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	return m.AppendBinary(nil)
+}
+
+// AppendBinary appends the encoded message to b and returns the extended
+// buffer. Options are encoded in ascending order of their number.
+func (m *Message) AppendBinary(b []byte) ([]byte, error) {
+	if len(m.Token) > 8 {
+		return b, ErrInvalidTokenLen
+	}
+	b = append(b, 1<<6|byte(m.Type)<<4|byte(len(m.Token)), byte(m.Code),
+		byte(m.MessageID>>8), byte(m.MessageID))
+	b = append(b, m.Token...)
+
+	m.Options.sort()
+	prev := OptionID(0)
+	for _, o := range m.Options {
+		delta := int(o.ID - prev)
+		prev = o.ID
+		dn, dext := optionNibble(delta)
+		ln, lext := optionNibble(len(o.Value))
+		b = append(b, dn<<4|ln)
+		b = appendExtended(b, dn, dext)
+		b = appendExtended(b, ln, lext)
+		b = append(b, o.Value...)
+	}
+
+	if len(m.Payload) > 0 {
+		b = append(b, 0xff)
+		b = append(b, m.Payload...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a message. The token, option values and payload
+// are copied, so data may be reused afterwards.
+func (m *Message) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return ErrMessageTooShort
+	}
+	if data[0]>>6 != 1 {
+		return ErrInvalidVersion
+	}
+	tkl := int(data[0] & 0x0f)
+	if tkl > 8 {
+		return ErrInvalidTokenLen
+	}
+	m.Type = Type(data[0]>>4) & 0x03
+	m.Code = Code(data[1])
+	m.MessageID = uint16(data[2])<<8 | uint16(data[3])
+	data = data[4:]
+	if len(data) < tkl {
+		return ErrMessageTooShort
+	}
+	m.Token = append([]byte(nil), data[:tkl]...)
+	data = data[tkl:]
+
+	m.Options = m.Options[:0]
+	m.Payload = nil
+	prev := 0
+	for len(data) > 0 {
+		if data[0] == 0xff {
+			if len(data) == 1 {
+				// a payload marker followed by an empty payload is an error
+				return ErrInvalidOption
+			}
+			m.Payload = append([]byte(nil), data[1:]...)
+			break
+		}
+		dn := int(data[0] >> 4)
+		ln := int(data[0] & 0x0f)
+		data = data[1:]
+		var delta, length int
+		var err error
+		if delta, data, err = readExtended(dn, data); err != nil {
+			return err
+		}
+		if length, data, err = readExtended(ln, data); err != nil {
+			return err
+		}
+		if len(data) < length {
+			return ErrInvalidOption
+		}
+		prev += delta
+		if prev > 0xffff {
+			return ErrInvalidOption
+		}
+		m.Options = append(m.Options, Option{
+			ID:    OptionID(prev),
+			Value: append([]byte(nil), data[:length]...),
+		})
+		data = data[length:]
+	}
+	return nil
+}
+
+// optionNibble returns the 4-bit value and extended value for an option delta
+// or length.
+func optionNibble(v int) (byte, int) {
+	switch {
+	case v < 13:
+		return byte(v), 0
+	case v < 269:
+		return 13, v - 13
+	default:
+		return 14, v - 269
+	}
+}
+
+func appendExtended(b []byte, nibble byte, ext int) []byte {
+	switch nibble {
+	case 13:
+		return append(b, byte(ext))
+	case 14:
+		return append(b, byte(ext>>8), byte(ext))
+	}
+	return b
+}
+
+func readExtended(nibble int, data []byte) (int, []byte, error) {
+	switch nibble {
+	case 13:
+		if len(data) < 1 {
+			return 0, data, ErrInvalidOption
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, data, ErrInvalidOption
+		}
+		return (int(data[0])<<8 | int(data[1])) + 269, data[2:], nil
+	case 15:
+		return 0, data, ErrInvalidOption
+	}
+	return nibble, data, nil
+}
+
+// splitPath returns the non-empty segments of a slash separated path.
+func splitPath(path string) []string {
+	parts := strings.Split(path, "/")
+	segs := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			segs = append(segs, p)
+		}
+	}
+	return segs
+}
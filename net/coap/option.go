@@ -0,0 +1,234 @@
+package coap
+
+import (
+	"strings"
+)
+
+// OptionID is the number of a CoAP option.
+type OptionID uint16
+
+const (
+	IfMatch       OptionID = 1
+	URIHost       OptionID = 3
+	ETag          OptionID = 4
+	IfNoneMatch   OptionID = 5
+	Observe       OptionID = 6
+	URIPort       OptionID = 7
+	LocationPath  OptionID = 8
+	URIPath       OptionID = 11
+	ContentType   OptionID = 12
+	MaxAge        OptionID = 14
+	URIQuery      OptionID = 15
+	Accept        OptionID = 17
+	LocationQuery OptionID = 20
+	Block2        OptionID = 23
+	Block1        OptionID = 27
+	Size2         OptionID = 28
+	ProxyURI      OptionID = 35
+	ProxyScheme   OptionID = 39
+	Size1         OptionID = 60
+)
+
+// Critical returns true if the option must be understood by the receiver.
+func (id OptionID) Critical() bool {
+	return id&1 != 0
+}
+
+// Option is a single CoAP option.
+type Option struct {
+	ID    OptionID
+	Value []byte
+}
+
+// Options is a list of options. The same option may occur more than once.
+type Options []Option
+
+// Get returns the value of the first option with the given ID.
+func (o Options) Get(id OptionID) ([]byte, bool) {
+	for _, opt := range o {
+		if opt.ID == id {
+			return opt.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Has returns true if at least one option with the given ID is present.
+func (o Options) Has(id OptionID) bool {
+	_, ok := o.Get(id)
+	return ok
+}
+
+// Uint returns the value of the first option with the given ID decoded as an
+// unsigned integer.
+func (o Options) Uint(id OptionID) (uint32, bool) {
+	v, ok := o.Get(id)
+	if !ok {
+		return 0, false
+	}
+	return decodeUint(v), true
+}
+
+// Add appends an option.
+func (o *Options) Add(id OptionID, value []byte) {
+	*o = append(*o, Option{ID: id, Value: value})
+}
+
+// AddString appends an option with a string value.
+func (o *Options) AddString(id OptionID, value string) {
+	o.Add(id, []byte(value))
+}
+
+// AddUint appends an option with an unsigned integer value, using the
+// shortest possible encoding.
+func (o *Options) AddUint(id OptionID, value uint32) {
+	o.Add(id, encodeUint(value))
+}
+
+// Set replaces all options with the given ID by a single one.
+func (o *Options) Set(id OptionID, value []byte) {
+	o.Del(id)
+	o.Add(id, value)
+}
+
+// SetUint replaces all options with the given ID by a single unsigned
+// integer option.
+func (o *Options) SetUint(id OptionID, value uint32) {
+	o.Set(id, encodeUint(value))
+}
+
+// Del removes all options with the given ID.
+func (o *Options) Del(id OptionID) {
+	opts := (*o)[:0]
+	for _, opt := range *o {
+		if opt.ID != id {
+			opts = append(opts, opt)
+		}
+	}
+	*o = opts
+}
+
+// Path returns the Uri-Path options joined with slashes.
+func (o Options) Path() string {
+	var sb strings.Builder
+	for _, opt := range o {
+		if opt.ID == URIPath {
+			sb.WriteByte('/')
+			sb.Write(opt.Value)
+		}
+	}
+	if sb.Len() == 0 {
+		return "/"
+	}
+	return sb.String()
+}
+
+// SetPath replaces the Uri-Path options with the segments of path.
+func (o *Options) SetPath(path string) {
+	o.Del(URIPath)
+	for _, seg := range splitPath(path) {
+		o.AddString(URIPath, seg)
+	}
+}
+
+// ContentFormat returns the Content-Format option.
+func (o Options) ContentFormat() (ContentFormat, bool) {
+	v, ok := o.Uint(ContentType)
+	return ContentFormat(v), ok
+}
+
+// Block returns the decoded Block1 or Block2 option.
+func (o Options) Block(id OptionID) (Block, bool) {
+	v, ok := o.Uint(id)
+	if !ok {
+		return Block{}, false
+	}
+	return decodeBlock(v), true
+}
+
+// SetBlock replaces the Block1 or Block2 option.
+func (o *Options) SetBlock(id OptionID, b Block) {
+	o.SetUint(id, b.encode())
+}
+
+// sort orders the options by number, keeping the relative order of repeated
+// options. Messages only carry a handful of options, so an insertion sort is
+// used to avoid pulling in the sort package.
+func (o Options) sort() {
+	for i := 1; i < len(o); i++ {
+		for j := i; j > 0 && o[j].ID < o[j-1].ID; j-- {
+			o[j], o[j-1] = o[j-1], o[j]
+		}
+	}
+}
+
+func encodeUint(v uint32) []byte {
+	switch {
+	case v == 0:
+		return nil
+	case v < 1<<8:
+		return []byte{byte(v)}
+	case v < 1<<16:
+		return []byte{byte(v >> 8), byte(v)}
+	case v < 1<<24:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	default:
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+}
+
+func decodeUint(b []byte) (v uint32) {
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// Block is the value of a Block1 or Block2 option (RFC 7959).
+type Block struct {
+	// Num is the number of the block within the whole body.
+	Num uint32
+
+	// More is set if more blocks follow.
+	More bool
+
+	// SZX is the size exponent, the block size is 1 << (SZX + 4).
+	SZX uint8
+}
+
+// Size returns the block size in bytes, from 16 to 1024.
+func (b Block) Size() int {
+	return 1 << (b.SZX + 4)
+}
+
+// Offset returns the byte offset of the block within the whole body.
+func (b Block) Offset() int {
+	return int(b.Num) * b.Size()
+}
+
+// BlockSZX returns the largest size exponent for a block of at most size
+// bytes.
+func BlockSZX(size int) uint8 {
+	szx := uint8(0)
+	for szx < 6 && 1<<(szx+5) <= size {
+		szx++
+	}
+	return szx
+}
+
+func (b Block) encode() uint32 {
+	v := b.Num<<4 | uint32(b.SZX&0x07)
+	if b.More {
+		v |= 1 << 3
+	}
+	return v
+}
+
+func decodeBlock(v uint32) Block {
+	szx := uint8(v & 0x07)
+	if szx > 6 {
+		// 7 is reserved, treat it as the largest supported size.
+		szx = 6
+	}
+	return Block{Num: v >> 4, More: v&(1<<3) != 0, SZX: szx}
+}
@@ -0,0 +1,345 @@
+package coap
+
+import (
+	"io"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+)
+
+const (
+	// MaxObservers is the maximum number of concurrent observations a
+	// server keeps track of.
+	MaxObservers = 4
+
+	// dedupEntries is the number of recent confirmable requests whose
+	// responses are kept to answer retransmissions.
+	dedupEntries = 4
+)
+
+// Handler responds to a request. The response is pre-filled with the
+// message type, ID and token and the code 2.05 Content; the handler sets the
+// code, options and payload as needed.
+//
+// Block-wise transfers are handled by the server: a handler that returns a
+// payload larger than the block size only has the requested block sent, and
+// a handler receiving a request with a Block1 option gets one block at a
+// time and can find its position with req.Options.Block(Block1).
+type Handler func(resp *Message, req *Message)
+
+type route struct {
+	path       string
+	handler    Handler
+	observable bool
+}
+
+type observer struct {
+	path  string
+	token []byte
+	mid   uint16
+}
+
+type dedupEntry struct {
+	mid  uint16
+	resp []byte
+}
+
+// Server is a minimal CoAP resource server.
+type Server struct {
+	endpoint
+
+	// BlockSize is the largest block size used for block-wise responses.
+	BlockSize int
+
+	routes    []route
+	observers []observer
+	seq       uint32
+	dedup     [dedupEntries]dedupEntry
+	dedupIdx  int
+}
+
+// Listen creates a server listening on the given UDP port.
+func Listen(port int) (*Server, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(conn), nil
+}
+
+// NewServer creates a server that exchanges datagrams over conn.
+func NewServer(conn io.ReadWriter) *Server {
+	s := &Server{
+		BlockSize: DefaultBlockSize,
+	}
+	s.init(conn)
+	return s
+}
+
+// Handle registers the handler for the resource at path.
+func (s *Server) Handle(path string, handler Handler) {
+	s.routes = append(s.routes, route{path: cleanPath(path), handler: handler})
+}
+
+// HandleObservable registers the handler for an observable resource at path.
+// Call Notify when the resource changes to send notifications to the
+// registered observers.
+func (s *Server) HandleObservable(path string, handler Handler) {
+	s.routes = append(s.routes, route{path: cleanPath(path), handler: handler, observable: true})
+}
+
+// Serve handles incoming requests until reading from the connection fails.
+func (s *Server) Serve() error {
+	for {
+		if err := s.Poll(time.Second); err != nil {
+			return err
+		}
+	}
+}
+
+// Poll waits up to timeout for a single message and handles it. It returns
+// nil if nothing arrived in time.
+func (s *Server) Poll(timeout time.Duration) error {
+	req := &Message{}
+	err := s.receive(req, timeout)
+	if err == ErrTimeout {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch req.Type {
+	case Reset:
+		// the client is no longer interested in a notification
+		for i, o := range s.observers {
+			if o.mid == req.MessageID {
+				s.removeObserver(i)
+				break
+			}
+		}
+		return nil
+	case Acknowledgement:
+		return nil
+	}
+
+	if req.Code == Empty {
+		// CoAP ping
+		if req.Type == Confirmable {
+			return s.sendEmpty(Reset, req.MessageID)
+		}
+		return nil
+	}
+	if !req.Code.IsRequest() {
+		if req.Type == Confirmable {
+			return s.sendEmpty(Reset, req.MessageID)
+		}
+		return nil
+	}
+
+	if req.Type == Confirmable {
+		for _, e := range s.dedup {
+			if e.resp != nil && e.mid == req.MessageID {
+				_, err := s.conn.Write(e.resp)
+				return err
+			}
+		}
+	}
+
+	resp := &Message{
+		Type:      Acknowledgement,
+		MessageID: req.MessageID,
+		Token:     req.Token,
+		Code:      Content,
+	}
+	if req.Type == NonConfirmable {
+		resp.Type = NonConfirmable
+		resp.MessageID = s.nextMessageID()
+	}
+	s.serve(resp, req)
+
+	if err := s.send(resp); err != nil {
+		return err
+	}
+	if req.Type == Confirmable {
+		e := &s.dedup[s.dedupIdx]
+		e.mid = req.MessageID
+		e.resp = append(e.resp[:0], s.tx...)
+		s.dedupIdx = (s.dedupIdx + 1) % dedupEntries
+	}
+	return nil
+}
+
+// serve looks up the route for a request and fills in the response.
+func (s *Server) serve(resp, req *Message) {
+	for _, o := range req.Options {
+		if o.ID.Critical() && !knownOption(o.ID) {
+			resp.Code = BadOption
+			return
+		}
+	}
+
+	path := req.Path()
+	var rt *route
+	for i := range s.routes {
+		if s.routes[i].path == path {
+			rt = &s.routes[i]
+			break
+		}
+	}
+	if rt == nil {
+		resp.Code = NotFound
+		return
+	}
+
+	if obs, ok := req.Options.Uint(Observe); ok && rt.observable && req.Code == GET {
+		switch obs {
+		case 0:
+			if s.addObserver(path, req.Token) {
+				resp.Options.SetUint(Observe, s.seq)
+			}
+		case 1:
+			s.cancelObserver(req.Token)
+		}
+	}
+
+	rt.handler(resp, req)
+
+	if b1, ok := req.Options.Block(Block1); ok {
+		if b1.More && resp.Code.IsSuccess() {
+			resp.Code = Continue
+		}
+		resp.Options.SetBlock(Block1, b1)
+	}
+	s.sliceBlock(resp, req)
+
+	if !resp.Code.IsSuccess() {
+		resp.Options.Del(Observe)
+		s.cancelObserver(req.Token)
+	}
+}
+
+// sliceBlock reduces the payload of resp to the block requested in req, if
+// the payload is too large or the client asked for a specific block.
+func (s *Server) sliceBlock(resp, req *Message) {
+	szx := BlockSZX(s.BlockSize)
+	b2, ok := req.Options.Block(Block2)
+	if ok && b2.SZX < szx {
+		szx = b2.SZX
+	}
+	if !ok && len(resp.Payload) <= 1<<(szx+4) {
+		return
+	}
+	block := Block{SZX: szx}
+	if ok {
+		// keep the offset if the client asked for a larger block size
+		block.Num = uint32(b2.Offset() / block.Size())
+	}
+	start := block.Offset()
+	if start > len(resp.Payload) {
+		resp.Code = BadOption
+		resp.Payload = nil
+		return
+	}
+	end := start + block.Size()
+	if end < len(resp.Payload) {
+		block.More = true
+	} else {
+		end = len(resp.Payload)
+	}
+	if block.Num == 0 {
+		resp.Options.SetUint(Size2, uint32(len(resp.Payload)))
+	}
+	resp.Payload = resp.Payload[start:end]
+	resp.Options.SetBlock(Block2, block)
+}
+
+// Notify sends the current representation of the resource at path to all of
+// its observers as non-confirmable notifications. Observers that reply with a
+// reset are removed.
+func (s *Server) Notify(path string) error {
+	path = cleanPath(path)
+	var rt *route
+	for i := range s.routes {
+		if s.routes[i].path == path {
+			rt = &s.routes[i]
+		}
+	}
+	if rt == nil {
+		return nil
+	}
+
+	s.seq = (s.seq + 1) & 0xffffff
+	for i := 0; i < len(s.observers); i++ {
+		o := &s.observers[i]
+		if o.path != path {
+			continue
+		}
+		req := &Message{Type: NonConfirmable, Code: GET, Token: o.token}
+		req.SetPath(path)
+		resp := &Message{
+			Type:      NonConfirmable,
+			MessageID: s.nextMessageID(),
+			Token:     o.token,
+			Code:      Content,
+		}
+		rt.handler(resp, req)
+		s.sliceBlock(resp, req)
+		o.mid = resp.MessageID
+		ok := resp.Code.IsSuccess()
+		if ok {
+			resp.Options.SetUint(Observe, s.seq)
+		}
+		if err := s.send(resp); err != nil {
+			return err
+		}
+		if !ok {
+			// an error ends the observation
+			s.removeObserver(i)
+			i--
+		}
+	}
+	return nil
+}
+
+func (s *Server) addObserver(path string, token []byte) bool {
+	for i := range s.observers {
+		if tokenEqual(s.observers[i].token, token) {
+			s.observers[i].path = path
+			return true
+		}
+	}
+	if len(s.observers) >= MaxObservers {
+		return false
+	}
+	s.observers = append(s.observers, observer{path: path, token: token})
+	return true
+}
+
+func (s *Server) cancelObserver(token []byte) {
+	for i := range s.observers {
+		if tokenEqual(s.observers[i].token, token) {
+			s.removeObserver(i)
+			return
+		}
+	}
+}
+
+func (s *Server) removeObserver(i int) {
+	s.observers = append(s.observers[:i], s.observers[i+1:]...)
+}
+
+// knownOption returns true for the critical options processed by the server.
+func knownOption(id OptionID) bool {
+	switch id {
+	case URIHost, URIPort, URIPath, URIQuery, Block1, Block2, IfMatch, IfNoneMatch, Accept:
+		return true
+	}
+	return false
+}
+
+func cleanPath(path string) string {
+	m := Message{}
+	m.SetPath(path)
+	return m.Path()
+}
@@ -0,0 +1,249 @@
+// +build !baremetal
+
+// Package hostnet provides a net.DeviceDriver backed by the network stack of
+// the host operating system.
+//
+// It allows code written against the drivers net, net/tls and net/mqtt
+// packages to run unmodified on a development machine or in CI, for example
+// against local stand-in servers on the loopback interface, without any wifi
+// hardware:
+//
+// 	drv := hostnet.New()
+// 	net.UseDriver(drv)
+// 	conn, err := net.Dial("tcp", "127.0.0.1:1883")
+//
+// Like the wifi modules it replaces, the driver manages a single socket at a
+// time.
+package hostnet // import "tinygo.org/x/drivers/net/hostnet"
+
+import (
+	"crypto/tls"
+	"errors"
+	stdnet "net"
+	"time"
+)
+
+var (
+	ErrNoSocket     = errors.New("hostnet: no socket connected")
+	ErrNoRemoteAddr = errors.New("hostnet: no remote address to send to")
+	ErrNoIPv4       = errors.New("hostnet: no IPv4 address found")
+)
+
+// DefaultPollTimeout is how long ReadSocket waits for data before reporting
+// that none is available.
+const DefaultPollTimeout = time.Millisecond
+
+// Driver implements net.DeviceDriver using operating system sockets.
+type Driver struct {
+	// TLSConfig is used for ConnectSSLSocket. The drivers net/tls package
+	// resolves host names before connecting, so set ServerName (or
+	// InsecureSkipVerify for local test servers) for certificate
+	// verification to succeed.
+	TLSConfig *tls.Config
+
+	// Resolve, if set, replaces the host resolver in GetDNS. Tests can use it
+	// to map host names used by firmware onto loopback addresses.
+	Resolve func(domain string) (string, error)
+
+	// LocalAddr is the local IP address UDP sockets are bound to. It
+	// defaults to all interfaces.
+	LocalAddr string
+
+	// DialTimeout limits the time to establish TCP and TLS connections.
+	// Zero means no limit.
+	DialTimeout time.Duration
+
+	// PollTimeout is how long ReadSocket waits for data before returning
+	// zero bytes, DefaultPollTimeout if zero.
+	PollTimeout time.Duration
+
+	tcp    stdnet.Conn
+	udp    *stdnet.UDPConn
+	remote *stdnet.UDPAddr
+	listen bool
+
+	buf  []byte
+	head int
+	size int
+}
+
+// New returns a driver with no open socket.
+func New() *Driver {
+	return &Driver{}
+}
+
+// GetDNS returns the IPv4 address of domain as a string. IP addresses are
+// returned unchanged.
+func (d *Driver) GetDNS(domain string) (string, error) {
+	if ip := stdnet.ParseIP(domain); ip != nil {
+		return domain, nil
+	}
+	if d.Resolve != nil {
+		return d.Resolve(domain)
+	}
+	addrs, err := stdnet.LookupHost(domain)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		if ip := stdnet.ParseIP(a); ip != nil && ip.To4() != nil {
+			return a, nil
+		}
+	}
+	return "", ErrNoIPv4
+}
+
+// ConnectTCPSocket opens a TCP connection, closing any open socket first.
+func (d *Driver) ConnectTCPSocket(addr, port string) error {
+	d.DisconnectSocket()
+	dialer := stdnet.Dialer{Timeout: d.DialTimeout}
+	conn, err := dialer.Dial("tcp", stdnet.JoinHostPort(addr, port))
+	if err != nil {
+		return err
+	}
+	d.tcp = conn
+	return nil
+}
+
+// ConnectSSLSocket opens a TLS connection using TLSConfig, closing any open
+// socket first.
+func (d *Driver) ConnectSSLSocket(addr, port string) error {
+	d.DisconnectSocket()
+	dialer := &stdnet.Dialer{Timeout: d.DialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", stdnet.JoinHostPort(addr, port), d.TLSConfig)
+	if err != nil {
+		return err
+	}
+	d.tcp = conn
+	return nil
+}
+
+// ConnectUDPSocket binds a UDP socket to listenport that sends to addr and
+// sendport. An addr of "0", as used by net.ListenUDP, leaves the remote
+// address open: replies are then sent to the sender of the most recently
+// received datagram, the same way the ESP8266 AT firmware behaves.
+func (d *Driver) ConnectUDPSocket(addr, sendport, listenport string) error {
+	d.DisconnectSocket()
+	laddr, err := stdnet.ResolveUDPAddr("udp4", stdnet.JoinHostPort(d.LocalAddr, listenport))
+	if err != nil {
+		return err
+	}
+	var raddr *stdnet.UDPAddr
+	if addr != "0" && addr != "" {
+		raddr, err = stdnet.ResolveUDPAddr("udp4", stdnet.JoinHostPort(addr, sendport))
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := stdnet.ListenUDP("udp4", laddr)
+	if err != nil {
+		return err
+	}
+	d.udp = conn
+	d.remote = raddr
+	d.listen = raddr == nil
+	return nil
+}
+
+// DisconnectSocket closes the open socket, if any.
+func (d *Driver) DisconnectSocket() error {
+	var err error
+	if d.tcp != nil {
+		err = d.tcp.Close()
+		d.tcp = nil
+	}
+	if d.udp != nil {
+		err = d.udp.Close()
+		d.udp = nil
+		d.remote = nil
+	}
+	d.listen = false
+	d.head, d.size = 0, 0
+	return err
+}
+
+// StartSocketSend is a no-op, as the host sockets need no preparation.
+func (d *Driver) StartSocketSend(size int) error {
+	return nil
+}
+
+// Write sends b over the open socket. For UDP sockets, b is sent as a single
+// datagram.
+func (d *Driver) Write(b []byte) (n int, err error) {
+	switch {
+	case d.tcp != nil:
+		return d.tcp.Write(b)
+	case d.udp != nil:
+		if d.remote == nil {
+			return 0, ErrNoRemoteAddr
+		}
+		return d.udp.WriteToUDP(b, d.remote)
+	default:
+		return 0, ErrNoSocket
+	}
+}
+
+// ReadSocket reads received data into b. Like the wifi module drivers it
+// does not block: if no data arrives within PollTimeout it returns 0 and a
+// nil error. A datagram that does not fit into b is returned over several
+// calls.
+func (d *Driver) ReadSocket(b []byte) (n int, err error) {
+	if d.size == 0 {
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(b, d.buf[d.head:d.head+d.size])
+	d.head += n
+	d.size -= n
+	return n, nil
+}
+
+// IsSocketDataAvailable returns true if received data is waiting to be read.
+func (d *Driver) IsSocketDataAvailable() bool {
+	if d.size == 0 {
+		d.fill()
+	}
+	return d.size > 0
+}
+
+// Response is only meaningful for the espat driver; it returns nothing.
+func (d *Driver) Response(timeout int) ([]byte, error) {
+	return nil, nil
+}
+
+// fill reads whatever arrives within the poll timeout into the receive
+// buffer.
+func (d *Driver) fill() error {
+	if d.buf == nil {
+		// large enough for any UDP datagram
+		d.buf = make([]byte, 65536)
+	}
+	timeout := d.PollTimeout
+	if timeout == 0 {
+		timeout = DefaultPollTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	var n int
+	var err error
+	switch {
+	case d.tcp != nil:
+		d.tcp.SetReadDeadline(deadline)
+		n, err = d.tcp.Read(d.buf)
+	case d.udp != nil:
+		d.udp.SetReadDeadline(deadline)
+		var from *stdnet.UDPAddr
+		n, from, err = d.udp.ReadFromUDP(d.buf)
+		if n > 0 && d.listen {
+			d.remote = from
+		}
+	default:
+		return ErrNoSocket
+	}
+	d.head, d.size = 0, n
+	if ne, ok := err.(stdnet.Error); ok && ne.Timeout() {
+		return nil
+	}
+	return err
+}
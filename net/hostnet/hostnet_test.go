@@ -0,0 +1,343 @@
+// +build !baremetal
+
+package hostnet
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"tinygo.org/x/drivers/net"
+	"tinygo.org/x/drivers/net/mqtt"
+	"tinygo.org/x/drivers/net/tls"
+)
+
+// useDriver makes d the active driver for the duration of the test.
+func useDriver(t *testing.T, d *Driver) {
+	net.ActiveDevice = d
+	t.Cleanup(func() {
+		d.DisconnectSocket()
+		net.ActiveDevice = nil
+	})
+}
+
+// readAll reads from conn until want bytes arrived or a second passed.
+func readAll(conn io.Reader, want int) []byte {
+	var got []byte
+	buf := make([]byte, 64)
+	for deadline := time.Now().Add(time.Second); len(got) < want && time.Now().Before(deadline); {
+		n, err := conn.Read(buf)
+		got = append(got, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	return got
+}
+
+// tcpEcho starts a TCP server on the loopback interface that echoes what it
+// receives.
+func tcpEcho(t *testing.T) stdnet.Addr {
+	ln, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return ln.Addr()
+}
+
+// udpEcho starts a UDP server on the loopback interface that echoes each
+// datagram to its sender.
+func udpEcho(t *testing.T) *stdnet.UDPAddr {
+	conn, err := stdnet.ListenUDP("udp4", &stdnet.UDPAddr{IP: stdnet.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], from)
+		}
+	}()
+	return conn.LocalAddr().(*stdnet.UDPAddr)
+}
+
+func TestDialTCP(t *testing.T) {
+	addr := tcpEcho(t)
+	useDriver(t, New())
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("hello over the drivers net package")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(conn, len(msg)); !bytes.Equal(got, msg) {
+		t.Errorf("got %q, want %q", got, msg)
+	}
+	conn.Close()
+	if _, err := conn.Write(msg); err != ErrNoSocket {
+		t.Errorf("Write after Close: got %v, want %v", err, ErrNoSocket)
+	}
+}
+
+func TestDialUDP(t *testing.T) {
+	addr := udpEcho(t)
+	useDriver(t, New())
+
+	conn, err := net.DialUDP("udp", &net.UDPAddr{}, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: addr.Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"first", "second datagram"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		// datagrams are not merged
+		if got := readAll(conn, len(msg)); string(got) != msg {
+			t.Errorf("got %q, want %q", got, msg)
+		}
+	}
+}
+
+func TestListenUDP(t *testing.T) {
+	d := New()
+	d.LocalAddr = "127.0.0.1"
+	useDriver(t, d)
+
+	// find a free port
+	probe, err := stdnet.ListenUDP("udp4", &stdnet.UDPAddr{IP: stdnet.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := probe.LocalAddr().(*stdnet.UDPAddr).Port
+	probe.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("nobody")); err != ErrNoRemoteAddr {
+		t.Errorf("Write before receiving: got %v, want %v", err, ErrNoRemoteAddr)
+	}
+
+	peer, err := stdnet.DialUDP("udp4", nil, &stdnet.UDPAddr{IP: stdnet.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	peer.Write([]byte("ping"))
+	if got := readAll(conn, 4); string(got) != "ping" {
+		t.Fatalf("got %q, want %q", got, "ping")
+	}
+	// the reply goes to the sender
+	if _, err := conn.Write([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 16)
+	n, err := peer.Read(buf)
+	if err != nil || string(buf[:n]) != "pong" {
+		t.Errorf("got %q, %v, want %q", buf[:n], err, "pong")
+	}
+}
+
+func TestDisconnectClearsListen(t *testing.T) {
+	addr := tcpEcho(t)
+	d := New()
+	d.LocalAddr = "127.0.0.1"
+	useDriver(t, d)
+
+	if err := d.ConnectUDPSocket("0", "0", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if !d.listen {
+		t.Fatal("UDP socket without remote address is not listening")
+	}
+	if _, err := net.Dial("tcp", addr.String()); err != nil {
+		t.Fatal(err)
+	}
+	if d.listen {
+		t.Error("TCP connection inherited the listen mode of the UDP socket")
+	}
+}
+
+func TestGetDNS(t *testing.T) {
+	d := New()
+	if ip, err := d.GetDNS("192.168.1.10"); err != nil || ip != "192.168.1.10" {
+		t.Errorf("got %q, %v", ip, err)
+	}
+	d.Resolve = func(domain string) (string, error) {
+		if domain == "broker.local" {
+			return "127.0.0.1", nil
+		}
+		return "", ErrNoIPv4
+	}
+	if ip, err := d.GetDNS("broker.local"); err != nil || ip != "127.0.0.1" {
+		t.Errorf("got %q, %v", ip, err)
+	}
+	if _, err := d.GetDNS("elsewhere.local"); err != ErrNoIPv4 {
+		t.Errorf("got %v, want the error of Resolve", err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure hello")
+	}))
+	defer srv.Close()
+
+	d := New()
+	d.TLSConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	useDriver(t, d)
+
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	conn, err := tls.Dial("tcp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: "+addr+"\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(&blockingReader{conn}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "secure hello" {
+		t.Errorf("got %d %q", resp.StatusCode, body)
+	}
+
+	// without the test certificate, verification fails
+	d.TLSConfig = nil
+	if _, err := tls.Dial("tcp", addr, nil); err == nil {
+		t.Error("connected to a server with an untrusted certificate")
+	}
+}
+
+// blockingReader waits for data on a non-blocking connection, as the
+// standard library readers expect.
+type blockingReader struct {
+	r io.Reader
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		n, err := b.r.Read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.ErrNoProgress
+}
+
+// mqttBroker starts a stand-in broker on the loopback interface for a single
+// client. It accepts the connection and subscriptions, and sends every
+// message published by the client back to it.
+func mqttBroker(t *testing.T) (addr string, published chan *packets.PublishPacket) {
+	ln, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	published = make(chan *packets.PublishPacket, 10)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			p, err := packets.ReadPacket(c)
+			if err != nil {
+				return
+			}
+			switch p := p.(type) {
+			case *packets.ConnectPacket:
+				ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+				if p.ClientIdentifier != "hostnet-test" {
+					ack.ReturnCode = packets.ErrRefusedIDRejected
+				}
+				ack.Write(c)
+			case *packets.SubscribePacket:
+				ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+				ack.MessageID = p.MessageID
+				ack.ReturnCodes = p.Qoss
+				ack.Write(c)
+			case *packets.PublishPacket:
+				published <- p
+				p.Write(c)
+			case *packets.DisconnectPacket:
+				return
+			}
+		}
+	}()
+	return ln.Addr().String(), published
+}
+
+func TestMQTT(t *testing.T) {
+	addr, published := mqttBroker(t)
+	useDriver(t, New())
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker("tcp://" + addr).SetClientID("hostnet-test")
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	if !client.IsConnected() {
+		t.Fatal("not connected")
+	}
+
+	received := make(chan string, 1)
+	token := client.Subscribe("sensors/temperature", 0, func(c mqtt.Client, m mqtt.Message) {
+		received <- m.Topic() + " " + string(m.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	if token := client.Publish("sensors/temperature", 0, false, "21.5"); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	select {
+	case p := <-published:
+		if p.TopicName != "sensors/temperature" || string(p.Payload) != "21.5" {
+			t.Errorf("broker got %q %q", p.TopicName, p.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("broker got no message")
+	}
+	select {
+	case m := <-received:
+		if m != "sensors/temperature 21.5" {
+			t.Errorf("client got %q", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client got no message")
+	}
+}
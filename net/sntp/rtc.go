@@ -0,0 +1,165 @@
+package sntp
+
+import (
+	"time"
+)
+
+// RTC is a real time clock that can be set, such as ds3231.Device or
+// ds1307.Device.
+type RTC interface {
+	SetTime(t time.Time) error
+}
+
+// DriftStats collects statistics about the difference between a real time
+// clock and the time reported by the server pool. Drift is positive when the
+// RTC is ahead of the server.
+type DriftStats struct {
+	// Samples is the number of drift measurements taken.
+	Samples int
+
+	// Last, Min, Max and Mean describe the measured drift.
+	Last time.Duration
+	Min  time.Duration
+	Max  time.Duration
+	Mean time.Duration
+
+	// PPM is the drift rate in parts per million measured over the time
+	// since the RTC was last set. It is only valid once Samples > 1.
+	PPM float32
+
+	// Corrections is the number of times the RTC has been set.
+	Corrections int
+
+	// LastSync is the server time of the most recent successful query.
+	LastSync time.Time
+}
+
+// Discipliner periodically sets a real time clock from an SNTP client and
+// keeps track of how far the clock has drifted in between.
+//
+//	rtc := ds3231.New(machine.I2C0)
+//	d := sntp.Discipliner{
+//		Client:   &sntp.Client{},
+//		RTC:      &rtc,
+//		ReadTime: rtc.ReadTime,
+//		Interval: time.Hour,
+//	}
+//	d.Run(nil)
+type Discipliner struct {
+	// Client is used to query the current time.
+	Client *Client
+
+	// RTC is the clock that is set.
+	RTC RTC
+
+	// ReadTime reads the current time from the RTC. It is optional but
+	// required to measure drift, e.g. ds3231.Device.ReadTime or
+	// ds1307.Device.Time.
+	ReadTime func() (time.Time, error)
+
+	// Interval is the time between synchronizations in Run.
+	Interval time.Duration
+
+	// Threshold is the drift below which the RTC is not set again. The
+	// default of zero always sets the RTC. It is ignored if ReadTime is nil.
+	Threshold time.Duration
+
+	// OnError, if set, is called by Run with the error of each failed Sync.
+	OnError func(err error)
+
+	// Stats holds the drift statistics gathered so far.
+	Stats DriftStats
+
+	lastSet time.Time
+	sum     time.Duration
+}
+
+// Sync queries the server pool once, measures the drift of the RTC and sets
+// it if needed.
+func (d *Discipliner) Sync() error {
+	r, err := d.Client.Query()
+	if err != nil {
+		return err
+	}
+
+	if d.ReadTime != nil {
+		rtcTime, err := d.ReadTime()
+		if err != nil {
+			return err
+		}
+		// the RTC is read after the reply arrived, so compare it against
+		// the server time at the same moment.
+		now := time.Now().Add(r.ClockOffset)
+		d.addSample(rtcTime.Sub(now), now)
+		if d.Stats.Samples > 1 && abs(d.Stats.Last) < d.Threshold {
+			d.Stats.LastSync = now
+			return nil
+		}
+	}
+
+	if err := d.set(r.ClockOffset); err != nil {
+		return err
+	}
+	d.Stats.LastSync = r.Time
+	return nil
+}
+
+// Run calls Sync every Interval until stop is closed. A failed Sync is
+// reported to OnError and retried after the next Interval. If stop is nil,
+// Run never returns.
+func (d *Discipliner) Run(stop <-chan struct{}) {
+	interval := d.Interval
+	if interval == 0 {
+		interval = time.Hour
+	}
+	for {
+		if err := d.Sync(); err != nil && d.OnError != nil {
+			d.OnError(err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// set waits for the start of the next second of server time and then sets
+// the RTC, because the RTCs supported here only store whole seconds.
+func (d *Discipliner) set(offset time.Duration) error {
+	now := time.Now().Add(offset)
+	next := now.Truncate(time.Second).Add(time.Second)
+	time.Sleep(next.Sub(now))
+	if err := d.RTC.SetTime(next.UTC()); err != nil {
+		return err
+	}
+	d.lastSet = next
+	d.Stats.Corrections++
+	return nil
+}
+
+func (d *Discipliner) addSample(drift time.Duration, now time.Time) {
+	s := &d.Stats
+	if s.Samples == 0 || drift < s.Min {
+		s.Min = drift
+	}
+	if s.Samples == 0 || drift > s.Max {
+		s.Max = drift
+	}
+	s.Samples++
+	s.Last = drift
+	d.sum += drift
+	s.Mean = d.sum / time.Duration(s.Samples)
+	if !d.lastSet.IsZero() {
+		if elapsed := now.Sub(d.lastSet); elapsed > 0 {
+			s.PPM = float32(float64(drift) / float64(elapsed) * 1e6)
+		}
+	}
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
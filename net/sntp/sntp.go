@@ -0,0 +1,310 @@
+// Package sntp implements a Simple Network Time Protocol (RFC 4330) client
+// on top of the UDP support in the drivers net package.
+//
+// The client queries a pool of servers in turn and computes the clock offset
+// and round-trip delay of each exchange, so the result can be used to set a
+// real time clock such as the DS3231 or DS1307.
+package sntp // import "tinygo.org/x/drivers/net/sntp"
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+)
+
+const (
+	// DefaultPort is the well-known NTP port.
+	DefaultPort = 123
+
+	// DefaultLocalPort is the UDP port that replies are received on.
+	DefaultLocalPort = 2390
+
+	// DefaultTimeout is the time to wait for a reply from a single server.
+	DefaultTimeout = 2 * time.Second
+
+	packetSize = 48
+
+	// ntpEpochOffset is the number of seconds between the NTP epoch
+	// (1900-01-01) and the Unix epoch (1970-01-01).
+	ntpEpochOffset = 2208988800
+
+	modeClient = 3
+	modeServer = 4
+	version    = 4
+)
+
+// DefaultServers is the server pool used when a Client has no Servers set.
+var DefaultServers = []string{
+	"0.pool.ntp.org",
+	"1.pool.ntp.org",
+	"2.pool.ntp.org",
+	"3.pool.ntp.org",
+}
+
+var (
+	ErrTimeout        = errors.New("sntp: timeout waiting for reply")
+	ErrShortPacket    = errors.New("sntp: short reply packet")
+	ErrInvalidReply   = errors.New("sntp: invalid reply")
+	ErrKissOfDeath    = errors.New("sntp: server sent kiss-of-death")
+	ErrUnsynchronized = errors.New("sntp: server clock is not synchronized")
+	ErrNoServers      = errors.New("sntp: no servers configured")
+)
+
+// Client queries SNTP servers over the currently active net.DeviceDriver.
+type Client struct {
+	// Servers is the pool of host names or IP addresses to query. Each query
+	// starts with the server that answered last, and moves on to the next
+	// server when one fails. When none answers, the next query starts one
+	// server further. If empty, DefaultServers is used.
+	Servers []string
+
+	// Port is the remote port, DefaultPort if zero.
+	Port int
+
+	// LocalPort is the local port replies are received on, DefaultLocalPort
+	// if zero.
+	LocalPort int
+
+	// Timeout is the time to wait for a reply from each server,
+	// DefaultTimeout if zero.
+	Timeout time.Duration
+
+	next int
+	buf  [packetSize]byte
+}
+
+// Response is the result of a single SNTP exchange.
+type Response struct {
+	// Server is the entry of the server pool that answered.
+	Server string
+
+	// Time is the corrected time at the moment the reply was received.
+	Time time.Time
+
+	// ClockOffset is the estimated offset of the server clock relative to
+	// the local clock. Adding it to time.Now() gives the server time.
+	ClockOffset time.Duration
+
+	// RTT is the round-trip delay of the exchange, excluding the time the
+	// server took to process the request.
+	RTT time.Duration
+
+	// Stratum is the stratum of the server, 1 for a primary reference.
+	Stratum uint8
+
+	// ReferenceID identifies the reference clock or upstream server.
+	ReferenceID uint32
+
+	// Precision is the precision of the server clock.
+	Precision time.Duration
+
+	// RootDelay and RootDispersion describe the total delay and dispersion
+	// to the reference clock as reported by the server.
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+
+	// Leap is the leap indicator of the server (0 = no warning,
+	// 1 = last minute has 61 seconds, 2 = last minute has 59 seconds).
+	Leap uint8
+}
+
+// Time returns the current time as reported by the server pool.
+func (c *Client) Time() (time.Time, error) {
+	r, err := c.Query()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.Time, nil
+}
+
+// Query sends a request to the servers in the pool in turn, returning the
+// first valid response. If no server answers, the error of the last attempt
+// is returned.
+func (c *Client) Query() (*Response, error) {
+	servers := c.Servers
+	if len(servers) == 0 {
+		servers = DefaultServers
+	}
+	if len(servers) == 0 {
+		return nil, ErrNoServers
+	}
+
+	var err error
+	for i := 0; i < len(servers); i++ {
+		idx := (c.next + i) % len(servers)
+		var r *Response
+		r, err = c.QueryServer(servers[idx])
+		if err == nil {
+			c.next = idx
+			return r, nil
+		}
+	}
+	c.next = (c.next + 1) % len(servers)
+	return nil, err
+}
+
+// QueryServer sends a single request to the given server.
+func (c *Client) QueryServer(server string) (*Response, error) {
+	port := c.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	lport := c.LocalPort
+	if lport == 0 {
+		lport = DefaultLocalPort
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", server+":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", &net.UDPAddr{Port: lport}, raddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Only the first byte and the transmit timestamp matter in a client
+	// request. The transmit timestamp is echoed back by the server as the
+	// originate timestamp, which allows matching the reply to the request.
+	req := c.buf[:]
+	for i := range req {
+		req[i] = 0
+	}
+	req[0] = version<<3 | modeClient
+	t1 := time.Now()
+	putTimestamp(req[40:], t1)
+	var origin [8]byte
+	copy(origin[:], req[40:48])
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	expire := t1.Add(timeout)
+	n := 0
+	for n < packetSize {
+		m, err := conn.Read(c.buf[n:])
+		if err != nil {
+			return nil, err
+		}
+		n += m
+		if m == 0 {
+			if time.Now().After(expire) {
+				return nil, ErrTimeout
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	t4 := time.Now()
+
+	r, err := parseReply(c.buf[:n], origin[:], t1, t4)
+	if err != nil {
+		return nil, err
+	}
+	r.Server = server
+	return r, nil
+}
+
+// parseReply validates a server reply and computes the clock offset and
+// round-trip delay from the four timestamps of the exchange:
+//
+//	t1: client transmit time (local clock)
+//	t2: server receive time (server clock)
+//	t3: server transmit time (server clock)
+//	t4: client receive time (local clock)
+func parseReply(b []byte, origin []byte, t1, t4 time.Time) (*Response, error) {
+	if len(b) < packetSize {
+		return nil, ErrShortPacket
+	}
+	leap := b[0] >> 6
+	mode := b[0] & 0x07
+	if mode != modeServer {
+		return nil, ErrInvalidReply
+	}
+	for i := 0; i < 8; i++ {
+		if b[24+i] != origin[i] {
+			return nil, ErrInvalidReply
+		}
+	}
+	stratum := b[1]
+	if stratum == 0 {
+		return nil, ErrKissOfDeath
+	}
+	if leap == 3 {
+		return nil, ErrUnsynchronized
+	}
+
+	t2 := getTimestamp(b[32:])
+	t3 := getTimestamp(b[40:])
+	if t3.IsZero() {
+		return nil, ErrInvalidReply
+	}
+
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	rtt := t4.Sub(t1) - t3.Sub(t2)
+	if rtt < 0 {
+		rtt = 0
+	}
+
+	return &Response{
+		Time:           t4.Add(offset),
+		ClockOffset:    offset,
+		RTT:            rtt,
+		Stratum:        stratum,
+		ReferenceID:    be32(b[12:]),
+		Precision:      precision(int8(b[3])),
+		RootDelay:      shortFormat(be32(b[4:])),
+		RootDispersion: shortFormat(be32(b[8:])),
+		Leap:           leap,
+	}, nil
+}
+
+// getTimestamp decodes a 64-bit NTP timestamp. Timestamps with the most
+// significant bit cleared are assumed to be in NTP era 1, which starts in
+// 2036.
+func getTimestamp(b []byte) time.Time {
+	sec := be32(b)
+	frac := be32(b[4:])
+	if sec == 0 && frac == 0 {
+		return time.Time{}
+	}
+	unix := int64(sec) - ntpEpochOffset
+	if sec&0x80000000 == 0 {
+		unix += 1 << 32
+	}
+	nsec := (int64(frac) * 1e9) >> 32
+	return time.Unix(unix, nsec)
+}
+
+// putTimestamp encodes t as a 64-bit NTP timestamp.
+func putTimestamp(b []byte, t time.Time) {
+	sec := uint32(t.Unix() + ntpEpochOffset)
+	frac := uint32((int64(t.Nanosecond()) << 32) / 1e9)
+	b[0], b[1], b[2], b[3] = byte(sec>>24), byte(sec>>16), byte(sec>>8), byte(sec)
+	b[4], b[5], b[6], b[7] = byte(frac>>24), byte(frac>>16), byte(frac>>8), byte(frac)
+}
+
+// shortFormat converts the 32-bit NTP short format (16.16 fixed point
+// seconds) to a duration.
+func shortFormat(v uint32) time.Duration {
+	return time.Duration((int64(v) * int64(time.Second)) >> 16)
+}
+
+// precision converts a log2 seconds precision value to a duration.
+func precision(p int8) time.Duration {
+	if p >= 0 {
+		return time.Second << uint(p)
+	}
+	return time.Second >> uint(-p)
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
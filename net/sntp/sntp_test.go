@@ -0,0 +1,170 @@
+package sntp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+)
+
+// tick is a duration that NTP timestamps represent exactly.
+const tick = time.Second / 256
+
+// reply returns a reply of a server of stratum 2 to a request sent at t1,
+// received at t2 and answered at t3.
+func reply(t1, t2, t3 time.Time) []byte {
+	b := make([]byte, packetSize)
+	b[0] = version<<3 | modeServer
+	b[1] = 2
+	b[3] = 0xEC                                   // precision of 2^-20 s
+	b[4], b[5], b[6], b[7] = 0, 0, 0x80, 0        // root delay of 0.5 s
+	b[8], b[9], b[10], b[11] = 0, 1, 0, 0         // root dispersion of 1 s
+	b[12], b[13], b[14], b[15] = 'G', 'P', 'S', 0 // reference
+	putTimestamp(b[24:], t1)
+	putTimestamp(b[32:], t2)
+	putTimestamp(b[40:], t3)
+	return b
+}
+
+func TestParseReply(t *testing.T) {
+	t1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// the server is 5 s ahead, the datagrams take 2 ticks each way, and the
+	// server answers in a tick
+	t2 := t1.Add(5*time.Second + 2*tick)
+	t3 := t2.Add(tick)
+	t4 := t1.Add(5 * tick)
+	b := reply(t1, t2, t3)
+
+	r, err := parseReply(b, b[24:32], t1, t4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ClockOffset != 5*time.Second || r.RTT != 4*tick || !r.Time.Equal(t4.Add(5*time.Second)) {
+		t.Errorf("offset %v, RTT %v, time %v", r.ClockOffset, r.RTT, r.Time)
+	}
+	if r.Stratum != 2 || r.ReferenceID != 0x47505300 || r.Precision != 953*time.Nanosecond ||
+		r.RootDelay != time.Second/2 || r.RootDispersion != time.Second || r.Leap != 0 {
+		t.Errorf("got %+v", r)
+	}
+
+	// a server that took longer than the exchange gives no negative RTT
+	b = reply(t1, t2, t2.Add(time.Second))
+	if r, err := parseReply(b, b[24:32], t1, t4); err != nil || r.RTT != 0 {
+		t.Errorf("got %v, %v, want an RTT of 0", r, err)
+	}
+
+	// the leap indicator
+	b = reply(t1, t2, t3)
+	b[0] |= 1 << 6
+	if r, err := parseReply(b, b[24:32], t1, t4); err != nil || r.Leap != 1 {
+		t.Errorf("got %v, %v, want a leap indicator of 1", r, err)
+	}
+}
+
+func TestParseReplyErrors(t *testing.T) {
+	t1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(tick)
+	for _, tc := range []struct {
+		name   string
+		change func(b []byte) []byte
+		err    error
+	}{
+		{"short", func(b []byte) []byte { return b[:packetSize-1] }, ErrShortPacket},
+		{"client mode", func(b []byte) []byte { b[0] = version<<3 | modeClient; return b }, ErrInvalidReply},
+		{"origin mismatch", func(b []byte) []byte { b[31]++; return b }, ErrInvalidReply},
+		// the RATE kiss code asks the client to send less often
+		{"kiss-of-death", func(b []byte) []byte { b[1] = 0; copy(b[12:], "RATE"); return b }, ErrKissOfDeath},
+		{"unsynchronized", func(b []byte) []byte { b[0] |= 3 << 6; return b }, ErrUnsynchronized},
+		{"zero transmit time", func(b []byte) []byte {
+			for i := 40; i < 48; i++ {
+				b[i] = 0
+			}
+			return b
+		}, ErrInvalidReply},
+	} {
+		b := reply(t1, t2, t2)
+		var origin [8]byte
+		copy(origin[:], b[24:])
+		if _, err := parseReply(tc.change(b), origin[:], t1, t2); err != tc.err {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	for _, tc := range []struct {
+		b    [8]byte
+		want time.Time
+	}{
+		{[8]byte{0x83, 0xAA, 0x7E, 0x80}, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{[8]byte{0x83, 0xAA, 0x7E, 0x80, 0x40}, time.Date(1970, 1, 1, 0, 0, 0, 250000000, time.UTC)},
+		{[8]byte{0x83, 0xAA, 0x7E, 0x80, 0xFF, 0xFF, 0xFF, 0xFF}, time.Date(1970, 1, 1, 0, 0, 0, 999999999, time.UTC)},
+		// the first and last seconds of era 0
+		{[8]byte{0x80}, time.Date(1968, 1, 20, 3, 14, 8, 0, time.UTC)},
+		{[8]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x80}, time.Date(2036, 2, 7, 6, 28, 15, 500000000, time.UTC)},
+		// and of era 1
+		{[8]byte{0, 0, 0, 0, 0x80}, time.Date(2036, 2, 7, 6, 28, 16, 500000000, time.UTC)},
+		{[8]byte{0, 0, 0, 1}, time.Date(2036, 2, 7, 6, 28, 17, 0, time.UTC)},
+		{[8]byte{0x7F, 0xFF, 0xFF, 0xFF}, time.Date(2104, 2, 26, 9, 42, 23, 0, time.UTC)},
+	} {
+		if got := getTimestamp(tc.b[:]); !got.Equal(tc.want) {
+			t.Errorf("% x: got %v, want %v", tc.b, got.UTC(), tc.want)
+		}
+		// the fraction is truncated both ways, which loses up to 2 ns
+		var b [8]byte
+		putTimestamp(b[:], tc.want)
+		if d := tc.want.Sub(getTimestamp(b[:])); d < 0 || d > 2 {
+			t.Errorf("%v: encoded as % x, read back %v earlier", tc.want, b, d)
+		}
+	}
+	if got := getTimestamp(make([]byte, 8)); !got.IsZero() {
+		t.Errorf("zero timestamp: got %v", got)
+	}
+}
+
+func TestShortFormat(t *testing.T) {
+	if d := shortFormat(0x00018000); d != 1500*time.Millisecond {
+		t.Errorf("got %v, want 1.5s", d)
+	}
+	if d := precision(-20); d != 953*time.Nanosecond {
+		t.Errorf("got %v, want 953ns", d)
+	}
+	if d := precision(1); d != 2*time.Second {
+		t.Errorf("got %v, want 2s", d)
+	}
+}
+
+var errNoDNS = errors.New("no DNS")
+
+// noDNS is a driver that cannot resolve names.
+type noDNS struct {
+	net.DeviceDriver
+}
+
+func (noDNS) GetDNS(domain string) (string, error) {
+	return "", errNoDNS
+}
+
+func TestRunReportsErrors(t *testing.T) {
+	saved := net.ActiveDevice
+	net.ActiveDevice = noDNS{}
+	defer func() { net.ActiveDevice = saved }()
+
+	stop := make(chan struct{})
+	var errs []error
+	d := Discipliner{
+		Client:   &Client{Servers: []string{"a", "b"}},
+		Interval: time.Millisecond,
+		OnError: func(err error) {
+			errs = append(errs, err)
+			if len(errs) == 2 {
+				close(stop)
+			}
+		},
+	}
+	d.Run(stop)
+	if len(errs) != 2 || errs[0] != errNoDNS || errs[1] != errNoDNS {
+		t.Errorf("got %v", errs)
+	}
+}
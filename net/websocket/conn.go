@@ -0,0 +1,563 @@
+package websocket
+
+import (
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the opcode of a WebSocket frame.
+type MessageType uint8
+
+const (
+	continuationFrame MessageType = 0
+	TextMessage       MessageType = 1
+	BinaryMessage     MessageType = 2
+	CloseMessage      MessageType = 8
+	PingMessage       MessageType = 9
+	PongMessage       MessageType = 10
+)
+
+func (t MessageType) isControl() bool {
+	return t >= CloseMessage
+}
+
+// closeTimeout is the time Close waits for the server to acknowledge the
+// close frame.
+const closeTimeout = 2 * time.Second
+
+// pollInterval is the time between reads while waiting for data, as the
+// drivers net connections do not block.
+const pollInterval = time.Millisecond
+
+// Conn is a client WebSocket connection.
+type Conn struct {
+	conn io.ReadWriteCloser
+
+	// Subprotocol is the subprotocol selected by the server, if any.
+	Subprotocol string
+
+	// ReadTimeout limits the time a read waits for data from the server.
+	// Zero means wait forever.
+	ReadTimeout time.Duration
+
+	// MaxFrameSize is the largest payload sent in a single frame by
+	// WriteMessage; larger messages are fragmented. Zero means no limit.
+	MaxFrameSize int
+
+	// PongHandler is called with the payload of each pong frame received.
+	PongHandler func(data []byte)
+
+	// read buffer
+	rbuf [128]byte
+	r, w int
+
+	// write buffer for frame headers and masked payload
+	wbuf [256]byte
+
+	deadline time.Time
+	rnd      uint32
+
+	// state of the frame being read
+	remaining uint64
+	fin       bool
+	inMessage bool
+	msgType   MessageType
+	reader    messageReader
+
+	closeSent bool
+	closed    error
+	ctrl      [125]byte
+}
+
+func newConn(conn io.ReadWriteCloser) *Conn {
+	c := &Conn{conn: conn, rnd: uint32(time.Now().UnixNano()) | 1}
+	c.reader.c = c
+	return c
+}
+
+// random returns the next value of a xorshift generator used for the masking
+// keys. RFC 6455 asks for unpredictable keys to protect intermediaries, but
+// most microcontrollers lack a source of strong randomness.
+func (c *Conn) random() uint32 {
+	c.rnd ^= c.rnd << 13
+	c.rnd ^= c.rnd >> 17
+	c.rnd ^= c.rnd << 5
+	return c.rnd
+}
+
+// fill waits for data from the underlying connection.
+func (c *Conn) fill(p []byte) (int, error) {
+	for {
+		n, err := c.conn.Read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+		if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+			return 0, ErrTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func (c *Conn) readByte() (byte, error) {
+	if c.r == c.w {
+		n, err := c.fill(c.rbuf[:])
+		if err != nil {
+			return 0, err
+		}
+		c.r, c.w = 0, n
+	}
+	b := c.rbuf[c.r]
+	c.r++
+	return b, nil
+}
+
+// readRaw reads up to len(p) bytes, from the buffer first.
+func (c *Conn) readRaw(p []byte) (int, error) {
+	if c.r < c.w {
+		n := copy(p, c.rbuf[c.r:c.w])
+		c.r += n
+		return n, nil
+	}
+	return c.fill(p)
+}
+
+func (c *Conn) startRead() {
+	if c.ReadTimeout > 0 {
+		c.deadline = time.Now().Add(c.ReadTimeout)
+	} else {
+		c.deadline = time.Time{}
+	}
+}
+
+// peek returns the next n bytes, which must fit in the read buffer, without
+// consuming them.
+func (c *Conn) peek(n int) ([]byte, error) {
+	for c.w-c.r < n {
+		if c.r > 0 {
+			c.w = copy(c.rbuf[:], c.rbuf[c.r:c.w])
+			c.r = 0
+		}
+		m, err := c.fill(c.rbuf[c.w:])
+		if err != nil {
+			return nil, err
+		}
+		c.w += m
+	}
+	return c.rbuf[c.r : c.r+n], nil
+}
+
+// readHeader reads the next frame header, and the payload of a control frame
+// into ctrl. Nothing is consumed until all of it has arrived, so a read that
+// times out halfway can be retried.
+func (c *Conn) readHeader() (op MessageType, fin bool, length uint64, err error) {
+	b, err := c.peek(2)
+	if err != nil {
+		return
+	}
+	fin = b[0]&0x80 != 0
+	op = MessageType(b[0] & 0x0f)
+	if b[0]&0x70 != 0 || b[1]&0x80 != 0 {
+		// no extensions are negotiated, and servers must not mask frames
+		return op, fin, 0, ErrProtocol
+	}
+	length = uint64(b[1] & 0x7f)
+	n := 2
+	switch length {
+	case 126:
+		n = 4
+	case 127:
+		n = 10
+	}
+	if op.isControl() {
+		if !fin || length > 125 {
+			return op, fin, length, ErrProtocol
+		}
+		n += int(length)
+	}
+	if b, err = c.peek(n); err != nil {
+		return
+	}
+	switch length {
+	case 126:
+		length = uint64(b[2])<<8 | uint64(b[3])
+	case 127:
+		length = 0
+		for _, x := range b[2:10] {
+			length = length<<8 | uint64(x)
+		}
+	}
+	if op.isControl() {
+		copy(c.ctrl[:], b[2:])
+	}
+	c.r += n
+	return op, fin, length, nil
+}
+
+// nextFrame reads frame headers, handling control frames, until a data frame
+// is found.
+func (c *Conn) nextFrame() (MessageType, error) {
+	for {
+		op, fin, length, err := c.readHeader()
+		if err != nil {
+			return 0, c.fail(err)
+		}
+		if !op.isControl() {
+			c.fin = fin
+			c.remaining = length
+			return op, nil
+		}
+		payload := c.ctrl[:length]
+		switch op {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, true, payload); err != nil {
+				return 0, err
+			}
+		case PongMessage:
+			if c.PongHandler != nil {
+				c.PongHandler(payload)
+			}
+		case CloseMessage:
+			return 0, c.handleClose(payload)
+		default:
+			return 0, c.fail(ErrProtocol)
+		}
+	}
+}
+
+// handleClose processes a close frame from the server, acknowledging it if
+// we did not start the closing handshake.
+func (c *Conn) handleClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(ErrProtocol)
+	case len(payload) >= 2:
+		ce.Code = CloseCode(payload[0])<<8 | CloseCode(payload[1])
+		if !validCloseCode(ce.Code) {
+			return c.fail(ErrProtocol)
+		}
+		if !utf8.Valid(payload[2:]) {
+			return c.fail(ErrInvalidUTF8)
+		}
+		ce.Reason = string(payload[2:])
+	}
+	if !c.closeSent {
+		c.closeSent = true
+		if len(payload) >= 2 {
+			c.writeFrame(CloseMessage, true, payload[:2])
+		} else {
+			c.writeFrame(CloseMessage, true, nil)
+		}
+	}
+	c.closed = ce
+	c.conn.Close()
+	return ce
+}
+
+// validCloseCode returns whether code may be received in a close frame
+// (RFC 6455 section 7.4): the codes registered for the protocol except those
+// reserved to report a missing code or an abnormal closure locally, and the
+// ranges of libraries and applications.
+func validCloseCode(code CloseCode) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < CloseNormal || code > 1014:
+		return false
+	}
+	return code != 1004 && code != CloseNoStatus && code != CloseAbnormal
+}
+
+// fail sends a close frame for a protocol violation and closes the
+// connection.
+func (c *Conn) fail(err error) error {
+	if err == ErrTimeout {
+		return err
+	}
+	if c.closed != nil {
+		return c.closed
+	}
+	code := CloseProtocolError
+	switch err {
+	case ErrInvalidUTF8:
+		code = CloseInvalidPayload
+	case ErrMessageTooBig:
+		code = CloseMessageTooBig
+	}
+	if !c.closeSent && err != io.EOF {
+		c.closeSent = true
+		c.writeClose(code, "")
+	}
+	c.closed = err
+	c.conn.Close()
+	return err
+}
+
+// NextReader returns the type of the next data message and a reader for its
+// payload. Any unread part of the previous message is discarded. Control
+// frames that arrive before or between the fragments of the message are
+// handled transparently.
+func (c *Conn) NextReader() (MessageType, io.Reader, error) {
+	if c.closed != nil {
+		return 0, nil, c.closed
+	}
+	c.startRead()
+	for c.inMessage {
+		var discard [64]byte
+		if _, err := c.reader.Read(discard[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	op, err := c.nextFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+	if op != TextMessage && op != BinaryMessage {
+		return 0, nil, c.fail(ErrProtocol)
+	}
+	c.msgType = op
+	c.inMessage = true
+	return op, &c.reader, nil
+}
+
+// ReadMessage reads the next data message into buf and returns its type and
+// length. If the message is longer than buf, ErrMessageTooBig is returned
+// with the first len(buf) bytes and the rest of the message is discarded.
+// Text messages are checked to be valid UTF-8.
+func (c *Conn) ReadMessage(buf []byte) (MessageType, int, error) {
+	typ, r, err := c.NextReader()
+	if err != nil {
+		return 0, 0, err
+	}
+	n := 0
+	for {
+		if n == len(buf) {
+			var probe [1]byte
+			m, err := r.Read(probe[:])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return typ, n, err
+			}
+			if m > 0 {
+				return typ, n, ErrMessageTooBig
+			}
+			continue
+		}
+		m, err := r.Read(buf[n:])
+		n += m
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return typ, n, err
+		}
+	}
+	if typ == TextMessage && !utf8.Valid(buf[:n]) {
+		return typ, n, c.fail(ErrInvalidUTF8)
+	}
+	return typ, n, nil
+}
+
+// messageReader reads the payload of the current message across fragments.
+type messageReader struct {
+	c *Conn
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	c := r.c
+	if !c.inMessage {
+		return 0, io.EOF
+	}
+	for c.remaining == 0 {
+		if c.fin {
+			c.inMessage = false
+			return 0, io.EOF
+		}
+		op, err := c.nextFrame()
+		if err != nil {
+			return 0, err
+		}
+		if op != continuationFrame {
+			return 0, c.fail(ErrProtocol)
+		}
+	}
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.readRaw(p)
+	c.remaining -= uint64(n)
+	if err != nil {
+		return n, c.fail(err)
+	}
+	return n, nil
+}
+
+// writeFrame sends a single frame. The payload is masked in chunks through
+// the write buffer so it is not modified and no extra memory is needed.
+func (c *Conn) writeFrame(op MessageType, fin bool, payload []byte) error {
+	b := c.wbuf[:0]
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	b = append(b, b0)
+	n := len(payload)
+	switch {
+	case n < 126:
+		b = append(b, 0x80|byte(n))
+	case n < 1<<16:
+		b = append(b, 0x80|126, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x80|127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	v := c.random()
+	mask := [4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	b = append(b, mask[:]...)
+
+	pos := 0
+	for {
+		free := len(c.wbuf) - len(b)
+		chunk := payload[pos:]
+		if len(chunk) > free {
+			chunk = chunk[:free]
+		}
+		for i, x := range chunk {
+			b = append(b, x^mask[(pos+i)&3])
+		}
+		pos += len(chunk)
+		if _, err := c.conn.Write(b); err != nil {
+			return err
+		}
+		if pos == len(payload) {
+			return nil
+		}
+		b = c.wbuf[:0]
+	}
+}
+
+func (c *Conn) writeClose(code CloseCode, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	var buf [125]byte
+	buf[0], buf[1] = byte(code>>8), byte(code)
+	n := 2 + copy(buf[2:], reason)
+	return c.writeFrame(CloseMessage, true, buf[:n])
+}
+
+// WriteMessage sends a text or binary message. Messages larger than
+// MaxFrameSize are split into fragments.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if c.closed != nil {
+		return c.closed
+	}
+	if c.MaxFrameSize <= 0 || len(data) <= c.MaxFrameSize {
+		return c.writeFrame(typ, true, data)
+	}
+	op := typ
+	for len(data) > c.MaxFrameSize {
+		if err := c.writeFrame(op, false, data[:c.MaxFrameSize]); err != nil {
+			return err
+		}
+		data = data[c.MaxFrameSize:]
+		op = continuationFrame
+	}
+	return c.writeFrame(op, true, data)
+}
+
+// WriteText sends a text message.
+func (c *Conn) WriteText(s string) error {
+	return c.WriteMessage(TextMessage, []byte(s))
+}
+
+// NextWriter returns a writer for a message of the given type. Each call to
+// Write sends one fragment, and Close sends the final fragment, so messages
+// can be streamed without holding them in memory.
+func (c *Conn) NextWriter(typ MessageType) io.WriteCloser {
+	return &messageWriter{c: c, op: typ}
+}
+
+type messageWriter struct {
+	c      *Conn
+	op     MessageType
+	closed bool
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.c.writeFrame(w.op, false, p); err != nil {
+		return 0, err
+	}
+	w.op = continuationFrame
+	return len(p), nil
+}
+
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.c.writeFrame(w.op, true, nil)
+}
+
+// Ping sends a ping frame with an optional payload of up to 125 bytes. The
+// pong is delivered to PongHandler while reading.
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return ErrControlTooLong
+	}
+	return c.writeFrame(PingMessage, true, data)
+}
+
+// Close starts the closing handshake with the given code and reason, waits
+// briefly for the server to acknowledge it and closes the connection.
+func (c *Conn) Close(code CloseCode, reason string) error {
+	if c.closed != nil {
+		return nil
+	}
+	if !c.closeSent {
+		c.closeSent = true
+		if err := c.writeClose(code, reason); err != nil {
+			c.closed = ErrClosed
+			c.conn.Close()
+			return err
+		}
+	}
+	c.deadline = time.Now().Add(closeTimeout)
+	for c.closed == nil {
+		c.inMessage = false
+		if _, err := c.nextFrame(); err != nil {
+			break
+		}
+		// discard data frames until the close frame arrives
+		for c.remaining > 0 {
+			var discard [64]byte
+			n := uint64(len(discard))
+			if n > c.remaining {
+				n = c.remaining
+			}
+			m, err := c.readRaw(discard[:n])
+			c.remaining -= uint64(m)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if c.closed == nil {
+		c.closed = ErrClosed
+		c.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Package websocket implements a WebSocket client (RFC 6455) on top of the
+// connections of the drivers net and net/tls packages.
+//
+// Frames are read through a small fixed buffer, so receiving a message only
+// needs as much memory as the caller provides for it. Control frames are
+// handled transparently: pings are answered, and a close frame from the
+// server is acknowledged and reported as a *CloseError.
+package websocket // import "tinygo.org/x/drivers/net/websocket"
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+	"tinygo.org/x/drivers/net/tls"
+)
+
+// acceptGUID is appended to the handshake key to compute the expected
+// Sec-WebSocket-Accept header.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	ErrBadScheme      = errors.New("websocket: url scheme must be ws or wss")
+	ErrBadHandshake   = errors.New("websocket: bad handshake")
+	ErrHeaderTooLong  = errors.New("websocket: handshake header too long")
+	ErrTimeout        = errors.New("websocket: timeout")
+	ErrProtocol       = errors.New("websocket: protocol error")
+	ErrMessageTooBig  = errors.New("websocket: message too big")
+	ErrInvalidUTF8    = errors.New("websocket: invalid utf-8 in text message")
+	ErrClosed         = errors.New("websocket: connection closed")
+	ErrControlTooLong = errors.New("websocket: control frame payload too long")
+)
+
+// Config holds optional settings for the opening handshake.
+type Config struct {
+	// Origin is sent in the Origin header if set.
+	Origin string
+
+	// Protocols are the requested subprotocols, in order of preference.
+	Protocols []string
+
+	// Header contains additional header lines such as
+	// "Authorization: Bearer xyz", without line endings.
+	Header []string
+
+	// Timeout limits the time to wait for the handshake response. Zero
+	// means DefaultHandshakeTimeout.
+	Timeout time.Duration
+}
+
+// DefaultHandshakeTimeout is the time to wait for the server to complete the
+// opening handshake.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Dial opens a WebSocket connection to a ws:// or wss:// URL. The config may
+// be nil.
+func Dial(url string, config *Config) (*Conn, error) {
+	var secure bool
+	switch {
+	case strings.HasPrefix(url, "ws://"):
+		url = url[len("ws://"):]
+	case strings.HasPrefix(url, "wss://"):
+		url = url[len("wss://"):]
+		secure = true
+	default:
+		return nil, ErrBadScheme
+	}
+
+	host, path := url, "/"
+	if i := strings.IndexByte(url, '/'); i >= 0 {
+		host, path = url[:i], url[i:]
+	}
+	address := host
+	if strings.IndexByte(host, ':') < 0 {
+		if secure {
+			address += ":443"
+		} else {
+			address += ":80"
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.Dial("tcp", address, nil)
+	} else {
+		conn, err = net.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn, host, path, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient performs the opening handshake over an established connection
+// and returns the WebSocket connection. The config may be nil.
+func NewClient(conn io.ReadWriteCloser, host, path string, config *Config) (*Conn, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	c := newConn(conn)
+
+	var key [16]byte
+	for i := 0; i < len(key); i += 4 {
+		v := c.random()
+		key[i], key[i+1], key[i+2], key[i+3] = byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(key[:])
+
+	var sb strings.Builder
+	sb.WriteString("GET " + path + " HTTP/1.1\r\n")
+	sb.WriteString("Host: " + host + "\r\n")
+	sb.WriteString("Upgrade: websocket\r\n")
+	sb.WriteString("Connection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Key: " + encodedKey + "\r\n")
+	sb.WriteString("Sec-WebSocket-Version: 13\r\n")
+	if config.Origin != "" {
+		sb.WriteString("Origin: " + config.Origin + "\r\n")
+	}
+	if len(config.Protocols) > 0 {
+		sb.WriteString("Sec-WebSocket-Protocol: " + strings.Join(config.Protocols, ", ") + "\r\n")
+	}
+	for _, h := range config.Header {
+		sb.WriteString(h + "\r\n")
+	}
+	sb.WriteString("\r\n")
+	if _, err := io.WriteString(conn, sb.String()); err != nil {
+		return nil, err
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	c.deadline = time.Now().Add(timeout)
+	defer func() { c.deadline = time.Time{} }()
+
+	status, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	// HTTP/1.1 101 Switching Protocols
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") || fields[1] != "101" {
+		return nil, ErrBadHandshake
+	}
+
+	h := sha1.New()
+	io.WriteString(h, encodedKey+acceptGUID)
+	expected := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	var upgrade, connection, accepted bool
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, ErrBadHandshake
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch name {
+		case "upgrade":
+			upgrade = strings.EqualFold(value, "websocket")
+		case "connection":
+			connection = strings.Contains(strings.ToLower(value), "upgrade")
+		case "sec-websocket-accept":
+			accepted = value == expected
+		case "sec-websocket-protocol":
+			c.Subprotocol = value
+		}
+	}
+	if !upgrade || !connection || !accepted {
+		return nil, ErrBadHandshake
+	}
+	return c, nil
+}
+
+// readLine reads a CRLF terminated handshake line. Lines longer than the read
+// buffer are rejected, except that long values of headers the client does not
+// look at are skipped.
+func (c *Conn) readLine() (string, error) {
+	var line []byte
+	truncated := false
+	for {
+		b, err := c.readByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			break
+		}
+		if len(line) < maxLineLength {
+			line = append(line, b)
+		} else {
+			truncated = true
+		}
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if truncated {
+		s := strings.ToLower(string(line))
+		if strings.HasPrefix(s, "sec-websocket") || strings.HasPrefix(s, "http/") {
+			return "", ErrHeaderTooLong
+		}
+	}
+	return string(line), nil
+}
+
+// maxLineLength is the longest handshake line that is kept.
+const maxLineLength = 256
+
+// CloseError is returned when the server closed the connection.
+type CloseError struct {
+	Code   CloseCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	s := "websocket: closed with code " + strconv.Itoa(int(e.Code))
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+// CloseCode is the status code sent in a close frame.
+type CloseCode uint16
+
+const (
+	CloseNormal             CloseCode = 1000
+	CloseGoingAway          CloseCode = 1001
+	CloseProtocolError      CloseCode = 1002
+	CloseUnsupportedData    CloseCode = 1003
+	CloseNoStatus           CloseCode = 1005
+	CloseAbnormal           CloseCode = 1006
+	CloseInvalidPayload     CloseCode = 1007
+	ClosePolicyViolation    CloseCode = 1008
+	CloseMessageTooBig      CloseCode = 1009
+	CloseMandatoryExtension CloseCode = 1010
+	CloseInternalError      CloseCode = 1011
+)
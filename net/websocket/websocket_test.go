@@ -0,0 +1,483 @@
+// +build !baremetal
+
+package websocket_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	stdnet "net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/net"
+	"tinygo.org/x/drivers/net/hostnet"
+	"tinygo.org/x/drivers/net/websocket"
+)
+
+// server is the far end of a connection: a WebSocket server on the loopback
+// interface that the tests script frame by frame.
+type server struct {
+	t    *testing.T
+	conn stdnet.Conn
+	r    *bufio.Reader
+	req  *http.Request
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value for a handshake key.
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// upgrade returns the response of a server that accepts the handshake, with
+// extra header lines.
+func upgrade(req *http.Request, header ...string) string {
+	s := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(req.Header.Get("Sec-WebSocket-Key")) + "\r\n"
+	for _, h := range header {
+		s += h + "\r\n"
+	}
+	return s + "\r\n"
+}
+
+// dial connects a client through the hostnet driver to a server on the
+// loopback interface, which answers the opening handshake with response.
+func dial(t *testing.T, config *websocket.Config, response func(req *http.Request) string) (*websocket.Conn, *server, error) {
+	t.Helper()
+	ln, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	d := hostnet.New()
+	net.ActiveDevice = d
+	t.Cleanup(func() {
+		d.DisconnectSocket()
+		net.ActiveDevice = nil
+	})
+
+	accepted := make(chan *server, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		s := &server{t: t, conn: conn, r: bufio.NewReader(conn)}
+		if s.req, err = http.ReadRequest(s.r); err == nil {
+			io.WriteString(conn, response(s.req))
+		}
+		accepted <- s
+	}()
+	c, err := websocket.Dial("ws://"+ln.Addr().String()+"/chat", config)
+	s := <-accepted
+	if s == nil {
+		t.Fatal("the client did not connect")
+	}
+	t.Cleanup(func() { s.conn.Close() })
+	return c, s, err
+}
+
+// open is dial with a server that accepts the handshake.
+func open(t *testing.T) (*websocket.Conn, *server) {
+	t.Helper()
+	c, s, err := dial(t, nil, func(req *http.Request) string { return upgrade(req) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+// frame returns an unmasked frame, as sent by a server.
+func frame(op websocket.MessageType, fin bool, payload []byte) []byte {
+	b := []byte{byte(op)}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, byte(n))
+	case n < 1<<16:
+		b = append(b, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		b = append(append(b, 127), ext[:]...)
+	}
+	return append(b, payload...)
+}
+
+// closeFrame returns a close frame with a code and reason.
+func closeFrame(code websocket.CloseCode, reason string) []byte {
+	return frame(websocket.CloseMessage, true, append([]byte{byte(code >> 8), byte(code)}, reason...))
+}
+
+func (s *server) send(frames ...[]byte) {
+	s.t.Helper()
+	if _, err := s.conn.Write(bytes.Join(frames, nil)); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// read returns the next frame from the client, unmasked, and its masking
+// key.
+func (s *server) read() (op websocket.MessageType, fin bool, payload []byte, mask [4]byte) {
+	s.t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		s.t.Fatal(err)
+	}
+	if hdr[1]&0x80 == 0 {
+		s.t.Fatal("frame from the client is not masked")
+	}
+	n := uint64(hdr[1] & 0x7f)
+	var ext []byte
+	switch n {
+	case 126:
+		ext = make([]byte, 2)
+	case 127:
+		ext = make([]byte, 8)
+	}
+	if ext != nil {
+		if _, err := io.ReadFull(s.r, ext); err != nil {
+			s.t.Fatal(err)
+		}
+		n = 0
+		for _, b := range ext {
+			n = n<<8 | uint64(b)
+		}
+	}
+	if _, err := io.ReadFull(s.r, mask[:]); err != nil {
+		s.t.Fatal(err)
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(s.r, payload); err != nil {
+		s.t.Fatal(err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+	return websocket.MessageType(hdr[0] & 0x0f), hdr[0]&0x80 != 0, payload, mask
+}
+
+// expect reads the next frame from the client and checks it.
+func (s *server) expect(op websocket.MessageType, fin bool, payload []byte) {
+	s.t.Helper()
+	gotOp, gotFin, got, _ := s.read()
+	if gotOp != op || gotFin != fin || !bytes.Equal(got, payload) {
+		s.t.Errorf("got frame %d, fin %v, %q, want %d, fin %v, %q", gotOp, gotFin, trim(got), op, fin, trim(payload))
+	}
+}
+
+// trim shortens long payloads in messages.
+func trim(b []byte) []byte {
+	if len(b) > 20 {
+		return b[:20]
+	}
+	return b
+}
+
+// payload returns n bytes of text.
+func payload(n int) []byte {
+	return bytes.Repeat([]byte("0123456789"), n/10+1)[:n]
+}
+
+func TestHandshake(t *testing.T) {
+	// the example of RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("acceptKey: got %s", got)
+	}
+
+	config := &websocket.Config{
+		Origin:    "http://example.com",
+		Protocols: []string{"chat", "superchat"},
+		Header:    []string{"Authorization: Bearer xyz"},
+	}
+	c, s, err := dial(t, config, func(req *http.Request) string {
+		return upgrade(req, "Sec-WebSocket-Protocol: chat")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := s.req
+	key, _ := base64.StdEncoding.DecodeString(req.Header.Get("Sec-WebSocket-Key"))
+	for _, tc := range []struct{ name, got, want string }{
+		{"method", req.Method, "GET"},
+		{"path", req.URL.Path, "/chat"},
+		{"host", req.Host, s.conn.LocalAddr().String()},
+		{"upgrade", req.Header.Get("Upgrade"), "websocket"},
+		{"connection", req.Header.Get("Connection"), "Upgrade"},
+		{"version", req.Header.Get("Sec-WebSocket-Version"), "13"},
+		{"origin", req.Header.Get("Origin"), "http://example.com"},
+		{"protocols", req.Header.Get("Sec-WebSocket-Protocol"), "chat, superchat"},
+		{"authorization", req.Header.Get("Authorization"), "Bearer xyz"},
+		{"subprotocol", c.Subprotocol, "chat"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+	if len(key) != 16 {
+		t.Errorf("got a key of %d bytes, want 16", len(key))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		timeout  time.Duration
+		response func(req *http.Request) string
+		err      error
+	}{
+		{"wrong accept", 0, func(req *http.Request) string {
+			return strings.Replace(upgrade(req), acceptKey(req.Header.Get("Sec-WebSocket-Key")), acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), 1)
+		}, websocket.ErrBadHandshake},
+		{"status", 0, func(req *http.Request) string {
+			return "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+		}, websocket.ErrBadHandshake},
+		{"no upgrade", 0, func(req *http.Request) string {
+			return strings.Replace(upgrade(req), "Upgrade: websocket\r\n", "", 1)
+		}, websocket.ErrBadHandshake},
+		{"long header", 0, func(req *http.Request) string {
+			return upgrade(req, "Sec-WebSocket-Extensions: "+strings.Repeat("x", 300))
+		}, websocket.ErrHeaderTooLong},
+		{"timeout", 50 * time.Millisecond, func(req *http.Request) string {
+			return ""
+		}, websocket.ErrTimeout},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := dial(t, &websocket.Config{Timeout: tc.timeout}, tc.response)
+			if err != tc.err {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	c, s := open(t)
+	var masks [][4]byte
+	read := func(op websocket.MessageType, fin bool, want []byte) {
+		t.Helper()
+		gotOp, gotFin, got, mask := s.read()
+		if gotOp != op || gotFin != fin || !bytes.Equal(got, want) {
+			t.Errorf("got frame %d, fin %v, %q, want %d, fin %v, %q", gotOp, gotFin, trim(got), op, fin, trim(want))
+		}
+		masks = append(masks, mask)
+	}
+
+	// the payload is masked in chunks of the write buffer, and the length
+	// takes 7, 16 and 64 bits
+	for _, n := range []int{5, 300, 70000} {
+		if err := c.WriteMessage(websocket.TextMessage, payload(n)); err != nil {
+			t.Fatal(err)
+		}
+		read(websocket.TextMessage, true, payload(n))
+	}
+
+	c.MaxFrameSize = 4
+	if err := c.WriteMessage(websocket.BinaryMessage, []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	read(websocket.BinaryMessage, false, []byte("0123"))
+	read(0, false, []byte("4567"))
+	read(0, true, []byte("89"))
+
+	w := c.NextWriter(websocket.TextMessage)
+	io.WriteString(w, "ab")
+	io.WriteString(w, "cd")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "ef"); err != websocket.ErrClosed {
+		t.Errorf("Write after Close: got %v, want %v", err, websocket.ErrClosed)
+	}
+	read(websocket.TextMessage, false, []byte("ab"))
+	read(0, false, []byte("cd"))
+	read(0, true, nil)
+
+	for i := 1; i < len(masks); i++ {
+		if masks[i] == masks[i-1] {
+			t.Errorf("frames %d and %d have the same masking key %x", i-1, i, masks[i])
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	c, s := open(t)
+	var pongs []string
+	c.PongHandler = func(data []byte) { pongs = append(pongs, string(data)) }
+
+	// control frames between the fragments of a message
+	s.send(
+		frame(websocket.TextMessage, false, []byte("Hel")),
+		frame(websocket.PingMessage, true, []byte("p")),
+		frame(0, false, []byte("l")),
+		frame(websocket.PongMessage, true, []byte("q")),
+		frame(0, false, nil),
+		frame(0, true, []byte("o")),
+		frame(websocket.BinaryMessage, true, payload(300)),
+		frame(websocket.BinaryMessage, true, payload(70000)),
+	)
+	buf := make([]byte, 80000)
+	typ, n, err := c.ReadMessage(buf)
+	if err != nil || typ != websocket.TextMessage || string(buf[:n]) != "Hello" {
+		t.Errorf("got %d, %q, %v, want a text message %q", typ, buf[:n], err, "Hello")
+	}
+	s.expect(websocket.PongMessage, true, []byte("p"))
+	if len(pongs) != 1 || pongs[0] != "q" {
+		t.Errorf("got pongs %q, want %q", pongs, "q")
+	}
+	for _, size := range []int{300, 70000} {
+		typ, n, err = c.ReadMessage(buf)
+		if err != nil || typ != websocket.BinaryMessage || !bytes.Equal(buf[:n], payload(size)) {
+			t.Errorf("got %d, %d bytes, %v, want a binary message of %d bytes", typ, n, err, size)
+		}
+	}
+
+	// the rest of a message too large for the buffer is discarded
+	s.send(
+		frame(websocket.BinaryMessage, false, payload(6)),
+		frame(0, true, payload(4)),
+		frame(websocket.TextMessage, true, []byte("next")),
+	)
+	typ, n, err = c.ReadMessage(buf[:4])
+	if err != websocket.ErrMessageTooBig || !bytes.Equal(buf[:n], payload(4)) {
+		t.Errorf("got %q, %v, want %q, %v", buf[:n], err, payload(4), websocket.ErrMessageTooBig)
+	}
+	typ, n, err = c.ReadMessage(buf)
+	if err != nil || string(buf[:n]) != "next" {
+		t.Errorf("got %q, %v, want %q", buf[:n], err, "next")
+	}
+
+	// a continuation must not start a message
+	s.send(frame(0, true, []byte("x")))
+	if _, _, err := c.ReadMessage(buf); err != websocket.ErrProtocol {
+		t.Errorf("got %v, want %v", err, websocket.ErrProtocol)
+	}
+	s.expect(websocket.CloseMessage, true, []byte{0x03, 0xea})
+}
+
+func TestPing(t *testing.T) {
+	c, s := open(t)
+	var pongs []string
+	c.PongHandler = func(data []byte) { pongs = append(pongs, string(data)) }
+	if err := c.Ping([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(websocket.PingMessage, true, []byte("hi"))
+	if err := c.Ping(payload(126)); err != websocket.ErrControlTooLong {
+		t.Errorf("got %v, want %v", err, websocket.ErrControlTooLong)
+	}
+
+	s.send(
+		frame(websocket.PongMessage, true, []byte("hi")),
+		frame(websocket.PingMessage, true, payload(125)),
+		frame(websocket.TextMessage, true, []byte("x")),
+	)
+	var buf [8]byte
+	if _, n, err := c.ReadMessage(buf[:]); err != nil || string(buf[:n]) != "x" {
+		t.Errorf("got %q, %v", buf[:n], err)
+	}
+	if len(pongs) != 1 || pongs[0] != "hi" {
+		t.Errorf("got pongs %q, want %q", pongs, "hi")
+	}
+	s.expect(websocket.PongMessage, true, payload(125))
+}
+
+func TestClose(t *testing.T) {
+	t.Run("client", func(t *testing.T) {
+		c, s := open(t)
+		s.send(
+			frame(websocket.TextMessage, true, []byte("late")),
+			closeFrame(websocket.CloseNormal, ""),
+		)
+		if err := c.Close(websocket.CloseNormal, "bye"); err != nil {
+			t.Fatal(err)
+		}
+		s.expect(websocket.CloseMessage, true, []byte("\x03\xe8bye"))
+		if err := c.WriteText("after"); err == nil {
+			t.Error("WriteText after Close succeeded")
+		}
+	})
+
+	var buf [16]byte
+	for _, tc := range []struct {
+		name    string
+		payload []byte
+		err     error
+		echo    []byte
+	}{
+		{"normal", []byte("\x03\xe9restart"), &websocket.CloseError{Code: websocket.CloseGoingAway, Reason: "restart"}, []byte{0x03, 0xe9}},
+		{"no status", nil, &websocket.CloseError{Code: websocket.CloseNoStatus}, nil},
+		{"1012", []byte{0x03, 0xf4}, &websocket.CloseError{Code: 1012}, []byte{0x03, 0xf4}},
+		{"3000", []byte{0x0b, 0xb8}, &websocket.CloseError{Code: 3000}, []byte{0x0b, 0xb8}},
+		{"4999", []byte{0x13, 0x87}, &websocket.CloseError{Code: 4999}, []byte{0x13, 0x87}},
+		{"short", []byte{0x03}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"invalid utf-8", []byte{0x03, 0xe8, 0xff}, websocket.ErrInvalidUTF8, []byte{0x03, 0xef}},
+		{"999", []byte{0x03, 0xe7}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"1004", []byte{0x03, 0xec}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"1005", []byte{0x03, 0xed}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"1006", []byte{0x03, 0xee}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"1015", []byte{0x03, 0xf7}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"2999", []byte{0x0b, 0xb7}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+		{"5000", []byte{0x13, 0x88}, websocket.ErrProtocol, []byte{0x03, 0xea}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, s := open(t)
+			s.send(frame(websocket.CloseMessage, true, tc.payload))
+			for i := 0; i < 2; i++ {
+				// the error is kept once the connection is closed
+				_, _, err := c.ReadMessage(buf[:])
+				if !sameError(err, tc.err) {
+					t.Errorf("got %v, want %v", err, tc.err)
+				}
+			}
+			s.expect(websocket.CloseMessage, true, tc.echo)
+		})
+	}
+}
+
+// sameError compares errors, and close errors by value.
+func sameError(err, want error) bool {
+	var ce, wantCE *websocket.CloseError
+	if errors.As(want, &wantCE) {
+		return errors.As(err, &ce) && *ce == *wantCE
+	}
+	return err == want
+}
+
+// TestReadTimeout checks that reads that time out before a frame header or a
+// control frame has fully arrived can be retried.
+func TestReadTimeout(t *testing.T) {
+	c, s := open(t)
+	c.ReadTimeout = 20 * time.Millisecond
+	data := append(frame(websocket.PingMessage, true, []byte("abc")), frame(websocket.TextMessage, true, payload(300))...)
+	var buf [512]byte
+	// the ping, and all but the last byte of the header of the message
+	for i := 0; i < 8; i++ {
+		s.send(data[i : i+1])
+		if _, _, err := c.ReadMessage(buf[:]); err != websocket.ErrTimeout {
+			t.Fatalf("after %d bytes: got %v, want %v", i+1, err, websocket.ErrTimeout)
+		}
+	}
+	c.ReadTimeout = time.Second
+	s.send(data[8:])
+	typ, n, err := c.ReadMessage(buf[:])
+	if err != nil || typ != websocket.TextMessage || !bytes.Equal(buf[:n], payload(300)) {
+		t.Errorf("got %d, %q, %v, want a text message of 300 bytes", typ, trim(buf[:n]), err)
+	}
+	s.expect(websocket.PongMessage, true, []byte("abc"))
+	if err := c.WriteText("done"); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(websocket.TextMessage, true, []byte("done"))
+}
@@ -0,0 +1,46 @@
+package scheduler
+
+import "time"
+
+// Clock tells the time and waits. The scheduler takes all its time from a
+// Clock, so that a ManualClock can run it in tests without waiting.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is the clock of the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// ManualClock is a clock that only moves when told to, for tests. Sleep
+// moves it forward instead of waiting.
+type ManualClock struct {
+	t time.Time
+}
+
+// NewManualClock returns a manual clock set to t.
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{t: t}
+}
+
+// Now returns the time of the clock.
+func (c *ManualClock) Now() time.Time {
+	return c.t
+}
+
+// Sleep moves the clock forward by d.
+func (c *ManualClock) Sleep(d time.Duration) {
+	if d > 0 {
+		c.t = c.t.Add(d)
+	}
+}
+
+// Set sets the clock to t, which may be in the past.
+func (c *ManualClock) Set(t time.Time) {
+	c.t = t
+}
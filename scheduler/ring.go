@@ -0,0 +1,127 @@
+package scheduler
+
+import "time"
+
+// Sample is a sensor reading and the time it was taken. Values are in the
+// units of the driver, usually thousandths such as millicelsius.
+type Sample struct {
+	Time  time.Time
+	Value int32
+}
+
+// Ring keeps the last samples of a value in a buffer of fixed size, the
+// oldest being overwritten when it is full. It is not safe for concurrent
+// use.
+type Ring struct {
+	samples []Sample
+	head    int // index of the oldest sample
+	count   int
+}
+
+// NewRing returns a ring of capacity samples.
+func NewRing(capacity int) *Ring {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring{samples: make([]Sample, capacity)}
+}
+
+// Add appends a sample, dropping the oldest one if the ring is full.
+func (r *Ring) Add(s Sample) {
+	i := r.head + r.count
+	if i >= len(r.samples) {
+		i -= len(r.samples)
+	}
+	r.samples[i] = s
+	if r.count < len(r.samples) {
+		r.count++
+	} else {
+		r.head++
+		if r.head == len(r.samples) {
+			r.head = 0
+		}
+	}
+}
+
+// Len returns the number of samples in the ring.
+func (r *Ring) Len() int {
+	return r.count
+}
+
+// Cap returns the capacity of the ring.
+func (r *Ring) Cap() int {
+	return len(r.samples)
+}
+
+// At returns the i-th sample, from 0 for the oldest to Len()-1.
+func (r *Ring) At(i int) Sample {
+	if i < 0 || i >= r.count {
+		return Sample{}
+	}
+	i += r.head
+	if i >= len(r.samples) {
+		i -= len(r.samples)
+	}
+	return r.samples[i]
+}
+
+// Last returns the newest sample, and false if the ring is empty.
+func (r *Ring) Last() (Sample, bool) {
+	if r.count == 0 {
+		return Sample{}, false
+	}
+	return r.At(r.count - 1), true
+}
+
+// Samples appends the samples to dst, oldest first, and returns the extended
+// slice.
+func (r *Ring) Samples(dst []Sample) []Sample {
+	for i := 0; i < r.count; i++ {
+		dst = append(dst, r.At(i))
+	}
+	return dst
+}
+
+// Reset empties the ring.
+func (r *Ring) Reset() {
+	r.head, r.count = 0, 0
+}
+
+// Stats summarizes samples.
+type Stats struct {
+	Count int
+	Min   int32
+	Max   int32
+	Mean  float32
+	Last  int32
+}
+
+// Stats returns the statistics of the samples in the ring.
+func (r *Ring) Stats() Stats {
+	return r.StatsSince(time.Time{})
+}
+
+// StatsSince returns the statistics of the samples taken at or after t.
+func (r *Ring) StatsSince(t time.Time) Stats {
+	var st Stats
+	var sum int64
+	for i := 0; i < r.count; i++ {
+		s := r.At(i)
+		if s.Time.Before(t) {
+			continue
+		}
+		if st.Count == 0 || s.Value < st.Min {
+			st.Min = s.Value
+		}
+		if st.Count == 0 || s.Value > st.Max {
+			st.Max = s.Value
+		}
+		sum += int64(s.Value)
+		st.Last = s.Value
+		st.Count++
+	}
+	if st.Count > 0 {
+		st.Mean = float32(float64(sum) / float64(st.Count))
+	}
+	return st
+}
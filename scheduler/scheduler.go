@@ -0,0 +1,217 @@
+// Package scheduler samples sensors at their own rates and keeps the
+// readings in ring buffers with their statistics.
+//
+// Tasks are scheduled on a fixed grid from the time they are added, so that
+// they do not drift however long the readings take:
+//
+//	s := scheduler.New(scheduler.SystemClock)
+//	climate := s.Add("bme280", time.Second, 60, 2, func(v []int32) (err error) {
+//		v[0], err = bme.ReadTemperature()
+//		if err == nil {
+//			v[1], err = bme.ReadHumidity()
+//		}
+//		return err
+//	})
+//	accel := s.Add("lis3dh", 10*time.Millisecond, 100, 3, scheduler.Read3(acc.ReadAcceleration))
+//	for {
+//		next := s.RunPending()
+//		stats := climate.Channels[0].Stats()
+//		println("temperature:", stats.Min, stats.Mean, stats.Max)
+//		time.Sleep(time.Until(next))
+//	}
+//
+// A scheduler, its tasks and their rings are not safe for concurrent use.
+// Read the samples and statistics in the goroutine that runs the tasks,
+// between calls of RunPending or from OnSample, rather than while Run runs
+// in another goroutine.
+package scheduler // import "tinygo.org/x/drivers/scheduler"
+
+import (
+	"context"
+	"time"
+)
+
+// Task samples a sensor periodically.
+type Task struct {
+	Name   string
+	Period time.Duration
+
+	// Read reads the sensor into values, one per channel, for example x, y
+	// and z of an accelerometer.
+	Read func(values []int32) error
+
+	// Channels are the buffers of the values, one per channel.
+	Channels []*Ring
+
+	// OnSample, if set, is called after every successful reading with its
+	// time and values, for example to log them.
+	OnSample func(t time.Time, values []int32)
+
+	// Samples counts the successful readings, Errors the failed ones, and
+	// Overruns the periods skipped because the scheduler was too late.
+	Samples  uint32
+	Errors   uint32
+	Overruns uint32
+
+	// LastError is the error of the last failed reading.
+	LastError error
+
+	next    time.Time
+	values  []int32
+	paused  bool
+	resumed bool
+}
+
+// Pause stops sampling until Resume.
+func (t *Task) Pause() {
+	t.paused = true
+}
+
+// Resume restarts sampling after Pause, at the next period on the grid.
+func (t *Task) Resume() {
+	if t.paused {
+		t.paused, t.resumed = false, true
+	}
+}
+
+// Scheduler runs sampling tasks.
+type Scheduler struct {
+	clock Clock
+	tasks []*Task
+}
+
+// New returns a scheduler that takes the time from clock.
+func New(clock Clock) *Scheduler {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Scheduler{clock: clock}
+}
+
+// Add adds a task that calls read every period, with channels values of
+// which the last capacity samples are kept. The first reading is due at
+// once.
+func (s *Scheduler) Add(name string, period time.Duration, capacity, channels int, read func(values []int32) error) *Task {
+	t := &Task{
+		Name:     name,
+		Period:   period,
+		Read:     read,
+		Channels: make([]*Ring, channels),
+		next:     s.clock.Now(),
+		values:   make([]int32, channels),
+	}
+	for i := range t.Channels {
+		t.Channels[i] = NewRing(capacity)
+	}
+	s.tasks = append(s.tasks, t)
+	return t
+}
+
+// Tasks returns the tasks of the scheduler.
+func (s *Scheduler) Tasks() []*Task {
+	return s.tasks
+}
+
+// Task returns the task called name, or nil.
+func (s *Scheduler) Task(name string) *Task {
+	for _, t := range s.tasks {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// RunPending runs the tasks that are due, earliest first, and returns when
+// the next one is due. It does not wait, so it fits in the main loop of a
+// program that does other work. Tasks that fall due while it runs are left
+// to the next call, so it returns even if the readings take all the time.
+func (s *Scheduler) RunPending() time.Time {
+	start := s.clock.Now()
+	for {
+		t := s.earliest()
+		if t == nil {
+			return s.clock.Now().Add(time.Second)
+		}
+		now := s.clock.Now()
+		if t.resumed {
+			t.resumed = false
+			if late := now.Sub(t.next); late > 0 {
+				t.next = t.next.Add((late + t.Period - 1) / t.Period * t.Period)
+			}
+			continue
+		}
+		if t.next.After(start) {
+			return t.next
+		}
+		s.run(t, now)
+	}
+}
+
+// earliest returns the active task due first.
+func (s *Scheduler) earliest() *Task {
+	var first *Task
+	for _, t := range s.tasks {
+		if t.paused || t.Period <= 0 {
+			continue
+		}
+		if first == nil || t.next.Before(first.next) {
+			first = t
+		}
+	}
+	return first
+}
+
+// run samples t and schedules its next reading on the grid.
+func (s *Scheduler) run(t *Task, now time.Time) {
+	if err := t.Read(t.values); err != nil {
+		t.Errors++
+		t.LastError = err
+	} else {
+		t.Samples++
+		for i, ring := range t.Channels {
+			ring.Add(Sample{Time: now, Value: t.values[i]})
+		}
+		if t.OnSample != nil {
+			t.OnSample(now, t.values)
+		}
+	}
+	t.next = t.next.Add(t.Period)
+	if late := s.clock.Now().Sub(t.next); late > 0 {
+		// skip the periods missed, rather than catching up with a burst; a
+		// reading that ends on the grid misses nothing after it
+		missed := (late + t.Period - 1) / t.Period
+		t.Overruns += uint32(missed)
+		t.next = t.next.Add(missed * t.Period)
+	}
+}
+
+// Run runs the tasks until ctx is done, sleeping in between. The tasks may
+// only be used from OnSample while it runs.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		next := s.RunPending()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.clock.Sleep(next.Sub(s.clock.Now()))
+	}
+}
+
+// Read1 adapts a driver method that returns a value, such as
+// bme280.Device.ReadTemperature, to Task.Read.
+func Read1(read func() (int32, error)) func([]int32) error {
+	return func(v []int32) (err error) {
+		v[0], err = read()
+		return err
+	}
+}
+
+// Read3 adapts a driver method that returns three values, such as
+// lis3dh.Device.ReadAcceleration, to Task.Read.
+func Read3(read func() (int32, int32, int32, error)) func([]int32) error {
+	return func(v []int32) (err error) {
+		v[0], v[1], v[2], err = read()
+		return err
+	}
+}
@@ -0,0 +1,183 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/scheduler"
+)
+
+var start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// run runs s until the clock reaches end.
+func run(s *scheduler.Scheduler, clock *scheduler.ManualClock, end time.Time) {
+	for clock.Now().Before(end) {
+		next := s.RunPending()
+		clock.Sleep(next.Sub(clock.Now()))
+	}
+}
+
+// offsets returns the times of the samples of ring since start.
+func offsets(ring *scheduler.Ring) []time.Duration {
+	var d []time.Duration
+	for _, s := range ring.Samples(nil) {
+		d = append(d, s.Time.Sub(start))
+	}
+	return d
+}
+
+func equal(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestGrid checks that readings that take time do not delay the next ones.
+func TestGrid(t *testing.T) {
+	clock := scheduler.NewManualClock(start)
+	s := scheduler.New(clock)
+	var n int32
+	fast := s.Add("fast", 100*time.Millisecond, 10, 1, func(v []int32) error {
+		clock.Sleep(30 * time.Millisecond)
+		n++
+		v[0] = n
+		return nil
+	})
+	slow := s.Add("slow", 250*time.Millisecond, 10, 1, func(v []int32) error {
+		clock.Sleep(40 * time.Millisecond)
+		v[0] = -1
+		return nil
+	})
+	run(s, clock, start.Add(time.Second))
+
+	// the slow task is sampled late when the fast one is due at the same
+	// time, but both keep to their grids
+	want := []time.Duration{0, 100, 200, 300, 400, 500, 600, 700, 800, 900}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if got := offsets(fast.Channels[0]); !equal(got, want) {
+		t.Errorf("fast: got %v, want %v", got, want)
+	}
+	want = []time.Duration{30, 250, 530, 750}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if got := offsets(slow.Channels[0]); !equal(got, want) {
+		t.Errorf("slow: got %v, want %v", got, want)
+	}
+	if fast.Samples != 10 || fast.Overruns != 0 || slow.Samples != 4 || slow.Overruns != 0 {
+		t.Errorf("got %d and %d samples, %d and %d overruns", fast.Samples, slow.Samples, fast.Overruns, slow.Overruns)
+	}
+	if st := fast.Channels[0].Stats(); st.Count != 10 || st.Min != 1 || st.Max != 10 || st.Mean != 5.5 || st.Last != 10 {
+		t.Errorf("got stats %+v", st)
+	}
+}
+
+// TestOverrun checks that a task that takes longer than its period skips
+// the periods missed.
+func TestOverrun(t *testing.T) {
+	clock := scheduler.NewManualClock(start)
+	s := scheduler.New(clock)
+	fail := false
+	task := s.Add("slow", 100*time.Millisecond, 10, 1, func(v []int32) error {
+		clock.Sleep(250 * time.Millisecond)
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	run(s, clock, start.Add(time.Second))
+	want := []time.Duration{0, 300 * time.Millisecond, 600 * time.Millisecond, 900 * time.Millisecond}
+	if got := offsets(task.Channels[0]); !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if task.Samples != 4 || task.Overruns != 8 {
+		t.Errorf("got %d samples, %d overruns", task.Samples, task.Overruns)
+	}
+
+	fail = true
+	run(s, clock, start.Add(1600*time.Millisecond))
+	if task.Samples != 4 || task.Errors != 2 || task.LastError == nil {
+		t.Errorf("got %d samples, %d errors, %v", task.Samples, task.Errors, task.LastError)
+	}
+}
+
+// TestOverrunOnGrid checks that a reading that ends exactly when the next is
+// due is not an overrun, and doesn't delay the next one.
+func TestOverrunOnGrid(t *testing.T) {
+	for _, tc := range []struct {
+		reading  time.Duration
+		want     []time.Duration
+		overruns uint32
+	}{
+		{100, []time.Duration{0, 100, 200, 300, 400, 500, 600, 700, 800, 900}, 0},
+		{300, []time.Duration{0, 300, 600, 900}, 8},
+	} {
+		clock := scheduler.NewManualClock(start)
+		s := scheduler.New(clock)
+		task := s.Add("task", 100*time.Millisecond, 10, 1, func(v []int32) error {
+			clock.Sleep(tc.reading * time.Millisecond)
+			return nil
+		})
+		run(s, clock, start.Add(time.Second))
+		for i := range tc.want {
+			tc.want[i] *= time.Millisecond
+		}
+		if got := offsets(task.Channels[0]); !equal(got, tc.want) {
+			t.Errorf("reading of %d ms: got %v, want %v", tc.reading, got, tc.want)
+		}
+		if task.Overruns != tc.overruns {
+			t.Errorf("reading of %d ms: got %d overruns, want %d", tc.reading, task.Overruns, tc.overruns)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	clock := scheduler.NewManualClock(start)
+	s := scheduler.New(clock)
+	task := s.Add("task", time.Second, 10, 1, func(v []int32) error { return nil })
+	run(s, clock, start.Add(1500*time.Millisecond))
+	task.Pause()
+	run(s, clock, start.Add(4500*time.Millisecond))
+	task.Resume()
+	run(s, clock, start.Add(7*time.Second))
+
+	// resumed at the next period on the grid, without overruns
+	want := []time.Duration{0, time.Second, 5 * time.Second, 6 * time.Second}
+	if got := offsets(task.Channels[0]); !equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if task.Overruns != 0 {
+		t.Errorf("got %d overruns", task.Overruns)
+	}
+	if s.Task("task") != task || s.Task("other") != nil {
+		t.Error("Task did not find the task")
+	}
+}
+
+func TestRun(t *testing.T) {
+	clock := scheduler.NewManualClock(start)
+	s := scheduler.New(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	task := s.Add("task", 10*time.Millisecond, 10, 1, func(v []int32) error { return nil })
+	task.OnSample = func(now time.Time, v []int32) {
+		if now.Sub(start) >= 50*time.Millisecond {
+			cancel()
+		}
+	}
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if task.Samples != 6 {
+		t.Errorf("got %d samples, want 6", task.Samples)
+	}
+}
@@ -1,5 +1,7 @@
 package semihosting
 
+import "io"
+
 // These three file descriptors are connected to the host stdin/stdout/stderr,
 // and can be used for logging.
 var (
@@ -18,3 +20,22 @@ type File struct {
 func (f *File) Write(buf []byte) error {
 	return Write(f.fd, buf)
 }
+
+// Writer returns the file as an io.Writer, for packages that write to one.
+func (f *File) Writer() io.Writer {
+	return fileWriter{f}
+}
+
+type fileWriter struct {
+	f *File
+}
+
+func (w fileWriter) Write(buf []byte) (int, error) {
+	if err := w.f.Write(buf); err != nil {
+		if e, ok := err.(*IOError); ok {
+			return e.BytesWritten, err
+		}
+		return 0, err
+	}
+	return len(buf), nil
+}
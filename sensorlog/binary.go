@@ -0,0 +1,275 @@
+package sensorlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+const (
+	recordSync   = 0xA5
+	recordHeader = 'H'
+	recordTime   = 'T'
+	recordData   = 'D'
+
+	binaryVersion = 1
+
+	// timeInterval is the number of data records between time records.
+	timeInterval = 64
+
+	maxPayload = 4096
+)
+
+var errBadRecord = errors.New("sensorlog: bad record")
+
+// appendBinary appends the records of values at t. It also returns the
+// number of data records since the last time record and the time of the
+// record, which the logger keeps once the records are written.
+func (l *Logger) appendBinary(b []byte, t time.Time, values []int32) (_ []byte, count int, last int64, err error) {
+	if !l.started {
+		if len(l.fields) > 255 {
+			return b, 0, 0, ErrTooManyFields
+		}
+		start := len(b)
+		b = append(b, recordSync, recordHeader, 0, 0, binaryVersion, byte(len(l.fields)))
+		for _, f := range l.fields {
+			b = append(b, f.Decimals)
+			b = appendString(b, f.Name)
+			b = appendString(b, f.Unit)
+		}
+		if len(b)-start-4 > maxPayload {
+			return b, 0, 0, ErrTooManyFields
+		}
+		b = finishRecord(b, start)
+	}
+
+	us := t.UnixNano() / 1000
+	count, delta := l.count, us-l.last
+	if !l.started || count == timeInterval || delta < 0 {
+		start := len(b)
+		b = append(b, recordSync, recordTime, 0, 0)
+		b = appendUint64(b, uint64(us))
+		b = finishRecord(b, start)
+		count, delta = 0, 0
+	}
+
+	var tmp [binary.MaxVarintLen64]byte
+	start := len(b)
+	b = append(b, recordSync, recordData, 0, 0)
+	b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(delta))]...)
+	for _, v := range values {
+		b = append(b, tmp[:binary.PutVarint(tmp[:], int64(v))]...)
+	}
+	return finishRecord(b, start), count + 1, us, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b = append(b, byte(len(s)))
+	return append(b, s...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+// finishRecord fills in the length and appends the CRC of the record that
+// starts at b[start].
+func finishRecord(b []byte, start int) []byte {
+	binary.LittleEndian.PutUint16(b[start+2:], uint16(len(b)-start-4))
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(b[start+1:]))
+	return append(b, crc[:]...)
+}
+
+// Record is a record decoded from a binary log.
+type Record struct {
+	Time   time.Time
+	Values []int32
+
+	// Fields are the fields of the log the record belongs to.
+	Fields []Field
+}
+
+// Decoder reads the records of a binary log.
+type Decoder struct {
+	r   io.Reader
+	buf []byte
+	pos int
+	eof bool
+
+	fields    []Field
+	values    []int32
+	last      int64 // time of the last record in microseconds
+	timeKnown bool
+
+	// Skipped counts the bytes of corrupted records skipped, and of data
+	// records skipped for lack of a header or time record.
+	Skipped int
+}
+
+// NewDecoder returns a decoder of the binary log read from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Next returns the next data record, or io.EOF at the end of the log. The
+// values of the record are only valid until the next call.
+func (d *Decoder) Next() (Record, error) {
+	for {
+		typ, payload, err := d.record()
+		if err != nil {
+			return Record{}, err
+		}
+		switch typ {
+		case recordHeader:
+			fields, err := parseHeader(payload)
+			if err != nil {
+				d.Skipped += len(payload)
+				d.fields = nil
+				continue
+			}
+			d.fields = fields
+		case recordTime:
+			if len(payload) != 8 {
+				d.Skipped += len(payload)
+				continue
+			}
+			d.last = int64(binary.LittleEndian.Uint64(payload))
+			d.timeKnown = true
+		case recordData:
+			if d.fields == nil || !d.timeKnown {
+				d.Skipped += len(payload)
+				continue
+			}
+			delta, n := binary.Uvarint(payload)
+			if n <= 0 {
+				d.Skipped += len(payload)
+				continue
+			}
+			p := payload[n:]
+			d.values = d.values[:0]
+			for range d.fields {
+				v, n := binary.Varint(p)
+				if n <= 0 {
+					break
+				}
+				d.values = append(d.values, int32(v))
+				p = p[n:]
+			}
+			if len(d.values) != len(d.fields) {
+				d.Skipped += len(payload)
+				continue
+			}
+			d.last += int64(delta)
+			return Record{
+				Time:   time.Unix(0, d.last*1000).UTC(),
+				Values: d.values,
+				Fields: d.fields,
+			}, nil
+		}
+	}
+}
+
+// record returns the next valid record, skipping corrupted ones.
+func (d *Decoder) record() (typ byte, payload []byte, err error) {
+	for {
+		if err := d.fill(4); err != nil {
+			return 0, nil, err
+		}
+		b := d.buf[d.pos:]
+		if b[0] != recordSync {
+			d.skip(1)
+			continue
+		}
+		length := int(binary.LittleEndian.Uint16(b[2:]))
+		if length > maxPayload {
+			d.skip(1)
+			continue
+		}
+		if err := d.fill(4 + length + 4); err == io.EOF {
+			d.skip(1) // truncated, or a false sync byte near the end
+			continue
+		} else if err != nil {
+			return 0, nil, err
+		}
+		b = d.buf[d.pos : d.pos+4+length+4]
+		if crc32.ChecksumIEEE(b[1:4+length]) != binary.LittleEndian.Uint32(b[4+length:]) {
+			d.skip(1)
+			continue
+		}
+		d.pos += len(b)
+		if b[1] != recordHeader && b[1] != recordTime && b[1] != recordData {
+			continue
+		}
+		return b[1], b[4 : 4+length], nil
+	}
+}
+
+// skip drops n bytes of corrupted data. As a data record may be lost, the
+// time is unknown until the next time record.
+func (d *Decoder) skip(n int) {
+	d.pos += n
+	d.Skipped += n
+	d.timeKnown = false
+}
+
+// fill reads until n bytes are buffered, or returns io.EOF.
+func (d *Decoder) fill(n int) error {
+	if d.pos > 0 && d.pos >= len(d.buf)/2 {
+		d.buf = append(d.buf[:0], d.buf[d.pos:]...)
+		d.pos = 0
+	}
+	for len(d.buf)-d.pos < n {
+		if d.eof {
+			return io.EOF
+		}
+		if cap(d.buf) == len(d.buf) {
+			d.buf = append(d.buf, make([]byte, 512)...)[:len(d.buf)]
+		}
+		m, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+m]
+		if err == io.EOF {
+			d.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseHeader(p []byte) ([]Field, error) {
+	if len(p) < 2 || p[0] != binaryVersion {
+		return nil, errBadRecord
+	}
+	fields := make([]Field, p[1])
+	p = p[2:]
+	for i := range fields {
+		if len(p) < 1 {
+			return nil, errBadRecord
+		}
+		fields[i].Decimals = p[0]
+		var ok bool
+		if fields[i].Name, p, ok = parseString(p[1:]); !ok {
+			return nil, errBadRecord
+		}
+		if fields[i].Unit, p, ok = parseString(p); !ok {
+			return nil, errBadRecord
+		}
+	}
+	return fields, nil
+}
+
+func parseString(p []byte) (string, []byte, bool) {
+	if len(p) < 1 || len(p) < 1+int(p[0]) {
+		return "", nil, false
+	}
+	n := int(p[0])
+	return string(p[1 : 1+n]), p[1+n:], true
+}
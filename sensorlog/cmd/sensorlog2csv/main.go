@@ -0,0 +1,93 @@
+// Command sensorlog2csv converts binary logs of package sensorlog to CSV.
+//
+// Usage:
+//
+//	sensorlog2csv [-json] [file...]
+//
+// It reads the files given, or the standard input, and writes the records to
+// the standard output. Every change of fields starts a new CSV header.
+// Corrupted records are skipped and counted on the standard error.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"tinygo.org/x/drivers/sensorlog"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "write newline-delimited JSON instead of CSV")
+	flag.Parse()
+
+	format := sensorlog.CSV
+	if *asJSON {
+		format = sensorlog.JSON
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if flag.NArg() == 0 {
+		if err := convert(os.Stdin, out, format); err != nil {
+			fail("stdin", err)
+		}
+		return
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fail(name, err)
+		}
+		err = convert(f, out, format)
+		f.Close()
+		if err != nil {
+			fail(name, err)
+		}
+	}
+}
+
+func convert(r io.Reader, w io.Writer, format sensorlog.Format) error {
+	dec := sensorlog.NewDecoder(bufio.NewReader(r))
+	var logger *sensorlog.Logger
+	var fields []sensorlog.Field
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if logger == nil || !sameFields(fields, rec.Fields) {
+			fields = rec.Fields
+			logger = sensorlog.New(w, format, fields...)
+		}
+		if err := logger.Log(rec.Time, rec.Values); err != nil {
+			return err
+		}
+	}
+	if dec.Skipped > 0 {
+		fmt.Fprintln(os.Stderr, "skipped", dec.Skipped, "bytes of corrupted records")
+	}
+	return nil
+}
+
+func sameFields(a, b []sensorlog.Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func fail(name string, err error) {
+	fmt.Fprintln(os.Stderr, "sensorlog2csv:", name+":", err)
+	os.Exit(1)
+}
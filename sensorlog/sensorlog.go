@@ -0,0 +1,223 @@
+// Package sensorlog writes sensor readings to any io.Writer, such as a file
+// on flash or semihosting, for later analysis.
+//
+// A log has a fixed list of fields, one value per field and record. Values
+// are integers, as drivers return them, with a number of decimals: a
+// temperature of 23456 with 3 decimals is 23.456 °C.
+//
+// Logs are written in one of three formats: CSV with a header line,
+// newline-delimited JSON, or a compact binary format that Decoder reads back.
+// The cmd/sensorlog2csv command converts binary logs to CSV on the host.
+//
+// # Binary format
+//
+// A binary log is a sequence of records:
+//
+//	sync    byte   // 0xA5
+//	type    byte   // 'H' header, 'T' time or 'D' data
+//	length  uint16 // of the payload
+//	payload [length]byte
+//	crc     uint32 // CRC-32 (IEEE) of type, length and payload
+//
+// Integers are little endian. A header record describes the fields of the
+// data records that follow it:
+//
+//	version byte // 1
+//	count   byte // number of fields
+//	fields  [count]struct {
+//		decimals byte
+//		name     string // length byte, then the bytes
+//		unit     string
+//	}
+//
+// A time record holds the time of the next data record, in microseconds
+// since 1970 as an int64. A data record holds the time since the previous
+// record in microseconds, as a varint, and the values of the fields, as
+// zig-zag varints like encoding/binary.PutVarint writes them. Time records
+// come every 64 data records, so that a decoder can resynchronize after a
+// corrupted record, which it skips.
+package sensorlog // import "tinygo.org/x/drivers/sensorlog"
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrFieldCount    = errors.New("sensorlog: wrong number of values")
+	ErrTooManyFields = errors.New("sensorlog: too many fields")
+)
+
+// Format is the format of a log.
+type Format uint8
+
+const (
+	CSV Format = iota
+	JSON
+	Binary
+)
+
+// Field describes a value of the records of a log.
+type Field struct {
+	Name string
+	Unit string
+
+	// Decimals is the number of decimals of the values, for example 3 for
+	// values in millicelsius logged as degrees.
+	Decimals uint8
+}
+
+// Fields returns count fields called prefix0, prefix1 and so on, for example
+// for the pixels of a thermal camera.
+func Fields(prefix string, count int, unit string, decimals uint8) []Field {
+	fields := make([]Field, count)
+	for i := range fields {
+		fields[i] = Field{Name: prefix + strconv.Itoa(i), Unit: unit, Decimals: decimals}
+	}
+	return fields
+}
+
+// Logger writes records to a log.
+type Logger struct {
+	w       io.Writer
+	format  Format
+	fields  []Field
+	buf     []byte
+	started bool
+	count   int   // data records since the last time record
+	last    int64 // time of the last record in microseconds
+}
+
+// New returns a logger of records with the given fields to w. The header, if
+// the format has one, is written with the first record. Several logs can be
+// written one after the other to the same file, but not interleaved.
+func New(w io.Writer, format Format, fields ...Field) *Logger {
+	return &Logger{w: w, format: format, fields: fields}
+}
+
+// Fields returns the fields of the log.
+func (l *Logger) Fields() []Field {
+	return l.fields
+}
+
+// Log writes a record of values, one per field, taken at time t.
+func (l *Logger) Log(t time.Time, values []int32) error {
+	if len(values) != len(l.fields) {
+		return ErrFieldCount
+	}
+	b := l.buf[:0]
+	count, last := l.count, l.last
+	var err error
+	switch l.format {
+	case CSV:
+		b = l.appendCSV(b, t, values)
+	case JSON:
+		b = l.appendJSON(b, t, values)
+	default:
+		b, count, last, err = l.appendBinary(b, t, values)
+		if err != nil {
+			return err
+		}
+	}
+	l.buf = b
+	if _, err := l.w.Write(b); err != nil {
+		return err
+	}
+	l.started = true
+	l.count, l.last = count, last
+	return nil
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func (l *Logger) appendCSV(b []byte, t time.Time, values []int32) []byte {
+	if !l.started {
+		b = append(b, "time"...)
+		for _, f := range l.fields {
+			name := f.Name
+			if f.Unit != "" {
+				name += " (" + f.Unit + ")"
+			}
+			b = append(b, ',')
+			b = appendCSVString(b, name)
+		}
+		b = append(b, '\n')
+	}
+	b = t.UTC().AppendFormat(b, timeFormat)
+	for i, v := range values {
+		b = append(b, ',')
+		b = appendDecimal(b, v, l.fields[i].Decimals)
+	}
+	return append(b, '\n')
+}
+
+func (l *Logger) appendJSON(b []byte, t time.Time, values []int32) []byte {
+	b = append(b, `{"time":"`...)
+	b = t.UTC().AppendFormat(b, timeFormat)
+	b = append(b, '"')
+	for i, v := range values {
+		b = append(b, ',')
+		b = appendJSONString(b, l.fields[i].Name)
+		b = append(b, ':')
+		b = appendDecimal(b, v, l.fields[i].Decimals)
+	}
+	return append(b, "}\n"...)
+}
+
+// appendDecimal appends v with the given number of decimals.
+func appendDecimal(b []byte, v int32, decimals uint8) []byte {
+	if decimals == 0 {
+		return strconv.AppendInt(b, int64(v), 10)
+	}
+	n := int64(v)
+	if n < 0 {
+		b = append(b, '-')
+		n = -n
+	}
+	digits := strconv.AppendInt(nil, n, 10)
+	for len(digits) <= int(decimals) {
+		digits = append([]byte{'0'}, digits...)
+	}
+	point := len(digits) - int(decimals)
+	b = append(b, digits[:point]...)
+	b = append(b, '.')
+	return append(b, digits[point:]...)
+}
+
+func appendCSVString(b []byte, s string) []byte {
+	quote := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ',' || s[i] == '"' || s[i] == '\n' {
+			quote = true
+		}
+	}
+	if !quote {
+		return append(b, s...)
+	}
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			b = append(b, '"')
+		}
+		b = append(b, s[i])
+	}
+	return append(b, '"')
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '"')
+}
@@ -0,0 +1,262 @@
+package sensorlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"tinygo.org/x/drivers/sensorlog"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 250000000, time.UTC)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	l := sensorlog.New(&buf, sensorlog.CSV,
+		sensorlog.Field{Name: "temperature", Unit: "°C", Decimals: 3},
+		sensorlog.Field{Name: `pressure, "raw"`, Decimals: 2},
+		sensorlog.Field{Name: "count"},
+	)
+	for i, values := range [][]int32{
+		{23456, 101325, 7},
+		{-5, -1234, -1},
+		{-1000, 5, math.MinInt32},
+	} {
+		if err := l.Log(start.Add(time.Duration(i)*time.Second), values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `time,temperature (°C),"pressure, ""raw""",count
+2024-05-01T12:00:00.250Z,23.456,1013.25,7
+2024-05-01T12:00:01.250Z,-0.005,-12.34,-1
+2024-05-01T12:00:02.250Z,-1.000,0.05,-2147483648
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	if err := l.Log(start, []int32{1, 2}); err != sensorlog.ErrFieldCount {
+		t.Errorf("got %v, want %v", err, sensorlog.ErrFieldCount)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	fields := []sensorlog.Field{
+		{Name: `say "hi"\`, Decimals: 1},
+		{Name: "line\nbreak\x01"},
+	}
+	l := sensorlog.New(&buf, sensorlog.JSON, fields...)
+	if err := l.Log(start.In(time.FixedZone("", 3600)), []int32{-15, 42}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"time":"2024-05-01T12:00:00.250Z","say \"hi\"\\":-1.5,"line\u000abreak\u0001":42}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got  %s\nwant %s", buf.String(), want)
+	}
+
+	// which is valid JSON
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m[fields[0].Name] != -1.5 || m[fields[1].Name] != 42.0 {
+		t.Errorf("got %v", m)
+	}
+}
+
+// entry is a record written to a log.
+type entry struct {
+	time   time.Time
+	values []int32
+}
+
+// writeLog logs n records of fields to w, with the times of times, and
+// returns them with the offset in w of each.
+func writeLog(t *testing.T, w *bytes.Buffer, fields []sensorlog.Field, n int, times func(i int) time.Time) ([]entry, []int) {
+	t.Helper()
+	l := sensorlog.New(w, sensorlog.Binary, fields...)
+	entries := make([]entry, n)
+	offsets := make([]int, n)
+	for i := range entries {
+		values := make([]int32, len(fields))
+		for j := range values {
+			values[j] = int32((i*7919+j*104729)%200001 - 100000)
+		}
+		values[0] = int32(i)
+		entries[i] = entry{times(i), values}
+		offsets[i] = w.Len()
+		if err := l.Log(entries[i].time, values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entries, offsets
+}
+
+// check decodes the log in data, and compares its records to want.
+func check(t *testing.T, data []byte, want []entry, fields [][]sensorlog.Field) *sensorlog.Decoder {
+	t.Helper()
+	d := sensorlog.NewDecoder(bytes.NewReader(data))
+	for i, e := range want {
+		rec, err := d.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if !rec.Time.Equal(e.time) || !equal(rec.Values, e.values) || !sameFields(rec.Fields, fields[i]) {
+			t.Fatalf("record %d: got %v %v %v, want %v %v %v", i, rec.Time, rec.Values, rec.Fields, e.time, e.values, fields[i])
+		}
+	}
+	if rec, err := d.Next(); err != io.EOF {
+		t.Errorf("after the last record: got %v, %v", rec, err)
+	}
+	return d
+}
+
+func TestBinary(t *testing.T) {
+	fields := []sensorlog.Field{
+		{Name: "index"},
+		{Name: "acceleration", Unit: "µg"},
+		{Name: "temperature", Unit: "°C", Decimals: 3},
+	}
+	var buf bytes.Buffer
+	// over several time records, with a step back in time
+	entries, _ := writeLog(t, &buf, fields, 200, func(i int) time.Time {
+		if i >= 150 {
+			i -= 20
+		}
+		return start.Add(time.Duration(i) * 10013 * time.Microsecond)
+	})
+	// and a second log of other fields after it
+	more := sensorlog.Fields("pixel", 64, "°C", 2)
+	entries2, _ := writeLog(t, &buf, more, 10, func(i int) time.Time {
+		return start.Add(time.Hour + time.Duration(i)*time.Second)
+	})
+
+	var fields2 [][]sensorlog.Field
+	for range entries {
+		fields2 = append(fields2, fields)
+	}
+	for range entries2 {
+		fields2 = append(fields2, more)
+	}
+	d := check(t, buf.Bytes(), append(entries, entries2...), fields2)
+	if d.Skipped != 0 {
+		t.Errorf("skipped %d bytes", d.Skipped)
+	}
+}
+
+func TestBinaryResync(t *testing.T) {
+	fields := []sensorlog.Field{{Name: "index"}, {Name: "value"}}
+	var buf bytes.Buffer
+	entries, offsets := writeLog(t, &buf, fields, 200, func(i int) time.Time {
+		return start.Add(time.Duration(i) * time.Millisecond)
+	})
+	data := buf.Bytes()
+	data[offsets[100]+5] ^= 0x40
+
+	// record 100 is lost, and the times of the data records after it
+	// unknown until the time record before record 128
+	want := append(entries[:100:100], entries[128:]...)
+	var fields2 [][]sensorlog.Field
+	for range want {
+		fields2 = append(fields2, fields)
+	}
+	d := check(t, data, want, fields2)
+	// the corrupted record, and the payloads of the records without a time
+	if d.Skipped < offsets[101]-offsets[100] {
+		t.Errorf("skipped %d bytes", d.Skipped)
+	}
+
+	// a log cut in the middle of a record
+	data = data[:offsets[199]+3]
+	check(t, data, want[:len(want)-1], fields2)
+}
+
+// failing fails the writes while fail is set.
+type failing struct {
+	bytes.Buffer
+	fail bool
+}
+
+var errWrite = errors.New("write failed")
+
+func (w *failing) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errWrite
+	}
+	return w.Buffer.Write(p)
+}
+
+// TestBinaryWriteError checks that a record that could not be written
+// doesn't change the time of the next.
+func TestBinaryWriteError(t *testing.T) {
+	fields := []sensorlog.Field{{Name: "value"}}
+	var w failing
+	l := sensorlog.New(&w, sensorlog.Binary, fields...)
+	var entries []entry
+	for i := 0; i < 140; i++ {
+		e := entry{start.Add(time.Duration(i) * time.Second), []int32{int32(i)}}
+		// the first record, with the header, and some around time records
+		w.fail = i == 0 || i == 70 || i > 100 && i < 130 && i%3 == 0
+		err := l.Log(e.time, e.values)
+		if w.fail {
+			if err != errWrite {
+				t.Fatalf("record %d: got %v, want %v", i, err, errWrite)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	var fields2 [][]sensorlog.Field
+	for range entries {
+		fields2 = append(fields2, fields)
+	}
+	check(t, w.Bytes(), entries, fields2)
+}
+
+func TestBinaryTooManyFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := sensorlog.New(&buf, sensorlog.Binary, sensorlog.Fields("f", 256, "", 0)...)
+	if err := l.Log(start, make([]int32, 256)); err != sensorlog.ErrTooManyFields {
+		t.Errorf("got %v, want %v", err, sensorlog.ErrTooManyFields)
+	}
+	name := strings.Repeat("n", 255)
+	l = sensorlog.New(&buf, sensorlog.Binary, sensorlog.Fields(name, 20, name, 0)...)
+	if err := l.Log(start, make([]int32, 20)); err != sensorlog.ErrTooManyFields {
+		t.Errorf("header of %d bytes: got %v, want %v", 20*2*256, err, sensorlog.ErrTooManyFields)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes", buf.Len())
+	}
+}
+
+func equal(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFields(a, b []sensorlog.Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,380 @@
+// Package esptool implements the serial protocol of the ESP32 ROM bootloader,
+// as used by Espressif's esptool.py, to write and verify the flash memory of
+// an ESP32 such as the NINA-W102 module on WiFiNINA boards.
+//
+// Commands and responses are framed with SLIP (RFC 1055). The package only
+// needs an io.ReadWriter connected to the bootloader, so it can be used both
+// from a microcontroller UART and from a host serial port.
+//
+// Protocol description:
+// https://docs.espressif.com/projects/esptool/en/latest/esp32/advanced-topics/serial-protocol.html
+package esptool // import "tinygo.org/x/drivers/wifinina/esptool"
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Bootloader command opcodes.
+const (
+	CmdFlashBegin    = 0x02
+	CmdFlashData     = 0x03
+	CmdFlashEnd      = 0x04
+	CmdMemBegin      = 0x05
+	CmdMemEnd        = 0x06
+	CmdMemData       = 0x07
+	CmdSync          = 0x08
+	CmdWriteReg      = 0x09
+	CmdReadReg       = 0x0A
+	CmdSPISetParams  = 0x0B
+	CmdSPIAttach     = 0x0D
+	CmdChangeBaud    = 0x0F
+	CmdSPIFlashMD5   = 0x13
+	CmdFlashDeflBeg  = 0x10
+	CmdFlashDeflData = 0x11
+	CmdFlashDeflEnd  = 0x12
+)
+
+const (
+	// FlashBlockSize is the largest payload of a FLASH_DATA command accepted
+	// by the ROM bootloader.
+	FlashBlockSize = 0x400
+
+	// FlashSectorSize is the erase granularity of the flash.
+	FlashSectorSize = 0x1000
+
+	// checksumSeed is the initial value of the FLASH_DATA checksum.
+	checksumSeed = 0xEF
+
+	// statusLen is the number of status bytes at the end of each response
+	// from the ESP32 ROM bootloader.
+	statusLen = 4
+
+	// DefaultTimeout is the time to wait for a response to most commands.
+	DefaultTimeout = 3 * time.Second
+
+	// eraseTimeoutPerMB and md5TimeoutPerMB scale the timeouts of commands
+	// whose duration depends on the size of the flash region.
+	eraseTimeoutPerMB = 30 * time.Second
+	md5TimeoutPerMB   = 8 * time.Second
+
+	syncAttempts = 7
+	syncTimeout  = 100 * time.Millisecond
+)
+
+var (
+	ErrTimeout     = errors.New("esptool: timeout waiting for response")
+	ErrNoSync      = errors.New("esptool: bootloader did not respond to sync")
+	ErrShortReply  = errors.New("esptool: response too short")
+	ErrMD5Mismatch = errors.New("esptool: flash MD5 does not match")
+	ErrShortImage  = errors.New("esptool: image is shorter than its size")
+)
+
+// StatusError is returned when the bootloader reports a failed command.
+type StatusError struct {
+	Command byte
+	Code    byte
+}
+
+func (e StatusError) Error() string {
+	msg := "unknown error 0x" + strconv.FormatUint(uint64(e.Code), 16)
+	switch e.Code {
+	case 0x05:
+		msg = "received message is invalid"
+	case 0x06:
+		msg = "failed to act on received message"
+	case 0x07:
+		msg = "invalid CRC in message"
+	case 0x08:
+		msg = "flash write error"
+	case 0x09:
+		msg = "flash read error"
+	case 0x0A:
+		msg = "flash read length error"
+	case 0x0B:
+		msg = "deflate error"
+	}
+	return "esptool: command 0x" + strconv.FormatUint(uint64(e.Command), 16) + " failed: " + msg
+}
+
+// Loader talks to the ROM bootloader of an ESP32.
+type Loader struct {
+	rw  io.ReadWriter
+	dec *Decoder
+	tx  []byte
+	rx  [64]byte
+}
+
+// NewLoader returns a Loader using rw, which must be connected to an ESP32
+// that has been reset into the serial bootloader. Reads from rw may return no
+// data without an error; the loader polls until its timeouts expire.
+func NewLoader(rw io.ReadWriter) *Loader {
+	return &Loader{
+		rw:  rw,
+		dec: NewDecoder(128),
+		tx:  make([]byte, 0, 2*(8+16+FlashBlockSize)+2),
+	}
+}
+
+// Command sends a command and waits for its response, returning the value
+// field and the response data without the status bytes.
+func (l *Loader) Command(op byte, data []byte, checksum uint32, timeout time.Duration) (uint32, []byte, error) {
+	var hdr [8]byte
+	hdr[0] = 0x00
+	hdr[1] = op
+	putUint16(hdr[2:], uint16(len(data)))
+	putUint32(hdr[4:], checksum)
+
+	l.tx = append(l.tx[:0], slipEnd)
+	l.tx = appendEscaped(l.tx, hdr[:])
+	l.tx = appendEscaped(l.tx, data)
+	l.tx = append(l.tx, slipEnd)
+	if _, err := l.rw.Write(l.tx); err != nil {
+		return 0, nil, err
+	}
+	return l.response(op, timeout)
+}
+
+// response waits for the response to op, skipping unrelated frames such as
+// the additional replies to SYNC.
+func (l *Loader) response(op byte, timeout time.Duration) (uint32, []byte, error) {
+	expire := time.Now().Add(timeout)
+	for {
+		n, err := l.rw.Read(l.rx[:])
+		if err != nil {
+			return 0, nil, err
+		}
+		if n == 0 {
+			if time.Now().After(expire) {
+				return 0, nil, ErrTimeout
+			}
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			if !l.dec.Feed(l.rx[i]) {
+				continue
+			}
+			frame := l.dec.Frame()
+			if len(frame) < 8 || frame[0] != 0x01 || frame[1] != op {
+				continue
+			}
+			size := int(frame[2]) | int(frame[3])<<8
+			value := getUint32(frame[4:])
+			body := frame[8:]
+			if len(body) < size || size < 2 {
+				return 0, nil, ErrShortReply
+			}
+			body = body[:size]
+			// the ESP32 ROM sends 4 status bytes, the flasher stub only 2
+			sl := statusLen
+			if size < sl {
+				sl = 2
+			}
+			status := body[len(body)-sl:]
+			if status[0] != 0 {
+				return value, nil, StatusError{Command: op, Code: status[1]}
+			}
+			return value, body[:len(body)-sl], nil
+		}
+	}
+}
+
+// Sync synchronizes with the bootloader, which also lets it detect the baud
+// rate.
+func (l *Loader) Sync() error {
+	var data [36]byte
+	data[0], data[1], data[2], data[3] = 0x07, 0x07, 0x12, 0x20
+	for i := 4; i < len(data); i++ {
+		data[i] = 0x55
+	}
+	for i := 0; i < syncAttempts; i++ {
+		if _, _, err := l.Command(CmdSync, data[:], 0, syncTimeout); err == nil {
+			// drain the remaining replies to the sync command
+			l.response(CmdSync, syncTimeout)
+			return nil
+		}
+	}
+	return ErrNoSync
+}
+
+// ReadReg reads a 32-bit register of the chip.
+func (l *Loader) ReadReg(addr uint32) (uint32, error) {
+	var data [4]byte
+	putUint32(data[:], addr)
+	v, _, err := l.Command(CmdReadReg, data[:], 0, DefaultTimeout)
+	return v, err
+}
+
+// WriteReg writes a 32-bit register of the chip.
+func (l *Loader) WriteReg(addr, value, mask, delayUS uint32) error {
+	var data [16]byte
+	putUint32(data[0:], addr)
+	putUint32(data[4:], value)
+	putUint32(data[8:], mask)
+	putUint32(data[12:], delayUS)
+	_, _, err := l.Command(CmdWriteReg, data[:], 0, DefaultTimeout)
+	return err
+}
+
+// SPIAttach attaches the default SPI flash. The ESP32 ROM requires this
+// before any flash command.
+func (l *Loader) SPIAttach() error {
+	var data [8]byte
+	_, _, err := l.Command(CmdSPIAttach, data[:], 0, DefaultTimeout)
+	return err
+}
+
+// SPISetParams tells the bootloader the geometry of the flash chip.
+func (l *Loader) SPISetParams(totalSize uint32) error {
+	var data [24]byte
+	putUint32(data[0:], 0) // flash ID
+	putUint32(data[4:], totalSize)
+	putUint32(data[8:], 64*1024) // block size
+	putUint32(data[12:], FlashSectorSize)
+	putUint32(data[16:], 256) // page size
+	putUint32(data[20:], 0xFFFF)
+	_, _, err := l.Command(CmdSPISetParams, data[:], 0, DefaultTimeout)
+	return err
+}
+
+// FlashBegin erases the region of size bytes at offset and prepares it to
+// receive data in blocks of FlashBlockSize.
+func (l *Loader) FlashBegin(offset, size uint32) error {
+	blocks := (size + FlashBlockSize - 1) / FlashBlockSize
+	erase := (size + FlashSectorSize - 1) &^ (FlashSectorSize - 1)
+	var data [16]byte
+	putUint32(data[0:], erase)
+	putUint32(data[4:], blocks)
+	putUint32(data[8:], FlashBlockSize)
+	putUint32(data[12:], offset)
+	_, _, err := l.Command(CmdFlashBegin, data[:], 0, scaledTimeout(eraseTimeoutPerMB, erase))
+	return err
+}
+
+// FlashData writes block number seq. Blocks shorter than FlashBlockSize are
+// padded with 0xFF.
+func (l *Loader) FlashData(seq uint32, block []byte) error {
+	var buf [16 + FlashBlockSize]byte
+	putUint32(buf[0:], FlashBlockSize)
+	putUint32(buf[4:], seq)
+	n := copy(buf[16:], block)
+	for i := 16 + n; i < len(buf); i++ {
+		buf[i] = 0xFF
+	}
+	_, _, err := l.Command(CmdFlashData, buf[:], checksum(buf[16:]), DefaultTimeout)
+	return err
+}
+
+// FlashEnd finishes writing. If reboot is true the chip leaves the
+// bootloader and runs the application.
+func (l *Loader) FlashEnd(reboot bool) error {
+	var data [4]byte
+	if !reboot {
+		data[0] = 1
+	}
+	_, _, err := l.Command(CmdFlashEnd, data[:], 0, DefaultTimeout)
+	return err
+}
+
+// FlashMD5 returns the MD5 digest of size bytes of flash at offset, as
+// computed by the chip.
+func (l *Loader) FlashMD5(offset, size uint32) ([md5.Size]byte, error) {
+	var sum [md5.Size]byte
+	var data [16]byte
+	putUint32(data[0:], offset)
+	putUint32(data[4:], size)
+	_, body, err := l.Command(CmdSPIFlashMD5, data[:], 0, scaledTimeout(md5TimeoutPerMB, size))
+	if err != nil {
+		return sum, err
+	}
+	switch len(body) {
+	case 2 * md5.Size:
+		// the ROM returns the digest as hex digits
+		if _, err := hex.Decode(sum[:], body); err != nil {
+			return sum, ErrShortReply
+		}
+	case md5.Size:
+		copy(sum[:], body)
+	default:
+		return sum, ErrShortReply
+	}
+	return sum, nil
+}
+
+// WriteFlash erases the region at offset and writes size bytes read from r,
+// then verifies the written data using the MD5 digest computed by the chip.
+// The progress callback, if not nil, is called after each block with the
+// number of bytes written so far.
+func (l *Loader) WriteFlash(offset uint32, r io.Reader, size int, progress func(written, total int)) error {
+	if err := l.FlashBegin(offset, uint32(size)); err != nil {
+		return err
+	}
+	h := md5.New()
+	var block [FlashBlockSize]byte
+	written := 0
+	for seq := uint32(0); written < size; seq++ {
+		n := size - written
+		if n > FlashBlockSize {
+			n = FlashBlockSize
+		}
+		if _, err := io.ReadFull(r, block[:n]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrShortImage
+			}
+			return err
+		}
+		h.Write(block[:n])
+		if err := l.FlashData(seq, block[:n]); err != nil {
+			return err
+		}
+		written += n
+		if progress != nil {
+			progress(written, size)
+		}
+	}
+
+	sum, err := l.FlashMD5(offset, uint32(size))
+	if err != nil {
+		return err
+	}
+	var expected [md5.Size]byte
+	copy(expected[:], h.Sum(nil))
+	if sum != expected {
+		return ErrMD5Mismatch
+	}
+	return nil
+}
+
+// checksum computes the FLASH_DATA payload checksum.
+func checksum(data []byte) uint32 {
+	c := byte(checksumSeed)
+	for _, b := range data {
+		c ^= b
+	}
+	return uint32(c)
+}
+
+func scaledTimeout(perMB time.Duration, size uint32) time.Duration {
+	t := time.Duration(uint64(perMB) * uint64(size) / 1e6)
+	if t < DefaultTimeout {
+		return DefaultTimeout
+	}
+	return t
+}
+
+func putUint16(b []byte, v uint16) {
+	b[0], b[1] = byte(v), byte(v>>8)
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0], b[1], b[2], b[3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+}
+
+func getUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
@@ -0,0 +1,110 @@
+package esptool
+
+// SLIP special characters (RFC 1055).
+const (
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+// AppendSLIP appends frame to dst, escaped and delimited by SLIP END bytes.
+func AppendSLIP(dst, frame []byte) []byte {
+	dst = append(dst, slipEnd)
+	dst = appendEscaped(dst, frame)
+	return append(dst, slipEnd)
+}
+
+// appendEscaped appends data to dst, escaping the SLIP special characters.
+func appendEscaped(dst, data []byte) []byte {
+	for _, b := range data {
+		switch b {
+		case slipEnd:
+			dst = append(dst, slipEsc, slipEscEnd)
+		case slipEsc:
+			dst = append(dst, slipEsc, slipEscEsc)
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return dst
+}
+
+// Decoder extracts SLIP frames from a byte stream. Bytes outside of frames
+// are ignored, as are frames longer than the buffer and frames with invalid
+// escape sequences.
+type Decoder struct {
+	buf      []byte
+	n        int
+	started  bool
+	escaped  bool
+	overflow bool
+	invalid  bool
+}
+
+// NewDecoder returns a decoder for frames of up to size bytes.
+func NewDecoder(size int) *Decoder {
+	return &Decoder{buf: make([]byte, size)}
+}
+
+// Feed adds one byte of input. It returns true when b completes a frame,
+// which is then available from Frame until the next call to Feed.
+func (d *Decoder) Feed(b byte) bool {
+	if b == slipEnd {
+		if !d.started || d.n == 0 {
+			// either the start of a frame or a run of END bytes
+			d.started = true
+			d.reset()
+			return false
+		}
+		ok := !d.overflow && !d.invalid && !d.escaped
+		if !ok {
+			d.reset()
+		}
+		// After a good frame the END byte only closes it, as every frame
+		// has its own pair of END bytes. After a bad frame it may instead
+		// have been the start of the next one, for example after noise.
+		d.started = !ok
+		return ok
+	}
+	if !d.started {
+		return false
+	}
+	if d.escaped {
+		d.escaped = false
+		switch b {
+		case slipEscEnd:
+			b = slipEnd
+		case slipEscEsc:
+			b = slipEsc
+		default:
+			d.invalid = true
+		}
+	} else if b == slipEsc {
+		d.escaped = true
+		return false
+	}
+	if d.n == len(d.buf) {
+		d.overflow = true
+		return false
+	}
+	d.buf[d.n] = b
+	d.n++
+	return false
+}
+
+// Frame returns the last complete frame. The slice is only valid until the
+// next call to Feed.
+func (d *Decoder) Frame() []byte {
+	frame := d.buf[:d.n]
+	d.n = 0
+	d.started = false
+	return frame
+}
+
+func (d *Decoder) reset() {
+	d.n = 0
+	d.escaped = false
+	d.overflow = false
+	d.invalid = false
+}
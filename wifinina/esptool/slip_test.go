@@ -0,0 +1,114 @@
+package esptool
+
+import (
+	"bytes"
+	"testing"
+)
+
+// decodeAll feeds data to d and returns the frames it completes.
+func decodeAll(d *Decoder, data []byte) [][]byte {
+	var frames [][]byte
+	for _, b := range data {
+		if d.Feed(b) {
+			frames = append(frames, append([]byte(nil), d.Frame()...))
+		}
+	}
+	return frames
+}
+
+func TestAppendSLIP(t *testing.T) {
+	got := AppendSLIP([]byte{0x01}, []byte{0x02, 0xC0, 0x03, 0xDB, 0xDC, 0xDD})
+	want := []byte{0x01, 0xC0, 0x02, 0xDB, 0xDC, 0x03, 0xDB, 0xDD, 0xDC, 0xDD, 0xC0}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	frames := [][]byte{
+		{0x00, 0x08, 0x24, 0x00},
+		{0xC0},
+		{0xDB},
+		{0xC0, 0xDB, 0xDC, 0xDD, 0xC0, 0xC0},
+		bytes.Repeat([]byte{0xDB}, 32), // escapes double the size on the wire
+	}
+	var stream []byte
+	for _, f := range frames {
+		stream = AppendSLIP(stream, f)
+	}
+	got := decodeAll(NewDecoder(32), stream)
+	if len(got) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(got), len(frames))
+	}
+	for i := range frames {
+		if !bytes.Equal(got[i], frames[i]) {
+			t.Errorf("frame %d: got % x, want % x", i, got[i], frames[i])
+		}
+	}
+}
+
+func TestDecoderFraming(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stream []byte
+		want   [][]byte
+	}{
+		{
+			name:   "back to back",
+			stream: []byte{0xC0, 1, 2, 0xC0, 0xC0, 3, 0xC0},
+			want:   [][]byte{{1, 2}, {3}},
+		},
+		{
+			name:   "runs of END bytes",
+			stream: []byte{0xC0, 0xC0, 0xC0, 1, 0xC0, 0xC0, 0xC0, 2, 0xC0},
+			want:   [][]byte{{1}, {2}},
+		},
+		{
+			name:   "bytes outside of frames",
+			stream: []byte{9, 9, 0xC0, 1, 0xC0, 9, 9, 0xC0, 2, 0xC0},
+			want:   [][]byte{{1}, {2}},
+		},
+		{
+			name:   "overflow",
+			stream: []byte{0xC0, 1, 2, 3, 4, 5, 0xC0, 0xC0, 6, 7, 8, 9, 0xC0},
+			want:   [][]byte{{6, 7, 8, 9}},
+		},
+		{
+			name:   "escaped bytes count once",
+			stream: []byte{0xC0, 0xDB, 0xDC, 0xDB, 0xDD, 1, 2, 0xC0},
+			want:   [][]byte{{0xC0, 0xDB, 1, 2}},
+		},
+		{
+			name:   "invalid escape",
+			stream: []byte{0xC0, 1, 0xDB, 0x05, 2, 0xC0, 0xC0, 3, 0xC0},
+			want:   [][]byte{{3}},
+		},
+		{
+			name:   "truncated by an END after ESC",
+			stream: []byte{0xC0, 1, 0xDB, 0xC0, 0xC0, 3, 0xC0},
+			want:   [][]byte{{3}},
+		},
+		{
+			// the END of a bad frame may have been the start of the next one
+			name:   "resynchronize after a bad frame",
+			stream: []byte{0xC0, 1, 2, 3, 4, 5, 0xC0, 6, 0xC0},
+			want:   [][]byte{{6}},
+		},
+		{
+			name:   "unterminated",
+			stream: []byte{0xC0, 1, 0xC0, 0xC0, 2, 3},
+			want:   [][]byte{{1}},
+		},
+	} {
+		got := decodeAll(NewDecoder(4), tc.stream)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got frames % x, want % x", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], tc.want[i]) {
+				t.Errorf("%s: frame %d: got % x, want % x", tc.name, i, got[i], tc.want[i])
+			}
+		}
+	}
+}
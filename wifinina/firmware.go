@@ -0,0 +1,134 @@
+package wifinina
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"machine"
+
+	"tinygo.org/x/drivers/wifinina/esptool"
+)
+
+const (
+	// FirmwareOffset is the flash address of the combined NINA firmware
+	// image as published at https://github.com/arduino/nina-fw/releases.
+	FirmwareOffset = 0x0
+
+	// CertificatesOffset and CertificatesSize describe the "certs" partition
+	// of the NINA firmware, which holds the root certificates used for TLS
+	// connections as concatenated PEM blocks.
+	CertificatesOffset = 0x10000
+	CertificatesSize   = 0x20000
+
+	// FlashSize is the size of the flash memory of the NINA-W102 module.
+	FlashSize = 2 * 1024 * 1024
+
+	// BootloaderBaudRate is the baud rate to configure the UART connected to
+	// the NINA module with before calling UpdateFirmware or
+	// UploadCertificates. The ROM bootloader detects the baud rate, but
+	// 115200 is known to work on all boards.
+	BootloaderBaudRate = 115200
+)
+
+var (
+	ErrFirmwareTooLarge     = errors.New("wifinina: firmware image too large")
+	ErrCertificatesTooLarge = errors.New("wifinina: certificates too large")
+)
+
+// Reset restarts the NINA module into the WiFiNINA firmware.
+func (d *Device) Reset() {
+	d.GPIO0.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	d.GPIO0.High()
+	d.CS.High()
+	d.RESET.Low()
+	time.Sleep(1 * time.Millisecond)
+	d.RESET.High()
+	time.Sleep(1 * time.Millisecond)
+
+	d.GPIO0.Low()
+	d.GPIO0.Configure(machine.PinConfig{Mode: machine.PinInput})
+}
+
+// EnterBootloader restarts the NINA module into its ROM serial bootloader by
+// holding GPIO0 low during reset. The bootloader listens on the UART that
+// connects the module to the microcontroller (NINA_TX/NINA_RX). Call Reset
+// to return to the WiFiNINA firmware.
+func (d *Device) EnterBootloader() {
+	d.GPIO0.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	d.RESET.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	d.GPIO0.Low()
+	d.RESET.Low()
+	time.Sleep(100 * time.Millisecond)
+	d.RESET.High()
+	time.Sleep(100 * time.Millisecond)
+	d.GPIO0.High()
+}
+
+// UpdateFirmware writes a new NINA firmware image of size bytes read from fw,
+// for example a flash.Device section or a file, and verifies it by MD5. The
+// UART must be connected to the module and configured with
+// BootloaderBaudRate. The progress callback may be nil. The module is reset
+// into the new firmware when done, even if the update failed.
+func (d *Device) UpdateFirmware(uart *machine.UART, fw io.Reader, size int, progress func(written, total int)) error {
+	if size > FlashSize-FirmwareOffset {
+		return ErrFirmwareTooLarge
+	}
+	return d.writeFlash(uart, FirmwareOffset, fw, size, progress)
+}
+
+// UploadCertificates replaces the root certificate store of the NINA
+// firmware with the PEM encoded certificates of size bytes read from pem.
+// The UART requirements are the same as for UpdateFirmware.
+func (d *Device) UploadCertificates(uart *machine.UART, pem io.Reader, size int) error {
+	// the firmware expects the store to be terminated by a zero byte
+	if size+1 > CertificatesSize {
+		return ErrCertificatesTooLarge
+	}
+	r := io.MultiReader(pem, bytes.NewReader([]byte{0}))
+	return d.writeFlash(uart, CertificatesOffset, r, size+1, nil)
+}
+
+func (d *Device) writeFlash(uart *machine.UART, offset uint32, r io.Reader, size int, progress func(written, total int)) error {
+	d.EnterBootloader()
+	defer d.Reset()
+
+	// discard boot messages printed by the ROM
+	var discard [16]byte
+	for uart.Buffered() > 0 {
+		uart.Read(discard[:])
+	}
+
+	l := esptool.NewLoader(uart)
+	if err := l.Sync(); err != nil {
+		return err
+	}
+	if err := l.SPIAttach(); err != nil {
+		return err
+	}
+	if err := l.SPISetParams(FlashSize); err != nil {
+		return err
+	}
+	if err := l.WriteFlash(offset, r, size, progress); err != nil {
+		return err
+	}
+	return l.FlashEnd(false)
+}
+
+// Passthrough resets the NINA module into its bootloader and then forwards
+// all data between host and nina, so that tools running on a computer, such
+// as esptool.py or the Arduino firmware updater, can flash the module
+// through the microcontroller. It never returns.
+func (d *Device) Passthrough(host, nina *machine.UART) {
+	d.EnterBootloader()
+	var buf [64]byte
+	for {
+		if n, _ := host.Read(buf[:]); n > 0 {
+			nina.Write(buf[:n])
+		}
+		if n, _ := nina.Read(buf[:]); n > 0 {
+			host.Write(buf[:n])
+		}
+	}
+}
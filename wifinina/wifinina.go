@@ -275,18 +275,8 @@ func (d *Device) Configure() {
 	d.CS.Configure(machine.PinConfig{machine.PinOutput})
 	d.ACK.Configure(machine.PinConfig{machine.PinInput})
 	d.RESET.Configure(machine.PinConfig{machine.PinOutput})
-	d.GPIO0.Configure(machine.PinConfig{machine.PinOutput})
-
-	d.GPIO0.High()
-	d.CS.High()
-	d.RESET.Low()
-	time.Sleep(1 * time.Millisecond)
-	d.RESET.High()
-	time.Sleep(1 * time.Millisecond)
-
-	d.GPIO0.Low()
-	d.GPIO0.Configure(machine.PinConfig{machine.PinInput})
 
+	d.Reset()
 }
 
 // ----------- client methods (should this be a separate struct?) ------------